@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -40,10 +41,10 @@ type AT struct {
 	// closed when modem is closed
 	closed chan struct{}
 
-	// channel for all lines read from the modem
+	// channel for all lines read from the modem, stamped with the time read
 	//
 	// Handled by the indLoop.
-	iLines chan string
+	iLines chan stampedLine
 
 	// channel for lines read from the modem after indications removed
 	//
@@ -73,6 +74,48 @@ type AT struct {
 	//
 	// Only accessed from the cmdLoop.
 	escGuard *time.Timer
+
+	// diagMu protects diag.
+	diagMu sync.Mutex
+
+	// if not-nil, the report recording the commands issued.
+	diag *DiagnosticsReport
+
+	// if not-nil, the journal of recent commands and indications.
+	journal *journal
+
+	// the counters of the traffic over the port.
+	stats *stats
+
+	// the counters of the calls to indication handlers.
+	indStats *indicationStats
+
+	// if not-nil, the policy restricting the commands that may be issued.
+	policy *policy
+
+	// pendingMu protects pending.
+	pendingMu sync.Mutex
+
+	// the ID of the command currently awaiting a response, if any.
+	pending string
+
+	// if not-nil, the tracer creating spans for commands.
+	tracer Tracer
+
+	// if not-nil, the modem annotating its traffic with command IDs.
+	correlator Correlator
+
+	// activityMu protects active and lastActive.
+	activityMu sync.Mutex
+
+	// the number of commands queued or in progress.
+	active int
+
+	// the time the most recent command completed.
+	lastActive time.Time
+
+	// if true, errors returned by commands are wrapped in a CommandError.
+	errContext bool
 }
 
 // Option is a construction option for an AT.
@@ -92,16 +135,22 @@ type InitOption interface {
 
 // New creates a new AT modem.
 func New(modem io.ReadWriter, options ...Option) *AT {
+	st := &stats{}
+	c, _ := modem.(Correlator)
 	a := &AT{
-		modem:      modem,
+		modem:      countingModem{modem, st},
+		stats:      st,
+		indStats:   newIndicationStats(),
 		cmdCh:      make(chan func()),
 		indCh:      make(chan func()),
-		iLines:     make(chan string),
+		iLines:     make(chan stampedLine),
 		cLines:     make(chan string),
 		closed:     make(chan struct{}),
 		escTime:    20 * time.Millisecond,
 		cmdTimeout: time.Second,
 		inds:       make(map[string]Indication),
+		lastActive: time.Now(),
+		correlator: c,
 	}
 	for _, option := range options {
 		option.applyOption(a)
@@ -112,9 +161,9 @@ func New(modem io.ReadWriter, options ...Option) *AT {
 			"E0", // disable echo
 		}
 	}
-	go lineReader(a.modem, a.iLines)
+	go lineReader(a.modem, a.iLines, a.stats)
 	go a.indLoop(a.indCh, a.iLines, a.cLines)
-	go cmdLoop(a.cmdCh, a.cLines, a.closed)
+	go cmdLoop(a.cmdCh, a.cLines, a.closed, a.stats)
 	return a
 }
 
@@ -143,11 +192,34 @@ func (o EscTimeOption) applyOption(a *AT) {
 // InfoHandler receives indication info.
 type InfoHandler func([]string)
 
+// StampedInfoHandler receives indication info along with the time the
+// indication was read from the modem.
+//
+// The time is taken as the first line of the indication is read, rather than
+// when the handler runs, so it is accurate even when handlers are delayed
+// under load.  It includes both the wall clock and the monotonic clock, so
+// intervals between indications, as determined using Sub, are unaffected by
+// changes to the wall clock.
+type StampedInfoHandler func(info []string, t time.Time)
+
 // WithIndication adds an indication during construction.
 func WithIndication(prefix string, handler InfoHandler, options ...IndicationOption) Indication {
+	return newIndication(prefix, unstamped(handler), options...)
+}
+
+// WithStampedIndication adds an indication, passed the time it was read from
+// the modem, during construction.
+func WithStampedIndication(prefix string, handler StampedInfoHandler, options ...IndicationOption) Indication {
 	return newIndication(prefix, handler, options...)
 }
 
+// unstamped adapts an InfoHandler to a StampedInfoHandler.
+func unstamped(handler InfoHandler) StampedInfoHandler {
+	return func(info []string, _ time.Time) {
+		handler(info)
+	}
+}
+
 func (o Indication) applyOption(a *AT) {
 	a.inds[o.prefix] = o
 }
@@ -192,9 +264,57 @@ func (o TimeoutOption) applyCommandOption(c *commandConfig) {
 	c.timeout = time.Duration(o)
 }
 
+// LineHandler receives individual info lines returned by a command.
+type LineHandler func(string)
+
+// WithLineHandler specifies a handler to receive the info lines returned by a
+// command as they are read from the modem.
+//
+// The lines passed to the handler are not included in the info returned by
+// the command, so the memory required to process a command with a large
+// response is bounded.
+//
+// The handler is called from the goroutine serialising access to the modem,
+// so it must not issue commands to the modem itself.
+func WithLineHandler(h LineHandler) LineHandlerOption {
+	return LineHandlerOption(h)
+}
+
+// LineHandlerOption specifies a handler to receive info lines as they are
+// read from the modem.
+type LineHandlerOption LineHandler
+
+func (o LineHandlerOption) applyCommandOption(c *commandConfig) {
+	c.lh = LineHandler(o)
+}
+
+// LayerOption is embedded by the command options of packages layered above
+// the AT driver, such as gsm, which are passed with the command options to
+// the methods of that layer, but which are consumed by the layer itself.
+//
+// The value names the option, e.g. "gsm.WithSendProgress".
+//
+// Such an option should never reach the driver, so if it does, as it was
+// passed to a method that does not support it, the command fails with
+// ErrUnsupportedOption rather than the option being silently ignored.
+type LayerOption string
+
+func (o LayerOption) applyCommandOption(c *commandConfig) {
+	if c.err == nil {
+		c.err = ErrUnsupportedOption(o)
+	}
+}
+
 // AddIndication adds a handler for a set of lines beginning with the prefixed
 // line and the following trailing lines.
 func (a *AT) AddIndication(prefix string, handler InfoHandler, options ...IndicationOption) (err error) {
+	return a.AddStampedIndication(prefix, unstamped(handler), options...)
+}
+
+// AddStampedIndication adds a handler for a set of lines beginning with the
+// prefixed line and the following trailing lines, which is also passed the
+// time the indication was read from the modem.
+func (a *AT) AddStampedIndication(prefix string, handler StampedInfoHandler, options ...IndicationOption) (err error) {
 	ind := newIndication(prefix, handler, options...)
 	errs := make(chan error)
 	indf := func() {
@@ -245,13 +365,22 @@ func (a *AT) Closed() <-chan struct{} {
 // the command and the status line), or an error if the command did not
 // complete successfully.
 func (a *AT) Command(cmd string, options ...CommandOption) ([]string, error) {
+	defer a.beginCommand()()
 	cfg := commandConfig{timeout: a.cmdTimeout}
 	for _, option := range options {
 		option.applyCommandOption(&cfg)
 	}
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+	if err := a.authorize(cmd); err != nil {
+		return nil, err
+	}
 	done := make(chan response)
 	cmdf := func() {
-		info, err := a.processReq(cmd, cfg.timeout)
+		info, err := a.exchange(cmd, func() ([]string, error) {
+			return a.processReq(cmd, cfg)
+		})
 		done <- response{info: info, err: err}
 	}
 	select {
@@ -291,7 +420,7 @@ func (a *AT) Escape(b ...byte) {
 // also be used subsequently to return the modem to a known state.
 //
 // The default init commands can be overridden by the options parameter.
-func (a *AT) Init(options ...InitOption) error {
+func (a *AT) Init(options ...InitOption) (err error) {
 	// escape any outstanding SMS operations then CR to flush the command
 	// buffer
 	a.Escape([]byte("\r\n")...)
@@ -300,11 +429,17 @@ func (a *AT) Init(options ...InitOption) error {
 	for _, option := range options {
 		option.applyInitOption(&cfg)
 	}
+	if cfg.diag != nil && a.StartDiagnostics(cfg.diag) {
+		defer func() {
+			a.StopDiagnostics()
+			cfg.diag.Err = err
+		}()
+	}
 	for _, cmd := range cfg.cmds {
-		_, err := a.Command(cmd, cfg.cmdOpts...)
-		switch err {
-		case nil:
-		case ErrDeadlineExceeded:
+		_, err = a.Command(cmd, cfg.cmdOpts...)
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrDeadlineExceeded):
 			return err
 		default:
 			return fmt.Errorf("AT%s returned error: %w", cmd, err)
@@ -330,13 +465,68 @@ func (a *AT) Init(options ...InitOption) error {
 // The format of the sms may be a text message or a hex coded SMS PDU,
 // depending on the configuration of the modem (text or PDU mode).
 func (a *AT) SMSCommand(cmd string, sms string, options ...CommandOption) (info []string, err error) {
+	defer a.beginCommand()()
 	cfg := commandConfig{timeout: a.cmdTimeout}
 	for _, option := range options {
 		option.applyCommandOption(&cfg)
 	}
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+	if err := a.authorize(cmd); err != nil {
+		return nil, err
+	}
 	done := make(chan response)
 	cmdf := func() {
-		info, err := a.processSmsReq(cmd, sms, cfg.timeout)
+		info, err := a.exchange(cmd, func() ([]string, error) {
+			return a.processSmsReq(cmd, sms, cfg)
+		})
+		done <- response{info: info, err: err}
+	}
+	select {
+	case <-a.closed:
+		return nil, ErrClosed
+	case a.cmdCh <- cmdf:
+		rsp := <-done
+		return rsp.info, rsp.err
+	}
+}
+
+// DataCommand issues a command that prompts for data to the modem, and
+// returns the result.
+//
+// A data command is issued in two steps; first the command line:
+//
+//	AT<command><CR>
+//
+// which the modem responds to with either a ">" prompt or a CONNECT, after
+// which the data is written to the modem unaltered.
+//
+// The modem then completes the command as per other commands, such as those
+// issued by Command.
+//
+// This is used by vendor specific commands that transfer a known length of
+// data, such as file uploads, so no terminator is added to the data.
+//
+// As some such commands complete with SEND OK or SEND FAIL, rather than a
+// final result code, those are also accepted as completing the command.
+func (a *AT) DataCommand(cmd string, data []byte, options ...CommandOption) (info []string, err error) {
+	defer a.beginCommand()()
+	cfg := commandConfig{timeout: a.cmdTimeout}
+	for _, option := range options {
+		option.applyCommandOption(&cfg)
+	}
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+	if err := a.authorize(cmd); err != nil {
+		return nil, err
+	}
+	done := make(chan response)
+	cmdf := func() {
+		info, err := a.exchange(cmd, func() ([]string, error) {
+			return a.processDataReq(cmd, data, cfg)
+		})
 		done <- response{info: info, err: err}
 	}
 	select {
@@ -351,31 +541,46 @@ func (a *AT) SMSCommand(cmd string, sms string, options ...CommandOption) (info
 // cmdLoop is responsible for the interface to the modem.
 //
 // It serialises the issuing of commands and awaits the responses.
-// If no command is pending then any lines received are discarded.
+// If no command is pending then any lines received are discarded, and
+// counted as parse errors.
 //
 // The cmdLoop terminates when the downstream closes.
-func cmdLoop(cmds chan func(), in <-chan string, out chan struct{}) {
+func cmdLoop(cmds chan func(), in <-chan string, out chan struct{}, s *stats) {
 	for {
 		select {
 		case cmd := <-cmds:
 			cmd()
-		case _, ok := <-in:
+		case line, ok := <-in:
 			if !ok {
 				close(out)
 				return
 			}
+			if line != "" {
+				s.addParseError()
+			}
 		}
 	}
 }
 
-// lineReader takes lines from m and redirects them to out.
+// stampedLine is a line read from the modem, and the time it was read.
+type stampedLine struct {
+	line string
+	t    time.Time
+}
+
+// lineReader takes lines from m and redirects them to out, stamped with the
+// time they were read.
 //
 // lineReader exits when m closes.
-func lineReader(m io.Reader, out chan string) {
+func lineReader(m io.Reader, out chan stampedLine, s *stats) {
 	scanner := bufio.NewScanner(m)
 	scanner.Split(scanLines)
 	for scanner.Scan() {
-		out <- scanner.Text()
+		s.addLine()
+		out <- stampedLine{scanner.Text(), time.Now()}
+	}
+	if scanner.Err() != nil {
+		s.addParseError()
 	}
 	close(out) // tell pipeline we're done - end of pipeline will close the AT.
 }
@@ -387,18 +592,24 @@ func lineReader(m io.Reader, out chan string) {
 // assumed to arrive in a contiguous block immediately after the indication.
 //
 // indLoop exits when the in channel closes.
-func (a *AT) indLoop(cmds chan func(), in <-chan string, out chan string) {
+func (a *AT) indLoop(cmds chan func(), in <-chan stampedLine, out chan string) {
 	defer close(out)
+Loop:
 	for {
 		select {
 		case cmd := <-cmds:
 			cmd()
-		case line, ok := <-in:
+		case sl, ok := <-in:
 			if !ok {
 				return
 			}
+			line := sl.line
 			for prefix, ind := range a.inds {
 				if strings.HasPrefix(line, prefix) {
+					if ind.isResponse != nil && a.isPending(line) && ind.isResponse(line) {
+						// the response to the pending command.
+						break
+					}
 					n := make([]string, ind.lines)
 					n[0] = line
 					for i := 1; i < ind.lines; i++ {
@@ -406,28 +617,68 @@ func (a *AT) indLoop(cmds chan func(), in <-chan string, out chan string) {
 						if !ok {
 							return
 						}
-						n[i] = t
+						n[i] = t.line
 					}
-					go ind.handler(n)
-					continue
+					a.journal.add(JournalEntry{Time: sl.t, Lines: n})
+					go a.callHandler(ind, n, sl.t)
+					// indications are not passed on to the cmdLoop.
+					continue Loop
 				}
 			}
+			switch parseRxLine(line, "") {
+			case rxlStatusOK, rxlStatusError:
+				// indications following the final response are not part of
+				// the command, even if they share its prefix.
+				a.setPending("")
+			}
 			out <- line
 		}
 	}
 }
 
+// setPending records the ID of the command awaiting a response.
+func (a *AT) setPending(cmdID string) {
+	a.pendingMu.Lock()
+	a.pending = cmdID
+	a.pendingMu.Unlock()
+}
+
+// isPending returns true if the line has the prefix of the info for the
+// pending command.
+func (a *AT) isPending(line string) bool {
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+	return a.pending != "" && strings.HasPrefix(line, a.pending+":")
+}
+
 // issue an escape command
 //
 // This should only be called from within the cmdLoop.
 func (a *AT) escape(b ...byte) {
-	cmd := append([]byte(string(esc)+"\r\n"), b...)
+	cmd := append([]byte{esc, '\r', '\n'}, b...)
 	a.modem.Write(cmd)
 	a.escGuard = time.NewTimer(a.escTime)
 }
 
+// exchange performs a request using the process function, recording the
+// exchange in the journal, diagnostics and span of the command.
+//
+// This should only be called from within the cmdLoop.
+func (a *AT) exchange(cmd string, process func() ([]string, error)) ([]string, error) {
+	id := a.beginExchange()
+	start := time.Now()
+	span := a.startSpan(id, cmd)
+	info, err := process()
+	a.endExchange()
+	a.record(id, cmd, start, info, err)
+	endSpan(span, start, err)
+	return info, a.withContext(id, cmd, start, info, err)
+}
+
 // perform a request  - issuing the command and awaiting the response.
-func (a *AT) processReq(cmd string, timeout time.Duration) (info []string, err error) {
+func (a *AT) processReq(cmd string, cfg commandConfig) (info []string, err error) {
+	a.setPending(parseCmdID(cmd))
+	defer a.setPending("")
 	a.waitEscGuard()
 	err = a.writeCommand(cmd)
 	if err != nil {
@@ -436,8 +687,8 @@ func (a *AT) processReq(cmd string, timeout time.Duration) (info []string, err e
 
 	cmdID := parseCmdID(cmd)
 	var expChan <-chan time.Time
-	if timeout >= 0 {
-		expiry := time.NewTimer(timeout)
+	if cfg.timeout >= 0 {
+		expiry := time.NewTimer(cfg.timeout)
 		expChan = expiry.C
 		defer expiry.Stop()
 	}
@@ -456,7 +707,7 @@ func (a *AT) processReq(cmd string, timeout time.Duration) (info []string, err e
 			lt := parseRxLine(line, cmdID)
 			i, done, perr := a.processRxLine(lt, line)
 			if i != nil {
-				info = append(info, *i)
+				info = cfg.addInfo(info, *i)
 			}
 			if perr != nil {
 				err = perr
@@ -471,22 +722,29 @@ func (a *AT) processReq(cmd string, timeout time.Duration) (info []string, err e
 
 // perform a SMS request  - issuing the command, awaiting the prompt, sending
 // the data and awaiting the response.
-func (a *AT) processSmsReq(cmd string, sms string, timeout time.Duration) (info []string, err error) {
+func (a *AT) processSmsReq(cmd string, sms string, cfg commandConfig) (info []string, err error) {
+	a.setPending(parseCmdID(cmd))
+	defer a.setPending("")
 	a.waitEscGuard()
 	err = a.writeSMSCommand(cmd)
 	if err != nil {
 		return
 	}
+	start := time.Now()
+	prompted := false
 	cmdID := parseCmdID(cmd)
 	var expChan <-chan time.Time
-	if timeout >= 0 {
-		expiry := time.NewTimer(timeout)
+	if cfg.timeout >= 0 {
+		expiry := time.NewTimer(cfg.timeout)
 		expChan = expiry.C
 		defer expiry.Stop()
 	}
 	for {
 		select {
 		case <-expChan:
+			if !prompted {
+				a.stats.addPromptTimeout()
+			}
 			// cancel outstanding SMS request
 			a.escape()
 			err = ErrDeadlineExceeded
@@ -500,9 +758,90 @@ func (a *AT) processSmsReq(cmd string, sms string, timeout time.Duration) (info
 				continue
 			}
 			lt := parseRxLine(line, cmdID)
+			if lt == rxlSMSPrompt && !prompted {
+				prompted = true
+				a.stats.addPromptWait(time.Since(start))
+			}
 			i, done, perr := a.processSmsRxLine(lt, line, sms)
 			if i != nil {
-				info = append(info, *i)
+				info = cfg.addInfo(info, *i)
+			}
+			if perr != nil {
+				err = perr
+				return
+			}
+			if done {
+				return
+			}
+		}
+	}
+}
+
+// perform a data request  - issuing the command, awaiting the prompt, sending
+// the data and awaiting the response.
+func (a *AT) processDataReq(cmd string, data []byte, cfg commandConfig) (info []string, err error) {
+	a.setPending(parseCmdID(cmd))
+	defer a.setPending("")
+	a.waitEscGuard()
+	err = a.writeSMSCommand(cmd)
+	if err != nil {
+		return
+	}
+	start := time.Now()
+	cmdID := parseCmdID(cmd)
+	var expChan <-chan time.Time
+	if cfg.timeout >= 0 {
+		expiry := time.NewTimer(cfg.timeout)
+		expChan = expiry.C
+		defer expiry.Stop()
+	}
+	sent := false
+	echo := dataLines(data)
+	for {
+		select {
+		case <-expChan:
+			if !sent {
+				a.stats.addPromptTimeout()
+			}
+			// cancel outstanding data request
+			a.escape()
+			err = ErrDeadlineExceeded
+			return
+		case line, ok := <-a.cLines:
+			if !ok {
+				err = ErrClosed
+				return
+			}
+			if line == "" {
+				continue
+			}
+			lt := parseRxLine(line, cmdID)
+			if !sent && (lt == rxlSMSPrompt || strings.HasPrefix(line, "CONNECT")) {
+				sent = true
+				a.stats.addPromptWait(time.Since(start))
+				if _, err = a.modem.Write(data); err != nil {
+					a.escape()
+					return
+				}
+				continue
+			}
+			if sent && lt == rxlUnknown {
+				// some send commands complete with SEND OK rather than OK
+				switch line {
+				case "SEND OK":
+					return
+				case "SEND FAIL":
+					err = ErrSendFailed
+					return
+				}
+			}
+			if sent && lt == rxlUnknown && echo[line] {
+				// swallow echoed data
+				continue
+			}
+			i, done, perr := a.processRxLine(lt, line)
+			if i != nil {
+				info = cfg.addInfo(info, *i)
 			}
 			if perr != nil {
 				err = perr
@@ -596,7 +935,8 @@ func (a *AT) writeCommand(cmd string) error {
 	return err
 }
 
-// writeSMSCommand writes a the first line of an SMS command to the modem.
+// writeSMSCommand writes a the first line of an SMS or data command to the
+// modem.
 //
 // This should only be called from within the cmdLoop.
 func (a *AT) writeSMSCommand(cmd string) error {
@@ -609,7 +949,7 @@ func (a *AT) writeSMSCommand(cmd string) error {
 //
 // This should only be called from within the cmdLoop.
 func (a *AT) writeSMS(sms string) error {
-	_, err := a.modem.Write([]byte(sms + string(sub)))
+	_, err := a.modem.Write(append([]byte(sms), sub))
 	return err
 }
 
@@ -642,6 +982,16 @@ func (e ConnectError) Error() string {
 	return string("Connect: " + e)
 }
 
+// ErrUnsupportedOption indicates an option was passed to a method that does
+// not support it.
+//
+// The value names the option.
+type ErrUnsupportedOption string
+
+func (e ErrUnsupportedOption) Error() string {
+	return "unsupported option: " + string(e)
+}
+
 var (
 	// ErrClosed indicates an operation cannot be performed as the modem has
 	// been closed.
@@ -658,6 +1008,10 @@ var (
 	// ErrIndicationExists indicates there is already a indication registered
 	// for a prefix.
 	ErrIndicationExists = errors.New("indication exists")
+
+	// ErrSendFailed indicates the modem returned SEND FAIL in response to a
+	// data command.
+	ErrSendFailed = errors.New("SEND FAIL")
 )
 
 // newError parses a line and creates an error corresponding to the content.
@@ -709,10 +1063,13 @@ const (
 type Indication struct {
 	prefix  string
 	lines   int
-	handler InfoHandler
+	handler StampedInfoHandler
+
+	// if not-nil, identifies lines that are responses to a pending command.
+	isResponse ResponseFilter
 }
 
-func newIndication(prefix string, handler InfoHandler, options ...IndicationOption) Indication {
+func newIndication(prefix string, handler StampedInfoHandler, options ...IndicationOption) Indication {
 	ind := Indication{
 		prefix:  prefix,
 		handler: handler,
@@ -750,6 +1107,36 @@ func WithTrailingLines(l int) TrailingLinesOption {
 // containing the indication.
 var WithTrailingLine = TrailingLinesOption(1)
 
+// ResponseFilter returns true if the line is the response to a command, rather
+// than an indication.
+type ResponseFilter func(line string) bool
+
+// ResponseFilterOption specifies a filter to separate command responses from
+// an indication sharing their prefix.
+type ResponseFilterOption ResponseFilter
+
+func (o ResponseFilterOption) applyIndicationOption(ind *Indication) {
+	ind.isResponse = ResponseFilter(o)
+}
+
+// WithResponseFilter specifies a filter to identify the lines that are
+// responses to a command, rather than the indication, where both share the
+// same prefix, such as +CREG: being both the response to AT+CREG? and the
+// indication of a change in registration.
+//
+// By default all lines with the prefix are passed to the indication handler,
+// even while a command with the same prefix is pending, so the command
+// receives no info.
+//
+// The filter is only applied to lines received while a command with the same
+// prefix is awaiting its final result code.  Lines it accepts are returned to
+// the command, while the remainder, being unsolicited, are passed to the
+// handler.  The filter must distinguish the two by content, as an indication
+// may be received at any time, including while the command is pending.
+func WithResponseFilter(f ResponseFilter) ResponseFilterOption {
+	return ResponseFilterOption(f)
+}
+
 // parseCmdID returns the identifier component of the command.
 //
 // This is the section prior to any '=' or '?' and is generally, but not
@@ -795,6 +1182,17 @@ func parseRxLine(line string, cmdID string) rxl {
 	}
 }
 
+// dataLines returns the lines of the data, as they would be read by
+// lineReader if echoed by the modem, so the echo can be distinguished from
+// the response.
+func dataLines(data []byte) map[string]bool {
+	lines := make(map[string]bool)
+	for _, l := range strings.Split(string(data), "\n") {
+		lines[strings.TrimSuffix(l, "\r")] = true
+	}
+	return lines
+}
+
 // scanLines is a custom line scanner for lineReader that recognises the prompt
 // returned by the modem in response to SMS commands such as +CMGS.
 func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
@@ -811,10 +1209,25 @@ func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 
 type commandConfig struct {
 	timeout time.Duration
+	lh      LineHandler
+
+	// the error raised by an unsupported option, if any.
+	err error
+}
+
+// addInfo adds a line of info to the response, or passes it to the line
+// handler, if one is configured.
+func (c commandConfig) addInfo(info []string, line string) []string {
+	if c.lh != nil {
+		c.lh(line)
+		return info
+	}
+	return append(info, line)
 }
 
 type initConfig struct {
 	timeout time.Duration
 	cmds    []string
 	cmdOpts []CommandOption
+	diag    *DiagnosticsReport
 }
@@ -16,6 +16,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -63,9 +64,9 @@ func TestNew(t *testing.T) {
 func TestWithEscTime(t *testing.T) {
 	cmdSet := map[string][]string{
 		// for init
-		string(27) + "\r\n\r\n": {"\r\n"},
-		"ATZ\r\n":               {"OK\r\n"},
-		"ATE0\r\n":              {"OK\r\n"},
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"OK\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
 	}
 	patterns := []struct {
 		name    string
@@ -103,10 +104,10 @@ func TestWithEscTime(t *testing.T) {
 func TestWithCmds(t *testing.T) {
 	cmdSet := map[string][]string{
 		// for init
-		string(27) + "\r\n\r\n": {"\r\n"},
-		"ATZ\r\n":               {"OK\r\n"},
-		"ATE0\r\n":              {"OK\r\n"},
-		"AT^CURC=0\r\n":         {"OK\r\n"},
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"OK\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
+		"AT^CURC=0\r\n":               {"OK\r\n"},
 	}
 	patterns := []struct {
 		name    string
@@ -143,10 +144,10 @@ func TestInit(t *testing.T) {
 	// mocked
 	cmdSet := map[string][]string{
 		// for init
-		string(27) + "\r\n\r\n": {"\r\n"},
-		"ATZ\r\n":               {"OK\r\n"},
-		"ATE0\r\n":              {"OK\r\n"},
-		"AT^CURC=0\r\n":         {"OK\r\n"},
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"OK\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
+		"AT^CURC=0\r\n":               {"OK\r\n"},
 	}
 	mm := mockModem{cmdSet: cmdSet, echo: false, r: make(chan []byte, 10)}
 	defer teardownModem(&mm)
@@ -178,9 +179,9 @@ func TestInit(t *testing.T) {
 func TestInitFailure(t *testing.T) {
 	cmdSet := map[string][]string{
 		// for init
-		string(27) + "\r\n\r\n": {"\r\n"},
-		"ATZ\r\n":               {"ERROR\r\n"},
-		"ATE0\r\n":              {"OK\r\n"},
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"ERROR\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
 	}
 	mm := mockModem{cmdSet: cmdSet, echo: false, r: make(chan []byte, 10)}
 	defer teardownModem(&mm)
@@ -202,8 +203,8 @@ func TestInitFailure(t *testing.T) {
 func TestCloseInInitTimeout(t *testing.T) {
 	cmdSet := map[string][]string{
 		// for init
-		string(27) + "\r\n\r\n": {"\r\n"},
-		"ATZ\r\n":               {""},
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {""},
 	}
 	mm := mockModem{cmdSet: cmdSet, echo: false, r: make(chan []byte, 10)}
 	defer teardownModem(&mm)
@@ -422,14 +423,82 @@ func TestCommandClosedPreWrite(t *testing.T) {
 	assert.Nil(t, info)
 }
 
+func TestWithLineHandler(t *testing.T) {
+	cmdSet := map[string][]string{
+		"ATINFO=1\r\n": {"info1\r\n", "info2\r\n", "INFO: info3\r\n", "\r\n", "OK\r\n"},
+		"ATCME\r\n":    {"info1\r\n", "+CME ERROR: 42\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	patterns := []struct {
+		name  string
+		cmd   string
+		lines []string
+		err   error
+	}{
+		{
+			"info",
+			"INFO=1",
+			[]string{"info1", "info2", "INFO: info3"},
+			nil,
+		},
+		{
+			"cme",
+			"CME",
+			[]string{"info1"},
+			at.CMEError("42"),
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			var lines []string
+			lh := func(l string) {
+				lines = append(lines, l)
+			}
+			info, err := m.Command(p.cmd, at.WithLineHandler(lh))
+			assert.Equal(t, p.err, err)
+			assert.Nil(t, info)
+			assert.Equal(t, p.lines, lines)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestLayerOption(t *testing.T) {
+	cmdSet := map[string][]string{
+		"ATI\r\n": {"info1\r\n", "OK\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	type layerOption struct {
+		at.LayerOption
+	}
+	lo := layerOption{"layer.WithOption"}
+	info, err := m.Command("I", lo)
+	assert.Equal(t, at.ErrUnsupportedOption("layer.WithOption"), err)
+	assert.Nil(t, info)
+	info, err = m.SMSCommand("+CMGS=23", "pdu", lo)
+	assert.Equal(t, at.ErrUnsupportedOption("layer.WithOption"), err)
+	assert.Nil(t, info)
+	info, err = m.DataCommand("+QFUPL", []byte("data"), lo)
+	assert.Equal(t, at.ErrUnsupportedOption("layer.WithOption"), err)
+	assert.Nil(t, info)
+	assert.Equal(t, "unsupported option: layer.WithOption", err.Error())
+
+	info, err = m.Command("I")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"info1"}, info)
+}
+
 func TestSMSCommand(t *testing.T) {
 	cmdSet := map[string][]string{
-		"ATCMS\r":           {"\r\n+CMS ERROR: 204\r\n"},
-		"ATCME\r":           {"\r\n+CME ERROR: 42\r\n"},
-		"ATSMS\r":           {"\n>"},
-		"ATSMS2\r":          {"\n> "},
-		"info" + string(26): {"\r\n", "info1\r\n", "info2\r\n", "INFO: info3\r\n", "\r\n", "OK\r\n"},
-		"sms+" + string(26): {"\r\n", "info4\r\n", "info5\r\n", "INFO: info6\r\n", "\r\n", "OK\r\n"},
+		"ATCMS\r":                 {"\r\n+CMS ERROR: 204\r\n"},
+		"ATCME\r":                 {"\r\n+CME ERROR: 42\r\n"},
+		"ATSMS\r":                 {"\n>"},
+		"ATSMS2\r":                {"\n> "},
+		"info" + string(rune(26)): {"\r\n", "info1\r\n", "info2\r\n", "INFO: info3\r\n", "\r\n", "OK\r\n"},
+		"sms+" + string(rune(26)): {"\r\n", "info4\r\n", "info5\r\n", "INFO: info6\r\n", "\r\n", "OK\r\n"},
 	}
 	m, mm := setupModem(t, cmdSet)
 	defer teardownModem(mm)
@@ -583,6 +652,102 @@ func TestSMSCommandClosedPrePDU(t *testing.T) {
 	<-done
 }
 
+func TestDataCommand(t *testing.T) {
+	cmdSet := map[string][]string{
+		"ATCONNECT\r": {"\r\nCONNECT\r\n"},
+		"ATPROMPT\r":  {"\n>"},
+		"ATCME\r":     {"\r\n+CME ERROR: 42\r\n"},
+		"ATSILENT\r":  {"\r\n"},
+		"payload":     {"\r\n", "+UPL: 7\r\n", "\r\nOK\r\n"},
+		"+UPL: 7 too": {"\r\n", "+UPL: 7\r\n", "\r\nOK\r\n"},
+		"sent":        {"\r\nSEND OK\r\n"},
+		"unsent":      {"\r\nSEND FAIL\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	patterns := []struct {
+		name    string
+		options []at.CommandOption
+		cmd     string
+		data    string
+		info    []string
+		err     error
+	}{
+		{
+			"connect",
+			nil,
+			"CONNECT",
+			"payload",
+			[]string{"+UPL: 7"},
+			nil,
+		},
+		{
+			"prompt",
+			nil,
+			"PROMPT",
+			"payload",
+			[]string{"+UPL: 7"},
+			nil,
+		},
+		{
+			"cme",
+			nil,
+			"CME",
+			"payload",
+			nil,
+			at.CMEError("42"),
+		},
+		{
+			"response within data",
+			nil,
+			"CONNECT",
+			"+UPL: 7 too",
+			[]string{"+UPL: 7"},
+			nil,
+		},
+		{
+			"send ok",
+			nil,
+			"PROMPT",
+			"sent",
+			nil,
+			nil,
+		},
+		{
+			"send fail",
+			nil,
+			"PROMPT",
+			"unsent",
+			nil,
+			at.ErrSendFailed,
+		},
+		{
+			"data error",
+			nil,
+			"CONNECT",
+			"junk",
+			nil,
+			at.ErrError,
+		},
+		{
+			"timeout",
+			[]at.CommandOption{at.WithTimeout(10 * time.Millisecond)},
+			"SILENT",
+			"payload",
+			nil,
+			at.ErrDeadlineExceeded,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			info, err := m.DataCommand(p.cmd, []byte(p.data), p.options...)
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.info, info)
+		}
+		t.Run(p.name, f)
+	}
+}
+
 func TestAddIndication(t *testing.T) {
 	m, mm := setupModem(t, nil)
 	defer teardownModem(mm)
@@ -619,6 +784,133 @@ func TestAddIndication(t *testing.T) {
 	}
 }
 
+func TestAddStampedIndication(t *testing.T) {
+	m, mm := setupModem(t, nil)
+	defer teardownModem(mm)
+
+	type stamped struct {
+		info []string
+		t    time.Time
+		rx   time.Time
+	}
+	c := make(chan stamped)
+	handler := func(info []string, t time.Time) {
+		c <- stamped{info, t, time.Now()}
+	}
+	err := m.AddStampedIndication("foo", handler, at.WithTrailingLine)
+	assert.Nil(t, err)
+	start := time.Now()
+	mm.r <- []byte("foo:\r\n")
+	// handler is delayed until the trailing line arrives
+	time.Sleep(50 * time.Millisecond)
+	mm.r <- []byte("bar\r\n")
+	select {
+	case n := <-c:
+		assert.Equal(t, []string{"foo:", "bar"}, n.info)
+		assert.False(t, n.t.Before(start), n.t)
+		assert.True(t, n.rx.Sub(n.t) >= 50*time.Millisecond, n.rx.Sub(n.t))
+	case <-time.After(200 * time.Millisecond):
+		t.Errorf("no notification received")
+	}
+	err = m.AddIndication("foo", func([]string) {})
+	assert.Equal(t, at.ErrIndicationExists, err)
+}
+
+func TestIndicationDuringCommand(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CSQ\r\n": {"+CSQ: 20,0\r\n", "notify: :yfiton\r\n", "OK\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	c := make(chan []string, 1)
+	handler := func(info []string) {
+		c <- info
+	}
+	err := m.AddIndication("notify", handler)
+	require.Nil(t, err)
+	info, err := m.Command("+CSQ")
+	assert.Nil(t, err)
+	// indication not included in command info
+	assert.Equal(t, []string{"+CSQ: 20,0"}, info)
+	select {
+	case n := <-c:
+		assert.Equal(t, []string{"notify: :yfiton"}, n)
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("no notification received")
+	}
+}
+
+func TestIndicationSharingCommandPrefix(t *testing.T) {
+	// +CREG: <stat> indications interleaved with the +CREG: <n>,<stat>
+	// response.
+	cmdSet := map[string][]string{
+		"AT+CREG?\r\n": {"+CREG: 5\r\n", "+CREG: 1,1\r\n", "+CREG: 2\r\n", "OK\r\n", "+CREG: 1,3\r\n"},
+		"ATI\r\n":      {"+CREG: 1,4\r\n", "info\r\n", "OK\r\n"},
+	}
+	isResponse := func(line string) bool {
+		return strings.Count(line, ",") > 0
+	}
+	patterns := []struct {
+		name    string
+		options []at.IndicationOption
+		cmd     string
+		info    []string
+		inds    []string
+	}{
+		{
+			"no filter",
+			nil,
+			"+CREG?",
+			nil,
+			[]string{"+CREG: 5", "+CREG: 1,1", "+CREG: 2", "+CREG: 1,3"},
+		},
+		{
+			"filter",
+			[]at.IndicationOption{at.WithResponseFilter(isResponse)},
+			"+CREG?",
+			[]string{"+CREG: 1,1"},
+			// indications following the final result code are not filtered.
+			[]string{"+CREG: 5", "+CREG: 2", "+CREG: 1,3"},
+		},
+		{
+			"other command",
+			[]at.IndicationOption{at.WithResponseFilter(isResponse)},
+			"I",
+			[]string{"info"},
+			[]string{"+CREG: 1,4"},
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			m, mm := setupModem(t, cmdSet)
+			defer teardownModem(mm)
+
+			c := make(chan []string, 5)
+			handler := func(info []string) {
+				c <- info
+			}
+			err := m.AddIndication("+CREG:", handler, p.options...)
+			require.Nil(t, err)
+			info, err := m.Command(p.cmd)
+			assert.Nil(t, err)
+			assert.Equal(t, p.info, info)
+			inds := []string(nil)
+			for range p.inds {
+				select {
+				case n := <-c:
+					inds = append(inds, n[0])
+				case <-time.After(100 * time.Millisecond):
+					t.Fatalf("no notification received")
+				}
+			}
+			// handlers are called from separate goroutines, so in any order.
+			assert.ElementsMatch(t, p.inds, inds)
+		}
+		t.Run(p.name, f)
+	}
+}
+
 func TestWithIndication(t *testing.T) {
 	c := make(chan []string)
 	handler := func(info []string) {
@@ -0,0 +1,374 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package attest provides utilities for testing code that drives a modem
+// using the at package.
+//
+// A Modem is a scripted modem that responds to commands from a set of rules,
+// and records the transcript of the commands it receives, so tests can assert
+// the exact AT command sequence produced by a code path.
+package attest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Modem is a scripted modem, standing in for the physical modem beneath an
+// at.AT.
+//
+// Each command written to the modem is recorded in the transcript, and
+// answered with the response of the first rule that matches it, or with ERROR
+// if no rule matches.
+type Modem struct {
+	rules []rule
+	echo  bool
+	r     chan []byte
+	done  chan struct{}
+	// the remainder of the data being read, only accessed by Read.
+	rem []byte
+	// mu covers the transcript and closed, and serialises writes to r so
+	// responses are not interleaved.
+	mu     sync.Mutex
+	cmds   []string
+	closed bool
+}
+
+type rule struct {
+	pattern string
+	rsp     []string
+	// if not-nil, generates the response, overriding rsp.
+	f Responder
+}
+
+// Option modifies the behaviour of the Modem.
+type Option interface {
+	applyOption(*Modem)
+}
+
+// New creates a scripted modem.
+func New(options ...Option) *Modem {
+	m := &Modem{
+		r:    make(chan []byte, 100),
+		done: make(chan struct{}),
+	}
+	for _, option := range options {
+		option.applyOption(m)
+	}
+	return m
+}
+
+// Read returns the responses and indications emitted by the modem.
+func (m *Modem) Read(p []byte) (int, error) {
+	if len(m.rem) == 0 {
+		select {
+		case m.rem = <-m.r:
+		case <-m.done:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, m.rem)
+	m.rem = m.rem[n:]
+	return n, nil
+}
+
+// Write records the command in the transcript and emits the matching
+// response.
+func (m *Modem) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, io.ErrClosedPipe
+	}
+	cmd := trimCommand(string(p))
+	m.cmds = append(m.cmds, cmd)
+	if m.echo {
+		m.emit(p)
+	}
+	rsp := []string{"ERROR"}
+	for _, r := range m.rules {
+		if Match(r.pattern, cmd) {
+			rsp = r.rsp
+			if r.f != nil {
+				rsp = r.f(cmd)
+			}
+			break
+		}
+	}
+	// the response is emitted as a single block, so large responses, such as
+	// a bulk +CMGL, cannot fill the read queue while the writer is blocked.
+	var b strings.Builder
+	for _, l := range rsp {
+		if l == ">" {
+			b.WriteString("\r\n> ")
+			continue
+		}
+		b.WriteString("\r\n" + l + "\r\n")
+	}
+	if b.Len() > 0 {
+		m.emit([]byte(b.String()))
+	}
+	return len(p), nil
+}
+
+// Close closes the modem, after which reads return io.EOF.
+func (m *Modem) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
+	return nil
+}
+
+// Indicate emits the lines from the modem, as an unsolicited indication.
+//
+// The lines are emitted as a contiguous block, framed by CRLF, so the lines
+// following the first are the trailing lines of the indication, such as the
+// PDU following a +CMT.
+func (m *Modem) Indicate(lines ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || len(lines) == 0 {
+		return
+	}
+	m.emit([]byte("\r\n" + strings.Join(lines, "\r\n") + "\r\n"))
+}
+
+// Inject emits the data from the modem as is, without framing, such as to
+// simulate noise on the link.
+func (m *Modem) Inject(data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || len(data) == 0 {
+		return
+	}
+	m.emit(data)
+}
+
+// Commands returns the transcript of the commands written to the modem.
+//
+// Commands are recorded as written, including the AT prefix, but without the
+// trailing line terminator, or the Ctrl-Z terminating an SMS.
+func (m *Modem) Commands() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.cmds...)
+}
+
+// Reset clears the transcript.
+func (m *Modem) Reset() {
+	m.mu.Lock()
+	m.cmds = nil
+	m.mu.Unlock()
+}
+
+// AssertCommands asserts that the transcript matches the patterns, as per
+// MatchCommands.
+//
+// Returns true if the transcript matches, else reports the mismatch to t and
+// returns false.
+func (m *Modem) AssertCommands(t TestingT, patterns ...string) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	cmds := m.Commands()
+	if err := MatchCommands(cmds, patterns...); err != nil {
+		t.Errorf("%v\ntranscript:\n\t%s\npatterns:\n\t%s",
+			err, strings.Join(cmds, "\n\t"), strings.Join(patterns, "\n\t"))
+		return false
+	}
+	return true
+}
+
+// emit queues data to be read from the modem.
+//
+// Must be called with mu held.
+func (m *Modem) emit(data []byte) {
+	select {
+	case m.r <- append([]byte(nil), data...):
+	case <-m.done:
+	}
+}
+
+// TestingT is the subset of testing.TB used to report assertion failures.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// AnyCommands is a pattern that matches any number of commands, including
+// none.
+const AnyCommands = "**"
+
+// MatchCommands checks that the commands match the patterns, in order.
+//
+// Each pattern matches a single command, as per Match, except AnyCommands,
+// which matches any number of consecutive commands.
+//
+// Returns nil if the commands match, else an error describing the first
+// mismatch.
+func MatchCommands(cmds []string, patterns ...string) error {
+	if matchCommands(cmds, patterns) {
+		return nil
+	}
+	// find the longest matching prefixes to identify the mismatch, noting
+	// that the empty prefixes always match.
+	for i := len(cmds); ; i-- {
+		for j := len(patterns); j >= 0; j-- {
+			if !matchCommands(cmds[:i], patterns[:j]) {
+				continue
+			}
+			switch {
+			case j == len(patterns):
+				return ErrUnexpectedCommand{i, cmds[i]}
+			case i == len(cmds):
+				return ErrMissingCommand{i, patterns[j]}
+			default:
+				return ErrMismatch{i, cmds[i], patterns[j]}
+			}
+		}
+	}
+}
+
+func matchCommands(cmds, patterns []string) bool {
+	if len(patterns) == 0 {
+		return len(cmds) == 0
+	}
+	if patterns[0] == AnyCommands {
+		for i := 0; i <= len(cmds); i++ {
+			if matchCommands(cmds[i:], patterns[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(cmds) == 0 || !Match(patterns[0], cmds[0]) {
+		return false
+	}
+	return matchCommands(cmds[1:], patterns[1:])
+}
+
+// Match returns true if the command matches the pattern.
+//
+// A '*' in the pattern matches any sequence of characters, including none,
+// and a '?' matches any single character.  All other characters match
+// themselves.
+func Match(pattern, cmd string) bool {
+	if pattern == "" {
+		return cmd == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(cmd); i++ {
+			if Match(pattern[1:], cmd[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return cmd != "" && Match(pattern[1:], cmd[1:])
+	default:
+		return cmd != "" && cmd[0] == pattern[0] && Match(pattern[1:], cmd[1:])
+	}
+}
+
+func trimCommand(cmd string) string {
+	cmd = strings.TrimSuffix(cmd, "\x1a")
+	cmd = strings.TrimSuffix(cmd, "\n")
+	return strings.TrimSuffix(cmd, "\r")
+}
+
+// EchoOption enables echoing of commands written to the modem.
+type EchoOption bool
+
+func (o EchoOption) applyOption(m *Modem) {
+	m.echo = bool(o)
+}
+
+// WithEcho has the modem echo the commands written to it, as a modem does by
+// default.
+const WithEcho = EchoOption(true)
+
+// ResponseOption adds a rule for responding to commands.
+type ResponseOption struct {
+	pattern string
+	rsp     []string
+}
+
+func (o ResponseOption) applyOption(m *Modem) {
+	m.rules = append(m.rules, rule{pattern: o.pattern, rsp: o.rsp})
+}
+
+// WithResponse specifies the response to commands matching the pattern.
+//
+// The pattern is matched against the command as recorded in the transcript,
+// as per Match, and the rules are tried in the order provided.
+//
+// Each response line is emitted separately, framed by CRLF, except a ">"
+// which is emitted as the prompt for the body of an SMS or data command.  An
+// empty response emits nothing.
+func WithResponse(pattern string, rsp ...string) ResponseOption {
+	return ResponseOption{pattern, rsp}
+}
+
+// Responder generates the response to a command, such as for a modem with
+// state that changes in response to commands.
+//
+// The response lines are emitted as per WithResponse.  Responders are called
+// with the modem locked, so must not call the Modem themselves.
+type Responder func(cmd string) []string
+
+// ResponderOption adds a rule for responding to commands with a Responder.
+type ResponderOption struct {
+	pattern string
+	f       Responder
+}
+
+func (o ResponderOption) applyOption(m *Modem) {
+	m.rules = append(m.rules, rule{pattern: o.pattern, f: o.f})
+}
+
+// WithResponder specifies the responder generating the response to commands
+// matching the pattern.
+//
+// The rule is tried in order with those provided by WithResponse.
+func WithResponder(pattern string, f Responder) ResponderOption {
+	return ResponderOption{pattern, f}
+}
+
+// ErrMismatch indicates a command did not match the expected pattern.
+type ErrMismatch struct {
+	Index   int
+	Cmd     string
+	Pattern string
+}
+
+func (e ErrMismatch) Error() string {
+	return fmt.Sprintf("command %d: %q does not match %q", e.Index, e.Cmd, e.Pattern)
+}
+
+// ErrMissingCommand indicates the transcript ended before a command matching
+// the pattern.
+type ErrMissingCommand struct {
+	Index   int
+	Pattern string
+}
+
+func (e ErrMissingCommand) Error() string {
+	return fmt.Sprintf("command %d: missing, expected %q", e.Index, e.Pattern)
+}
+
+// ErrUnexpectedCommand indicates the transcript contained a command beyond
+// those expected.
+type ErrUnexpectedCommand struct {
+	Index int
+	Cmd   string
+}
+
+func (e ErrUnexpectedCommand) Error() string {
+	return fmt.Sprintf("command %d: %q unexpected", e.Index, e.Cmd)
+}
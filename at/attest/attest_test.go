@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package attest_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/at/attest"
+)
+
+func TestMatch(t *testing.T) {
+	patterns := []struct {
+		pattern string
+		cmd     string
+		match   bool
+	}{
+		{"AT+CSQ", "AT+CSQ", true},
+		{"AT+CSQ", "AT+CSQ=?", false},
+		{"AT+CSQ", "AT+CS", false},
+		{"AT+CMGS=*", "AT+CMGS=23", true},
+		{"AT+CMGS=*", "AT+CMGS=", true},
+		{"AT+CMGS=*", "AT+CMGD=1", false},
+		{"AT+CMGD=?", "AT+CMGD=1", true},
+		{"AT+CMGD=?", "AT+CMGD=12", false},
+		{"AT+C*=?", "AT+CNMI=?", true},
+		{"*", "", true},
+		{"", "", true},
+		{"", "AT", false},
+	}
+	for _, p := range patterns {
+		assert.Equal(t, p.match, attest.Match(p.pattern, p.cmd), "%q %q", p.pattern, p.cmd)
+	}
+}
+
+func TestMatchCommands(t *testing.T) {
+	cmds := []string{"ATZ", "AT^CURC=0", "ATE0", "AT+CMEE=2", "AT+CSQ"}
+	patterns := []struct {
+		name     string
+		patterns []string
+		err      error
+	}{
+		{
+			"exact",
+			[]string{"ATZ", "AT^CURC=0", "ATE0", "AT+CMEE=2", "AT+CSQ"},
+			nil,
+		},
+		{
+			"wildcards",
+			[]string{"ATZ", "AT^CURC=?", "ATE*", "AT+CMEE=*", "AT+*"},
+			nil,
+		},
+		{
+			"any",
+			[]string{"ATZ", attest.AnyCommands, "AT+CSQ"},
+			nil,
+		},
+		{
+			"any empty",
+			[]string{"ATZ", attest.AnyCommands, "AT^CURC=0", "ATE0", "AT+CMEE=2", "AT+CSQ", attest.AnyCommands},
+			nil,
+		},
+		{
+			"mismatch",
+			[]string{"ATZ", "AT^CURC=0", "ATE1", attest.AnyCommands},
+			attest.ErrMismatch{2, "ATE0", "ATE1"},
+		},
+		{
+			"missing",
+			[]string{attest.AnyCommands, "AT+CSQ", "AT+COPS?"},
+			attest.ErrMissingCommand{5, "AT+COPS?"},
+		},
+		{
+			"unexpected",
+			[]string{"ATZ", "AT^CURC=0", "ATE0", "AT+CMEE=2"},
+			attest.ErrUnexpectedCommand{4, "AT+CSQ"},
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			err := attest.MatchCommands(cmds, p.patterns...)
+			assert.Equal(t, p.err, err)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+type mockT struct {
+	errs []string
+}
+
+func (t *mockT) Errorf(format string, args ...interface{}) {
+	t.errs = append(t.errs, fmt.Sprintf(format, args...))
+}
+
+func TestModem(t *testing.T) {
+	m := attest.New(
+		attest.WithEcho,
+		attest.WithResponse("AT+CSQ", "+CSQ: 20,99", "OK"),
+		attest.WithResponse("AT+CMGS=*", ">"),
+		attest.WithResponse("0001*", "+CMGS: 42", "OK"),
+		attest.WithResponse("AT*", "OK"),
+	)
+	defer m.Close()
+	a := at.New(m, at.WithTimeout(100*time.Millisecond))
+
+	info, err := a.Command("+CSQ")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+CSQ: 20,99"}, info)
+
+	info, err = a.SMSCommand("+CMGS=23", "000101099121436587f900000cf4f29c0e6a97e7f3f0b90c")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+CMGS: 42"}, info)
+
+	_, err = a.Command("+CNMI=1,2,0,0,0")
+	assert.Nil(t, err)
+
+	// unmatched
+	_, err = a.SMSCommand("+CMGS=23", "00ff")
+	assert.Equal(t, at.ErrError, err)
+
+	assert.True(t, m.AssertCommands(t,
+		"AT+CSQ",
+		"AT+CMGS=23",
+		"0001*",
+		attest.AnyCommands,
+		"00ff",
+	))
+
+	// failure reported
+	mt := mockT{}
+	assert.False(t, m.AssertCommands(&mt, "AT+CSQ", "AT+CMGS=?"))
+	require.Len(t, mt.errs, 1)
+	assert.Contains(t, mt.errs[0], `command 1: "AT+CMGS=23" does not match "AT+CMGS=?"`)
+
+	m.Reset()
+	assert.Empty(t, m.Commands())
+
+	// indications
+	ind := make(chan []string, 1)
+	err = a.AddIndication("+CMTI:", func(info []string) { ind <- info })
+	require.Nil(t, err)
+	m.Indicate(`+CMTI: "SM",3`)
+	select {
+	case info := <-ind:
+		assert.Equal(t, []string{`+CMTI: "SM",3`}, info)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("no indication")
+	}
+	assert.Empty(t, m.Commands())
+
+	// indication with trailing line
+	err = a.AddIndication("+CMT:", func(info []string) { ind <- info }, at.WithTrailingLine)
+	require.Nil(t, err)
+	m.Indicate("+CMT: ,24", "00040B911234567890F000000250100173832305C8329BFD06")
+	select {
+	case info := <-ind:
+		assert.Equal(t, []string{"+CMT: ,24", "00040B911234567890F000000250100173832305C8329BFD06"}, info)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("no indication")
+	}
+
+	// closed
+	m.Close()
+	select {
+	case <-a.Closed():
+	case <-time.After(100 * time.Millisecond):
+		t.Error("modem not closed")
+	}
+	_, err = m.Write([]byte("AT\r\n"))
+	assert.NotNil(t, err)
+}
+
+func TestResponder(t *testing.T) {
+	rssi := 10
+	m := attest.New(
+		attest.WithResponder("AT+CSQ", func(cmd string) []string {
+			rssi++
+			return []string{fmt.Sprintf("+CSQ: %d,99", rssi), "OK"}
+		}),
+		attest.WithResponse("AT*", "OK"),
+	)
+	defer m.Close()
+	a := at.New(m, at.WithTimeout(100*time.Millisecond))
+
+	info, err := a.Command("+CSQ")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+CSQ: 11,99"}, info)
+	info, err = a.Command("+CSQ")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+CSQ: 12,99"}, info)
+	m.AssertCommands(t, "AT+CSQ", "AT+CSQ")
+}
+
+func TestInject(t *testing.T) {
+	m := attest.New(attest.WithResponse("AT*", "OK"))
+	defer m.Close()
+	a := at.New(m, at.WithTimeout(100*time.Millisecond))
+
+	// unframed noise, followed by an indication.
+	ind := make(chan []string, 1)
+	err := a.AddIndication("+CMTI:", func(info []string) { ind <- info })
+	require.Nil(t, err)
+	m.Inject([]byte("\x00\xffnoise"))
+	m.Indicate(`+CMTI: "SM",3`)
+	select {
+	case info := <-ind:
+		assert.Equal(t, []string{`+CMTI: "SM",3`}, info)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("no indication")
+	}
+	_, err = a.Command("")
+	assert.Nil(t, err)
+	assert.True(t, a.Stats().ParseErrors >= 1)
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import "sync/atomic"
+
+// Correlator is implemented by modems that annotate the traffic over the port
+// with the correlation ID of the command it belongs to, such as trace.Trace.
+//
+// Each command issued by Command, SMSCommand and DataCommand is assigned a
+// correlation ID, numbered from 1, which is also recorded in the spans
+// created by WithTracer, the JournalEntry and Exchange of the command, and
+// the CommandError returned when WithErrorContext is applied.  So an
+// application log line can be matched to the exact exchange with the modem.
+//
+// If the modem passed to New implements Correlator then it is passed the ID
+// of each command before the command is written, and 0 once the command
+// completes.  As indications may arrive at any time, lines read while a
+// command is in progress may belong to an indication rather than the command.
+type Correlator interface {
+	Correlate(id uint64)
+}
+
+// beginExchange assigns the correlation ID to the command about to be issued.
+//
+// Only called from the cmdLoop.
+func (a *AT) beginExchange() uint64 {
+	id := atomic.AddUint64(&a.stats.commands, 1)
+	if a.correlator != nil {
+		a.correlator.Correlate(id)
+	}
+	return id
+}
+
+// endExchange indicates the command has completed.
+//
+// Only called from the cmdLoop.
+func (a *AT) endExchange() {
+	if a.correlator != nil {
+		a.correlator.Correlate(0)
+	}
+}
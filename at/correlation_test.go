@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/trace"
+)
+
+func TestCorrelationID(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+GMI\r\n":   {"Quectel\r\n", "OK\r\n"},
+		"AT+CPIN?\r\n": {"+CME ERROR: 10\r\n"},
+	}
+	mm := &mockModem{cmdSet: cmdSet, echo: false, r: make(chan []byte, 10)}
+	defer teardownModem(mm)
+	var b bytes.Buffer
+	tr := trace.New(mm, trace.WithLogger(log.New(&b, "", 0)))
+	a := at.New(tr, at.WithJournal(10), at.WithErrorContext())
+	require.NotNil(t, a)
+
+	_, err := a.Command("+GMI")
+	require.Nil(t, err)
+	_, err = a.Command("+CPIN?")
+	var ce *at.CommandError
+	require.True(t, errors.As(err, &ce), err)
+	assert.Equal(t, uint64(2), ce.ID)
+	assert.Contains(t, err.Error(), ", #2)")
+
+	ee := a.Journal()
+	require.Equal(t, 2, len(ee))
+	assert.Equal(t, uint64(1), ee[0].ID)
+	assert.Equal(t, uint64(2), ee[1].ID)
+	assert.Equal(t, uint64(2), a.Stats().Commands)
+
+	traces := b.String()
+	assert.Contains(t, traces, "#1 w: AT+GMI\r\n")
+	assert.Contains(t, traces, "#1 r: Quectel\r\n")
+	assert.Contains(t, traces, "#2 w: AT+CPIN?\r\n")
+
+	var jb bytes.Buffer
+	err = a.DumpJournal(&jb)
+	assert.Nil(t, err)
+	assert.Contains(t, jb.String(), " #2 AT+CPIN? (")
+}
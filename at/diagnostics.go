@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exchange is a command issued to the modem and its response.
+type Exchange struct {
+	// ID is the correlation ID of the command.
+	ID uint64
+
+	// Cmd is the command, without the AT prefix.
+	Cmd string
+
+	// Info is the info returned by the modem.
+	Info []string
+
+	// Err is the error returned by the command.
+	Err error
+
+	// Start is the time the command was issued.
+	Start time.Time
+
+	// Duration is the time taken for the modem to complete the command.
+	Duration time.Duration
+}
+
+// DiagnosticsReport is a transcript of the commands issued to the modem, such
+// as by Init, with their responses and timing.
+type DiagnosticsReport struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+
+	// Err is the error returned by Init, if the report was collected by Init.
+	Err error
+}
+
+// WithDiagnostics specifies a report to collect a transcript of the
+// commands issued by Init.
+//
+// The report is returned as the option, so it can be recognised by drivers
+// wrapping Init, such as the gsm package, which then extend the transcript to
+// cover their own initialisation.
+func WithDiagnostics(r *DiagnosticsReport) *DiagnosticsReport {
+	return r
+}
+
+func (r *DiagnosticsReport) applyInitOption(i *initConfig) {
+	i.diag = r
+}
+
+// Exchanges returns the commands recorded in the report.
+func (r *DiagnosticsReport) Exchanges() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Exchange(nil), r.exchanges...)
+}
+
+// String returns the transcript in a human readable form.
+func (r *DiagnosticsReport) String() string {
+	var b strings.Builder
+	for _, e := range r.Exchanges() {
+		fmt.Fprintf(&b, "%s AT%s (%s)\n", e.Start.Format("15:04:05.000"), e.Cmd, e.Duration)
+		for _, i := range e.Info {
+			fmt.Fprintf(&b, "  %s\n", i)
+		}
+		if e.Err != nil {
+			fmt.Fprintf(&b, "  error: %s\n", e.Err)
+		} else {
+			b.WriteString("  OK\n")
+		}
+	}
+	if r.Err != nil {
+		fmt.Fprintf(&b, "result: %s\n", r.Err)
+	}
+	return b.String()
+}
+
+func (r *DiagnosticsReport) add(e Exchange) {
+	r.mu.Lock()
+	r.exchanges = append(r.exchanges, e)
+	r.mu.Unlock()
+}
+
+// StartDiagnostics starts recording the commands issued to the modem into the
+// report.
+//
+// Returns false if a report is already being recorded, in which case the
+// recording continues into that report.
+func (a *AT) StartDiagnostics(r *DiagnosticsReport) bool {
+	a.diagMu.Lock()
+	defer a.diagMu.Unlock()
+	if a.diag != nil {
+		return false
+	}
+	a.diag = r
+	return true
+}
+
+// StopDiagnostics stops recording the commands issued to the modem.
+func (a *AT) StopDiagnostics() {
+	a.diagMu.Lock()
+	a.diag = nil
+	a.diagMu.Unlock()
+}
+
+// record adds the command to the journal, if enabled, and to the diagnostics
+// report, if one is being recorded.
+func (a *AT) record(id uint64, cmd string, start time.Time, info []string, err error) {
+	a.journal.add(JournalEntry{
+		ID:       id,
+		Time:     start,
+		Cmd:      cmd,
+		Lines:    info,
+		Err:      err,
+		Duration: time.Since(start),
+	})
+	a.diagMu.Lock()
+	r := a.diag
+	a.diagMu.Unlock()
+	if r == nil {
+		return
+	}
+	r.add(Exchange{
+		ID:       id,
+		Cmd:      cmd,
+		Info:     info,
+		Err:      err,
+		Start:    start,
+		Duration: time.Since(start),
+	})
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+)
+
+func TestWithDiagnostics(t *testing.T) {
+	cmdSet := map[string][]string{
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"OK\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
+		"AT+CMEE=2\r\n":               {"+CME ERROR: 3\r\n"},
+		"AT+GMI\r\n":                  {"Quectel\r\n", "OK\r\n"},
+	}
+	a, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	r := at.DiagnosticsReport{}
+	err := a.Init(at.WithDiagnostics(&r))
+	require.Nil(t, err)
+	ee := r.Exchanges()
+	require.Equal(t, 2, len(ee))
+	assert.Equal(t, "Z", ee[0].Cmd)
+	assert.Nil(t, ee[0].Err)
+	assert.False(t, ee[0].Start.IsZero())
+	assert.Equal(t, "E0", ee[1].Cmd)
+	assert.Nil(t, r.Err)
+
+	// stopped after Init
+	_, err = a.Command("+GMI")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(r.Exchanges()))
+
+	// failure
+	r = at.DiagnosticsReport{}
+	err = a.Init(at.WithCmds("+GMI", "+CMEE=2", "E0"), at.WithDiagnostics(&r))
+	require.NotNil(t, err)
+	assert.Equal(t, err, r.Err)
+	ee = r.Exchanges()
+	require.Equal(t, 2, len(ee))
+	assert.Equal(t, []string{"Quectel"}, ee[0].Info)
+	assert.True(t, errors.Is(ee[1].Err, at.CMEError("3")))
+	s := r.String()
+	assert.True(t, strings.Contains(s, " AT+GMI ("), s)
+	assert.True(t, strings.Contains(s, "  Quectel\n  OK\n"), s)
+	assert.True(t, strings.Contains(s, "  error: CME Error: 3\n"), s)
+	assert.True(t, strings.Contains(s, "result: AT+CMEE=2 returned error: CME Error: 3\n"), s)
+}
+
+func TestStartDiagnostics(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+GMI\r\n":                      {"Quectel\r\n", "OK\r\n"},
+		"AT+CMGS=\"+123456789\"\r":        {"\n>"},
+		"test message" + string(rune(26)): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
+	}
+	a, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	r := at.DiagnosticsReport{}
+	assert.True(t, a.StartDiagnostics(&r))
+	// already recording
+	assert.False(t, a.StartDiagnostics(&at.DiagnosticsReport{}))
+	_, err := a.Command("+GMI")
+	assert.Nil(t, err)
+	_, err = a.SMSCommand("+CMGS=\"+123456789\"", "test message")
+	assert.Nil(t, err)
+	a.StopDiagnostics()
+	_, err = a.Command("+GMI")
+	assert.Nil(t, err)
+	ee := r.Exchanges()
+	require.Equal(t, 2, len(ee))
+	assert.Equal(t, "+GMI", ee[0].Cmd)
+	assert.Equal(t, "+CMGS=\"+123456789\"", ee[1].Cmd)
+	assert.Equal(t, []string{"+CMGS: 42"}, ee[1].Info)
+}
@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// cmeText maps the numeric CME error codes to their text, as per 3GPP TS
+// 27.007.
+var cmeText = map[string]string{
+	"0":   "phone failure",
+	"1":   "no connection to phone",
+	"2":   "phone-adaptor link reserved",
+	"3":   "operation not allowed",
+	"4":   "operation not supported",
+	"5":   "PH-SIM PIN required",
+	"6":   "PH-FSIM PIN required",
+	"7":   "PH-FSIM PUK required",
+	"10":  "SIM not inserted",
+	"11":  "SIM PIN required",
+	"12":  "SIM PUK required",
+	"13":  "SIM failure",
+	"14":  "SIM busy",
+	"15":  "SIM wrong",
+	"16":  "incorrect password",
+	"17":  "SIM PIN2 required",
+	"18":  "SIM PUK2 required",
+	"20":  "memory full",
+	"21":  "invalid index",
+	"22":  "not found",
+	"23":  "memory failure",
+	"24":  "text string too long",
+	"25":  "invalid characters in text string",
+	"26":  "dial string too long",
+	"27":  "invalid characters in dial string",
+	"30":  "no network service",
+	"31":  "network timeout",
+	"32":  "network not allowed - emergency calls only",
+	"40":  "network personalization PIN required",
+	"41":  "network personalization PUK required",
+	"42":  "network subset personalization PIN required",
+	"43":  "network subset personalization PUK required",
+	"44":  "service provider personalization PIN required",
+	"45":  "service provider personalization PUK required",
+	"46":  "corporate personalization PIN required",
+	"47":  "corporate personalization PUK required",
+	"100": "unknown",
+}
+
+// cmsText maps the numeric CMS error codes to their text, as per 3GPP TS
+// 27.005.
+var cmsText = map[string]string{
+	"300": "ME failure",
+	"301": "SMS service of ME reserved",
+	"302": "operation not allowed",
+	"303": "operation not supported",
+	"304": "invalid PDU mode parameter",
+	"305": "invalid text mode parameter",
+	"310": "SIM not inserted",
+	"311": "SIM PIN required",
+	"312": "PH-SIM PIN required",
+	"313": "SIM failure",
+	"314": "SIM busy",
+	"315": "SIM wrong",
+	"316": "SIM PUK required",
+	"317": "SIM PIN2 required",
+	"318": "SIM PUK2 required",
+	"320": "memory failure",
+	"321": "invalid memory index",
+	"322": "memory full",
+	"330": "SMSC address unknown",
+	"331": "no network service",
+	"332": "network timeout",
+	"340": "no +CNMA acknowledgement expected",
+	"500": "unknown error",
+}
+
+// Text returns the textual form of the error.
+//
+// Numeric errors, as returned when the modem is configured with +CMEE=1, are
+// translated to the corresponding text.  Textual errors, and numeric errors
+// with no known translation, are returned unaltered.
+func (e CMEError) Text() string {
+	if t, ok := cmeText[string(e)]; ok {
+		return t
+	}
+	return string(e)
+}
+
+// Text returns the textual form of the error.
+//
+// Numeric errors, as returned when the modem is configured with +CMEE=1, are
+// translated to the corresponding text.  Textual errors, and numeric errors
+// with no known translation, are returned unaltered.
+func (e CMSError) Text() string {
+	if t, ok := cmsText[string(e)]; ok {
+		return t
+	}
+	return string(e)
+}
+
+// CommandError is the error returned by a command when the AT is created with
+// WithErrorContext.
+//
+// It wraps the error returned by the modem with the context of the command,
+// so the failure can be diagnosed from logs alone.
+type CommandError struct {
+	// ID is the correlation ID of the command, as recorded in the journal,
+	// spans and traces.
+	ID uint64
+
+	// Cmd is the command, without the AT prefix.
+	Cmd string
+
+	// Info is the info returned by the modem before the command failed.
+	Info []string
+
+	// Elapsed is the time between the command being issued and it failing.
+	Elapsed time.Duration
+
+	// Err is the underlying error, such as a CMEError or ErrDeadlineExceeded.
+	Err error
+}
+
+func (e *CommandError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "AT%s: %s (after %s, #%d)", e.Cmd, e.Err, e.Elapsed, e.ID)
+	if len(e.Info) > 0 {
+		fmt.Fprintf(&b, " info: %q", e.Info)
+	}
+	return b.String()
+}
+
+// Unwrap returns the underlying error, so the error can be tested using
+// errors.Is and errors.As.
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorContextOption specifies that command errors are returned as a
+// CommandError.
+type ErrorContextOption bool
+
+func (o ErrorContextOption) applyOption(a *AT) {
+	a.errContext = bool(o)
+}
+
+// WithErrorContext specifies that errors returned by Command, SMSCommand and
+// DataCommand are wrapped in a CommandError, which records the command, the
+// info returned, and the time taken before the failure.
+//
+// The underlying error remains available via errors.Is and errors.As, so
+// errors should be tested using those rather than by direct comparison.
+//
+// The wrapping is opt-in, as errors such as ErrDeadlineExceeded and CMEError
+// have always been returned unwrapped, so existing callers compare them
+// directly, e.g. err == at.ErrDeadlineExceeded, and those comparisons would
+// silently fail if the errors were wrapped by default.
+//
+// As the gsm package issues its commands through the AT, the errors from
+// those commands are also wrapped, but errors raised by the gsm package
+// itself, such as gsm.ErrNoService, are not.
+func WithErrorContext() ErrorContextOption {
+	return ErrorContextOption(true)
+}
+
+// withContext wraps the error returned by a command in a CommandError, if
+// enabled.
+func (a *AT) withContext(id uint64, cmd string, start time.Time, info []string, err error) error {
+	if err == nil || !a.errContext {
+		return err
+	}
+	return &CommandError{
+		ID:      id,
+		Cmd:     cmd,
+		Info:    info,
+		Elapsed: time.Since(start),
+		Err:     err,
+	}
+}
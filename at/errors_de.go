@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+// cmeTextDE maps the numeric CME error codes to their German descriptions.
+var cmeTextDE = map[string]string{
+	"0":   "Telefonfehler",
+	"1":   "keine Verbindung zum Telefon",
+	"2":   "Telefonadapter-Verbindung reserviert",
+	"3":   "Vorgang nicht erlaubt",
+	"4":   "Vorgang nicht unterstützt",
+	"5":   "PH-SIM-PIN erforderlich",
+	"6":   "PH-FSIM-PIN erforderlich",
+	"7":   "PH-FSIM-PUK erforderlich",
+	"10":  "SIM-Karte nicht eingelegt",
+	"11":  "SIM-PIN erforderlich",
+	"12":  "SIM-PUK erforderlich",
+	"13":  "SIM-Kartenfehler",
+	"14":  "SIM-Karte beschäftigt",
+	"15":  "falsche SIM-Karte",
+	"16":  "falsches Passwort",
+	"17":  "SIM-PIN2 erforderlich",
+	"18":  "SIM-PUK2 erforderlich",
+	"20":  "Speicher voll",
+	"21":  "ungültiger Index",
+	"22":  "nicht gefunden",
+	"23":  "Speicherfehler",
+	"24":  "Text zu lang",
+	"25":  "ungültige Zeichen im Text",
+	"26":  "Rufnummer zu lang",
+	"27":  "ungültige Zeichen in der Rufnummer",
+	"30":  "kein Netz",
+	"31":  "Zeitüberschreitung im Netz",
+	"32":  "Netz nicht erlaubt - nur Notrufe",
+	"40":  "Netz-Personalisierungs-PIN erforderlich",
+	"41":  "Netz-Personalisierungs-PUK erforderlich",
+	"42":  "Netzteilmengen-Personalisierungs-PIN erforderlich",
+	"43":  "Netzteilmengen-Personalisierungs-PUK erforderlich",
+	"44":  "Dienstanbieter-Personalisierungs-PIN erforderlich",
+	"45":  "Dienstanbieter-Personalisierungs-PUK erforderlich",
+	"46":  "Firmen-Personalisierungs-PIN erforderlich",
+	"47":  "Firmen-Personalisierungs-PUK erforderlich",
+	"100": "unbekannt",
+}
+
+// cmsTextDE maps the numeric CMS error codes to their German descriptions.
+var cmsTextDE = map[string]string{
+	"300": "Gerätefehler",
+	"301": "SMS-Dienst des Geräts reserviert",
+	"302": "Vorgang nicht erlaubt",
+	"303": "Vorgang nicht unterstützt",
+	"304": "ungültiger Parameter im PDU-Modus",
+	"305": "ungültiger Parameter im Textmodus",
+	"310": "SIM-Karte nicht eingelegt",
+	"311": "SIM-PIN erforderlich",
+	"312": "PH-SIM-PIN erforderlich",
+	"313": "SIM-Kartenfehler",
+	"314": "SIM-Karte beschäftigt",
+	"315": "falsche SIM-Karte",
+	"316": "SIM-PUK erforderlich",
+	"317": "SIM-PIN2 erforderlich",
+	"318": "SIM-PUK2 erforderlich",
+	"320": "Speicherfehler",
+	"321": "ungültiger Speicherindex",
+	"322": "Speicher voll",
+	"330": "SMSC-Adresse unbekannt",
+	"331": "kein Netz",
+	"332": "Zeitüberschreitung im Netz",
+	"340": "keine +CNMA-Bestätigung erwartet",
+	"500": "unbekannter Fehler",
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+// cmeTextFR maps the numeric CME error codes to their French descriptions.
+var cmeTextFR = map[string]string{
+	"0":   "défaillance du téléphone",
+	"1":   "aucune connexion au téléphone",
+	"2":   "liaison avec l'adaptateur du téléphone réservée",
+	"3":   "opération non autorisée",
+	"4":   "opération non prise en charge",
+	"5":   "code PH-SIM PIN requis",
+	"6":   "code PH-FSIM PIN requis",
+	"7":   "code PH-FSIM PUK requis",
+	"10":  "carte SIM non insérée",
+	"11":  "code PIN de la SIM requis",
+	"12":  "code PUK de la SIM requis",
+	"13":  "défaillance de la carte SIM",
+	"14":  "carte SIM occupée",
+	"15":  "carte SIM incorrecte",
+	"16":  "mot de passe incorrect",
+	"17":  "code PIN2 de la SIM requis",
+	"18":  "code PUK2 de la SIM requis",
+	"20":  "mémoire pleine",
+	"21":  "index invalide",
+	"22":  "introuvable",
+	"23":  "défaillance de la mémoire",
+	"24":  "texte trop long",
+	"25":  "caractères invalides dans le texte",
+	"26":  "numéro trop long",
+	"27":  "caractères invalides dans le numéro",
+	"30":  "aucun service réseau",
+	"31":  "délai d'attente du réseau dépassé",
+	"32":  "réseau non autorisé - appels d'urgence uniquement",
+	"40":  "code PIN de personnalisation réseau requis",
+	"41":  "code PUK de personnalisation réseau requis",
+	"42":  "code PIN de personnalisation de sous-réseau requis",
+	"43":  "code PUK de personnalisation de sous-réseau requis",
+	"44":  "code PIN de personnalisation du fournisseur de services requis",
+	"45":  "code PUK de personnalisation du fournisseur de services requis",
+	"46":  "code PIN de personnalisation entreprise requis",
+	"47":  "code PUK de personnalisation entreprise requis",
+	"100": "inconnue",
+}
+
+// cmsTextFR maps the numeric CMS error codes to their French descriptions.
+var cmsTextFR = map[string]string{
+	"300": "défaillance de l'équipement",
+	"301": "service SMS de l'équipement réservé",
+	"302": "opération non autorisée",
+	"303": "opération non prise en charge",
+	"304": "paramètre invalide en mode PDU",
+	"305": "paramètre invalide en mode texte",
+	"310": "carte SIM non insérée",
+	"311": "code PIN de la SIM requis",
+	"312": "code PH-SIM PIN requis",
+	"313": "défaillance de la carte SIM",
+	"314": "carte SIM occupée",
+	"315": "carte SIM incorrecte",
+	"316": "code PUK de la SIM requis",
+	"317": "code PIN2 de la SIM requis",
+	"318": "code PUK2 de la SIM requis",
+	"320": "défaillance de la mémoire",
+	"321": "index de mémoire invalide",
+	"322": "mémoire pleine",
+	"330": "adresse du SMSC inconnue",
+	"331": "aucun service réseau",
+	"332": "délai d'attente du réseau dépassé",
+	"340": "aucun acquittement +CNMA attendu",
+	"500": "erreur inconnue",
+}
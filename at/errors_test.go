@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+)
+
+func TestCMEErrorText(t *testing.T) {
+	patterns := []struct {
+		err  at.CMEError
+		text string
+	}{
+		{"10", "SIM not inserted"},
+		{"14", "SIM busy"},
+		{"100", "unknown"},
+		{"999", "999"},
+		{"SIM busy", "SIM busy"},
+	}
+	for _, p := range patterns {
+		assert.Equal(t, p.text, p.err.Text(), string(p.err))
+	}
+}
+
+func TestCMSErrorText(t *testing.T) {
+	patterns := []struct {
+		err  at.CMSError
+		text string
+	}{
+		{"304", "invalid PDU mode parameter"},
+		{"330", "SMSC address unknown"},
+		{"204", "204"},
+		{"memory full", "memory full"},
+	}
+	for _, p := range patterns {
+		assert.Equal(t, p.text, p.err.Text(), string(p.err))
+	}
+}
+
+func TestWithErrorContext(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CPIN?\r\n":  {"+CME ERROR: 10\r\n"},
+		"AT+COPS=?\r\n": {"+COPS: (2,\"Telstra\")\r\n", "ERROR\r\n"},
+		"AT+CMGS=23\r":  {"\n>"},
+		"pdu\x1a":       {"\r\n+CMS ERROR: 500\r\n"},
+		"AT+GMI\r\n":    {"Quectel\r\n", "OK\r\n"},
+		"AT+CSQ\r\n":    {""},
+	}
+	a, mm := setupModem(t, cmdSet, at.WithErrorContext())
+	defer teardownModem(mm)
+
+	info, err := a.Command("+GMI")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"Quectel"}, info)
+
+	_, err = a.Command("+CPIN?")
+	var ce *at.CommandError
+	require.True(t, errors.As(err, &ce), err)
+	assert.Equal(t, "+CPIN?", ce.Cmd)
+	assert.Equal(t, at.CMEError("10"), ce.Err)
+	var cme at.CMEError
+	assert.True(t, errors.As(err, &cme))
+	assert.Equal(t, "10", string(cme))
+
+	_, err = a.Command("+COPS=?")
+	require.True(t, errors.As(err, &ce), err)
+	assert.True(t, errors.Is(err, at.ErrError))
+	assert.Equal(t, []string{"+COPS: (2,\"Telstra\")"}, ce.Info)
+	assert.Contains(t, err.Error(), "AT+COPS=?: ERROR (after ")
+	assert.Contains(t, err.Error(), `info: ["+COPS: (2,\"Telstra\")"]`)
+
+	_, err = a.SMSCommand("+CMGS=23", "pdu")
+	require.True(t, errors.As(err, &ce), err)
+	assert.Equal(t, "+CMGS=23", ce.Cmd)
+	assert.Equal(t, at.CMSError("500"), ce.Err)
+
+	_, err = a.Command("+CSQ", at.WithTimeout(10*time.Millisecond))
+	require.True(t, errors.As(err, &ce), err)
+	assert.True(t, errors.Is(err, at.ErrDeadlineExceeded))
+	assert.True(t, ce.Elapsed >= 10*time.Millisecond, ce.Elapsed)
+}
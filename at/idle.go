@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import (
+	"time"
+)
+
+// beginCommand marks the start of a command, including any time spent queued
+// waiting for the command channel, and returns the function to call when the
+// command completes.
+func (a *AT) beginCommand() func() {
+	a.activityMu.Lock()
+	a.active++
+	a.activityMu.Unlock()
+	return func() {
+		a.activityMu.Lock()
+		a.active--
+		a.lastActive = time.Now()
+		a.activityMu.Unlock()
+	}
+}
+
+// Idle returns the period the command channel has been idle, i.e. since the
+// most recent command completed, or since the AT was created if no commands
+// have been issued.
+//
+// Returns zero while commands are queued or in progress.
+func (a *AT) Idle() time.Duration {
+	a.activityMu.Lock()
+	defer a.activityMu.Unlock()
+	if a.active > 0 {
+		return 0
+	}
+	return time.Since(a.lastActive)
+}
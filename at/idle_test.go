@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdle(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CSQ\r\n": {"+CSQ: 20,0\r\n", "OK\r\n"},
+	}
+	a, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, a.Idle() >= 20*time.Millisecond)
+
+	// busy while in progress
+	mm.readDelay = 50 * time.Millisecond
+	done := make(chan struct{})
+	go func() {
+		a.Command("+CSQ")
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, a.Idle())
+	<-done
+
+	// restarted on completion
+	idle := a.Idle()
+	assert.True(t, idle < 20*time.Millisecond, idle)
+	time.Sleep(20 * time.Millisecond)
+	require.True(t, a.Idle() >= 20*time.Millisecond)
+}
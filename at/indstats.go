@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// IndicationStats are the counters of the calls to the handler of an
+// indication.
+//
+// The counters are cumulative from the creation of the AT, and persist if the
+// indication is cancelled and added again.
+type IndicationStats struct {
+	// Prefix is the prefix of the indication, as provided to AddIndication.
+	Prefix string
+
+	// Count is the number of times the handler has been called.
+	Count uint64
+
+	// TotalTime is the total time spent in the handler.
+	TotalTime time.Duration
+
+	// MaxTime is the longest time spent in a single call to the handler.
+	MaxTime time.Duration
+
+	// Slow is the number of calls that exceeded the budget set by
+	// WithHandlerBudget.
+	Slow uint64
+}
+
+// MeanTime returns the average time spent in the handler.
+func (s IndicationStats) MeanTime() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalTime / time.Duration(s.Count)
+}
+
+// SlowHandler is the warning emitted when the handler of an indication
+// exceeds the budget set by WithHandlerBudget.
+type SlowHandler struct {
+	// Time is the time the indication was read from the modem.
+	Time time.Time
+
+	// Prefix is the prefix of the indication.
+	Prefix string
+
+	// Lines are the lines of the indication passed to the handler.
+	Lines []string
+
+	// Duration is the time spent in the handler.
+	Duration time.Duration
+
+	// Budget is the budget that was exceeded.
+	Budget time.Duration
+}
+
+// SlowHandlerHandler receives warnings of slow indication handlers.
+type SlowHandlerHandler func(SlowHandler)
+
+// HandlerBudgetOption sets the time budget for indication handlers.
+type HandlerBudgetOption struct {
+	d time.Duration
+	h SlowHandlerHandler
+}
+
+func (o HandlerBudgetOption) applyOption(a *AT) {
+	a.indStats.budget = o.d
+	a.indStats.slow = o.h
+}
+
+// WithHandlerBudget specifies the maximum time indication handlers are
+// expected to take, and a handler passed a SlowHandler warning for each call
+// that exceeds it.
+//
+// Indication handlers that block, such as by issuing commands that are queued
+// behind a long running command, can stall the processing of indications, so
+// the warnings identify the handler responsible.
+//
+// The warning is emitted once the slow handler returns, from the goroutine
+// that called it, so the warning handler should not block.
+func WithHandlerBudget(d time.Duration, h SlowHandlerHandler) HandlerBudgetOption {
+	return HandlerBudgetOption{d, h}
+}
+
+// IndicationStats returns the counters of the calls to the handler of each
+// indication, sorted by prefix.
+func (a *AT) IndicationStats() []IndicationStats {
+	return a.indStats.snapshot()
+}
+
+// indicationStats holds the counters of the calls to indication handlers.
+type indicationStats struct {
+	// mu protects stats, as the handlers are called from separate goroutines.
+	mu    sync.Mutex
+	stats map[string]*IndicationStats
+
+	// the budget for each call, or 0 if unlimited.
+	budget time.Duration
+
+	// if not-nil, the handler for SlowHandler warnings.
+	slow SlowHandlerHandler
+}
+
+func newIndicationStats() *indicationStats {
+	return &indicationStats{stats: make(map[string]*IndicationStats)}
+}
+
+// record updates the counters for a call to the handler of the indication,
+// and emits a warning if the call exceeded the budget.
+func (s *indicationStats) record(prefix string, lines []string, t time.Time, d time.Duration) {
+	slow := s.budget > 0 && d > s.budget
+	s.mu.Lock()
+	st, ok := s.stats[prefix]
+	if !ok {
+		st = &IndicationStats{Prefix: prefix}
+		s.stats[prefix] = st
+	}
+	st.Count++
+	st.TotalTime += d
+	if d > st.MaxTime {
+		st.MaxTime = d
+	}
+	if slow {
+		st.Slow++
+	}
+	s.mu.Unlock()
+	if slow && s.slow != nil {
+		s.slow(SlowHandler{
+			Time:     t,
+			Prefix:   prefix,
+			Lines:    lines,
+			Duration: d,
+			Budget:   s.budget,
+		})
+	}
+}
+
+func (s *indicationStats) snapshot() []IndicationStats {
+	s.mu.Lock()
+	ss := make([]IndicationStats, 0, len(s.stats))
+	for _, st := range s.stats {
+		ss = append(ss, *st)
+	}
+	s.mu.Unlock()
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Prefix < ss[j].Prefix })
+	return ss
+}
+
+// callHandler calls the handler of the indication and records the time spent
+// in it.
+func (a *AT) callHandler(ind Indication, lines []string, t time.Time) {
+	start := time.Now()
+	ind.handler(lines, t)
+	a.indStats.record(ind.prefix, lines, t, time.Since(start))
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+)
+
+func TestIndicationStats(t *testing.T) {
+	slowChan := make(chan at.SlowHandler, 3)
+	sh := func(s at.SlowHandler) {
+		slowChan <- s
+	}
+	m, mm := setupModem(t, nil, at.WithHandlerBudget(10*time.Millisecond, sh))
+	defer teardownModem(mm)
+
+	assert.Empty(t, m.IndicationStats())
+
+	done := make(chan struct{}, 3)
+	fast := func(info []string) {
+		done <- struct{}{}
+	}
+	slow := func(info []string) {
+		time.Sleep(20 * time.Millisecond)
+		done <- struct{}{}
+	}
+	err := m.AddIndication("+FAST:", fast)
+	require.Nil(t, err)
+	err = m.AddIndication("+SLOW:", slow, at.WithTrailingLine)
+	require.Nil(t, err)
+
+	wait := func() {
+		select {
+		case <-done:
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("handler not called")
+		}
+	}
+	mm.r <- []byte("+FAST: 1\r\n")
+	wait()
+	mm.r <- []byte("+FAST: 2\r\n")
+	wait()
+	mm.r <- []byte("+SLOW: 1\r\ntrailing\r\n")
+	wait()
+
+	select {
+	case s := <-slowChan:
+		assert.Equal(t, "+SLOW:", s.Prefix)
+		assert.Equal(t, []string{"+SLOW: 1", "trailing"}, s.Lines)
+		assert.Equal(t, 10*time.Millisecond, s.Budget)
+		assert.True(t, s.Duration >= 20*time.Millisecond)
+		assert.False(t, s.Time.IsZero())
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no slow handler warning")
+	}
+	assert.Empty(t, slowChan)
+
+	// the stats are recorded after the handler returns.
+	var stats []at.IndicationStats
+	for i := 0; i < 10; i++ {
+		stats = m.IndicationStats()
+		if len(stats) == 2 && stats[0].Count == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.Len(t, stats, 2)
+	assert.Equal(t, "+FAST:", stats[0].Prefix)
+	assert.Equal(t, uint64(2), stats[0].Count)
+	assert.Equal(t, uint64(0), stats[0].Slow)
+	assert.True(t, stats[0].MaxTime <= stats[0].TotalTime)
+	assert.Equal(t, "+SLOW:", stats[1].Prefix)
+	assert.Equal(t, uint64(1), stats[1].Count)
+	assert.Equal(t, uint64(1), stats[1].Slow)
+	assert.True(t, stats[1].MaxTime >= 20*time.Millisecond)
+	assert.Equal(t, stats[1].TotalTime, stats[1].MeanTime())
+
+	// the stats persist after the indication is cancelled.
+	m.CancelIndication("+SLOW:")
+	assert.Len(t, m.IndicationStats(), 2)
+}
+
+func TestIndicationStatsMeanTime(t *testing.T) {
+	assert.Equal(t, time.Duration(0), at.IndicationStats{}.MeanTime())
+	s := at.IndicationStats{Count: 4, TotalTime: 10 * time.Millisecond}
+	assert.Equal(t, 2500*time.Microsecond, s.MeanTime())
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// JournalEntry is a command or indication recorded in the journal.
+type JournalEntry struct {
+	// ID is the correlation ID of the command, or 0 for an indication.
+	ID uint64
+
+	// Time is the time the command was issued, or the indication was read
+	// from the modem.
+	Time time.Time
+
+	// Cmd is the command, without the AT prefix, or empty for an indication.
+	Cmd string
+
+	// Lines are the info returned by the command, or the lines of the
+	// indication.
+	Lines []string
+
+	// Err is the error returned by the command.
+	Err error
+
+	// Duration is the time taken for the modem to complete the command.
+	Duration time.Duration
+}
+
+// journal is a ring buffer of the most recent commands and indications.
+type journal struct {
+	mu      sync.Mutex
+	entries []JournalEntry
+	next    int
+	full    bool
+}
+
+func newJournal(size int) *journal {
+	return &journal{entries: make([]JournalEntry, size)}
+}
+
+func (j *journal) add(e JournalEntry) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.entries[j.next] = e
+	j.next++
+	if j.next == len(j.entries) {
+		j.next = 0
+		j.full = true
+	}
+	j.mu.Unlock()
+}
+
+// snapshot returns the entries, oldest first.
+func (j *journal) snapshot() []JournalEntry {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.full {
+		return append([]JournalEntry(nil), j.entries[:j.next]...)
+	}
+	return append(append([]JournalEntry(nil), j.entries[j.next:]...), j.entries[:j.next]...)
+}
+
+// JournalOption specifies the number of entries retained in the journal.
+type JournalOption int
+
+func (o JournalOption) applyOption(a *AT) {
+	if o > 0 {
+		a.journal = newJournal(int(o))
+	}
+}
+
+// WithJournal specifies that the most recent commands, with their responses,
+// and indications are retained in a journal, so they are available for
+// postmortem analysis even if the modem is not being traced.
+//
+// The journal retains the given number of entries, with each command or
+// indication being one entry.
+func WithJournal(size int) JournalOption {
+	return JournalOption(size)
+}
+
+// Journal returns the entries in the journal, oldest first.
+//
+// Returns nil if the journal is not enabled.
+func (a *AT) Journal() []JournalEntry {
+	return a.journal.snapshot()
+}
+
+// DumpJournal writes the entries in the journal, oldest first, in a human
+// readable form.
+func (a *AT) DumpJournal(w io.Writer) error {
+	for _, e := range a.Journal() {
+		var err error
+		ts := e.Time.Format("15:04:05.000")
+		if e.Cmd == "" {
+			_, err = fmt.Fprintf(w, "%s indication\n", ts)
+		} else {
+			_, err = fmt.Fprintf(w, "%s #%d AT%s (%s)\n", ts, e.ID, e.Cmd, e.Duration)
+		}
+		if err != nil {
+			return err
+		}
+		for _, l := range e.Lines {
+			if _, err = fmt.Fprintf(w, "  %s\n", l); err != nil {
+				return err
+			}
+		}
+		if e.Err != nil {
+			if _, err = fmt.Fprintf(w, "  error: %s\n", e.Err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+)
+
+func TestWithJournal(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+GMI\r\n":  {"Quectel\r\n", "OK\r\n"},
+		"AT+GMM\r\n":  {"EC25\r\n", "OK\r\n"},
+		"AT+CSQ\r\n":  {"+CSQ: 20,0\r\n", "OK\r\n"},
+		"AT+CMEE\r\n": {"+CME ERROR: 3\r\n"},
+	}
+	a, mm := setupModem(t, cmdSet, at.WithJournal(3))
+	defer teardownModem(mm)
+
+	assert.Empty(t, a.Journal())
+	_, err := a.Command("+GMI")
+	require.Nil(t, err)
+	ee := a.Journal()
+	require.Equal(t, 1, len(ee))
+	assert.Equal(t, "+GMI", ee[0].Cmd)
+	assert.Equal(t, []string{"Quectel"}, ee[0].Lines)
+	assert.False(t, ee[0].Time.IsZero())
+
+	ind := make(chan []string, 1)
+	err = a.AddIndication("+CMTI:", func(info []string) {
+		ind <- info
+	})
+	require.Nil(t, err)
+	mm.r <- []byte("\r\n+CMTI: \"SM\",3\r\n")
+	select {
+	case <-ind:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no indication")
+	}
+	a.Command("+GMM")
+	a.Command("+CMEE")
+
+	// wrapped
+	ee = a.Journal()
+	require.Equal(t, 3, len(ee))
+	assert.Equal(t, "", ee[0].Cmd)
+	assert.Equal(t, []string{"+CMTI: \"SM\",3"}, ee[0].Lines)
+	assert.Equal(t, "+GMM", ee[1].Cmd)
+	assert.Equal(t, "+CMEE", ee[2].Cmd)
+	assert.Equal(t, at.CMEError("3"), ee[2].Err)
+
+	a.Command("+CSQ")
+	var b bytes.Buffer
+	err = a.DumpJournal(&b)
+	assert.Nil(t, err)
+	dump := b.String()
+	assert.Contains(t, dump, " AT+GMM ("+ee[1].Duration.String()+")\n")
+	assert.Contains(t, dump, "  EC25\n")
+	assert.Contains(t, dump, " AT+CMEE ("+ee[2].Duration.String()+")\n  error: CME Error: 3\n")
+	assert.Contains(t, dump, " AT+CSQ (")
+	assert.True(t, strings.HasSuffix(dump, "  +CSQ: 20,0\n"), dump)
+}
+
+func TestJournalDisabled(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+GMI\r\n": {"Quectel\r\n", "OK\r\n"},
+	}
+	a, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	_, err := a.Command("+GMI")
+	require.Nil(t, err)
+	assert.Nil(t, a.Journal())
+	var b bytes.Buffer
+	assert.Nil(t, a.DumpJournal(&b))
+	assert.Equal(t, 0, b.Len())
+}
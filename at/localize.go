@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrorTable provides the descriptions of the numeric CME and CMS error codes
+// in a particular language.
+//
+// Codes missing from the table are described in English, so a table may be
+// partial.
+type ErrorTable struct {
+	// CME maps the numeric CME error codes to their descriptions.
+	CME map[string]string
+
+	// CMS maps the numeric CMS error codes to their descriptions.
+	CMS map[string]string
+}
+
+var (
+	// tablesMu protects tables.
+	tablesMu sync.RWMutex
+
+	// the error tables, mapped by language tag.
+	tables = map[string]ErrorTable{
+		"en": {CME: cmeText, CMS: cmsText},
+		"de": {CME: cmeTextDE, CMS: cmsTextDE},
+		"fr": {CME: cmeTextFR, CMS: cmsTextFR},
+	}
+
+	// the codes of the English error descriptions, as returned by modems
+	// configured with +CMEE=2, mapped by the lower case description.
+	cmeCodes = reverse(cmeText)
+	cmsCodes = reverse(cmsText)
+)
+
+func reverse(m map[string]string) map[string]string {
+	r := make(map[string]string, len(m))
+	for k, v := range m {
+		r[strings.ToLower(v)] = k
+	}
+	return r
+}
+
+// RegisterErrorTable adds or replaces the error table for a language, such
+// as "es" or "pt-BR".
+//
+// Tables for English ("en"), German ("de") and French ("fr") are built in.
+func RegisterErrorTable(lang string, t ErrorTable) {
+	tablesMu.Lock()
+	tables[strings.ToLower(lang)] = t
+	tablesMu.Unlock()
+}
+
+// lookup returns the description of the code in the language, falling back
+// from a regional variant, such as "de-AT", to the base language, "de".
+func lookup(lang, code string, table func(ErrorTable) map[string]string) (string, bool) {
+	lang = strings.ToLower(strings.Replace(lang, "_", "-", -1))
+	tablesMu.RLock()
+	defer tablesMu.RUnlock()
+	for {
+		if t, ok := tables[lang]; ok {
+			if d, ok := table(t)[code]; ok {
+				return d, true
+			}
+		}
+		idx := strings.LastIndex(lang, "-")
+		if idx < 0 {
+			return "", false
+		}
+		lang = lang[:idx]
+	}
+}
+
+// Code returns the numeric code of the error.
+//
+// Textual errors, as returned when the modem is configured with +CMEE=2, are
+// mapped back to the corresponding code, so logs can record the code
+// regardless of the modem configuration.  Returns false if the error is
+// textual and the text is not recognised.
+func (e CMEError) Code() (string, bool) {
+	if _, ok := cmeText[string(e)]; ok {
+		return string(e), true
+	}
+	c, ok := cmeCodes[strings.ToLower(strings.TrimSpace(string(e)))]
+	return c, ok
+}
+
+// Localize returns the description of the error in the language, such as
+// "de", for display to users.
+//
+// Errors with no description in the language are described in English, as
+// per Text.
+func (e CMEError) Localize(lang string) string {
+	if c, ok := e.Code(); ok {
+		if d, ok := lookup(lang, c, func(t ErrorTable) map[string]string { return t.CME }); ok {
+			return d
+		}
+	}
+	return e.Text()
+}
+
+// Code returns the numeric code of the error.
+//
+// Textual errors, as returned when the modem is configured with +CMEE=2, are
+// mapped back to the corresponding code, so logs can record the code
+// regardless of the modem configuration.  Returns false if the error is
+// textual and the text is not recognised.
+func (e CMSError) Code() (string, bool) {
+	if _, ok := cmsText[string(e)]; ok {
+		return string(e), true
+	}
+	c, ok := cmsCodes[strings.ToLower(strings.TrimSpace(string(e)))]
+	return c, ok
+}
+
+// Localize returns the description of the error in the language, such as
+// "de", for display to users.
+//
+// Errors with no description in the language are described in English, as
+// per Text.
+func (e CMSError) Localize(lang string) string {
+	if c, ok := e.Code(); ok {
+		if d, ok := lookup(lang, c, func(t ErrorTable) map[string]string { return t.CMS }); ok {
+			return d
+		}
+	}
+	return e.Text()
+}
+
+// LocalizeError returns the description of the CME or CMS error wrapped in
+// err in the language, or the text of err if it wraps neither.
+func LocalizeError(err error, lang string) string {
+	var cme CMEError
+	if errors.As(err, &cme) {
+		return cme.Localize(lang)
+	}
+	var cms CMSError
+	if errors.As(err, &cms) {
+		return cms.Localize(lang)
+	}
+	return err.Error()
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/at"
+)
+
+func TestErrorCode(t *testing.T) {
+	patterns := []struct {
+		err  error
+		code string
+		ok   bool
+	}{
+		{at.CMEError("10"), "10", true},
+		{at.CMEError("SIM busy"), "14", true},
+		{at.CMEError("sim PIN required"), "11", true},
+		{at.CMEError("999"), "", false},
+		{at.CMEError("widget jammed"), "", false},
+		{at.CMSError("330"), "330", true},
+		{at.CMSError("memory full"), "322", true},
+		{at.CMSError("widget jammed"), "", false},
+	}
+	for _, p := range patterns {
+		var code string
+		var ok bool
+		switch e := p.err.(type) {
+		case at.CMEError:
+			code, ok = e.Code()
+		case at.CMSError:
+			code, ok = e.Code()
+		}
+		assert.Equal(t, p.code, code, p.err)
+		assert.Equal(t, p.ok, ok, p.err)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	at.RegisterErrorTable("es", at.ErrorTable{
+		CME: map[string]string{"10": "SIM no insertada"},
+	})
+	patterns := []struct {
+		name string
+		err  error
+		lang string
+		text string
+	}{
+		{"numeric", at.CMEError("10"), "de", "SIM-Karte nicht eingelegt"},
+		{"textual", at.CMEError("SIM busy"), "fr", "carte SIM occupée"},
+		{"regional", at.CMEError("10"), "de-AT", "SIM-Karte nicht eingelegt"},
+		{"underscore", at.CMEError("10"), "fr_CA", "carte SIM non insérée"},
+		{"english", at.CMEError("10"), "en", "SIM not inserted"},
+		{"unknown language", at.CMEError("10"), "xx", "SIM not inserted"},
+		{"unknown code", at.CMEError("999"), "de", "999"},
+		{"unknown text", at.CMEError("widget jammed"), "de", "widget jammed"},
+		{"cms", at.CMSError("322"), "de", "Speicher voll"},
+		{"cms textual", at.CMSError("SMSC address unknown"), "fr", "adresse du SMSC inconnue"},
+		{"registered", at.CMEError("10"), "ES", "SIM no insertada"},
+		{"partial table", at.CMEError("14"), "es", "SIM busy"},
+		{"wrapped", fmt.Errorf("send: %w", at.CMSError("500")), "de", "unbekannter Fehler"},
+		{"other", errors.New("boom"), "de", "boom"},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			assert.Equal(t, p.text, at.LocalizeError(p.err, p.lang))
+		}
+		t.Run(p.name, f)
+	}
+}
@@ -0,0 +1,259 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEvent records a command checked against the command policy.
+type AuditEvent struct {
+	// Time is the time the command was checked.
+	Time time.Time
+
+	// Cmd is the command, without the AT prefix.
+	Cmd string
+
+	// Allowed indicates if the command was issued to the modem.
+	Allowed bool
+
+	// Reason describes why the command was denied, or is empty if allowed.
+	Reason string
+}
+
+// AuditHandler receives the audit events for the commands checked against the
+// command policy.
+type AuditHandler func(AuditEvent)
+
+// policy restricts the commands that may be issued to the modem.
+type policy struct {
+	allow []string
+	deny  []string
+	audit AuditHandler
+}
+
+func (a *AT) ensurePolicy() *policy {
+	if a.policy == nil {
+		a.policy = &policy{}
+	}
+	return a.policy
+}
+
+// AllowListOption restricts the commands that may be issued to those on the
+// list.
+type AllowListOption []string
+
+func (o AllowListOption) applyOption(a *AT) {
+	p := a.ensurePolicy()
+	p.allow = append(p.allow, o...)
+}
+
+// WithAllowList restricts the commands that may be issued, using Command,
+// SMSCommand or DataCommand, to those beginning with one of the prefixes,
+// such as "+CMGS" or "+CSQ".  Prefixes are matched without the AT prefix,
+// and ignoring case.
+//
+// The list applies to all commands, including those issued by Init and by
+// higher layers, such as the gsm package, so must include those as well as
+// any issued directly.
+//
+// Commands that are not allowed fail with ErrCommandDenied without being
+// issued to the modem.
+//
+// Once a list or audit handler is applied, commands containing control
+// characters, such as CR or Ctrl-Z, which could be used to smuggle additional
+// commands, are always denied.  A command line containing several commands,
+// such as "E0+CMGF=0" or "+CSQ;+CREG?", must have each of the commands
+// allowed, and spaces, which the modem ignores, are ignored when matching.
+func WithAllowList(prefixes ...string) AllowListOption {
+	return AllowListOption(prefixes)
+}
+
+// DenyListOption prevents the commands on the list being issued.
+type DenyListOption []string
+
+func (o DenyListOption) applyOption(a *AT) {
+	p := a.ensurePolicy()
+	p.deny = append(p.deny, o...)
+}
+
+// WithDenyList prevents commands beginning with one of the prefixes, such as
+// "+CLCK" or "+CFUN", being issued, even if they are allowed by
+// WithAllowList.  Prefixes are matched as per WithAllowList.
+//
+// Commands that are denied fail with ErrCommandDenied without being issued to
+// the modem.
+func WithDenyList(prefixes ...string) DenyListOption {
+	return DenyListOption(prefixes)
+}
+
+// AuditOption provides a handler for audit events.
+type AuditOption AuditHandler
+
+func (o AuditOption) applyOption(a *AT) {
+	a.ensurePolicy().audit = AuditHandler(o)
+}
+
+// WithAudit provides a handler that is passed an AuditEvent for each command
+// checked against the allow and deny lists, whether allowed or denied, so
+// attempts to issue restricted commands can be logged or alerted on.
+//
+// The handler is called synchronously, before the command is issued, so
+// should not block.
+func WithAudit(h AuditHandler) AuditOption {
+	return AuditOption(h)
+}
+
+// authorize checks the command against the policy, if any.
+func (a *AT) authorize(cmd string) error {
+	p := a.policy
+	if p == nil {
+		return nil
+	}
+	reason := p.check(cmd)
+	if p.audit != nil {
+		p.audit(AuditEvent{
+			Time:    time.Now(),
+			Cmd:     cmd,
+			Allowed: reason == "",
+			Reason:  reason,
+		})
+	}
+	if reason != "" {
+		return fmt.Errorf("AT%s: %s: %w", cmd, reason, ErrCommandDenied)
+	}
+	return nil
+}
+
+// check returns the reason the command is denied, or an empty string if it
+// is allowed.
+func (p *policy) check(cmd string) string {
+	if strings.IndexFunc(cmd, isControl) >= 0 {
+		return "contains control characters"
+	}
+	for _, c := range splitCommands(cmd) {
+		if matchPrefix(p.deny, c) {
+			return "on deny list"
+		}
+		if p.allow != nil && !matchPrefix(p.allow, c) {
+			return "not on allow list"
+		}
+	}
+	return ""
+}
+
+func matchPrefix(prefixes []string, cmd string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(cmd, normalise(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCommands splits a command line into the commands it contains, as per
+// V.250, normalised for matching.
+//
+// Basic commands are a letter, or '&' and a letter, followed by an optional
+// number, or an S-parameter, e.g. E0, &F or S0=1, and may follow one another
+// without a separator.  Extended commands begin with any other character,
+// such as '+' or a vendor prefix like '^' or '#', and extend to the next ';'
+// outside a quoted string, as does a dial command.
+func splitCommands(line string) []string {
+	line = normalise(line)
+	var cmds []string
+	for len(line) > 0 {
+		c := line[0]
+		var n int
+		switch {
+		case c == ';':
+			line = line[1:]
+			continue
+		case c == 'D':
+			n = commandEnd(line)
+		case c == 'S':
+			n = 1 + countDigits(line[1:])
+			if n < len(line) && line[n] == '?' {
+				n++
+			} else if n < len(line) && line[n] == '=' {
+				n++
+				n += countDigits(line[n:])
+			}
+		case c == '&':
+			n = 1
+			if n < len(line) && isLetter(line[n]) {
+				n++
+			}
+			n += countDigits(line[n:])
+		case isLetter(c):
+			n = 1 + countDigits(line[1:])
+		default:
+			n = commandEnd(line)
+		}
+		cmds = append(cmds, line[:n])
+		line = line[n:]
+	}
+	return cmds
+}
+
+// normalise upper cases the command line and removes any spaces outside
+// quoted strings, as the modem ignores those.
+func normalise(line string) string {
+	var b strings.Builder
+	quoted := false
+	for _, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if r == ' ' && !quoted {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
+
+// commandEnd returns the index of the ';' terminating the command at the
+// start of the line, ignoring any within quoted strings, or the length of
+// the line if the command is not terminated.
+func commandEnd(line string) int {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return len(line)
+}
+
+func countDigits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+func isLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
+
+var (
+	// ErrCommandDenied indicates a command was not issued to the modem as it
+	// is not permitted by the command policy.
+	ErrCommandDenied = errors.New("command denied by policy")
+)
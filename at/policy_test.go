@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/at"
+)
+
+func TestCommandPolicy(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT\r\n":                 {"OK\r\n"},
+		"AT+CSQ\r\n":             {"+CSQ: 20,0\r\n", "OK\r\n"},
+		"AT+CSQ;+CREG?\r\n":      {"+CSQ: 20,0\r\n", "+CREG: 0,1\r\n", "OK\r\n"},
+		"AT+CLCK=\"SC\",2\r\n":   {"+CLCK: 0\r\n", "OK\r\n"},
+		"AT+CMGS=23\r":           {"\n>"},
+		"ATE0+CSQ\r\n":           {"+CSQ: 20,0\r\n", "OK\r\n"},
+		"ATE0 S0=0 +CSQ\r\n":     {"+CSQ: 20,0\r\n", "OK\r\n"},
+		"AT+CREG=\"+CLCK;\"\r\n": {"OK\r\n"},
+	}
+	var events []at.AuditEvent
+	m, mm := setupModem(t, cmdSet,
+		at.WithAllowList("+csq", "+CREG", "+CLCK", "+CMGS", "E0", "S0"),
+		at.WithDenyList("+CLCK"),
+		at.WithAudit(func(e at.AuditEvent) {
+			events = append(events, e)
+		}))
+	defer teardownModem(mm)
+
+	patterns := []struct {
+		name   string
+		cmd    string
+		err    bool
+		reason string
+	}{
+		{"allowed", "+CSQ", false, ""},
+		{"concatenated", "+CSQ;+CREG?", false, ""},
+		{"plain", "", false, ""},
+		{"not allowed", "+CFUN=0", true, "not on allow list"},
+		{"denied", "+CLCK=\"SC\",2", true, "on deny list"},
+		{"concatenated denied", "+CSQ;+CFUN=0", true, "not on allow list"},
+		{"injected", "+CSQ\r\nAT+CFUN=0", true, "contains control characters"},
+		{"basic and extended", "E0+CSQ", false, ""},
+		{"spaced", "E0 S0=0 +CSQ", false, ""},
+		{"quoted", "+CREG=\"+CLCK;\"", false, ""},
+		{"basic then denied", "E0+CLCK=\"SC\",1,\"1234\"", true, "on deny list"},
+		{"spaced denied", "+C LCK=\"SC\",2", true, "on deny list"},
+		{"basic not allowed", "E0V1", true, "not on allow list"},
+		{"S-parameter not allowed", "E0S7=30", true, "not on allow list"},
+		{"dial not allowed", "D123;+CSQ", true, "not on allow list"},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			events = nil
+			_, err := m.Command(p.cmd)
+			if p.err {
+				assert.True(t, errors.Is(err, at.ErrCommandDenied), err)
+			} else {
+				assert.Nil(t, err)
+			}
+			if assert.Equal(t, 1, len(events)) {
+				assert.Equal(t, p.cmd, events[0].Cmd)
+				assert.Equal(t, !p.err, events[0].Allowed)
+				assert.Equal(t, p.reason, events[0].Reason)
+				assert.False(t, events[0].Time.IsZero())
+			}
+		}
+		t.Run(p.name, f)
+	}
+
+	// SMS and data commands are also checked
+	_, err := m.SMSCommand("+CMGW=23", "pdu")
+	assert.True(t, errors.Is(err, at.ErrCommandDenied), err)
+	_, err = m.DataCommand("+QFUPL=\"x\",3", []byte("abc"))
+	assert.True(t, errors.Is(err, at.ErrCommandDenied), err)
+}
+
+func TestCommandPolicyDenyOnly(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CSQ\r\n": {"+CSQ: 20,0\r\n", "OK\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet, at.WithDenyList("+CFUN"))
+	defer teardownModem(mm)
+
+	_, err := m.Command("+CSQ")
+	assert.Nil(t, err)
+	_, err = m.Command("+cfun=1,1")
+	assert.True(t, errors.Is(err, at.ErrCommandDenied), err)
+}
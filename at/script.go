@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OnError is the policy applied when a step of a script fails.
+type OnError int
+
+const (
+	// Abort stops the script at the failed step.
+	Abort OnError = iota
+
+	// Continue records the failure and continues with the next step.
+	Continue
+
+	// Rollback issues the Rollback commands of the failed step and of the
+	// steps already completed, in reverse order, then stops the script.
+	Rollback
+)
+
+// ScriptStep is a command issued by RunScript.
+type ScriptStep struct {
+	// Cmd is the command, without the AT prefix.
+	Cmd string
+
+	// Expect, if not empty, must be contained in a line of the info returned
+	// by the command, else the step fails with ErrUnexpectedResponse.
+	Expect string
+
+	// OnError is the policy applied if the step fails.
+	OnError OnError
+
+	// Rollback, if not empty, is the command that reverses the effect of the
+	// step, such as restoring a configuration item to its prior value.
+	Rollback string
+
+	// Timeout, if not zero, overrides the timeout for the command.
+	Timeout time.Duration
+}
+
+// StepResult is the outcome of a command issued by RunScript.
+type StepResult struct {
+	// Cmd is the command, without the AT prefix.
+	Cmd string
+
+	// Info is the info returned by the command.
+	Info []string
+
+	// Err is the error returned by the command, or ErrUnexpectedResponse if
+	// the info did not contain the expected response.
+	Err error
+
+	// Duration is the time taken to complete the command.
+	Duration time.Duration
+}
+
+// ScriptReport is the outcome of a script run by RunScript.
+type ScriptReport struct {
+	// Steps are the results of the steps issued, in order.
+	//
+	// Steps after an aborted step are not issued, so are not included.
+	Steps []StepResult
+
+	// Rollbacks are the results of the rollback commands issued, in the
+	// order issued.
+	Rollbacks []StepResult
+
+	// Err is the error that stopped the script, or nil if the script ran to
+	// completion.
+	Err error
+}
+
+// Failed returns the number of steps that failed, including those continued
+// past.
+func (r ScriptReport) Failed() int {
+	n := 0
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// RunScript issues a sequence of commands to the modem as a unit, with no
+// other commands interleaved, such as for vendor configuration recipes and
+// provisioning.
+//
+// Each step is checked against its expected response, and on failure the
+// OnError policy of the step is applied.  The report records the outcome of
+// each step and rollback, and the error that stopped the script, which is
+// also returned.  Steps continued past do not cause an error to be returned,
+// so the report should be checked for those.
+//
+// All the commands, including the rollbacks, are checked against the command
+// policy before the script starts, and the script is not started if any are
+// denied.
+//
+// The options apply to all the steps, with the Timeout of a step overriding
+// any timeout option.
+func (a *AT) RunScript(steps []ScriptStep, options ...CommandOption) (ScriptReport, error) {
+	defer a.beginCommand()()
+	cfg := commandConfig{timeout: a.cmdTimeout}
+	for _, option := range options {
+		option.applyCommandOption(&cfg)
+	}
+	if cfg.err != nil {
+		return ScriptReport{Err: cfg.err}, cfg.err
+	}
+	for _, s := range steps {
+		if err := a.authorize(s.Cmd); err != nil {
+			return ScriptReport{Err: err}, err
+		}
+		if s.Rollback == "" {
+			continue
+		}
+		if err := a.authorize(s.Rollback); err != nil {
+			return ScriptReport{Err: err}, err
+		}
+	}
+	done := make(chan ScriptReport)
+	cmdf := func() {
+		done <- a.runScript(steps, cfg)
+	}
+	select {
+	case <-a.closed:
+		return ScriptReport{Err: ErrClosed}, ErrClosed
+	case a.cmdCh <- cmdf:
+		r := <-done
+		return r, r.Err
+	}
+}
+
+// runScript issues the steps of the script.
+//
+// This should only be called from within the cmdLoop.
+func (a *AT) runScript(steps []ScriptStep, cfg commandConfig) (r ScriptReport) {
+	for n, s := range steps {
+		res := a.runStep(s.Cmd, s.Timeout, cfg)
+		if res.Err == nil && s.Expect != "" && !containsLine(res.Info, s.Expect) {
+			res.Err = fmt.Errorf("AT%s: expected %q: %w", s.Cmd, s.Expect, ErrUnexpectedResponse)
+		}
+		r.Steps = append(r.Steps, res)
+		if res.Err == nil || s.OnError == Continue {
+			continue
+		}
+		r.Err = res.Err
+		if errors.Is(res.Err, ErrClosed) || s.OnError != Rollback {
+			return
+		}
+		for m := n; m >= 0; m-- {
+			rs := steps[m]
+			if rs.Rollback == "" {
+				continue
+			}
+			r.Rollbacks = append(r.Rollbacks, a.runStep(rs.Rollback, rs.Timeout, cfg))
+		}
+		return
+	}
+	return
+}
+
+// runStep issues a single command of a script.
+//
+// This should only be called from within the cmdLoop.
+func (a *AT) runStep(cmd string, timeout time.Duration, cfg commandConfig) StepResult {
+	if timeout != 0 {
+		cfg.timeout = timeout
+	}
+	start := time.Now()
+	info, err := a.exchange(cmd, func() ([]string, error) {
+		return a.processReq(cmd, cfg)
+	})
+	return StepResult{
+		Cmd:      cmd,
+		Info:     info,
+		Err:      err,
+		Duration: time.Since(start),
+	}
+}
+
+func containsLine(info []string, s string) bool {
+	for _, l := range info {
+		if strings.Contains(l, s) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// ErrUnexpectedResponse indicates a script step did not return the
+	// expected response.
+	ErrUnexpectedResponse = errors.New("unexpected response")
+)
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/at"
+)
+
+func TestRunScript(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QCFG=\"nwscanmode\",3\r\n": {"OK\r\n"},
+		"AT+QCFG=\"nwscanmode\"\r\n":   {"+QCFG: \"nwscanmode\",3\r\n", "OK\r\n"},
+		"AT+QCFG=\"band\",0,0\r\n":     {"OK\r\n"},
+		"AT+QCFG=\"nwscanmode\",0\r\n": {"OK\r\n"},
+		"AT+QBAD\r\n":                  {"ERROR\r\n"},
+		"AT+CSQ\r\n":                   {""},
+	}
+	a, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	patterns := []struct {
+		name      string
+		steps     []at.ScriptStep
+		issued    []string
+		rollbacks []string
+		failed    int
+		err       error
+	}{
+		{
+			"ok",
+			[]at.ScriptStep{
+				{Cmd: "+QCFG=\"nwscanmode\",3"},
+				{Cmd: "+QCFG=\"nwscanmode\"", Expect: "\"nwscanmode\",3"},
+			},
+			[]string{"+QCFG=\"nwscanmode\",3", "+QCFG=\"nwscanmode\""},
+			nil,
+			0,
+			nil,
+		},
+		{
+			"abort",
+			[]at.ScriptStep{
+				{Cmd: "+QCFG=\"nwscanmode\",3"},
+				{Cmd: "+QBAD"},
+				{Cmd: "+QCFG=\"nwscanmode\""},
+			},
+			[]string{"+QCFG=\"nwscanmode\",3", "+QBAD"},
+			nil,
+			1,
+			at.ErrError,
+		},
+		{
+			"continue",
+			[]at.ScriptStep{
+				{Cmd: "+QBAD", OnError: at.Continue},
+				{Cmd: "+QCFG=\"nwscanmode\"", Expect: "\"nwscanmode\",2", OnError: at.Continue},
+				{Cmd: "+QCFG=\"nwscanmode\",3"},
+			},
+			[]string{"+QBAD", "+QCFG=\"nwscanmode\"", "+QCFG=\"nwscanmode\",3"},
+			nil,
+			2,
+			nil,
+		},
+		{
+			"unexpected",
+			[]at.ScriptStep{
+				{Cmd: "+QCFG=\"nwscanmode\"", Expect: "\"nwscanmode\",2"},
+			},
+			[]string{"+QCFG=\"nwscanmode\""},
+			nil,
+			1,
+			at.ErrUnexpectedResponse,
+		},
+		{
+			"rollback",
+			[]at.ScriptStep{
+				{Cmd: "+QCFG=\"nwscanmode\",3", Rollback: "+QCFG=\"nwscanmode\",0"},
+				{Cmd: "+QCFG=\"band\",0,0"},
+				{Cmd: "+QBAD", OnError: at.Rollback},
+				{Cmd: "+QCFG=\"nwscanmode\""},
+			},
+			[]string{"+QCFG=\"nwscanmode\",3", "+QCFG=\"band\",0,0", "+QBAD"},
+			[]string{"+QCFG=\"nwscanmode\",0"},
+			1,
+			at.ErrError,
+		},
+		{
+			"timeout",
+			[]at.ScriptStep{
+				{Cmd: "+CSQ", Timeout: 10 * time.Millisecond},
+			},
+			[]string{"+CSQ"},
+			nil,
+			1,
+			at.ErrDeadlineExceeded,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			r, err := a.RunScript(p.steps)
+			assert.True(t, errors.Is(err, p.err), err)
+			assert.Equal(t, err, r.Err)
+			var cmds []string
+			for _, s := range r.Steps {
+				cmds = append(cmds, s.Cmd)
+			}
+			assert.Equal(t, p.issued, cmds)
+			var rbs []string
+			for _, s := range r.Rollbacks {
+				rbs = append(rbs, s.Cmd)
+				assert.Nil(t, s.Err)
+			}
+			assert.Equal(t, p.rollbacks, rbs)
+			assert.Equal(t, p.failed, r.Failed())
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestRunScriptDenied(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QCFG=\"nwscanmode\",3\r\n": {"OK\r\n"},
+	}
+	a, mm := setupModem(t, cmdSet, at.WithDenyList("+CFUN"))
+	defer teardownModem(mm)
+
+	r, err := a.RunScript([]at.ScriptStep{
+		{Cmd: "+QCFG=\"nwscanmode\",3", Rollback: "+CFUN=1,1"},
+	})
+	assert.True(t, errors.Is(err, at.ErrCommandDenied), err)
+	assert.Empty(t, r.Steps)
+	assert.Zero(t, a.Stats().BytesWritten)
+}
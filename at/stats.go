@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the counters of the traffic over the port to the modem.
+//
+// The counters are cumulative from the creation of the AT, so rates can be
+// determined by the difference between successive calls to Stats.
+//
+// Flaky links, such as a marginal USB connection, typically show as parse
+// errors and prompt timeouts well before they cause commands to fail.
+type Stats struct {
+	// Commands is the number of commands issued to the modem, which is also
+	// the correlation ID of the most recent command.
+	Commands uint64
+
+	// BytesRead is the number of bytes read from the modem.
+	BytesRead uint64
+
+	// BytesWritten is the number of bytes written to the modem.
+	BytesWritten uint64
+
+	// Lines is the number of lines read from the modem, including blank
+	// lines.
+	Lines uint64
+
+	// ParseErrors is the number of lines that could not be attributed to a
+	// command or an indication, such as noise on the link or responses
+	// arriving after their command has timed out, plus any errors reading
+	// lines from the modem.
+	ParseErrors uint64
+
+	// PromptWaits is the number of ">" prompts, or CONNECTs, awaited by
+	// SMSCommand and DataCommand.
+	PromptWaits uint64
+
+	// PromptTimeouts is the number of commands that timed out waiting for
+	// the prompt.
+	PromptTimeouts uint64
+
+	// PromptWaitTime is the total time spent waiting for the prompts
+	// counted in PromptWaits.
+	PromptWaitTime time.Duration
+}
+
+// Stats returns the counters of the traffic over the port to the modem.
+//
+// The Stats may be exported to a metrics system by polling, or via expvar,
+// e.g.
+//
+//	expvar.Publish("modem", expvar.Func(func() interface{} {
+//		return modem.Stats()
+//	}))
+func (a *AT) Stats() Stats {
+	s := a.stats
+	return Stats{
+		Commands:       atomic.LoadUint64(&s.commands),
+		BytesRead:      atomic.LoadUint64(&s.bytesRead),
+		BytesWritten:   atomic.LoadUint64(&s.bytesWritten),
+		Lines:          atomic.LoadUint64(&s.lines),
+		ParseErrors:    atomic.LoadUint64(&s.parseErrors),
+		PromptWaits:    atomic.LoadUint64(&s.promptWaits),
+		PromptTimeouts: atomic.LoadUint64(&s.promptTimeouts),
+		PromptWaitTime: time.Duration(atomic.LoadUint64(&s.promptWaitTime)),
+	}
+}
+
+// stats holds the counters updated by the AT.
+//
+// The counters are updated atomically, as they are updated by both the
+// lineReader and cmdLoop, and read by Stats.
+type stats struct {
+	commands       uint64
+	bytesRead      uint64
+	bytesWritten   uint64
+	lines          uint64
+	parseErrors    uint64
+	promptWaits    uint64
+	promptTimeouts uint64
+	promptWaitTime uint64
+}
+
+func (s *stats) addLine() {
+	atomic.AddUint64(&s.lines, 1)
+}
+
+func (s *stats) addParseError() {
+	atomic.AddUint64(&s.parseErrors, 1)
+}
+
+// addPromptWait records a prompt received after waiting for the period d.
+func (s *stats) addPromptWait(d time.Duration) {
+	atomic.AddUint64(&s.promptWaits, 1)
+	atomic.AddUint64(&s.promptWaitTime, uint64(d))
+}
+
+func (s *stats) addPromptTimeout() {
+	atomic.AddUint64(&s.promptTimeouts, 1)
+}
+
+// countingModem counts the bytes read from and written to the modem.
+type countingModem struct {
+	io.ReadWriter
+	s *stats
+}
+
+func (m countingModem) Read(p []byte) (int, error) {
+	n, err := m.ReadWriter.Read(p)
+	atomic.AddUint64(&m.s.bytesRead, uint64(n))
+	return n, err
+}
+
+func (m countingModem) Write(p []byte) (int, error) {
+	n, err := m.ReadWriter.Write(p)
+	atomic.AddUint64(&m.s.bytesWritten, uint64(n))
+	return n, err
+}
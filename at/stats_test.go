@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+)
+
+func TestStats(t *testing.T) {
+	cmdSet := map[string][]string{
+		"ATSMS\r":                 {"\n>"},
+		"ATSLOW\r":                {""},
+		"sms+" + string(rune(26)): {"\r\n", "info\r\n", "\r\n", "OK\r\n"},
+		string(rune(27)) + "\r\n": {"\r\nOK\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	mm.echo = false
+
+	assert.Equal(t, at.Stats{}, m.Stats())
+
+	info, err := m.SMSCommand("SMS", "sms+")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"info"}, info)
+	s := m.Stats()
+	assert.Equal(t, uint64(len("ATSMS\r")+len("sms+")+1), s.BytesWritten)
+	assert.Equal(t, uint64(len("\n>\r\ninfo\r\n\r\nOK\r\n")), s.BytesRead)
+	assert.Equal(t, uint64(6), s.Lines)
+	assert.Equal(t, uint64(1), s.PromptWaits)
+	assert.True(t, s.PromptWaitTime > 0)
+	assert.Equal(t, uint64(0), s.PromptTimeouts)
+	assert.Equal(t, uint64(0), s.ParseErrors)
+
+	// prompt never arrives
+	_, err = m.SMSCommand("SLOW", "sms+", at.WithTimeout(10*time.Millisecond))
+	assert.Equal(t, at.ErrDeadlineExceeded, err)
+	assert.Equal(t, uint64(1), m.Stats().PromptTimeouts)
+
+	// unsolicited noise
+	mm.r <- []byte("noise\r\n")
+	for i := 0; i < 10 && m.Stats().ParseErrors == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.True(t, m.Stats().ParseErrors >= 1)
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at
+
+import (
+	"errors"
+	"time"
+)
+
+// Tracer creates spans for operations performed on the modem, such as to
+// include modem operations in the distributed traces of the host
+// application.
+//
+// The interface is deliberately minimal, so the driver does not depend on a
+// particular tracing implementation, and can be implemented by a thin
+// adapter around an OpenTelemetry trace.Tracer.
+type Tracer interface {
+	// Start starts a span with the given name.
+	Start(name string) Span
+}
+
+// Span is a traced operation.
+type Span interface {
+	// SetAttribute attaches a key/value pair to the span.
+	SetAttribute(key string, value interface{})
+
+	// End completes the span, recording the error if the operation failed.
+	End(err error)
+}
+
+// TracerOption specifies the tracer used to trace commands.
+type TracerOption struct {
+	Tracer
+}
+
+func (o TracerOption) applyOption(a *AT) {
+	a.tracer = o.Tracer
+}
+
+// WithTracer specifies a tracer to create a span for each command issued to
+// the modem.
+//
+// Spans are named after the command, e.g. "AT+CMGS", and have the following
+// attributes:
+//
+//	at.command     the complete command
+//	at.id          the correlation ID of the command
+//	at.duration_ms the time taken to complete the command
+//	at.cme_error   the CME error returned by the modem, if any
+//	at.cms_error   the CMS error returned by the modem, if any
+func WithTracer(t Tracer) TracerOption {
+	return TracerOption{t}
+}
+
+// startSpan starts the span for a command, if a tracer is configured.
+func (a *AT) startSpan(id uint64, cmd string) Span {
+	if a.tracer == nil {
+		return nil
+	}
+	s := a.tracer.Start("AT" + parseCmdID(cmd))
+	s.SetAttribute("at.command", cmd)
+	s.SetAttribute("at.id", id)
+	return s
+}
+
+// endSpan completes the span for a command, if any.
+func endSpan(s Span, start time.Time, err error) {
+	if s == nil {
+		return
+	}
+	s.SetAttribute("at.duration_ms", time.Since(start).Milliseconds())
+	var cme CMEError
+	if errors.As(err, &cme) {
+		s.SetAttribute("at.cme_error", string(cme))
+	}
+	var cms CMSError
+	if errors.As(err, &cms) {
+		s.SetAttribute("at.cms_error", string(cms))
+	}
+	s.End(err)
+}
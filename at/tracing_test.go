@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package at_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+)
+
+type span struct {
+	name  string
+	attrs map[string]interface{}
+	ended bool
+	err   error
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.attrs[key] = value
+}
+
+func (s *span) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type tracer struct {
+	mu    sync.Mutex
+	spans []*span
+}
+
+func (t *tracer) Start(name string) at.Span {
+	s := &span{name: name, attrs: map[string]interface{}{}}
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return s
+}
+
+func TestWithTracer(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CSQ\r\n":         {"+CSQ: 20,0\r\n", "OK\r\n"},
+		"AT+CPIN?\r\n":       {"+CME ERROR: 10\r\n"},
+		"AT+CMGS=23\r":       {"\r\n+CMS ERROR: 304\r\n"},
+		"AT+QFUPL=\"f\",3\r": {"\r\nCONNECT\r\n"},
+		"abc":                {"\r\nOK\r\n"},
+	}
+	tr := &tracer{}
+	a, mm := setupModem(t, cmdSet, at.WithTracer(tr))
+	defer teardownModem(mm)
+
+	_, err := a.Command("+CSQ")
+	require.Nil(t, err)
+	_, err = a.Command("+CPIN?")
+	require.Equal(t, at.CMEError("10"), err)
+	_, err = a.SMSCommand("+CMGS=23", "pdu")
+	require.Equal(t, at.CMSError("304"), err)
+	_, err = a.DataCommand("+QFUPL=\"f\",3", []byte("abc"))
+	require.Nil(t, err)
+
+	require.Len(t, tr.spans, 4)
+	patterns := []struct {
+		name string
+		cmd  string
+		cme  interface{}
+		cms  interface{}
+		err  error
+	}{
+		{"AT+CSQ", "+CSQ", nil, nil, nil},
+		{"AT+CPIN", "+CPIN?", "10", nil, at.CMEError("10")},
+		{"AT+CMGS", "+CMGS=23", nil, "304", at.CMSError("304")},
+		{"AT+QFUPL", "+QFUPL=\"f\",3", nil, nil, nil},
+	}
+	for i, p := range patterns {
+		s := tr.spans[i]
+		assert.Equal(t, p.name, s.name)
+		assert.True(t, s.ended)
+		assert.Equal(t, p.err, s.err)
+		assert.Equal(t, p.cmd, s.attrs["at.command"])
+		assert.Equal(t, p.cme, s.attrs["at.cme_error"])
+		assert.Equal(t, p.cms, s.attrs["at.cms_error"])
+		assert.IsType(t, int64(0), s.attrs["at.duration_ms"])
+	}
+}
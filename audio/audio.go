@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package audio provides a driver to configure the voice audio path of a
+// modem, such as the audio channel, gains, sidetone and echo cancellation.
+//
+// The audio commands are vendor specific, so the Dialect of the modem must be
+// provided.  The ranges of gains and levels are also vendor, and even model,
+// specific, so are passed through to the modem unaltered.
+package audio
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/warthog618/modem/at"
+)
+
+// Dialect identifies the vendor specific audio command set supported by the
+// modem.
+type Dialect int
+
+const (
+	// Quectel modems, using the +QAUDMOD family of commands.
+	Quectel Dialect = iota
+
+	// SIMCom modems, using the +CSDVC family of commands.
+	SIMCom
+)
+
+// Audio decorates the AT modem with the ability to configure the audio path.
+type Audio struct {
+	*at.AT
+	dialect Dialect
+}
+
+// New creates a new Audio driver for the modem.
+func New(a *at.AT, dialect Dialect) *Audio {
+	return &Audio{AT: a, dialect: dialect}
+}
+
+// Channel identifies the audio input and output device used for voice calls.
+type Channel int
+
+const (
+	// Handset is the handset microphone and earpiece.
+	Handset Channel = iota
+
+	// Headset is the headset microphone and earpiece.
+	Headset
+
+	// Speaker is the handsfree speakerphone.
+	Speaker
+)
+
+// channel values by dialect.
+var channels = map[Dialect]map[Channel]int{
+	Quectel: {Handset: 0, Headset: 1, Speaker: 2},
+	SIMCom:  {Handset: 1, Headset: 2, Speaker: 3},
+}
+
+var (
+	// ErrNotSupported indicates the requested configuration is not supported
+	// by the dialect.
+	ErrNotSupported = errors.New("not supported by dialect")
+)
+
+// SetChannel selects the audio channel used for voice calls.
+func (a *Audio) SetChannel(c Channel, options ...at.CommandOption) error {
+	v, ok := channels[a.dialect][c]
+	if !ok {
+		return ErrNotSupported
+	}
+	cmd := "+QAUDMOD=%d"
+	if a.dialect == SIMCom {
+		cmd = "+CSDVC=%d"
+	}
+	return a.command(fmt.Sprintf(cmd, v), options)
+}
+
+// SetSpeakerVolume sets the volume of the audio output.
+func (a *Audio) SetSpeakerVolume(level int, options ...at.CommandOption) error {
+	return a.command(fmt.Sprintf("+CLVL=%d", level), options)
+}
+
+// SetMicGain sets the gain of the audio input.
+func (a *Audio) SetMicGain(gain int, options ...at.CommandOption) error {
+	cmd := fmt.Sprintf("+QMIC=%d,%d", gain, gain)
+	if a.dialect == SIMCom {
+		cmd = fmt.Sprintf("+CMICGAIN=%d", gain)
+	}
+	return a.command(cmd, options)
+}
+
+// SetSidetone sets the gain of the sidetone, the feedback of the audio input
+// into the audio output.  A gain of 0 disables the sidetone.
+func (a *Audio) SetSidetone(gain int, options ...at.CommandOption) error {
+	cmd := "+QSIDET=%d"
+	if a.dialect == SIMCom {
+		cmd = "+SIDET=%d"
+	}
+	return a.command(fmt.Sprintf(cmd, gain), options)
+}
+
+// SetEchoCancellation enables or disables the echo canceller.
+func (a *Audio) SetEchoCancellation(enable bool, options ...at.CommandOption) error {
+	v := 0
+	if enable {
+		v = 1
+	}
+	cmd := "+QEEC=0,%d"
+	if a.dialect == SIMCom {
+		cmd = "+CECM=%d"
+	}
+	return a.command(fmt.Sprintf(cmd, v), options)
+}
+
+// Config is a complete audio path configuration.
+//
+// Nil fields are left unaltered.
+type Config struct {
+	Channel          *Channel
+	SpeakerVolume    *int
+	MicGain          *int
+	Sidetone         *int
+	EchoCancellation *bool
+}
+
+// Apply applies the configuration to the modem, stopping at the first error.
+func (a *Audio) Apply(cfg Config, options ...at.CommandOption) error {
+	if cfg.Channel != nil {
+		if err := a.SetChannel(*cfg.Channel, options...); err != nil {
+			return err
+		}
+	}
+	if cfg.SpeakerVolume != nil {
+		if err := a.SetSpeakerVolume(*cfg.SpeakerVolume, options...); err != nil {
+			return err
+		}
+	}
+	if cfg.MicGain != nil {
+		if err := a.SetMicGain(*cfg.MicGain, options...); err != nil {
+			return err
+		}
+	}
+	if cfg.Sidetone != nil {
+		if err := a.SetSidetone(*cfg.Sidetone, options...); err != nil {
+			return err
+		}
+	}
+	if cfg.EchoCancellation != nil {
+		if err := a.SetEchoCancellation(*cfg.EchoCancellation, options...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// command issues the command, wrapping any error with the command.
+func (a *Audio) command(cmd string, options []at.CommandOption) error {
+	if _, err := a.Command(cmd, options...); err != nil {
+		return fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	return nil
+}
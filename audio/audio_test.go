@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package audio_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/audio"
+)
+
+func TestSetters(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect audio.Dialect
+		cmd     string
+		set     func(a *audio.Audio) error
+	}{
+		{
+			"quectel channel",
+			audio.Quectel,
+			"AT+QAUDMOD=2\r\n",
+			func(a *audio.Audio) error { return a.SetChannel(audio.Speaker) },
+		},
+		{
+			"simcom channel",
+			audio.SIMCom,
+			"AT+CSDVC=1\r\n",
+			func(a *audio.Audio) error { return a.SetChannel(audio.Handset) },
+		},
+		{
+			"volume",
+			audio.Quectel,
+			"AT+CLVL=3\r\n",
+			func(a *audio.Audio) error { return a.SetSpeakerVolume(3) },
+		},
+		{
+			"quectel mic gain",
+			audio.Quectel,
+			"AT+QMIC=20000,20000\r\n",
+			func(a *audio.Audio) error { return a.SetMicGain(20000) },
+		},
+		{
+			"simcom mic gain",
+			audio.SIMCom,
+			"AT+CMICGAIN=4\r\n",
+			func(a *audio.Audio) error { return a.SetMicGain(4) },
+		},
+		{
+			"quectel sidetone",
+			audio.Quectel,
+			"AT+QSIDET=0\r\n",
+			func(a *audio.Audio) error { return a.SetSidetone(0) },
+		},
+		{
+			"simcom sidetone",
+			audio.SIMCom,
+			"AT+SIDET=2\r\n",
+			func(a *audio.Audio) error { return a.SetSidetone(2) },
+		},
+		{
+			"quectel echo",
+			audio.Quectel,
+			"AT+QEEC=0,1\r\n",
+			func(a *audio.Audio) error { return a.SetEchoCancellation(true) },
+		},
+		{
+			"simcom echo",
+			audio.SIMCom,
+			"AT+CECM=0\r\n",
+			func(a *audio.Audio) error { return a.SetEchoCancellation(false) },
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			a, mm := setupModem(t, map[string][]string{p.cmd: {"OK\r\n"}}, p.dialect)
+			defer teardownModem(mm)
+			err := p.set(a)
+			assert.Nil(t, err)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestSetChannelUnsupported(t *testing.T) {
+	a, mm := setupModem(t, nil, audio.Quectel)
+	defer teardownModem(mm)
+	err := a.SetChannel(audio.Channel(7))
+	assert.Equal(t, audio.ErrNotSupported, err)
+}
+
+func TestApply(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CSDVC=3\r\n":    {"OK\r\n"},
+		"AT+CLVL=4\r\n":     {"OK\r\n"},
+		"AT+CECM=1\r\n":     {"OK\r\n"},
+		"AT+CMICGAIN=5\r\n": {"ERROR\r\n"},
+	}
+	a, mm := setupModem(t, cmdSet, audio.SIMCom)
+	defer teardownModem(mm)
+
+	ch := audio.Speaker
+	vol := 4
+	ec := true
+	err := a.Apply(audio.Config{Channel: &ch, SpeakerVolume: &vol, EchoCancellation: &ec})
+	assert.Nil(t, err)
+
+	// empty
+	err = a.Apply(audio.Config{})
+	assert.Nil(t, err)
+
+	// error
+	gain := 5
+	err = a.Apply(audio.Config{Channel: &ch, MicGain: &gain, EchoCancellation: &ec})
+	assert.True(t, errors.Is(err, at.ErrError))
+}
+
+type mockModem struct {
+	cmdSet map[string][]string
+	closed bool
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if data == nil {
+		return 0, at.ErrClosed
+	}
+	copy(p, data) // assumes p is empty
+	if !ok {
+		return len(data), fmt.Errorf("closed with data")
+	}
+	return len(data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	if mm.closed {
+		return 0, at.ErrClosed
+	}
+	v := mm.cmdSet[string(p)]
+	if len(v) == 0 {
+		mm.r <- []byte("\r\nERROR\r\n")
+	} else {
+		for _, l := range v {
+			mm.r <- []byte(l)
+		}
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) Close() error {
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
+
+func setupModem(t *testing.T, cmdSet map[string][]string, d audio.Dialect) (*audio.Audio, *mockModem) {
+	mm := &mockModem{cmdSet: cmdSet, r: make(chan []byte, 10)}
+	a := audio.New(at.New(mm), d)
+	require.NotNil(t, a)
+	return a, mm
+}
+
+func teardownModem(mm *mockModem) {
+	mm.Close()
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package audio
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/warthog618/modem/at"
+)
+
+// PlayFile plays the named audio file from the modem filesystem on the audio
+// output.
+//
+// Playback continues until the file ends or StopPlayback is called.
+func (a *Audio) PlayFile(name string, options ...at.CommandOption) error {
+	cmd := "+QAUDPLAY=\"%s\",0"
+	if a.dialect == SIMCom {
+		cmd = "+CCMXPLAY=\"%s\",0"
+	}
+	return a.command(fmt.Sprintf(cmd, name), options)
+}
+
+// StopPlayback stops playback started by PlayFile.
+func (a *Audio) StopPlayback(options ...at.CommandOption) error {
+	cmd := "+QAUDSTOP"
+	if a.dialect == SIMCom {
+		cmd = "+CCMXSTOP"
+	}
+	return a.command(cmd, options)
+}
+
+// PlayTone plays a continuous tone of the given frequency, in Hz, for the
+// given duration on the audio output.
+func (a *Audio) PlayTone(frequency int, duration time.Duration, options ...at.CommandOption) error {
+	cmd := "+QLTONE=1,%d,%d,0,%d"
+	if a.dialect == SIMCom {
+		cmd = "+SIMTONE=1,%d,%d,0,%d"
+	}
+	ms := int(duration / time.Millisecond)
+	return a.command(fmt.Sprintf(cmd, frequency, ms, ms), options)
+}
+
+// PlayStandardTone plays one of the modem's predefined tones, such as dial or
+// busy tones, identified by the vendor specific tone number.
+//
+// This is only supported by SIMCom modems, using +CPTONE.
+func (a *Audio) PlayStandardTone(tone int, options ...at.CommandOption) error {
+	if a.dialect != SIMCom {
+		return ErrNotSupported
+	}
+	return a.command(fmt.Sprintf("+CPTONE=%d", tone), options)
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package audio_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/audio"
+)
+
+func TestPlayback(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect audio.Dialect
+		cmd     string
+		play    func(a *audio.Audio) error
+	}{
+		{
+			"quectel file",
+			audio.Quectel,
+			"AT+QAUDPLAY=\"UFS:alert.wav\",0\r\n",
+			func(a *audio.Audio) error { return a.PlayFile("UFS:alert.wav") },
+		},
+		{
+			"simcom file",
+			audio.SIMCom,
+			"AT+CCMXPLAY=\"C:/alert.wav\",0\r\n",
+			func(a *audio.Audio) error { return a.PlayFile("C:/alert.wav") },
+		},
+		{
+			"quectel stop",
+			audio.Quectel,
+			"AT+QAUDSTOP\r\n",
+			func(a *audio.Audio) error { return a.StopPlayback() },
+		},
+		{
+			"simcom stop",
+			audio.SIMCom,
+			"AT+CCMXSTOP\r\n",
+			func(a *audio.Audio) error { return a.StopPlayback() },
+		},
+		{
+			"quectel tone",
+			audio.Quectel,
+			"AT+QLTONE=1,440,500,0,500\r\n",
+			func(a *audio.Audio) error { return a.PlayTone(440, 500*time.Millisecond) },
+		},
+		{
+			"simcom tone",
+			audio.SIMCom,
+			"AT+SIMTONE=1,1000,2000,0,2000\r\n",
+			func(a *audio.Audio) error { return a.PlayTone(1000, 2*time.Second) },
+		},
+		{
+			"simcom standard tone",
+			audio.SIMCom,
+			"AT+CPTONE=2\r\n",
+			func(a *audio.Audio) error { return a.PlayStandardTone(2) },
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			a, mm := setupModem(t, map[string][]string{p.cmd: {"OK\r\n"}}, p.dialect)
+			defer teardownModem(mm)
+			err := p.play(a)
+			assert.Nil(t, err)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestPlayStandardToneUnsupported(t *testing.T) {
+	a, mm := setupModem(t, nil, audio.Quectel)
+	defer teardownModem(mm)
+	err := a.PlayStandardTone(2)
+	assert.Equal(t, audio.ErrNotSupported, err)
+}
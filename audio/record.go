@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package audio
+
+import (
+	"fmt"
+
+	"github.com/warthog618/modem/at"
+)
+
+// Format identifies the encoding of a recording.
+type Format int
+
+const (
+	// AMR is AMR-NB encoding.
+	AMR Format = iota
+
+	// WAV is PCM encoding in a WAV container.
+	WAV
+)
+
+// Quectel format values for +QAUDRD.
+var quectelFormats = map[Format]int{
+	AMR: 3,
+	WAV: 13,
+}
+
+// StartRecording starts recording the in-call audio to the named file in the
+// modem filesystem.
+//
+// For SIMCom modems the format is determined by the extension of the name,
+// so the format is ignored.
+//
+// The recording continues until StopRecording is called or the call ends.
+func (a *Audio) StartRecording(name string, format Format, options ...at.CommandOption) error {
+	if a.dialect == SIMCom {
+		return a.command(fmt.Sprintf("+CREC=1,\"%s\"", name), options)
+	}
+	f, ok := quectelFormats[format]
+	if !ok {
+		return ErrNotSupported
+	}
+	return a.command(fmt.Sprintf("+QAUDRD=1,\"%s\",%d", name, f), options)
+}
+
+// StopRecording stops a recording started by StartRecording.
+func (a *Audio) StopRecording(options ...at.CommandOption) error {
+	cmd := "+QAUDRD=0"
+	if a.dialect == SIMCom {
+		cmd = "+CREC=0"
+	}
+	return a.command(cmd, options)
+}
+
+// SetUSBAudio enables or disables the transfer of in-call audio over the USB
+// audio (UAC) interface, for capture or playback by the host.
+func (a *Audio) SetUSBAudio(enable bool, options ...at.CommandOption) error {
+	var cmd string
+	switch {
+	case a.dialect == SIMCom && enable:
+		cmd = "+CPCMREG=1"
+	case a.dialect == SIMCom:
+		cmd = "+CPCMREG=0"
+	case enable:
+		cmd = "+QPCMV=1,2"
+	default:
+		cmd = "+QPCMV=0"
+	}
+	return a.command(cmd, options)
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package audio_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/audio"
+)
+
+func TestRecording(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect audio.Dialect
+		format  audio.Format
+		start   string
+		stop    string
+	}{
+		{
+			"quectel amr",
+			audio.Quectel,
+			audio.AMR,
+			"AT+QAUDRD=1,\"RAM:rec.amr\",3\r\n",
+			"AT+QAUDRD=0\r\n",
+		},
+		{
+			"quectel wav",
+			audio.Quectel,
+			audio.WAV,
+			"AT+QAUDRD=1,\"RAM:rec.amr\",13\r\n",
+			"AT+QAUDRD=0\r\n",
+		},
+		{
+			"simcom",
+			audio.SIMCom,
+			audio.WAV,
+			"AT+CREC=1,\"RAM:rec.amr\"\r\n",
+			"AT+CREC=0\r\n",
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{
+				p.start: {"OK\r\n"},
+				p.stop:  {"OK\r\n"},
+			}
+			a, mm := setupModem(t, cmdSet, p.dialect)
+			defer teardownModem(mm)
+			err := a.StartRecording("RAM:rec.amr", p.format)
+			assert.Nil(t, err)
+			err = a.StopRecording()
+			assert.Nil(t, err)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestRecordingErrors(t *testing.T) {
+	a, mm := setupModem(t, nil, audio.Quectel)
+	defer teardownModem(mm)
+
+	err := a.StartRecording("RAM:rec.amr", audio.Format(7))
+	assert.Equal(t, audio.ErrNotSupported, err)
+
+	err = a.StartRecording("RAM:rec.amr", audio.AMR)
+	assert.True(t, errors.Is(err, at.ErrError))
+
+	err = a.StopRecording()
+	assert.True(t, errors.Is(err, at.ErrError))
+}
+
+func TestSetUSBAudio(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect audio.Dialect
+		enable  bool
+		cmd     string
+	}{
+		{"quectel on", audio.Quectel, true, "AT+QPCMV=1,2\r\n"},
+		{"quectel off", audio.Quectel, false, "AT+QPCMV=0\r\n"},
+		{"simcom on", audio.SIMCom, true, "AT+CPCMREG=1\r\n"},
+		{"simcom off", audio.SIMCom, false, "AT+CPCMREG=0\r\n"},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			a, mm := setupModem(t, map[string][]string{p.cmd: {"OK\r\n"}}, p.dialect)
+			defer teardownModem(mm)
+			err := a.SetUSBAudio(p.enable)
+			assert.Nil(t, err)
+		}
+		t.Run(p.name, f)
+	}
+}
@@ -0,0 +1,367 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package bt provides access to the Bluetooth interface of SIMCom modules,
+// such as the SIM800 and SIM868, that expose Bluetooth via AT commands.
+//
+// Only the Serial Port Profile (SPP) is supported, for exchanging data with a
+// paired device, such as a phone.
+package bt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// BT decorates the AT modem with the ability to drive the Bluetooth
+// interface.
+type BT struct {
+	*at.AT
+	ph PairingHandler
+	ch ConnectHandler
+	lh LinkHandler
+	dh DataHandler
+
+	// the active scan, if any.
+	mu   sync.Mutex
+	scan chan []string
+}
+
+// Option is a construction option for the BT.
+type Option interface {
+	applyOption(*BT)
+}
+
+// New creates a new BT for the modem.
+//
+// The Bluetooth interface is not powered until Start is called.
+func New(a *at.AT, options ...Option) *BT {
+	b := BT{AT: a}
+	for _, option := range options {
+		option.applyOption(&b)
+	}
+	return &b
+}
+
+// PairingRequest is a request to pair with a device, requiring numeric
+// confirmation of the passkey.
+type PairingRequest struct {
+	Name    string
+	Address string
+	Passkey string
+}
+
+// PairingHandler decides if a pairing request is accepted.
+type PairingHandler func(PairingRequest) bool
+
+func (h PairingHandler) applyOption(b *BT) {
+	b.ph = h
+}
+
+// WithPairingHandler specifies the handler that decides if pairing requests
+// are accepted.
+//
+// By default all pairing requests are rejected.
+func WithPairingHandler(h PairingHandler) Option {
+	return h
+}
+
+// ConnectRequest is a request by a device to connect using a profile.
+type ConnectRequest struct {
+	Address string
+	Profile string
+}
+
+// ConnectHandler decides if a connection request is accepted.
+type ConnectHandler func(ConnectRequest) bool
+
+func (h ConnectHandler) applyOption(b *BT) {
+	b.ch = h
+}
+
+// WithConnectHandler specifies the handler that decides if connection
+// requests from paired devices are accepted.
+//
+// By default all connection requests are rejected.
+func WithConnectHandler(h ConnectHandler) Option {
+	return h
+}
+
+// Link is a connection to a device.
+type Link struct {
+	ID      int
+	Name    string
+	Address string
+
+	// Profile is the connected profile, and is empty for a disconnection.
+	Profile string
+}
+
+// LinkHandler receives connections and disconnections.
+//
+// The up flag is true for a connection and false for a disconnection.
+type LinkHandler func(l Link, up bool)
+
+func (h LinkHandler) applyOption(b *BT) {
+	b.lh = h
+}
+
+// WithLinkHandler specifies the handler that receives connections and
+// disconnections.
+func WithLinkHandler(h LinkHandler) Option {
+	return h
+}
+
+// DataHandler receives data sent by a device over SPP.
+type DataHandler func(id int, data []byte)
+
+func (h DataHandler) applyOption(b *BT) {
+	b.dh = h
+}
+
+// WithDataHandler specifies the handler that receives SPP data.
+//
+// The data is received in the +BTSPPDATA indication, so data containing line
+// endings is split across several calls.
+func WithDataHandler(h DataHandler) Option {
+	return h
+}
+
+var indPrefixes = []string{
+	"+BTPAIRING",
+	"+BTCONNECTING",
+	"+BTCONNECT",
+	"+BTDISCONN",
+	"+BTSPPDATA",
+	"+BTSCAN",
+}
+
+// Start powers the Bluetooth interface and starts handling indications from
+// it.
+func (b *BT) Start(options ...at.CommandOption) error {
+	handlers := []at.InfoHandler{
+		b.handlePairing,
+		b.handleConnecting,
+		b.handleConnect,
+		b.handleDisconnect,
+		b.handleData,
+		b.handleScan,
+	}
+	for i, prefix := range indPrefixes {
+		if err := b.AddIndication(prefix+":", handlers[i]); err != nil {
+			b.cancelIndications()
+			return err
+		}
+	}
+	if _, err := b.Command("+BTPOWER=1", options...); err != nil {
+		b.cancelIndications()
+		return err
+	}
+	return nil
+}
+
+// Stop powers down the Bluetooth interface.
+func (b *BT) Stop(options ...at.CommandOption) error {
+	b.cancelIndications()
+	_, err := b.Command("+BTPOWER=0", options...)
+	return err
+}
+
+// SetName sets the name the module presents to other devices.
+func (b *BT) SetName(name string, options ...at.CommandOption) error {
+	_, err := b.Command(fmt.Sprintf("+BTHOST=\"%s\"", name), options...)
+	return err
+}
+
+// Device is a device found by a scan.
+type Device struct {
+	ID      int
+	Name    string
+	Address string
+	RSSI    int
+}
+
+// Scan searches for nearby devices for the period, which the module limits
+// to between 10 and 60 seconds.
+func (b *BT) Scan(period time.Duration, options ...at.CommandOption) ([]Device, error) {
+	sc := make(chan []string, 10)
+	b.mu.Lock()
+	if b.scan != nil {
+		b.mu.Unlock()
+		return nil, ErrScanInProgress
+	}
+	b.scan = sc
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.scan = nil
+		b.mu.Unlock()
+	}()
+	secs := int(period / time.Second)
+	if _, err := b.Command(fmt.Sprintf("+BTSCAN=1,%d", secs), options...); err != nil {
+		return nil, err
+	}
+	// allow the module some leeway to report the end of the scan.
+	expiry := time.NewTimer(period + 5*time.Second)
+	defer expiry.Stop()
+	var dd []Device
+	for {
+		select {
+		case <-expiry.C:
+			return dd, at.ErrDeadlineExceeded
+		case <-b.Closed():
+			return dd, at.ErrClosed
+		case fields := <-sc:
+			if fields[0] == "1" {
+				return dd, nil
+			}
+			if d, ok := parseDevice(fields); ok {
+				dd = append(dd, d)
+			}
+		}
+	}
+}
+
+// Pair initiates pairing with a device found by a scan.
+//
+// The numeric confirmation of the passkey is passed to the PairingHandler.
+func (b *BT) Pair(id int, options ...at.CommandOption) error {
+	_, err := b.Command(fmt.Sprintf("+BTPAIR=0,%d", id), options...)
+	return err
+}
+
+// Unpair removes the pairing with a device.
+func (b *BT) Unpair(id int, options ...at.CommandOption) error {
+	_, err := b.Command(fmt.Sprintf("+BTUNPAIR=%d", id), options...)
+	return err
+}
+
+// Disconnect drops the connection to a device.
+func (b *BT) Disconnect(id int, options ...at.CommandOption) error {
+	_, err := b.Command(fmt.Sprintf("+BTDISCONN=%d", id), options...)
+	return err
+}
+
+// Send sends the data to the connected device over SPP.
+func (b *BT) Send(data []byte, options ...at.CommandOption) error {
+	_, err := b.DataCommand(fmt.Sprintf("+BTSPPSEND=%d", len(data)), data, options...)
+	return err
+}
+
+func (b *BT) cancelIndications() {
+	for _, prefix := range indPrefixes {
+		b.CancelIndication(prefix + ":")
+	}
+}
+
+func (b *BT) handlePairing(i []string) {
+	fields := info.Fields(info.TrimPrefix(i[0], "+BTPAIRING"))
+	if len(fields) < 2 {
+		return
+	}
+	pr := PairingRequest{Name: fields[0], Address: fields[1]}
+	if len(fields) > 2 {
+		pr.Passkey = fields[2]
+	}
+	accept := 0
+	if b.ph != nil && b.ph(pr) {
+		accept = 1
+	}
+	b.Command(fmt.Sprintf("+BTPAIR=1,%d", accept))
+}
+
+func (b *BT) handleConnecting(i []string) {
+	fields := info.Fields(info.TrimPrefix(i[0], "+BTCONNECTING"))
+	if len(fields) < 2 {
+		return
+	}
+	accept := 0
+	if b.ch != nil && b.ch(ConnectRequest{Address: fields[0], Profile: fields[1]}) {
+		accept = 1
+	}
+	b.Command(fmt.Sprintf("+BTACPT=%d", accept))
+}
+
+func (b *BT) handleConnect(i []string) {
+	fields := info.Fields(info.TrimPrefix(i[0], "+BTCONNECT"))
+	if len(fields) < 4 || b.lh == nil {
+		return
+	}
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return
+	}
+	b.lh(Link{ID: id, Name: fields[1], Address: fields[2], Profile: fields[3]}, true)
+}
+
+func (b *BT) handleDisconnect(i []string) {
+	fields := info.Fields(info.TrimPrefix(i[0], "+BTDISCONN"))
+	if len(fields) < 3 || b.lh == nil {
+		return
+	}
+	id, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return
+	}
+	b.lh(Link{ID: id, Name: fields[0], Address: fields[1]}, false)
+}
+
+func (b *BT) handleData(i []string) {
+	if b.dh == nil {
+		return
+	}
+	// the data is not quoted, and may contain commas, so is not split.
+	fields := strings.SplitN(info.TrimPrefix(i[0], "+BTSPPDATA"), ",", 3)
+	if len(fields) < 3 {
+		return
+	}
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return
+	}
+	b.dh(id, []byte(fields[2]))
+}
+
+func (b *BT) handleScan(i []string) {
+	b.mu.Lock()
+	sc := b.scan
+	b.mu.Unlock()
+	if sc == nil {
+		return
+	}
+	select {
+	case sc <- info.Fields(info.TrimPrefix(i[0], "+BTSCAN")):
+	default:
+	}
+}
+
+// parseDevice parses the fields of a +BTSCAN device indication, of the form
+// 0,<id>,<name>,<address>,<rssi>.
+func parseDevice(fields []string) (Device, bool) {
+	if len(fields) < 5 || fields[0] != "0" {
+		return Device{}, false
+	}
+	id, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Device{}, false
+	}
+	rssi, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return Device{}, false
+	}
+	return Device{ID: id, Name: fields[2], Address: fields[3], RSSI: rssi}, true
+}
+
+var (
+	// ErrScanInProgress indicates a scan was requested while another is in
+	// progress.
+	ErrScanInProgress = errors.New("scan in progress")
+)
@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package bt_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/bt"
+)
+
+func TestStart(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+BTPOWER=1\r\n": {"OK\r\n"},
+		"AT+BTPOWER=0\r\n": {"OK\r\n"},
+	}
+	b, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	err := b.Start()
+	assert.Nil(t, err)
+	// indications registered
+	err = b.AddIndication("+BTSPPDATA:", func([]string) {})
+	assert.Equal(t, at.ErrIndicationExists, err)
+	err = b.Stop()
+	assert.Nil(t, err)
+	// and removed
+	err = b.AddIndication("+BTSPPDATA:", func([]string) {})
+	assert.Nil(t, err)
+}
+
+func TestStartError(t *testing.T) {
+	b, mm := setupModem(t, nil)
+	defer teardownModem(mm)
+	err := b.Start()
+	assert.Equal(t, at.ErrError, err)
+	// indications removed so can be restarted
+	err = b.AddIndication("+BTSPPDATA:", func([]string) {})
+	assert.Nil(t, err)
+}
+
+func TestSetName(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+BTHOST=\"tracker\"\r\n": {"OK\r\n"},
+	}
+	b, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	err := b.SetName("tracker")
+	assert.Nil(t, err)
+	err = b.SetName("other")
+	assert.Equal(t, at.ErrError, err)
+}
+
+func TestScan(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+BTPOWER=1\r\n": {"OK\r\n"},
+		"AT+BTSCAN=1,10\r\n": {
+			"OK\r\n",
+			"+BTSCAN: 0,1,\"phone\",a4:50:46:21:0c:f1,-62\r\n",
+			"+BTSCAN: 0,2,\"speaker\",00:1a:7d:da:71:13,-80\r\n",
+		},
+	}
+	b, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	err := b.Start()
+	require.Nil(t, err)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		mm.r <- []byte("+BTSCAN: 1\r\n")
+	}()
+	dd, err := b.Scan(10 * time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, []bt.Device{
+		{ID: 1, Name: "phone", Address: "a4:50:46:21:0c:f1", RSSI: -62},
+		{ID: 2, Name: "speaker", Address: "00:1a:7d:da:71:13", RSSI: -80},
+	}, dd)
+
+	dd, err = b.Scan(20 * time.Second)
+	assert.Equal(t, at.ErrError, err)
+	assert.Nil(t, dd)
+}
+
+func TestPairing(t *testing.T) {
+	patterns := []struct {
+		name   string
+		accept bool
+		cmd    string
+	}{
+		{"accept", true, "AT+BTPAIR=1,1\r\n"},
+		{"reject", false, "AT+BTPAIR=1,0\r\n"},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			rsp := make(chan struct{})
+			cmdSet := map[string][]string{
+				"AT+BTPOWER=1\r\n":  {"OK\r\n"},
+				"AT+BTPAIR=0,1\r\n": {"OK\r\n"},
+			}
+			prc := make(chan bt.PairingRequest, 1)
+			ph := func(pr bt.PairingRequest) bool {
+				prc <- pr
+				return p.accept
+			}
+			b, mm := setupModem(t, cmdSet, bt.WithPairingHandler(ph))
+			defer teardownModem(mm)
+			mm.cmdSet[p.cmd] = []string{"OK\r\n"}
+			mm.notify = map[string]chan struct{}{p.cmd: rsp}
+			err := b.Start()
+			require.Nil(t, err)
+			err = b.Pair(1)
+			require.Nil(t, err)
+			mm.r <- []byte("+BTPAIRING: \"phone\",a4:50:46:21:0c:f1,123456\r\n")
+			select {
+			case pr := <-prc:
+				assert.Equal(t, bt.PairingRequest{
+					Name:    "phone",
+					Address: "a4:50:46:21:0c:f1",
+					Passkey: "123456"}, pr)
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("no pairing request")
+			}
+			select {
+			case <-rsp:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("no pairing response")
+			}
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestConnection(t *testing.T) {
+	rsp := make(chan struct{})
+	cmdSet := map[string][]string{
+		"AT+BTPOWER=1\r\n":   {"OK\r\n"},
+		"AT+BTACPT=1\r\n":    {"OK\r\n"},
+		"AT+BTDISCONN=1\r\n": {"OK\r\n"},
+	}
+	ch := func(cr bt.ConnectRequest) bool {
+		return cr.Profile == "SPP"
+	}
+	lc := make(chan bt.Link, 1)
+	upc := make(chan bool, 1)
+	lh := func(l bt.Link, up bool) {
+		lc <- l
+		upc <- up
+	}
+	dc := make(chan string, 1)
+	dh := func(id int, data []byte) {
+		dc <- fmt.Sprintf("%d:%s", id, data)
+	}
+	b, mm := setupModem(t, cmdSet,
+		bt.WithConnectHandler(ch),
+		bt.WithLinkHandler(lh),
+		bt.WithDataHandler(dh))
+	defer teardownModem(mm)
+	mm.notify = map[string]chan struct{}{"AT+BTACPT=1\r\n": rsp}
+	err := b.Start()
+	require.Nil(t, err)
+
+	mm.r <- []byte("+BTCONNECTING: \"a4:50:46:21:0c:f1\",\"SPP\"\r\n")
+	select {
+	case <-rsp:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("connection not accepted")
+	}
+
+	mm.r <- []byte("+BTCONNECT: 1,\"phone\",a4:50:46:21:0c:f1,\"SPP\"\r\n")
+	select {
+	case l := <-lc:
+		assert.Equal(t, bt.Link{ID: 1, Name: "phone", Address: "a4:50:46:21:0c:f1", Profile: "SPP"}, l)
+		assert.True(t, <-upc)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no connection")
+	}
+
+	mm.r <- []byte("+BTSPPDATA: 1,9,hello,bob\r\n")
+	select {
+	case d := <-dc:
+		assert.Equal(t, "1:hello,bob", d)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no data")
+	}
+
+	err = b.Disconnect(1)
+	assert.Nil(t, err)
+	mm.r <- []byte("+BTDISCONN: \"phone\",a4:50:46:21:0c:f1,1\r\n")
+	select {
+	case l := <-lc:
+		assert.Equal(t, bt.Link{ID: 1, Name: "phone", Address: "a4:50:46:21:0c:f1"}, l)
+		assert.False(t, <-upc)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no disconnection")
+	}
+}
+
+func TestSend(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+BTSPPSEND=5\r": {"\r\n> "},
+		"hello":            {"\r\nSEND OK\r\n"},
+		"AT+BTSPPSEND=3\r": {"\r\n> "},
+		"bye":              {"\r\nSEND FAIL\r\n"},
+	}
+	b, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	err := b.Send([]byte("hello"))
+	assert.Nil(t, err)
+	err = b.Send([]byte("bye"))
+	assert.Equal(t, at.ErrSendFailed, err)
+}
+
+type mockModem struct {
+	cmdSet map[string][]string
+	notify map[string]chan struct{}
+	closed bool
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if data == nil {
+		return 0, at.ErrClosed
+	}
+	copy(p, data) // assumes p is empty
+	if !ok {
+		return len(data), fmt.Errorf("closed with data")
+	}
+	return len(data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	if mm.closed {
+		return 0, at.ErrClosed
+	}
+	v := mm.cmdSet[string(p)]
+	if len(v) == 0 {
+		mm.r <- []byte("\r\nERROR\r\n")
+	} else {
+		for _, l := range v {
+			mm.r <- []byte(l)
+		}
+	}
+	if n, ok := mm.notify[string(p)]; ok {
+		close(n)
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) Close() error {
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
+
+func setupModem(t *testing.T, cmdSet map[string][]string, options ...bt.Option) (*bt.BT, *mockModem) {
+	if cmdSet == nil {
+		cmdSet = map[string][]string{}
+	}
+	mm := &mockModem{cmdSet: cmdSet, r: make(chan []byte, 10)}
+	b := bt.New(at.New(mm), options...)
+	require.NotNil(t, b)
+	return b, mm
+}
+
+func teardownModem(mm *mockModem) {
+	mm.Close()
+}
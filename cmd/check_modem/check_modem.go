@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// check_modem is a Nagios compatible plugin that checks the health of a
+// modem.
+//
+// The status is reported on a single line, along with performance data for
+// the signal strength, registration, SIM state and, optionally, the depth of
+// an outgoing message queue directory, and the exit code follows the Nagios
+// plugin convention - 0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/modem/serial"
+)
+
+var version = "undefined"
+
+// Nagios plugin exit codes.
+const (
+	stateOK = iota
+	stateWarning
+	stateCritical
+	stateUnknown
+)
+
+var stateNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+func main() {
+	dev := flag.String("d", "/dev/ttyUSB0", "path to modem device")
+	baud := flag.Int("b", 115200, "baud rate")
+	timeout := flag.Duration("t", 5*time.Second, "command timeout period")
+	period := flag.Duration("p", 30*time.Second, "overall check timeout period")
+	rssiWarn := flag.Int("w", 10, "rssi warning threshold")
+	rssiCrit := flag.Int("c", 5, "rssi critical threshold")
+	queue := flag.String("q", "", "queue directory to report the depth of")
+	queueWarn := flag.Int("qw", 10, "queue depth warning threshold")
+	queueCrit := flag.Int("qc", 100, "queue depth critical threshold")
+	vsn := flag.Bool("version", false, "report version and exit")
+	flag.Parse()
+	if *vsn {
+		fmt.Printf("%s %s\n", os.Args[0], version)
+		os.Exit(0)
+	}
+	m, err := serial.New(serial.WithPort(*dev), serial.WithBaud(*baud))
+	if err != nil {
+		exit(stateUnknown, err.Error(), nil)
+	}
+	defer m.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *period)
+	defer cancel()
+	g := gsm.New(at.New(m, at.WithTimeout(*timeout)))
+	state := stateOK
+	var msgs, perf []string
+	if err = g.Init(); err != nil {
+		exit(stateCritical, "init: "+err.Error(), nil)
+	}
+	r := g.HealthCheck(ctx, gsm.ATProbe, gsm.SIMProbe, gsm.RegistrationProbe)
+	for _, p := range r.Results {
+		v := 1
+		if !p.Passed() {
+			v = 0
+			state = stateCritical
+			msgs = append(msgs, fmt.Sprintf("%s: %v", p.Name, p.Err))
+		}
+		if p.Name != "at" {
+			perf = append(perf, fmt.Sprintf("%s=%d", p.Name, v))
+		}
+	}
+	rssi, _, err := g.SignalQuality()
+	switch {
+	case err != nil:
+		state = stateCritical
+		msgs = append(msgs, fmt.Sprintf("signal: %v", err))
+	case rssi == 99 || rssi < *rssiCrit:
+		state = stateCritical
+		msgs = append(msgs, fmt.Sprintf("rssi %d", rssi))
+	case rssi < *rssiWarn:
+		state = worst(state, stateWarning)
+		msgs = append(msgs, fmt.Sprintf("rssi %d", rssi))
+	default:
+		msgs = append(msgs, fmt.Sprintf("rssi %d", rssi))
+	}
+	if err == nil {
+		perf = append([]string{fmt.Sprintf("rssi=%d;%d;%d;0;31", rssi, *rssiWarn, *rssiCrit)}, perf...)
+	}
+	if *queue != "" {
+		depth, err := queueDepth(*queue)
+		switch {
+		case err != nil:
+			state = worst(state, stateUnknown)
+			msgs = append(msgs, fmt.Sprintf("queue: %v", err))
+		case depth >= *queueCrit:
+			state = stateCritical
+			msgs = append(msgs, fmt.Sprintf("queue depth %d", depth))
+		case depth >= *queueWarn:
+			state = worst(state, stateWarning)
+			msgs = append(msgs, fmt.Sprintf("queue depth %d", depth))
+		}
+		if err == nil {
+			perf = append(perf, fmt.Sprintf("queue=%d;%d;%d;0", depth, *queueWarn, *queueCrit))
+		}
+	}
+	exit(state, strings.Join(msgs, ", "), perf)
+}
+
+// worst returns the more severe of the two states.
+//
+// UNKNOWN is more severe than OK, but less severe than WARNING or CRITICAL, as
+// a known problem is more significant than an unknown one.
+func worst(a, b int) int {
+	if severity[a] > severity[b] {
+		return a
+	}
+	return b
+}
+
+var severity = []int{stateOK: 0, stateWarning: 2, stateCritical: 3, stateUnknown: 1}
+
+// queueDepth returns the number of messages waiting in the queue directory.
+func queueDepth(dir string) (int, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() && !strings.HasPrefix(fi.Name(), ".") {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func exit(state int, msg string, perf []string) {
+	line := fmt.Sprintf("MODEM %s - %s", stateNames[state], msg)
+	if len(perf) > 0 {
+		line += " | " + strings.Join(perf, " ")
+	}
+	fmt.Println(line)
+	os.Exit(state)
+}
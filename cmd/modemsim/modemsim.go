@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// modemsim is a soft modem, which simulates a GSM modem over TCP or a
+// pseudo-terminal, so applications built on the modem packages can be tested
+// end to end, such as in CI, without a physical modem.
+//
+// The simulated modem responds to the commands issued by the at and gsm
+// packages, including sending messages, reading, listing and deleting
+// stored messages, and reporting signal quality and network registration.
+// Echo is disabled, as per ATE0.
+//
+// Each TCP connection is a separate session, with its own modem state.  The
+// pseudo-terminal is a single session, and its path is logged on startup,
+// or may be linked to a fixed path using -link.
+//
+// A scenario file may be provided to script the behaviour of the modem.  It
+// contains lines overriding the responses to commands matching a pattern,
+// as per attest.Match, with the response lines separated by '|', e.g.
+//
+//	respond AT+COPS? +COPS: 0,0,"Telstra",7 | OK
+//	respond AT+CMGS=* +CMS ERROR: 500
+//
+// and lines scheduling actions at an offset from the start of the session,
+// e.g.
+//
+//	+5s sms +61412345678 hello from the network
+//	+10s registration 0
+//	+15s signal 5
+//	+20s garbage 64
+//	+25s registration 1
+//	+30s indicate +CUSD: 0,"balance $10",15
+//	+60s close
+//
+// The actions are:
+//
+//	sms <number> <text>   deliver a message, as per the +CNMI settings
+//	registration <stat>   change the network registration status, e.g. 0
+//	                      for not registered or 1 for registered
+//	signal <rssi>         change the signal strength reported by +CSQ
+//	garbage <count>       emit count random bytes, simulating line noise
+//	indicate <line>       emit the line as an unsolicited result code
+//	close                 end the session, dropping the TCP connection
+//
+// Comments start with '#', so the text of messages cannot contain '#'.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/warthog618/modem/at/attest"
+	"github.com/warthog618/modem/trace"
+)
+
+var version = "undefined"
+
+func main() {
+	addr := flag.String("l", "", "TCP address to listen on, e.g. localhost:2323")
+	pty := flag.Bool("p", false, "simulate the modem over a pseudo-terminal")
+	link := flag.String("link", "", "path to link to the pseudo-terminal")
+	script := flag.String("s", "", "path to scenario file")
+	verbose := flag.Bool("v", false, "log modem interactions")
+	vsn := flag.Bool("version", false, "report version and exit")
+	flag.Parse()
+	if *vsn {
+		fmt.Printf("%s %s\n", os.Args[0], version)
+		os.Exit(0)
+	}
+	if *addr == "" && !*pty {
+		log.Fatal("one of -l or -p is required")
+	}
+	var sc scenario
+	if *script != "" {
+		var err error
+		if sc, err = loadScenario(*script); err != nil {
+			log.Fatalf("%s: %v", *script, err)
+		}
+	}
+	errs := make(chan error, 2)
+	if *pty {
+		go func() {
+			errs <- servePty(sc, *link, *verbose)
+		}()
+	}
+	if *addr != "" {
+		go func() {
+			errs <- serveTCP(sc, *addr, *verbose)
+		}()
+	}
+	log.Fatal(<-errs)
+}
+
+// serveTCP runs a session for each connection to the address.
+func serveTCP(sc scenario, addr string, verbose bool) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("listening on %s", l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			log.Printf("%s: session started", conn.RemoteAddr())
+			runSession(conn, sc, verbose)
+			conn.Close()
+			log.Printf("%s: session ended", conn.RemoteAddr())
+		}()
+	}
+}
+
+// servePty runs a session over a pseudo-terminal.
+//
+// The pseudo-terminal persists across sessions, so a session ended by the
+// scenario is restarted, with a fresh modem state.
+func servePty(sc scenario, link string, verbose bool) error {
+	master, slave, err := openPty()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	defer slave.Close()
+	path := slave.Name()
+	if link != "" {
+		os.Remove(link)
+		if err = os.Symlink(path, link); err != nil {
+			return err
+		}
+		defer os.Remove(link)
+		path = link
+	}
+	log.Printf("modem available at %s", path)
+	for {
+		if err = runSession(master, sc, verbose); err != nil {
+			return err
+		}
+		log.Printf("%s: session restarted", path)
+	}
+}
+
+// runSession simulates a modem over the link until the link fails or the
+// scenario closes the session.
+//
+// Returns the error that caused the link to fail, or nil if the session was
+// closed by the scenario.
+func runSession(link io.ReadWriter, sc scenario, verbose bool) error {
+	if verbose {
+		link = trace.New(link, trace.WithReadFormat("cmd: %q"), trace.WithWriteFormat("rsp: %q"))
+	}
+	s := newSim()
+	var rules []attest.Option
+	for _, rsp := range sc.responses {
+		rules = append(rules, attest.WithResponse(rsp.pattern, rsp.lines...))
+	}
+	rules = append(rules, attest.WithResponder("*", s.respond))
+	m := attest.New(rules...)
+	defer m.Close()
+
+	done := make(chan error, 2)
+	// commands from the link to the modem
+	go func() {
+		done <- readCommands(link, m)
+	}()
+	// responses from the modem to the link
+	go func() {
+		_, err := io.Copy(link, m)
+		done <- err
+	}()
+	start := time.Now()
+	for _, e := range sc.events {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(time.Until(start.Add(e.offset))):
+		}
+		if e.action == "close" {
+			return nil
+		}
+		if err := perform(s, m, e); err != nil {
+			log.Printf("%s: %v", e.action, err)
+		}
+	}
+	return <-done
+}
+
+// readCommands reads commands from the link and writes them to the modem,
+// one command per write.
+//
+// Commands are terminated by CR, the body of an SMS by Ctrl-Z, and an escape
+// is passed on immediately.
+func readCommands(link io.Reader, m io.Writer) error {
+	r := bufio.NewReader(link)
+	var cmd []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch b {
+		case '\n':
+			// the LF following the CR terminating a command.
+			if len(cmd) == 0 {
+				continue
+			}
+			cmd = append(cmd, b)
+		case '\r', 0x1a, 0x1b:
+			cmd = append(cmd, b)
+			if len(cmd) > 1 || b != '\r' {
+				m.Write(cmd)
+			}
+			cmd = cmd[:0]
+		default:
+			cmd = append(cmd, b)
+		}
+	}
+}
+
+// perform performs the scenario action on the modem.
+func perform(s *sim, m *attest.Modem, e event) error {
+	switch e.action {
+	case "sms":
+		inds, err := s.deliver(e.args[0], e.args[1])
+		if err != nil {
+			return err
+		}
+		for _, ind := range inds {
+			m.Indicate(ind...)
+		}
+	case "registration":
+		stat, _ := strconv.Atoi(e.args[0])
+		for _, ind := range s.setRegistration(stat) {
+			m.Indicate(ind...)
+		}
+	case "signal":
+		rssi, _ := strconv.Atoi(e.args[0])
+		s.setSignal(rssi)
+	case "garbage":
+		n, _ := strconv.Atoi(e.args[0])
+		noise := make([]byte, n)
+		rand.Read(noise)
+		m.Inject(noise)
+	case "indicate":
+		m.Indicate(e.args[0])
+	}
+	return nil
+}
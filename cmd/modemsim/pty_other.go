@@ -0,0 +1,18 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// openPty is only supported on Linux.
+func openPty() (master, slave *os.File, err error) {
+	return nil, nil, errors.New("pty not supported on this platform")
+}
@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scenario is the script run by the simulator for each session.
+type scenario struct {
+	// responses override the built-in responses to matching commands.
+	responses []response
+
+	// events are the actions performed during the session, in order of
+	// their offset.
+	events []event
+}
+
+// response is a canned response to commands matching the pattern.
+type response struct {
+	pattern string
+	lines   []string
+}
+
+// event is an action performed at an offset from the start of the session.
+type event struct {
+	offset time.Duration
+	action string
+	args   []string
+}
+
+// loadScenario reads the scenario from the named file.
+func loadScenario(path string) (scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return scenario{}, err
+	}
+	defer f.Close()
+	return parseScenario(f)
+}
+
+// parseScenario parses a scenario, i.e. lines of either
+//
+//	respond <pattern> <line>[ | <line>...]
+//
+// or
+//
+//	+<offset> <action> [<args>...]
+//
+// with comments starting with '#'.
+//
+// Actions not recognised are rejected, rather than being silently ignored,
+// so typos are detected.
+func parseScenario(r io.Reader) (scenario, error) {
+	var sc scenario
+	s := bufio.NewScanner(r)
+	lineNum := 0
+	for s.Scan() {
+		lineNum++
+		line := s.Text()
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var err error
+		if strings.HasPrefix(line, "+") {
+			var e event
+			if e, err = parseEvent(line); err == nil {
+				sc.events = append(sc.events, e)
+			}
+		} else {
+			var rsp response
+			if rsp, err = parseResponse(line); err == nil {
+				sc.responses = append(sc.responses, rsp)
+			}
+		}
+		if err != nil {
+			return sc, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	sort.SliceStable(sc.events, func(i, j int) bool {
+		return sc.events[i].offset < sc.events[j].offset
+	})
+	return sc, s.Err()
+}
+
+func parseResponse(line string) (response, error) {
+	fields := strings.SplitN(line, " ", 3)
+	if fields[0] != "respond" {
+		return response{}, fmt.Errorf("unknown directive %q", fields[0])
+	}
+	if len(fields) < 3 {
+		return response{}, errors.New("expected respond <pattern> <lines>")
+	}
+	lines := strings.Split(fields[2], "|")
+	for n, l := range lines {
+		lines[n] = strings.TrimSpace(l)
+	}
+	return response{pattern: fields[1], lines: lines}, nil
+}
+
+func parseEvent(line string) (event, error) {
+	fields := strings.Fields(line)
+	offset, err := time.ParseDuration(fields[0][1:])
+	if err != nil {
+		return event{}, err
+	}
+	if len(fields) < 2 {
+		return event{}, errors.New("expected +<offset> <action>")
+	}
+	e := event{offset: offset, action: fields[1], args: fields[2:]}
+	switch e.action {
+	case "sms":
+		// the text is the remainder of the line, so may contain spaces.
+		if len(e.args) < 2 {
+			return e, errors.New("expected sms <number> <text>")
+		}
+		e.args = fieldsN(line, 4)[2:]
+	case "indicate":
+		if len(e.args) < 1 {
+			return e, errors.New("expected indicate <line>")
+		}
+		e.args = fieldsN(line, 3)[2:]
+	case "registration":
+		err = intArg(e.args, 0, 5)
+	case "signal":
+		err = intArg(e.args, 0, 99)
+	case "garbage":
+		err = intArg(e.args, 1, 4096)
+	case "close":
+		if len(e.args) != 0 {
+			err = errors.New("unexpected arguments")
+		}
+	default:
+		err = fmt.Errorf("unknown action %q", e.action)
+	}
+	return e, err
+}
+
+// fieldsN splits the line into at most n whitespace separated fields, the
+// last being the remainder of the line.
+func fieldsN(line string, n int) []string {
+	var fields []string
+	line = strings.TrimSpace(line)
+	for len(fields) < n-1 {
+		idx := strings.IndexAny(line, " \t")
+		if idx < 0 {
+			break
+		}
+		fields = append(fields, line[:idx])
+		line = strings.TrimLeft(line[idx:], " \t")
+	}
+	if line != "" {
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+// intArg checks the args are a single integer within the range.
+func intArg(args []string, min, max int) error {
+	if len(args) != 1 {
+		return errors.New("expected a single argument")
+	}
+	v, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	if v < min || v > max {
+		return fmt.Errorf("%d out of range %d-%d", v, min, max)
+	}
+	return nil
+}
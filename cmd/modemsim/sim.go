@@ -0,0 +1,395 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/pdumode"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// storageSize is the number of messages the simulated SIM can store.
+const storageSize = 30
+
+// sim is the state of a simulated modem, which responds to the commands
+// issued by the modem and gsm packages.
+type sim struct {
+	mu sync.Mutex
+
+	// true if in PDU mode (+CMGF=0), else text mode.
+	pduMode bool
+
+	// the <mt> set by +CNMI, which determines how messages are delivered.
+	mt int
+
+	// the unsolicited result code mode of each registration command, e.g.
+	// +CREG=2.
+	regMode map[string]int
+
+	// the network registration status.
+	stat int
+
+	// the signal strength, as per +CSQ.
+	rssi int
+
+	// the TP-MR of the most recently sent message.
+	mr int
+
+	// true while waiting for the body of a +CMGS.
+	awaitingBody bool
+
+	// the stored messages, indexed by storage slot.
+	store map[int]*storedMsg
+}
+
+// storedMsg is a received message held in the simulated SIM storage.
+type storedMsg struct {
+	number string
+	scts   time.Time
+	text   string
+	pdu    string
+	length int
+	read   bool
+}
+
+func newSim() *sim {
+	return &sim{
+		pduMode: true,
+		mt:      2,
+		regMode: make(map[string]int),
+		stat:    1,
+		rssi:    20,
+		store:   make(map[int]*storedMsg),
+	}
+}
+
+// respond returns the response to the command.
+//
+// Commands not recognised, or with invalid parameters, return ERROR.
+func (s *sim) respond(cmd string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strings.HasPrefix(cmd, "\x1b") {
+		// escape, which cancels any pending body, and is not acknowledged.
+		s.awaitingBody = false
+		return nil
+	}
+	if s.awaitingBody {
+		s.awaitingBody = false
+		s.mr = (s.mr + 1) & 0xff
+		return []string{fmt.Sprintf("+CMGS: %d", s.mr), "OK"}
+	}
+	if !strings.HasPrefix(strings.ToUpper(cmd), "AT") {
+		return []string{"ERROR"}
+	}
+	cmd = cmd[2:]
+	op, param := cmd, ""
+	if idx := strings.IndexAny(cmd, "=?"); idx >= 0 {
+		op, param = cmd[:idx], cmd[idx:]
+	}
+	op = strings.ToUpper(op)
+	var info []string
+	ok := true
+	switch op {
+	case "", "Z", "E0", "E1", "&F", "+CMEE", "+CSCS", "+CSDH", "+CNMA":
+	case "+GCAP":
+		info = []string{"+GCAP: +CGSM"}
+	case "+CGMI":
+		info = []string{"warthog618"}
+	case "+CGMM":
+		info = []string{"modemsim"}
+	case "+CGMR":
+		info = []string{version}
+	case "+CGSN":
+		info = []string{"490154203237518"}
+	case "+CIMI":
+		info = []string{"505019999999999"}
+	case "+CPIN":
+		info = []string{"+CPIN: READY"}
+	case "+CSQ":
+		info = []string{fmt.Sprintf("+CSQ: %d,99", s.rssi)}
+	case "+CSMS":
+		info = []string{"+CSMS: 0,1,1,1"}
+	case "+CMGF":
+		info, ok = s.cmgf(param)
+	case "+CNMI":
+		info, ok = s.cnmi(param)
+	case "+CREG", "+CGREG", "+CEREG":
+		info, ok = s.creg(op, param)
+	case "+COPS":
+		info = []string{"+COPS: 0"}
+		if s.registered() {
+			info = []string{`+COPS: 0,0,"modemsim",7`}
+		}
+	case "+CPMS":
+		n := len(s.store)
+		info = []string{fmt.Sprintf(`+CPMS: "SM",%d,%d,"SM",%d,%d,"SM",%d,%d`,
+			n, storageSize, n, storageSize, n, storageSize)}
+	case "+CMGS":
+		if !strings.HasPrefix(param, "=") || !s.registered() {
+			return []string{"+CMS ERROR: 331"}
+		}
+		s.awaitingBody = true
+		return []string{">"}
+	case "+CMGR":
+		return s.cmgr(param)
+	case "+CMGL":
+		info, ok = s.cmgl(param)
+	case "+CMGD":
+		ok = s.cmgd(param)
+	default:
+		ok = false
+	}
+	if !ok {
+		return []string{"ERROR"}
+	}
+	return append(info, "OK")
+}
+
+func (s *sim) registered() bool {
+	return s.stat == 1 || s.stat == 5
+}
+
+func (s *sim) cmgf(param string) ([]string, bool) {
+	switch param {
+	case "?":
+		return []string{fmt.Sprintf("+CMGF: %d", boolInt(!s.pduMode))}, true
+	case "=?":
+		return []string{"+CMGF: (0,1)"}, true
+	case "=0", "=1":
+		s.pduMode = param == "=0"
+		return nil, true
+	}
+	return nil, false
+}
+
+func (s *sim) cnmi(param string) ([]string, bool) {
+	switch param {
+	case "?":
+		return []string{fmt.Sprintf("+CNMI: 1,%d,0,0,0", s.mt)}, true
+	case "=?":
+		return []string{"+CNMI: (0-2),(0-3),(0,2),(0-2),(0,1)"}, true
+	}
+	fields := strings.Split(strings.TrimPrefix(param, "="), ",")
+	if len(fields) < 2 {
+		return nil, false
+	}
+	mt, err := strconv.Atoi(fields[1])
+	if err != nil || mt < 0 || mt > 3 {
+		return nil, false
+	}
+	s.mt = mt
+	return nil, true
+}
+
+func (s *sim) creg(op, param string) ([]string, bool) {
+	switch param {
+	case "?":
+		return []string{fmt.Sprintf("%s: %d,%d", op, s.regMode[op], s.stat)}, true
+	case "=?":
+		return []string{op + ": (0-2)"}, true
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(param, "="))
+	if err != nil || n < 0 || n > 2 {
+		return nil, false
+	}
+	s.regMode[op] = n
+	return nil, true
+}
+
+// cmgr returns the response to +CMGR, including the final result code.
+func (s *sim) cmgr(param string) []string {
+	index, err := strconv.Atoi(strings.TrimPrefix(param, "="))
+	if err != nil {
+		return []string{"ERROR"}
+	}
+	m := s.store[index]
+	if m == nil {
+		// invalid memory index
+		return []string{"+CMS ERROR: 321"}
+	}
+	info := s.storedInfo("+CMGR: ", m)
+	m.read = true
+	return append(info, "OK")
+}
+
+func (s *sim) cmgl(param string) ([]string, bool) {
+	stat := strings.Trim(strings.TrimPrefix(param, "="), `"`)
+	if stat == "?" {
+		if s.pduMode {
+			return []string{"+CMGL: (0-4)"}, true
+		}
+		return []string{`+CMGL: ("REC UNREAD","REC READ","STO UNSENT","STO SENT","ALL")`}, true
+	}
+	var info []string
+	for index := 1; index <= storageSize; index++ {
+		m := s.store[index]
+		if m == nil {
+			continue
+		}
+		switch stat {
+		case "0", "REC UNREAD":
+			if m.read {
+				continue
+			}
+		case "1", "REC READ":
+			if !m.read {
+				continue
+			}
+		case "4", "ALL":
+		default:
+			// only received messages are stored.
+			continue
+		}
+		info = append(info, s.storedInfo(fmt.Sprintf("+CMGL: %d,", index), m)...)
+		m.read = true
+	}
+	return info, true
+}
+
+// storedInfo returns the header and body of a stored message, as returned by
+// +CMGR and +CMGL.
+func (s *sim) storedInfo(prefix string, m *storedMsg) []string {
+	if s.pduMode {
+		return []string{fmt.Sprintf("%s%d,,%d", prefix, boolInt(m.read), m.length), m.pdu}
+	}
+	stat := "REC UNREAD"
+	if m.read {
+		stat = "REC READ"
+	}
+	return []string{
+		fmt.Sprintf(`%s"%s","%s",,"%s"`, prefix, stat, m.number, textSCTS(m.scts)),
+		m.text,
+	}
+}
+
+func (s *sim) cmgd(param string) bool {
+	fields := strings.Split(strings.TrimPrefix(param, "="), ",")
+	index, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return false
+	}
+	if len(fields) > 1 && fields[1] != "0" {
+		// any delflag deletes all messages, as only received messages are
+		// stored.
+		s.store = make(map[int]*storedMsg)
+		return true
+	}
+	delete(s.store, index)
+	return true
+}
+
+// deliver delivers a message from the network, returning the indications to
+// be emitted, as determined by the <mt> set by +CNMI.
+func (s *sim) deliver(number, text string) ([][]string, error) {
+	tpdus, err := sms.Encode([]byte(text), sms.AsDeliver, sms.From(number))
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pduMode {
+		// text mode delivers the complete text as a single message.
+		tpdus = tpdus[:1]
+	}
+	now := time.Now()
+	var inds [][]string
+	for n := range tpdus {
+		tp := &tpdus[n]
+		tp.SCTS = tpdu.Timestamp{Time: now}
+		b, err := tp.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		pdu, err := (&pdumode.PDU{TPDU: b}).MarshalHexString()
+		if err != nil {
+			return nil, err
+		}
+		m := &storedMsg{number: number, scts: now, text: text, pdu: pdu, length: len(b)}
+		if s.mt == 2 || s.mt == 3 {
+			inds = append(inds, s.cmt(m))
+			continue
+		}
+		index := s.freeSlot()
+		if index == 0 {
+			// storage full, so the message is lost.
+			continue
+		}
+		s.store[index] = m
+		if s.mt == 1 {
+			inds = append(inds, []string{fmt.Sprintf(`+CMTI: "SM",%d`, index)})
+		}
+	}
+	return inds, nil
+}
+
+// cmt returns the +CMT indication forwarding the message.
+func (s *sim) cmt(m *storedMsg) []string {
+	if s.pduMode {
+		return []string{fmt.Sprintf("+CMT: ,%d", m.length), m.pdu}
+	}
+	return []string{fmt.Sprintf(`+CMT: "%s",,"%s"`, m.number, textSCTS(m.scts)), m.text}
+}
+
+// freeSlot returns the lowest free storage index, or 0 if the storage is full.
+func (s *sim) freeSlot() int {
+	for index := 1; index <= storageSize; index++ {
+		if _, ok := s.store[index]; !ok {
+			return index
+		}
+	}
+	return 0
+}
+
+// setRegistration changes the network registration status, returning the
+// indications to be emitted for the registration commands that have
+// unsolicited result codes enabled.
+func (s *sim) setRegistration(stat int) [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stat == s.stat {
+		return nil
+	}
+	s.stat = stat
+	var inds [][]string
+	for _, op := range []string{"+CREG", "+CGREG", "+CEREG"} {
+		if s.regMode[op] > 0 {
+			inds = append(inds, []string{fmt.Sprintf("%s: %d", op, stat)})
+		}
+	}
+	return inds
+}
+
+// setSignal changes the signal strength reported by +CSQ.
+func (s *sim) setSignal(rssi int) {
+	s.mu.Lock()
+	s.rssi = rssi
+	s.mu.Unlock()
+}
+
+// textSCTS formats a timestamp as per a text mode message, i.e.
+// "yy/MM/dd,hh:mm:ss±zz", where zz is the offset from UTC in quarter hours.
+func textSCTS(t time.Time) string {
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%c%02d", t.Format("06/01/02,15:04:05"), sign, offset/(15*60))
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
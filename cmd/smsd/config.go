@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// config is the daemon configuration.
+type config struct {
+	// device is the path to the modem device.
+	device string
+
+	// baud is the baud rate of the modem device.
+	baud int
+
+	// timeout is the AT command timeout.
+	timeout time.Duration
+
+	// spool is the path to the spool directory.
+	spool string
+
+	// period is the period between scans of the outgoing directory.
+	period time.Duration
+
+	// reports enables requesting and recording status reports.
+	reports bool
+
+	// receive enables storing received messages.
+	receive bool
+
+	// verbose enables logging of modem interactions.
+	verbose bool
+
+	// keyEnv is the name of the environment variable containing the key
+	// used to encrypt the message files written to the spool, if any.
+	keyEnv string
+}
+
+func defaultConfig() config {
+	return config{
+		device:  "/dev/ttyUSB0",
+		baud:    115200,
+		timeout: 5 * time.Second,
+		spool:   "/var/spool/sms",
+		period:  time.Second,
+		reports: true,
+		receive: true,
+	}
+}
+
+// loadConfig reads the configuration from the named file.
+func loadConfig(path string) (config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return config{}, err
+	}
+	defer f.Close()
+	return parseConfig(f)
+}
+
+// parseConfig parses a configuration in the smstools style, i.e. lines of
+// "key = value", with comments starting with '#'.
+//
+// Keys not recognised are rejected, rather than being silently ignored, so
+// typos are detected.
+func parseConfig(r io.Reader) (config, error) {
+	cfg := defaultConfig()
+	sc := bufio.NewScanner(r)
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		line := sc.Text()
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return cfg, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		val := strings.TrimSpace(kv[1])
+		if err := cfg.set(key, val); err != nil {
+			return cfg, fmt.Errorf("line %d: %s: %w", lineNum, key, err)
+		}
+	}
+	return cfg, sc.Err()
+}
+
+func (c *config) set(key, val string) (err error) {
+	switch key {
+	case "device":
+		c.device = val
+	case "baudrate", "baud":
+		c.baud, err = strconv.Atoi(val)
+	case "timeout":
+		c.timeout, err = time.ParseDuration(val)
+	case "spool":
+		c.spool = val
+	case "period":
+		c.period, err = time.ParseDuration(val)
+	case "report", "reports":
+		c.reports, err = parseBool(val)
+	case "receive":
+		c.receive, err = parseBool(val)
+	case "verbose":
+		c.verbose, err = parseBool(val)
+	case "keyenv":
+		c.keyEnv = val
+	default:
+		err = errors.New("unknown key")
+	}
+	return
+}
+
+// parseBool parses the boolean forms accepted by smstools, as well as those
+// accepted by strconv.
+func parseBool(val string) (bool, error) {
+	switch strings.ToLower(val) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(val)
+}
+
+// fixed returns the keys of the settings that differ between the
+// configurations and which cannot be changed without restarting the daemon.
+func (c config) fixed(n config) []string {
+	var keys []string
+	if c.device != n.device {
+		keys = append(keys, "device")
+	}
+	if c.baud != n.baud {
+		keys = append(keys, "baudrate")
+	}
+	if c.timeout != n.timeout {
+		keys = append(keys, "timeout")
+	}
+	if c.spool != n.spool {
+		keys = append(keys, "spool")
+	}
+	if c.reports != n.reports {
+		keys = append(keys, "report")
+	}
+	if c.verbose != n.verbose {
+		keys = append(keys, "verbose")
+	}
+	if c.keyEnv != n.keyEnv {
+		keys = append(keys, "keyenv")
+	}
+	return keys
+}
+
+// liveConfig is the configuration of the running daemon, which may be
+// reloaded.
+type liveConfig struct {
+	mu  sync.Mutex
+	cfg config
+}
+
+func (l *liveConfig) get() config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg
+}
+
+// reload applies the settings of the new configuration that can be changed
+// while the daemon is running, i.e. the period and receive, and returns the
+// keys of the settings that were not applied.
+func (l *liveConfig) reload(n config) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := l.cfg.fixed(n)
+	l.cfg.period = n.period
+	l.cfg.receive = n.receive
+	return keys
+}
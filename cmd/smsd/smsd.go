@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// smsd is an SMS daemon, in the style of smstools, that sends messages
+// dropped into a spool directory, stores received messages, and records
+// status reports against the messages they refer to.
+//
+// The configuration is read from a file of "key = value" lines, e.g.
+//
+//	device = /dev/ttyUSB2
+//	baudrate = 115200
+//	timeout = 5s
+//	spool = /var/spool/sms
+//	period = 1s
+//	report = yes
+//	receive = yes
+//	verbose = no
+//	keyenv = SMSD_KEY
+//
+// If keyenv is set then the message files written to the spool are encrypted
+// with the AES key, in hex or base64, held in the named environment variable.
+//
+// The period and receive settings are reloaded from the file on SIGHUP,
+// without interrupting the connection to the modem or the messages waiting
+// in the spool.  Changes to the other settings require a restart.  While
+// receive is disabled received messages are left in the modem storage.
+//
+// See the spool package for the layout of the spool directory and the format
+// of the message files.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/modem/serial"
+	"github.com/warthog618/modem/spool"
+	"github.com/warthog618/modem/trace"
+)
+
+var version = "undefined"
+
+func main() {
+	cfgPath := flag.String("c", "/etc/smsd.conf", "path to configuration file")
+	vsn := flag.Bool("version", false, "report version and exit")
+	flag.Parse()
+	if *vsn {
+		fmt.Printf("%s %s\n", os.Args[0], version)
+		os.Exit(0)
+	}
+	cfg, err := loadConfig(*cfgPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m, err := serial.New(serial.WithPort(cfg.device), serial.WithBaud(cfg.baud))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer m.Close()
+	var mio io.ReadWriter = m
+	if cfg.verbose {
+		mio = trace.New(m)
+	}
+	g := gsm.New(at.New(mio, at.WithTimeout(cfg.timeout)))
+	if err = g.Init(); err != nil {
+		log.Fatal(err)
+	}
+	spopts := []spool.Option{
+		spool.WithPeriod(cfg.period),
+		spool.WithErrorHandler(func(err error) {
+			log.Printf("spool: %v\n", err)
+		}),
+		spool.WithResultHandler(func(r spool.Result) {
+			if r.Err != nil {
+				log.Printf("%s: send to %s failed: %v\n", r.Name, r.To, r.Err)
+				return
+			}
+			log.Printf("%s: sent to %s, mr %v\n", r.Name, r.To, r.MRs)
+		}),
+		spool.WithDeliveryHandler(func(d spool.Delivery) {
+			log.Printf("%s: delivery to %s %s\n", d.Name, d.To, d.Status)
+		}),
+	}
+	if cfg.keyEnv != "" {
+		spopts = append(spopts, spool.WithEncryption(spool.KeyFromEnv(cfg.keyEnv)))
+	}
+	if cfg.reports {
+		spopts = append(spopts, spool.WithStatusReports())
+	}
+	sp, err := spool.New(cfg.spool, g, spopts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	live := &liveConfig{cfg: cfg}
+	if err = startRx(g, sp, cfg); err != nil {
+		log.Fatal(err)
+	}
+	defer g.StopMessageRx()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case s := <-sigs:
+				if s == syscall.SIGHUP {
+					reload(*cfgPath, live, g, sp)
+					continue
+				}
+				log.Printf("%v, exiting...\n", s)
+			case <-g.Closed():
+				log.Println("modem closed, exiting...")
+			}
+			cancel()
+			return
+		}
+	}()
+	log.Printf("%s %s started, spooling from %s\n", os.Args[0], version, cfg.spool)
+	sp.Run(ctx)
+}
+
+// reload reloads the configuration from the file and applies the settings
+// that can be changed while running.
+//
+// If the file cannot be loaded the current configuration is retained.
+func reload(path string, live *liveConfig, g *gsm.GSM, sp *spool.Spool) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		log.Printf("reload: %v, configuration unchanged\n", err)
+		return
+	}
+	old := live.get()
+	for _, key := range live.reload(cfg) {
+		log.Printf("reload: %s change requires restart\n", key)
+	}
+	sp.SetPeriod(cfg.period)
+	if cfg.receive != old.receive {
+		// the receiver is restarted, rather than messages being discarded by
+		// the handler, as they are acked or read from storage before being
+		// passed to the handler.
+		g.StopMessageRx()
+		if err = startRx(g, sp, live.get()); err != nil {
+			log.Printf("reload: %v\n", err)
+		}
+	}
+	log.Printf("reloaded %s\n", path)
+}
+
+// startRx starts receiving messages and status reports, and records them in
+// the spool.
+//
+// If receive is disabled, but status reports are not, the modem is told to
+// leave received messages in its storage, so they are not lost.
+func startRx(g *gsm.GSM, sp *spool.Spool, cfg config) error {
+	if !cfg.receive && !cfg.reports {
+		return nil
+	}
+	eh := func(err error) {
+		log.Printf("rx: %v\n", err)
+	}
+	mh := func(msg gsm.Message) {
+		name, err := sp.Store(msg)
+		if err != nil {
+			eh(err)
+			return
+		}
+		log.Printf("%s: received from %s\n", name, msg.Number)
+	}
+	var rxopts []gsm.RxOption
+	if !cfg.receive {
+		// only forward status reports.
+		rxopts = append(rxopts, gsm.WithInitialCommand("+CNMI=1,0,0,1,0"))
+	}
+	if cfg.reports {
+		srh := func(sr gsm.StatusReport) {
+			name, err := sp.Report(sr)
+			if err != nil {
+				eh(fmt.Errorf("status report for mr %d: %w", sr.MR, err))
+				return
+			}
+			log.Printf("%s: mr %d %s\n", name, sr.MR, sr.Status)
+		}
+		rxopts = append(rxopts, gsm.WithStatusReports(srh))
+	}
+	return g.StartMessageRx(mh, eh, rxopts...)
+}
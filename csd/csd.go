@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package csd provides circuit switched data calls, such as are still used
+// by legacy telemetry endpoints.
+//
+// Once connected, the modem port carries the data stream rather than AT
+// commands, so the call takes exclusive control of the port.  The port must
+// not be concurrently used by an at.AT, so calls are typically made on a
+// dedicated modem port, or on a port before or after it is used by an at.AT.
+package csd
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Call is a connected circuit switched data call.
+//
+// Reads and writes on the call are passed to and from the remote end.
+type Call struct {
+	rw        io.ReadWriter
+	r         *bufio.Reader
+	guardTime time.Duration
+	timeout   time.Duration
+
+	// Connect is the CONNECT result returned by the modem, which may include
+	// the connection rate, e.g. "CONNECT 9600".
+	Connect string
+
+	// if not-nil, a read of a result abandoned after a timeout, which must
+	// complete before the port is read again.
+	pending chan finalResult
+}
+
+// finalResult is a final result code read from the modem.
+type finalResult struct {
+	line string
+	err  error
+}
+
+// Option is a construction option for Dial.
+type Option interface {
+	applyOption(*Call)
+}
+
+type timeoutOption time.Duration
+
+func (o timeoutOption) applyOption(c *Call) {
+	c.timeout = time.Duration(o)
+}
+
+// WithTimeout specifies the time allowed for the call to connect, or to hang
+// up.
+//
+// The default is 1 minute.
+func WithTimeout(d time.Duration) Option {
+	return timeoutOption(d)
+}
+
+type guardTimeOption time.Duration
+
+func (o guardTimeOption) applyOption(c *Call) {
+	c.guardTime = time.Duration(o)
+}
+
+// WithGuardTime specifies the guard time either side of the +++ escape
+// sequence used to return the modem to command mode.
+//
+// The default is 1 second, which matches the default S12 register setting.
+func WithGuardTime(d time.Duration) Option {
+	return guardTimeOption(d)
+}
+
+var (
+	// ErrBusy indicates the called number is busy.
+	ErrBusy = errors.New("busy")
+
+	// ErrDeadlineExceeded indicates the modem did not respond within the
+	// timeout.  The state of the port is then unknown and it should be
+	// closed.
+	ErrDeadlineExceeded = errors.New("deadline exceeded")
+
+	// ErrError indicates the modem rejected the command.
+	ErrError = errors.New("error")
+
+	// ErrInvalidNumber indicates the number contains characters other than
+	// those permitted in a dial string, so could inject commands into the
+	// modem.
+	ErrInvalidNumber = errors.New("invalid number")
+
+	// ErrNoAnswer indicates the called number did not answer.
+	ErrNoAnswer = errors.New("no answer")
+
+	// ErrNoCarrier indicates the connection could not be established, or has
+	// been lost.
+	ErrNoCarrier = errors.New("no carrier")
+
+	// ErrNoDialtone indicates the modem has no network service.
+	ErrNoDialtone = errors.New("no dialtone")
+)
+
+// results maps the final result codes to their errors.
+var results = map[string]error{
+	"OK":          nil,
+	"BUSY":        ErrBusy,
+	"ERROR":       ErrError,
+	"NO ANSWER":   ErrNoAnswer,
+	"NO CARRIER":  ErrNoCarrier,
+	"NO DIALTONE": ErrNoDialtone,
+}
+
+// dialChars are the characters permitted in the number passed to Dial, being
+// the digits and the dial modifiers of V.250.
+const dialChars = "0123456789*#+ABCDabcd,TtPpWw!@"
+
+// Dial places a data call to the number and, once connected, returns the call
+// for the exchange of data.
+//
+// The number may only contain digits, '*', '#', '+', 'A' to 'D', and the
+// dial modifiers ',', 'T', 'P', 'W', '!' and '@', else ErrInvalidNumber is
+// returned.
+func Dial(rw io.ReadWriter, number string, options ...Option) (*Call, error) {
+	c := Call{
+		rw:        rw,
+		r:         bufio.NewReader(rw),
+		guardTime: time.Second,
+		timeout:   time.Minute,
+	}
+	for _, option := range options {
+		option.applyOption(&c)
+	}
+	// a trailing ';' would make it a voice call.
+	number = strings.TrimRight(number, ";")
+	if number == "" || strings.Trim(number, dialChars) != "" {
+		return nil, ErrInvalidNumber
+	}
+	if _, err := io.WriteString(rw, "ATD"+number+"\r"); err != nil {
+		return nil, err
+	}
+	result, err := c.result(true)
+	if err != nil {
+		return nil, err
+	}
+	c.Connect = result
+	return &c, nil
+}
+
+// Read reads data from the remote end.
+//
+// Returns ErrDeadlineExceeded if a Hangup has timed out and the modem has
+// still not returned a result.
+func (c *Call) Read(p []byte) (int, error) {
+	if c.pending != nil {
+		select {
+		case <-c.pending:
+			c.pending = nil
+		default:
+			return 0, ErrDeadlineExceeded
+		}
+	}
+	return c.r.Read(p)
+}
+
+// Write writes data to the remote end.
+func (c *Call) Write(p []byte) (int, error) {
+	return c.rw.Write(p)
+}
+
+// Hangup returns the modem to command mode and hangs up the call.
+//
+// Any data received from the remote end and not yet read is discarded.  A call
+// already dropped by the remote end is not considered an error.
+func (c *Call) Hangup() error {
+	time.Sleep(c.guardTime)
+	if _, err := io.WriteString(c.rw, "+++"); err != nil {
+		return err
+	}
+	time.Sleep(c.guardTime)
+	if _, err := io.WriteString(c.rw, "ATH\r"); err != nil {
+		return err
+	}
+	_, err := c.result(false)
+	if err == ErrNoCarrier {
+		return nil
+	}
+	return err
+}
+
+// result waits for the final result code from the modem.
+//
+// Lines that are not result codes, such as echoed commands or data, are
+// discarded.
+func (c *Call) result(connect bool) (string, error) {
+	done := c.pending
+	if done == nil {
+		done = make(chan finalResult, 1)
+		go c.readResult(connect, done)
+	}
+	select {
+	case r := <-done:
+		c.pending = nil
+		return r.line, r.err
+	case <-time.After(c.timeout):
+		// the read cannot be cancelled, so it is left pending, and later
+		// reads wait for it rather than reading concurrently with it.
+		c.pending = done
+		return "", ErrDeadlineExceeded
+	}
+}
+
+// readResult reads lines from the modem until a final result code is found,
+// and returns it via done.
+func (c *Call) readResult(connect bool, done chan<- finalResult) {
+	for {
+		l, err := c.r.ReadString('\n')
+		if err != nil {
+			done <- finalResult{err: err}
+			return
+		}
+		l = strings.TrimSpace(l)
+		if connect && strings.HasPrefix(l, "CONNECT") {
+			done <- finalResult{line: l}
+			return
+		}
+		if err, ok := results[l]; ok {
+			done <- finalResult{l, err}
+			return
+		}
+		if strings.HasPrefix(l, "+CME ERROR") {
+			done <- finalResult{l, ErrError}
+			return
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package csd_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/csd"
+)
+
+func TestDial(t *testing.T) {
+	patterns := []struct {
+		name    string
+		number  string
+		rsp     []string
+		connect string
+		err     error
+	}{
+		{"connect", "12345", []string{"ATD12345\r\r\n", "\r\nCONNECT 9600\r\n"}, "CONNECT 9600", nil},
+		{"voice suffix", "12345;", []string{"\r\nCONNECT\r\n"}, "CONNECT", nil},
+		{"busy", "12345", []string{"\r\nBUSY\r\n"}, "", csd.ErrBusy},
+		{"no answer", "12345", []string{"\r\nNO ANSWER\r\n"}, "", csd.ErrNoAnswer},
+		{"no carrier", "12345", []string{"\r\nNO CARRIER\r\n"}, "", csd.ErrNoCarrier},
+		{"no dialtone", "12345", []string{"\r\nNO DIALTONE\r\n"}, "", csd.ErrNoDialtone},
+		{"error", "12345", []string{"\r\nERROR\r\n"}, "", csd.ErrError},
+		{"cme error", "12345", []string{"\r\n+CME ERROR: 30\r\n"}, "", csd.ErrError},
+		{"timeout", "12345", nil, "", csd.ErrDeadlineExceeded},
+		{"empty", "", nil, "", csd.ErrInvalidNumber},
+		{"injection", "12345\rATH", nil, "", csd.ErrInvalidNumber},
+		{"modifiers", "T0,P12345W", []string{"\r\nCONNECT\r\n"}, "CONNECT", nil},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			mm := newMockModem(map[string][]string{"ATD" + strings.TrimRight(p.number, ";") + "\r": p.rsp})
+			defer mm.Close()
+			c, err := csd.Dial(mm, p.number, csd.WithTimeout(50*time.Millisecond))
+			assert.Equal(t, p.err, err)
+			if p.err != nil {
+				assert.Nil(t, c)
+				return
+			}
+			require.NotNil(t, c)
+			assert.Equal(t, p.connect, c.Connect)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestCall(t *testing.T) {
+	cmdSet := map[string][]string{
+		"ATD12345\r": {"\r\nCONNECT 9600\r\n", "welcome"},
+		"ping":       {"pong"},
+		"+++":        {"\r\nOK\r\n"},
+		"ATH\r":      {"\r\nOK\r\n"},
+	}
+	mm := newMockModem(cmdSet)
+	defer mm.Close()
+	c, err := csd.Dial(mm, "12345", csd.WithGuardTime(time.Millisecond))
+	require.Nil(t, err)
+
+	// data following CONNECT is preserved
+	buf := make([]byte, 16)
+	n, err := c.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "welcome", string(buf[:n]))
+
+	n, err = c.Write([]byte("ping"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	n, err = c.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "pong", string(buf[:n]))
+
+	err = c.Hangup()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ATD12345\r", "ping", "+++", "ATH\r"}, mm.written)
+}
+
+func TestHangupDropped(t *testing.T) {
+	cmdSet := map[string][]string{
+		"ATD12345\r": {"\r\nCONNECT\r\n"},
+		"ATH\r":      {"\r\nNO CARRIER\r\n"},
+	}
+	mm := newMockModem(cmdSet)
+	defer mm.Close()
+	c, err := csd.Dial(mm, "12345", csd.WithGuardTime(time.Millisecond))
+	require.Nil(t, err)
+	err = c.Hangup()
+	assert.Nil(t, err)
+}
+
+func TestHangupTimeout(t *testing.T) {
+	cmdSet := map[string][]string{
+		"ATD12345\r": {"\r\nCONNECT\r\n"},
+	}
+	mm := newMockModem(cmdSet)
+	defer mm.Close()
+	c, err := csd.Dial(mm, "12345",
+		csd.WithGuardTime(time.Millisecond),
+		csd.WithTimeout(20*time.Millisecond))
+	require.Nil(t, err)
+	err = c.Hangup()
+	assert.Equal(t, csd.ErrDeadlineExceeded, err)
+
+	// the abandoned read of the result is not raced
+	buf := make([]byte, 16)
+	_, err = c.Read(buf)
+	assert.Equal(t, csd.ErrDeadlineExceeded, err)
+
+	// and consumes the late result
+	mm.r <- []byte("\r\nOK\r\n")
+	time.Sleep(10 * time.Millisecond)
+	mm.r <- []byte("late")
+	n, err := c.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "late", string(buf[:n]))
+}
+
+type mockModem struct {
+	cmdSet  map[string][]string
+	written []string
+	closed  bool
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func newMockModem(cmdSet map[string][]string) *mockModem {
+	return &mockModem{cmdSet: cmdSet, r: make(chan []byte, 10)}
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if !ok {
+		return 0, io.EOF
+	}
+	copy(p, data) // assumes p is empty
+	return len(data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	if mm.closed {
+		return 0, io.ErrClosedPipe
+	}
+	mm.written = append(mm.written, string(p))
+	for _, l := range mm.cmdSet[string(p)] {
+		mm.r <- []byte(l)
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) Close() error {
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package fax provides minimal Class 1 fax transmission, sufficient to send a
+// single page fax to a fax machine or fax receiving service.
+//
+// The T.30 session is driven directly over the modem port, so the port must
+// not be concurrently used by an at.AT.
+//
+// The page must already be encoded as T.4 one-dimensional (Modified Huffman)
+// data, for a 1728 pel wide page at normal resolution, with the bits of each
+// byte in transmission order (LSB first, as per TIFF FillOrder 2), and
+// terminated by an RTC.  This is the encoding of the strips of a Class F
+// TIFF.
+package fax
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Option is a construction option for Send.
+type Option interface {
+	applyOption(*session)
+}
+
+type identityOption string
+
+func (o identityOption) applyOption(s *session) {
+	s.identity = string(o)
+}
+
+// WithIdentity specifies the transmitting subscriber identification (TSI),
+// typically the fax number of the sender, of up to 20 characters.
+func WithIdentity(id string) Option {
+	return identityOption(id)
+}
+
+type timeoutOption time.Duration
+
+func (o timeoutOption) applyOption(s *session) {
+	s.timeout = time.Duration(o)
+}
+
+// WithTimeout specifies the time allowed for each step of the session,
+// including the call connecting.
+//
+// The default is 1 minute.
+func WithTimeout(d time.Duration) Option {
+	return timeoutOption(d)
+}
+
+var (
+	// ErrDeadlineExceeded indicates the modem or the remote end did not
+	// respond within the timeout.
+	ErrDeadlineExceeded = errors.New("deadline exceeded")
+
+	// ErrNoCarrier indicates the call could not be established, or was
+	// dropped.
+	ErrNoCarrier = errors.New("no carrier")
+
+	// ErrNotReceiver indicates the remote end is not capable of receiving a
+	// fax.
+	ErrNotReceiver = errors.New("remote is not a fax receiver")
+
+	// ErrRejected indicates the remote end rejected the page, or the training
+	// at all supported rates.
+	ErrRejected = errors.New("rejected by remote")
+)
+
+// ErrUnexpectedResponse indicates the modem returned a response other than
+// the one expected.
+type ErrUnexpectedResponse struct {
+	Cmd      string
+	Response string
+}
+
+func (e ErrUnexpectedResponse) Error() string {
+	return fmt.Sprintf("unexpected response to '%s': '%s'", e.Cmd, e.Response)
+}
+
+// HDLC framing.
+const (
+	dle = 0x10
+	etx = 0x03
+
+	address    = 0xff
+	nonFinal   = 0x03
+	finalFrame = 0x13
+)
+
+// T.30 facsimile control fields, as passed to and from the modem, with the
+// X bit, indicating the sender of the frame is the caller, masked off.
+const (
+	fcfDIS = 0x80
+	fcfDCS = 0x82
+	fcfTSI = 0x42
+	fcfCFR = 0x84
+	fcfFTT = 0x44
+	fcfMCF = 0x8c
+	fcfRTN = 0x4c
+	fcfEOP = 0x2e
+	fcfDCN = 0xfa
+
+	// the X bit, set in frames sent by the caller.
+	fcfX = 0x01
+)
+
+// rate is a data signalling rate supported for the page transfer.
+type rate struct {
+	// mod is the +FTM modulation.
+	mod int
+	// bps is the bits per second.
+	bps int
+	// sig is the DCS data signalling rate field, bits 11-14.
+	sig byte
+}
+
+// rates is the set of rates to train at, in order of preference.
+var rates = []rate{
+	{96, 9600, 0x04},
+	{72, 7200, 0x0c},
+	{48, 4800, 0x08},
+	{24, 2400, 0x00},
+}
+
+// Send dials the number and sends the page.
+func Send(rw io.ReadWriter, number string, page []byte, options ...Option) error {
+	s := newSession(rw)
+	for _, option := range options {
+		option.applyOption(s)
+	}
+	defer s.close()
+	if err := s.command("+FCLASS=1", "OK"); err != nil {
+		return err
+	}
+	// the modem starts receiving V.21 frames once the call connects.
+	if err := s.command("D"+strings.TrimRight(number, ";"), "CONNECT"); err != nil {
+		return err
+	}
+	defer s.hangup()
+	if err := s.receiveDIS(); err != nil {
+		return err
+	}
+	r, err := s.train()
+	if err != nil {
+		return err
+	}
+	if err = s.sendPage(r, page); err != nil {
+		return err
+	}
+	s.sendFrames([]byte{fcfDCN | fcfX})
+	return nil
+}
+
+// receiveDIS receives the frames from the called station, and checks it
+// includes a DIS indicating the station can receive.
+func (s *session) receiveDIS() error {
+	for {
+		f, final, err := s.receiveFrame()
+		if err != nil {
+			return err
+		}
+		if len(f) > 0 && f[0]&^fcfX == fcfDIS {
+			// bit 10 - receiving function
+			if len(f) < 3 || f[2]&0x02 == 0 {
+				return ErrNotReceiver
+			}
+			return nil
+		}
+		if final {
+			return ErrNotReceiver
+		}
+		if err = s.command("+FRH=3", "CONNECT"); err != nil {
+			return err
+		}
+	}
+}
+
+// train sends the DCS and training check, at decreasing rates until the
+// remote confirms.
+func (s *session) train() (rate, error) {
+	for _, r := range rates {
+		tsi := make([]byte, 21)
+		tsi[0] = fcfTSI | fcfX
+		id := fmt.Sprintf("%-20.20s", s.identity)
+		for i := 0; i < 20; i++ {
+			// the identity is sent last digit first.
+			tsi[20-i] = id[i]
+		}
+		// bit 10 - receiver operation, bits 11-14 rate, bits 21-23 0ms scan
+		// time, normal resolution, MH coding, A4.
+		dcs := []byte{fcfDCS | fcfX, 0x00, 0x02 | r.sig, 0x70}
+		if err := s.sendFrames(tsi, dcs); err != nil {
+			return r, err
+		}
+		if err := s.command("+FTS=8", "OK"); err != nil {
+			return r, err
+		}
+		if err := s.command(fmt.Sprintf("+FTM=%d", r.mod), "CONNECT"); err != nil {
+			return r, err
+		}
+		// 1.5 seconds of zeros
+		if err := s.sendData(make([]byte, r.bps*3/16)); err != nil {
+			return r, err
+		}
+		fcf, err := s.response()
+		if err != nil {
+			return r, err
+		}
+		switch fcf {
+		case fcfCFR:
+			return r, nil
+		case fcfFTT:
+			continue
+		default:
+			return r, ErrRejected
+		}
+	}
+	return rate{}, ErrRejected
+}
+
+// sendPage sends the page at the trained rate.
+func (s *session) sendPage(r rate, page []byte) error {
+	if err := s.command(fmt.Sprintf("+FTM=%d", r.mod), "CONNECT"); err != nil {
+		return err
+	}
+	if err := s.sendData(page); err != nil {
+		return err
+	}
+	if err := s.command("+FTS=8", "OK"); err != nil {
+		return err
+	}
+	if err := s.sendFrames([]byte{fcfEOP | fcfX}); err != nil {
+		return err
+	}
+	fcf, err := s.response()
+	if err != nil {
+		return err
+	}
+	if fcf != fcfMCF {
+		return ErrRejected
+	}
+	return nil
+}
+
+// response receives the FCF of the response frame from the remote.
+func (s *session) response() (byte, error) {
+	if err := s.command("+FRH=3", "CONNECT"); err != nil {
+		return 0, err
+	}
+	f, _, err := s.receiveFrame()
+	if err != nil {
+		return 0, err
+	}
+	if len(f) == 0 {
+		return 0, ErrRejected
+	}
+	return f[0] &^ fcfX, nil
+}
+
+// sendFrames sends a sequence of V.21 HDLC frames, each comprising the FCF
+// and FIF, with the last marked final.
+func (s *session) sendFrames(frames ...[]byte) error {
+	if err := s.command("+FTH=3", "CONNECT"); err != nil {
+		return err
+	}
+	for i, f := range frames {
+		ctl := byte(nonFinal)
+		expect := "CONNECT"
+		if i == len(frames)-1 {
+			ctl = finalFrame
+			expect = "OK"
+		}
+		frame := append([]byte{address, ctl}, f...)
+		if err := s.write(stuff(frame)); err != nil {
+			return err
+		}
+		if err := s.expect("frame", expect); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendData sends high speed data and waits for the modem to complete the
+// transmission.
+func (s *session) sendData(data []byte) error {
+	if err := s.write(stuff(data)); err != nil {
+		return err
+	}
+	return s.expect("data", "OK")
+}
+
+// receiveFrame receives a V.21 HDLC frame, returning the FCF and FIF, and if
+// the frame is marked final.
+func (s *session) receiveFrame() ([]byte, bool, error) {
+	var frame []byte
+	for {
+		b, err := s.readByte()
+		if err != nil {
+			return nil, false, err
+		}
+		if b != dle {
+			frame = append(frame, b)
+			continue
+		}
+		if b, err = s.readByte(); err != nil {
+			return nil, false, err
+		}
+		if b == etx {
+			break
+		}
+		frame = append(frame, b)
+	}
+	if err := s.expect("frame", "OK"); err != nil {
+		return nil, false, err
+	}
+	// address, control, fcf and fcs
+	if len(frame) < 5 {
+		return nil, false, ErrUnexpectedResponse{"frame", fmt.Sprintf("% x", frame)}
+	}
+	return frame[2 : len(frame)-2], frame[1] == finalFrame, nil
+}
+
+// hangup ends the call.
+func (s *session) hangup() {
+	s.command("H", "OK")
+}
+
+// stuff doubles any DLEs in the data and appends the DLE ETX terminator.
+func stuff(data []byte) []byte {
+	out := make([]byte, 0, len(data)+2)
+	for _, b := range data {
+		if b == dle {
+			out = append(out, dle)
+		}
+		out = append(out, b)
+	}
+	return append(out, dle, etx)
+}
@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package fax_test
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/fax"
+)
+
+const (
+	dis    = "\xff\x13\x80\x00\x02\x70\x12\x34\x10\x03"
+	disTx  = "\xff\x13\x80\x00\x00\x70\x12\x34\x10\x03"
+	cfr    = "\xff\x13\x84\x12\x34\x10\x03"
+	ftt    = "\xff\x13\x44\x12\x34\x10\x03"
+	mcf    = "\xff\x13\x8c\x12\x34\x10\x03"
+	rtn    = "\xff\x13\x4c\x12\x34\x10\x03"
+	ok     = "\r\nOK\r\n"
+	cnct   = "\r\nCONNECT\r\n"
+	page   = "\x01\x10\x02"
+	pageTx = "\x01\x10\x10\x02\x10\x03"
+)
+
+// the steps of a session up to, and including, the DIS.
+var dialSteps = []step{
+	{"AT+FCLASS=1\r", []string{ok}},
+	{"ATD123\r", []string{cnct, dis, ok}},
+}
+
+// trainSteps returns the steps to train at the rate.
+func trainSteps(mod, sig string, rsp string) []step {
+	return []step{
+		{"AT+FTH=3\r", []string{cnct}},
+		{"\xff\x03\x43               4321+", []string{cnct}},
+		{"\xff\x13\x83\x00" + sig + "\x70\x10\x03", []string{ok}},
+		{"AT+FTS=8\r", []string{ok}},
+		{"AT+FTM=" + mod + "\r", []string{cnct}},
+		{"\x00\x00\x00", []string{ok}},
+		{"AT+FRH=3\r", []string{cnct, rsp, ok}},
+	}
+}
+
+func pageSteps(mod string, rsp string) []step {
+	return []step{
+		{"AT+FTM=" + mod + "\r", []string{cnct}},
+		{pageTx, []string{ok}},
+		{"AT+FTS=8\r", []string{ok}},
+		{"AT+FTH=3\r", []string{cnct}},
+		{"\xff\x13\x2f\x10\x03", []string{ok}},
+		{"AT+FRH=3\r", []string{cnct, rsp, ok}},
+	}
+}
+
+var hangupSteps = []step{
+	{"ATH\r", []string{ok}},
+}
+
+var dcnSteps = []step{
+	{"AT+FTH=3\r", []string{cnct}},
+	{"\xff\x13\xfb\x10\x03", []string{ok}},
+}
+
+func steps(ss ...[]step) []step {
+	var s []step
+	for _, x := range ss {
+		s = append(s, x...)
+	}
+	return s
+}
+
+func TestSend(t *testing.T) {
+	patterns := []struct {
+		name  string
+		steps []step
+		err   error
+	}{
+		{
+			"sent",
+			steps(dialSteps,
+				trainSteps("96", "\x06", cfr),
+				pageSteps("96", mcf),
+				dcnSteps,
+				hangupSteps),
+			nil,
+		},
+		{
+			"fallback",
+			steps(dialSteps,
+				trainSteps("96", "\x06", ftt),
+				trainSteps("72", "\x0e", cfr),
+				pageSteps("72", mcf),
+				dcnSteps,
+				hangupSteps),
+			nil,
+		},
+		{
+			"untrainable",
+			steps(dialSteps,
+				trainSteps("96", "\x06", ftt),
+				trainSteps("72", "\x0e", ftt),
+				trainSteps("48", "\x0a", ftt),
+				trainSteps("24", "\x02", ftt),
+				hangupSteps),
+			fax.ErrRejected,
+		},
+		{
+			"page rejected",
+			steps(dialSteps,
+				trainSteps("96", "\x06", cfr),
+				pageSteps("96", rtn),
+				hangupSteps),
+			fax.ErrRejected,
+		},
+		{
+			"not receiver",
+			[]step{
+				{"AT+FCLASS=1\r", []string{ok}},
+				{"ATD123\r", []string{cnct, disTx, ok}},
+				{"ATH\r", []string{ok}},
+			},
+			fax.ErrNotReceiver,
+		},
+		{
+			"no carrier",
+			[]step{
+				{"AT+FCLASS=1\r", []string{ok}},
+				{"ATD123\r", []string{"\r\nNO CARRIER\r\n"}},
+			},
+			fax.ErrNoCarrier,
+		},
+		{
+			"no class 1",
+			[]step{
+				{"AT+FCLASS=1\r", []string{"\r\nERROR\r\n"}},
+			},
+			fax.ErrUnexpectedResponse{Cmd: "+FCLASS=1", Response: "ERROR"},
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			mm := newMockModem(p.steps)
+			defer mm.Close()
+			err := fax.Send(mm, "123", []byte(page),
+				fax.WithIdentity("+1234"),
+				fax.WithTimeout(100*time.Millisecond))
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, "", mm.unexpected())
+			assert.Equal(t, len(p.steps), mm.consumed())
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	mm := newMockModem([]step{{"AT+FCLASS=1\r", nil}})
+	defer mm.Close()
+	start := time.Now()
+	err := fax.Send(mm, "123", []byte(page), fax.WithTimeout(20*time.Millisecond))
+	assert.Equal(t, fax.ErrDeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestErrUnexpectedResponse(t *testing.T) {
+	err := fax.ErrUnexpectedResponse{Cmd: "+FTH=3", Response: "ERROR"}
+	assert.Equal(t, "unexpected response to '+FTH=3': 'ERROR'", err.Error())
+}
+
+// step is an expected write to the modem, identified by its prefix, and the
+// responses returned by the modem.
+type step struct {
+	prefix string
+	rsp    []string
+}
+
+type mockModem struct {
+	mu     sync.Mutex
+	steps  []step
+	idx    int
+	unexp  []string
+	closed bool
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func newMockModem(steps []step) *mockModem {
+	return &mockModem{steps: steps, r: make(chan []byte, 10)}
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(p, data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if mm.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if mm.idx < len(mm.steps) && strings.HasPrefix(string(p), mm.steps[mm.idx].prefix) {
+		for _, l := range mm.steps[mm.idx].rsp {
+			mm.r <- []byte(l)
+		}
+		mm.idx++
+	} else {
+		mm.unexp = append(mm.unexp, string(p))
+		mm.r <- []byte("\r\nERROR\r\n")
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) consumed() int {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return mm.idx
+}
+
+func (mm *mockModem) unexpected() string {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return strings.Join(mm.unexp, "|")
+}
+
+func (mm *mockModem) Close() error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package fax
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// session is a fax session over the modem port.
+type session struct {
+	rw       io.ReadWriter
+	identity string
+	timeout  time.Duration
+
+	// chunks read from the modem.
+	rxc  chan []byte
+	done chan struct{}
+	buf  []byte
+}
+
+func newSession(rw io.ReadWriter) *session {
+	s := session{
+		rw:      rw,
+		timeout: time.Minute,
+		rxc:     make(chan []byte),
+		done:    make(chan struct{}),
+	}
+	go s.readLoop()
+	return &s
+}
+
+// readLoop reads chunks from the modem until the port is closed or the
+// session ends.
+func (s *session) readLoop() {
+	defer close(s.rxc)
+	for {
+		buf := make([]byte, 256)
+		n, err := s.rw.Read(buf)
+		if n > 0 {
+			select {
+			case s.rxc <- buf[:n]:
+			case <-s.done:
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// close ends the session.
+//
+// The read loop exits once its pending read completes.
+func (s *session) close() {
+	close(s.done)
+}
+
+func (s *session) readByte() (byte, error) {
+	for len(s.buf) == 0 {
+		select {
+		case b, ok := <-s.rxc:
+			if !ok {
+				return 0, ErrNoCarrier
+			}
+			s.buf = b
+		case <-time.After(s.timeout):
+			return 0, ErrDeadlineExceeded
+		}
+	}
+	b := s.buf[0]
+	s.buf = s.buf[1:]
+	return b, nil
+}
+
+// readLine reads the next non-empty line from the modem.
+func (s *session) readLine() (string, error) {
+	var l []byte
+	for {
+		b, err := s.readByte()
+		if err != nil {
+			return "", err
+		}
+		if b != '\n' {
+			l = append(l, b)
+			continue
+		}
+		line := strings.TrimSpace(string(l))
+		if line != "" {
+			return line, nil
+		}
+		l = l[:0]
+	}
+}
+
+func (s *session) write(b []byte) error {
+	_, err := s.rw.Write(b)
+	return err
+}
+
+// command issues the AT command and waits for the expected result.
+func (s *session) command(cmd, want string) error {
+	if err := s.write([]byte("AT" + cmd + "\r")); err != nil {
+		return err
+	}
+	return s.expect(cmd, want)
+}
+
+// expect waits for the expected result from the modem, ignoring any command
+// echo.
+func (s *session) expect(cmd, want string) error {
+	for {
+		l, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(l, "AT"):
+			continue
+		case strings.HasPrefix(l, want):
+			return nil
+		case l == "NO CARRIER":
+			return ErrNoCarrier
+		}
+		return ErrUnexpectedResponse{cmd, l}
+	}
+}
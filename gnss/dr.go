@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gnss
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// DRCalibration is the calibration state of the dead reckoning sensors.
+type DRCalibration int
+
+const (
+	// DRUncalibrated indicates the sensors have not been calibrated, so dead
+	// reckoning is unavailable.
+	DRUncalibrated DRCalibration = iota
+
+	// DRCalibrating indicates the sensors are being calibrated, which
+	// requires the vehicle to be driven with a GNSS fix.
+	DRCalibrating
+
+	// DRCalibrated indicates the sensors are calibrated, so fused fixes are
+	// available, including while the GNSS fix is lost.
+	DRCalibrated
+)
+
+func (c DRCalibration) String() string {
+	switch c {
+	case DRUncalibrated:
+		return "uncalibrated"
+	case DRCalibrating:
+		return "calibrating"
+	case DRCalibrated:
+		return "calibrated"
+	}
+	return "unknown"
+}
+
+// SetDR enables or disables dead reckoning, fusing the GNSS fix with the
+// inertial sensors of modules that support it, such as the Quectel LG69T
+// family.
+//
+// Once enabled, fused fixes are returned by GNSSFix, Position and
+// StartPositionStream, with a Source of SourceDR while the position is
+// determined by dead reckoning.
+//
+// Only supported by the Quectel dialect.
+func (g *GNSS) SetDR(enable bool, options ...at.CommandOption) error {
+	v := "0"
+	if enable {
+		v = "1"
+	}
+	return g.SetDRConfig("drenable", []string{v}, options...)
+}
+
+// SetDRConfig sets an item of the dead reckoning configuration, such as the
+// mounting or vehicle parameters, using +QDRCFG.
+//
+// The items and values are module specific, so refer to the module
+// documentation.  String values must be quoted by the caller.
+//
+// Only supported by the Quectel dialect.
+func (g *GNSS) SetDRConfig(item string, values []string, options ...at.CommandOption) error {
+	if g.dialect != Quectel {
+		return ErrUnsupported
+	}
+	cmd := fmt.Sprintf("+QDRCFG=\"%s\"", item)
+	if len(values) > 0 {
+		cmd += "," + strings.Join(values, ",")
+	}
+	_, err := g.Command(cmd, options...)
+	return err
+}
+
+// DRCalibrationStatus returns the calibration state of the dead reckoning
+// sensors.
+//
+// The modem returns:
+//
+//	+QDRCFG: "calibstatus",<state>
+//
+// Only supported by the Quectel dialect.
+func (g *GNSS) DRCalibrationStatus(options ...at.CommandOption) (DRCalibration, error) {
+	if g.dialect != Quectel {
+		return DRUncalibrated, ErrUnsupported
+	}
+	i, err := g.Command("+QDRCFG=\"calibstatus\"", options...)
+	if err != nil {
+		return DRUncalibrated, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+QDRCFG") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+QDRCFG"))
+		if len(fields) < 2 || fields[0] != "calibstatus" {
+			continue
+		}
+		state, err := strconv.Atoi(fields[1])
+		if err != nil || state < 0 || state > int(DRCalibrated) {
+			return DRUncalibrated, ErrMalformedResponse
+		}
+		return DRCalibration(state), nil
+	}
+	return DRUncalibrated, ErrMalformedResponse
+}
+
+// the fix mode reported by +QGPSLOC for fixes determined by dead reckoning,
+// as per the NMEA GGA quality indicator.
+const drFixMode = "6"
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gnss_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/gnss"
+)
+
+func TestSetDR(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QDRCFG=\"drenable\",1\r\n":        {"OK\r\n"},
+		"AT+QDRCFG=\"vehicle\",\"car\",2\r\n": {"OK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet, gnss.Quectel)
+	defer teardownModem(mm)
+
+	assert.Nil(t, g.SetDR(true))
+	assert.NotNil(t, g.SetDR(false))
+	assert.Nil(t, g.SetDRConfig("vehicle", []string{"\"car\"", "2"}))
+
+	s, mms := setupModem(t, cmdSet, gnss.SIMCom)
+	defer teardownModem(mms)
+	assert.Equal(t, gnss.ErrUnsupported, s.SetDR(true))
+}
+
+func TestDRCalibrationStatus(t *testing.T) {
+	patterns := []struct {
+		name  string
+		rsp   []string
+		state gnss.DRCalibration
+		err   error
+	}{
+		{"calibrated", []string{"+QDRCFG: \"calibstatus\",2\r\n", "OK\r\n"}, gnss.DRCalibrated, nil},
+		{"calibrating", []string{"+QDRCFG: \"calibstatus\",1\r\n", "OK\r\n"}, gnss.DRCalibrating, nil},
+		{"bad state", []string{"+QDRCFG: \"calibstatus\",7\r\n", "OK\r\n"}, gnss.DRUncalibrated, gnss.ErrMalformedResponse},
+		{"missing", []string{"OK\r\n"}, gnss.DRUncalibrated, gnss.ErrMalformedResponse},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{"AT+QDRCFG=\"calibstatus\"\r\n": p.rsp}
+			g, mm := setupModem(t, cmdSet, gnss.Quectel)
+			defer teardownModem(mm)
+			state, err := g.DRCalibrationStatus()
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.state, state)
+		}
+		t.Run(p.name, f)
+	}
+	assert.Equal(t, "calibrated", gnss.DRCalibrated.String())
+	assert.Equal(t, "unknown", gnss.DRCalibration(42).String())
+}
+
+func TestDRFix(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QGPSLOC=2\r\n": {"+QGPSLOC: 061951.000,31.16484,121.62689,0.7,24.4,6,0.00,0.0,0.0,110513,09\r\n", "OK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet, gnss.Quectel)
+	defer teardownModem(mm)
+	f, err := g.GNSSFix()
+	assert.Nil(t, err)
+	assert.Equal(t, gnss.SourceDR, f.Source)
+	assert.Equal(t, "DR", f.Source.String())
+}
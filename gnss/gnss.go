@@ -0,0 +1,402 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package gnss provides the position of the modem, from its embedded GNSS
+// receiver, or from cell based location services, such as Quectel
+// QuecLocator or SIMCom +CLBS.
+//
+// The GNSS and location commands are vendor specific, so the Dialect of the
+// modem must be provided.
+package gnss
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// Dialect identifies the vendor specific GNSS command set supported by the
+// modem.
+type Dialect int
+
+const (
+	// Quectel modems, using +QGPS, +QGPSLOC and +QCELLLOC.
+	Quectel Dialect = iota
+
+	// SIMCom modems, using +CGNSPWR, +CGNSINF and +CLBS.
+	SIMCom
+)
+
+// Source identifies the source of a fix.
+type Source int
+
+const (
+	// SourceGNSS indicates the fix was provided by the GNSS receiver.
+	SourceGNSS Source = iota
+
+	// SourceCell indicates the fix was provided by a cell based location
+	// service.
+	SourceCell
+
+	// SourceDR indicates the fix was provided by dead reckoning, fusing the
+	// GNSS receiver with inertial sensors, while the GNSS fix is unavailable.
+	SourceDR
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceGNSS:
+		return "GNSS"
+	case SourceCell:
+		return "cell"
+	case SourceDR:
+		return "DR"
+	}
+	return "unknown"
+}
+
+// Fix is a position determined by the modem.
+type Fix struct {
+	// Time is the time of the fix, as reported by the GNSS receiver, or the
+	// time the fix was returned for cell based fixes.
+	Time time.Time
+
+	// Latitude is the latitude, in decimal degrees.
+	Latitude float64
+
+	// Longitude is the longitude, in decimal degrees.
+	Longitude float64
+
+	// Altitude is the altitude above mean sea level, in metres.
+	//
+	// Zero for cell based fixes.
+	Altitude float64
+
+	// Accuracy is the estimated horizontal accuracy, in metres, or zero if
+	// unknown.
+	//
+	// For GNSS fixes this is estimated from the HDOP.
+	Accuracy float64
+
+	// Satellites is the number of satellites used in a GNSS fix.
+	Satellites int
+
+	// Source is the source of the fix.
+	Source Source
+}
+
+// GNSS decorates the AT modem with the ability to determine its position.
+type GNSS struct {
+	*at.AT
+	dialect    Dialect
+	pollPeriod time.Duration
+
+	// mu protects users.
+	mu sync.Mutex
+
+	// the number of users requiring the GNSS receiver be powered.
+	users int
+
+	// streamMu protects streams and stopSource.
+	streamMu sync.Mutex
+
+	// the running streams started by StartPositionStream.
+	streams map[*PositionStream]bool
+
+	// if not-nil, stops the source of fixes for the streams.
+	stopSource func()
+}
+
+// Option is a construction option for the GNSS.
+type Option interface {
+	applyOption(*GNSS)
+}
+
+// New creates a new GNSS for the modem.
+func New(a *at.AT, dialect Dialect, options ...Option) *GNSS {
+	g := GNSS{
+		AT:         a,
+		dialect:    dialect,
+		pollPeriod: time.Second,
+		streams:    make(map[*PositionStream]bool),
+	}
+	for _, option := range options {
+		option.applyOption(&g)
+	}
+	return &g
+}
+
+type pollPeriodOption time.Duration
+
+func (o pollPeriodOption) applyOption(g *GNSS) {
+	g.pollPeriod = time.Duration(o)
+}
+
+// WithPollPeriod specifies the period between polls of the GNSS receiver
+// while waiting for a fix, or streaming fixes from modems that do not report
+// them using indications.
+//
+// The default is 1 second.
+func WithPollPeriod(d time.Duration) Option {
+	return pollPeriodOption(d)
+}
+
+// the user equivalent range error, in metres, used to estimate the accuracy
+// of GNSS fixes from the HDOP.
+const uere = 5.0
+
+// the time allowed for a cell based location service to respond, as it
+// involves a network request.
+var cellFixTimeout = 60 * time.Second
+
+// Acquire powers on the GNSS receiver, if it is not already powered, and
+// holds it powered until a matching call to Release.
+//
+// Position acquires the receiver while waiting for a fix, so the receiver
+// only needs to be acquired explicitly to keep it powered between fixes, as
+// the time to first fix is considerably shorter from a warm start.
+func (g *GNSS) Acquire() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.users == 0 {
+		if err := g.powerOn(); err != nil {
+			return err
+		}
+	}
+	g.users++
+	return nil
+}
+
+// Release releases the receiver acquired by Acquire, powering it off once it
+// is no longer required.
+func (g *GNSS) Release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.users == 0 {
+		return
+	}
+	g.users--
+	if g.users == 0 {
+		g.powerOff()
+	}
+}
+
+func (g *GNSS) powerOn() error {
+	if g.dialect == SIMCom {
+		_, err := g.Command("+CGNSPWR=1")
+		return err
+	}
+	_, err := g.Command("+QGPS=1")
+	var cme at.CMEError
+	if errors.As(err, &cme) && cme == "504" {
+		// session is ongoing - already powered
+		return nil
+	}
+	return err
+}
+
+func (g *GNSS) powerOff() {
+	if g.dialect == SIMCom {
+		g.Command("+CGNSPWR=0")
+		return
+	}
+	g.Command("+QGPSEND")
+}
+
+// GNSSFix returns the current fix from the GNSS receiver.
+//
+// The receiver must be powered, using Acquire, or the fix will fail.
+//
+// Returns ErrNoFix if the receiver does not have a fix.
+func (g *GNSS) GNSSFix(options ...at.CommandOption) (Fix, error) {
+	if g.dialect == SIMCom {
+		return g.gnssFixSIMCom(options)
+	}
+	return g.gnssFixQuectel(options)
+}
+
+// gnssFixQuectel reads the fix using +QGPSLOC, which returns:
+//
+//	+QGPSLOC: <UTC>,<lat>,<lon>,<hdop>,<alt>,<fix>,<cog>,<spkm>,<spkn>,<date>,<nsat>
+func (g *GNSS) gnssFixQuectel(options []at.CommandOption) (Fix, error) {
+	i, err := g.Command("+QGPSLOC=2", options...)
+	var cme at.CMEError
+	if errors.As(err, &cme) && cme == "516" {
+		// not fixed now
+		return Fix{}, ErrNoFix
+	}
+	if err != nil {
+		return Fix{}, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+QGPSLOC") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+QGPSLOC"))
+		if len(fields) < 11 {
+			return Fix{}, ErrMalformedResponse
+		}
+		f := Fix{Source: SourceGNSS}
+		var hdop float64
+		if f.Time, err = time.Parse("020106150405", fields[9]+fields[0]); err != nil {
+			return Fix{}, ErrMalformedResponse
+		}
+		if err = parseFloats(fields[1:5], &f.Latitude, &f.Longitude, &hdop, &f.Altitude); err != nil {
+			return Fix{}, err
+		}
+		if f.Satellites, err = strconv.Atoi(fields[10]); err != nil {
+			return Fix{}, ErrMalformedResponse
+		}
+		f.Accuracy = hdop * uere
+		if fields[5] == drFixMode {
+			f.Source = SourceDR
+		}
+		return f, nil
+	}
+	return Fix{}, ErrMalformedResponse
+}
+
+// gnssFixSIMCom reads the fix using +CGNSINF, which returns:
+//
+//	+CGNSINF: <run>,<fix>,<UTC>,<lat>,<lon>,<alt>,<speed>,<course>,<mode>,,<hdop>,<pdop>,<vdop>,,<sats view>,<sats used>,...
+func (g *GNSS) gnssFixSIMCom(options []at.CommandOption) (Fix, error) {
+	i, err := g.Command("+CGNSINF", options...)
+	if err != nil {
+		return Fix{}, err
+	}
+	for _, l := range i {
+		if info.HasPrefix(l, "+CGNSINF") {
+			return parseGNSINF(info.TrimPrefix(l, "+CGNSINF"))
+		}
+	}
+	return Fix{}, ErrMalformedResponse
+}
+
+// parseGNSINF parses the navigation information returned by +CGNSINF, and
+// reported by +UGNSINF.
+func parseGNSINF(line string) (Fix, error) {
+	fields := info.Fields(line)
+	if len(fields) < 2 || fields[1] != "1" {
+		return Fix{}, ErrNoFix
+	}
+	if len(fields) < 16 {
+		return Fix{}, ErrMalformedResponse
+	}
+	f := Fix{Source: SourceGNSS}
+	var hdop float64
+	var err error
+	if f.Time, err = time.Parse("20060102150405", fields[2]); err != nil {
+		return Fix{}, ErrMalformedResponse
+	}
+	if err = parseFloats(fields[3:6], &f.Latitude, &f.Longitude, &f.Altitude); err != nil {
+		return Fix{}, err
+	}
+	if err = parseFloats(fields[10:11], &hdop); err != nil {
+		return Fix{}, err
+	}
+	if f.Satellites, err = strconv.Atoi(fields[15]); err != nil {
+		return Fix{}, ErrMalformedResponse
+	}
+	f.Accuracy = hdop * uere
+	return f, nil
+}
+
+// CellFix returns a fix from the cell based location service of the modem.
+//
+// The service requires a data connection, and the modem may need to be
+// configured with the details of the service, such as the token for
+// QuecLocator, beforehand.
+//
+// Returns ErrNoFix if the service cannot determine the location.
+func (g *GNSS) CellFix(options ...at.CommandOption) (Fix, error) {
+	options = append([]at.CommandOption{at.WithTimeout(cellFixTimeout)}, options...)
+	if g.dialect == SIMCom {
+		return g.cellFixSIMCom(options)
+	}
+	return g.cellFixQuectel(options)
+}
+
+// cellFixQuectel reads the fix using QuecLocator, which returns:
+//
+//	+QCELLLOC: <lon>,<lat>
+func (g *GNSS) cellFixQuectel(options []at.CommandOption) (Fix, error) {
+	i, err := g.Command("+QCELLLOC=1", options...)
+	if err != nil {
+		return Fix{}, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+QCELLLOC") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+QCELLLOC"))
+		if len(fields) < 2 {
+			return Fix{}, ErrMalformedResponse
+		}
+		f := Fix{Time: time.Now(), Source: SourceCell}
+		if err = parseFloats(fields, &f.Longitude, &f.Latitude); err != nil {
+			return Fix{}, err
+		}
+		return f, nil
+	}
+	return Fix{}, ErrMalformedResponse
+}
+
+// cellFixSIMCom reads the fix using +CLBS, which returns:
+//
+//	+CLBS: <locationcode>,<lon>,<lat>,<acc>
+//
+// where a locationcode other than 0 indicates failure.
+func (g *GNSS) cellFixSIMCom(options []at.CommandOption) (Fix, error) {
+	i, err := g.Command("+CLBS=1,1", options...)
+	if err != nil {
+		return Fix{}, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CLBS") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+CLBS"))
+		if fields[0] != "0" {
+			return Fix{}, ErrNoFix
+		}
+		if len(fields) < 4 {
+			return Fix{}, ErrMalformedResponse
+		}
+		f := Fix{Time: time.Now(), Source: SourceCell}
+		if err = parseFloats(fields[1:], &f.Longitude, &f.Latitude, &f.Accuracy); err != nil {
+			return Fix{}, err
+		}
+		return f, nil
+	}
+	return Fix{}, ErrMalformedResponse
+}
+
+// parseFloats parses the leading fields into the corresponding values.
+func parseFloats(fields []string, vals ...*float64) error {
+	for n, v := range vals {
+		f, err := strconv.ParseFloat(fields[n], 64)
+		if err != nil {
+			return ErrMalformedResponse
+		}
+		*v = f
+	}
+	return nil
+}
+
+var (
+	// ErrMalformedResponse indicates the modem returned a badly formed
+	// response.
+	ErrMalformedResponse = errors.New("modem returned malformed response")
+
+	// ErrNoFix indicates no position fix is available.
+	ErrNoFix = errors.New("no position fix")
+
+	// ErrUnsupported indicates the operation is not supported by the
+	// dialect.
+	ErrUnsupported = errors.New("not supported by dialect")
+)
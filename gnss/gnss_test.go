@@ -0,0 +1,270 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gnss_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gnss"
+)
+
+const (
+	qgpsloc = "+QGPSLOC: 061951.000,31.16484,121.62689,0.7,24.4,3,0.00,0.0,0.0,110513,09\r\n"
+	cgnsinf = "+CGNSINF: 1,1,20200101120000.000,-33.8688,151.2093,58.0,0.00,0.0,1,,1.2,1.5,0.9,,12,8,,,42,,\r\n"
+)
+
+func TestGNSSFix(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect gnss.Dialect
+		cmd     string
+		rsp     []string
+		fix     gnss.Fix
+		err     error
+	}{
+		{
+			"quectel",
+			gnss.Quectel,
+			"AT+QGPSLOC=2\r\n",
+			[]string{qgpsloc, "OK\r\n"},
+			gnss.Fix{
+				Time:       time.Date(2013, 5, 11, 6, 19, 51, 0, time.UTC),
+				Latitude:   31.16484,
+				Longitude:  121.62689,
+				Altitude:   24.4,
+				Accuracy:   3.5,
+				Satellites: 9,
+			},
+			nil,
+		},
+		{
+			"quectel not fixed",
+			gnss.Quectel,
+			"AT+QGPSLOC=2\r\n",
+			[]string{"+CME ERROR: 516\r\n"},
+			gnss.Fix{},
+			gnss.ErrNoFix,
+		},
+		{
+			"quectel malformed",
+			gnss.Quectel,
+			"AT+QGPSLOC=2\r\n",
+			[]string{"+QGPSLOC: 061951.000,31.16484\r\n", "OK\r\n"},
+			gnss.Fix{},
+			gnss.ErrMalformedResponse,
+		},
+		{
+			"simcom",
+			gnss.SIMCom,
+			"AT+CGNSINF\r\n",
+			[]string{cgnsinf, "OK\r\n"},
+			gnss.Fix{
+				Time:       time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC),
+				Latitude:   -33.8688,
+				Longitude:  151.2093,
+				Altitude:   58,
+				Accuracy:   6,
+				Satellites: 8,
+			},
+			nil,
+		},
+		{
+			"simcom not fixed",
+			gnss.SIMCom,
+			"AT+CGNSINF\r\n",
+			[]string{"+CGNSINF: 1,0,,,,,,,,,,,,,,,,,,,\r\n", "OK\r\n"},
+			gnss.Fix{},
+			gnss.ErrNoFix,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, map[string][]string{p.cmd: p.rsp}, p.dialect)
+			defer teardownModem(mm)
+			fix, err := g.GNSSFix()
+			assert.Equal(t, p.err, err)
+			assert.InDelta(t, p.fix.Accuracy, fix.Accuracy, 0.001)
+			fix.Accuracy = p.fix.Accuracy
+			assert.Equal(t, p.fix, fix)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestCellFix(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect gnss.Dialect
+		cmd     string
+		rsp     []string
+		fix     gnss.Fix
+		err     error
+	}{
+		{
+			"quectel",
+			gnss.Quectel,
+			"AT+QCELLLOC=1\r\n",
+			[]string{"+QCELLLOC: 121.362548,31.221551\r\n", "OK\r\n"},
+			gnss.Fix{Latitude: 31.221551, Longitude: 121.362548, Source: gnss.SourceCell},
+			nil,
+		},
+		{
+			"simcom",
+			gnss.SIMCom,
+			"AT+CLBS=1,1\r\n",
+			[]string{"+CLBS: 0,121.354848,31.221402,550\r\n", "OK\r\n"},
+			gnss.Fix{Latitude: 31.221402, Longitude: 121.354848, Accuracy: 550, Source: gnss.SourceCell},
+			nil,
+		},
+		{
+			"simcom failed",
+			gnss.SIMCom,
+			"AT+CLBS=1,1\r\n",
+			[]string{"+CLBS: 1\r\n", "OK\r\n"},
+			gnss.Fix{},
+			gnss.ErrNoFix,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, map[string][]string{p.cmd: p.rsp}, p.dialect)
+			defer teardownModem(mm)
+			fix, err := g.CellFix()
+			assert.Equal(t, p.err, err)
+			if err == nil {
+				assert.False(t, fix.Time.IsZero())
+			}
+			fix.Time = time.Time{}
+			assert.Equal(t, p.fix, fix)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	cell := "+QCELLLOC: 121.362548,31.221551\r\n"
+	patterns := []struct {
+		name    string
+		loc     []string
+		options []gnss.PositionOption
+		source  gnss.Source
+		err     error
+	}{
+		{"gnss", []string{qgpsloc, "OK\r\n"}, nil, gnss.SourceGNSS, nil},
+		{"fallback", []string{"+CME ERROR: 516\r\n"}, nil, gnss.SourceCell, nil},
+		{
+			"insufficient gnss accuracy",
+			[]string{qgpsloc, "OK\r\n"},
+			[]gnss.PositionOption{gnss.WithAccuracy(2)},
+			gnss.SourceGNSS,
+			gnss.ErrNoFix,
+		},
+		{
+			"without fallback",
+			[]string{"+CME ERROR: 516\r\n"},
+			[]gnss.PositionOption{gnss.WithoutCellFallback},
+			gnss.SourceGNSS,
+			gnss.ErrNoFix,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{
+				"AT+QGPS=1\r\n":     {"+CME ERROR: 504\r\n"},
+				"AT+QGPSEND\r\n":    {"OK\r\n"},
+				"AT+QGPSLOC=2\r\n":  p.loc,
+				"AT+QCELLLOC=1\r\n": {cell, "OK\r\n"},
+			}
+			g, mm := setupModem(t, cmdSet, gnss.Quectel, gnss.WithPollPeriod(5*time.Millisecond))
+			defer teardownModem(mm)
+			options := append([]gnss.PositionOption{gnss.WithFixTimeout(20 * time.Millisecond)}, p.options...)
+			fix, err := g.Position(context.Background(), options...)
+			assert.Equal(t, p.err, err)
+			if err == nil {
+				assert.Equal(t, p.source, fix.Source)
+			}
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestPositionCancelled(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QGPS=1\r\n":    {"OK\r\n"},
+		"AT+QGPSEND\r\n":   {"OK\r\n"},
+		"AT+QGPSLOC=2\r\n": {"+CME ERROR: 516\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet, gnss.Quectel, gnss.WithPollPeriod(5*time.Millisecond))
+	defer teardownModem(mm)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := g.Position(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestSourceString(t *testing.T) {
+	assert.Equal(t, "GNSS", gnss.SourceGNSS.String())
+	assert.Equal(t, "cell", gnss.SourceCell.String())
+	assert.Equal(t, "unknown", gnss.Source(42).String())
+}
+
+type mockModem struct {
+	cmdSet map[string][]string
+	closed bool
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if data == nil {
+		return 0, at.ErrClosed
+	}
+	copy(p, data) // assumes p is empty
+	if !ok {
+		return len(data), fmt.Errorf("closed with data")
+	}
+	return len(data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	if mm.closed {
+		return 0, at.ErrClosed
+	}
+	v := mm.cmdSet[string(p)]
+	if len(v) == 0 {
+		mm.r <- []byte("\r\nERROR\r\n")
+	} else {
+		for _, l := range v {
+			mm.r <- []byte(l)
+		}
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) Close() error {
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
+
+func setupModem(t *testing.T, cmdSet map[string][]string, d gnss.Dialect, options ...gnss.Option) (*gnss.GNSS, *mockModem) {
+	mm := &mockModem{cmdSet: cmdSet, r: make(chan []byte, 10)}
+	g := gnss.New(at.New(mm), d, options...)
+	require.NotNil(t, g)
+	return g, mm
+}
+
+func teardownModem(mm *mockModem) {
+	mm.Close()
+}
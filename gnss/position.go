@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gnss
+
+import (
+	"context"
+	"time"
+)
+
+// PositionOption is an option for Position.
+type PositionOption interface {
+	applyPositionOption(*positionConfig)
+}
+
+type positionConfig struct {
+	timeout  time.Duration
+	accuracy float64
+	cell     bool
+}
+
+type fixTimeoutOption time.Duration
+
+func (o fixTimeoutOption) applyPositionOption(c *positionConfig) {
+	c.timeout = time.Duration(o)
+}
+
+// WithFixTimeout specifies the time allowed for the GNSS receiver to obtain
+// a fix before falling back to the cell based location service.
+//
+// The default is 30 seconds.
+func WithFixTimeout(d time.Duration) PositionOption {
+	return fixTimeoutOption(d)
+}
+
+type accuracyOption float64
+
+func (o accuracyOption) applyPositionOption(c *positionConfig) {
+	c.accuracy = float64(o)
+}
+
+// WithAccuracy specifies the accuracy, in metres, that a fix must meet to be
+// returned.
+//
+// GNSS fixes that do not meet the accuracy continue to be refined until the
+// fix timeout.  Cell based fixes that do not meet the accuracy, or do not
+// report their accuracy, are rejected.
+//
+// By default fixes of any accuracy are accepted.
+func WithAccuracy(metres float64) PositionOption {
+	return accuracyOption(metres)
+}
+
+type cellFallbackOption bool
+
+func (o cellFallbackOption) applyPositionOption(c *positionConfig) {
+	c.cell = bool(o)
+}
+
+// WithoutCellFallback prevents Position falling back to the cell based
+// location service if the GNSS receiver cannot obtain a fix.
+var WithoutCellFallback = cellFallbackOption(false)
+
+// Position returns the position of the modem.
+//
+// The GNSS receiver is tried first, as it is the more accurate, and is
+// polled until it obtains a fix meeting the accuracy, or the fix timeout
+// expires, after which the cell based location service is tried.  The source
+// and accuracy of the fix are returned with it.
+//
+// The receiver is powered while waiting for the fix, and powered off
+// afterwards unless it has been acquired using Acquire.
+//
+// Returns ErrNoFix if no fix meeting the accuracy could be obtained, the error
+// from the cell based location service if it fails, or the error from the
+// context if it is done first.
+func (g *GNSS) Position(ctx context.Context, options ...PositionOption) (Fix, error) {
+	cfg := positionConfig{
+		timeout: 30 * time.Second,
+		cell:    true,
+	}
+	for _, option := range options {
+		option.applyPositionOption(&cfg)
+	}
+	f, err := g.waitGNSSFix(ctx, cfg)
+	if err == nil {
+		return f, nil
+	}
+	if ctx.Err() != nil {
+		return Fix{}, ctx.Err()
+	}
+	if !cfg.cell {
+		return Fix{}, err
+	}
+	f, err = g.CellFix()
+	if err != nil {
+		return Fix{}, err
+	}
+	if !cfg.accepts(f) {
+		return Fix{}, ErrNoFix
+	}
+	return f, nil
+}
+
+// accepts returns true if the fix meets the required accuracy.
+func (c positionConfig) accepts(f Fix) bool {
+	if c.accuracy <= 0 {
+		return true
+	}
+	return f.Accuracy > 0 && f.Accuracy <= c.accuracy
+}
+
+// waitGNSSFix polls the GNSS receiver until it obtains a fix meeting the
+// accuracy or the timeout expires.
+func (g *GNSS) waitGNSSFix(ctx context.Context, cfg positionConfig) (Fix, error) {
+	if err := g.Acquire(); err != nil {
+		return Fix{}, ErrNoFix
+	}
+	defer g.Release()
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	defer cancel()
+	t := time.NewTicker(g.pollPeriod)
+	defer t.Stop()
+	for {
+		f, err := g.GNSSFix()
+		if err == nil && cfg.accepts(f) {
+			return f, nil
+		}
+		select {
+		case <-ctx.Done():
+			return Fix{}, ErrNoFix
+		case <-t.C:
+		}
+	}
+}
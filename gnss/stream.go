@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gnss
+
+import (
+	"time"
+
+	"github.com/warthog618/modem/info"
+)
+
+// PositionStream delivers GNSS fixes, as started by StartPositionStream.
+type PositionStream struct {
+	// C receives the fixes.
+	//
+	// The channel is closed by Stop.
+	C <-chan Fix
+
+	g           *GNSS
+	c           chan Fix
+	rate        time.Duration
+	minAccuracy float64
+
+	// the time the most recent fix was delivered.
+	//
+	// Protected by g.streamMu.
+	last time.Time
+}
+
+// StartPositionStream starts delivering fixes from the GNSS receiver on the
+// channel of the returned stream, at most once per rate, and only those with
+// an accuracy of minAccuracy metres or better.  A rate of zero delivers every
+// fix, and a minAccuracy of zero delivers fixes of any accuracy.
+//
+// Fixes are streamed from the modem using indications where the modem
+// supports them, such as +UGNSINF for SIMCom, else the receiver is polled at
+// the poll period.  The source is shared by all streams.
+//
+// The receiver is powered while any stream is running, and powered off once
+// the last is stopped, unless it has been acquired using Acquire.
+//
+// The channel is buffered for a single fix, and fixes are dropped rather than
+// blocking if it is full, so a slow reader receives the most timely fixes
+// available.
+func (g *GNSS) StartPositionStream(rate time.Duration, minAccuracy float64) (*PositionStream, error) {
+	c := make(chan Fix, 1)
+	s := PositionStream{
+		C:           c,
+		g:           g,
+		c:           c,
+		rate:        rate,
+		minAccuracy: minAccuracy,
+	}
+	g.streamMu.Lock()
+	defer g.streamMu.Unlock()
+	if len(g.streams) == 0 {
+		if err := g.Acquire(); err != nil {
+			return nil, err
+		}
+		g.stopSource = g.startSource()
+	}
+	g.streams[&s] = true
+	return &s, nil
+}
+
+// Stop stops the stream, and closes its channel.
+//
+// Once the last stream is stopped the source of fixes is stopped and the
+// receiver released.
+func (s *PositionStream) Stop() {
+	g := s.g
+	g.streamMu.Lock()
+	defer g.streamMu.Unlock()
+	if !g.streams[s] {
+		return
+	}
+	delete(g.streams, s)
+	close(s.c)
+	if len(g.streams) == 0 {
+		g.stopSource()
+		g.stopSource = nil
+		g.Release()
+	}
+}
+
+// startSource starts the shared source of fixes, preferring indications, and
+// returns the function to stop it.
+func (g *GNSS) startSource() func() {
+	if g.dialect == SIMCom {
+		if stop := g.startURC(); stop != nil {
+			return stop
+		}
+	}
+	done := make(chan struct{})
+	go g.poll(done)
+	return func() {
+		close(done)
+	}
+}
+
+// startURC enables the periodic reporting of the navigation information by
+// SIMCom modems, returning nil if it is not supported.
+func (g *GNSS) startURC() func() {
+	handler := func(i []string) {
+		if f, err := parseGNSINF(info.TrimPrefix(i[0], "+UGNSINF")); err == nil {
+			g.publish(f)
+		}
+	}
+	if g.AddIndication("+UGNSINF:", handler) != nil {
+		return nil
+	}
+	// report every fix
+	if _, err := g.Command("+CGNSURC=1"); err != nil {
+		g.CancelIndication("+UGNSINF:")
+		return nil
+	}
+	return func() {
+		g.Command("+CGNSURC=0")
+		g.CancelIndication("+UGNSINF:")
+	}
+}
+
+// poll polls the receiver for fixes until done is closed or the modem closes.
+func (g *GNSS) poll(done <-chan struct{}) {
+	t := time.NewTicker(g.pollPeriod)
+	defer t.Stop()
+	for {
+		if f, err := g.GNSSFix(); err == nil {
+			g.publish(f)
+		}
+		select {
+		case <-done:
+			return
+		case <-g.Closed():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// publish delivers the fix to the streams it satisfies.
+func (g *GNSS) publish(f Fix) {
+	now := time.Now()
+	g.streamMu.Lock()
+	defer g.streamMu.Unlock()
+	for s := range g.streams {
+		if s.minAccuracy > 0 && (f.Accuracy <= 0 || f.Accuracy > s.minAccuracy) {
+			continue
+		}
+		if !s.last.IsZero() && now.Sub(s.last) < s.rate {
+			continue
+		}
+		select {
+		case s.c <- f:
+			s.last = now
+		default:
+		}
+	}
+}
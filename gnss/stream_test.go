@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gnss_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gnss"
+)
+
+func TestStartPositionStreamPoll(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QGPS=1\r\n":    {"OK\r\n"},
+		"AT+QGPSEND\r\n":   {"OK\r\n"},
+		"AT+QGPSLOC=2\r\n": {qgpsloc, "OK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet, gnss.Quectel, gnss.WithPollPeriod(5*time.Millisecond))
+	defer teardownModem(mm)
+
+	all, err := g.StartPositionStream(0, 0)
+	require.Nil(t, err)
+	slow, err := g.StartPositionStream(time.Hour, 0)
+	require.Nil(t, err)
+	accurate, err := g.StartPositionStream(0, 2)
+	require.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case f := <-all.C:
+			assert.Equal(t, gnss.SourceGNSS, f.Source)
+			assert.Equal(t, 9, f.Satellites)
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("no fix received")
+		}
+	}
+	// rate limited to the first fix
+	select {
+	case <-slow.C:
+	default:
+		t.Error("no fix received")
+	}
+	select {
+	case f := <-slow.C:
+		t.Errorf("unexpected fix: %v", f)
+	default:
+	}
+	// filtered by accuracy
+	select {
+	case f := <-accurate.C:
+		t.Errorf("unexpected fix: %v", f)
+	default:
+	}
+
+	all.Stop()
+	slow.Stop()
+	accurate.Stop()
+	// stopping twice is harmless
+	accurate.Stop()
+	for range all.C {
+	}
+	_, ok := <-accurate.C
+	assert.False(t, ok)
+}
+
+func TestStartPositionStreamURC(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CGNSPWR=1\r\n": {"OK\r\n"},
+		"AT+CGNSPWR=0\r\n": {"OK\r\n"},
+		"AT+CGNSURC=1\r\n": {"OK\r\n"},
+		"AT+CGNSURC=0\r\n": {"OK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet, gnss.SIMCom)
+	defer teardownModem(mm)
+
+	s, err := g.StartPositionStream(0, 0)
+	require.Nil(t, err)
+	defer s.Stop()
+
+	mm.r <- []byte(strings.Replace(cgnsinf, "+CGNSINF", "+UGNSINF", 1))
+	select {
+	case f := <-s.C:
+		assert.Equal(t, -33.8688, f.Latitude)
+		assert.Equal(t, 151.2093, f.Longitude)
+		assert.Equal(t, 8, f.Satellites)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no fix received")
+	}
+}
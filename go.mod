@@ -1,11 +1,12 @@
 module github.com/warthog618/modem
 
 require (
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.4.0
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
 	github.com/warthog618/sms v0.3.0
-	golang.org/x/sys v0.0.0-20200413165638-669c56c373c4 // indirect
+	golang.org/x/sys v0.0.0-20200413165638-669c56c373c4
 )
 
 go 1.13
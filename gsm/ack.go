@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// AckStatus is the outcome of acknowledging a received message to the
+// network.
+type AckStatus int
+
+const (
+	// AckNotRequired indicates the message did not require acknowledgement,
+	// as the modem acknowledges messages itself, or the message was read
+	// from storage.
+	AckNotRequired AckStatus = iota
+
+	// Acked indicates the message was acknowledged using +CNMA.
+	Acked
+
+	// AckFailed indicates the modem rejected the +CNMA, so the network may
+	// redeliver the message.
+	AckFailed
+)
+
+func (s AckStatus) String() string {
+	switch s {
+	case AckNotRequired:
+		return "not required"
+	case Acked:
+		return "acked"
+	case AckFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+type ackFailureThresholdOption int
+
+func (o ackFailureThresholdOption) applyRxOption(c *rxConfig) {
+	c.ackThreshold = int(o)
+}
+
+// WithAckFailureThreshold specifies the number of consecutive +CNMA failures
+// after which the modem is switched to storing received messages and
+// indicating them with +CMTI, which does not require acknowledgement.
+// Messages indicated after the switch are deleted from storage once
+// dispatched, as per WithCMTI.
+//
+// The default is 3.  A threshold of 0 disables the fallback.
+func WithAckFailureThreshold(n int) RxOption {
+	return ackFailureThresholdOption(n)
+}
+
+// acker acknowledges messages received via +CMT, falling back to +CMTI if
+// the acknowledgements persistently fail.
+type acker struct {
+	g         *GSM
+	threshold int
+
+	mu sync.Mutex
+
+	// whether status reports forwarded via +CDS require acknowledgement,
+	// which is unaffected by the fallback.
+	reportsRequired bool
+
+	cnmi     string
+	required bool
+	failures int
+
+	// whether the modem has been switched to +CMTI by the fallback.
+	fellBack bool
+}
+
+// ack acknowledges a received TPDU, if required.
+//
+// Returns ErrAckFallback if the acknowledgement failed and the modem has been
+// switched to +CMTI as a result.
+func (a *acker) ack() (AckStatus, error) {
+	a.mu.Lock()
+	required := a.required
+	a.mu.Unlock()
+	if !required {
+		return AckNotRequired, nil
+	}
+	_, err := a.g.optionalCommand("+CNMA")
+	a.mu.Lock()
+	if err == nil {
+		a.failures = 0
+		a.mu.Unlock()
+		return Acked, nil
+	}
+	a.failures++
+	fallback := a.required && a.threshold > 0 && a.failures >= a.threshold
+	if fallback {
+		a.required = false
+	}
+	cnmi := a.cnmi
+	a.mu.Unlock()
+	if !fallback {
+		return AckFailed, nil
+	}
+	if _, cerr := a.g.Command(cnmiWithoutAck(cnmi)); cerr != nil {
+		// try again after another threshold of failures.
+		a.mu.Lock()
+		a.required = true
+		a.failures = 0
+		a.mu.Unlock()
+		return AckFailed, nil
+	}
+	a.mu.Lock()
+	a.fellBack = true
+	a.mu.Unlock()
+	return AckFailed, ErrAckFallback{err}
+}
+
+// fallenBack returns true if the modem has been switched to +CMTI by the
+// fallback, so received messages are now held in storage.
+func (a *acker) fallenBack() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.fellBack
+}
+
+// ackReport acknowledges a received status report, if required.
+//
+// Failures are not counted towards the fallback to +CMTI, as that only
+// alters the forwarding of SMS-DELIVERs, not status reports.
+func (a *acker) ackReport() AckStatus {
+	a.mu.Lock()
+	required := a.reportsRequired
+	a.mu.Unlock()
+	if !required {
+		return AckNotRequired
+	}
+	if _, err := a.g.optionalCommand("+CNMA"); err != nil {
+		return AckFailed
+	}
+	return Acked
+}
+
+// cnmiWithoutAck returns the +CNMI command with the SMS-DELIVER mode changed
+// to store messages and indicate them with +CMTI.
+func cnmiWithoutAck(cmd string) string {
+	fields := strings.Split(strings.TrimPrefix(cmd, "+CNMI="), ",")
+	if !strings.HasPrefix(cmd, "+CNMI=") || len(fields) < 2 {
+		return "+CNMI=1,1,0,0,0"
+	}
+	fields[1] = "1"
+	return "+CNMI=" + strings.Join(fields, ",")
+}
+
+// ErrAckFallback indicates that acknowledging received messages persistently
+// failed, so the modem has been switched to storing received messages and
+// indicating them with +CMTI, which does not require acknowledgement.
+type ErrAckFallback struct {
+	// Err is the error returned by the most recent +CNMA.
+	Err error
+}
+
+func (e ErrAckFallback) Error() string {
+	return fmt.Sprintf("switched to +CMTI after +CNMA failed: %s", e.Err)
+}
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestMessageAck(t *testing.T) {
+	cmt := "+CMT: ,24\r\n00040B911234567890F000000250100173832305C8329BFD06\r\n"
+	patterns := []struct {
+		name    string
+		cmdSet  map[string][]string
+		options []gsm.RxOption
+		acks    []gsm.AckStatus
+		cnmi    string
+	}{
+		{
+			"acked",
+			map[string][]string{
+				"AT+CNMA\r\n": {"\r\nOK\r\n"},
+			},
+			nil,
+			[]gsm.AckStatus{gsm.Acked, gsm.Acked, gsm.Acked},
+			"",
+		},
+		{
+			"not required",
+			map[string][]string{
+				"AT+CSMS?\r\n": {"+CSMS: 0,1,1,1\r\n", "OK\r\n"},
+			},
+			nil,
+			[]gsm.AckStatus{gsm.AckNotRequired, gsm.AckNotRequired},
+			"",
+		},
+		{
+			"fallback",
+			map[string][]string{
+				"AT+CNMA\r\n":           {"+CMS ERROR: 340\r\n"},
+				"AT+CNMI=1,1,0,0,0\r\n": {"\r\nOK\r\n"},
+			},
+			[]gsm.RxOption{gsm.WithAckFailureThreshold(2)},
+			[]gsm.AckStatus{gsm.AckFailed, gsm.AckFailed, gsm.AckNotRequired},
+			"AT+CNMI=1,1,0,0,0\r\n",
+		},
+		{
+			"fallback custom cnmi",
+			map[string][]string{
+				"AT+CNMA\r\n":           {"+CMS ERROR: 340\r\n"},
+				"AT+CNMI=2,2,0,1,0\r\n": {"\r\nOK\r\n"},
+				"AT+CNMI=2,1,0,1,0\r\n": {"\r\nOK\r\n"},
+			},
+			[]gsm.RxOption{gsm.WithInitialCommand("+CNMI=2,2,0,1,0")},
+			[]gsm.AckStatus{gsm.AckFailed, gsm.AckFailed, gsm.AckFailed, gsm.AckNotRequired},
+			"AT+CNMI=2,1,0,1,0\r\n",
+		},
+		{
+			"fallback disabled",
+			map[string][]string{
+				"AT+CNMA\r\n": {"+CMS ERROR: 340\r\n"},
+			},
+			[]gsm.RxOption{gsm.WithAckFailureThreshold(0)},
+			[]gsm.AckStatus{gsm.AckFailed, gsm.AckFailed, gsm.AckFailed, gsm.AckFailed},
+			"",
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			if _, ok := p.cmdSet["AT+CNMI=2,2,0,1,0\r\n"]; !ok {
+				p.cmdSet["AT+CNMI=1,2,0,0,0\r\n"] = []string{"\r\nOK\r\n"}
+			}
+			g, mm := setupModem(t, p.cmdSet)
+			defer teardownModem(mm)
+
+			msgChan := make(chan gsm.Message, 5)
+			errChan := make(chan error, 5)
+			err := g.StartMessageRx(
+				func(msg gsm.Message) { msgChan <- msg },
+				func(err error) { errChan <- err },
+				p.options...)
+			require.Nil(t, err)
+			for _, ack := range p.acks {
+				mm.r <- []byte(cmt)
+				select {
+				case msg := <-msgChan:
+					assert.Equal(t, ack, msg.Ack)
+				case <-time.After(100 * time.Millisecond):
+					t.Fatal("no message received")
+				}
+			}
+			if p.cnmi == "" {
+				assert.Empty(t, errChan)
+				return
+			}
+			select {
+			case err := <-errChan:
+				assert.Equal(t, gsm.ErrAckFallback{Err: at.CMSError("340")}, err)
+			default:
+				t.Error("no fallback error")
+			}
+			assert.Contains(t, mm.written(), p.cnmi)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestAckFallbackDeletes(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"+CMS ERROR: 340\r\n"},
+		"AT+CNMI=1,1,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CMGR=2\r\n": {
+			"+CMGR: 0,,24\r\n",
+			"00040B911234567890F000000250100173832305C8329BFD06\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGD=2\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 5)
+	errChan := make(chan error, 5)
+	err := g.StartMessageRx(
+		func(msg gsm.Message) { msgChan <- msg },
+		func(err error) { errChan <- err },
+		gsm.WithAckFailureThreshold(1))
+	require.Nil(t, err)
+	defer g.StopMessageRx()
+
+	mm.r <- []byte("+CMT: ,24\r\n00040B911234567890F000000250100173832305C8329BFD06\r\n")
+	select {
+	case <-msgChan:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	select {
+	case err := <-errChan:
+		assert.Equal(t, gsm.ErrAckFallback{Err: at.CMSError("340")}, err)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no fallback error")
+	}
+
+	// messages now indicated via +CMTI are deleted once dispatched.
+	mm.r <- []byte("+CMTI: \"SM\",2\r\n")
+	select {
+	case msg := <-msgChan:
+		assert.Equal(t, gsm.AckNotRequired, msg.Ack)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	deleted := false
+	for i := 0; i < 100 && !deleted; i++ {
+		for _, c := range mm.written() {
+			if c == "AT+CMGD=2\r\n" {
+				deleted = true
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, deleted)
+	assert.Empty(t, errChan)
+}
+
+func TestStatusReportAck(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMA\r\n":           {"+CMS ERROR: 340\r\n"},
+		"AT+CNMI=1,2,0,1,0\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	srChan := make(chan gsm.StatusReport, 5)
+	errChan := make(chan error, 5)
+	err := g.StartMessageRx(
+		func(gsm.Message) {},
+		func(err error) { errChan <- err },
+		gsm.WithStatusReports(func(sr gsm.StatusReport) { srChan <- sr }),
+		gsm.WithAckFailureThreshold(2))
+	require.Nil(t, err)
+	defer g.StopMessageRx()
+
+	cds := "+CDS: 21\r\n00022a04912143021020304050000210203050500000\r\n"
+	for i := 0; i < 3; i++ {
+		mm.r <- []byte(cds)
+		select {
+		case <-srChan:
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("no status report received")
+		}
+	}
+	// failed report acks do not count towards the fallback.
+	assert.Empty(t, errChan)
+	assert.NotContains(t, mm.written(), "AT+CNMI=1,1,0,1,0\r\n")
+	acks := 0
+	for _, cmd := range mm.written() {
+		if cmd == "AT+CNMA\r\n" {
+			acks++
+		}
+	}
+	assert.Equal(t, 3, acks)
+}
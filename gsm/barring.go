@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// BarringFacility identifies a call barring facility, as per +CLCK.
+type BarringFacility string
+
+const (
+	// BarAllOutgoing bars all outgoing calls.
+	BarAllOutgoing BarringFacility = "AO"
+
+	// BarOutgoingInternational bars outgoing international calls.
+	BarOutgoingInternational BarringFacility = "OI"
+
+	// BarOutgoingInternationalExHome bars outgoing international calls,
+	// except to the home country.
+	BarOutgoingInternationalExHome BarringFacility = "OX"
+
+	// BarAllIncoming bars all incoming calls.
+	BarAllIncoming BarringFacility = "AI"
+
+	// BarIncomingRoaming bars incoming calls when roaming outside the home
+	// country.
+	BarIncomingRoaming BarringFacility = "IR"
+
+	// AllBarring refers to all barring services, and is only valid for
+	// disabling barring and changing the barring password.
+	AllBarring BarringFacility = "AB"
+
+	// AllOutgoingBarring refers to all outgoing barring services, and is only
+	// valid for disabling barring.
+	AllOutgoingBarring BarringFacility = "AG"
+
+	// AllIncomingBarring refers to all incoming barring services, and is only
+	// valid for disabling barring.
+	AllIncomingBarring BarringFacility = "AC"
+)
+
+// SetCallBarring enables or disables the call barring facility, using the
+// network barring password.
+func (g *GSM) SetCallBarring(fac BarringFacility, enable bool, password string, options ...at.CommandOption) error {
+	mode := 0
+	if enable {
+		mode = 1
+	}
+	_, err := g.Command(fmt.Sprintf("+CLCK=\"%s\",%d,\"%s\"", fac, mode, password), options...)
+	return err
+}
+
+// CallBarring returns true if the call barring facility is enabled for any
+// class of service.
+func (g *GSM) CallBarring(fac BarringFacility, options ...at.CommandOption) (bool, error) {
+	i, err := g.Command(fmt.Sprintf("+CLCK=\"%s\",2", fac), options...)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CLCK") {
+			continue
+		}
+		found = true
+		status, err := strconv.Atoi(info.Fields(info.TrimPrefix(l, "+CLCK"))[0])
+		if err != nil {
+			return false, ErrMalformedResponse
+		}
+		if status == 1 {
+			return true, nil
+		}
+	}
+	if !found {
+		return false, ErrMalformedResponse
+	}
+	return false, nil
+}
+
+// ChangeBarringPassword changes the network call barring password, as per
+// +CPWD.
+func (g *GSM) ChangeBarringPassword(oldPassword, newPassword string, options ...at.CommandOption) error {
+	_, err := g.Command(fmt.Sprintf("+CPWD=\"%s\",\"%s\",\"%s\"", AllBarring, oldPassword, newPassword), options...)
+	return err
+}
+
+// SetClosedUserGroup enables or disables the closed user group, as per +CCUG,
+// restricting calls to members of the group with the given index.
+//
+// The index is 0-9, or 10 for the preferred group of the subscription.
+func (g *GSM) SetClosedUserGroup(enable bool, index int, options ...at.CommandOption) error {
+	n := 0
+	if enable {
+		n = 1
+	}
+	_, err := g.Command(fmt.Sprintf("+CCUG=%d,%d", n, index), options...)
+	return err
+}
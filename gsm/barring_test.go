@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestSetCallBarring(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CLCK=\"AO\",1,\"0000\"\r\n": {"OK\r\n"},
+		"AT+CLCK=\"AB\",0,\"0000\"\r\n": {"OK\r\n"},
+		"AT+CLCK=\"IR\",1,\"1111\"\r\n": {"+CME ERROR: 16\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	err := g.SetCallBarring(gsm.BarAllOutgoing, true, "0000")
+	assert.Nil(t, err)
+
+	err = g.SetCallBarring(gsm.AllBarring, false, "0000")
+	assert.Nil(t, err)
+
+	err = g.SetCallBarring(gsm.BarIncomingRoaming, true, "1111")
+	assert.Equal(t, at.CMEError("16"), err)
+}
+
+func TestCallBarring(t *testing.T) {
+	patterns := []struct {
+		name    string
+		rsp     []string
+		enabled bool
+		err     error
+	}{
+		{"enabled", []string{"+CLCK: 1,1\r\n", "OK\r\n"}, true, nil},
+		{"disabled", []string{"+CLCK: 0,7\r\n", "OK\r\n"}, false, nil},
+		{"class", []string{"+CLCK: 0,1\r\n", "+CLCK: 1,4\r\n", "OK\r\n"}, true, nil},
+		{"missing", []string{"OK\r\n"}, false, gsm.ErrMalformedResponse},
+		{"malformed", []string{"+CLCK: x\r\n", "OK\r\n"}, false, gsm.ErrMalformedResponse},
+		{"error", []string{"ERROR\r\n"}, false, at.ErrError},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, map[string][]string{"AT+CLCK=\"OI\",2\r\n": p.rsp})
+			defer teardownModem(mm)
+			enabled, err := g.CallBarring(gsm.BarOutgoingInternational)
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.enabled, enabled)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestChangeBarringPassword(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CPWD=\"AB\",\"0000\",\"1234\"\r\n": {"OK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	err := g.ChangeBarringPassword("0000", "1234")
+	assert.Nil(t, err)
+
+	err = g.ChangeBarringPassword("9999", "1234")
+	assert.Equal(t, at.ErrError, err)
+}
+
+func TestSetClosedUserGroup(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CCUG=1,3\r\n":  {"OK\r\n"},
+		"AT+CCUG=0,10\r\n": {"OK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	err := g.SetClosedUserGroup(true, 3)
+	assert.Nil(t, err)
+
+	err = g.SetClosedUserGroup(false, 10)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+//
+// Benchmarks for the performance sensitive paths through the GSM module,
+// driven by a scripted modem so they exercise the full stack from the AT
+// line scanner and command queue up to the message handlers.
+//
+// Profiles can be collected using:
+//
+//	go test -run XXX -bench . -benchmem -cpuprofile cpu.out -memprofile mem.out
+
+package gsm_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/at/attest"
+	"github.com/warthog618/modem/gsm"
+)
+
+const (
+	// a single part SMS-DELIVER, as per a +CMT indication.
+	benchPDU = "00040B911234567890F000000250100173832305C8329BFD06"
+
+	// the number of messages returned by the bulk +CMGL.
+	benchListSize = 100
+)
+
+// benchBaselines are the maximum allocations per operation allowed for each
+// benchmark, as guarded by TestBenchmarkBaselines.
+//
+// Allocations vary with the Go version and the race detector, so the check
+// is only run if MODEM_BENCH_BASELINES is set, as it is by CI and make check,
+// e.g.
+//
+//	MODEM_BENCH_BASELINES=1 go test -run BenchmarkBaselines
+//
+// The baselines are set roughly 25% above the measured allocations, noted
+// alongside, to allow for variation between Go versions, so a failure
+// indicates a significant regression, or that a redesign has improved the
+// path and the baseline should be lowered to suit.
+//
+// Timings are too dependent on the host to be guarded, but for reference the
+// measured timings on a 4 core x86_64 are ReceiveURC 13us/op, ListPDUs
+// 0.8ms/op (for 100 messages), and SendConcurrent 20us/op.
+var benchBaselines = []struct {
+	name   string
+	bench  func(*testing.B)
+	allocs int64
+}{
+	{"ReceiveURC", BenchmarkReceiveURC, 44},         // 35
+	{"ListPDUs", BenchmarkListPDUs, 1900},           // 1528
+	{"SendConcurrent", BenchmarkSendConcurrent, 70}, // 56
+}
+
+func TestBenchmarkBaselines(t *testing.T) {
+	if os.Getenv("MODEM_BENCH_BASELINES") == "" {
+		t.Skip("set MODEM_BENCH_BASELINES to check the benchmark baselines")
+	}
+	for _, bl := range benchBaselines {
+		bl := bl
+		t.Run(bl.name, func(t *testing.T) {
+			r := testing.Benchmark(bl.bench)
+			if r.N == 0 {
+				t.Fatal("benchmark failed")
+			}
+			t.Logf("%s %s", r, r.MemString())
+			if allocs := r.AllocsPerOp(); allocs > bl.allocs {
+				t.Errorf("allocs/op %d exceeds baseline %d", allocs, bl.allocs)
+			}
+		})
+	}
+}
+
+// setupBenchModem creates a GSM driving a scripted modem that responds to
+// the commands issued by Init and StartMessageRx, and to any additional
+// rules.
+func setupBenchModem(b *testing.B, rules ...attest.Option) (*gsm.GSM, *attest.Modem) {
+	rules = append(rules,
+		attest.WithResponse("AT+GCAP", "+GCAP: +CGSM", "OK"),
+		attest.WithResponse("AT+CSMS?", "+CSMS: 0,1,1,1", "OK"),
+		attest.WithResponse("AT*", "OK"))
+	m := attest.New(rules...)
+	g := gsm.New(at.New(m))
+	if err := g.Init(); err != nil {
+		m.Close()
+		b.Fatalf("init failed: %v", err)
+	}
+	return g, m
+}
+
+// BenchmarkReceiveURC measures the reception of single part messages via
+// +CMT indications.
+func BenchmarkReceiveURC(b *testing.B) {
+	g, m := setupBenchModem(b)
+	defer m.Close()
+	msgs := make(chan gsm.Message, 1)
+	mh := func(msg gsm.Message) {
+		msgs <- msg
+	}
+	eh := func(err error) {
+		b.Errorf("rx error: %v", err)
+	}
+	if err := g.StartMessageRx(mh, eh); err != nil {
+		b.Fatalf("start rx failed: %v", err)
+	}
+	cmt := fmt.Sprintf("+CMT: ,%d", len(benchPDU)/2-1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		m.Indicate(cmt, benchPDU)
+		<-msgs
+	}
+}
+
+// BenchmarkListPDUs measures the parsing of a bulk +CMGL response.
+func BenchmarkListPDUs(b *testing.B) {
+	rsp := make([]string, 0, 2*benchListSize+1)
+	for n := 0; n < benchListSize; n++ {
+		rsp = append(rsp, fmt.Sprintf("+CMGL: %d,1,,%d", n, len(benchPDU)/2-1), benchPDU)
+	}
+	rsp = append(rsp, "OK")
+	g, m := setupBenchModem(b, attest.WithResponse("AT+CMGL=4", rsp...))
+	defer m.Close()
+	count := 0
+	ph := func(sp gsm.StoredPDU) {
+		count++
+	}
+	eh := func(err error) {
+		b.Errorf("list error: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := g.ListPDUs(gsm.AllMessages, ph, eh); err != nil {
+			b.Fatalf("list failed: %v", err)
+		}
+	}
+	b.StopTimer()
+	if count != b.N*benchListSize {
+		b.Errorf("listed %d messages, expected %d", count, b.N*benchListSize)
+	}
+}
+
+// BenchmarkSendConcurrent measures sending single part messages from
+// concurrent goroutines.
+func BenchmarkSendConcurrent(b *testing.B) {
+	g, m := setupBenchModem(b,
+		attest.WithResponse("AT+CMGS=*", ">"),
+		attest.WithResponse("00*", "+CMGS: 42", "OK"))
+	defer m.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := g.SendShortMessage("+12345", "hello"); err != nil {
+				b.Errorf("send failed: %v", err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/at"
+)
+
+// CircuitBreakerChanged is published to the EventBus provided to New when the
+// circuit breaker enabled by WithCircuitBreaker opens or closes.
+type CircuitBreakerChanged struct {
+	// Open is true if the breaker opened, and false if it closed.
+	Open bool
+
+	// Err is the send error that opened the breaker.
+	//
+	// It is nil when the breaker closes.
+	Err error
+}
+
+// circuitBreaker pauses sends while the modem is persistently failing them.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	steps     []RecoveryStep
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	// whether the breaker is half-open, allowing a trial send after recovery.
+	trial  bool
+	opened time.Time
+	level  int
+}
+
+// the probes run to confirm the modem has recovered before a trial send.
+var breakerProbes = []Probe{ATProbe, SIMProbe, RegistrationProbe}
+
+type circuitBreakerOption struct {
+	threshold int
+	cooldown  time.Duration
+	steps     []RecoveryStep
+}
+
+func (o circuitBreakerOption) applyOption(g *GSM) {
+	b := circuitBreaker{
+		threshold: o.threshold,
+		cooldown:  o.cooldown,
+		steps:     o.steps,
+	}
+	if len(b.steps) == 0 {
+		b.steps = []RecoveryStep{ReinitStep, CFUNCycleStep}
+	}
+	if b.threshold < 1 {
+		b.threshold = 1
+	}
+	g.breaker = &b
+}
+
+// WithCircuitBreaker adds a circuit breaker to the send path that opens after
+// threshold consecutive sends fail with CMS error 500, unknown error, which
+// indicates the modem is wedged rather than that the message or network is at
+// fault.
+//
+// While the breaker is open sends fail immediately with ErrCircuitOpen, so a
+// retry queue is not consumed by a modem that cannot send.  Once the cooldown
+// has elapsed the next send takes the next step of the recovery ladder, then
+// runs a health check and, if healthy, attempts the send as a trial.  The
+// breaker closes if the trial succeeds, or fails with any other error, as the
+// modem has then handled the send, and re-opens, escalating the ladder, if it
+// fails with CMS error 500.  Recovery is performed by the send that triggers
+// it, so that send may take considerably longer than usual.
+//
+// The steps default to ReinitStep followed by CFUNCycleStep.  Steps taken are
+// published to the EventBus as RecoveryAttempted, and the breaker opening and
+// closing as CircuitBreakerChanged.  A failed trial does not change the state,
+// so is not published as CircuitBreakerChanged.
+func WithCircuitBreaker(threshold int, cooldown time.Duration, steps ...RecoveryStep) Option {
+	return circuitBreakerOption{threshold, cooldown, steps}
+}
+
+// sendCommand issues a send command to the modem, subject to the circuit
+// breaker, if enabled.
+//
+// Must be called with sendMu held.
+func (g *GSM) sendCommand(cmd, data string, options ...at.CommandOption) ([]string, error) {
+	if err := g.breakerAllow(); err != nil {
+		return nil, err
+	}
+	i, err := g.SMSCommand(cmd, data, options...)
+	g.breakerReport(err)
+	return i, err
+}
+
+// breakerAllow returns nil if a send may proceed, attempting recovery if the
+// breaker is open and the cooldown has elapsed.
+func (g *GSM) breakerAllow() error {
+	b := g.breaker
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if !b.open || b.trial {
+		b.mu.Unlock()
+		return nil
+	}
+	if time.Since(b.opened) < b.cooldown {
+		b.mu.Unlock()
+		return ErrCircuitOpen
+	}
+	level := b.level
+	if level >= len(b.steps) {
+		// stay on the last rung
+		level = len(b.steps) - 1
+	}
+	b.level = level + 1
+	b.mu.Unlock()
+
+	step := b.steps[level]
+	serr := step.Action(g)
+	if g.bus != nil {
+		g.bus.Publish(RecoveryAttempted{Step: step.Name, Level: level, Err: serr})
+	}
+	healthy := serr == nil &&
+		g.HealthCheck(context.Background(), breakerProbes...).Healthy()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !healthy {
+		b.opened = time.Now()
+		return ErrCircuitOpen
+	}
+	b.trial = true
+	return nil
+}
+
+// breakerReport reports the outcome of a send to the breaker.
+func (g *GSM) breakerReport(err error) {
+	b := g.breaker
+	if b == nil {
+		return
+	}
+	wedged := isWedged(err)
+	b.mu.Lock()
+	if b.trial {
+		// the trial is over, so the breaker either closes, as the modem
+		// handled the send, or re-opens with a fresh cooldown.
+		b.trial = false
+		b.failures = 0
+		if wedged {
+			b.opened = time.Now()
+		} else {
+			b.open = false
+			b.level = 0
+		}
+		b.mu.Unlock()
+		// the breaker remains open if the trial failed, so only closing
+		// is a change of state.
+		if !wedged && g.bus != nil {
+			g.bus.Publish(CircuitBreakerChanged{})
+		}
+		return
+	}
+	if !wedged {
+		b.failures = 0
+		b.mu.Unlock()
+		return
+	}
+	b.failures++
+	if b.open || b.failures < b.threshold {
+		b.mu.Unlock()
+		return
+	}
+	b.open = true
+	b.failures = 0
+	b.opened = time.Now()
+	b.mu.Unlock()
+	if g.bus != nil {
+		g.bus.Publish(CircuitBreakerChanged{Open: true, Err: err})
+	}
+}
+
+// isWedged returns true if the error indicates the modem is unable to send,
+// rather than a problem with the message or network.
+//
+// That is CMS error 500, in either numeric or textual form.
+func isWedged(err error) bool {
+	var cms at.CMSError
+	if !errors.As(err, &cms) {
+		return false
+	}
+	code, ok := cms.Code()
+	return ok && code == "500"
+}
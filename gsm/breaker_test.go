@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestWithCircuitBreaker(t *testing.T) {
+	tp, _ := hex.DecodeString("0101099121436587f900000cf4f29c0e6a97e7f3f0b90c")
+	pdu := "00" + hex.EncodeToString(tp) + string(rune(26))
+	cmdSet := map[string][]string{
+		"AT\r\n":       {"OK\r\n"},
+		"AT+CPIN?\r\n": {"+CPIN: READY\r\n", "OK\r\n"},
+		"AT+CREG?\r\n": {"+CREG: 0,1\r\n", "OK\r\n"},
+		"AT+CMGS=23\r": {"\n>"},
+		pdu:            {"\r\n+CMS ERROR: 500\r\n"},
+	}
+	b := gsm.NewEventBus()
+	var events []gsm.Event
+	b.Subscribe(func(e gsm.Event) {
+		events = append(events, e)
+	})
+	fixed := gsm.RecoveryStep{
+		Name: "fix",
+		Action: func(*gsm.GSM) error {
+			cmdSet[pdu] = []string{"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"}
+			return nil
+		},
+	}
+	g, mm := setupModem(t, cmdSet,
+		gsm.WithEventBus(b),
+		gsm.WithCircuitBreaker(2, 50*time.Millisecond, fixed))
+	defer teardownModem(mm)
+
+	// below threshold
+	_, err := g.SendPDU(tp)
+	assert.Equal(t, at.CMSError("500"), err)
+	assert.Empty(t, events)
+
+	// opens
+	_, err = g.SendPDU(tp)
+	assert.Equal(t, at.CMSError("500"), err)
+	require.Equal(t, []gsm.Event{
+		gsm.CircuitBreakerChanged{Open: true, Err: at.CMSError("500")},
+	}, events)
+
+	// open - fails without sending
+	n := len(mm.written())
+	_, err = g.SendPDU(tp)
+	assert.Equal(t, gsm.ErrCircuitOpen, err)
+	assert.Equal(t, n, len(mm.written()))
+
+	// recovers after cooldown and closes on a successful trial
+	time.Sleep(60 * time.Millisecond)
+	mr, err := g.SendPDU(tp)
+	assert.Nil(t, err)
+	assert.Equal(t, "42", mr)
+	assert.Equal(t, []gsm.Event{
+		gsm.CircuitBreakerChanged{Open: true, Err: at.CMSError("500")},
+		gsm.RecoveryAttempted{Step: "fix", Level: 0},
+		gsm.CircuitBreakerChanged{},
+	}, events)
+}
+
+func TestCircuitBreakerTrial(t *testing.T) {
+	tp, _ := hex.DecodeString("0101099121436587f900000cf4f29c0e6a97e7f3f0b90c")
+	pdu := "00" + hex.EncodeToString(tp) + string(rune(26))
+	cmdSet := map[string][]string{
+		"AT\r\n":       {"OK\r\n"},
+		"AT+CPIN?\r\n": {"+CPIN: READY\r\n", "OK\r\n"},
+		"AT+CREG?\r\n": {"+CREG: 0,1\r\n", "OK\r\n"},
+		"AT+CMGS=23\r": {"\n>"},
+		pdu:            {"\r\n+CMS ERROR: unknown error\r\n"},
+	}
+	b := gsm.NewEventBus()
+	var events []gsm.Event
+	b.Subscribe(func(e gsm.Event) {
+		if _, ok := e.(gsm.CircuitBreakerChanged); ok {
+			events = append(events, e)
+		}
+	})
+	g, mm := setupModem(t, cmdSet,
+		gsm.WithEventBus(b),
+		gsm.WithCircuitBreaker(1, 20*time.Millisecond, gsm.RecoveryStep{
+			Name:   "noop",
+			Action: func(*gsm.GSM) error { return nil },
+		}))
+	defer teardownModem(mm)
+
+	// textual form of CMS error 500 opens
+	wedged := at.CMSError("unknown error")
+	_, err := g.SendPDU(tp)
+	assert.Equal(t, wedged, err)
+	require.Equal(t, []gsm.Event{
+		gsm.CircuitBreakerChanged{Open: true, Err: wedged},
+	}, events)
+
+	// failed trial re-opens with a fresh cooldown
+	time.Sleep(30 * time.Millisecond)
+	_, err = g.SendPDU(tp)
+	assert.Equal(t, wedged, err)
+	_, err = g.SendPDU(tp)
+	assert.Equal(t, gsm.ErrCircuitOpen, err)
+	// still open, so no change published
+	require.Equal(t, []gsm.Event{
+		gsm.CircuitBreakerChanged{Open: true, Err: wedged},
+	}, events)
+
+	// trial failing with other errors closes
+	time.Sleep(30 * time.Millisecond)
+	cmdSet[pdu] = []string{"\r\n+CMS ERROR: 304\r\n"}
+	_, err = g.SendPDU(tp)
+	assert.Equal(t, at.CMSError("304"), err)
+	assert.Equal(t, []gsm.Event{
+		gsm.CircuitBreakerChanged{Open: true, Err: wedged},
+		gsm.CircuitBreakerChanged{},
+	}, events)
+	_, err = g.SendPDU(tp)
+	assert.Equal(t, at.CMSError("304"), err)
+
+	// re-opens once closed
+	cmdSet[pdu] = []string{"\r\n+CMS ERROR: 500\r\n"}
+	_, err = g.SendPDU(tp)
+	assert.Equal(t, at.CMSError("500"), err)
+	assert.Equal(t, []gsm.Event{
+		gsm.CircuitBreakerChanged{Open: true, Err: wedged},
+		gsm.CircuitBreakerChanged{},
+		gsm.CircuitBreakerChanged{Open: true, Err: at.CMSError("500")},
+	}, events)
+}
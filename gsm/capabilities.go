@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/warthog618/modem/at"
+)
+
+// Capabilities describes the capabilities of the modem, as discovered while
+// using it.
+type Capabilities struct {
+	// Unsupported is the set of commands the modem has reported as not
+	// supported, identified by their name, e.g. "+CNMA".
+	Unsupported map[string]bool
+}
+
+// Supports returns false if the named command, e.g. "+CNMA", has been
+// reported as not supported by the modem.
+func (c Capabilities) Supports(cmd string) bool {
+	return !c.Unsupported[cmdName(cmd)]
+}
+
+// UnsupportedCommand is published to the EventBus provided to New the first
+// time the modem reports a command as not supported.
+//
+// The command is not issued again, and the feature dependent on it is
+// disabled.
+type UnsupportedCommand struct {
+	// Cmd is the name of the command, e.g. "+CNMA".
+	Cmd string
+
+	// Err is the error returned by the modem.
+	Err error
+}
+
+// Capabilities returns the capabilities of the modem discovered so far.
+func (g *GSM) Capabilities() Capabilities {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c := Capabilities{Unsupported: make(map[string]bool, len(g.unsupported))}
+	for k, v := range g.unsupported {
+		c.Unsupported[k] = v
+	}
+	return c
+}
+
+// optionalCommand issues a command supporting an optional feature.
+//
+// If the modem reports the command as not supported then the command is
+// recorded as unsupported, a warning published, and subsequent calls return
+// ErrUnsupported without issuing the command.
+func (g *GSM) optionalCommand(cmd string, options ...at.CommandOption) ([]string, error) {
+	name := cmdName(cmd)
+	g.mu.Lock()
+	unsupported := g.unsupported[name]
+	g.mu.Unlock()
+	if unsupported {
+		return nil, ErrUnsupported
+	}
+	i, err := g.Command(cmd, options...)
+	if err == nil || !isUnsupported(err) {
+		return i, err
+	}
+	g.mu.Lock()
+	if g.unsupported == nil {
+		g.unsupported = make(map[string]bool)
+	}
+	first := !g.unsupported[name]
+	g.unsupported[name] = true
+	g.mu.Unlock()
+	if first && g.bus != nil {
+		g.bus.Publish(UnsupportedCommand{Cmd: name, Err: err})
+	}
+	return i, err
+}
+
+// cmdName returns the name of the command, stripped of any parameters or
+// query.
+func cmdName(cmd string) string {
+	if idx := strings.IndexAny(cmd, "=?"); idx >= 0 {
+		return cmd[:idx]
+	}
+	return cmd
+}
+
+// isUnsupported returns true if the error indicates the command is not
+// supported by the modem.
+func isUnsupported(err error) bool {
+	var cme at.CMEError
+	if errors.As(err, &cme) {
+		return cme == "4" || cme.Text() == "operation not supported"
+	}
+	var cms at.CMSError
+	if errors.As(err, &cms) {
+		return cms == "303" || cms.Text() == "operation not supported"
+	}
+	return false
+}
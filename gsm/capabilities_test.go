@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestUnsupportedCommand(t *testing.T) {
+	patterns := []struct {
+		name string
+		rsp  string
+	}{
+		{"numeric cms", "\r\n+CMS ERROR: 303\r\n"},
+		{"textual cms", "\r\n+CMS ERROR: operation not supported\r\n"},
+		{"numeric cme", "\r\n+CME ERROR: 4\r\n"},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{
+				"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+				"AT+CNMA\r\n":           {p.rsp},
+			}
+			b := gsm.NewEventBus()
+			warnings := make(chan gsm.Event, 3)
+			b.Subscribe(func(e gsm.Event) {
+				warnings <- e
+			}, gsm.UnsupportedCommand{})
+			g, mm := setupModem(t, cmdSet, gsm.WithEventBus(b))
+			defer teardownModem(mm)
+			assert.True(t, g.Capabilities().Supports("+CNMA"))
+
+			msgs := make(chan gsm.Message, 3)
+			mh := func(m gsm.Message) {
+				msgs <- m
+			}
+			eh := func(err error) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			err := g.StartMessageRx(mh, eh)
+			require.Nil(t, err)
+
+			oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+			for i := 0; i < 2; i++ {
+				mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, UD: []byte("hello")}))
+				select {
+				case m := <-msgs:
+					assert.Equal(t, "hello", m.Message)
+				case <-time.After(100 * time.Millisecond):
+					t.Fatal("no message received")
+				}
+			}
+			// allow the second ack to complete, if any
+			time.Sleep(20 * time.Millisecond)
+
+			acks := 0
+			for _, w := range mm.written() {
+				if w == "AT+CNMA\r\n" {
+					acks++
+				}
+			}
+			assert.Equal(t, 1, acks)
+			assert.False(t, g.Capabilities().Supports("+CNMA"))
+			assert.False(t, g.Capabilities().Supports("+CNMA=?"))
+			select {
+			case w := <-warnings:
+				require.IsType(t, gsm.UnsupportedCommand{}, w)
+				assert.Equal(t, "+CNMA", w.(gsm.UnsupportedCommand).Cmd)
+			default:
+				t.Error("no warning published")
+			}
+			assert.Equal(t, 0, len(warnings))
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestUnsupportedCommandOtherError(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\n+CMS ERROR: 340\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	err := g.StartMessageRx(func(gsm.Message) {}, func(error) {})
+	require.Nil(t, err)
+	oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+	mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, UD: []byte("hello")}))
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, g.Capabilities().Supports("+CNMA"))
+}
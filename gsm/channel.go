@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+var (
+	// AIDUSIM is the partial AID of the USIM application, being the 3GPP RID
+	// and application code, which selects the USIM by partial DF name.
+	AIDUSIM = []byte{0xa0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x02}
+
+	// AIDISIM is the partial AID of the ISIM application, which selects the
+	// ISIM by partial DF name.
+	AIDISIM = []byte{0xa0, 0x00, 0x00, 0x00, 0x87, 0x10, 0x04}
+)
+
+// TransmitAPDU issues a command APDU to the SIM via +CSIM, on the basic
+// channel or the logical channel encoded in the CLA.
+//
+// The response APDU from the SIM, including the status words, is returned.
+func (g *GSM) TransmitAPDU(apdu []byte, options ...at.CommandOption) ([]byte, error) {
+	cmd := strings.ToUpper(hex.EncodeToString(apdu))
+	i, err := g.Command(fmt.Sprintf("+CSIM=%d,\"%s\"", len(cmd), cmd), options...)
+	if err != nil {
+		return nil, err
+	}
+	return parseAPDUResponse(i, "+CSIM")
+}
+
+// OpenLogicalChannel opens a logical channel to the SIM application with the
+// AID, such as AIDISIM, using +CCHO, returning the session id of the channel.
+//
+// The AID may be partial, in which case the first application matching the
+// partial AID is selected.
+//
+// Commands are issued to the application using TransmitLogicalChannel, and
+// the channel should be closed using CloseLogicalChannel when no longer
+// required, as the SIM supports only a few logical channels.
+func (g *GSM) OpenLogicalChannel(aid []byte, options ...at.CommandOption) (int, error) {
+	if len(aid) < 5 || len(aid) > 16 {
+		return 0, ErrInvalidAID
+	}
+	i, err := g.Command(fmt.Sprintf("+CCHO=\"%s\"", strings.ToUpper(hex.EncodeToString(aid))), options...)
+	if err != nil {
+		return 0, err
+	}
+	// the session id is returned bare by some modems and with a +CCHO prefix
+	// by others.
+	for _, l := range i {
+		l = strings.TrimSpace(l)
+		if info.HasPrefix(l, "+CCHO") {
+			l = info.TrimPrefix(l, "+CCHO")
+		}
+		if l == "" {
+			continue
+		}
+		ch, err := strconv.Atoi(l)
+		if err != nil || ch < 0 {
+			return 0, ErrMalformedResponse
+		}
+		return ch, nil
+	}
+	return 0, ErrMalformedResponse
+}
+
+// CloseLogicalChannel closes a logical channel opened by OpenLogicalChannel,
+// using +CCHC.
+func (g *GSM) CloseLogicalChannel(channel int, options ...at.CommandOption) error {
+	_, err := g.Command(fmt.Sprintf("+CCHC=%d", channel), options...)
+	return err
+}
+
+// TransmitLogicalChannel issues a command APDU to the application on the
+// logical channel opened by OpenLogicalChannel, using +CGLA.
+//
+// The CLA of the APDU is adjusted by the modem to address the channel.
+//
+// The response APDU from the application, including the status words, is
+// returned.
+func (g *GSM) TransmitLogicalChannel(channel int, apdu []byte, options ...at.CommandOption) ([]byte, error) {
+	cmd := strings.ToUpper(hex.EncodeToString(apdu))
+	i, err := g.Command(fmt.Sprintf("+CGLA=%d,%d,\"%s\"", channel, len(cmd), cmd), options...)
+	if err != nil {
+		return nil, err
+	}
+	return parseAPDUResponse(i, "+CGLA")
+}
+
+// parseAPDUResponse parses the response APDU from the info returned by
+// +CSIM or +CGLA, which is of the form:
+//
+//	<prefix>: <length>,<response>
+func parseAPDUResponse(i []string, prefix string) ([]byte, error) {
+	for _, l := range i {
+		if !info.HasPrefix(l, prefix) {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, prefix))
+		if len(fields) < 2 {
+			return nil, ErrMalformedResponse
+		}
+		rsp, err := hex.DecodeString(fields[1])
+		if err != nil || len(rsp) < 2 {
+			return nil, ErrMalformedResponse
+		}
+		return rsp, nil
+	}
+	return nil, ErrMalformedResponse
+}
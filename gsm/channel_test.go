@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestTransmitAPDU(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CSIM=10,\"00B0000010\"\r\n": {"+CSIM: 6,\"AB9000\"\r\n", "\r\nOK\r\n"},
+		"AT+CSIM=10,\"00B0000020\"\r\n": {"+CSIM: 2,\"90\"\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	rsp, err := g.TransmitAPDU([]byte{0x00, 0xb0, 0x00, 0x00, 0x10})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xab, 0x90, 0x00}, rsp)
+
+	// short response
+	_, err = g.TransmitAPDU([]byte{0x00, 0xb0, 0x00, 0x00, 0x20})
+	assert.Equal(t, gsm.ErrMalformedResponse, err)
+
+	// error
+	_, err = g.TransmitAPDU([]byte{0x00, 0xb0, 0x00, 0x00, 0x30})
+	assert.Equal(t, at.ErrError, err)
+}
+
+func TestOpenLogicalChannel(t *testing.T) {
+	patterns := []struct {
+		name    string
+		aid     []byte
+		cmdSet  map[string][]string
+		channel int
+		err     error
+	}{
+		{
+			"prefixed",
+			gsm.AIDISIM,
+			map[string][]string{
+				"AT+CCHO=\"A0000000871004\"\r\n": {"+CCHO: 2\r\n", "\r\nOK\r\n"},
+			},
+			2,
+			nil,
+		},
+		{
+			"bare",
+			gsm.AIDUSIM,
+			map[string][]string{
+				"AT+CCHO=\"A0000000871002\"\r\n": {"1\r\n", "\r\nOK\r\n"},
+			},
+			1,
+			nil,
+		},
+		{
+			"malformed",
+			gsm.AIDISIM,
+			map[string][]string{
+				"AT+CCHO=\"A0000000871004\"\r\n": {"+CCHO: two\r\n", "\r\nOK\r\n"},
+			},
+			0,
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"missing",
+			gsm.AIDISIM,
+			map[string][]string{
+				"AT+CCHO=\"A0000000871004\"\r\n": {"\r\nOK\r\n"},
+			},
+			0,
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"error",
+			gsm.AIDISIM,
+			map[string][]string{
+				"AT+CCHO=\"A0000000871004\"\r\n": {"\r\n+CME ERROR: 3\r\n"},
+			},
+			0,
+			at.CMEError("3"),
+		},
+		{
+			"short aid",
+			[]byte{0xa0, 0x00},
+			nil,
+			0,
+			gsm.ErrInvalidAID,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, p.cmdSet)
+			defer teardownModem(mm)
+
+			ch, err := g.OpenLogicalChannel(p.aid)
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.channel, ch)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestLogicalChannel(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CCHO=\"A0000000871004\"\r\n":      {"+CCHO: 3\r\n", "\r\nOK\r\n"},
+		"AT+CGLA=3,14,\"00A40004026F02\"\r\n": {"+CGLA: 4,\"9000\"\r\n", "\r\nOK\r\n"},
+		"AT+CGLA=3,10,\"00B0000000\"\r\n":     {"+CGLA: 8,\"80019000\"\r\n", "\r\nOK\r\n"},
+		"AT+CGLA=3,10,\"00B0000010\"\r\n":     {"+CGLA: 4\r\n", "\r\nOK\r\n"},
+		"AT+CCHC=3\r\n":                       {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	ch, err := g.OpenLogicalChannel(gsm.AIDISIM)
+	require.Nil(t, err)
+	assert.Equal(t, 3, ch)
+
+	// select EF IMPI
+	rsp, err := g.TransmitLogicalChannel(ch, []byte{0x00, 0xa4, 0x00, 0x04, 0x02, 0x6f, 0x02})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x90, 0x00}, rsp)
+
+	rsp, err = g.TransmitLogicalChannel(ch, []byte{0x00, 0xb0, 0x00, 0x00, 0x00})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x80, 0x01, 0x90, 0x00}, rsp)
+
+	// malformed
+	_, err = g.TransmitLogicalChannel(ch, []byte{0x00, 0xb0, 0x00, 0x00, 0x10})
+	assert.Equal(t, gsm.ErrMalformedResponse, err)
+
+	err = g.CloseLogicalChannel(ch)
+	assert.Nil(t, err)
+
+	// closed
+	_, err = g.TransmitLogicalChannel(ch, []byte{0x00, 0xb0, 0x00, 0x00, 0x20})
+	assert.Equal(t, at.ErrError, err)
+
+	err = g.CloseLogicalChannel(4)
+	assert.Equal(t, at.ErrError, err)
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import "fmt"
+
+// the +CNMI settings tried by StartMessageRx, in order, unless overridden.
+//
+// Mode 1 is preferred as it discards indications while the link is reserved,
+// such as during a data call, rather than buffering them, but is rejected by
+// some modems, such as the SIM800 and some Quectel firmwares, which only
+// support mode 2.
+var defaultCNMI = []string{
+	"+CNMI=1,2,0,0,0",
+	"+CNMI=2,2,0,0,0",
+}
+
+type cnmiOption string
+
+func (o cnmiOption) applyRxOption(c *rxConfig) {
+	c.cnmi = append(c.cnmi, string(o))
+}
+
+// WithCNMI specifies the +CNMI settings used by StartMessageRx to direct the
+// modem to forward received messages.
+//
+// The parameters are the <mode>, <mt>, <bm>, <ds> and <bfr> as per 3GPP TS
+// 27.005.  The option may be applied several times to provide a list of
+// candidate settings, which are tried in order until one is accepted by the
+// modem.
+//
+// The default is "1,2,0,0,0", falling back to "2,2,0,0,0".
+//
+// The <ds> is overridden by WithStatusReports, and all the candidates are
+// overridden by WithInitialCommand.
+func WithCNMI(mode, mt, bm, ds, bfr int) RxOption {
+	return cnmiOption(fmt.Sprintf("+CNMI=%d,%d,%d,%d,%d", mode, mt, bm, ds, bfr))
+}
+
+// setCNMI issues each of the +CNMI commands in turn until one is accepted by
+// the modem.
+//
+// Returns the accepted command, else the error returned for the last
+// command.
+func (g *GSM) setCNMI(cmds []string) (cmd string, err error) {
+	for _, cmd = range cmds {
+		if _, err = g.Command(cmd); err == nil {
+			return
+		}
+	}
+	return "", err
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestWithCNMI(t *testing.T) {
+	patterns := []struct {
+		name    string
+		cmdSet  map[string][]string
+		options []gsm.RxOption
+		err     error
+		cmds    []string
+	}{
+		{
+			"default",
+			map[string][]string{
+				"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+			},
+			nil,
+			nil,
+			[]string{"AT+CNMI=1,2,0,0,0\r\n"},
+		},
+		{
+			"default fallback",
+			map[string][]string{
+				"AT+CNMI=2,2,0,0,0\r\n": {"\r\nOK\r\n"},
+			},
+			nil,
+			nil,
+			[]string{"AT+CNMI=1,2,0,0,0\r\n", "AT+CNMI=2,2,0,0,0\r\n"},
+		},
+		{
+			"candidates",
+			map[string][]string{
+				"AT+CNMI=3,2,0,0,0\r\n": {"\r\n+CME ERROR: 3\r\n"},
+				"AT+CNMI=2,2,0,0,1\r\n": {"\r\nOK\r\n"},
+			},
+			[]gsm.RxOption{gsm.WithCNMI(3, 2, 0, 0, 0), gsm.WithCNMI(2, 2, 0, 0, 1)},
+			nil,
+			[]string{"AT+CNMI=3,2,0,0,0\r\n", "AT+CNMI=2,2,0,0,1\r\n"},
+		},
+		{
+			"with reports",
+			map[string][]string{
+				"AT+CNMI=2,2,0,1,0\r\n": {"\r\nOK\r\n"},
+			},
+			[]gsm.RxOption{gsm.WithCNMI(2, 2, 0, 0, 0), gsm.WithStatusReports(nil)},
+			nil,
+			[]string{"AT+CNMI=2,2,0,1,0\r\n"},
+		},
+		{
+			"initial command",
+			map[string][]string{
+				"AT+CNMI=2,1,0,0,0\r\n": {"\r\nOK\r\n"},
+			},
+			[]gsm.RxOption{gsm.WithCNMI(2, 2, 0, 0, 0), gsm.WithInitialCommand("+CNMI=2,1,0,0,0")},
+			nil,
+			[]string{"AT+CNMI=2,1,0,0,0\r\n"},
+		},
+		{
+			"all rejected",
+			map[string][]string{
+				"AT+CNMI=1,2,0,0,0\r\n": {"\r\n+CME ERROR: 3\r\n"},
+				"AT+CNMI=2,2,0,0,0\r\n": {"\r\n+CME ERROR: 4\r\n"},
+			},
+			nil,
+			at.CMEError("4"),
+			[]string{"AT+CNMI=1,2,0,0,0\r\n", "AT+CNMI=2,2,0,0,0\r\n"},
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			p.cmdSet["AT+CSMS?\r\n"] = []string{"+CSMS: 0,1,1,1\r\n", "OK\r\n"}
+			g, mm := setupModem(t, p.cmdSet)
+			defer teardownModem(mm)
+
+			err := g.StartMessageRx(
+				func(msg gsm.Message) {},
+				func(err error) {},
+				p.options...)
+			assert.Equal(t, p.err, err)
+			var cnmi []string
+			for _, cmd := range mm.written() {
+				if strings.HasPrefix(cmd, "AT+CNMI=") {
+					cnmi = append(cnmi, cmd)
+				}
+			}
+			assert.Equal(t, p.cmds, cnmi)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestWithCNMIAckFallback(t *testing.T) {
+	// the fallback to +CMTI is based on the accepted +CNMI settings.
+	cmdSet := map[string][]string{
+		"AT+CNMA\r\n":           {"+CMS ERROR: 340\r\n"},
+		"AT+CNMI=2,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMI=2,1,0,0,0\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 1)
+	errChan := make(chan error, 1)
+	err := g.StartMessageRx(
+		func(msg gsm.Message) { msgChan <- msg },
+		func(err error) { errChan <- err },
+		gsm.WithAckFailureThreshold(1))
+	require.Nil(t, err)
+	mm.r <- []byte("+CMT: ,24\r\n00040B911234567890F000000250100173832305C8329BFD06\r\n")
+	select {
+	case msg := <-msgChan:
+		assert.Equal(t, gsm.AckFailed, msg.Ack)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	select {
+	case err := <-errChan:
+		assert.Equal(t, gsm.ErrAckFallback{Err: at.CMSError("340")}, err)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no fallback error")
+	}
+	assert.Contains(t, mm.written(), "AT+CNMI=2,1,0,0,0\r\n")
+	assert.NotContains(t, mm.written(), "AT+CNMI=1,1,0,0,0\r\n")
+}
@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/modem/trace"
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/pdumode"
+)
+
+// smscModem is a mock modem that accepts any SMS-SUBMIT, assigning TP-MRs in
+// the order the PDUs are received, and which injects a +CMT indication after
+// each PDU to interleave received messages with the sends.
+type smscModem struct {
+	r      chan []byte
+	mu     sync.Mutex
+	mr     int
+	pdus   []string
+	closed bool
+}
+
+func (mm *smscModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if !ok {
+		return 0, at.ErrClosed
+	}
+	return copy(p, data), nil
+}
+
+func (mm *smscModem) Write(p []byte) (n int, err error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if mm.closed {
+		return 0, at.ErrClosed
+	}
+	cmd := string(p)
+	mm.r <- p
+	switch {
+	case strings.HasPrefix(cmd, "AT+CMGS="):
+		mm.r <- []byte("\n>")
+	case strings.HasSuffix(cmd, string(rune(26))):
+		mm.pdus = append(mm.pdus, cmd[:len(cmd)-1])
+		mm.r <- []byte("\r\n+CMT: ,24\r\n00040B911234567890F000000250100173832305C8329BFD06\r\n")
+		mm.mr++
+		mm.r <- []byte(fmt.Sprintf("\r\n+CMGS: %d\r\n\r\nOK\r\n", mm.mr))
+	default:
+		mm.r <- []byte("\r\nOK\r\n")
+	}
+	return len(p), nil
+}
+
+func (mm *smscModem) Close() error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if !mm.closed {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
+
+func (mm *smscModem) written() []string {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return append([]string(nil), mm.pdus...)
+}
+
+func TestConcurrentUse(t *testing.T) {
+	mm := &smscModem{r: make(chan []byte, 100)}
+	defer mm.Close()
+	var modem io.ReadWriter = mm
+	if debug {
+		modem = trace.New(modem)
+	}
+	g := gsm.New(at.New(modem, at.WithTimeout(time.Second)))
+	require.NotNil(t, g)
+
+	var active, overlaps, received int32
+	mh := func(msg gsm.Message) {
+		if atomic.AddInt32(&active, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&received, 1)
+		atomic.AddInt32(&active, -1)
+	}
+	eh := func(err error) {
+		t.Errorf("rx error: %v", err)
+	}
+	err := g.StartMessageRx(mh, eh)
+	require.Nil(t, err)
+	defer g.StopMessageRx()
+
+	const senders = 8
+	msg := strings.Repeat("long message ", 15) // two parts
+	mrs := make([][]string, senders)
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			mrs[i], err = g.SendLongMessage("+12345", msg)
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// the parts of each message are contiguous and assigned consecutive MRs.
+	for i := 0; i < senders; i++ {
+		require.Len(t, mrs[i], 2)
+		mr1, err := strconv.Atoi(mrs[i][0])
+		assert.Nil(t, err)
+		mr2, err := strconv.Atoi(mrs[i][1])
+		assert.Nil(t, err)
+		assert.Equal(t, mr1+1, mr2)
+	}
+	pdus := mm.written()
+	require.Len(t, pdus, 2*senders)
+	for i := 0; i < len(pdus); i += 2 {
+		var refs [2]int
+		for j := 0; j < 2; j++ {
+			p, err := pdumode.UnmarshalHexString(pdus[i+j])
+			require.Nil(t, err)
+			tp, err := sms.Unmarshal(p.TPDU, sms.AsMO)
+			require.Nil(t, err)
+			segments, seqno, mref, ok := tp.ConcatInfo()
+			require.True(t, ok)
+			assert.Equal(t, 2, segments)
+			assert.Equal(t, j+1, seqno)
+			refs[j] = mref
+		}
+		assert.Equal(t, refs[0], refs[1])
+	}
+
+	// received messages are passed to the handler one at a time.
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&received) == 2*senders
+	}, time.Second, 10*time.Millisecond)
+	assert.Zero(t, atomic.LoadInt32(&overlaps))
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// StorageUsage is the usage of a message storage.
+type StorageUsage struct {
+	// Storage is the name of the message storage, e.g. "SM", "ME" or "MT".
+	Storage string
+
+	// Used is the number of messages held in the storage.
+	Used int
+
+	// Total is the number of messages the storage can hold.
+	Total int
+}
+
+// Free returns the number of messages the storage can hold in addition to
+// those already held.
+func (u StorageUsage) Free() int {
+	return u.Total - u.Used
+}
+
+// MessageStorage is the preferred message storage, as selected by +CPMS.
+type MessageStorage struct {
+	// Read is the storage messages are read and deleted from.
+	Read StorageUsage
+
+	// Write is the storage messages are written and sent from.
+	Write StorageUsage
+
+	// Receive is the storage received messages are placed in, when they are
+	// directed to storage.
+	Receive StorageUsage
+}
+
+// MessageStorage returns the preferred message storage, and the usage of
+// each, so exhaustion of the storage can be monitored.
+//
+// The modem returns:
+//
+//	+CPMS: <mem1>,<used1>,<total1>,<mem2>,<used2>,<total2>,<mem3>,<used3>,<total3>
+//
+// with the write and receive storage being optional.
+func (g *GSM) MessageStorage(options ...at.CommandOption) (MessageStorage, error) {
+	i, err := g.Command("+CPMS?", options...)
+	if err != nil {
+		return MessageStorage{}, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CPMS") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+CPMS"))
+		var ms MessageStorage
+		usages := []*StorageUsage{&ms.Read, &ms.Write, &ms.Receive}
+		for n := 0; n < len(usages) && len(fields) >= 3*(n+1); n++ {
+			u, err := parseStorageUsage(fields[3*n+1 : 3*n+3])
+			if err != nil {
+				return MessageStorage{}, err
+			}
+			u.Storage = fields[3*n]
+			*usages[n] = u
+		}
+		if ms.Read.Storage == "" {
+			return MessageStorage{}, ErrMalformedResponse
+		}
+		return ms, nil
+	}
+	return MessageStorage{}, ErrMalformedResponse
+}
+
+// SetMessageStorage selects the preferred message storage, such as "SM" for
+// the SIM, "ME" for the modem, or "MT" for both, and returns the usage of
+// each.
+//
+// The write and receive storage are optional, and are left unchanged if
+// empty, though receive may only be set if write is also set.  The Storage of
+// those left unchanged is not returned, so is empty.
+//
+// The modem returns:
+//
+//	+CPMS: <used1>,<total1>,<used2>,<total2>,<used3>,<total3>
+func (g *GSM) SetMessageStorage(read, write, receive string, options ...at.CommandOption) (MessageStorage, error) {
+	mems := []string{read}
+	if write != "" {
+		mems = append(mems, write)
+		if receive != "" {
+			mems = append(mems, receive)
+		}
+	}
+	args := make([]string, len(mems))
+	for n, m := range mems {
+		if err := checkStorage(m); err != nil {
+			return MessageStorage{}, err
+		}
+		args[n] = strconv.Quote(m)
+	}
+	i, err := g.Command("+CPMS="+strings.Join(args, ","), options...)
+	if err != nil {
+		return MessageStorage{}, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CPMS") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+CPMS"))
+		if len(fields) < 2 {
+			return MessageStorage{}, ErrMalformedResponse
+		}
+		var ms MessageStorage
+		usages := []*StorageUsage{&ms.Read, &ms.Write, &ms.Receive}
+		for n := 0; n < len(usages) && len(fields) >= 2*(n+1); n++ {
+			u, err := parseStorageUsage(fields[2*n : 2*n+2])
+			if err != nil {
+				return MessageStorage{}, err
+			}
+			if n < len(mems) {
+				u.Storage = mems[n]
+			}
+			*usages[n] = u
+		}
+		return ms, nil
+	}
+	return MessageStorage{}, ErrMalformedResponse
+}
+
+// inMessageStorage calls f with mem selected as the read storage, as +CMGR
+// and +CMGD act on the read storage, and restores the previous read storage
+// afterwards.
+//
+// If mem is empty, or the read storage cannot be determined, such as if the
+// modem does not support +CPMS, then f is called with the storage unchanged.
+func (g *GSM) inMessageStorage(mem string, f func() error) error {
+	if mem == "" {
+		return f()
+	}
+	g.cpmsMu.Lock()
+	defer g.cpmsMu.Unlock()
+	ms, err := g.MessageStorage()
+	if err != nil || ms.Read.Storage == mem {
+		return f()
+	}
+	if _, err = g.SetMessageStorage(mem, "", ""); err != nil {
+		return err
+	}
+	err = f()
+	if _, rerr := g.SetMessageStorage(ms.Read.Storage, "", ""); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// parseStorageUsage parses the used and total fields of a storage.
+func parseStorageUsage(fields []string) (StorageUsage, error) {
+	used, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return StorageUsage{}, ErrMalformedResponse
+	}
+	total, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return StorageUsage{}, ErrMalformedResponse
+	}
+	return StorageUsage{Used: used, Total: total}, nil
+}
+
+// checkStorage checks the storage name is alphanumeric, so it cannot alter
+// the command it is embedded in.
+func checkStorage(mem string) error {
+	if mem == "" {
+		return ErrUnsafeInput{"storage", mem, "empty"}
+	}
+	for _, r := range mem {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return ErrUnsafeInput{"storage", mem, fmt.Sprintf("invalid character %q", r)}
+		}
+	}
+	return nil
+}
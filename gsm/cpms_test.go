@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestMessageStorage(t *testing.T) {
+	patterns := []struct {
+		name    string
+		rsp     []string
+		storage gsm.MessageStorage
+		err     error
+	}{
+		{
+			"all",
+			[]string{"+CPMS: \"SM\",3,30,\"ME\",0,255,\"MT\",3,285\r\n", "OK\r\n"},
+			gsm.MessageStorage{
+				Read:    gsm.StorageUsage{Storage: "SM", Used: 3, Total: 30},
+				Write:   gsm.StorageUsage{Storage: "ME", Used: 0, Total: 255},
+				Receive: gsm.StorageUsage{Storage: "MT", Used: 3, Total: 285},
+			},
+			nil,
+		},
+		{
+			"read only",
+			[]string{"+CPMS: \"SM\",30,30\r\n", "OK\r\n"},
+			gsm.MessageStorage{
+				Read: gsm.StorageUsage{Storage: "SM", Used: 30, Total: 30},
+			},
+			nil,
+		},
+		{
+			"malformed",
+			[]string{"+CPMS: \"SM\",3,many\r\n", "OK\r\n"},
+			gsm.MessageStorage{},
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"missing",
+			[]string{"OK\r\n"},
+			gsm.MessageStorage{},
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"error",
+			[]string{"+CMS ERROR: 310\r\n"},
+			gsm.MessageStorage{},
+			at.CMSError("310"),
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{"AT+CPMS?\r\n": p.rsp}
+			g, mm := setupModem(t, cmdSet)
+			defer teardownModem(mm)
+			ms, err := g.MessageStorage()
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.storage, ms)
+		}
+		t.Run(p.name, f)
+	}
+	assert.Equal(t, 27, gsm.StorageUsage{Used: 3, Total: 30}.Free())
+}
+
+func TestSetMessageStorage(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CPMS=\"SM\"\r\n":               {"+CPMS: 3,30,0,255,3,285\r\n", "OK\r\n"},
+		"AT+CPMS=\"ME\",\"ME\",\"ME\"\r\n": {"+CPMS: 0,255,0,255,0,255\r\n", "OK\r\n"},
+		"AT+CPMS=\"MT\",\"SM\"\r\n":        {"+CPMS: 3,285,x,30\r\n", "OK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	ms, err := g.SetMessageStorage("SM", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, gsm.MessageStorage{
+		Read:    gsm.StorageUsage{Storage: "SM", Used: 3, Total: 30},
+		Write:   gsm.StorageUsage{Used: 0, Total: 255},
+		Receive: gsm.StorageUsage{Used: 3, Total: 285},
+	}, ms)
+
+	ms, err = g.SetMessageStorage("ME", "ME", "ME")
+	assert.Nil(t, err)
+	assert.Equal(t, gsm.MessageStorage{
+		Read:    gsm.StorageUsage{Storage: "ME", Used: 0, Total: 255},
+		Write:   gsm.StorageUsage{Storage: "ME", Used: 0, Total: 255},
+		Receive: gsm.StorageUsage{Storage: "ME", Used: 0, Total: 255},
+	}, ms)
+
+	_, err = g.SetMessageStorage("MT", "SM", "")
+	assert.Equal(t, gsm.ErrMalformedResponse, err)
+
+	_, err = g.SetMessageStorage("SM\",\"ME", "", "")
+	assert.IsType(t, gsm.ErrUnsafeInput{}, err)
+
+	_, err = g.SetMessageStorage("SR", "", "")
+	assert.Equal(t, at.ErrError, err)
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// DataDownloadHandler receives SIM data download messages, such as carrier
+// OTA updates, that are addressed to the SIM rather than the user.
+type DataDownloadHandler func(tpdu.TPDU)
+
+type dataDownloadOption DataDownloadHandler
+
+func (o dataDownloadOption) applyRxOption(c *rxConfig) {
+	c.ddh = DataDownloadHandler(o)
+}
+
+// WithDataDownloadHandler specifies a handler for SIM data download messages,
+// i.e. those with a TP-PID of 0x7f.
+//
+// Those messages are passed to the data download handler rather than the
+// message handler.  Modems that do not forward the messages to the SIM
+// themselves may have the handler call DownloadToSIM to do so.
+func WithDataDownloadHandler(h DataDownloadHandler) RxOption {
+	return dataDownloadOption(h)
+}
+
+// the TP-PID identifying a SIM data download message.
+const pidSIMDataDownload = 0x7f
+
+// DownloadToSIM forwards a SIM data download message to the SIM, using an
+// SMS-PP data download ENVELOPE issued via +CSIM.
+//
+// The response APDU from the SIM, including the status words, is returned.
+// Any response data is intended to be returned to the network as part of the
+// RP-ACK, but that is beyond the control of the AT command set.
+func (g *GSM) DownloadToSIM(tp tpdu.TPDU, options ...at.CommandOption) ([]byte, error) {
+	b, err := tp.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	env := berTLV(0xd1, append(
+		// device identities - from network to UICC
+		[]byte{0x82, 0x02, 0x83, 0x81},
+		berTLV(0x8b, b)...))
+	// UICC first, falling back to the GSM SIM class if not supported.
+	rsp, err := g.envelope(0x80, env, options...)
+	if err == nil && len(rsp) == 2 && rsp[0] == 0x6e {
+		rsp, err = g.envelope(0xa0, env, options...)
+	}
+	return rsp, err
+}
+
+// envelope issues an ENVELOPE APDU to the SIM via +CSIM.
+func (g *GSM) envelope(cla byte, env []byte, options ...at.CommandOption) ([]byte, error) {
+	apdu := append([]byte{cla, 0xc2, 0x00, 0x00, byte(len(env))}, env...)
+	return g.TransmitAPDU(apdu, options...)
+}
+
+// berTLV encodes a BER-TLV data object, as used by the SIM toolkit.
+func berTLV(tag byte, v []byte) []byte {
+	b := []byte{tag}
+	if len(v) > 127 {
+		b = append(b, 0x81)
+	}
+	b = append(b, byte(len(v)))
+	return append(b, v...)
+}
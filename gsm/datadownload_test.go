@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestWithDataDownloadHandler(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	ddChan := make(chan tpdu.TPDU, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		t.Errorf("error received: %v", err)
+	}
+	ddh := func(tp tpdu.TPDU) {
+		ddChan <- tp
+	}
+	err := g.StartMessageRx(mh, eh, gsm.WithDataDownloadHandler(ddh))
+	require.Nil(t, err)
+
+	oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+	// data download
+	mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, PID: 0x7f, DCS: 0xf6, UD: []byte{1, 2, 3}}))
+	select {
+	case tp := <-ddChan:
+		assert.Equal(t, byte(0x7f), tp.PID)
+		assert.Equal(t, []byte{1, 2, 3}, []byte(tp.UD))
+	case <-msgChan:
+		t.Errorf("data download passed to message handler")
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("no data download received")
+	}
+
+	// plain
+	mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, UD: []byte("hello")}))
+	select {
+	case <-msgChan:
+	case <-ddChan:
+		t.Errorf("message passed to data download handler")
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("no message received")
+	}
+}
+
+func TestDownloadToSIM(t *testing.T) {
+	env := "C200001AD118820283818B1200049121437FF61010100000000003010203"
+	cmdSet := map[string][]string{
+		"AT+CSIM=62,\"80" + env + "\"\r\n": {"+CSIM: 4,\"6E00\"\r\n", "\r\nOK\r\n"},
+		"AT+CSIM=62,\"A0" + env + "\"\r\n": {"+CSIM: 4,\"9000\"\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	tp := tpdu.TPDU{
+		OA:  tpdu.Address{Addr: "1234", TOA: 0x91},
+		PID: 0x7f,
+		DCS: 0xf6,
+		UD:  []byte{1, 2, 3},
+	}
+	// class fallback
+	rsp, err := g.DownloadToSIM(tp)
+	require.Nil(t, err)
+	assert.Equal(t, []byte{0x90, 0x00}, rsp)
+
+	// uicc
+	cmdSet["AT+CSIM=62,\"80"+env+"\"\r\n"] = []string{"+CSIM: 6,\"AB9000\"\r\n", "\r\nOK\r\n"}
+	rsp, err = g.DownloadToSIM(tp)
+	require.Nil(t, err)
+	assert.Equal(t, []byte{0xab, 0x90, 0x00}, rsp)
+
+	// malformed
+	cmdSet["AT+CSIM=62,\"80"+env+"\"\r\n"] = []string{"+CSIM: 4\r\n", "\r\nOK\r\n"}
+	_, err = g.DownloadToSIM(tp)
+	assert.Equal(t, gsm.ErrMalformedResponse, err)
+
+	// error
+	delete(cmdSet, "AT+CSIM=62,\"80"+env+"\"\r\n")
+	_, err = g.DownloadToSIM(tp)
+	assert.Equal(t, at.ErrError, err)
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+type dedupOption int
+
+func (o dedupOption) applyRxOption(c *rxConfig) {
+	c.dedup = int(o)
+}
+
+// WithDeduplication discards received TPDUs that duplicate one of the most
+// recently received TPDUs.
+//
+// Duplicates are typically the result of the SMSC retrying a delivery that
+// was not acknowledged.  TPDUs are considered duplicates if they share the
+// originating address, service centre timestamp, concatenation details and
+// user data.
+//
+// The size determines the number of recently received TPDUs remembered.
+func WithDeduplication(size int) RxOption {
+	return dedupOption(size)
+}
+
+type sharedDedupOption struct {
+	d *DedupSet
+}
+
+func (o sharedDedupOption) applyRxOption(c *rxConfig) {
+	c.dedupSet = o.d
+}
+
+// WithSharedDeduplication discards received TPDUs that duplicate one of the
+// TPDUs recently received by any receiver sharing the set.
+//
+// This is intended for modems that deliver indications on several ports, or
+// on several CMUX channels, where a receiver is started on each port.  Each
+// port acknowledges the TPDU as usual, but the message is only passed to the
+// message handler by the first receiver to see it.
+//
+// As the parts of a concatenated message may then be passed on by different
+// receivers, the receivers should also share a Collector, using
+// WithCollector.
+func WithSharedDeduplication(d *DedupSet) RxOption {
+	return sharedDedupOption{d}
+}
+
+// DedupSet is a fixed size LRU set of keys identifying received TPDUs.
+//
+// A DedupSet is safe for concurrent use, and may be shared by several
+// receivers to coalesce the TPDUs delivered by each.
+type DedupSet struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+// NewDedupSet creates a DedupSet that remembers the specified number of most
+// recently received TPDUs.
+func NewDedupSet(size int) *DedupSet {
+	return &DedupSet{
+		size:  size,
+		order: list.New(),
+		keys:  make(map[string]*list.Element),
+	}
+}
+
+// seen returns true if the TPDU has been seen recently, else records it and
+// returns false.
+func (d *DedupSet) seen(tp *tpdu.TPDU) bool {
+	key := dedupKey(tp)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.keys[key]; ok {
+		d.order.MoveToFront(e)
+		return true
+	}
+	d.keys[key] = d.order.PushFront(key)
+	if d.order.Len() > d.size {
+		e := d.order.Back()
+		d.order.Remove(e)
+		delete(d.keys, e.Value.(string))
+	}
+	return false
+}
+
+// dedupKey returns the key identifying the TPDU for deduplication.
+func dedupKey(tp *tpdu.TPDU) string {
+	h := fnv.New64a()
+	h.Write(tp.UD)
+	segs, seqno, mref, _ := tp.ConcatInfo()
+	return fmt.Sprintf("%s:%d:%d:%d:%d:%d:%x",
+		tp.OA.Number(), tp.SCTS.Unix(), tp.MR, segs, seqno, mref, h.Sum64())
+}
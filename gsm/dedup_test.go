@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestWithDeduplication(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		t.Errorf("error received: %v", err)
+	}
+	err := g.StartMessageRx(mh, eh, gsm.WithDeduplication(2))
+	require.Nil(t, err)
+
+	oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+	ts := func(s int) tpdu.Timestamp {
+		return tpdu.Timestamp{Time: time.Date(2020, 1, 1, 0, 0, s, 0, time.UTC)}
+	}
+	m1 := cmtIndication(t, tpdu.TPDU{OA: oa, SCTS: ts(1), UD: []byte("one")})
+	m2 := cmtIndication(t, tpdu.TPDU{OA: oa, SCTS: ts(2), UD: []byte("two")})
+	m3 := cmtIndication(t, tpdu.TPDU{OA: oa, SCTS: ts(3), UD: []byte("three")})
+	patterns := []struct {
+		name string
+		rx   string
+		msg  bool
+	}{
+		{"first", m1, true},
+		{"duplicate", m1, false},
+		{"second", m2, true},
+		{"refresh first", m1, false},
+		{"third", m3, true},
+		{"duplicate refreshed", m1, false},
+		{"evicted", m2, true},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			mm.r <- []byte(p.rx)
+			select {
+			case <-msgChan:
+				assert.True(t, p.msg)
+			case <-time.After(50 * time.Millisecond):
+				assert.False(t, p.msg)
+			}
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestWithSharedDeduplication(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+	}
+	g1, mm1 := setupModem(t, cmdSet)
+	defer teardownModem(mm1)
+	g2, mm2 := setupModem(t, cmdSet)
+	defer teardownModem(mm2)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		t.Errorf("error received: %v", err)
+	}
+	ds := gsm.NewDedupSet(4)
+	c := sms.NewCollector()
+	defer c.Close()
+	err := g1.StartMessageRx(mh, eh, gsm.WithSharedDeduplication(ds), gsm.WithCollector(c))
+	require.Nil(t, err)
+	err = g2.StartMessageRx(mh, eh, gsm.WithSharedDeduplication(ds), gsm.WithCollector(c))
+	require.Nil(t, err)
+
+	oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+	ts := tpdu.Timestamp{Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	part := func(seqno int, ud string) string {
+		tp := tpdu.TPDU{
+			FirstOctet: tpdu.FoUDHI,
+			OA:         oa,
+			SCTS:       ts,
+			UDH:        tpdu.UserDataHeader{{ID: 0, Data: []byte{3, 2, byte(seqno)}}},
+			UD:         []byte(ud),
+		}
+		return cmtIndication(t, tp)
+	}
+	p1 := part(1, "hello ")
+	p2 := part(2, "world")
+
+	// each part delivered on both ports, in different orders
+	mm1.r <- []byte(p1)
+	mm2.r <- []byte(p1)
+	mm2.r <- []byte(p2)
+	mm1.r <- []byte(p2)
+	select {
+	case msg := <-msgChan:
+		assert.Equal(t, "hello world", msg.Message)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("no message")
+	}
+	select {
+	case msg := <-msgChan:
+		t.Errorf("duplicate message: %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/warthog618/modem/at"
+)
+
+// DeleteFilter selects the messages deleted by DeleteAll.
+//
+// The values correspond to the <delflag> values of +CMGD.
+type DeleteFilter int
+
+const (
+	// DeleteRead deletes the received messages that have been read.
+	DeleteRead DeleteFilter = iota + 1
+
+	// DeleteReadAndSent deletes the received messages that have been read,
+	// and the stored messages that have been sent.
+	DeleteReadAndSent
+
+	// DeleteReadSentAndUnsent deletes all messages other than received
+	// messages that have not been read.
+	DeleteReadSentAndUnsent
+
+	// DeleteAllMessages deletes all messages, including received messages
+	// that have not been read.
+	DeleteAllMessages
+)
+
+// cmgdaFlags maps the filters to their +CMGDA equivalents, in PDU mode and
+// text mode, for those that have one.
+var cmgdaFlags = map[DeleteFilter][2]string{
+	DeleteRead:        {"1", "\"DEL READ\""},
+	DeleteAllMessages: {"6", "\"DEL ALL\""},
+}
+
+// DeleteMessage deletes the message at the index in the modem message
+// storage, such as one of the Slots of a Message or StoredMessage.
+func (g *GSM) DeleteMessage(index int, options ...at.CommandOption) error {
+	_, err := g.Command(fmt.Sprintf("+CMGD=%d", index), options...)
+	return err
+}
+
+// DeleteAll deletes the messages selected by the filter from the modem
+// message storage, so the storage does not fill.  A full storage silently
+// stops the receipt of messages the network directs to storage.
+//
+// The messages are deleted using the <delflag> of +CMGD.  If the modem does
+// not support that, the vendor specific +CMGDA is used instead, where it
+// supports the filter.
+func (g *GSM) DeleteAll(filter DeleteFilter, options ...at.CommandOption) error {
+	_, err := g.Command(fmt.Sprintf("+CMGD=1,%d", filter), options...)
+	if err == nil || !(isUnsupported(err) || errors.Is(err, at.ErrError)) {
+		return err
+	}
+	flags, ok := cmgdaFlags[filter]
+	if !ok {
+		return err
+	}
+	flag := flags[0]
+	if !g.pduMode {
+		flag = flags[1]
+	}
+	if _, aerr := g.optionalCommand("+CMGDA="+flag, options...); aerr != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestDeleteMessage(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGD=3\r\n": {"\r\nOK\r\n"},
+		"AT+CMGD=4\r\n": {"\r\n+CMS ERROR: 321\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	err := g.DeleteMessage(3)
+	assert.Nil(t, err)
+
+	err = g.DeleteMessage(4)
+	assert.Equal(t, at.CMSError("321"), err)
+}
+
+func TestDeleteAll(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGD=1,1\r\n": {"\r\nOK\r\n"},
+		"AT+CMGD=1,4\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	err := g.DeleteAll(gsm.DeleteRead)
+	assert.Nil(t, err)
+	err = g.DeleteAll(gsm.DeleteAllMessages)
+	assert.Nil(t, err)
+
+	// fallback to +CMGDA
+	cmdSet = map[string][]string{
+		"AT+CMGD=1,4\r\n": {"\r\n+CMS ERROR: 303\r\n"},
+		"AT+CMGDA=6\r\n":  {"\r\nOK\r\n"},
+	}
+	g, mm = setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	err = g.DeleteAll(gsm.DeleteAllMessages)
+	assert.Nil(t, err)
+
+	// no equivalent
+	err = g.DeleteAll(gsm.DeleteReadAndSent)
+	assert.Equal(t, at.ErrError, err)
+
+	// fallback fails
+	err = g.DeleteAll(gsm.DeleteRead)
+	assert.Equal(t, at.ErrError, err)
+
+	// text mode fallback
+	cmdSet = map[string][]string{
+		"AT+CMGDA=\"DEL READ\"\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm = setupModem(t, cmdSet, gsm.WithTextMode)
+	defer teardownModem(mm)
+	err = g.DeleteAll(gsm.DeleteRead)
+	assert.Nil(t, err)
+}
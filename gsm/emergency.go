@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"time"
+
+	"github.com/warthog618/modem/at"
+)
+
+// Location is a geographic location, in decimal degrees.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// LocationFix determines the current location, such as by obtaining a GNSS
+// fix.
+type LocationFix func() (Location, error)
+
+// EmergencyOption defines a behavioural option for DialEmergency.
+type EmergencyOption interface {
+	applyEmergencyOption(*emergencyConfig)
+}
+
+type emergencyConfig struct {
+	fix     LocationFix
+	timeout time.Duration
+}
+
+type locationFixOption LocationFix
+
+func (o locationFixOption) applyEmergencyOption(c *emergencyConfig) {
+	c.fix = LocationFix(o)
+}
+
+// WithLocationFix specifies a function to determine the location of the
+// caller.
+//
+// The fix is started before the call is dialled, and runs concurrently with
+// it, so the call is not delayed waiting for the fix.  The result is
+// available from the Location method of the returned EmergencyCall.
+func WithLocationFix(f LocationFix) EmergencyOption {
+	return locationFixOption(f)
+}
+
+type emergencyTimeoutOption time.Duration
+
+func (o emergencyTimeoutOption) applyEmergencyOption(c *emergencyConfig) {
+	c.timeout = time.Duration(o)
+}
+
+// WithDialTimeout specifies the time allowed for the modem to accept the
+// dial command.
+//
+// The default is 30 seconds.
+func WithDialTimeout(d time.Duration) EmergencyOption {
+	return emergencyTimeoutOption(d)
+}
+
+// EmergencyCall describes an emergency call placed by DialEmergency.
+type EmergencyCall struct {
+	// Number is the number dialled.
+	Number string
+
+	// Start is the time the call was dialled.
+	Start time.Time
+
+	located  chan struct{}
+	location Location
+	err      error
+}
+
+// Location returns the location determined by the LocationFix provided to
+// DialEmergency, blocking until the fix completes.
+//
+// Returns ErrNoLocation if no LocationFix was provided.
+func (c *EmergencyCall) Location() (Location, error) {
+	<-c.located
+	return c.location, c.err
+}
+
+// DialEmergency places a voice call to an emergency number, such as 112 or
+// 911.
+//
+// Emergency numbers are exempt from fixed dialling and call barring, and may
+// be dialled without a SIM or network registration where the modem allows.
+// If the modem is not registered then automatic network selection is
+// requested, so the modem may register with any available network.
+//
+// The number defaults to 112 if empty.
+func (g *GSM) DialEmergency(number string, options ...EmergencyOption) (*EmergencyCall, error) {
+	cfg := emergencyConfig{timeout: 30 * time.Second}
+	for _, option := range options {
+		option.applyEmergencyOption(&cfg)
+	}
+	if number == "" {
+		number = "112"
+	}
+	call := EmergencyCall{
+		Number:  number,
+		located: make(chan struct{}),
+		err:     ErrNoLocation,
+	}
+	if cfg.fix != nil {
+		go func() {
+			call.location, call.err = cfg.fix()
+			close(call.located)
+		}()
+	} else {
+		close(call.located)
+	}
+	if stat, err := g.RegistrationStatus(); err != nil || !stat.Registered() {
+		// best effort - the modem can place the call in limited service.
+		g.Command("+COPS=0")
+	}
+	call.Start = time.Now()
+	_, err := g.Command("D"+number+";", at.WithTimeout(cfg.timeout))
+	return &call, err
+}
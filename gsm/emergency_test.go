@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestDialEmergency(t *testing.T) {
+	loc := gsm.Location{Latitude: -27.47, Longitude: 153.02}
+	fixErr := errors.New("no fix")
+	patterns := []struct {
+		name    string
+		number  string
+		creg    []string
+		options []gsm.EmergencyOption
+		cmds    []string
+		loc     gsm.Location
+		locErr  error
+		err     error
+	}{
+		{
+			"registered",
+			"911",
+			[]string{"+CREG: 0,1\r\n", "OK\r\n"},
+			nil,
+			[]string{"AT+CREG?\r\n", "ATD911;\r\n"},
+			gsm.Location{},
+			gsm.ErrNoLocation,
+			nil,
+		},
+		{
+			"default number",
+			"",
+			[]string{"+CREG: 0,5\r\n", "OK\r\n"},
+			nil,
+			[]string{"AT+CREG?\r\n", "ATD112;\r\n"},
+			gsm.Location{},
+			gsm.ErrNoLocation,
+			nil,
+		},
+		{
+			"unregistered",
+			"112",
+			[]string{"+CREG: 0,3\r\n", "OK\r\n"},
+			nil,
+			[]string{"AT+CREG?\r\n", "AT+COPS=0\r\n", "ATD112;\r\n"},
+			gsm.Location{},
+			gsm.ErrNoLocation,
+			nil,
+		},
+		{
+			"location",
+			"112",
+			[]string{"+CREG: 0,1\r\n", "OK\r\n"},
+			[]gsm.EmergencyOption{
+				gsm.WithLocationFix(func() (gsm.Location, error) {
+					time.Sleep(10 * time.Millisecond)
+					return loc, nil
+				}),
+			},
+			[]string{"AT+CREG?\r\n", "ATD112;\r\n"},
+			loc,
+			nil,
+			nil,
+		},
+		{
+			"location error",
+			"112",
+			[]string{"+CREG: 0,1\r\n", "OK\r\n"},
+			[]gsm.EmergencyOption{
+				gsm.WithLocationFix(func() (gsm.Location, error) {
+					return gsm.Location{}, fixErr
+				}),
+				gsm.WithDialTimeout(time.Second),
+			},
+			[]string{"AT+CREG?\r\n", "ATD112;\r\n"},
+			gsm.Location{},
+			fixErr,
+			nil,
+		},
+		{
+			"dial error",
+			"000",
+			[]string{"+CREG: 0,1\r\n", "OK\r\n"},
+			nil,
+			[]string{"AT+CREG?\r\n", "ATD000;\r\n"},
+			gsm.Location{},
+			gsm.ErrNoLocation,
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{
+				"AT+CREG?\r\n":  p.creg,
+				"AT+COPS=0\r\n": {"OK\r\n"},
+				"ATD911;\r\n":   {"OK\r\n"},
+				"ATD112;\r\n":   {"OK\r\n"},
+			}
+			g, mm := setupModem(t, cmdSet)
+			defer teardownModem(mm)
+			call, err := g.DialEmergency(p.number, p.options...)
+			assert.Equal(t, p.err, err)
+			require.NotNil(t, call)
+			assert.False(t, call.Start.IsZero())
+			loc, err := call.Location()
+			assert.Equal(t, p.locErr, err)
+			assert.Equal(t, p.loc, loc)
+			assert.Equal(t, p.cmds, mm.written())
+		}
+		t.Run(p.name, f)
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// Estimate describes how a message would be encoded when sent.
+type Estimate struct {
+	// Alphabet is the alphabet the message is encoded in.
+	Alphabet tpdu.Alphabet
+
+	// Segments is the usage of each of the PDUs the message is split into.
+	Segments []SegmentUsage
+}
+
+// SegmentUsage describes the user data usage of one PDU.
+//
+// For the 7-bit alphabet the units are septets, else they are octets.
+type SegmentUsage struct {
+	// Used is the user data used by the message text.
+	Used int
+
+	// Capacity is the user data available for message text, i.e. excluding
+	// the user data header, such as the concatenation header added to each
+	// part of a long message.
+	Capacity int
+}
+
+// Count returns the number of segments, i.e. PDUs, the message is sent in.
+func (e Estimate) Count() int {
+	return len(e.Segments)
+}
+
+// EstimateSegments returns the encoding the message would be sent in by
+// SendLongMessage, without sending it.
+//
+// The encoding options provided to New, and any provided to
+// WithEncoderOptionOnce, are applied, as they would be for a send, as is any
+// transliteration enabled by WithTransliteration, but the TP-MR and
+// concatenation references are not consumed.
+func (g *GSM) EstimateSegments(message string, options ...at.CommandOption) (Estimate, error) {
+	cfg, _ := g.sendConfig("", options)
+	e := sms.NewEncoder(append([]sms.EncoderOption{sms.AsSubmit}, cfg.eOpts...)...)
+	pdus, err := e.Encode([]byte(g.text(message)))
+	if err != nil {
+		return Estimate{}, err
+	}
+	est := Estimate{Segments: make([]SegmentUsage, len(pdus))}
+	for i := range pdus {
+		if i == 0 {
+			est.Alphabet, _ = pdus[i].DCS.Alphabet()
+		}
+		est.Segments[i] = SegmentUsage{
+			Used:     len(pdus[i].UD),
+			Capacity: pdus[i].UDBlockSize(),
+		}
+	}
+	return est, nil
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/gsm7/charset"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestEstimateSegments(t *testing.T) {
+	patterns := []struct {
+		name     string
+		goptions []gsm.Option
+		options  []at.CommandOption
+		message  string
+		est      gsm.Estimate
+	}{
+		{
+			"empty",
+			nil,
+			nil,
+			"",
+			gsm.Estimate{Segments: []gsm.SegmentUsage{}},
+		},
+		{
+			"single 7bit",
+			nil,
+			nil,
+			"hello",
+			gsm.Estimate{
+				Alphabet: tpdu.Alpha7Bit,
+				Segments: []gsm.SegmentUsage{{Used: 5, Capacity: 160}},
+			},
+		},
+		{
+			"full 7bit",
+			nil,
+			nil,
+			strings.Repeat("a", 160),
+			gsm.Estimate{
+				Alphabet: tpdu.Alpha7Bit,
+				Segments: []gsm.SegmentUsage{{Used: 160, Capacity: 160}},
+			},
+		},
+		{
+			"multipart 7bit",
+			nil,
+			nil,
+			strings.Repeat("a", 161),
+			gsm.Estimate{
+				Alphabet: tpdu.Alpha7Bit,
+				Segments: []gsm.SegmentUsage{
+					{Used: 153, Capacity: 153},
+					{Used: 8, Capacity: 153},
+				},
+			},
+		},
+		{
+			"escaped 7bit",
+			nil,
+			nil,
+			"{}",
+			gsm.Estimate{
+				Alphabet: tpdu.Alpha7Bit,
+				Segments: []gsm.SegmentUsage{{Used: 4, Capacity: 160}},
+			},
+		},
+		{
+			"multipart ucs2",
+			nil,
+			nil,
+			strings.Repeat("я", 71),
+			gsm.Estimate{
+				Alphabet: tpdu.AlphaUCS2,
+				Segments: []gsm.SegmentUsage{
+					{Used: 134, Capacity: 134},
+					{Used: 8, Capacity: 134},
+				},
+			},
+		},
+		{
+			"encoder option",
+			[]gsm.Option{gsm.WithEncoderOption(sms.WithLockingCharset(charset.Turkish))},
+			nil,
+			"Çok güzel ğ",
+			gsm.Estimate{
+				Alphabet: tpdu.Alpha7Bit,
+				// locking shift header uses 3 octets + UDHL, so 5 septets.
+				Segments: []gsm.SegmentUsage{{Used: 11, Capacity: 155}},
+			},
+		},
+		{
+			"encoder option once",
+			nil,
+			[]at.CommandOption{gsm.WithEncoderOptionOnce(sms.WithLockingCharset(charset.Turkish))},
+			"Çok güzel ğ",
+			gsm.Estimate{
+				Alphabet: tpdu.Alpha7Bit,
+				Segments: []gsm.SegmentUsage{{Used: 11, Capacity: 155}},
+			},
+		},
+		{
+			"fallback ucs2",
+			nil,
+			nil,
+			"Çok güzel ğ",
+			gsm.Estimate{
+				Alphabet: tpdu.AlphaUCS2,
+				Segments: []gsm.SegmentUsage{{Used: 22, Capacity: 140}},
+			},
+		},
+		{
+			"transliterated",
+			[]gsm.Option{gsm.WithTransliteration()},
+			nil,
+			"“Hello” – café",
+			gsm.Estimate{
+				Alphabet: tpdu.Alpha7Bit,
+				Segments: []gsm.SegmentUsage{{Used: 14, Capacity: 160}},
+			},
+		},
+		{
+			"untransliterable",
+			[]gsm.Option{gsm.WithTransliteration()},
+			nil,
+			"“Hello” 你好",
+			gsm.Estimate{
+				Alphabet: tpdu.AlphaUCS2,
+				Segments: []gsm.SegmentUsage{{Used: 20, Capacity: 140}},
+			},
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, nil, p.goptions...)
+			defer teardownModem(mm)
+			est, err := g.EstimateSegments(p.message, p.options...)
+			require.Nil(t, err)
+			assert.Equal(t, p.est, est)
+			assert.Equal(t, len(p.est.Segments), est.Count())
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestEstimateSegmentsPreservesMR(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGS=23\r": {"\n>"},
+		"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(rune(26)): {"\r\n", "+CMGS: 44\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	_, err := g.EstimateSegments("test message")
+	require.Nil(t, err)
+	_, err = g.EstimateSegments(strings.Repeat("a", 200))
+	require.Nil(t, err)
+	// the first send still uses an MR of 1
+	mr, err := g.SendShortMessage("+123456789", "test message")
+	require.Nil(t, err)
+	assert.Equal(t, "44", mr)
+}
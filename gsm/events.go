@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// Event is an event published to an EventBus.
+//
+// Events are identified by their concrete type, such as Message,
+// VoicemailWaiting or ErrorEvent.
+type Event interface{}
+
+// ErrorEvent is published for errors detected while processing asynchronous
+// events, such as received messages.
+type ErrorEvent struct {
+	Err error
+}
+
+// EventHandler receives events from an EventBus.
+type EventHandler func(Event)
+
+// EventBus distributes events from the modem to subscribers, so applications
+// can consume a single stream of events rather than registering separate
+// handlers for each.
+type EventBus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[int]subscription
+}
+
+type subscription struct {
+	h     EventHandler
+	types map[reflect.Type]bool
+}
+
+// NewEventBus creates a new EventBus.
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[int]subscription)}
+}
+
+// Subscribe registers a handler for events.
+//
+// If event prototypes are provided then the handler only receives events of
+// the same types, e.g.
+//
+//	bus.Subscribe(h, gsm.Message{}, gsm.VoicemailWaiting{})
+//
+// else it receives all events.
+//
+// The handler is called from the goroutine publishing the event, so should
+// not block.
+//
+// The returned function cancels the subscription.
+func (b *EventBus) Subscribe(h EventHandler, prototypes ...Event) func() {
+	s := subscription{h: h}
+	if len(prototypes) > 0 {
+		s.types = make(map[reflect.Type]bool)
+		for _, p := range prototypes {
+			s.types[reflect.TypeOf(p)] = true
+		}
+	}
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = s
+	b.mu.Unlock()
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+	}
+}
+
+// Publish passes the event to all interested subscribers.
+func (b *EventBus) Publish(e Event) {
+	t := reflect.TypeOf(e)
+	b.mu.RLock()
+	hh := make([]EventHandler, 0, len(b.subs))
+	for _, s := range b.subs {
+		if s.types == nil || s.types[t] {
+			hh = append(hh, s.h)
+		}
+	}
+	b.mu.RUnlock()
+	for _, h := range hh {
+		h(e)
+	}
+}
+
+// EventBusOption specifies a bus to publish events to.
+//
+// It may be applied to New, for events such as UnsupportedCommand, and to
+// StartMessageRx, for received messages and the like.
+type EventBusOption struct {
+	b *EventBus
+}
+
+func (o EventBusOption) applyOption(g *GSM) {
+	g.bus = o.b
+}
+
+func (o EventBusOption) applyRxOption(c *rxConfig) {
+	c.bus = o.b
+}
+
+// WithEventBus specifies a bus to publish events to.
+//
+// When applied to StartMessageRx, received events are published in addition
+// to being passed to the handlers provided to StartMessageRx.  Received
+// messages are published as Message, errors as ErrorEvent, and voicemail
+// waiting indications as VoicemailWaiting.  Voicemail waiting indications
+// are only discarded from the received messages, and +CIEV indications only
+// enabled, if WithVoicemailHandler is also applied.  SIM data download messages are
+// published as tpdu.TPDU if WithDataDownloadHandler is also applied, one
+// time passwords as OTPReceived if WithOTPExtraction is also applied, and
+// clock skew as ClockSkew if WithClockSkewDetection is also applied, and
+// status reports as StatusReport if WithStatusReports is also applied.
+//
+// The handlers provided to StartMessageRx may be nil when a bus is provided.
+//
+// When applied to New, warnings such as UnsupportedCommand are published.
+func WithEventBus(b *EventBus) EventBusOption {
+	return EventBusOption{b}
+}
+
+// publish extends the handlers to also publish to the bus.
+func (c *rxConfig) publish(mh MessageHandler, eh ErrorHandler) (MessageHandler, ErrorHandler) {
+	b := c.bus
+	pmh := func(m Message) {
+		if mh != nil {
+			mh(m)
+		}
+		b.Publish(m)
+	}
+	peh := func(err error) {
+		if eh != nil {
+			eh(err)
+		}
+		b.Publish(ErrorEvent{err})
+	}
+	// wrapping a nil vmh would enable voicemail handling, so indications
+	// are only published by the receive path in that case.
+	if vmh := c.vmh; vmh != nil {
+		c.vmh = func(vmw VoicemailWaiting) {
+			vmh(vmw)
+			b.Publish(vmw)
+		}
+	}
+	if c.reports {
+		srh := c.srh
+		c.srh = func(sr StatusReport) {
+			if srh != nil {
+				srh(sr)
+			}
+			b.Publish(sr)
+		}
+	}
+	if ddh := c.ddh; ddh != nil {
+		c.ddh = func(tp tpdu.TPDU) {
+			ddh(tp)
+			b.Publish(tp)
+		}
+	}
+	return pmh, peh
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestEventBus(t *testing.T) {
+	b := gsm.NewEventBus()
+	var all, msgs []gsm.Event
+	cancelAll := b.Subscribe(func(e gsm.Event) {
+		all = append(all, e)
+	})
+	cancelMsgs := b.Subscribe(func(e gsm.Event) {
+		msgs = append(msgs, e)
+	}, gsm.Message{})
+
+	msg := gsm.Message{Number: "+1234", Message: "hello"}
+	ee := gsm.ErrorEvent{errors.New("oops")}
+	b.Publish(msg)
+	b.Publish(ee)
+	assert.Equal(t, []gsm.Event{msg, ee}, all)
+	assert.Equal(t, []gsm.Event{msg}, msgs)
+
+	// cancelled
+	cancelMsgs()
+	b.Publish(msg)
+	assert.Equal(t, []gsm.Event{msg, ee, msg}, all)
+	assert.Equal(t, []gsm.Event{msg}, msgs)
+	cancelAll()
+	b.Publish(msg)
+	assert.Equal(t, 3, len(all))
+}
+
+func TestWithEventBus(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	b := gsm.NewEventBus()
+	events := make(chan gsm.Event, 3)
+	b.Subscribe(func(e gsm.Event) {
+		events <- e
+	})
+	err := g.StartMessageRx(nil, nil, gsm.WithEventBus(b))
+	require.Nil(t, err)
+
+	oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+	next := func() gsm.Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(100 * time.Millisecond):
+			t.Errorf("no event received")
+			return nil
+		}
+	}
+
+	// message
+	mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, UD: []byte("hello")}))
+	e := next()
+	require.IsType(t, gsm.Message{}, e)
+	assert.Equal(t, "+1234", e.(gsm.Message).Number)
+	assert.Equal(t, "hello", e.(gsm.Message).Message)
+
+	// voicemail - published, but not discarded without a voicemail handler
+	mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, DCS: 0xc8, UD: []byte("vm")}))
+	assert.Equal(t, gsm.VoicemailWaiting{Active: true, Line: 1}, next())
+	e = next()
+	require.IsType(t, gsm.Message{}, e)
+	assert.Equal(t, "vm", e.(gsm.Message).Message)
+	assert.NotContains(t, mm.written(), "AT+CIND=?\r\n")
+}
+
+func TestWithEventBusVoicemailHandler(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	b := gsm.NewEventBus()
+	events := make(chan gsm.Event, 3)
+	b.Subscribe(func(e gsm.Event) {
+		events <- e
+	})
+	vmws := make(chan gsm.VoicemailWaiting, 3)
+	vmh := func(vmw gsm.VoicemailWaiting) {
+		vmws <- vmw
+	}
+	err := g.StartMessageRx(nil, nil,
+		gsm.WithEventBus(b),
+		gsm.WithVoicemailHandler(vmh))
+	require.Nil(t, err)
+
+	// voicemail - passed to the handler and published, and discarded
+	oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+	mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, DCS: 0xc8, UD: []byte("vm")}))
+	vmw := gsm.VoicemailWaiting{Active: true, Line: 1}
+	select {
+	case e := <-events:
+		assert.Equal(t, vmw, e)
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("no event received")
+	}
+	select {
+	case v := <-vmws:
+		assert.Equal(t, vmw, v)
+	default:
+		t.Errorf("no voicemail indication received")
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event: %v", e)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
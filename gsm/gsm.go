@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/warthog618/modem/at"
@@ -20,11 +21,67 @@ import (
 )
 
 // GSM modem decorates the AT modem with GSM specific functionality.
+//
+// A GSM is safe for concurrent use by multiple goroutines, including sends
+// issued while messages are being received via StartMessageRx.
+//
+// Sends are serialised, so the PDUs of a long message are sent contiguously,
+// without PDUs from other sends interleaved, and TP-MRs are assigned in the
+// order the PDUs are sent.  Received messages are passed to the message
+// handler one at a time.
 type GSM struct {
 	*at.AT
-	sca     pdumode.SMSCAddress
-	pduMode bool
-	eOpts   []sms.EncoderOption
+	sca       pdumode.SMSCAddress
+	pduMode   bool
+	eOpts     []sms.EncoderOption
+	mr        *refCounter
+	concatRef *refCounter
+	sched     *scheduler
+	gate      *sendGate
+	breaker   *circuitBreaker
+	bus       *EventBus
+	reports   *reportRouter
+
+	// sendMu serialises sends, from encoding through to the final +CMGS.
+	sendMu sync.Mutex
+
+	// cpmsMu serialises temporary changes to the read storage.
+	cpmsMu sync.Mutex
+
+	// the error reporting mode set by Init, or -1 to select automatically.
+	cmee int
+
+	// whether Init checks the modem is GSM capable.
+	gcapCheck bool
+
+	// the period Init waits for the SIM to become ready.
+	simReadyTimeout time.Duration
+
+	// mu protects the cached state below.
+	mu sync.Mutex
+
+	// the numbers returned by +CNUM, cached after the first successful read.
+	ownNumbers []OwnNumber
+
+	// the commands found to be unsupported by the modem.
+	unsupported map[string]bool
+
+	// if not-nil, the active signal watch started by StartSignalRx.
+	signal *signalWatch
+
+	// if not-nil, passes stored TPDUs to the receiver started by
+	// StartMessageRx.
+	rxStored StoredPDUHandler
+
+	// if not-nil, restores the modem configuration set by StartMessageRx,
+	// such as after the modem has been reset by Init.
+	rxRestore func() error
+
+	// if not-nil, the tracer creating spans for sends and receives.
+	tracer at.Tracer
+
+	// whether text messages are transliterated to the GSM 7-bit alphabet.
+	translit bool
 }
 
 // Option is a construction option for the GSM.
@@ -39,7 +96,16 @@ type RxOption interface {
 
 // New creates a new GSM modem.
 func New(a *at.AT, options ...Option) *GSM {
-	g := GSM{AT: a, pduMode: true}
+	g := GSM{
+		AT:        a,
+		pduMode:   true,
+		gcapCheck: true,
+		cmee:      -1,
+		mr:        newRefCounter(1, 0xff),
+		concatRef: newRefCounter(1, 0xff),
+		sched:     newScheduler(),
+		reports:   newReportRouter(),
+	}
 	for _, option := range options {
 		option.applyOption(&g)
 	}
@@ -69,7 +135,8 @@ func (o initialCmdOption) applyRxOption(c *rxConfig) {
 
 // WithInitialCommand overrides the initial command
 //
-// The default is "+CNMI=1,2,0,0,0"
+// The default is "+CNMI=1,2,0,0,0", falling back to "+CNMI=2,2,0,0,0", as
+// per WithCNMI.  The initial command is not subject to fallback.
 func WithInitialCommand(cmd string) RxOption {
 	return initialCmdOption(cmd)
 }
@@ -137,59 +204,138 @@ func WithReassemblyTimeout(d time.Duration) RxOption {
 	return timeoutOption(d)
 }
 
+type gcapCheckOption bool
+
+func (o gcapCheckOption) applyOption(g *GSM) {
+	g.gcapCheck = bool(o)
+}
+
+// WithoutGCAPCheck specifies that Init should not check that the modem is GSM
+// capable.
+//
+// This is for modems that support the SMS commands but do not report +CGSM in
+// their +GCAP response, and do not support the +CMGF=? fallback check.
+var WithoutGCAPCheck = gcapCheckOption(false)
+
+type errorReportingOption int
+
+func (o errorReportingOption) applyOption(g *GSM) {
+	g.cmee = int(o)
+}
+
+// WithErrorReporting specifies the +CMEE error reporting mode set by Init.
+//
+// The mode is 0 for no error details, 1 for numeric errors, or 2 for textual
+// errors.  Numeric errors can be translated to text using the Text method of
+// at.CMEError and at.CMSError.
+//
+// By default Init requests textual errors, falling back to numeric errors if
+// the modem does not support textual errors.
+func WithErrorReporting(mode int) Option {
+	return errorReportingOption(mode)
+}
+
 // Init initialises the GSM modem.
+//
+// If a report is provided using at.WithDiagnostics, the transcript covers the
+// complete GSM initialisation, not just the AT initialisation.
 func (g *GSM) Init(options ...at.InitOption) (err error) {
+	for _, o := range options {
+		if r, ok := o.(*at.DiagnosticsReport); ok && g.StartDiagnostics(r) {
+			defer func() {
+				g.StopDiagnostics()
+				r.Err = err
+			}()
+		}
+	}
+	// the SIM may have changed, so flush any cached state.
+	g.mu.Lock()
+	g.ownNumbers = nil
+	g.mu.Unlock()
 	if err = g.AT.Init(options...); err != nil {
 		return
 	}
-	// test GCAP response to ensure +GSM support, and modem sync.
-	var i []string
-	i, err = g.Command("+GCAP")
-	if err != nil {
-		return
+	if g.gcapCheck {
+		if err = g.checkGSMCapable(); err != nil {
+			return
+		}
 	}
-	capabilities := make(map[string]bool)
-	for _, l := range i {
-		if info.HasPrefix(l, "+GCAP") {
-			caps := strings.Split(info.TrimPrefix(l, "+GCAP"), ",")
-			for _, cap := range caps {
-				capabilities[cap] = true
-			}
+	if g.simReadyTimeout > 0 {
+		if err = g.waitSIMReady(); err != nil {
+			return
 		}
 	}
-	if !capabilities["+CGSM"] {
-		return ErrNotGSMCapable
+	cmgf := "+CMGF=1" // text mode
+	if g.pduMode {
+		cmgf = "+CMGF=0" // pdu mode
 	}
-	cmds := []string{
-		"+CMGF=1", // text mode
-		"+CMEE=2", // textual errors
+	if _, err = g.Command(cmgf); err != nil {
+		return
 	}
-	if g.pduMode {
-		cmds[0] = "+CMGF=0" // pdu mode
+	return g.setErrorReporting()
+}
+
+// setErrorReporting configures the modem error reporting mode.
+//
+// Unless the mode has been set explicitly, textual errors are requested,
+// falling back to numeric errors if the modem does not support textual.
+func (g *GSM) setErrorReporting() (err error) {
+	if g.cmee >= 0 {
+		_, err = g.Command(fmt.Sprintf("+CMEE=%d", g.cmee))
+		return
 	}
-	for _, cmd := range cmds {
-		_, err = g.Command(cmd)
-		if err != nil {
-			return
-		}
+	if _, err = g.Command("+CMEE=2"); err == nil {
+		return
 	}
+	_, err = g.Command("+CMEE=1")
 	return
 }
 
 // SendShortMessage sends an SMS message to the number.
 //
 // If the modem is in PDU mode then the message is converted to a single SMS
-// PDU.
+// PDU.  In text mode the message is encoded by the modem, so
+// WithEncoderOptionOnce and WithMRHandler return ErrWrongMode.
 //
 // The mr is returned on success, else an error.
 func (g *GSM) SendShortMessage(number string, message string, options ...at.CommandOption) (rsp string, err error) {
+	span := g.startSpan("SMS send")
+	defer func() {
+		var mr []string
+		if len(rsp) > 0 {
+			mr = []string{rsp}
+		}
+		endSendSpan(span, mr, err)
+	}()
+	if err = checkNumber(number); err != nil {
+		return
+	}
+	cfg, options := g.sendConfig(number, options)
+	defer cfg.cancel()
+	if !g.pduMode && cfg.pduOnly {
+		err = ErrWrongMode
+		return
+	}
+	release, err := g.waitForService(cfg.ctx)
+	if err != nil {
+		return
+	}
+	defer g.sched.urgent()()
+	g.sendMu.Lock()
+	defer g.sendMu.Unlock()
+	release()
+	if cfg.ctx != nil {
+		if err = cfg.ctx.Err(); err != nil {
+			return
+		}
+	}
 	if g.pduMode {
 		var pdus []tpdu.TPDU
-		eOpts := append(g.eOpts, sms.To(number))
-		pdus, err = sms.Encode([]byte(message), eOpts...)
+		pdus, err = g.encode(message, cfg)
 		if err != nil {
 			return
 		}
+		span.SetAttribute("sms.parts", len(pdus))
 		if len(pdus) > 1 {
 			err = ErrOverlength
 			return
@@ -199,10 +345,18 @@ func (g *GSM) SendShortMessage(number string, message string, options ...at.Comm
 		if err != nil {
 			return
 		}
-		return g.SendPDU(tp, options...)
+		if cfg.mrh != nil {
+			cfg.mrh(int(pdus[0].MR))
+		}
+		return g.sendPDU(tp, options...)
+	}
+	span.SetAttribute("sms.parts", 1)
+	var text string
+	if text, err = sanitizeText(g.text(message)); err != nil {
+		return
 	}
 	var i []string
-	i, err = g.SMSCommand("+CMGS=\""+number+"\"", message, options...)
+	i, err = g.sendCommand("+CMGS=\""+number+"\"", text, options...)
 	if err != nil {
 		return
 	}
@@ -223,31 +377,63 @@ func (g *GSM) SendShortMessage(number string, message string, options ...at.Comm
 // The message is split into concatenated SMS PDUs, if necessary.
 //
 // The mr of send PDUs is returned on success, else an error.
+//
+// If the send is cancelled, using WithContext, times out, using
+// WithSendTimeout, or fails part way through, the mr of the PDUs already sent
+// are returned along with the error.
 func (g *GSM) SendLongMessage(number string, message string, options ...at.CommandOption) (rsp []string, err error) {
+	span := g.startSpan("SMS send")
+	defer func() {
+		endSendSpan(span, rsp, err)
+	}()
 	if !g.pduMode {
 		err = ErrWrongMode
 		return
 	}
+	if err = checkNumber(number); err != nil {
+		return
+	}
 	var pdus []tpdu.TPDU
-	eOpts := append(g.eOpts, sms.To(number))
-	pdus, err = sms.Encode([]byte(message), eOpts...)
+	cfg, options := g.sendConfig(number, options)
+	defer cfg.cancel()
+	release, err := g.waitForService(cfg.ctx)
 	if err != nil {
 		return
 	}
-	for _, p := range pdus {
+	defer g.sched.urgent()()
+	g.sendMu.Lock()
+	defer g.sendMu.Unlock()
+	release()
+	pdus, err = g.encode(message, cfg)
+	if err != nil {
+		return
+	}
+	span.SetAttribute("sms.parts", len(pdus))
+	for n, p := range pdus {
+		if cfg.ctx != nil {
+			if err = cfg.ctx.Err(); err != nil {
+				return
+			}
+		}
 		var tp []byte
 		tp, err = p.MarshalBinary()
 		if err != nil {
 			return
 		}
+		if cfg.mrh != nil {
+			cfg.mrh(int(p.MR))
+		}
 		var mr string
-		mr, err = g.SendPDU(tp, options...)
+		mr, err = g.sendPDU(tp, options...)
 		if len(mr) > 0 {
 			rsp = append(rsp, mr)
 		}
 		if err != nil {
 			return
 		}
+		if cfg.ph != nil {
+			cfg.ph(n+1, len(pdus), mr)
+		}
 	}
 	return
 }
@@ -260,6 +446,31 @@ func (g *GSM) SendPDU(tpdu []byte, options ...at.CommandOption) (rsp string, err
 	if !g.pduMode {
 		return "", ErrWrongMode
 	}
+	cfg, options := g.sendConfig("", options)
+	defer cfg.cancel()
+	if cfg.srr {
+		tpdu = withSRR(tpdu)
+	}
+	release, err := g.waitForService(cfg.ctx)
+	if err != nil {
+		return
+	}
+	defer g.sched.urgent()()
+	g.sendMu.Lock()
+	defer g.sendMu.Unlock()
+	release()
+	if cfg.ctx != nil {
+		if err = cfg.ctx.Err(); err != nil {
+			return
+		}
+	}
+	return g.sendPDU(tpdu, options...)
+}
+
+// sendPDU sends an SMS PDU.
+//
+// Must be called with sendMu held.
+func (g *GSM) sendPDU(tpdu []byte, options ...at.CommandOption) (rsp string, err error) {
 	pdu := pdumode.PDU{SMSC: g.sca, TPDU: tpdu}
 	var s string
 	s, err = pdu.MarshalHexString()
@@ -267,7 +478,7 @@ func (g *GSM) SendPDU(tpdu []byte, options ...at.CommandOption) (rsp string, err
 		return
 	}
 	var i []string
-	i, err = g.SMSCommand(fmt.Sprintf("+CMGS=%d", len(tpdu)), s, options...)
+	i, err = g.sendCommand(fmt.Sprintf("+CMGS=%d", len(tpdu)), s, options...)
 	if err != nil {
 		return
 	}
@@ -275,6 +486,7 @@ func (g *GSM) SendPDU(tpdu []byte, options ...at.CommandOption) (rsp string, err
 	for _, l := range i {
 		if info.HasPrefix(l, "+CMGS") {
 			rsp = info.TrimPrefix(l, "+CMGS")
+			g.mr.sync(rsp)
 			return
 		}
 	}
@@ -290,8 +502,64 @@ func (g *GSM) SendPDU(tpdu []byte, options ...at.CommandOption) (rsp string, err
 type Message struct {
 	Number  string
 	Message string
-	SCTS    tpdu.Timestamp
-	TPDUs   []*tpdu.TPDU
+
+	// SCTS is the time the SMSC received the message, in the time zone
+	// encoded in the timestamp.
+	SCTS tpdu.Timestamp
+
+	// Class is the message class, as determined from the DCS of the first
+	// TPDU, or tpdu.MClassUnknown if no class is indicated.
+	Class tpdu.MessageClass
+
+	// OA is the originating address, including the type of number and
+	// numbering plan, of which the Number is the string form.
+	OA tpdu.Address
+
+	// PID is the TP-PID of the first TPDU.
+	PID byte
+
+	// DCS is the TP-DCS of the first TPDU.
+	DCS tpdu.DCS
+
+	// Alphabet is the alphabet the message was encoded with, as determined
+	// from the DCS.
+	Alphabet tpdu.Alphabet
+
+	// UDH is the user data header of the first TPDU, or nil if it has none.
+	UDH tpdu.UserDataHeader
+
+	// Ports are the application ports the message is addressed to, or nil
+	// if the message does not use application port addressing.
+	Ports *ApplicationPorts
+
+	// Segments is the number of TPDUs the message was concatenated from, or 1
+	// if the message was not concatenated.
+	Segments int
+
+	// ConcatRef is the concatenation reference number shared by the TPDUs
+	// of a concatenated message, or -1 if the message was not concatenated.
+	ConcatRef int
+
+	// Ack is the outcome of acknowledging the TPDU that completed the
+	// message.
+	Ack AckStatus
+
+	// Received is the time the indication of the TPDU that completed the
+	// message was read from the modem, or the time the TPDU was read from
+	// storage if it was not indicated.
+	//
+	// It includes a monotonic clock reading, so may be compared with the
+	// times of other events to determine their order and latency.
+	Received time.Time
+
+	// Slots are the locations in the modem message storage of the TPDUs
+	// forming the message, for those TPDUs read from storage, such as those
+	// indicated by +CMTI, so they can later be re-read or deleted.
+	//
+	// Empty if the message was delivered directly, via +CMT.
+	Slots []StorageSlot
+
+	TPDUs []*tpdu.TPDU
 }
 
 // MessageHandler receives a decoded SMS message from the modem.
@@ -311,6 +579,32 @@ type rxConfig struct {
 	timeout    time.Duration
 	c          Collector
 	initialCmd string
+	cnmi       []string
+	vmh        VoicemailHandler
+	ddh        DataDownloadHandler
+	dedup      int
+	dedupSet   *DedupSet
+	bus        *EventBus
+	otp        *otpOption
+	skew       *clockSkewOption
+	srh        StatusReportHandler
+
+	// whether status reports are forwarded via +CDS.
+	reports bool
+
+	// whether unread messages in storage are received before enabling
+	// indications.
+	drain bool
+
+	// whether messages received by the drain are deleted from storage.
+	drainDelete bool
+
+	// whether messages are stored and indicated by +CMTI, then deleted once
+	// received.
+	cmti bool
+
+	// the number of consecutive +CNMA failures before falling back to +CMTI.
+	ackThreshold int
 }
 
 // StartMessageRx sets up the modem to receive SMS messages and pass them to
@@ -320,83 +614,540 @@ type rxConfig struct {
 // reassembled into a complete message before being passed to the message
 // handler.
 //
+// Messages that the network directs to SIM storage, such as class 2
+// messages, are stored by the modem and indicated via +CMTI.  These are read
+// from storage and passed to the message handler in the same manner as other
+// messages, with the class, and the storage slots the message was read from,
+// available in the Message.
+//
+// Unread messages already in storage are received before the delivery of new
+// messages is enabled if WithStartupDrain is applied, and are deleted from
+// storage once passed to the message handler if WithDrainDeletion is also
+// applied.
+//
+// The modem is directed to forward received messages using +CNMI, trying the
+// candidate settings provided by WithCNMI in turn until one is accepted.  If
+// WithCMTI is applied the modem is instead directed to store received
+// messages and indicate them with +CMTI, and they are deleted from storage
+// once received.
+//
 // Errors detected while receiving messages are passed to the error handler.
 //
-// Requires the modem to be in PDU mode.
+// Received messages are acknowledged using +CNMA if the Phase 2+ message
+// service is selected.  If the modem does not support +CNMA then the Phase 2
+// service is selected instead, so the modem acknowledges messages itself.
+// The outcome of the acknowledgement is reported in the Message Ack field.
+// If acknowledgement fails repeatedly then the modem is switched to +CMTI,
+// which does not require acknowledgement, and an ErrAckFallback is passed to
+// the error handler.
+//
+// In text mode the modem is configured with +CSDH=1, where supported, so the
+// received messages include the header fields required to decode them, as
+// per UnmarshalTextTPDU.  Status reports and the startup drain require PDU
+// mode, so WithStatusReports and WithStartupDrain return ErrWrongMode in text
+// mode.
 func (g *GSM) StartMessageRx(mh MessageHandler, eh ErrorHandler, options ...RxOption) error {
-	if !g.pduMode {
-		return ErrWrongMode
-	}
 	cfg := rxConfig{
-		timeout:    24 * time.Hour,
-		initialCmd: "+CNMI=1,2,0,0,0",
+		timeout:      24 * time.Hour,
+		ackThreshold: 3,
 	}
 	for _, option := range options {
 		option.applyRxOption(&cfg)
 	}
+	// the candidate +CNMI commands, in order of preference.
+	cnmi := cfg.cnmi
+	if cfg.initialCmd != "" {
+		cnmi = []string{cfg.initialCmd}
+	} else if len(cnmi) == 0 {
+		cnmi = defaultCNMI
+	}
+	unmarshal := UnmarshalTPDU
+	read := func(index int) (tpdu.TPDU, error) {
+		sp, err := g.ReadPDU(index)
+		return sp.TPDU, err
+	}
+	if !g.pduMode {
+		if cfg.reports || cfg.drain {
+			return ErrWrongMode
+		}
+		unmarshal = UnmarshalTextTPDU
+		read = func(index int) (tpdu.TPDU, error) {
+			return g.readText(index)
+		}
+		// show the header fields required to decode the message.
+		g.optionalCommand("+CSDH=1")
+	}
+	if cfg.reports || cfg.cmti {
+		rcnmi := make([]string, len(cnmi))
+		for n, cmd := range cnmi {
+			if cfg.reports {
+				cmd = cnmiWithReports(cmd)
+			}
+			if cfg.cmti {
+				cmd = cnmiWithoutAck(cmd)
+			}
+			rcnmi[n] = cmd
+		}
+		cnmi = rcnmi
+	}
+	if cfg.bus != nil {
+		mh, eh = cfg.publish(mh, eh)
+	}
+	if cfg.otp != nil {
+		mh = cfg.otp.extend(mh, cfg.bus)
+	}
+	if cfg.skew != nil {
+		mh = cfg.skew.extend(mh, cfg.bus)
+	}
+	slots := newSlotTracker()
 	if cfg.c == nil {
 		rto := func(tpdus []*tpdu.TPDU) {
+			slots.release(tpdus)
 			eh(ErrReassemblyTimeout{tpdus})
 		}
 		cfg.c = sms.NewCollector(sms.WithReassemblyTimeout(cfg.timeout, rto))
 	}
-	cmtHandler := func(info []string) {
-		tp, err := UnmarshalTPDU(info)
-		if err != nil {
-			eh(ErrUnmarshal{info, err})
+	ak := acker{
+		g:         g,
+		threshold: cfg.ackThreshold,
+		cnmi:      cnmi[0],
+	}
+	if !cfg.cmti || cfg.reports {
+		// both +CMT and +CDS require acknowledgement in the Phase 2+
+		// service.
+		required := g.ackRequired()
+		ak.required = required && !cfg.cmti
+		ak.reportsRequired = required && cfg.reports
+	}
+	dc := cfg.dedupSet
+	if dc == nil && cfg.dedup > 0 {
+		dc = NewDedupSet(cfg.dedup)
+	}
+	if dc == nil && cfg.drain {
+		dc = NewDedupSet(startupDrainDedup)
+	}
+	// rxMu serialises the processing of received TPDUs, as the indication
+	// handlers may run concurrently, so the message and error handlers are
+	// called one at a time.
+	var rxMu sync.Mutex
+	// the slots of messages received while draining, to be deleted once the
+	// drain is complete.
+	var drained []StorageSlot
+	draining := cfg.drain && cfg.drainDelete
+	// the slots indicated by +CMTI, if they are to be deleted once their
+	// messages are dispatched, and those ready for deletion.
+	cmtiSlots := make(map[StorageSlot]bool)
+	var dispatched []StorageSlot
+	dispatch := func(ss ...StorageSlot) {
+		for _, slot := range ss {
+			if cmtiSlots[slot] {
+				delete(cmtiSlots, slot)
+				dispatched = append(dispatched, slot)
+			}
+		}
+	}
+	rx := func(tp tpdu.TPDU, as AckStatus, slot *StorageSlot, t time.Time, span at.Span) (err error) {
+		discard := func() {
+			if slot != nil {
+				dispatch(*slot)
+			}
+		}
+		if dc != nil && dc.seen(&tp) {
+			discard()
 			return
 		}
-		g.Command("+CNMA")
-		tpdus, err := cfg.c.Collect(tp)
-		if err != nil {
-			eh(ErrCollect{tp, err})
+		if cfg.ddh != nil && tp.PID == pidSIMDataDownload {
+			cfg.ddh(tp)
+			discard()
 			return
 		}
+		if cfg.vmh != nil {
+			vmw, vmDiscard := voicemailWaiting(&tp)
+			if vmw != nil {
+				cfg.vmh(*vmw)
+			}
+			if vmDiscard {
+				discard()
+				return
+			}
+		} else if cfg.bus != nil {
+			// publish the indication, but leave the message to be
+			// delivered, as voicemail handling has not been requested.
+			if vmw, _ := voicemailWaiting(&tp); vmw != nil {
+				cfg.bus.Publish(*vmw)
+			}
+		}
+		slots.add(&tp, slot)
+		tpdus, cerr := cfg.c.Collect(tp)
+		if cerr != nil {
+			slots.release([]*tpdu.TPDU{&tp})
+			return ErrCollect{tp, cerr}
+		}
+		span.SetAttribute("sms.complete", tpdus != nil)
 		if tpdus == nil {
 			return
 		}
-		m, err := sms.Decode(tpdus)
-		if err != nil {
-			eh(ErrDecode{tpdus, err})
+		m, derr := sms.Decode(tpdus)
+		if derr != nil {
+			err = ErrDecode{tpdus, derr}
 		}
 		if m != nil {
-			mh(Message{
-				Number:  tpdus[0].OA.Number(),
-				Message: string(m),
-				SCTS:    tpdus[0].SCTS,
-				TPDUs:   tpdus,
+			class, _ := tpdus[0].DCS.Class()
+			msg := Message{
+				Number:   tpdus[0].OA.Number(),
+				Message:  string(m),
+				SCTS:     tpdus[0].SCTS,
+				Class:    class,
+				Ack:      as,
+				Received: t,
+				Slots:    slots.release(tpdus),
+				TPDUs:    tpdus,
+			}
+			msg.setMetadata()
+			mh(msg)
+			if draining {
+				drained = append(drained, msg.Slots...)
+			}
+			dispatch(msg.Slots...)
+		} else {
+			slots.release(tpdus)
+		}
+		return
+	}
+	cmtHandler := func(info []string, t time.Time) {
+		span := g.startSpan("SMS receive")
+		span.SetAttribute("sms.indication", "+CMT")
+		var as AckStatus
+		var aerr error
+		tp, err := unmarshal(info)
+		if err != nil {
+			err = ErrUnmarshal{info, err}
+		} else {
+			as, aerr = ak.ack()
+			span.SetAttribute("sms.ack", as.String())
+		}
+		rxMu.Lock()
+		if aerr != nil {
+			eh(aerr)
+		}
+		if err == nil {
+			err = rx(tp, as, nil, t, span)
+		}
+		if err != nil {
+			eh(err)
+		}
+		rxMu.Unlock()
+		span.End(err)
+	}
+	// messages the network directs to SIM storage, such as class 2, are
+	// stored by the modem and indicated by +CMTI, so read them from there.
+	cmtiHandler := func(info []string, t time.Time) {
+		span := g.startSpan("SMS receive")
+		span.SetAttribute("sms.indication", "+CMTI")
+		var tp tpdu.TPDU
+		slot, err := parseCMTI(info[0])
+		if err != nil {
+			err = ErrUnmarshal{info, err}
+		} else {
+			// the message is read from the storage it was indicated in,
+			// which need not be the read storage.
+			err = g.inMessageStorage(slot.Storage, func() (rerr error) {
+				tp, rerr = read(slot.Index)
+				return
 			})
 		}
+		rxMu.Lock()
+		if err == nil {
+			// after the fallback to +CMTI all messages are stored, so they
+			// are deleted once dispatched, as per WithCMTI, else the
+			// storage fills.
+			if cfg.cmti || ak.fallenBack() {
+				cmtiSlots[slot] = true
+			}
+			err = rx(tp, AckNotRequired, &slot, t, span)
+		}
+		if err != nil {
+			eh(err)
+		}
+		ds := dispatched
+		dispatched = nil
+		rxMu.Unlock()
+		span.End(err)
+		// deleted outside rxMu, so the deletions do not hold up the
+		// processing of other indications.
+		for _, slot := range ds {
+			derr := g.inMessageStorage(slot.Storage, func() error {
+				return g.DeleteMessage(slot.Index)
+			})
+			if derr != nil {
+				rxMu.Lock()
+				eh(derr)
+				rxMu.Unlock()
+			}
+		}
+	}
+	cdsHandler := func(info []string, t time.Time) {
+		span := g.startSpan("SMS status report")
+		var sr StatusReport
+		tp, err := UnmarshalTPDU(info)
+		if err != nil {
+			err = ErrUnmarshal{info, err}
+		} else {
+			// the ack is not affected by the report being unexpected.
+			ak.ackReport()
+			sr, err = NewStatusReport(&tp)
+		}
+		rxMu.Lock()
+		if err == nil {
+			span.SetAttribute("sms.mr", sr.MR)
+			g.reports.route(sr)
+			if cfg.srh != nil {
+				cfg.srh(sr)
+			}
+		} else {
+			eh(err)
+		}
+		rxMu.Unlock()
+		span.End(err)
+	}
+	// TPDUs read from storage other than via +CMTI, such as by draining the
+	// storage, are passed in by ReceiveStoredPDU.
+	storedHandler := func(sp StoredPDU) {
+		span := g.startSpan("SMS receive")
+		span.SetAttribute("sms.indication", "stored")
+		slot := StorageSlot{Index: sp.Index}
+		rxMu.Lock()
+		err := rx(sp.TPDU, AckNotRequired, &slot, time.Now(), span)
+		if err != nil {
+			eh(err)
+		}
+		rxMu.Unlock()
+		span.End(err)
 	}
-	err := g.AddIndication("+CMT:", cmtHandler, at.WithTrailingLine)
+	err := g.AddStampedIndication("+CMT:", cmtHandler, at.WithTrailingLine)
 	if err != nil {
 		return err
 	}
-	// tell the modem to forward SMS-DELIVERs via +CMT indications...
-	_, err = g.Command(cfg.initialCmd)
+	err = g.AddStampedIndication("+CMTI:", cmtiHandler)
 	if err != nil {
 		g.CancelIndication("+CMT:")
+		return err
 	}
-	return err
+	cancel := func() {
+		g.CancelIndication("+CMT:")
+		g.CancelIndication("+CMTI:")
+		if cfg.reports {
+			g.CancelIndication("+CDS:")
+		}
+	}
+	if cfg.reports {
+		err = g.AddStampedIndication("+CDS:", cdsHandler, at.WithTrailingLine)
+		if err != nil {
+			g.CancelIndication("+CMT:")
+			g.CancelIndication("+CMTI:")
+			return err
+		}
+	}
+	if cfg.drain {
+		err = g.ListPDUs(RecUnread, storedHandler, eh)
+		if err != nil {
+			cancel()
+			return err
+		}
+		rxMu.Lock()
+		draining = false
+		rxMu.Unlock()
+		// deleted after the listing, as commands cannot be issued from
+		// within the handlers.
+		for _, slot := range drained {
+			if derr := g.DeleteMessage(slot.Index); derr != nil {
+				eh(derr)
+			}
+		}
+	}
+	// tell the modem to forward SMS-DELIVERs via +CMT indications...
+	cmd, err := g.setCNMI(cnmi)
+	if err != nil {
+		cancel()
+		return err
+	}
+	ak.mu.Lock()
+	ak.cnmi = cmd
+	ak.mu.Unlock()
+	if cfg.vmh != nil {
+		g.startCIEVRx(cfg.vmh)
+	}
+	restore := func() error {
+		if !g.pduMode {
+			g.optionalCommand("+CSDH=1")
+		}
+		ak.mu.Lock()
+		cmd := ak.cnmi
+		fellBack := ak.fellBack
+		ak.mu.Unlock()
+		if fellBack {
+			cmd = cnmiWithoutAck(cmd)
+		}
+		if !fellBack && (!cfg.cmti || cfg.reports) {
+			// the message service may have been reset too.
+			required := g.ackRequired()
+			ak.mu.Lock()
+			ak.required = required && !cfg.cmti
+			ak.reportsRequired = required && cfg.reports
+			ak.mu.Unlock()
+		}
+		if _, err := g.Command(cmd); err != nil {
+			return err
+		}
+		if cfg.vmh != nil {
+			g.optionalCommand("+CMER=3,0,0,1")
+		}
+		return nil
+	}
+	g.mu.Lock()
+	g.rxStored = storedHandler
+	g.rxRestore = restore
+	g.mu.Unlock()
+	return nil
+}
+
+// restoreMessageRx restores the modem configuration set by StartMessageRx,
+// if messages are being received, as it is reset by Init.
+func (g *GSM) restoreMessageRx() error {
+	g.mu.Lock()
+	restore := g.rxRestore
+	g.mu.Unlock()
+	if restore == nil {
+		return nil
+	}
+	return restore()
+}
+
+// startCIEVRx passes changes to the "message" indicator, which indicates
+// voicemail waiting, to the voicemail handler.
+//
+// This is best effort, as not all modems support indicators, so errors are
+// ignored.
+func (g *GSM) startCIEVRx(vmh VoicemailHandler) {
+	i, err := g.optionalCommand("+CIND=?")
+	if err != nil {
+		return
+	}
+	msgInd := cindIndex(i, "message")
+	if msgInd == 0 {
+		return
+	}
+	ciev := func(info []string) {
+		ind, value, err := parseCIEV(info[0])
+		if err != nil || ind != msgInd {
+			return
+		}
+		vmh(VoicemailWaiting{Active: value != 0, Line: 1})
+	}
+	if g.AddIndication("+CIEV:", ciev) != nil {
+		return
+	}
+	// enable indicator event reporting
+	g.optionalCommand("+CMER=3,0,0,1")
 }
 
 // StopMessageRx ends the reception of messages started by StartMessageRx,
 func (g *GSM) StopMessageRx() {
 	// tell the modem to stop forwarding SMSs to us.
 	g.Command("+CNMI=0,0,0,0,0")
-	// and detach the handler
+	// and detach the handlers
 	g.CancelIndication("+CMT:")
+	g.CancelIndication("+CMTI:")
+	g.CancelIndication("+CDS:")
+	g.CancelIndication("+CIEV:")
+	g.mu.Lock()
+	g.rxStored = nil
+	g.rxRestore = nil
+	g.mu.Unlock()
 }
 
-// UnmarshalTPDU converts +CMT info into the corresponding SMS TPDU.
+// ReceiveStoredPDU passes a TPDU read from the modem message storage, such as
+// by ListPDUs, to the receiver started by StartMessageRx.
+//
+// The TPDU is processed as per those indicated by +CMTI, so the parts of a
+// concatenated message are reassembled regardless of whether they were
+// delivered via +CMT, indicated via +CMTI, or found in storage.  As the
+// storage the TPDU was read from is not known, only the Index of the
+// corresponding StorageSlot is set.
+//
+// Errors processing the TPDU are passed to the error handler provided to
+// StartMessageRx.  Returns ErrNotReceiving if messages are not being
+// received.
+func (g *GSM) ReceiveStoredPDU(sp StoredPDU) error {
+	g.mu.Lock()
+	h := g.rxStored
+	g.mu.Unlock()
+	if h == nil {
+		return ErrNotReceiving
+	}
+	h(sp)
+	return nil
+}
+
+// parseCMTI returns the storage slot from a +CMTI indication.
+//
+// The indication is of the form:
+//
+//	+CMTI: <mem>,<index>
+func parseCMTI(line string) (StorageSlot, error) {
+	fields := info.Fields(info.TrimPrefix(line, "+CMTI"))
+	if len(fields) < 2 {
+		return StorageSlot{}, ErrMalformedResponse
+	}
+	index, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return StorageSlot{}, err
+	}
+	return StorageSlot{Storage: fields[0], Index: index}, nil
+}
+
+// checkGSMCapable checks the modem is GSM capable, based on the +GCAP
+// response.
+//
+// If +GCAP fails or does not include +CGSM then support for +CMGF is used as
+// an alternative indication, as some modems that support SMS do not report
+// +CGSM.
+func (g *GSM) checkGSMCapable() error {
+	// test GCAP response to ensure +GSM support, and modem sync.
+	i, err := g.Command("+GCAP")
+	if err == nil {
+		for _, l := range i {
+			if info.HasPrefix(l, "+GCAP") {
+				caps := strings.Split(info.TrimPrefix(l, "+GCAP"), ",")
+				for _, cap := range caps {
+					if cap == "+CGSM" {
+						return nil
+					}
+				}
+			}
+		}
+		err = ErrNotGSMCapable
+	}
+	if _, cerr := g.Command("+CMGF=?"); cerr == nil {
+		return nil
+	}
+	return err
+}
+
+// UnmarshalTPDU converts +CMT, or +CDS, info into the corresponding SMS TPDU.
 func UnmarshalTPDU(info []string) (tp tpdu.TPDU, err error) {
 	if len(info) < 2 {
 		err = ErrUnderlength
 		return
 	}
+	// the length is the last field, and the only field for +CDS.
 	lstr := strings.Split(info[0], ",")
+	lf := lstr[len(lstr)-1]
+	if len(lstr) == 1 {
+		lf = strings.TrimSpace(lf[strings.IndexByte(lf, ':')+1:])
+	}
 	var l int
-	l, err = strconv.Atoi(lstr[len(lstr)-1])
+	l, err = strconv.Atoi(lf)
 	if err != nil {
 		return
 	}
@@ -471,10 +1222,29 @@ func (e ErrUnmarshal) Error() string {
 }
 
 var (
+	// ErrCircuitOpen indicates a send was not attempted as the circuit
+	// breaker is open, following persistent send failures.
+	ErrCircuitOpen = errors.New("send circuit breaker open")
+
+	// ErrInvalidAID indicates an AID is not a valid application identifier.
+	ErrInvalidAID = errors.New("invalid AID")
+
+	// ErrInvalidMMI indicates a string is not a valid MMI string.
+	ErrInvalidMMI = errors.New("invalid MMI string")
+
+	// ErrInvalidMR indicates a string is not a valid TP-MR.
+	ErrInvalidMR = errors.New("invalid message reference")
+
 	// ErrMalformedResponse indicates the modem returned a badly formed
 	// response.
 	ErrMalformedResponse = errors.New("modem returned malformed response")
 
+	// ErrNoLocation indicates no location is available.
+	ErrNoLocation = errors.New("no location available")
+
+	// ErrNoService indicates the modem has no network service.
+	ErrNoService = errors.New("no network service")
+
 	// ErrNotGSMCapable indicates that the modem does not support the GSM
 	// command set, as determined from the GCAP response.
 	ErrNotGSMCapable = errors.New("modem is not GSM capable")
@@ -483,6 +1253,14 @@ var (
 	// operations.
 	ErrNotPINReady = errors.New("modem is not PIN Ready")
 
+	// ErrNotReceiving indicates an operation requires messages to be
+	// received, using StartMessageRx, and they are not.
+	ErrNotReceiving = errors.New("not receiving messages")
+
+	// ErrNotStatusReport indicates a TPDU is not the SMS-STATUS-REPORT
+	// expected.
+	ErrNotStatusReport = errors.New("not a status report")
+
 	// ErrOverlength indicates the message is too long for a single PDU and
 	// must be split into multiple PDUs.
 	ErrOverlength = errors.New("message too long for one SMS")
@@ -491,6 +1269,9 @@ var (
 	// decode a PDU.
 	ErrUnderlength = errors.New("insufficient info")
 
+	// ErrUnsupported indicates the modem does not support a command.
+	ErrUnsupported = errors.New("command not supported by modem")
+
 	// ErrWrongMode indicates the GSM modem is operating in the wrong mode and
 	// so cannot support the command.
 	ErrWrongMode = errors.New("modem is in the wrong mode")
@@ -14,10 +14,13 @@
 package gsm_test
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -78,9 +81,9 @@ func TestInit(t *testing.T) {
 	// mocked
 	cmdSet := map[string][]string{
 		// for init (AT)
-		string(27) + "\r\n\r\n": {"\r\n"},
-		"ATZ\r\n":               {"OK\r\n"},
-		"ATE0\r\n":              {"OK\r\n"},
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"OK\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
 		// for init (GSM)
 		"AT+CMEE=2\r\n": {"OK\r\n"},
 		"AT+CMGF=1\r\n": {"OK\r\n"},
@@ -229,15 +232,139 @@ func TestInit(t *testing.T) {
 	}
 }
 
+func TestWithoutGCAPCheck(t *testing.T) {
+	cmdSet := map[string][]string{
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"OK\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
+		"AT+CMEE=2\r\n":               {"OK\r\n"},
+		"AT+CMGF=0\r\n":               {"OK\r\n"},
+		"AT+GCAP\r\n":                 {"+GCAP: +DS,+ES\r\n", "OK\r\n"},
+	}
+	patterns := []struct {
+		name  string
+		gopts []gsm.Option
+		cmgf  []string
+		err   error
+	}{
+		{"not GSM capable", nil, nil, gsm.ErrNotGSMCapable},
+		{"CMGF fallback", nil, []string{"+CMGF: (0,1)\r\n", "OK\r\n"}, nil},
+		{"without check", []gsm.Option{gsm.WithoutGCAPCheck}, nil, nil},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet["AT+CMGF=?\r\n"] = p.cmgf
+			mm := mockModem{
+				cmdSet:    cmdSet,
+				r:         make(chan []byte, 10),
+				readDelay: time.Millisecond,
+			}
+			defer teardownModem(&mm)
+			g := gsm.New(at.New(&mm), p.gopts...)
+			require.NotNil(t, g)
+			err := g.Init()
+			assert.Equal(t, p.err, err)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestWithErrorReporting(t *testing.T) {
+	cmdSet := map[string][]string{
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"OK\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
+		"AT+CMEE=1\r\n":               {"OK\r\n"},
+		"AT+CMEE=0\r\n":               {"OK\r\n"},
+		"AT+CMGF=0\r\n":               {"OK\r\n"},
+		"AT+GCAP\r\n":                 {"+GCAP: +CGSM,+DS,+ES\r\n", "OK\r\n"},
+	}
+	patterns := []struct {
+		name  string
+		gopts []gsm.Option
+		cmds  []string
+		err   error
+	}{
+		{
+			"fallback",
+			nil,
+			[]string{"AT+CMEE=2\r\n", "AT+CMEE=1\r\n"},
+			nil,
+		},
+		{
+			"explicit",
+			[]gsm.Option{gsm.WithErrorReporting(0)},
+			[]string{"AT+CMEE=0\r\n"},
+			nil,
+		},
+		{
+			"explicit unsupported",
+			[]gsm.Option{gsm.WithErrorReporting(2)},
+			[]string{"AT+CMEE=2\r\n"},
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			mm := mockModem{
+				cmdSet:    cmdSet,
+				r:         make(chan []byte, 10),
+				readDelay: time.Millisecond,
+			}
+			defer teardownModem(&mm)
+			g := gsm.New(at.New(&mm), p.gopts...)
+			require.NotNil(t, g)
+			err := g.Init()
+			assert.Equal(t, p.err, err)
+			var cmee []string
+			for _, cmd := range mm.written() {
+				if strings.HasPrefix(cmd, "AT+CMEE") {
+					cmee = append(cmee, cmd)
+				}
+			}
+			assert.Equal(t, p.cmds, cmee)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestInitDiagnostics(t *testing.T) {
+	cmdSet := map[string][]string{
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"OK\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
+		"AT+CMEE=2\r\n":               {"OK\r\n"},
+		"AT+GCAP\r\n":                 {"+GCAP: +CGSM,+DS,+ES\r\n", "OK\r\n"},
+	}
+	mm := mockModem{
+		cmdSet:    cmdSet,
+		r:         make(chan []byte, 10),
+		readDelay: time.Millisecond,
+	}
+	defer teardownModem(&mm)
+	g := gsm.New(at.New(&mm))
+	require.NotNil(t, g)
+	r := at.DiagnosticsReport{}
+	err := g.Init(at.WithDiagnostics(&r))
+	assert.Equal(t, at.ErrError, err)
+	assert.Equal(t, err, r.Err)
+	cmds := []string{}
+	for _, e := range r.Exchanges() {
+		cmds = append(cmds, e.Cmd)
+	}
+	assert.Equal(t, []string{"Z", "E0", "+GCAP", "+CMGF=0"}, cmds)
+}
+
 func TestSendShortMessage(t *testing.T) {
 	// mocked
 	cmdSet := map[string][]string{
-		"AT+CMGS=\"+123456789\"\r":        {"\n>"},
-		"AT+CMGS=23\r":                    {"\n>"},
-		"test message" + string(26):       {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
-		"cruft test message" + string(26): {"\r\n", "pad\r\n", "+CMGS: 43\r\n", "\r\nOK\r\n"},
-		"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(26): {"\r\n", "+CMGS: 44\r\n", "\r\nOK\r\n"},
-		"malformed test message" + string(26):                           {"\r\n", "pad\r\n", "\r\nOK\r\n"},
+		"AT+CMGS=\"+123456789\"\r":              {"\n>"},
+		"AT+CMGS=23\r":                          {"\n>"},
+		"test message" + string(rune(26)):       {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
+		"cruft test message" + string(rune(26)): {"\r\n", "pad\r\n", "+CMGS: 43\r\n", "\r\nOK\r\n"},
+		"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(rune(26)): {"\r\n", "+CMGS: 44\r\n", "\r\nOK\r\n"},
+		"008101099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(rune(26)): {"\r\n", "+CMGS: 45\r\n", "\r\nOK\r\n"},
+		"malformed test message" + string(rune(26)):                           {"\r\n", "pad\r\n", "\r\nOK\r\n"},
 	}
 	patterns := []struct {
 		name     string
@@ -331,6 +458,62 @@ func TestSendShortMessage(t *testing.T) {
 			tpdu.EncodeError("SmsSubmit.ud.sm", tpdu.ErrOddUCS2Length),
 			"",
 		},
+		{
+			"text mode encoder option once",
+			[]at.CommandOption{gsm.WithEncoderOptionOnce(sms.AsUCS2)},
+			[]gsm.Option{gsm.WithTextMode},
+			"+123456789",
+			"test message",
+			gsm.ErrWrongMode,
+			"",
+		},
+		{
+			"text mode mr handler",
+			[]at.CommandOption{gsm.WithMRHandler(func(int) {})},
+			[]gsm.Option{gsm.WithTextMode},
+			"+123456789",
+			"test message",
+			gsm.ErrWrongMode,
+			"",
+		},
+		{
+			"encode error once",
+			[]at.CommandOption{
+				gsm.WithEncoderOptionOnce(sms.WithTemplateOption(tpdu.DCS(0x80))),
+			},
+			nil,
+			"+123456789",
+			"test message",
+			sms.ErrDcsConflict,
+			"",
+		},
+		{
+			"marshal error once",
+			[]at.CommandOption{gsm.WithEncoderOptionOnce(sms.AsUCS2)},
+			nil,
+			"+123456789",
+			"an odd length string!",
+			tpdu.EncodeError("SmsSubmit.ud.sm", tpdu.ErrOddUCS2Length),
+			"",
+		},
+		{
+			"reply path",
+			nil,
+			[]gsm.Option{gsm.WithReplyPath},
+			"+123456789",
+			"test message",
+			nil,
+			"45",
+		},
+		{
+			"pduMode once",
+			[]at.CommandOption{gsm.WithEncoderOptionOnce(sms.WithCharset())},
+			nil,
+			"+123456789",
+			"test message",
+			nil,
+			"44",
+		},
 	}
 	for _, p := range patterns {
 		f := func(t *testing.T) {
@@ -352,9 +535,11 @@ func TestSendLongMessage(t *testing.T) {
 		"AT+CMGS=152\r": {"\n>"},
 		"AT+CMGS=47\r":  {"\n>"},
 		"AT+CMGS=32\r":  {"\r\n", "pad\r\n", "\r\nOK\r\n"},
-		"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(26): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
-		"004101099121436587f90000a0050003010201c2207b599e07b1dfee33885e9ed341edf27c1e3e97417474980ebaa7d96c90fb4d0799d374d03d4d47a7dda0b7bb0c9a36a72028b10a0acf41693a283d07a9eb733a88fe7e83d86ff719647ecb416f771904255641657bd90dbaa7e968d071da0495dde33739ed3eb34074f4bb7e4683f2ef3a681c7683cc693aa8fd9697416937e8ed2e83a0" + string(26): {"\r\n", "+CMGS: 43\r\n", "\r\nOK\r\n"},
-		"004102099121436587f90000270500030102028855101d1d7683f2ef3aa81dce83d2ee343d1d66b3f3a0321e5e1ed301" + string(26): {"\r\n", "+CMGS: 44\r\n", "\r\nOK\r\n"},
+		"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(rune(26)): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
+		"004101099121436587f90000a0050003010201c2207b599e07b1dfee33885e9ed341edf27c1e3e97417474980ebaa7d96c90fb4d0799d374d03d4d47a7dda0b7bb0c9a36a72028b10a0acf41693a283d07a9eb733a88fe7e83d86ff719647ecb416f771904255641657bd90dbaa7e968d071da0495dde33739ed3eb34074f4bb7e4683f2ef3a681c7683cc693aa8fd9697416937e8ed2e83a0" + string(rune(26)): {"\r\n", "+CMGS: 43\r\n", "\r\nOK\r\n"},
+		"004102099121436587f90000270500030102028855101d1d7683f2ef3aa81dce83d2ee343d1d66b3f3a0321e5e1ed301" + string(rune(26)): {"\r\n", "+CMGS: 44\r\n", "\r\nOK\r\n"},
+		"004101099121436587f90000a0050003200201c2207b599e07b1dfee33885e9ed341edf27c1e3e97417474980ebaa7d96c90fb4d0799d374d03d4d47a7dda0b7bb0c9a36a72028b10a0acf41693a283d07a9eb733a88fe7e83d86ff719647ecb416f771904255641657bd90dbaa7e968d071da0495dde33739ed3eb34074f4bb7e4683f2ef3a681c7683cc693aa8fd9697416937e8ed2e83a0" + string(rune(26)): {"\r\n", "+CMGS: 45\r\n", "\r\nOK\r\n"},
+		"004102099121436587f90000270500032002028855101d1d7683f2ef3aa81dce83d2ee343d1d66b3f3a0321e5e1ed301" + string(rune(26)): {"\r\n", "+CMGS: 46\r\n", "\r\nOK\r\n"},
 	}
 	patterns := []struct {
 		name     string
@@ -419,6 +604,15 @@ func TestSendLongMessage(t *testing.T) {
 			nil,
 			[]string{"43", "44"},
 		},
+		{
+			"concat ref seed",
+			nil,
+			[]gsm.Option{gsm.WithConcatRefSeed(0x20)},
+			"+123456789",
+			"a very long test message that will not fit within one SMS PDU as it is just too long for one PDU even with GSM encoding, though you can fit more in one PDU than you may initially expect",
+			nil,
+			[]string{"45", "46"},
+		},
 		{
 			"encode error",
 			nil,
@@ -454,13 +648,129 @@ func TestSendLongMessage(t *testing.T) {
 	}
 }
 
+func TestSendLongMessageProgress(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGS=152\r": {"\n>"},
+		"AT+CMGS=47\r":  {"\n>"},
+		"004101099121436587f90000a0050003010201c2207b599e07b1dfee33885e9ed341edf27c1e3e97417474980ebaa7d96c90fb4d0799d374d03d4d47a7dda0b7bb0c9a36a72028b10a0acf41693a283d07a9eb733a88fe7e83d86ff719647ecb416f771904255641657bd90dbaa7e968d071da0495dde33739ed3eb34074f4bb7e4683f2ef3a681c7683cc693aa8fd9697416937e8ed2e83a0" + string(rune(26)): {"\r\n", "+CMGS: 43\r\n", "\r\nOK\r\n"},
+		"004102099121436587f90000270500030102028855101d1d7683f2ef3aa81dce83d2ee343d1d66b3f3a0321e5e1ed301" + string(rune(26)): {"\r\n", "+CMGS: 44\r\n", "\r\nOK\r\n"},
+	}
+	msg := "a very long test message that will not fit within one SMS PDU as it is just too long for one PDU even with GSM encoding, though you can fit more in one PDU than you may initially expect"
+	// each send uses a new modem so the TP-MR cycle restarts.
+	send := func(options ...at.CommandOption) ([]string, error) {
+		g, mm := setupModem(t, cmdSet)
+		defer teardownModem(mm)
+		return g.SendLongMessage("+123456789", msg, options...)
+	}
+	type progress struct {
+		part, parts int
+		mr          string
+	}
+	var prog []progress
+	ph := func(part, parts int, mr string) {
+		prog = append(prog, progress{part, parts, mr})
+	}
+
+	// progress
+	mr, err := send(gsm.WithSendProgress(ph))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"43", "44"}, mr)
+	assert.Equal(t, []progress{{1, 2, "43"}, {2, 2, "44"}}, prog)
+
+	// cancelled part way
+	ctx, cancel := context.WithCancel(context.Background())
+	prog = nil
+	cph := func(part, parts int, mr string) {
+		ph(part, parts, mr)
+		cancel()
+	}
+	mr, err = send(gsm.WithSendProgress(cph), gsm.WithContext(ctx))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"43"}, mr)
+	assert.Equal(t, []progress{{1, 2, "43"}}, prog)
+
+	// cancelled before start
+	mr, err = send(gsm.WithContext(ctx))
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, mr)
+}
+
+func TestWithSendTimeout(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGS=152\r": {"\n>"},
+		"AT+CMGS=47\r":  {"\n>"},
+		"004101099121436587f90000a0050003010201c2207b599e07b1dfee33885e9ed341edf27c1e3e97417474980ebaa7d96c90fb4d0799d374d03d4d47a7dda0b7bb0c9a36a72028b10a0acf41693a283d07a9eb733a88fe7e83d86ff719647ecb416f771904255641657bd90dbaa7e968d071da0495dde33739ed3eb34074f4bb7e4683f2ef3a681c7683cc693aa8fd9697416937e8ed2e83a0" + string(rune(26)): {"\r\n", "+CMGS: 43\r\n", "\r\nOK\r\n"},
+		"004102099121436587f90000270500030102028855101d1d7683f2ef3aa81dce83d2ee343d1d66b3f3a0321e5e1ed301" + string(rune(26)): {"\r\n", "+CMGS: 44\r\n", "\r\nOK\r\n"},
+	}
+	msg := "a very long test message that will not fit within one SMS PDU as it is just too long for one PDU even with GSM encoding, though you can fit more in one PDU than you may initially expect"
+	send := func(options ...at.CommandOption) ([]string, error) {
+		g, mm := setupModem(t, cmdSet)
+		defer teardownModem(mm)
+		return g.SendLongMessage("+123456789", msg, options...)
+	}
+	slow := func(part, parts int, mr string) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// aggregate exceeds the command timeout, but not the send timeout
+	mr, err := send(gsm.WithSendProgress(slow),
+		at.WithTimeout(80*time.Millisecond),
+		gsm.WithSendTimeout(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"43", "44"}, mr)
+
+	// expires part way
+	mr, err = send(gsm.WithSendProgress(slow),
+		gsm.WithSendTimeout(30*time.Millisecond))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, []string{"43"}, mr)
+
+	// within a parent context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mr, err = send(gsm.WithContext(ctx), gsm.WithSendTimeout(time.Second))
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, mr)
+}
+
+func TestWithMRHandler(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGS=23\r": {"\n>"},
+		"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(rune(26)): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
+		"00012b099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(rune(26)): {"\r\n", "+CMGS: 255\r\n", "\r\nOK\r\n"},
+		"000100099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(rune(26)): {"\r\n", "+CMGS: 0\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	var mrs []int
+	mrh := func(mr int) {
+		mrs = append(mrs, mr)
+	}
+	// initial
+	mr, err := g.SendShortMessage("+123456789", "test message", gsm.WithMRHandler(mrh))
+	assert.Nil(t, err)
+	assert.Equal(t, "42", mr)
+
+	// resynchronised with modem
+	mr, err = g.SendShortMessage("+123456789", "test message", gsm.WithMRHandler(mrh))
+	assert.Nil(t, err)
+	assert.Equal(t, "255", mr)
+
+	// wrapped
+	mr, err = g.SendShortMessage("+123456789", "test message", gsm.WithMRHandler(mrh))
+	assert.Nil(t, err)
+	assert.Equal(t, "0", mr)
+	assert.Equal(t, []int{1, 43, 0}, mrs)
+}
+
 func TestSendPDU(t *testing.T) {
 	// mocked
 	cmdSet := map[string][]string{
-		"AT+CMGS=6\r":                 {"\n>"},
-		"00010203040506" + string(26): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
-		"00110203040506" + string(26): {"\r\n", "pad\r\n", "+CMGS: 43\r\n", "\r\nOK\r\n"},
-		"00210203040506" + string(26): {"\r\n", "pad\r\n", "\r\nOK\r\n"},
+		"AT+CMGS=6\r":                       {"\n>"},
+		"00010203040506" + string(rune(26)): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
+		"00110203040506" + string(rune(26)): {"\r\n", "pad\r\n", "+CMGS: 43\r\n", "\r\nOK\r\n"},
+		"00210203040506" + string(rune(26)): {"\r\n", "pad\r\n", "\r\nOK\r\n"},
 	}
 	patterns := []struct {
 		name    string
@@ -543,7 +853,7 @@ func TestStartMessageRx(t *testing.T) {
 	}
 
 	// wrong mode
-	err := g.StartMessageRx(mh, eh)
+	err := g.StartMessageRx(mh, eh, gsm.WithStatusReports(nil))
 	require.Equal(t, gsm.ErrWrongMode, err)
 
 	g, mm = setupModem(t, cmdSet)
@@ -734,6 +1044,395 @@ func TestStartMessageRxOptions(t *testing.T) {
 	}
 }
 
+func TestStartMessageRxCMTI(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+		"AT+CMGR=3\r\n": {
+			"+CMGR: 0,,24\r\n",
+			"00040B911234567890F000120250100173832305C8329BFD06\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGR=5\r\n": {
+			"+CMGR: 0,,159\r\n",
+			"00400b911234567890f0000010101000000000a00500030102016031d98c56b3dd7039584c36a3d56c375c0e1693cd6835db0d9783c564335acd76c3e56031d98c56b3dd7039584c36a3d56c375c0e1693cd6835db0d9783c564335acd76c3e56031d98c56b3dd7039584c36a3d56c375c0e1693cd6835db0d9783c564335acd76c3e56031d98c56b3dd7039584c36a3d56c375c0e1693cd6835db0d9783c564\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGR=6\r\n": {
+			"+CMGR: 0,,35\r\n",
+			"00400b911234567890f00000101010000000001205000301020266b49aed86cbd1c36936\r\n",
+			"\r\nOK\r\n",
+		},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	errChan := make(chan error, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		errChan <- err
+	}
+	err := g.StartMessageRx(mh, eh)
+	require.Nil(t, err)
+
+	patterns := []struct {
+		name string
+		rx   string
+		msg  *gsm.Message
+		err  error
+	}{
+		{
+			"class 2",
+			"+CMTI: \"SM\",3\r\n",
+			&gsm.Message{
+				Number:  "+21436587090",
+				Message: "Hello",
+				Class:   tpdu.MClass2,
+				Slots:   []gsm.StorageSlot{{Storage: "SM", Index: 3}},
+			},
+			nil,
+		},
+		{
+			"concatenated",
+			"+CMTI: \"ME\",6\r\n+CMTI: \"ME\",5\r\n",
+			&gsm.Message{
+				Number:  "+21436587090",
+				Message: strings.Repeat("0123456789", 16) + "tail",
+				Class:   tpdu.MClassUnknown,
+				Slots: []gsm.StorageSlot{
+					{Storage: "ME", Index: 5},
+					{Storage: "ME", Index: 6},
+				},
+			},
+			nil,
+		},
+		{
+			"read error",
+			"+CMTI: \"SM\",4\r\n",
+			nil,
+			at.ErrError,
+		},
+		{
+			"malformed",
+			"+CMTI: \"SM\"\r\n",
+			nil,
+			gsm.ErrUnmarshal{
+				Info: []string{"+CMTI: \"SM\""},
+				Err:  gsm.ErrMalformedResponse,
+			},
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			mm.r <- []byte(p.rx)
+			select {
+			case msg := <-msgChan:
+				require.NotNil(t, p.msg)
+				assert.Equal(t, p.msg.Number, msg.Number)
+				assert.Equal(t, p.msg.Message, msg.Message)
+				assert.Equal(t, p.msg.Class, msg.Class)
+				assert.Equal(t, p.msg.Slots, msg.Slots)
+			case err := <-errChan:
+				assert.Equal(t, p.err, err)
+			case <-time.After(100 * time.Millisecond):
+				t.Errorf("no notification received")
+			}
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestReceiveStoredPDU(t *testing.T) {
+	part1 := "00400b911234567890f0000010101000000000a00500030102016031d98c56b3dd7039584c36a3d56c375c0e1693cd6835db0d9783c564335acd76c3e56031d98c56b3dd7039584c36a3d56c375c0e1693cd6835db0d9783c564335acd76c3e56031d98c56b3dd7039584c36a3d56c375c0e1693cd6835db0d9783c564335acd76c3e56031d98c56b3dd7039584c36a3d56c375c0e1693cd6835db0d9783c564"
+	part2 := "00400b911234567890f00000101010000000001205000301020266b49aed86cbd1c36936"
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMI=0,0,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+		"AT+CMGR=5\r\n":         {"+CMGR: 0,,35\r\n", part2 + "\r\n", "\r\nOK\r\n"},
+		"AT+CMGL=0\r\n":         {"+CMGL: 7,0,,35\r\n", part2 + "\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	sp := gsm.StoredPDU{Index: 7}
+	err := g.ReceiveStoredPDU(sp)
+	assert.Equal(t, gsm.ErrNotReceiving, err)
+	err = gsm.ReceiveStoredTask(time.Minute).Action(g)
+	assert.Equal(t, gsm.ErrNotReceiving, err)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		t.Errorf("error received: %v", err)
+	}
+	err = g.StartMessageRx(mh, eh)
+	require.Nil(t, err)
+	text := strings.Repeat("0123456789", 16) + "tail"
+
+	// +CMT and +CMTI
+	mm.r <- []byte("+CMT: ,159\r\n" + part1 + "\r\n+CMTI: \"SM\",5\r\n")
+	select {
+	case msg := <-msgChan:
+		assert.Equal(t, text, msg.Message)
+		assert.Equal(t, []gsm.StorageSlot{{Storage: "SM", Index: 5}}, msg.Slots)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+
+	// +CMT and storage
+	mm.r <- []byte("+CMT: ,159\r\n" + part1 + "\r\n")
+	err = gsm.ReceiveStoredTask(time.Minute).Action(g)
+	require.Nil(t, err)
+	select {
+	case msg := <-msgChan:
+		assert.Equal(t, text, msg.Message)
+		assert.Equal(t, []gsm.StorageSlot{{Index: 7}}, msg.Slots)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+
+	g.StopMessageRx()
+	err = g.ReceiveStoredPDU(sp)
+	assert.Equal(t, gsm.ErrNotReceiving, err)
+}
+
+func TestWithStartupDrain(t *testing.T) {
+	hello := "00040B911234567890F000120250100173832305C8329BFD06"
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+		"AT+CMGL=0\r\n":         {"+CMGL: 3,0,,24\r\n", hello + "\r\n", "\r\nOK\r\n"},
+		"AT+CMGR=3\r\n":         {"+CMGR: 1,,24\r\n", hello + "\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		t.Errorf("error received: %v", err)
+	}
+	err := g.StartMessageRx(mh, eh, gsm.WithStartupDrain())
+	require.Nil(t, err)
+	select {
+	case msg := <-msgChan:
+		assert.Equal(t, "Hello", msg.Message)
+		assert.Equal(t, []gsm.StorageSlot{{Index: 3}}, msg.Slots)
+	default:
+		t.Fatal("stored message not received")
+	}
+	cmds := mm.written()
+	require.True(t, len(cmds) >= 2, cmds)
+	assert.Equal(t, "AT+CMGL=0\r\n", cmds[len(cmds)-2])
+	assert.Equal(t, "AT+CNMI=1,2,0,0,0\r\n", cmds[len(cmds)-1])
+
+	// a late indication of the stored message is discarded
+	mm.r <- []byte("+CMTI: \"SM\",3\r\n")
+	select {
+	case msg := <-msgChan:
+		t.Errorf("duplicate message received: %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// list error
+	g, mm = setupModem(t, nil)
+	defer teardownModem(mm)
+	err = g.StartMessageRx(mh, eh, gsm.WithStartupDrain())
+	assert.Equal(t, at.ErrError, err)
+}
+
+func TestWithDrainDeletion(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CMGL=0\r\n": {
+			"+CMGL: 1,0,,36\r\n",
+			part2of2 + "\r\n",
+			"+CMGL: 2,0,,24\r\n",
+			"00040B911234567890F000120250100173832305C8329BFD06\r\n",
+			"+CMGL: 3,0,,155\r\n",
+			part1of2 + "\r\n",
+			"+CMGL: 4,0,,155\r\n",
+			partial + "\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGD=1\r\n": {"\r\nOK\r\n"},
+		"AT+CMGD=2\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	errChan := make(chan error, 3)
+	eh := func(err error) {
+		errChan <- err
+	}
+	err := g.StartMessageRx(mh, eh, gsm.WithStartupDrain(), gsm.WithDrainDeletion())
+	require.Nil(t, err)
+	require.Len(t, msgChan, 2)
+	msg := <-msgChan
+	assert.Equal(t, []gsm.StorageSlot{{Index: 2}}, msg.Slots)
+	msg = <-msgChan
+	assert.Equal(t, []gsm.StorageSlot{{Index: 3}, {Index: 1}}, msg.Slots)
+
+	// the partial message is left in storage, and deletion errors reported
+	require.Len(t, errChan, 1)
+	assert.Equal(t, at.ErrError, <-errChan)
+	cmds := mm.written()
+	require.True(t, len(cmds) >= 4, cmds)
+	assert.Equal(t, []string{
+		"AT+CMGL=0\r\n",
+		"AT+CMGD=2\r\n",
+		"AT+CMGD=3\r\n",
+		"AT+CMGD=1\r\n",
+		"AT+CNMI=1,2,0,0,0\r\n",
+	}, cmds[len(cmds)-5:])
+}
+
+func TestWithCMTI(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,1,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CMGR=1\r\n":         {"+CMGR: 0,,36\r\n", part2of2 + "\r\n", "\r\nOK\r\n"},
+		"AT+CMGR=2\r\n": {
+			"+CMGR: 0,,24\r\n",
+			"00040B911234567890F000000250100173832305C8329BFD06\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGR=3\r\n": {"+CMGR: 0,,155\r\n", part1of2 + "\r\n", "\r\nOK\r\n"},
+		"AT+CMGD=2\r\n": {"\r\nOK\r\n"},
+		"AT+CMGD=3\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	errChan := make(chan error, 3)
+	eh := func(err error) {
+		errChan <- err
+	}
+	err := g.StartMessageRx(mh, eh, gsm.WithCMTI())
+	require.Nil(t, err)
+	// no acknowledgement required, so the message service is not checked.
+	assert.NotContains(t, mm.written(), "AT+CSMS?\r\n")
+
+	deleted := func(cmd string) bool {
+		for i := 0; i < 100; i++ {
+			for _, c := range mm.written() {
+				if c == cmd {
+					return true
+				}
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return false
+	}
+
+	// single part
+	mm.r <- []byte("+CMTI: \"SM\",2\r\n")
+	select {
+	case msg := <-msgChan:
+		assert.Equal(t, []gsm.StorageSlot{{Storage: "SM", Index: 2}}, msg.Slots)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	assert.True(t, deleted("AT+CMGD=2\r\n"))
+
+	// concatenated, with the parts deleted once complete
+	mm.r <- []byte("+CMTI: \"SM\",1\r\n")
+	select {
+	case <-msgChan:
+		t.Fatal("partial message received")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.NotContains(t, mm.written(), "AT+CMGD=1\r\n")
+	mm.r <- []byte("+CMTI: \"SM\",3\r\n")
+	select {
+	case msg := <-msgChan:
+		assert.Equal(t, []gsm.StorageSlot{{Storage: "SM", Index: 3}, {Storage: "SM", Index: 1}}, msg.Slots)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	assert.True(t, deleted("AT+CMGD=3\r\n"))
+
+	// deletion errors reported
+	select {
+	case err := <-errChan:
+		assert.Equal(t, at.ErrError, err)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no deletion error")
+	}
+	assert.Contains(t, mm.written(), "AT+CMGD=1\r\n")
+}
+
+func TestCMTIStorage(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,1,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CPMS?\r\n":          {"+CPMS: \"SM\",1,10,\"SM\",1,10,\"SM\",1,10\r\n", "\r\nOK\r\n"},
+		"AT+CPMS=\"ME\"\r\n":    {"+CPMS: 1,50,1,10,1,10\r\n", "\r\nOK\r\n"},
+		"AT+CPMS=\"SM\"\r\n":    {"+CPMS: 1,10,1,10,1,10\r\n", "\r\nOK\r\n"},
+		"AT+CMGR=2\r\n": {
+			"+CMGR: 0,,24\r\n",
+			"00040B911234567890F000000250100173832305C8329BFD06\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGD=2\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	errChan := make(chan error, 3)
+	eh := func(err error) {
+		errChan <- err
+	}
+	err := g.StartMessageRx(mh, eh, gsm.WithCMTI())
+	require.Nil(t, err)
+
+	// read and deleted from the indicated storage, not the read storage
+	mm.r <- []byte("+CMTI: \"ME\",2\r\n")
+	select {
+	case msg := <-msgChan:
+		assert.Equal(t, []gsm.StorageSlot{{Storage: "ME", Index: 2}}, msg.Slots)
+	case err := <-errChan:
+		t.Fatalf("error: %v", err)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	for i := 0; i < 100; i++ {
+		if len(mm.written()) >= 9 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, []string{
+		"AT+CNMI=1,1,0,0,0\r\n",
+		"AT+CPMS?\r\n",
+		"AT+CPMS=\"ME\"\r\n",
+		"AT+CMGR=2\r\n",
+		"AT+CPMS=\"SM\"\r\n",
+		"AT+CPMS?\r\n",
+		"AT+CPMS=\"ME\"\r\n",
+		"AT+CMGD=2\r\n",
+		"AT+CPMS=\"SM\"\r\n",
+	}, mm.written())
+}
+
 func TestStopMessageRx(t *testing.T) {
 	cmdSet := map[string][]string{
 		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
@@ -949,6 +1648,17 @@ type mockModem struct {
 	readDelay time.Duration
 	// The buffer emulating characters emitted by the modem.
 	r chan []byte
+	// mu guards closed, and serialises writes to r with its closing.
+	mu sync.Mutex
+	// The commands written to the modem.
+	cmds []string
+}
+
+// written returns the commands written to the modem.
+func (mm *mockModem) written() []string {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return append([]string(nil), mm.cmds...)
 }
 
 func (mm *mockModem) Read(p []byte) (n int, err error) {
@@ -965,9 +1675,12 @@ func (mm *mockModem) Read(p []byte) (n int, err error) {
 }
 
 func (mm *mockModem) Write(p []byte) (n int, err error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
 	if mm.closed {
 		return 0, at.ErrClosed
 	}
+	mm.cmds = append(mm.cmds, string(p))
 	if mm.echo {
 		mm.r <- p
 	}
@@ -986,6 +1699,8 @@ func (mm *mockModem) Write(p []byte) (n int, err error) {
 }
 
 func (mm *mockModem) Close() error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
 	if mm.closed == false {
 		mm.closed = true
 		close(mm.r)
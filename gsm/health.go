@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Probe is a check of one aspect of the health of the modem.
+type Probe struct {
+	// Name identifies the probe in the report.
+	Name string
+
+	// Check performs the probe, returning an error if it fails.
+	Check func(g *GSM) error
+}
+
+// ATProbe checks the modem responds to commands.
+var ATProbe = Probe{
+	Name: "at",
+	Check: func(g *GSM) error {
+		_, err := g.Command("")
+		return err
+	},
+}
+
+// SIMProbe checks the SIM is ready.
+var SIMProbe = Probe{
+	Name: "sim",
+	Check: func(g *GSM) error {
+		ready, err := g.pinReady()
+		if err == nil && !ready {
+			err = ErrNotPINReady
+		}
+		return err
+	},
+}
+
+// RegistrationProbe checks the modem is registered to a network.
+var RegistrationProbe = Probe{
+	Name: "registration",
+	Check: func(g *GSM) error {
+		stat, err := g.RegistrationStatus()
+		if err != nil {
+			return err
+		}
+		if !stat.Registered() {
+			return fmt.Errorf("not registered: status %d", stat)
+		}
+		return nil
+	},
+}
+
+// SignalProbe returns a probe that checks the rssi reported by +CSQ is known
+// and at least min.
+func SignalProbe(min int) Probe {
+	return Probe{
+		Name: "signal",
+		Check: func(g *GSM) error {
+			rssi, _, err := g.SignalQuality()
+			if err != nil {
+				return err
+			}
+			if rssi == 99 || rssi < min {
+				return fmt.Errorf("insufficient signal: rssi %d", rssi)
+			}
+			return nil
+		},
+	}
+}
+
+// DefaultProbes is the set of probes run by HealthCheck if none are provided.
+var DefaultProbes = []Probe{ATProbe, SIMProbe, RegistrationProbe, SignalProbe(1)}
+
+// ProbeResult is the result of a single probe.
+type ProbeResult struct {
+	// Name is the name of the probe.
+	Name string
+
+	// Err is the error returned by the probe, or nil if it passed.
+	Err error
+
+	// Duration is the time taken to run the probe.
+	Duration time.Duration
+}
+
+// Passed returns true if the probe passed.
+func (r ProbeResult) Passed() bool {
+	return r.Err == nil
+}
+
+// HealthReport is the result of a health check.
+type HealthReport struct {
+	// Time is the time the check started.
+	Time time.Time
+
+	// Results are the results of the probes, in the order they were run.
+	Results []ProbeResult
+}
+
+// Healthy returns true if all the probes passed.
+func (r HealthReport) Healthy() bool {
+	for _, p := range r.Results {
+		if !p.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// HealthCheck runs the probes, or DefaultProbes if none are provided, and
+// returns a report of the results.
+//
+// All probes are run, even if earlier probes fail, so the report is
+// complete.  If the context is done before all probes are run then the
+// remaining probes fail with the context error.
+func (g *GSM) HealthCheck(ctx context.Context, probes ...Probe) HealthReport {
+	if len(probes) == 0 {
+		probes = DefaultProbes
+	}
+	r := HealthReport{Time: time.Now()}
+	for _, p := range probes {
+		start := time.Now()
+		err := ctx.Err()
+		if err == nil {
+			err = p.Check(g)
+		}
+		r.Results = append(r.Results, ProbeResult{
+			Name:     p.Name,
+			Err:      err,
+			Duration: time.Since(start),
+		})
+	}
+	return r
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestHealthCheck(t *testing.T) {
+	healthy := map[string][]string{
+		"AT\r\n":       {"OK\r\n"},
+		"AT+CPIN?\r\n": {"+CPIN: READY\r\n", "OK\r\n"},
+		"AT+CREG?\r\n": {"+CREG: 0,1\r\n", "OK\r\n"},
+		"AT+CSQ\r\n":   {"+CSQ: 20,0\r\n", "OK\r\n"},
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	pingErr := errors.New("ping failed")
+	ping := gsm.Probe{
+		Name: "ping",
+		Check: func(g *gsm.GSM) error {
+			return pingErr
+		},
+	}
+	patterns := []struct {
+		name    string
+		ctx     context.Context
+		over    map[string][]string
+		probes  []gsm.Probe
+		names   []string
+		errs    []error
+		healthy bool
+	}{
+		{
+			"healthy",
+			context.Background(),
+			nil,
+			nil,
+			[]string{"at", "sim", "registration", "signal"},
+			[]error{nil, nil, nil, nil},
+			true,
+		},
+		{
+			"sim pin",
+			context.Background(),
+			map[string][]string{"AT+CPIN?\r\n": {"+CPIN: SIM PIN\r\n", "OK\r\n"}},
+			nil,
+			[]string{"at", "sim", "registration", "signal"},
+			[]error{nil, gsm.ErrNotPINReady, nil, nil},
+			false,
+		},
+		{
+			"sim missing",
+			context.Background(),
+			map[string][]string{"AT+CPIN?\r\n": {"+CME ERROR: 10\r\n"}},
+			nil,
+			[]string{"at", "sim", "registration", "signal"},
+			[]error{nil, at.CMEError("10"), nil, nil},
+			false,
+		},
+		{
+			"custom",
+			context.Background(),
+			nil,
+			[]gsm.Probe{gsm.ATProbe, gsm.SignalProbe(25), ping},
+			[]string{"at", "signal", "ping"},
+			[]error{nil, errors.New("insufficient signal: rssi 20"), pingErr},
+			false,
+		},
+		{
+			"unregistered",
+			context.Background(),
+			map[string][]string{"AT+CREG?\r\n": {"+CREG: 0,2\r\n", "OK\r\n"}},
+			[]gsm.Probe{gsm.RegistrationProbe},
+			[]string{"registration"},
+			[]error{errors.New("not registered: status 2")},
+			false,
+		},
+		{
+			"cancelled",
+			cancelled,
+			nil,
+			[]gsm.Probe{gsm.ATProbe},
+			[]string{"at"},
+			[]error{context.Canceled},
+			false,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{}
+			for k, v := range healthy {
+				cmdSet[k] = v
+			}
+			for k, v := range p.over {
+				cmdSet[k] = v
+			}
+			g, mm := setupModem(t, cmdSet)
+			defer teardownModem(mm)
+			r := g.HealthCheck(p.ctx, p.probes...)
+			assert.Equal(t, p.healthy, r.Healthy())
+			assert.False(t, r.Time.IsZero())
+			require.Equal(t, len(p.names), len(r.Results))
+			for i, pr := range r.Results {
+				assert.Equal(t, p.names[i], pr.Name)
+				assert.Equal(t, p.errs[i], pr.Err)
+				assert.Equal(t, p.errs[i] == nil, pr.Passed())
+			}
+		}
+		t.Run(p.name, f)
+	}
+}
@@ -0,0 +1,345 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// HousekeepingTask is a periodic maintenance task, such as draining stored
+// messages, that is only run when the modem is otherwise idle.
+type HousekeepingTask struct {
+	// Name identifies the task in events.
+	Name string
+
+	// Interval is the minimum period between runs of the task.
+	Interval time.Duration
+
+	// Action performs the task.
+	Action func(g *GSM) error
+
+	// Blackouts are the periods during which the task must not be run.
+	//
+	// The task is held while any blackout is active, without affecting the
+	// running of other tasks, and is run once it is due and no blackout is
+	// active.
+	Blackouts []Blackout
+}
+
+// Blackout determines when a housekeeping task must not be run.
+type Blackout interface {
+	// Active returns true if the blackout applies at the given time.
+	Active(now time.Time) bool
+}
+
+// BlackoutFunc adapts a function to a Blackout, such as to hold a task while
+// messages are queued for sending.
+type BlackoutFunc func(now time.Time) bool
+
+// Active returns the result of calling the function.
+func (f BlackoutFunc) Active(now time.Time) bool {
+	return f(now)
+}
+
+// BlackoutWindow is a daily period, in local time, during which a task must
+// not be run, such as business hours.
+type BlackoutWindow struct {
+	// Start is the start of the window, as an offset from midnight.
+	Start time.Duration
+
+	// End is the end of the window, as an offset from midnight.
+	//
+	// If End is before Start then the window spans midnight.
+	End time.Duration
+
+	// Days are the days on which the window starts, or every day if empty.
+	Days []time.Weekday
+}
+
+// Active returns true if the time is within the window.
+func (w BlackoutWindow) Active(now time.Time) bool {
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	offset := now.Sub(midnight)
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End && w.onDay(now.Weekday())
+	}
+	// spans midnight, so may have started the day before
+	if offset >= w.Start {
+		return w.onDay(now.Weekday())
+	}
+	return offset < w.End && w.onDay((now.Weekday()+6)%7)
+}
+
+func (w BlackoutWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// blackedOut returns true if any of the task blackouts is active.
+func (t *housekeepingTask) blackedOut(now time.Time) bool {
+	for _, b := range t.Blackouts {
+		if b.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// DrainStoredTask returns a task that reads unread messages from the modem
+// message storage and passes them to the handler.
+//
+// This picks up messages stored by the modem while no message handler was
+// running, or whose indications were lost.
+func DrainStoredTask(interval time.Duration, ph StoredPDUHandler) HousekeepingTask {
+	return HousekeepingTask{
+		Name:     "drain stored",
+		Interval: interval,
+		Action: func(g *GSM) error {
+			return listUnread(g, ph)
+		},
+	}
+}
+
+// ReceiveStoredTask returns a task that reads unread messages from the modem
+// message storage and passes them to the receiver started by StartMessageRx,
+// as per ReceiveStoredPDU.
+//
+// This picks up the parts of concatenated messages that the network directed
+// to storage, so they are reassembled with the parts delivered directly.  The
+// storage is not read while messages are not being received.
+func ReceiveStoredTask(interval time.Duration) HousekeepingTask {
+	return HousekeepingTask{
+		Name:     "receive stored",
+		Interval: interval,
+		Action: func(g *GSM) error {
+			g.mu.Lock()
+			h := g.rxStored
+			g.mu.Unlock()
+			if h == nil {
+				return ErrNotReceiving
+			}
+			return listUnread(g, h)
+		},
+	}
+}
+
+// listUnread passes the unread messages in the modem message storage to the
+// handler, returning the first error encountered.
+func listUnread(g *GSM, ph StoredPDUHandler) error {
+	var lerr error
+	err := g.ListPDUs(RecUnread, ph, func(err error) {
+		if lerr == nil {
+			lerr = err
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return lerr
+}
+
+// DeleteReadTask returns a task that deletes read messages from the modem
+// message storage, so the storage does not fill.
+func DeleteReadTask(interval time.Duration) HousekeepingTask {
+	return HousekeepingTask{
+		Name:     "delete read",
+		Interval: interval,
+		Action: func(g *GSM) error {
+			return g.DeleteAll(DeleteRead)
+		},
+	}
+}
+
+// NetworkInfo is the network state collected by NetworkInfoTask.
+type NetworkInfo struct {
+	Registration RegistrationStatus
+	RSSI         int
+	BER          int
+}
+
+// NetworkInfoTask returns a task that refreshes the network registration and
+// signal quality, and passes them to the handler.
+func NetworkInfoTask(interval time.Duration, h func(NetworkInfo)) HousekeepingTask {
+	return HousekeepingTask{
+		Name:     "network info",
+		Interval: interval,
+		Action: func(g *GSM) error {
+			rs, err := g.RegistrationStatus()
+			if err != nil {
+				return err
+			}
+			rssi, ber, err := g.SignalQuality()
+			if err != nil {
+				return err
+			}
+			h(NetworkInfo{Registration: rs, RSSI: rssi, BER: ber})
+			return nil
+		},
+	}
+}
+
+// HousekeepingRun is published to the EventBus provided to New each time a
+// housekeeping task is run.
+type HousekeepingRun struct {
+	// Task is the name of the task.
+	Task string
+
+	// Duration is the time taken to run the task.
+	Duration time.Duration
+
+	// Err is the error returned by the task.
+	Err error
+}
+
+// Housekeeper runs housekeeping tasks when the command channel to the modem
+// is idle, so maintenance work does not add latency to user commands.
+//
+// A task is run once the command channel has been idle for the idle period,
+// no sends are pending, and the interval since the task was last run has
+// passed.  Only one task is run per idle period, and the commands issued by
+// the task count as activity, so the tasks are spread out and a user command
+// is only ever queued behind a single task.
+type Housekeeper struct {
+	g      *GSM
+	idle   time.Duration
+	period time.Duration
+
+	mu    sync.Mutex
+	tasks []*housekeepingTask
+}
+
+type housekeepingTask struct {
+	HousekeepingTask
+	last time.Time
+}
+
+// HousekeepingOption is a construction option for a Housekeeper.
+type HousekeepingOption interface {
+	applyHousekeepingOption(*Housekeeper)
+}
+
+type idlePeriodOption time.Duration
+
+func (o idlePeriodOption) applyHousekeepingOption(h *Housekeeper) {
+	h.idle = time.Duration(o)
+}
+
+// WithIdlePeriod specifies the period the command channel must be idle before
+// a housekeeping task is run.
+//
+// The default is 5 seconds.
+func WithIdlePeriod(d time.Duration) HousekeepingOption {
+	return idlePeriodOption(d)
+}
+
+type housekeepingTasksOption []HousekeepingTask
+
+func (o housekeepingTasksOption) applyHousekeepingOption(h *Housekeeper) {
+	for _, t := range o {
+		h.tasks = append(h.tasks, &housekeepingTask{HousekeepingTask: t})
+	}
+}
+
+// WithHousekeepingTasks adds tasks to the Housekeeper.
+func WithHousekeepingTasks(tasks ...HousekeepingTask) HousekeepingOption {
+	return housekeepingTasksOption(tasks)
+}
+
+// NewHousekeeper creates a housekeeper for the modem.
+func (g *GSM) NewHousekeeper(options ...HousekeepingOption) *Housekeeper {
+	h := Housekeeper{
+		g:    g,
+		idle: 5 * time.Second,
+	}
+	for _, option := range options {
+		option.applyHousekeepingOption(&h)
+	}
+	h.period = h.idle / 5
+	if h.period < 10*time.Millisecond {
+		h.period = 10 * time.Millisecond
+	}
+	return &h
+}
+
+// AddTask adds a task to the Housekeeper.
+//
+// The task is first run at the first idle period after it is added.
+func (h *Housekeeper) AddTask(t HousekeepingTask) {
+	h.mu.Lock()
+	h.tasks = append(h.tasks, &housekeepingTask{HousekeepingTask: t})
+	h.mu.Unlock()
+}
+
+// Run runs the housekeeping tasks as the modem becomes idle, until the
+// context is done or the modem is closed.
+func (h *Housekeeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.g.Closed():
+			return
+		case <-ticker.C:
+			h.RunOnce()
+		}
+	}
+}
+
+// RunOnce runs the most overdue task, if the modem is idle.
+//
+// Returns true if a task was run.
+func (h *Housekeeper) RunOnce() bool {
+	if h.g.Idle() < h.idle || h.g.sched.busy() {
+		return false
+	}
+	t := h.due(time.Now())
+	if t == nil {
+		return false
+	}
+	start := time.Now()
+	err := t.Action(h.g)
+	h.mu.Lock()
+	t.last = time.Now()
+	h.mu.Unlock()
+	if h.g.bus != nil {
+		h.g.bus.Publish(HousekeepingRun{Task: t.Name, Duration: time.Since(start), Err: err})
+	}
+	return true
+}
+
+// due returns the task that is most overdue, or nil if no task is due.
+func (h *Housekeeper) due(now time.Time) *housekeepingTask {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var due *housekeepingTask
+	var overdue time.Duration
+	for _, t := range h.tasks {
+		if t.blackedOut(now) {
+			continue
+		}
+		if t.last.IsZero() {
+			// never run, so as overdue as possible
+			return t
+		}
+		od := now.Sub(t.last) - t.Interval
+		if od >= 0 && (due == nil || od > overdue) {
+			due = t
+			overdue = od
+		}
+	}
+	return due
+}
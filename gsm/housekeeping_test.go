@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestHousekeeper(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGD=1,1\r\n": {"OK\r\n"},
+		"AT+CREG?\r\n":    {"+CREG: 0,1\r\n", "OK\r\n"},
+		"AT+CSQ\r\n":      {"+CSQ: 20,0\r\n", "OK\r\n"},
+	}
+	b := gsm.NewEventBus()
+	var mu sync.Mutex
+	var runs []gsm.HousekeepingRun
+	b.Subscribe(func(e gsm.Event) {
+		mu.Lock()
+		runs = append(runs, e.(gsm.HousekeepingRun))
+		mu.Unlock()
+	}, gsm.HousekeepingRun{})
+	g, mm := setupModem(t, cmdSet, gsm.WithEventBus(b))
+	defer teardownModem(mm)
+
+	var ni []gsm.NetworkInfo
+	taskErr := errors.New("task failed")
+	h := g.NewHousekeeper(
+		gsm.WithIdlePeriod(20*time.Millisecond),
+		gsm.WithHousekeepingTasks(
+			gsm.DeleteReadTask(time.Hour),
+			gsm.NetworkInfoTask(time.Hour, func(n gsm.NetworkInfo) {
+				ni = append(ni, n)
+			})))
+
+	// not yet idle
+	_, err := g.Command("+CSQ")
+	require.Nil(t, err)
+	assert.False(t, h.RunOnce())
+
+	// one task per idle period
+	time.Sleep(25 * time.Millisecond)
+	assert.True(t, h.RunOnce())
+	assert.False(t, h.RunOnce())
+	time.Sleep(25 * time.Millisecond)
+	assert.True(t, h.RunOnce())
+	assert.Equal(t, []gsm.NetworkInfo{{Registration: gsm.RegisteredHome, RSSI: 20, BER: 0}}, ni)
+
+	// none due
+	time.Sleep(25 * time.Millisecond)
+	assert.False(t, h.RunOnce())
+
+	h.AddTask(gsm.HousekeepingTask{
+		Name:     "failing",
+		Interval: time.Hour,
+		Action:   func(*gsm.GSM) error { return taskErr },
+	})
+	assert.True(t, h.RunOnce())
+
+	mu.Lock()
+	require.Len(t, runs, 3)
+	assert.Equal(t, "delete read", runs[0].Task)
+	assert.Nil(t, runs[0].Err)
+	assert.Equal(t, "network info", runs[1].Task)
+	assert.Equal(t, "failing", runs[2].Task)
+	assert.Equal(t, taskErr, runs[2].Err)
+	mu.Unlock()
+	assert.Contains(t, mm.written(), "AT+CMGD=1,1\r\n")
+}
+
+func TestHousekeeperRun(t *testing.T) {
+	g, mm := setupModem(t, nil)
+	defer teardownModem(mm)
+
+	ran := make(chan struct{}, 5)
+	h := g.NewHousekeeper(
+		gsm.WithIdlePeriod(10*time.Millisecond),
+		gsm.WithHousekeepingTasks(gsm.HousekeepingTask{
+			Name:     "tick",
+			Interval: 20 * time.Millisecond,
+			Action: func(*gsm.GSM) error {
+				ran <- struct{}{}
+				return nil
+			},
+		}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ran:
+		case <-time.After(200 * time.Millisecond):
+			t.Fatal("task not run")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("run not cancelled")
+	}
+}
+
+func TestHousekeeperBlackout(t *testing.T) {
+	g, mm := setupModem(t, nil)
+	defer teardownModem(mm)
+
+	var blackout bool
+	var ran []string
+	task := func(name string) gsm.HousekeepingTask {
+		return gsm.HousekeepingTask{
+			Name:     name,
+			Interval: time.Hour,
+			Action: func(*gsm.GSM) error {
+				ran = append(ran, name)
+				return nil
+			},
+		}
+	}
+	held := task("held")
+	held.Blackouts = []gsm.Blackout{gsm.BlackoutFunc(func(time.Time) bool {
+		return blackout
+	})}
+	h := g.NewHousekeeper(
+		gsm.WithIdlePeriod(10*time.Millisecond),
+		gsm.WithHousekeepingTasks(held, task("free")))
+	time.Sleep(15 * time.Millisecond)
+
+	// held task does not block others
+	blackout = true
+	assert.True(t, h.RunOnce())
+	assert.False(t, h.RunOnce())
+	assert.Equal(t, []string{"free"}, ran)
+
+	// run once the blackout ends
+	blackout = false
+	assert.True(t, h.RunOnce())
+	assert.Equal(t, []string{"free", "held"}, ran)
+}
+
+func TestBlackoutWindow(t *testing.T) {
+	// 2020-06-01 is a Monday
+	local := func(day, hour, min int) time.Time {
+		return time.Date(2020, 6, day, hour, min, 0, 0, time.Local)
+	}
+	business := gsm.BlackoutWindow{
+		Start: 9 * time.Hour,
+		End:   17 * time.Hour,
+		Days: []time.Weekday{
+			time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday,
+		},
+	}
+	overnight := gsm.BlackoutWindow{
+		Start: 22 * time.Hour,
+		End:   6 * time.Hour,
+		Days:  []time.Weekday{time.Friday},
+	}
+	daily := gsm.BlackoutWindow{Start: 12 * time.Hour, End: 13 * time.Hour}
+	patterns := []struct {
+		name   string
+		w      gsm.BlackoutWindow
+		t      time.Time
+		active bool
+	}{
+		{"business start", business, local(1, 9, 0), true},
+		{"business hours", business, local(3, 12, 30), true},
+		{"business end", business, local(5, 17, 0), false},
+		{"before business", business, local(1, 8, 59), false},
+		{"weekend", business, local(6, 12, 0), false},
+		{"overnight evening", overnight, local(5, 23, 0), true},
+		{"overnight morning", overnight, local(6, 5, 59), true},
+		{"overnight end", overnight, local(6, 6, 0), false},
+		{"overnight other day", overnight, local(4, 23, 0), false},
+		{"overnight previous morning", overnight, local(5, 1, 0), false},
+		{"daily", daily, local(7, 12, 15), true},
+		{"daily outside", daily, local(7, 13, 15), false},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			assert.Equal(t, p.active, p.w.Active(p.t))
+		}
+		t.Run(p.name, f)
+	}
+}
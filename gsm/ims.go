@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// IMSService identifies the services available over IMS, as reported in the
+// <ext_info> of +CIREG.
+type IMSService int
+
+const (
+	// IMSVoice indicates voice over IMS, i.e. VoLTE, is available.
+	IMSVoice IMSService = 1 << iota
+
+	// IMSVideo indicates video over IMS is available.
+	IMSVideo
+
+	// IMSSMS indicates SMS over IMS is available.
+	IMSSMS
+
+	// IMSText indicates real-time text over IMS is available.
+	IMSText
+)
+
+// IMSRegistration is the IMS registration status, as reported by +CIREG.
+type IMSRegistration struct {
+	// Registered indicates the modem is registered with the IMS.
+	Registered bool
+
+	// Services are the services available over IMS.
+	//
+	// Only reported by modems supporting the extended +CIREG reporting, so
+	// is zero if unknown.
+	Services IMSService
+}
+
+// Has returns true if the service is available over IMS.
+func (r IMSRegistration) Has(s IMSService) bool {
+	return r.Services&s == s
+}
+
+// IMSRegistrationChanged is published to the EventBus provided to New when
+// the IMS registration status reported by the modem changes.
+type IMSRegistrationChanged struct {
+	// Time is the time the change was read from the modem.
+	Time time.Time
+
+	IMSRegistration
+}
+
+// IMSHandler receives changes in IMS registration status.
+type IMSHandler func(IMSRegistrationChanged)
+
+// IMSRegistration returns the IMS registration status, using +CIREG.
+//
+// Once the modem has rejected +CIREG as not supported, subsequent calls
+// return ErrUnsupported without issuing the command.
+func (g *GSM) IMSRegistration(options ...at.CommandOption) (IMSRegistration, error) {
+	i, err := g.optionalCommand("+CIREG?", options...)
+	if err != nil {
+		return IMSRegistration{}, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CIREG") {
+			continue
+		}
+		// +CIREG: <n>,<reg_info>[,<ext_info>]
+		fields := info.Fields(info.TrimPrefix(l, "+CIREG"))
+		if len(fields) < 2 {
+			break
+		}
+		return parseIMSRegistration(fields[1:])
+	}
+	return IMSRegistration{}, ErrMalformedResponse
+}
+
+// parseIMSRegistration parses the <reg_info>[,<ext_info>] fields of a +CIREG
+// response or indication.
+func parseIMSRegistration(fields []string) (IMSRegistration, error) {
+	reg, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return IMSRegistration{}, ErrMalformedResponse
+	}
+	r := IMSRegistration{Registered: reg == 1}
+	if len(fields) > 1 && fields[1] != "" {
+		ext, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return IMSRegistration{}, ErrMalformedResponse
+		}
+		r.Services = IMSService(ext)
+	}
+	return r, nil
+}
+
+// StartIMSRx passes changes in the IMS registration status to the handler,
+// and publishes them to the bus provided to New as IMSRegistrationChanged.
+//
+// The changes are indicated by the modem via +CIREG, with the extended
+// reporting of the available services requested, falling back to basic
+// reporting if not supported.
+//
+// The current status is reported immediately, if available.
+//
+// The handler may be nil if the changes are only required on the bus.
+func (g *GSM) StartIMSRx(h IMSHandler) error {
+	report := func(r IMSRegistration, t time.Time) {
+		rc := IMSRegistrationChanged{Time: t, IMSRegistration: r}
+		if h != nil {
+			h(rc)
+		}
+		if g.bus != nil {
+			g.bus.Publish(rc)
+		}
+	}
+	cireg := func(i []string, t time.Time) {
+		// +CIREG: <reg_info>[,<ext_info>]
+		r, err := parseIMSRegistration(info.Fields(info.TrimPrefix(i[0], "+CIREG")))
+		if err != nil {
+			return
+		}
+		report(r, t)
+	}
+	err := g.AddStampedIndication("+CIREG:", cireg)
+	if err != nil {
+		return err
+	}
+	_, err = g.Command("+CIREG=2")
+	if err != nil {
+		_, err = g.Command("+CIREG=1")
+	}
+	if err != nil {
+		g.CancelIndication("+CIREG:")
+		return err
+	}
+	if r, err := g.IMSRegistration(); err == nil {
+		report(r, time.Now())
+	}
+	return nil
+}
+
+// StopIMSRx ends the reporting of IMS registration status started by
+// StartIMSRx.
+func (g *GSM) StopIMSRx() {
+	g.CancelIndication("+CIREG:")
+	g.Command("+CIREG=0")
+}
+
+// IMSMode is the IMS configuration of the modem, as set by the Quectel
+// +QCFG="ims" command.
+type IMSMode int
+
+const (
+	// IMSAuto leaves IMS enabled or disabled as per the carrier
+	// configuration (MBN) selected by the modem.
+	IMSAuto IMSMode = iota
+
+	// IMSOn enables IMS, and so VoLTE and SMS over IMS.
+	IMSOn
+
+	// IMSOff disables IMS.
+	IMSOff
+)
+
+// IMSConfig is the IMS configuration of the modem.
+type IMSConfig struct {
+	// Mode is the configured IMS mode.
+	Mode IMSMode
+
+	// VoLTEReady indicates VoLTE is ready for use, as reported by the modem.
+	VoLTEReady bool
+}
+
+// IMSConfig returns the IMS configuration of the modem, using the Quectel
+// +QCFG="ims" command.
+func (g *GSM) IMSConfig(options ...at.CommandOption) (IMSConfig, error) {
+	i, err := g.Command(`+QCFG="ims"`, options...)
+	if err != nil {
+		return IMSConfig{}, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+QCFG") {
+			continue
+		}
+		// +QCFG: "ims",<mode>[,<VoLTE_state>]
+		fields := info.Fields(info.TrimPrefix(l, "+QCFG"))
+		if len(fields) < 2 || fields[0] != "ims" {
+			continue
+		}
+		mode, err := strconv.Atoi(fields[1])
+		if err != nil {
+			break
+		}
+		c := IMSConfig{Mode: IMSMode(mode)}
+		if len(fields) > 2 {
+			c.VoLTEReady = fields[2] == "1"
+		}
+		return c, nil
+	}
+	return IMSConfig{}, ErrMalformedResponse
+}
+
+// SetIMSMode enables or disables IMS, and so VoLTE and SMS over IMS, using
+// the Quectel +QCFG="ims" command.
+//
+// Depending on the modem, the change may not take effect until the modem is
+// restarted, or the radio cycled using +CFUN.
+func (g *GSM) SetIMSMode(mode IMSMode, options ...at.CommandOption) error {
+	_, err := g.Command(fmt.Sprintf(`+QCFG="ims",%d`, mode), options...)
+	return err
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestIMSRegistration(t *testing.T) {
+	patterns := []struct {
+		name   string
+		cmdSet map[string][]string
+		reg    gsm.IMSRegistration
+		err    error
+	}{
+		{
+			"registered",
+			map[string][]string{
+				"AT+CIREG?\r\n": {"+CIREG: 0,1\r\n", "\r\nOK\r\n"},
+			},
+			gsm.IMSRegistration{Registered: true},
+			nil,
+		},
+		{
+			"extended",
+			map[string][]string{
+				"AT+CIREG?\r\n": {"+CIREG: 2,1,5\r\n", "\r\nOK\r\n"},
+			},
+			gsm.IMSRegistration{Registered: true, Services: gsm.IMSVoice | gsm.IMSSMS},
+			nil,
+		},
+		{
+			"not registered",
+			map[string][]string{
+				"AT+CIREG?\r\n": {"+CIREG: 0,0\r\n", "\r\nOK\r\n"},
+			},
+			gsm.IMSRegistration{},
+			nil,
+		},
+		{
+			"malformed",
+			map[string][]string{
+				"AT+CIREG?\r\n": {"+CIREG: 0\r\n", "\r\nOK\r\n"},
+			},
+			gsm.IMSRegistration{},
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"unsupported",
+			map[string][]string{
+				"AT+CIREG?\r\n": {"\r\n+CME ERROR: 4\r\n"},
+			},
+			gsm.IMSRegistration{},
+			at.CMEError("4"),
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, p.cmdSet)
+			defer teardownModem(mm)
+
+			reg, err := g.IMSRegistration()
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.reg, reg)
+		}
+		t.Run(p.name, f)
+	}
+	r := gsm.IMSRegistration{Registered: true, Services: gsm.IMSVoice | gsm.IMSSMS}
+	assert.True(t, r.Has(gsm.IMSVoice))
+	assert.True(t, r.Has(gsm.IMSSMS))
+	assert.False(t, r.Has(gsm.IMSVideo))
+}
+
+func TestStartIMSRx(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CIREG=2\r\n": {"\r\nOK\r\n"},
+		"AT+CIREG?\r\n":  {"+CIREG: 2,0\r\n", "\r\nOK\r\n"},
+		"AT+CIREG=0\r\n": {"\r\nOK\r\n"},
+	}
+	b := gsm.NewEventBus()
+	events := make(chan gsm.Event, 10)
+	b.Subscribe(func(e gsm.Event) {
+		events <- e
+	}, gsm.IMSRegistrationChanged{})
+	g, mm := setupModem(t, cmdSet, gsm.WithEventBus(b))
+	defer teardownModem(mm)
+
+	changes := make(chan gsm.IMSRegistration, 10)
+	h := func(rc gsm.IMSRegistrationChanged) {
+		assert.False(t, rc.Time.IsZero())
+		changes <- rc.IMSRegistration
+	}
+	err := g.StartIMSRx(h)
+	require.Nil(t, err)
+	err = g.StartIMSRx(h)
+	assert.Equal(t, at.ErrIndicationExists, err)
+
+	mm.r <- []byte("+CIREG: 1,1\r\n")
+	time.Sleep(10 * time.Millisecond)
+	mm.r <- []byte("+CIREG: bad\r\n")
+	time.Sleep(10 * time.Millisecond)
+	mm.r <- []byte("+CIREG: 0\r\n")
+	expected := []gsm.IMSRegistration{
+		{},
+		{Registered: true, Services: gsm.IMSVoice},
+		{},
+	}
+	for _, x := range expected {
+		select {
+		case r := <-changes:
+			assert.Equal(t, x, r)
+		case <-time.After(100 * time.Millisecond):
+			t.Fatalf("no change received, expected %v", x)
+		}
+		select {
+		case e := <-events:
+			assert.Equal(t, x, e.(gsm.IMSRegistrationChanged).IMSRegistration)
+		case <-time.After(100 * time.Millisecond):
+			t.Fatalf("no event received, expected %v", x)
+		}
+	}
+
+	g.StopIMSRx()
+	mm.r <- []byte("+CIREG: 1\r\n")
+	select {
+	case r := <-changes:
+		t.Errorf("change received after stop: %v", r)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// basic reporting fallback
+	delete(cmdSet, "AT+CIREG=2\r\n")
+	cmdSet["AT+CIREG=1\r\n"] = []string{"\r\nOK\r\n"}
+	err = g.StartIMSRx(nil)
+	assert.Nil(t, err)
+	g.StopIMSRx()
+
+	// unsupported
+	delete(cmdSet, "AT+CIREG=1\r\n")
+	err = g.StartIMSRx(nil)
+	assert.Equal(t, at.ErrError, err)
+}
+
+func TestIMSConfig(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QCFG=\"ims\"\r\n": {"+QCFG: \"ims\",1,1\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	c, err := g.IMSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, gsm.IMSConfig{Mode: gsm.IMSOn, VoLTEReady: true}, c)
+
+	cmdSet["AT+QCFG=\"ims\"\r\n"] = []string{"+QCFG: \"ims\",0\r\n", "\r\nOK\r\n"}
+	c, err = g.IMSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, gsm.IMSConfig{Mode: gsm.IMSAuto}, c)
+
+	cmdSet["AT+QCFG=\"ims\"\r\n"] = []string{"+QCFG: \"ims\",on\r\n", "\r\nOK\r\n"}
+	_, err = g.IMSConfig()
+	assert.Equal(t, gsm.ErrMalformedResponse, err)
+
+	delete(cmdSet, "AT+QCFG=\"ims\"\r\n")
+	_, err = g.IMSConfig()
+	assert.Equal(t, at.ErrError, err)
+}
+
+func TestSetIMSMode(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QCFG=\"ims\",2\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	err := g.SetIMSMode(gsm.IMSOff)
+	assert.Nil(t, err)
+
+	err = g.SetIMSMode(gsm.IMSOn)
+	assert.Equal(t, at.ErrError, err)
+}
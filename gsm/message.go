@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"encoding/binary"
+
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// ApplicationPorts are the ports of a message using application port
+// addressing, such as a WAP push or a message directed to a particular
+// application on the handset.
+type ApplicationPorts struct {
+	// Destination is the port of the receiving application.
+	Destination int
+
+	// Source is the port of the sending application.
+	Source int
+}
+
+// the IEIs of the application port addressing information elements.
+const (
+	ieiPorts8  = 0x04
+	ieiPorts16 = 0x05
+)
+
+// applicationPorts returns the application ports from the UDH, or nil if the
+// UDH contains no application port addressing.
+func applicationPorts(udh tpdu.UserDataHeader) *ApplicationPorts {
+	if ie, ok := udh.IE(ieiPorts16); ok && len(ie.Data) == 4 {
+		return &ApplicationPorts{
+			Destination: int(binary.BigEndian.Uint16(ie.Data[0:2])),
+			Source:      int(binary.BigEndian.Uint16(ie.Data[2:4])),
+		}
+	}
+	if ie, ok := udh.IE(ieiPorts8); ok && len(ie.Data) == 2 {
+		return &ApplicationPorts{
+			Destination: int(ie.Data[0]),
+			Source:      int(ie.Data[1]),
+		}
+	}
+	return nil
+}
+
+// setMetadata populates the metadata of the message from its first TPDU.
+func (m *Message) setMetadata() {
+	m.Segments = 1
+	m.ConcatRef = -1
+	if len(m.TPDUs) == 0 || m.TPDUs[0] == nil {
+		return
+	}
+	first := m.TPDUs[0]
+	m.OA = first.OA
+	m.PID = first.PID
+	m.DCS = first.DCS
+	m.Alphabet, _ = first.DCS.Alphabet()
+	m.UDH = first.UDH
+	m.Ports = applicationPorts(first.UDH)
+	if segments, _, mref, ok := first.ConcatInfo(); ok && segments > 1 {
+		m.Segments = segments
+		m.ConcatRef = mref
+	}
+}
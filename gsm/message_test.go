@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestMessageMetadata(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		t.Errorf("error received: %v", err)
+	}
+	err := g.StartMessageRx(mh, eh)
+	require.Nil(t, err)
+
+	oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+	scts := tpdu.Timestamp{Time: time.Date(2020, 5, 1, 10, 37, 28, 0, time.UTC)}
+	rx := func(tp tpdu.TPDU) gsm.Message {
+		mm.r <- []byte(cmtIndication(t, tp))
+		select {
+		case msg := <-msgChan:
+			return msg
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("no message received")
+		}
+		return gsm.Message{}
+	}
+
+	// plain
+	msg := rx(tpdu.TPDU{OA: oa, SCTS: scts, UD: []byte("hello")})
+	assert.Equal(t, "hello", msg.Message)
+	assert.Equal(t, "+1234", msg.Number)
+	assert.Equal(t, oa, msg.OA)
+	assert.Equal(t, scts.Unix(), msg.SCTS.Unix())
+	assert.Equal(t, tpdu.Alpha7Bit, msg.Alphabet)
+	assert.Equal(t, byte(0), msg.PID)
+	assert.Nil(t, msg.UDH)
+	assert.Nil(t, msg.Ports)
+	assert.Equal(t, 1, msg.Segments)
+	assert.Equal(t, -1, msg.ConcatRef)
+
+	// 16-bit application ports
+	tp := tpdu.TPDU{OA: oa, PID: 0x01, DCS: 0x04, UD: []byte("data")}
+	tp.SetUDH(tpdu.UserDataHeader{{ID: 0x05, Data: []byte{0x0b, 0x84, 0x23, 0xf0}}})
+	msg = rx(tp)
+	assert.Equal(t, "data", msg.Message)
+	assert.Equal(t, byte(0x01), msg.PID)
+	assert.Equal(t, tpdu.DCS(0x04), msg.DCS)
+	assert.Equal(t, tpdu.Alpha8Bit, msg.Alphabet)
+	assert.Equal(t, &gsm.ApplicationPorts{Destination: 2948, Source: 9200}, msg.Ports)
+	assert.Len(t, msg.UDH, 1)
+
+	// 8-bit application ports
+	tp = tpdu.TPDU{OA: oa, UD: []byte("hello")}
+	tp.SetUDH(tpdu.UserDataHeader{{ID: 0x04, Data: []byte{0xf5, 0xf6}}})
+	msg = rx(tp)
+	assert.Equal(t, &gsm.ApplicationPorts{Destination: 0xf5, Source: 0xf6}, msg.Ports)
+
+	// concatenated
+	for seqno, ud := range [][]byte{{0, 'h', 0, 'i'}, {0, '!'}} {
+		tp = tpdu.TPDU{OA: oa, DCS: 0x08, UD: ud}
+		tp.SetUDH(tpdu.UserDataHeader{{ID: 0x00, Data: []byte{0x42, 2, byte(seqno + 1)}}})
+		mm.r <- []byte(cmtIndication(t, tp))
+	}
+	select {
+	case msg = <-msgChan:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	assert.Equal(t, "hi!", msg.Message)
+	assert.Equal(t, 2, msg.Segments)
+	assert.Equal(t, 0x42, msg.ConcatRef)
+	assert.Equal(t, tpdu.AlphaUCS2, msg.Alphabet)
+	assert.Len(t, msg.TPDUs, 2)
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// refCounter generates the references for outgoing TPDUs, such as the TP-MR
+// and the concatenation reference.
+//
+// The counter is shared by all sends, so the references cycle through all
+// values before repeating.  The TP-MR is also resynchronised with the TP-MR
+// reported by the modem, in case the modem assigns its own, so that delivery
+// reports can be unambiguously correlated with the sent TPDU.
+type refCounter struct {
+	mu   sync.Mutex
+	next int
+	mask int
+}
+
+func newRefCounter(seed, mask int) *refCounter {
+	return &refCounter{next: seed & mask, mask: mask}
+}
+
+// Count returns the next reference.
+func (c *refCounter) Count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ref := c.next
+	c.next = (c.next + 1) & c.mask
+	return ref
+}
+
+// sync resynchronises the counter with the mr returned by +CMGS.
+//
+// The mr may be followed by other fields, such as the SCTS, which are ignored.
+func (c *refCounter) sync(rsp string) {
+	mr, err := strconv.Atoi(strings.TrimSpace(strings.Split(rsp, ",")[0]))
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.next = (mr + 1) & c.mask
+	c.mu.Unlock()
+}
+
+type concatRefSeedOption int
+
+func (o concatRefSeedOption) applyOption(g *GSM) {
+	g.concatRef = newRefCounter(int(o), 0xff)
+}
+
+// WithConcatRefSeed specifies the concatenation reference number used for the
+// first long message sent.
+//
+// The reference is incremented for each subsequent long message.
+//
+// The default is 1.
+func WithConcatRefSeed(seed int) Option {
+	return concatRefSeedOption(seed)
+}
+
+// replyPath is a TPDU option that sets the TP-RP.
+type replyPath struct{}
+
+func (replyPath) ApplyTPDUOption(t *tpdu.TPDU) error {
+	t.FirstOctet |= tpdu.FoRP
+	return nil
+}
+
+// WithReplyPath requests that the TP-RP be set in sent messages, so that
+// replies are routed back via the same SMSC.
+//
+// This is only relevant in PDU mode.
+var WithReplyPath = encoderOption{sms.WithTemplateOption(replyPath{})}
@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// RegistrationStatus is the network registration status, as reported by
+// +CREG.
+type RegistrationStatus int
+
+const (
+	// NotRegistered indicates the modem is not registered and is not searching
+	// for an operator.
+	NotRegistered RegistrationStatus = iota
+
+	// RegisteredHome indicates the modem is registered to the home network.
+	RegisteredHome
+
+	// Searching indicates the modem is not registered but is searching for an
+	// operator.
+	Searching
+
+	// RegistrationDenied indicates registration was denied.
+	RegistrationDenied
+
+	// RegistrationUnknown indicates the registration status is unknown.
+	RegistrationUnknown
+
+	// RegisteredRoaming indicates the modem is registered to a roaming
+	// network.
+	RegisteredRoaming
+)
+
+// Registered returns true if the status indicates the modem is registered to
+// a network, either home or roaming.
+func (s RegistrationStatus) Registered() bool {
+	return s == RegisteredHome || s == RegisteredRoaming
+}
+
+// RegistrationStatus returns the network registration status.
+func (g *GSM) RegistrationStatus(options ...at.CommandOption) (RegistrationStatus, error) {
+	i, err := g.Command("+CREG?", options...)
+	if err != nil {
+		return RegistrationUnknown, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CREG") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+CREG"))
+		if len(fields) < 2 {
+			break
+		}
+		stat, err := strconv.Atoi(fields[1])
+		if err != nil {
+			break
+		}
+		return RegistrationStatus(stat), nil
+	}
+	return RegistrationUnknown, ErrMalformedResponse
+}
+
+// SignalQuality returns the received signal strength, rssi, and the bit error
+// rate, ber, as reported by +CSQ.
+//
+// The rssi ranges from 0 (-113dBm or less) to 31 (-51dBm or greater), and
+// both are 99 if unknown.
+func (g *GSM) SignalQuality(options ...at.CommandOption) (rssi int, ber int, err error) {
+	var i []string
+	i, err = g.Command("+CSQ", options...)
+	if err != nil {
+		return
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CSQ") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+CSQ"))
+		if len(fields) < 2 {
+			break
+		}
+		if rssi, err = strconv.Atoi(fields[0]); err != nil {
+			break
+		}
+		if ber, err = strconv.Atoi(fields[1]); err != nil {
+			break
+		}
+		return
+	}
+	err = ErrMalformedResponse
+	return
+}
+
+type sendGatingOption struct {
+	minRSSI int
+	timeout time.Duration
+}
+
+func (o sendGatingOption) applyOption(g *GSM) {
+	g.gate = &sendGate{minRSSI: o.minRSSI, timeout: o.timeout}
+}
+
+// WithSendGating holds sends until the modem is registered to a network with
+// an rssi of at least minRSSI, rather than having them fail during an outage.
+//
+// Sends are held for up to the timeout, or until the context provided by
+// WithContext is done, after which they fail with ErrNoService.  Held sends
+// are released in order once service returns.
+func WithSendGating(minRSSI int, timeout time.Duration) Option {
+	return sendGatingOption{minRSSI, timeout}
+}
+
+// sendGate holds sends while the modem has no network service.
+type sendGate struct {
+	minRSSI int
+	timeout time.Duration
+
+	mu sync.Mutex
+	// the time until which service is assumed, following a successful check.
+	okUntil time.Time
+	// closed when the most recently held send is released, so held sends
+	// can queue behind it.
+	tail chan struct{}
+}
+
+// the period between checks of network service while sends are held.
+var sendGatePollPeriod = 250 * time.Millisecond
+
+// the period for which a successful network service check remains valid.
+var sendGateCacheTTL = 5 * time.Second
+
+// waitForService waits until the modem has network service, if send gating
+// is enabled.
+//
+// Held sends are queued, with only the send at the head of the queue polling
+// for service, and the returned function releases the next held send, so it
+// should be called once the send has acquired sendMu to preserve the order.
+func (g *GSM) waitForService(ctx context.Context) (func(), error) {
+	gate := g.gate
+	if gate == nil {
+		return func() {}, nil
+	}
+	gate.mu.Lock()
+	if time.Now().Before(gate.okUntil) && gate.tail == nil {
+		gate.mu.Unlock()
+		return func() {}, nil
+	}
+	prev := gate.tail
+	done := make(chan struct{})
+	gate.tail = done
+	gate.mu.Unlock()
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			gate.mu.Lock()
+			if gate.tail == done {
+				gate.tail = nil
+			}
+			gate.mu.Unlock()
+			close(done)
+		})
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, gate.timeout)
+	defer cancel()
+	if prev != nil {
+		select {
+		case <-prev:
+		case <-ctx.Done():
+			// keep the queue intact for those behind.
+			go func() {
+				<-prev
+				release()
+			}()
+			return nil, ErrNoService
+		}
+	}
+	gate.mu.Lock()
+	ok := time.Now().Before(gate.okUntil)
+	gate.mu.Unlock()
+	for !ok {
+		if g.inService(gate.minRSSI) {
+			gate.mu.Lock()
+			gate.okUntil = time.Now().Add(sendGateCacheTTL)
+			gate.mu.Unlock()
+			break
+		}
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, ErrNoService
+		case <-time.After(sendGatePollPeriod):
+		}
+	}
+	return release, nil
+}
+
+// inService returns true if the modem is registered with sufficient signal.
+func (g *GSM) inService(minRSSI int) bool {
+	stat, err := g.RegistrationStatus()
+	if err != nil || !stat.Registered() {
+		return false
+	}
+	rssi, _, err := g.SignalQuality()
+	return err == nil && rssi != 99 && rssi >= minRSSI
+}
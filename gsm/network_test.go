@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"encoding/hex"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestRegistrationStatus(t *testing.T) {
+	patterns := []struct {
+		name string
+		rsp  []string
+		stat gsm.RegistrationStatus
+		err  error
+	}{
+		{"home", []string{"+CREG: 0,1\r\n", "OK\r\n"}, gsm.RegisteredHome, nil},
+		{"roaming", []string{"+CREG: 2,5,\"1A2B\",\"0C3D\"\r\n", "OK\r\n"}, gsm.RegisteredRoaming, nil},
+		{"searching", []string{"+CREG: 0,2\r\n", "OK\r\n"}, gsm.Searching, nil},
+		{"malformed", []string{"+CREG: 0\r\n", "OK\r\n"}, gsm.RegistrationUnknown, gsm.ErrMalformedResponse},
+		{"missing", []string{"OK\r\n"}, gsm.RegistrationUnknown, gsm.ErrMalformedResponse},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, map[string][]string{"AT+CREG?\r\n": p.rsp})
+			defer teardownModem(mm)
+			stat, err := g.RegistrationStatus()
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.stat, stat)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestSignalQuality(t *testing.T) {
+	patterns := []struct {
+		name string
+		rsp  []string
+		rssi int
+		ber  int
+		err  error
+	}{
+		{"good", []string{"+CSQ: 20,0\r\n", "OK\r\n"}, 20, 0, nil},
+		{"unknown", []string{"+CSQ: 99,99\r\n", "OK\r\n"}, 99, 99, nil},
+		{"missing", []string{"OK\r\n"}, 0, 0, gsm.ErrMalformedResponse},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, map[string][]string{"AT+CSQ\r\n": p.rsp})
+			defer teardownModem(mm)
+			rssi, ber, err := g.SignalQuality()
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.rssi, rssi)
+			assert.Equal(t, p.ber, ber)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestWithSendGating(t *testing.T) {
+	patterns := []struct {
+		name string
+		creg []string
+		csq  []string
+		mr   string
+		err  error
+	}{
+		{
+			"in service",
+			[]string{"+CREG: 0,1\r\n", "OK\r\n"},
+			[]string{"+CSQ: 20,0\r\n", "OK\r\n"},
+			"42",
+			nil,
+		},
+		{
+			"unregistered",
+			[]string{"+CREG: 0,2\r\n", "OK\r\n"},
+			[]string{"+CSQ: 20,0\r\n", "OK\r\n"},
+			"",
+			gsm.ErrNoService,
+		},
+		{
+			"weak signal",
+			[]string{"+CREG: 0,5\r\n", "OK\r\n"},
+			[]string{"+CSQ: 3,0\r\n", "OK\r\n"},
+			"",
+			gsm.ErrNoService,
+		},
+		{
+			"unknown signal",
+			[]string{"+CREG: 0,1\r\n", "OK\r\n"},
+			[]string{"+CSQ: 99,99\r\n", "OK\r\n"},
+			"",
+			gsm.ErrNoService,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{
+				"AT+CREG?\r\n": p.creg,
+				"AT+CSQ\r\n":   p.csq,
+				"AT+CMGS=23\r": {"\n>"},
+				"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(rune(26)): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
+			}
+			g, mm := setupModem(t, cmdSet, gsm.WithSendGating(10, 300*time.Millisecond))
+			defer teardownModem(mm)
+			start := time.Now()
+			mr, err := g.SendShortMessage("+123456789", "test message")
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.mr, mr)
+			assert.True(t, time.Since(start) < time.Second)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestSendGatingOrder(t *testing.T) {
+	tp := func(mr string) []byte {
+		b, _ := hex.DecodeString("01" + mr + "099121436587f900000cf4f29c0e6a97e7f3f0b90c")
+		return b
+	}
+	pdu := func(mr string) string {
+		return "00" + hex.EncodeToString(tp(mr)) + string(rune(26))
+	}
+	cmdSet := map[string][]string{
+		"AT+CREG?\r\n": {"+CREG: 0,2\r\n", "OK\r\n"},
+		"AT+CSQ\r\n":   {"+CSQ: 20,0\r\n", "OK\r\n"},
+		"AT+CMGS=23\r": {"\n>"},
+		pdu("01"):      {"\r\n", "+CMGS: 1\r\n", "\r\nOK\r\n"},
+		pdu("02"):      {"\r\n", "+CMGS: 2\r\n", "\r\nOK\r\n"},
+		pdu("03"):      {"\r\n", "+CMGS: 3\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet, gsm.WithSendGating(10, 2*time.Second))
+	defer teardownModem(mm)
+
+	// held sends are released in the order they were made
+	var wg sync.WaitGroup
+	for _, mr := range []string{"01", "02", "03"} {
+		wg.Add(1)
+		go func(mr string) {
+			defer wg.Done()
+			_, err := g.SendPDU(tp(mr))
+			assert.Nil(t, err)
+		}(mr)
+		time.Sleep(20 * time.Millisecond)
+	}
+	mm.mu.Lock()
+	cmdSet["AT+CREG?\r\n"] = []string{"+CREG: 0,1\r\n", "OK\r\n"}
+	mm.mu.Unlock()
+	wg.Wait()
+
+	var sent []string
+	for _, cmd := range mm.written() {
+		if strings.HasSuffix(cmd, string(rune(26))) {
+			sent = append(sent, cmd)
+		}
+	}
+	require.Equal(t, []string{pdu("01"), pdu("02"), pdu("03")}, sent)
+	// only the head of the queue polls
+	creg := 0
+	for _, cmd := range mm.written() {
+		if cmd == "AT+CREG?\r\n" {
+			creg++
+		}
+	}
+	assert.True(t, creg < 5, creg)
+}
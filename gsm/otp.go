@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"regexp"
+	"strings"
+)
+
+// OTPReceived is published when a one time password is recognised in a
+// received message.
+type OTPReceived struct {
+	// Code is the one time password, with any separators removed.
+	Code string
+
+	// Sender is the originating address of the message.
+	Sender string
+
+	// Message is the message containing the code.
+	Message Message
+}
+
+// OTPHandler receives the one time passwords recognised in received messages.
+type OTPHandler func(OTPReceived)
+
+// OTPRule is a pattern for recognising one time passwords.
+//
+// The code is formed from the submatches of the pattern, concatenated, or
+// the complete match if the pattern has no submatches.  This allows codes
+// with separators, such as "123-456", to be reported as "123456".
+type OTPRule struct {
+	// Sender restricts the rule to messages from the sender.
+	//
+	// The comparison is case insensitive, so alphanumeric senders may be
+	// provided in any case.  The rule applies to all senders if empty.
+	Sender string
+
+	// Pattern recognises the code in the message text.
+	Pattern *regexp.Regexp
+}
+
+// DefaultOTPRules are the rules applied if none are provided to
+// WithOTPExtraction.
+//
+// They recognise 4 to 8 digit codes following common keywords, such as
+// "code" or "OTP", codes of the form "G-123456" or "123-456", and 6 digit
+// codes standing alone.
+var DefaultOTPRules = []OTPRule{
+	{Pattern: regexp.MustCompile(`(?i)(?:code|otp|pin|passcode|password|verification)\D{0,20}?\b(\d{4,8})\b`)},
+	{Pattern: regexp.MustCompile(`\b[A-Z]-(\d{4,8})\b`)},
+	{Pattern: regexp.MustCompile(`\b(\d{3})[- ](\d{3})\b`)},
+	{Pattern: regexp.MustCompile(`\b(\d{6})\b`)},
+}
+
+type otpOption struct {
+	h     OTPHandler
+	rules []OTPRule
+}
+
+func (o otpOption) applyRxOption(c *rxConfig) {
+	c.otp = &o
+}
+
+// WithOTPExtraction checks received messages for one time passwords and
+// passes any recognised to the handler, in addition to the message being
+// passed to the message handler.
+//
+// The rules are tried in order, and the first match is reported, so more
+// specific rules, such as those for a particular sender, should precede more
+// general ones.  If no rules are provided then DefaultOTPRules are applied.
+//
+// If an EventBus is provided to StartMessageRx then the codes are also
+// published as OTPReceived.  The handler may be nil in that case.
+func WithOTPExtraction(h OTPHandler, rules ...OTPRule) RxOption {
+	if len(rules) == 0 {
+		rules = DefaultOTPRules
+	}
+	return otpOption{h, rules}
+}
+
+// ExtractOTP returns the one time password in the message, as recognised by
+// the first matching rule.
+//
+// Returns false if no rule matches.
+func ExtractOTP(m Message, rules ...OTPRule) (OTPReceived, bool) {
+	for _, r := range rules {
+		if r.Sender != "" && !strings.EqualFold(r.Sender, m.Number) {
+			continue
+		}
+		match := r.Pattern.FindStringSubmatch(m.Message)
+		if match == nil {
+			continue
+		}
+		code := match[0]
+		if len(match) > 1 {
+			code = strings.Join(match[1:], "")
+		}
+		return OTPReceived{Code: code, Sender: m.Number, Message: m}, true
+	}
+	return OTPReceived{}, false
+}
+
+// extend extends the message handler to extract one time passwords from the
+// messages.
+func (o *otpOption) extend(mh MessageHandler, b *EventBus) MessageHandler {
+	return func(m Message) {
+		mh(m)
+		otp, ok := ExtractOTP(m, o.rules...)
+		if !ok {
+			return
+		}
+		if o.h != nil {
+			o.h(otp)
+		}
+		if b != nil {
+			b.Publish(otp)
+		}
+	}
+}
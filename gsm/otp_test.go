@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestExtractOTP(t *testing.T) {
+	bankRule := gsm.OTPRule{
+		Sender:  "MyBank",
+		Pattern: regexp.MustCompile(`ref ([A-Z0-9]{5})`),
+	}
+	rules := append([]gsm.OTPRule{bankRule}, gsm.DefaultOTPRules...)
+	patterns := []struct {
+		name   string
+		sender string
+		msg    string
+		code   string
+		ok     bool
+	}{
+		{"keyword", "+1234", "Your verification code is 482913.", "482913", true},
+		{"keyword otp", "+1234", "OTP: 1234 valid for 5 minutes", "1234", true},
+		{"keyword case", "+1234", "Use PASSCODE 99887766 to log in", "99887766", true},
+		{"prefixed", "Google", "G-482913 is your Google verification code.", "482913", true},
+		{"separated", "+1234", "Enter 482-913 to confirm", "482913", true},
+		{"standalone", "+1234", "482913 - do not share", "482913", true},
+		{"sender rule", "MYBANK", "Transaction ref AB12C, code 1234", "AB12C", true},
+		{"sender rule other sender", "+1234", "Transaction ref AB12C, code 1234", "1234", true},
+		{"none", "+1234", "See you at 10", "", false},
+		{"too long", "+1234", "Order 123456789 shipped", "", false},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			m := gsm.Message{Number: p.sender, Message: p.msg}
+			otp, ok := gsm.ExtractOTP(m, rules...)
+			assert.Equal(t, p.ok, ok)
+			assert.Equal(t, p.code, otp.Code)
+			if ok {
+				assert.Equal(t, p.sender, otp.Sender)
+				assert.Equal(t, m, otp.Message)
+			}
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestWithOTPExtraction(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		t.Errorf("error received: %v", err)
+	}
+	otpChan := make(chan gsm.OTPReceived, 3)
+	oh := func(otp gsm.OTPReceived) {
+		otpChan <- otp
+	}
+	bus := gsm.NewEventBus()
+	evChan := make(chan gsm.Event, 3)
+	bus.Subscribe(func(e gsm.Event) { evChan <- e }, gsm.OTPReceived{})
+	err := g.StartMessageRx(mh, eh, gsm.WithOTPExtraction(oh), gsm.WithEventBus(bus))
+	require.Nil(t, err)
+
+	oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+	scts := tpdu.Timestamp{Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, SCTS: scts, UD: []byte("Your code is 482913")}))
+	select {
+	case m := <-msgChan:
+		assert.Equal(t, "Your code is 482913", m.Message)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	select {
+	case otp := <-otpChan:
+		assert.Equal(t, "482913", otp.Code)
+		assert.Equal(t, "+1234", otp.Sender)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no OTP received")
+	}
+	select {
+	case e := <-evChan:
+		require.IsType(t, gsm.OTPReceived{}, e)
+		assert.Equal(t, "482913", e.(gsm.OTPReceived).Code)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no OTP event published")
+	}
+
+	// no OTP
+	mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, SCTS: scts, UD: []byte("hello")}))
+	select {
+	case <-msgChan:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	select {
+	case otp := <-otpChan:
+		t.Errorf("unexpected OTP: %v", otp)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
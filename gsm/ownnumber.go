@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"encoding/hex"
+	"strconv"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+	"github.com/warthog618/sms/encoding/ucs2"
+)
+
+// OwnNumber is a subscriber number (MSISDN) associated with the SIM.
+type OwnNumber struct {
+	// Alpha is the optional alphanumeric label associated with the number.
+	Alpha string
+
+	// Number is the subscriber number.
+	Number string
+
+	// Type is the type of address octet of the number, e.g. 145 for
+	// international numbers.
+	Type int
+}
+
+// GetOwnNumbers returns the subscriber numbers associated with the SIM, as
+// reported by +CNUM.
+//
+// The numbers are read from the modem on the first call and cached for
+// subsequent calls.  The cache is flushed by Init.
+//
+// If the modem character set is UCS2 then the alpha and number fields are
+// decoded from their hex form.
+//
+// SIMs that do not have their own number provisioned return an empty list.
+func (g *GSM) GetOwnNumbers(options ...at.CommandOption) ([]OwnNumber, error) {
+	g.mu.Lock()
+	nums := g.ownNumbers
+	g.mu.Unlock()
+	if nums != nil {
+		return append([]OwnNumber(nil), nums...), nil
+	}
+	isUCS2 := false
+	if i, err := g.Command("+CSCS?", options...); err == nil {
+		for _, l := range i {
+			if info.HasPrefix(l, "+CSCS") {
+				isUCS2 = info.Fields(info.TrimPrefix(l, "+CSCS"))[0] == "UCS2"
+			}
+		}
+	}
+	i, err := g.Command("+CNUM", options...)
+	if err != nil {
+		return nil, err
+	}
+	nums = []OwnNumber{}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CNUM") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+CNUM"))
+		if len(fields) < 3 {
+			return nil, ErrMalformedResponse
+		}
+		n := OwnNumber{Alpha: fields[0], Number: fields[1]}
+		n.Type, err = strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, ErrMalformedResponse
+		}
+		if isUCS2 {
+			n.Alpha = decodeUCS2Hex(n.Alpha)
+			n.Number = decodeUCS2Hex(n.Number)
+		}
+		nums = append(nums, n)
+	}
+	g.mu.Lock()
+	g.ownNumbers = nums
+	g.mu.Unlock()
+	return append([]OwnNumber(nil), nums...), nil
+}
+
+// decodeUCS2Hex decodes a string in the hex encoded UCS2 form used by modems
+// in the UCS2 character set.
+//
+// If the string cannot be decoded it is returned unaltered.
+func decodeUCS2Hex(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return s
+	}
+	r, err := ucs2.Decode(b)
+	if err != nil {
+		return s
+	}
+	return string(r)
+}
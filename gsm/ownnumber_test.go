@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestGetOwnNumbers(t *testing.T) {
+	patterns := []struct {
+		name   string
+		cmdSet map[string][]string
+		nums   []gsm.OwnNumber
+		err    error
+	}{
+		{
+			"gsm",
+			map[string][]string{
+				"AT+CSCS?\r\n": {"+CSCS: \"GSM\"\r\n", "OK\r\n"},
+				"AT+CNUM\r\n": {
+					"+CNUM: \"Voice, main\",\"+61123456789\",145\r\n",
+					"+CNUM: ,\"0412345678\",129\r\n",
+					"OK\r\n",
+				},
+			},
+			[]gsm.OwnNumber{
+				{Alpha: "Voice, main", Number: "+61123456789", Type: 145},
+				{Number: "0412345678", Type: 129},
+			},
+			nil,
+		},
+		{
+			"ucs2",
+			map[string][]string{
+				"AT+CSCS?\r\n": {"+CSCS: \"UCS2\"\r\n", "OK\r\n"},
+				"AT+CNUM\r\n": {
+					"+CNUM: \"00480069\",\"002B00360031003100320033\",145\r\n",
+					"OK\r\n",
+				},
+			},
+			[]gsm.OwnNumber{
+				{Alpha: "Hi", Number: "+61123", Type: 145},
+			},
+			nil,
+		},
+		{
+			"no cscs",
+			map[string][]string{
+				"AT+CNUM\r\n": {"+CNUM: ,\"+61123456789\",145\r\n", "OK\r\n"},
+			},
+			[]gsm.OwnNumber{
+				{Number: "+61123456789", Type: 145},
+			},
+			nil,
+		},
+		{
+			"none",
+			map[string][]string{
+				"AT+CNUM\r\n": {"OK\r\n"},
+			},
+			nil,
+			nil,
+		},
+		{
+			"malformed",
+			map[string][]string{
+				"AT+CNUM\r\n": {"+CNUM: ,\"+61123456789\"\r\n", "OK\r\n"},
+			},
+			nil,
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"bad type",
+			map[string][]string{
+				"AT+CNUM\r\n": {"+CNUM: ,\"+61123456789\",int\r\n", "OK\r\n"},
+			},
+			nil,
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"error",
+			nil,
+			nil,
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, p.cmdSet)
+			defer teardownModem(mm)
+			nums, err := g.GetOwnNumbers()
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.nums, nums)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestGetOwnNumbersCached(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNUM\r\n": {"+CNUM: ,\"+61123456789\",145\r\n", "OK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+	nums, err := g.GetOwnNumbers()
+	assert.Nil(t, err)
+	assert.Equal(t, []gsm.OwnNumber{{Number: "+61123456789", Type: 145}}, nums)
+
+	// cached, so modem not queried
+	delete(cmdSet, "AT+CNUM\r\n")
+	nums, err = g.GetOwnNumbers()
+	assert.Nil(t, err)
+	assert.Equal(t, []gsm.OwnNumber{{Number: "+61123456789", Type: 145}}, nums)
+}
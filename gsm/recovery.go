@@ -0,0 +1,223 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/at"
+)
+
+// RecoveryStep is one rung of the recovery ladder.
+type RecoveryStep struct {
+	// Name identifies the step in events.
+	Name string
+
+	// Action attempts to recover the modem.
+	Action func(g *GSM) error
+}
+
+// ReinitStep re-initialises the modem using Init.
+//
+// Init resets the modem, so if messages are being received the configuration
+// set by StartMessageRx, such as +CNMI, is then restored.  The step fails if
+// the configuration cannot be restored.
+var ReinitStep = RecoveryStep{
+	Name: "reinit",
+	Action: func(g *GSM) error {
+		if err := g.Init(); err != nil {
+			return err
+		}
+		return g.restoreMessageRx()
+	},
+}
+
+// CFUNCycleStep cycles the modem functionality, turning the radio off and on
+// again.
+var CFUNCycleStep = RecoveryStep{
+	Name: "cfun cycle",
+	Action: func(g *GSM) error {
+		if _, err := g.Command("+CFUN=0", at.WithTimeout(15*time.Second)); err != nil {
+			return err
+		}
+		_, err := g.Command("+CFUN=1", at.WithTimeout(15*time.Second))
+		return err
+	},
+}
+
+// VendorResetStep returns a step that issues a vendor specific reset command,
+// such as "+CFUN=1,1".
+func VendorResetStep(cmd string) RecoveryStep {
+	return RecoveryStep{
+		Name: "vendor reset",
+		Action: func(g *GSM) error {
+			_, err := g.Command(cmd)
+			return err
+		},
+	}
+}
+
+// HardwareResetStep returns a step that calls the provided function to reset
+// the modem in hardware, such as by toggling DTR or a GPIO.
+func HardwareResetStep(reset func() error) RecoveryStep {
+	return RecoveryStep{
+		Name: "hardware reset",
+		Action: func(*GSM) error {
+			return reset()
+		},
+	}
+}
+
+// RecoveryAttempted is published to the EventBus provided to New for each
+// recovery step taken.
+type RecoveryAttempted struct {
+	// Step is the name of the step.
+	Step string
+
+	// Level is the index of the step in the ladder.
+	Level int
+
+	// Err is the error returned by the step.
+	Err error
+}
+
+// Recovery escalates through a ladder of recovery steps while commands to the
+// modem persistently fail.
+//
+// Failures are reported to the Recovery, using Report or Command.  Once the
+// number of consecutive failures reaches the threshold the next step of the
+// ladder is taken.  Subsequent steps are taken only after the holdoff
+// period, to allow the previous step to take effect, and the ladder resets to
+// the first step once commands have succeeded for the holdoff period.
+type Recovery struct {
+	g         *GSM
+	steps     []RecoveryStep
+	threshold int
+	holdoff   time.Duration
+
+	mu       sync.Mutex
+	failures int
+	level    int
+	last     time.Time
+}
+
+// RecoveryOption is a construction option for a Recovery.
+type RecoveryOption interface {
+	applyRecoveryOption(*Recovery)
+}
+
+type recoveryStepsOption []RecoveryStep
+
+func (o recoveryStepsOption) applyRecoveryOption(r *Recovery) {
+	r.steps = []RecoveryStep(o)
+}
+
+// WithRecoverySteps specifies the steps of the recovery ladder, in order of
+// escalation.
+//
+// The default is ReinitStep followed by CFUNCycleStep.
+func WithRecoverySteps(steps ...RecoveryStep) RecoveryOption {
+	return recoveryStepsOption(steps)
+}
+
+type failureThresholdOption int
+
+func (o failureThresholdOption) applyRecoveryOption(r *Recovery) {
+	r.threshold = int(o)
+}
+
+// WithFailureThreshold specifies the number of consecutive failures that
+// trigger a recovery step.
+//
+// The default is 3.
+func WithFailureThreshold(n int) RecoveryOption {
+	return failureThresholdOption(n)
+}
+
+type recoveryHoldoffOption time.Duration
+
+func (o recoveryHoldoffOption) applyRecoveryOption(r *Recovery) {
+	r.holdoff = time.Duration(o)
+}
+
+// WithRecoveryHoldoff specifies the minimum period between recovery steps,
+// and the period commands must succeed for the ladder to reset.
+//
+// The default is 1 minute.
+func WithRecoveryHoldoff(d time.Duration) RecoveryOption {
+	return recoveryHoldoffOption(d)
+}
+
+// NewRecovery creates a recovery ladder for the modem.
+func (g *GSM) NewRecovery(options ...RecoveryOption) *Recovery {
+	r := Recovery{
+		g:         g,
+		steps:     []RecoveryStep{ReinitStep, CFUNCycleStep},
+		threshold: 3,
+		holdoff:   time.Minute,
+	}
+	for _, option := range options {
+		option.applyRecoveryOption(&r)
+	}
+	return &r
+}
+
+// Command issues the command to the modem and reports the outcome to the
+// Recovery.
+func (r *Recovery) Command(cmd string, options ...at.CommandOption) ([]string, error) {
+	i, err := r.g.Command(cmd, options...)
+	r.Report(err)
+	return i, err
+}
+
+// Report reports the outcome of a command to the Recovery, which takes the
+// next recovery step if the failure threshold is reached.
+//
+// Failures reported during the holdoff period accumulate, so the next step is
+// taken on the first failure after the holdoff if the threshold was reached
+// in the meantime.
+//
+// Only failures indicating the modem is unresponsive, such as timeouts,
+// count towards the threshold.  Errors returned by the modem, such as CME
+// errors, indicate the modem is responsive, so are treated as successes.
+//
+// Returns true if a recovery step was taken.
+func (r *Recovery) Report(err error) bool {
+	r.mu.Lock()
+	if !errors.Is(err, at.ErrDeadlineExceeded) {
+		r.failures = 0
+		if r.level > 0 && time.Since(r.last) >= r.holdoff {
+			r.level = 0
+		}
+		r.mu.Unlock()
+		return false
+	}
+	r.failures++
+	if r.failures < r.threshold || len(r.steps) == 0 ||
+		(r.level > 0 && time.Since(r.last) < r.holdoff) {
+		r.mu.Unlock()
+		return false
+	}
+	level := r.level
+	if level >= len(r.steps) {
+		// stay on the last rung
+		level = len(r.steps) - 1
+	}
+	r.level = level + 1
+	r.failures = 0
+	r.mu.Unlock()
+
+	step := r.steps[level]
+	serr := step.Action(r.g)
+	r.mu.Lock()
+	r.last = time.Now()
+	r.mu.Unlock()
+	if r.g.bus != nil {
+		r.g.bus.Publish(RecoveryAttempted{Step: step.Name, Level: level, Err: serr})
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestRecovery(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CFUN=1,1\r\n": {"OK\r\n"},
+		"AT+CFUN=0\r\n":   {"OK\r\n"},
+		"AT+CFUN=1\r\n":   {"OK\r\n"},
+		"AT+CSQ\r\n":      {"+CSQ: 20,0\r\n", "OK\r\n"},
+	}
+	b := gsm.NewEventBus()
+	var events []gsm.Event
+	b.Subscribe(func(e gsm.Event) {
+		events = append(events, e)
+	})
+	g, mm := setupModem(t, cmdSet, gsm.WithEventBus(b))
+	defer teardownModem(mm)
+
+	hwErr := errors.New("no gpio")
+	hwResets := 0
+	r := g.NewRecovery(
+		gsm.WithRecoverySteps(
+			gsm.CFUNCycleStep,
+			gsm.VendorResetStep("+CFUN=1,1"),
+			gsm.HardwareResetStep(func() error {
+				hwResets++
+				return hwErr
+			})),
+		gsm.WithFailureThreshold(2),
+		gsm.WithRecoveryHoldoff(50*time.Millisecond))
+
+	fail := at.ErrDeadlineExceeded
+	// below threshold
+	assert.False(t, r.Report(fail))
+	// modem errors are not failures
+	assert.False(t, r.Report(at.CMEError("3")))
+	assert.False(t, r.Report(fail))
+	// first rung
+	assert.True(t, r.Report(fail))
+	assert.Equal(t, []gsm.Event{gsm.RecoveryAttempted{Step: "cfun cycle", Level: 0}}, events)
+
+	// holdoff - failures accumulate but no step is taken
+	assert.False(t, r.Report(fail))
+	assert.False(t, r.Report(fail))
+	time.Sleep(60 * time.Millisecond)
+	// second rung
+	assert.True(t, r.Report(fail))
+	time.Sleep(60 * time.Millisecond)
+	assert.False(t, r.Report(fail))
+	// third rung
+	assert.True(t, r.Report(fail))
+	time.Sleep(60 * time.Millisecond)
+	assert.False(t, r.Report(fail))
+	// stays on last rung
+	assert.True(t, r.Report(fail))
+	assert.Equal(t, 2, hwResets)
+	assert.Equal(t, []gsm.Event{
+		gsm.RecoveryAttempted{Step: "cfun cycle", Level: 0},
+		gsm.RecoveryAttempted{Step: "vendor reset", Level: 1},
+		gsm.RecoveryAttempted{Step: "hardware reset", Level: 2, Err: hwErr},
+		gsm.RecoveryAttempted{Step: "hardware reset", Level: 2, Err: hwErr},
+	}, events)
+
+	// success after holdoff resets ladder
+	time.Sleep(60 * time.Millisecond)
+	_, err := r.Command("+CSQ")
+	assert.Nil(t, err)
+	assert.False(t, r.Report(fail))
+	assert.True(t, r.Report(fail))
+	assert.Equal(t, gsm.RecoveryAttempted{Step: "cfun cycle", Level: 0}, events[len(events)-1])
+}
+
+func TestRecoveryDefaults(t *testing.T) {
+	g, mm := setupModem(t, nil)
+	defer teardownModem(mm)
+	r := g.NewRecovery(gsm.WithRecoverySteps())
+	for i := 0; i < 5; i++ {
+		assert.False(t, r.Report(at.ErrDeadlineExceeded))
+	}
+}
+
+func TestReinitStepRestoresRx(t *testing.T) {
+	cmdSet := map[string][]string{
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"OK\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
+		"AT+CMEE=2\r\n":               {"OK\r\n"},
+		"AT+CMGF=0\r\n":               {"OK\r\n"},
+		"AT+GCAP\r\n":                 {"+GCAP: +CGSM\r\n", "OK\r\n"},
+		"AT+CSMS?\r\n":                {"+CSMS: 0,1,1,1\r\n", "OK\r\n"},
+		"AT+CNMI=1,2,0,0,0\r\n":       {"OK\r\n"},
+	}
+	mm := mockModem{
+		cmdSet:    cmdSet,
+		r:         make(chan []byte, 10),
+		readDelay: time.Millisecond,
+	}
+	defer teardownModem(&mm)
+	g := gsm.New(at.New(&mm))
+	require.NotNil(t, g)
+
+	// not receiving, so nothing to restore
+	assert.Nil(t, gsm.ReinitStep.Action(g))
+	assert.NotContains(t, mm.written(), "AT+CNMI=1,2,0,0,0\r\n")
+
+	err := g.StartMessageRx(func(gsm.Message) {}, func(error) {})
+	require.Nil(t, err)
+	n := len(mm.written())
+
+	// +CNMI is restored after the reset
+	assert.Nil(t, gsm.ReinitStep.Action(g))
+	cmds := mm.written()[n:]
+	assert.Equal(t, "ATZ\r\n", cmds[1])
+	assert.Equal(t, "AT+CNMI=1,2,0,0,0\r\n", cmds[len(cmds)-1])
+
+	// and the step fails if it cannot be
+	cmdSet["AT+CNMI=1,2,0,0,0\r\n"] = []string{"ERROR\r\n"}
+	assert.Equal(t, at.ErrError, gsm.ReinitStep.Action(g))
+
+	// not restored once stopped
+	g.StopMessageRx()
+	assert.Nil(t, gsm.ReinitStep.Action(g))
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// StatusReportHandler receives the status reports of sent messages.
+type StatusReportHandler func(StatusReport)
+
+type srrOption struct {
+	at.LayerOption
+}
+
+func (o srrOption) applySendOption(c *sendConfig) {
+	c.srr = true
+	c.eOpts = append(c.eOpts, sms.WithTemplateOption(statusReportRequest{}))
+}
+
+// WithStatusReportRequest sets the TP-SRR of the sent TPDUs, requesting the
+// SMSC return an SMS-STATUS-REPORT once each TPDU is delivered, or delivery
+// fails.
+//
+// The reports are received by StartMessageRx with WithStatusReports applied,
+// and are correlated with the mr returned by the send using
+// SubscribeStatusReport.
+//
+// Applies to SendShortMessage and SendLongMessage in PDU mode, and to
+// SendPDU, where the TP-SRR is set in the provided TPDU.  In text mode the
+// TP-SRR is determined by the first octet set using +CSMP.
+func WithStatusReportRequest() at.CommandOption {
+	return srrOption{"gsm.WithStatusReportRequest"}
+}
+
+// statusReportRequest is a TPDU option that sets the TP-SRR.
+type statusReportRequest struct{}
+
+func (statusReportRequest) ApplyTPDUOption(t *tpdu.TPDU) error {
+	t.FirstOctet |= tpdu.FoSRR
+	return nil
+}
+
+// withSRR returns a copy of the binary TPDU with the TP-SRR set.
+func withSRR(b []byte) []byte {
+	if len(b) == 0 {
+		return b
+	}
+	b = append([]byte(nil), b...)
+	b[0] |= byte(tpdu.FoSRR)
+	return b
+}
+
+type statusReportsOption StatusReportHandler
+
+func (o statusReportsOption) applyRxOption(c *rxConfig) {
+	c.srh = StatusReportHandler(o)
+	c.reports = true
+}
+
+// WithStatusReports enables the receipt of SMS-STATUS-REPORTs, which the
+// modem is directed to forward via +CDS indications.
+//
+// Each report is passed to the handlers registered for its TP-MR using
+// SubscribeStatusReport, and to the handler h, if not nil, and published as a
+// StatusReport if WithEventBus is also applied.
+//
+// The +CNMI initial command is altered to forward status reports, so any
+// command provided by WithInitialCommand should select the same <mt>.
+//
+// Reports are only returned by the SMSC for messages sent with
+// WithStatusReportRequest.
+func WithStatusReports(h StatusReportHandler) RxOption {
+	return statusReportsOption(h)
+}
+
+// cnmiWithReports returns the +CNMI command with the SMS-STATUS-REPORT mode
+// changed to forward reports via +CDS.
+func cnmiWithReports(cmd string) string {
+	fields := strings.Split(strings.TrimPrefix(cmd, "+CNMI="), ",")
+	if !strings.HasPrefix(cmd, "+CNMI=") || len(fields) < 4 {
+		return "+CNMI=1,2,0,1,0"
+	}
+	fields[3] = "1"
+	return "+CNMI=" + strings.Join(fields, ",")
+}
+
+// reportRouter passes status reports to the handlers subscribed to their
+// TP-MR.
+type reportRouter struct {
+	mu     sync.Mutex
+	nextID int
+	subs   map[int]map[int]StatusReportHandler
+}
+
+func newReportRouter() *reportRouter {
+	return &reportRouter{subs: make(map[int]map[int]StatusReportHandler)}
+}
+
+func (r *reportRouter) subscribe(mr int, h StatusReportHandler) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.nextID
+	r.nextID++
+	hh := r.subs[mr]
+	if hh == nil {
+		hh = make(map[int]StatusReportHandler)
+		r.subs[mr] = hh
+	}
+	hh[id] = h
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.subs[mr], id)
+		if len(r.subs[mr]) == 0 {
+			delete(r.subs, mr)
+		}
+	}
+}
+
+func (r *reportRouter) route(sr StatusReport) {
+	r.mu.Lock()
+	hh := make([]StatusReportHandler, 0, len(r.subs[sr.MR]))
+	for _, h := range r.subs[sr.MR] {
+		hh = append(hh, h)
+	}
+	r.mu.Unlock()
+	for _, h := range hh {
+		h(sr)
+	}
+}
+
+// SubscribeStatusReport registers a handler for the status reports of the
+// TPDU sent with the mr returned by SendPDU or SendShortMessage, or one of
+// those returned by SendLongMessage.
+//
+// The handler is called for each report with the corresponding TP-MR,
+// including interim reports, such as DeliveryPending, until the returned
+// function is called to cancel the subscription.  As the TP-MR cycles through
+// 256 values, the subscription should be cancelled once a final report is
+// received, or after a period beyond which the report is of no interest.
+//
+// As the report may be returned quickly, the subscription may be registered
+// before the send, using the mr passed to the handler provided by
+// WithMRHandler, so the report cannot be missed.
+//
+// Reports are only received while StartMessageRx is active with
+// WithStatusReports applied.
+//
+// Returns ErrInvalidMR if the mr is not a valid TP-MR.
+func (g *GSM) SubscribeStatusReport(mr string, h StatusReportHandler) (func(), error) {
+	n, err := strconv.Atoi(strings.TrimSpace(strings.Split(mr, ",")[0]))
+	if err != nil || n < 0 || n > 0xff {
+		return nil, ErrInvalidMR
+	}
+	return g.reports.subscribe(n, h), nil
+}
@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestWithStatusReportRequest(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGS=6\r":                       {"\n>"},
+		"00210203040506" + string(rune(26)): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet, gsm.WithPDUMode)
+	defer teardownModem(mm)
+
+	tp := []byte{1, 2, 3, 4, 5, 6}
+	mr, err := g.SendPDU(tp, gsm.WithStatusReportRequest())
+	assert.Nil(t, err)
+	assert.Equal(t, "42", mr)
+	// caller's TPDU is unaltered
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6}, tp)
+}
+
+func TestWithStatusReports(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,1,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	_, err := g.SubscribeStatusReport("bogus", nil)
+	assert.Equal(t, gsm.ErrInvalidMR, err)
+	_, err = g.SubscribeStatusReport("256", nil)
+	assert.Equal(t, gsm.ErrInvalidMR, err)
+
+	subChan := make(chan gsm.StatusReport, 3)
+	cancel, err := g.SubscribeStatusReport("42", func(sr gsm.StatusReport) {
+		subChan <- sr
+	})
+	require.Nil(t, err)
+	otherChan := make(chan gsm.StatusReport, 3)
+	ocancel, err := g.SubscribeStatusReport("43", func(sr gsm.StatusReport) {
+		otherChan <- sr
+	})
+	require.Nil(t, err)
+	defer ocancel()
+
+	srChan := make(chan gsm.StatusReport, 3)
+	errChan := make(chan error, 3)
+	bus := gsm.NewEventBus()
+	evChan := make(chan gsm.Event, 3)
+	bus.Subscribe(func(e gsm.Event) { evChan <- e }, gsm.StatusReport{})
+	err = g.StartMessageRx(
+		func(gsm.Message) {},
+		func(err error) { errChan <- err },
+		gsm.WithStatusReports(func(sr gsm.StatusReport) { srChan <- sr }),
+		gsm.WithEventBus(bus))
+	require.Nil(t, err)
+	defer g.StopMessageRx()
+
+	scts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	expected := gsm.StatusReport{
+		MR:        42,
+		Recipient: "+1234",
+		SCTS:      scts,
+		DT:        scts.Add(time.Minute),
+		Status:    gsm.Delivered,
+	}
+	cds := "+CDS: 21\r\n00022a04912143021020304050000210203050500000\r\n"
+	mm.r <- []byte(cds)
+	select {
+	case sr := <-subChan:
+		assert.Equal(t, expected, sr)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("no report for subscriber")
+	}
+	select {
+	case sr := <-srChan:
+		assert.Equal(t, expected, sr)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("no report for handler")
+	}
+	select {
+	case e := <-evChan:
+		assert.Equal(t, expected, e)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("no report published")
+	}
+
+	// cancelled
+	cancel()
+	mm.r <- []byte(cds)
+	select {
+	case sr := <-srChan:
+		assert.Equal(t, expected, sr)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("no report for handler")
+	}
+	select {
+	case sr := <-subChan:
+		t.Errorf("report for cancelled subscriber: %v", sr)
+	default:
+	}
+	select {
+	case sr := <-otherChan:
+		t.Errorf("report for other subscriber: %v", sr)
+	default:
+	}
+
+	// malformed
+	mm.r <- []byte("+CDS: 21\r\n00022a0491214302\r\n")
+	select {
+	case err := <-errChan:
+		assert.IsType(t, gsm.ErrUnmarshal{}, err)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("no error for malformed report")
+	}
+}
+
+func TestWithStatusReportsInitialCommand(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=2,1,0,1,0\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	err := g.StartMessageRx(
+		func(gsm.Message) {},
+		func(error) {},
+		gsm.WithInitialCommand("+CNMI=2,1,0,0,0"),
+		gsm.WithStatusReports(nil))
+	require.Nil(t, err)
+	g.StopMessageRx()
+
+	err = g.StartMessageRx(
+		func(gsm.Message) {},
+		func(error) {},
+		gsm.WithInitialCommand("+CNMI=2,1,0,2,0"))
+	assert.Equal(t, at.ErrError, err)
+}
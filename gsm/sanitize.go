@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrUnsafeInput indicates input to a send was rejected as it could alter the
+// AT command it is embedded in, such as a number containing a quote or a
+// text mode message containing Ctrl-Z, so injecting commands into the modem.
+type ErrUnsafeInput struct {
+	// Field identifies the input, "number" or "message".
+	Field string
+
+	// Value is the rejected input.
+	Value string
+
+	// Reason describes why the input was rejected.
+	Reason string
+}
+
+func (e ErrUnsafeInput) Error() string {
+	return fmt.Sprintf("unsafe %s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+// checkNumber checks the number is a plausible destination, being an
+// optional leading + followed by digits, * and #.
+func checkNumber(number string) error {
+	digits := strings.TrimPrefix(number, "+")
+	if digits == "" {
+		return ErrUnsafeInput{"number", number, "empty"}
+	}
+	for _, r := range digits {
+		if (r < '0' || r > '9') && r != '*' && r != '#' {
+			return ErrUnsafeInput{"number", number, fmt.Sprintf("invalid character %q", r)}
+		}
+	}
+	return nil
+}
+
+// sanitizeText prepares a message to be sent in text mode, where the message
+// is written to the modem as is.
+//
+// Ctrl-Z would terminate the message early, and ESC cancel it, after which
+// the remainder of the message would be interpreted as commands, so messages
+// containing either are rejected.  A CR would end the line and prompt for the
+// next, so line breaks are normalised to LF.
+func sanitizeText(message string) (string, error) {
+	if i := strings.IndexAny(message, "\x1a\x1b"); i >= 0 {
+		return "", ErrUnsafeInput{"message", message, fmt.Sprintf("invalid character %q", message[i])}
+	}
+	message = strings.Replace(message, "\r\n", "\n", -1)
+	return strings.Replace(message, "\r", "\n", -1), nil
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestSendUnsafeInput(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGS=\"+123456789\"\r":              {"\n>"},
+		"line one\nline two" + string(rune(26)): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
+	}
+	patterns := []struct {
+		name    string
+		number  string
+		message string
+		err     error
+		mr      string
+	}{
+		{
+			"ok",
+			"+123456789",
+			"line one\r\nline two",
+			nil,
+			"42",
+		},
+		{
+			"cr",
+			"+123456789",
+			"line one\rline two",
+			nil,
+			"42",
+		},
+		{
+			"quote",
+			"+1234\";+CFUN=0;\"",
+			"test message",
+			gsm.ErrUnsafeInput{
+				Field:  "number",
+				Value:  "+1234\";+CFUN=0;\"",
+				Reason: "invalid character '\"'",
+			},
+			"",
+		},
+		{
+			"empty number",
+			"+",
+			"test message",
+			gsm.ErrUnsafeInput{Field: "number", Value: "+", Reason: "empty"},
+			"",
+		},
+		{
+			"ctrl-z",
+			"+123456789",
+			"test\x1a\r\nAT+CFUN=0\r\n",
+			gsm.ErrUnsafeInput{
+				Field:  "message",
+				Value:  "test\x1a\r\nAT+CFUN=0\r\n",
+				Reason: "invalid character '\\x1a'",
+			},
+			"",
+		},
+		{
+			"escape",
+			"+123456789",
+			"test\x1b",
+			gsm.ErrUnsafeInput{
+				Field:  "message",
+				Value:  "test\x1b",
+				Reason: "invalid character '\\x1b'",
+			},
+			"",
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, cmdSet, gsm.WithTextMode)
+			defer teardownModem(mm)
+			mr, err := g.SendShortMessage(p.number, p.message)
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.mr, mr)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestSendLongMessageUnsafeNumber(t *testing.T) {
+	g, mm := setupModem(t, nil)
+	defer teardownModem(mm)
+	mrs, err := g.SendLongMessage("+1234\r\nAT+CFUN=0", "test message")
+	assert.Equal(t, gsm.ErrUnsafeInput{
+		Field:  "number",
+		Value:  "+1234\r\nAT+CFUN=0",
+		Reason: "invalid character '\\r'",
+	}, err)
+	assert.Nil(t, mrs)
+}
+
+func TestErrUnsafeInput(t *testing.T) {
+	err := gsm.ErrUnsafeInput{Field: "number", Value: "+12\"", Reason: "invalid character '\"'"}
+	assert.Equal(t, "unsafe number \"+12\\\"\": invalid character '\"'", err.Error())
+}
@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// OperatorStatus is the availability of an operator, as reported by +COPS.
+type OperatorStatus int
+
+const (
+	// OperatorUnknown indicates the availability of the operator is unknown.
+	OperatorUnknown OperatorStatus = iota
+
+	// OperatorAvailable indicates the operator is available.
+	OperatorAvailable
+
+	// OperatorCurrent indicates the modem is registered to the operator.
+	OperatorCurrent
+
+	// OperatorForbidden indicates the operator is forbidden.
+	OperatorForbidden
+)
+
+// Operator is a network operator found by an operator scan.
+type Operator struct {
+	// Status is the availability of the operator.
+	Status OperatorStatus
+
+	// LongName is the long alphanumeric name of the operator.
+	LongName string
+
+	// ShortName is the short alphanumeric name of the operator.
+	ShortName string
+
+	// Numeric is the MCC and MNC of the operator, e.g. "50501".
+	Numeric string
+
+	// AcT is the access technology of the operator, as per +COPS, e.g. 0
+	// for GSM, 2 for UTRAN or 7 for E-UTRAN, or -1 if not reported.
+	AcT int
+}
+
+// ScanResult is the outcome of an operator scan by ScanTask.
+type ScanResult struct {
+	// Time is the time the scan completed.
+	Time time.Time
+
+	// Duration is the time taken by the scan.
+	Duration time.Duration
+
+	// Operators are the operators found.
+	Operators []Operator
+}
+
+// ScanHandler receives the results of operator scans.
+type ScanHandler func(ScanResult)
+
+// the time allowed for an operator scan, as the modem searches all the bands
+// it supports.
+var scanTimeout = 3 * time.Minute
+
+// ScanOperators scans for the network operators available to the modem,
+// using +COPS=?.
+//
+// The scan can take minutes, during which the modem cannot perform other
+// commands, so it is run as a LongOperation and allowed 3 minutes unless
+// overridden by an at.WithTimeout option.  The modem may lose service during
+// the scan.
+func (g *GSM) ScanOperators(options ...at.CommandOption) ([]Operator, error) {
+	options = append([]at.CommandOption{at.WithTimeout(scanTimeout)}, options...)
+	var ops []Operator
+	err := g.LongOperation(func() error {
+		i, err := g.Command("+COPS=?", options...)
+		if err != nil {
+			return err
+		}
+		for _, l := range i {
+			if info.HasPrefix(l, "+COPS") {
+				ops, err = parseOperators(info.TrimPrefix(l, "+COPS"))
+				return err
+			}
+		}
+		return ErrMalformedResponse
+	})
+	return ops, err
+}
+
+// parseOperators parses the operators from a +COPS=? response, which is of
+// the form:
+//
+//	(<stat>,<long>,<short>,<numeric>[,<AcT>]),...,,(<modes>),(<formats>)
+//
+// The lists of supported modes and formats, following the empty field, are
+// ignored.
+func parseOperators(line string) ([]Operator, error) {
+	var ops []Operator
+	quoted := false
+	start := -1
+	for n, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			start = n + 1
+		case c == ')' && start >= 0:
+			op, err := parseOperator(line[start:n])
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, op)
+			start = -1
+		case c == ',' && start < 0 && strings.HasPrefix(line[n+1:], ","):
+			return ops, nil
+		}
+	}
+	return ops, nil
+}
+
+func parseOperator(group string) (Operator, error) {
+	fields := info.Fields(group)
+	if len(fields) < 4 {
+		return Operator{}, ErrMalformedResponse
+	}
+	stat, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return Operator{}, ErrMalformedResponse
+	}
+	op := Operator{
+		Status:    OperatorStatus(stat),
+		LongName:  fields[1],
+		ShortName: fields[2],
+		Numeric:   fields[3],
+		AcT:       -1,
+	}
+	if len(fields) > 4 && fields[4] != "" {
+		if op.AcT, err = strconv.Atoi(fields[4]); err != nil {
+			return Operator{}, ErrMalformedResponse
+		}
+	}
+	return op, nil
+}
+
+// ScanTask returns a task that scans for network operators and passes the
+// result to the handler, such as for surveying the signal environment.
+//
+// As the modem is unavailable for the duration of the scan, and may lose
+// service, blackouts can be provided to prevent scans during periods when
+// that is unacceptable, such as business hours, or while messages are queued
+// for sending.  Scans are never started while SMS sends are pending.
+func ScanTask(interval time.Duration, h ScanHandler, blackouts ...Blackout) HousekeepingTask {
+	return HousekeepingTask{
+		Name:     "operator scan",
+		Interval: interval,
+		Action: func(g *GSM) error {
+			start := time.Now()
+			ops, err := g.ScanOperators()
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			h(ScanResult{Time: now, Duration: now.Sub(start), Operators: ops})
+			return nil
+		},
+		Blackouts: blackouts,
+	}
+}
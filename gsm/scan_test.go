@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestScanOperators(t *testing.T) {
+	patterns := []struct {
+		name   string
+		cmdSet map[string][]string
+		ops    []gsm.Operator
+		err    error
+	}{
+		{
+			"operators",
+			map[string][]string{
+				"AT+COPS=?\r\n": {
+					"+COPS: (2,\"Telstra\",\"Telstra\",\"50501\",7),(1,\"Optus (AU)\",\"Optus\",\"50502\",2),(3,\"vodafone AU\",\"voda AU\",\"50503\"),,(0,1,2,3,4),(0,1,2)\r\n",
+					"\r\nOK\r\n",
+				},
+			},
+			[]gsm.Operator{
+				{gsm.OperatorCurrent, "Telstra", "Telstra", "50501", 7},
+				{gsm.OperatorAvailable, "Optus (AU)", "Optus", "50502", 2},
+				{gsm.OperatorForbidden, "vodafone AU", "voda AU", "50503", -1},
+			},
+			nil,
+		},
+		{
+			"none",
+			map[string][]string{
+				"AT+COPS=?\r\n": {"+COPS: ,,(0,1,2,3,4),(0,1,2)\r\n", "\r\nOK\r\n"},
+			},
+			nil,
+			nil,
+		},
+		{
+			"malformed",
+			map[string][]string{
+				"AT+COPS=?\r\n": {"+COPS: (2,\"Telstra\"),,(0,1,2,3,4),(0,1,2)\r\n", "\r\nOK\r\n"},
+			},
+			nil,
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"missing",
+			map[string][]string{
+				"AT+COPS=?\r\n": {"\r\nOK\r\n"},
+			},
+			nil,
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"error",
+			nil,
+			nil,
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			g, mm := setupModem(t, p.cmdSet)
+			defer teardownModem(mm)
+
+			ops, err := g.ScanOperators()
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.ops, ops)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestScanTask(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+COPS=?\r\n": {"+COPS: (2,\"Telstra\",\"Telstra\",\"50501\",7),,(0,1,2,3,4),(0,1,2)\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	var results []gsm.ScanResult
+	sh := func(r gsm.ScanResult) {
+		results = append(results, r)
+	}
+	blackout := true
+	task := gsm.ScanTask(time.Hour, sh, gsm.BlackoutFunc(func(time.Time) bool {
+		return blackout
+	}))
+	assert.Equal(t, "operator scan", task.Name)
+	h := g.NewHousekeeper(
+		gsm.WithIdlePeriod(10*time.Millisecond),
+		gsm.WithHousekeepingTasks(task))
+	time.Sleep(15 * time.Millisecond)
+	assert.False(t, h.RunOnce())
+	assert.Empty(t, results)
+
+	blackout = false
+	assert.True(t, h.RunOnce())
+	require.Len(t, results, 1)
+	assert.False(t, results[0].Time.IsZero())
+	assert.Equal(t, []gsm.Operator{{gsm.OperatorCurrent, "Telstra", "Telstra", "50501", 7}}, results[0].Operators)
+
+	// scan failure
+	err := task.Action(g)
+	assert.Nil(t, err)
+	delete(cmdSet, "AT+COPS=?\r\n")
+	err = task.Action(g)
+	assert.Equal(t, at.ErrError, err)
+	assert.Len(t, results, 2)
+}
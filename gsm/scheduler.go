@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"sync"
+)
+
+// scheduler arbitrates access to the single command channel between latency
+// sensitive operations, such as sending SMSs, and long running operations,
+// such as full storage listings.
+//
+// Long running operations are deferred until no sends are pending, so that
+// sends are not queued behind them.  Once started, a long running operation
+// cannot be preempted, so sends issued during it must still wait for it to
+// complete.
+type scheduler struct {
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+}
+
+func newScheduler() *scheduler {
+	s := scheduler{}
+	s.idle = sync.NewCond(&s.mu)
+	return &s
+}
+
+// urgent marks the start of a latency sensitive operation, and returns the
+// function to call when it completes.
+//
+// Sends are only marked once they are ready to be sent, so sends held by the
+// send gate while waiting for network service do not defer long running
+// operations indefinitely.
+func (s *scheduler) urgent() func() {
+	s.mu.Lock()
+	s.pending++
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		s.pending--
+		if s.pending == 0 {
+			s.idle.Broadcast()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// busy returns true if any latency sensitive operations are pending.
+func (s *scheduler) busy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending > 0
+}
+
+// deferred runs the long running operation once no latency sensitive
+// operations are pending.
+func (s *scheduler) deferred(f func() error) error {
+	s.mu.Lock()
+	for s.pending > 0 {
+		s.idle.Wait()
+	}
+	s.mu.Unlock()
+	return f()
+}
+
+// LongOperation runs a long running operation, such as an operator scan or a
+// firmware update, once no SMS sends are pending.
+//
+// This prevents the latency of sending SMSs blowing out while they are queued
+// behind maintenance work.  Sends issued while the operation is running must
+// still wait for it to complete.
+//
+// ListPDUs is automatically deferred in this manner.
+func (g *GSM) LongOperation(f func() error) error {
+	return g.sched.deferred(f)
+}
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestLongOperation(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGS=23\r": {"\n>"},
+		"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c" + string(rune(26)): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	// idle
+	err := g.LongOperation(func() error {
+		return errors.New("ran")
+	})
+	assert.Equal(t, errors.New("ran"), err)
+
+	// deferred behind a send
+	mm.readDelay = 20 * time.Millisecond
+	events := make(chan string, 2)
+	go func() {
+		g.SendShortMessage("+123456789", "test message")
+		events <- "sent"
+	}()
+	time.Sleep(10 * time.Millisecond)
+	err = g.LongOperation(func() error {
+		events <- "long"
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "sent", <-events)
+	assert.Equal(t, "long", <-events)
+}
+
+func TestLongOperationGatedSend(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CREG?\r\n": {"+CREG: 0,2\r\n", "OK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet, gsm.WithSendGating(10, 200*time.Millisecond))
+	defer teardownModem(mm)
+
+	// not deferred behind a send held waiting for service
+	events := make(chan string, 2)
+	go func() {
+		_, err := g.SendShortMessage("+123456789", "test message")
+		assert.Equal(t, gsm.ErrNoService, err)
+		events <- "sent"
+	}()
+	time.Sleep(20 * time.Millisecond)
+	err := g.LongOperation(func() error {
+		events <- "long"
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "long", <-events)
+	assert.Equal(t, "sent", <-events)
+}
@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"context"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// sendOption is an option specific to the send methods.
+//
+// It satisfies at.CommandOption, by embedding an at.LayerOption, so it can be
+// passed with the command options, but it is removed before those reach the
+// AT driver.  Passed to any other method it is rejected by the driver.
+type sendOption interface {
+	at.CommandOption
+	applySendOption(*sendConfig)
+}
+
+type sendConfig struct {
+	eOpts []sms.EncoderOption
+	ph    SendProgressHandler
+	ctx   context.Context
+	mrh   MRHandler
+
+	// whether the TP-SRR is set in sent TPDUs.
+	srr bool
+
+	// whether options that only apply to PDU mode, as the modem encodes text
+	// mode messages itself, were provided.
+	pduOnly bool
+
+	// timeout is the overall time allowed for the send, and cancel releases
+	// the context enforcing it.
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+// sendConfig separates the send options from the command options passed to a
+// send.
+//
+// The cancel of the returned config must be called once the send is complete.
+func (g *GSM) sendConfig(number string, options []at.CommandOption) (sendConfig, []at.CommandOption) {
+	cfg := sendConfig{
+		eOpts:  append([]sms.EncoderOption(nil), g.eOpts...),
+		cancel: func() {},
+	}
+	cOpts := []at.CommandOption(nil)
+	for _, o := range options {
+		if so, ok := o.(sendOption); ok {
+			so.applySendOption(&cfg)
+		} else {
+			cOpts = append(cOpts, o)
+		}
+	}
+	cfg.eOpts = append(cfg.eOpts, sms.To(number))
+	if cfg.timeout > 0 {
+		ctx := cfg.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		cfg.ctx, cfg.cancel = context.WithTimeout(ctx, cfg.timeout)
+	}
+	return cfg, cOpts
+}
+
+// encode converts the message into SMS-SUBMIT TPDUs, with the TP-MR and
+// concatenation reference drawn from the GSM reference cycles.
+func (g *GSM) encode(message string, cfg sendConfig) ([]tpdu.TPDU, error) {
+	e := sms.NewEncoder(append([]sms.EncoderOption{sms.AsSubmit}, cfg.eOpts...)...)
+	e.MsgCount = g.mr
+	e.ConcatRef = g.concatRef
+	return e.Encode([]byte(g.text(message)))
+}
+
+type encoderOptionOnce struct {
+	at.LayerOption
+	eo sms.EncoderOption
+}
+
+func (o encoderOptionOnce) applySendOption(c *sendConfig) {
+	c.eOpts = append(c.eOpts, o.eo)
+	c.pduOnly = true
+}
+
+// WithEncoderOptionOnce applies the encoder option when converting the text
+// message to SMS TPDUs for a single send, in addition to any encoder options
+// provided to New.
+//
+// This allows, for example, forcing UCS-2 for a particular message.
+//
+// It requires PDU mode, so SendShortMessage returns ErrWrongMode in text mode.
+func WithEncoderOptionOnce(eo sms.EncoderOption) at.CommandOption {
+	return encoderOptionOnce{"gsm.WithEncoderOptionOnce", eo}
+}
+
+// SendProgressHandler receives notification of each part of a long message
+// being sent, along with the mr returned by the modem for that part.
+//
+// Parts are numbered from 1.
+type SendProgressHandler func(part, parts int, mr string)
+
+type sendProgressOption struct {
+	at.LayerOption
+	ph SendProgressHandler
+}
+
+func (o sendProgressOption) applySendOption(c *sendConfig) {
+	c.ph = o.ph
+}
+
+// WithSendProgress specifies a handler to be called as each part of a long
+// message is sent.
+func WithSendProgress(ph SendProgressHandler) at.CommandOption {
+	return sendProgressOption{"gsm.WithSendProgress", ph}
+}
+
+type contextOption struct {
+	at.LayerOption
+	ctx context.Context
+}
+
+func (o contextOption) applySendOption(c *sendConfig) {
+	c.ctx = o.ctx
+}
+
+// WithContext specifies a context that can cancel sending a long message.
+//
+// The context is checked before each part is sent, so cancellation aborts
+// the remaining parts, but does not interrupt a part already being sent.
+func WithContext(ctx context.Context) at.CommandOption {
+	return contextOption{"gsm.WithContext", ctx}
+}
+
+type sendTimeoutOption struct {
+	at.LayerOption
+	d time.Duration
+}
+
+func (o sendTimeoutOption) applySendOption(c *sendConfig) {
+	c.timeout = o.d
+}
+
+// WithSendTimeout specifies the maximum time allowed to send a message,
+// including waiting for network service, waiting for other sends to complete,
+// and sending all the parts of a long message.
+//
+// This is distinct from at.WithTimeout, which limits the time allowed for
+// each AT command, and so each part of a long message.  A long message may
+// take several command timeouts to send, so the overall send timeout should
+// allow for the number of parts.
+//
+// As with WithContext, the deadline is checked before each part is sent, so a
+// part already being sent when the deadline expires is limited only by its
+// command timeout.  The send fails with context.DeadlineExceeded.
+func WithSendTimeout(d time.Duration) at.CommandOption {
+	return sendTimeoutOption{"gsm.WithSendTimeout", d}
+}
+
+// MRHandler receives the TP-MR assigned to a TPDU immediately before the TPDU
+// is sent, so delivery reports can be correlated even if the send itself is
+// interrupted.
+type MRHandler func(mr int)
+
+type mrOption struct {
+	at.LayerOption
+	mrh MRHandler
+}
+
+func (o mrOption) applySendOption(c *sendConfig) {
+	c.mrh = o.mrh
+	c.pduOnly = true
+}
+
+// WithMRHandler specifies a handler to be passed the TP-MR of each TPDU before
+// it is sent.
+//
+// The TP-MR is drawn from a cycle shared by all sends and resynchronised with
+// the mr returned by the modem, though a modem that assigns its own TP-MR may
+// still override it.
+//
+// It requires PDU mode, so SendShortMessage returns ErrWrongMode in text mode.
+func WithMRHandler(mrh MRHandler) at.CommandOption {
+	return mrOption{"gsm.WithMRHandler", mrh}
+}
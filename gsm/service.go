@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// MessageService describes the message service selected on the modem, as per
+// +CSMS.
+type MessageService struct {
+	// Service is the selected message service.
+	//
+	// 0 is GSM 03.40/03.41 Phase 2, where the modem acknowledges received
+	// messages itself, and 1 is Phase 2+, where received messages must be
+	// acknowledged using +CNMA.
+	Service int
+
+	// MT indicates support for mobile terminated messages.
+	MT bool
+
+	// MO indicates support for mobile originated messages.
+	MO bool
+
+	// BM indicates support for broadcast messages.
+	BM bool
+}
+
+// SelectMessageService selects the message service, as per +CSMS, and returns
+// the message types supported by the service.
+func (g *GSM) SelectMessageService(service int, options ...at.CommandOption) (ms MessageService, err error) {
+	var i []string
+	i, err = g.Command(fmt.Sprintf("+CSMS=%d", service), options...)
+	if err != nil {
+		return
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CSMS") {
+			continue
+		}
+		ms.Service = service
+		ms.MT, ms.MO, ms.BM, err = parseServiceSupport(info.Fields(info.TrimPrefix(l, "+CSMS")))
+		return
+	}
+	err = ErrMalformedResponse
+	return
+}
+
+// MessageService returns the message service currently selected on the modem,
+// as per +CSMS?.
+func (g *GSM) MessageService(options ...at.CommandOption) (ms MessageService, err error) {
+	var i []string
+	i, err = g.Command("+CSMS?", options...)
+	if err != nil {
+		return
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CSMS") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+CSMS"))
+		if len(fields) < 4 {
+			break
+		}
+		ms.Service, err = strconv.Atoi(fields[0])
+		if err != nil {
+			err = ErrMalformedResponse
+			return
+		}
+		ms.MT, ms.MO, ms.BM, err = parseServiceSupport(fields[1:])
+		return
+	}
+	err = ErrMalformedResponse
+	return
+}
+
+// parseServiceSupport parses the <mt>,<mo>,<bm> fields of a +CSMS response.
+func parseServiceSupport(fields []string) (mt, mo, bm bool, err error) {
+	if len(fields) < 3 {
+		err = ErrMalformedResponse
+		return
+	}
+	flags := make([]bool, 3)
+	for i := range flags {
+		var v int
+		v, err = strconv.Atoi(fields[i])
+		if err != nil {
+			err = ErrMalformedResponse
+			return
+		}
+		flags[i] = v != 0
+	}
+	return flags[0], flags[1], flags[2], nil
+}
+
+// ackRequired determines if received messages must be acknowledged using
+// +CNMA.
+//
+// Acknowledgement is only required for the Phase 2+ service.  If the modem
+// does not support +CNMA then the Phase 2 service is selected instead, so the
+// modem acknowledges messages itself.
+//
+// If the service cannot be determined, or the fallback to Phase 2 fails, then
+// acknowledgement is assumed to be required.
+func (g *GSM) ackRequired() bool {
+	ms, err := g.MessageService()
+	if err != nil {
+		return true
+	}
+	if ms.Service == 0 {
+		return false
+	}
+	if _, err = g.Command("+CNMA=?"); err == nil {
+		return true
+	}
+	// no point acknowledging if the modem doesn't support it, so fallback to
+	// Phase 2, if possible.
+	if _, err = g.SelectMessageService(0); err != nil {
+		// still Phase 2+, so the network expects acknowledgements.
+		return true
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestSelectMessageService(t *testing.T) {
+	patterns := []struct {
+		name    string
+		service int
+		rsp     []string
+		ms      gsm.MessageService
+		err     error
+	}{
+		{
+			"phase 2+",
+			1,
+			[]string{"+CSMS: 1,1,1\r\n", "OK\r\n"},
+			gsm.MessageService{Service: 1, MT: true, MO: true, BM: true},
+			nil,
+		},
+		{
+			"phase 2",
+			0,
+			[]string{"+CSMS: 1,1,0\r\n", "OK\r\n"},
+			gsm.MessageService{Service: 0, MT: true, MO: true},
+			nil,
+		},
+		{
+			"missing",
+			1,
+			[]string{"OK\r\n"},
+			gsm.MessageService{},
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"malformed",
+			1,
+			[]string{"+CSMS: 1,x,1\r\n", "OK\r\n"},
+			gsm.MessageService{Service: 1},
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"error",
+			1,
+			nil,
+			gsm.MessageService{},
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{}
+			if p.rsp != nil {
+				cmdSet["AT+CSMS=0\r\n"] = p.rsp
+				cmdSet["AT+CSMS=1\r\n"] = p.rsp
+			}
+			g, mm := setupModem(t, cmdSet)
+			defer teardownModem(mm)
+			ms, err := g.SelectMessageService(p.service)
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.ms, ms)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestMessageService(t *testing.T) {
+	patterns := []struct {
+		name string
+		rsp  []string
+		ms   gsm.MessageService
+		err  error
+	}{
+		{
+			"phase 2+",
+			[]string{"+CSMS: 1,1,1,1\r\n", "OK\r\n"},
+			gsm.MessageService{Service: 1, MT: true, MO: true, BM: true},
+			nil,
+		},
+		{
+			"short",
+			[]string{"+CSMS: 1,1,1\r\n", "OK\r\n"},
+			gsm.MessageService{},
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"bad service",
+			[]string{"+CSMS: x,1,1,1\r\n", "OK\r\n"},
+			gsm.MessageService{},
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"error",
+			nil,
+			gsm.MessageService{},
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{}
+			if p.rsp != nil {
+				cmdSet["AT+CSMS?\r\n"] = p.rsp
+			}
+			g, mm := setupModem(t, cmdSet)
+			defer teardownModem(mm)
+			ms, err := g.MessageService()
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.ms, ms)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestStartMessageRxAck(t *testing.T) {
+	cmt := "+CMT: ,24\r\n00040B911234567890F000000250100173832305C8329BFD06\r\n"
+	patterns := []struct {
+		name   string
+		cmdSet map[string][]string
+		ack    bool
+		csms0  bool
+	}{
+		{
+			"unknown service",
+			map[string][]string{},
+			true,
+			false,
+		},
+		{
+			"phase 2",
+			map[string][]string{
+				"AT+CSMS?\r\n": {"+CSMS: 0,1,1,1\r\n", "OK\r\n"},
+			},
+			false,
+			false,
+		},
+		{
+			"phase 2+",
+			map[string][]string{
+				"AT+CSMS?\r\n":  {"+CSMS: 1,1,1,1\r\n", "OK\r\n"},
+				"AT+CNMA=?\r\n": {"OK\r\n"},
+			},
+			true,
+			false,
+		},
+		{
+			"phase 2+ without CNMA",
+			map[string][]string{
+				"AT+CSMS?\r\n":  {"+CSMS: 1,1,1,1\r\n", "OK\r\n"},
+				"AT+CSMS=0\r\n": {"+CSMS: 1,1,1\r\n", "OK\r\n"},
+			},
+			false,
+			true,
+		},
+		{
+			"phase 2+ without CNMA or phase 2",
+			map[string][]string{
+				"AT+CSMS?\r\n": {"+CSMS: 1,1,1,1\r\n", "OK\r\n"},
+			},
+			true,
+			true,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			p.cmdSet["AT+CNMI=1,2,0,0,0\r\n"] = []string{"OK\r\n"}
+			p.cmdSet["AT+CNMA\r\n"] = []string{"OK\r\n"}
+			g, mm := setupModem(t, p.cmdSet)
+			defer teardownModem(mm)
+			msgChan := make(chan gsm.Message, 1)
+			mh := func(msg gsm.Message) {
+				msgChan <- msg
+			}
+			eh := func(err error) {
+				t.Errorf("error received: %v", err)
+			}
+			err := g.StartMessageRx(mh, eh)
+			require.Nil(t, err)
+			mm.r <- []byte(cmt)
+			select {
+			case <-msgChan:
+			case <-time.After(100 * time.Millisecond):
+				t.Errorf("no notification received")
+			}
+			assert.Equal(t, p.ack, contains(mm.written(), "AT+CNMA\r\n"))
+			assert.Equal(t, p.csms0, contains(mm.written(), "AT+CSMS=0\r\n"))
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
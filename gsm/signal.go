@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// SignalChanged is published to the EventBus provided to New when the signal
+// quality reported by the modem changes.
+type SignalChanged struct {
+	// Time is the time the change was detected, being the time the
+	// indication was read from the modem, or the poll completed.
+	Time time.Time
+
+	// RSSI is the received signal strength, on the +CSQ scale, from 0
+	// (-113dBm or less) to 31 (-51dBm or greater), or 99 if unknown.
+	RSSI int
+
+	// BER is the bit error rate, on the +CSQ scale, or 99 if unknown.
+	BER int
+
+	// Source identifies the indication or command that reported the change,
+	// i.e. "+QIND", "^RSSI" or "+CSQ".
+	Source string
+}
+
+// SignalHandler receives changes in signal quality.
+type SignalHandler func(SignalChanged)
+
+// SignalOption is an option for StartSignalRx.
+type SignalOption interface {
+	applySignalOption(*signalConfig)
+}
+
+type signalConfig struct {
+	period time.Duration
+}
+
+type signalPollPeriodOption time.Duration
+
+func (o signalPollPeriodOption) applySignalOption(c *signalConfig) {
+	c.period = time.Duration(o)
+}
+
+// WithSignalPollPeriod specifies the period between polls of +CSQ for modems
+// that do not support signal quality indications.
+//
+// The default is 30 seconds.
+func WithSignalPollPeriod(d time.Duration) SignalOption {
+	return signalPollPeriodOption(d)
+}
+
+// signalWatch tracks the signal quality reported to the handler, so only
+// changes are reported.
+type signalWatch struct {
+	g      *GSM
+	h      SignalHandler
+	prefix string
+	done   chan struct{}
+
+	mu   sync.Mutex
+	rssi int
+	ber  int
+}
+
+const (
+	qindCSQPrefix = `+QIND: "csq"`
+	rssiPrefix    = "^RSSI:"
+)
+
+// StartSignalRx passes changes in the signal quality to the handler, and
+// publishes them to the bus provided to New as SignalChanged.
+//
+// Vendor indications are used where the modem supports them, being +QIND
+// "csq" indications on Quectel modems and ^RSSI indications on Huawei modems,
+// as they report changes as they happen without the overhead of polling.
+// Other modems are polled using +CSQ.
+//
+// The current signal quality is reported immediately, if available.
+//
+// The handler may be nil if the changes are only required on the bus.
+func (g *GSM) StartSignalRx(h SignalHandler, options ...SignalOption) error {
+	cfg := signalConfig{period: 30 * time.Second}
+	for _, option := range options {
+		option.applySignalOption(&cfg)
+	}
+	w := &signalWatch{g: g, h: h, done: make(chan struct{}), rssi: -1, ber: -1}
+	g.mu.Lock()
+	if g.signal != nil {
+		g.mu.Unlock()
+		return at.ErrIndicationExists
+	}
+	g.signal = w
+	g.mu.Unlock()
+
+	if rssi, ber, err := g.SignalQuality(); err == nil {
+		w.update(rssi, ber, "+CSQ", time.Now())
+	}
+	if w.startURC(qindCSQPrefix, w.qindHandler, `+QINDCFG="csq",1,0`) ||
+		w.startURC(rssiPrefix, w.rssiHandler, "^CURC=1") {
+		return nil
+	}
+	go w.poll(cfg.period)
+	return nil
+}
+
+// StopSignalRx ends the reporting of signal quality started by
+// StartSignalRx.
+func (g *GSM) StopSignalRx() {
+	g.mu.Lock()
+	w := g.signal
+	g.signal = nil
+	g.mu.Unlock()
+	if w == nil {
+		return
+	}
+	close(w.done)
+	switch w.prefix {
+	case qindCSQPrefix:
+		g.CancelIndication(w.prefix)
+		g.Command(`+QINDCFG="csq",0,0`)
+	case rssiPrefix:
+		g.CancelIndication(w.prefix)
+	}
+}
+
+// startURC attempts to enable the vendor indication, returning true if it is
+// supported.
+func (w *signalWatch) startURC(prefix string, handler at.StampedInfoHandler, cmd string) bool {
+	if w.g.AddStampedIndication(prefix, handler) != nil {
+		return false
+	}
+	if _, err := w.g.optionalCommand(cmd); err != nil {
+		w.g.CancelIndication(prefix)
+		return false
+	}
+	w.prefix = prefix
+	return true
+}
+
+// qindHandler handles Quectel indications of the form:
+//
+//	+QIND: "csq",<rssi>,<ber>
+func (w *signalWatch) qindHandler(i []string, t time.Time) {
+	fields := info.Fields(info.TrimPrefix(i[0], "+QIND"))
+	if len(fields) < 3 {
+		return
+	}
+	rssi, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return
+	}
+	ber, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return
+	}
+	w.update(rssi, ber, "+QIND", t)
+}
+
+// rssiHandler handles Huawei indications of the form:
+//
+//	^RSSI: <rssi>
+func (w *signalWatch) rssiHandler(i []string, t time.Time) {
+	rssi, err := strconv.Atoi(info.TrimPrefix(i[0], "^RSSI"))
+	if err != nil {
+		return
+	}
+	w.update(rssi, 99, "^RSSI", t)
+}
+
+// poll polls +CSQ until the watch is stopped or the modem closed.
+func (w *signalWatch) poll(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.g.Closed():
+			return
+		case <-ticker.C:
+			if rssi, ber, err := w.g.SignalQuality(); err == nil {
+				w.update(rssi, ber, "+CSQ", time.Now())
+			}
+		}
+	}
+}
+
+// update reports the signal quality, read from the modem at time t, if it
+// has changed.
+//
+// Indication handlers may run concurrently, so changes are reported with the
+// lock held to keep them in order.
+func (w *signalWatch) update(rssi, ber int, source string, t time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if rssi == w.rssi && ber == w.ber {
+		return
+	}
+	select {
+	case <-w.done:
+		return
+	default:
+	}
+	w.rssi = rssi
+	w.ber = ber
+	sc := SignalChanged{Time: t, RSSI: rssi, BER: ber, Source: source}
+	if w.h != nil {
+		w.h(sc)
+	}
+	if w.g.bus != nil {
+		w.g.bus.Publish(sc)
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestStartSignalRx(t *testing.T) {
+	type change struct {
+		rssi, ber int
+		source    string
+	}
+	patterns := []struct {
+		name    string
+		cmdSet  map[string][]string
+		urcs    []string
+		changes []change
+	}{
+		{
+			"quectel",
+			map[string][]string{
+				"AT+CSQ\r\n":                 {"+CSQ: 20,0\r\n", "OK\r\n"},
+				"AT+QINDCFG=\"csq\",1,0\r\n": {"OK\r\n"},
+			},
+			[]string{
+				"+QIND: \"csq\",21,0\r\n",
+				"+QIND: \"csq\",21,0\r\n",
+				"+QIND: \"csq\",18,99\r\n",
+				"+QIND: \"csq\",bad\r\n",
+			},
+			[]change{{20, 0, "+CSQ"}, {21, 0, "+QIND"}, {18, 99, "+QIND"}},
+		},
+		{
+			"huawei",
+			map[string][]string{
+				"AT+CSQ\r\n":                 {"+CSQ: 20,99\r\n", "OK\r\n"},
+				"AT+QINDCFG=\"csq\",1,0\r\n": {"+CME ERROR: 4\r\n"},
+				"AT^CURC=1\r\n":              {"OK\r\n"},
+			},
+			[]string{
+				"^RSSI: 20\r\n",
+				"^RSSI: 12\r\n",
+			},
+			[]change{{20, 99, "+CSQ"}, {12, 99, "^RSSI"}},
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			b := gsm.NewEventBus()
+			events := make(chan gsm.Event, 10)
+			b.Subscribe(func(e gsm.Event) {
+				events <- e
+			}, gsm.SignalChanged{})
+			g, mm := setupModem(t, p.cmdSet, gsm.WithEventBus(b))
+			defer teardownModem(mm)
+
+			changes := make(chan change, 10)
+			h := func(sc gsm.SignalChanged) {
+				assert.False(t, sc.Time.IsZero())
+				changes <- change{sc.RSSI, sc.BER, sc.Source}
+			}
+			err := g.StartSignalRx(h)
+			require.Nil(t, err)
+			err = g.StartSignalRx(h)
+			assert.Equal(t, at.ErrIndicationExists, err)
+			for _, urc := range p.urcs {
+				mm.r <- []byte(urc)
+				// allow each indication to be handled in order
+				time.Sleep(10 * time.Millisecond)
+			}
+			for _, c := range p.changes {
+				select {
+				case got := <-changes:
+					assert.Equal(t, c, got)
+				case <-time.After(100 * time.Millisecond):
+					t.Fatalf("missing change %v", c)
+				}
+				e := <-events
+				assert.Equal(t, c.rssi, e.(gsm.SignalChanged).RSSI)
+			}
+			select {
+			case got := <-changes:
+				t.Errorf("unexpected change %v", got)
+			default:
+			}
+			g.StopSignalRx()
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestStartSignalRxPolled(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CSQ\r\n": {"+CSQ: 20,0\r\n", "OK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	changes := make(chan gsm.SignalChanged, 10)
+	err := g.StartSignalRx(func(sc gsm.SignalChanged) {
+		changes <- sc
+	}, gsm.WithSignalPollPeriod(20*time.Millisecond))
+	require.Nil(t, err)
+	sc := <-changes
+	assert.Equal(t, 20, sc.RSSI)
+	assert.Equal(t, "+CSQ", sc.Source)
+
+	// only changes are reported
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, changes)
+
+	g.StopSignalRx()
+	g.StopSignalRx()
+	assert.Contains(t, mm.written(), "AT^CURC=1\r\n")
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/info"
+)
+
+type simReadyTimeoutOption time.Duration
+
+func (o simReadyTimeoutOption) applyOption(g *GSM) {
+	g.simReadyTimeout = time.Duration(o)
+}
+
+// WithSIMReadyTimeout specifies that Init should wait, for up to the given
+// period, for the SIM and SMS subsystem to become ready before configuring the
+// modem for SMS.
+//
+// Readiness is determined by polling +CPIN, and then either a vendor "SMS
+// Ready" or "+QIND: SMS DONE" indication, or a successful +CPMS query.
+//
+// Init returns ErrNotPINReady if the SIM is not ready within the period, or
+// if the SIM requires a PIN.
+//
+// By default Init does not wait.
+func WithSIMReadyTimeout(d time.Duration) Option {
+	return simReadyTimeoutOption(d)
+}
+
+// the period between polls of the SIM readiness.
+var simReadyPollPeriod = 250 * time.Millisecond
+
+// smsReadyIndications are the vendor indications that the SMS subsystem is
+// ready.
+var smsReadyIndications = []string{
+	"SMS Ready",
+	"+QIND: SMS DONE",
+}
+
+// waitSIMReady waits for the SIM and SMS subsystem to become ready.
+func (g *GSM) waitSIMReady() error {
+	smsReady := make(chan struct{})
+	var once sync.Once
+	h := func([]string) {
+		once.Do(func() { close(smsReady) })
+	}
+	for _, prefix := range smsReadyIndications {
+		// best effort - the prefix may already be claimed.
+		if g.AddIndication(prefix, h) == nil {
+			defer g.CancelIndication(prefix)
+		}
+	}
+	deadline := time.NewTimer(g.simReadyTimeout)
+	defer deadline.Stop()
+	// the indication wakes the poll once, as the closed channel would
+	// otherwise turn the poll into a busy loop.
+	wake := smsReady
+	for {
+		pinReady, err := g.pinReady()
+		if err == ErrNotPINReady {
+			return err
+		}
+		if pinReady {
+			select {
+			case <-smsReady:
+				return nil
+			default:
+			}
+			if _, err = g.Command("+CPMS?"); err == nil {
+				return nil
+			}
+		}
+		select {
+		case <-wake:
+			wake = nil
+		case <-deadline.C:
+			return ErrNotPINReady
+		case <-time.After(simReadyPollPeriod):
+		}
+	}
+}
+
+// pinReady returns true if +CPIN indicates the SIM is ready.
+//
+// Returns ErrNotPINReady if the SIM requires a PIN or PUK, as waiting will not
+// help.  Other errors, such as the SIM being busy, are returned as is.
+func (g *GSM) pinReady() (bool, error) {
+	i, err := g.Command("+CPIN?")
+	if err != nil {
+		return false, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CPIN") {
+			continue
+		}
+		if info.TrimPrefix(l, "+CPIN") == "READY" {
+			return true, nil
+		}
+		return false, ErrNotPINReady
+	}
+	return false, ErrMalformedResponse
+}
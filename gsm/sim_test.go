@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestWithSIMReadyTimeout(t *testing.T) {
+	initSet := map[string][]string{
+		string(rune(27)) + "\r\n\r\n": {"\r\n"},
+		"ATZ\r\n":                     {"OK\r\n"},
+		"ATE0\r\n":                    {"OK\r\n"},
+		"AT+CMEE=2\r\n":               {"OK\r\n"},
+		"AT+CMGF=0\r\n":               {"OK\r\n"},
+		"AT+GCAP\r\n":                 {"+GCAP: +CGSM,+DS,+ES\r\n", "OK\r\n"},
+	}
+	patterns := []struct {
+		name string
+		cpin []string
+		cpms []string
+		ind  string
+		err  error
+	}{
+		{
+			"ready",
+			[]string{"+CPIN: READY\r\n", "OK\r\n"},
+			[]string{"+CPMS: \"SM\",0,10,\"SM\",0,10,\"SM\",0,10\r\n", "OK\r\n"},
+			"",
+			nil,
+		},
+		{
+			"sms ready indication",
+			[]string{"+CPIN: READY\r\n", "OK\r\n"},
+			nil,
+			"SMS Ready\r\n",
+			nil,
+		},
+		{
+			"qind indication",
+			[]string{"+CPIN: READY\r\n", "OK\r\n"},
+			nil,
+			"+QIND: SMS DONE\r\n",
+			nil,
+		},
+		{
+			"sms not ready",
+			[]string{"+CPIN: READY\r\n", "OK\r\n"},
+			nil,
+			"",
+			gsm.ErrNotPINReady,
+		},
+		{
+			"sim busy",
+			[]string{"+CME ERROR: 14\r\n"},
+			nil,
+			"",
+			gsm.ErrNotPINReady,
+		},
+		{
+			"sms ready sim busy",
+			[]string{"+CME ERROR: 14\r\n"},
+			nil,
+			"SMS Ready\r\n",
+			gsm.ErrNotPINReady,
+		},
+		{
+			"pin required",
+			[]string{"+CPIN: SIM PIN\r\n", "OK\r\n"},
+			nil,
+			"",
+			gsm.ErrNotPINReady,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{
+				"AT+CPIN?\r\n": p.cpin,
+				"AT+CPMS?\r\n": p.cpms,
+			}
+			for k, v := range initSet {
+				cmdSet[k] = v
+			}
+			mm := mockModem{
+				cmdSet:    cmdSet,
+				r:         make(chan []byte, 10),
+				readDelay: time.Millisecond,
+			}
+			defer teardownModem(&mm)
+			g := gsm.New(at.New(&mm), gsm.WithSIMReadyTimeout(300*time.Millisecond))
+			require.NotNil(t, g)
+			if p.ind != "" {
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					mm.r <- []byte(p.ind)
+				}()
+			}
+			start := time.Now()
+			err := g.Init()
+			assert.Equal(t, p.err, err)
+			assert.True(t, time.Since(start) < time.Second)
+			// polled, not spun
+			polls := 0
+			for _, c := range mm.written() {
+				if c == "AT+CPIN?\r\n" {
+					polls++
+				}
+			}
+			assert.True(t, polls < 5, "polls %d", polls)
+		}
+		t.Run(p.name, f)
+	}
+}
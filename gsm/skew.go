@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"time"
+)
+
+// ClockSkew is published when the SCTS of a received message differs from the
+// host time by more than the threshold provided to WithClockSkewDetection.
+type ClockSkew struct {
+	// SCTS is the time the SMSC received the message, in the time zone
+	// encoded in the SCTS.
+	SCTS time.Time
+
+	// Received is the host time the message was received, as per
+	// Message.Received.
+	Received time.Time
+
+	// Skew is the host time less the SCTS, so is positive if the host clock
+	// is ahead of the SMSC, or the delivery of the message was delayed.
+	Skew time.Duration
+
+	// Sender is the originating address of the message.
+	Sender string
+}
+
+// ClockSkewHandler receives the clock skew detected in received messages.
+type ClockSkewHandler func(ClockSkew)
+
+type clockSkewOption struct {
+	threshold time.Duration
+	h         ClockSkewHandler
+}
+
+func (o clockSkewOption) applyRxOption(c *rxConfig) {
+	c.skew = &o
+}
+
+// WithClockSkewDetection compares the SCTS of received messages with the host
+// time, and passes any difference exceeding the threshold to the handler, in
+// addition to the message being passed to the message handler.
+//
+// This is intended to diagnose hosts with drifting clocks, such as those
+// without a battery backed RTC.  The SMSC may delay delivering a message,
+// such as while the modem is out of coverage, so a host time ahead of the
+// SCTS may be a delayed delivery rather than skew, and the threshold should
+// allow for that.  A host time behind the SCTS is always skew.
+//
+// If an EventBus is provided to StartMessageRx then the skew is also
+// published as ClockSkew.  The handler may be nil in that case.
+func WithClockSkewDetection(threshold time.Duration, h ClockSkewHandler) RxOption {
+	return clockSkewOption{threshold, h}
+}
+
+// extend extends the message handler to check the SCTS of the messages
+// against the host time.
+func (o *clockSkewOption) extend(mh MessageHandler, b *EventBus) MessageHandler {
+	return func(m Message) {
+		mh(m)
+		if m.SCTS.IsZero() {
+			return
+		}
+		now := m.Received
+		if now.IsZero() {
+			now = time.Now()
+		}
+		skew := now.Sub(m.SCTS.Time)
+		if skew <= o.threshold && skew >= -o.threshold {
+			return
+		}
+		cs := ClockSkew{
+			SCTS:     m.SCTS.Time,
+			Received: now,
+			Skew:     skew,
+			Sender:   m.Number,
+		}
+		if o.h != nil {
+			o.h(cs)
+		}
+		if b != nil {
+			b.Publish(cs)
+		}
+	}
+}
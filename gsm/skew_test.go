@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestWithClockSkewDetection(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		t.Errorf("error received: %v", err)
+	}
+	csChan := make(chan gsm.ClockSkew, 3)
+	csh := func(cs gsm.ClockSkew) {
+		csChan <- cs
+	}
+	bus := gsm.NewEventBus()
+	evChan := make(chan gsm.Event, 3)
+	bus.Subscribe(func(e gsm.Event) { evChan <- e }, gsm.ClockSkew{})
+	err := g.StartMessageRx(mh, eh,
+		gsm.WithClockSkewDetection(10*time.Minute, csh),
+		gsm.WithEventBus(bus))
+	require.Nil(t, err)
+
+	oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+	zone := time.FixedZone("", 10*60*60)
+
+	// in sync
+	scts := tpdu.Timestamp{Time: time.Now().In(zone).Truncate(time.Second)}
+	mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, SCTS: scts, UD: []byte("hello")}))
+	select {
+	case m := <-msgChan:
+		_, offset := m.SCTS.Zone()
+		assert.Equal(t, 10*60*60, offset)
+		assert.True(t, scts.Equal(m.SCTS.Time))
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	select {
+	case cs := <-csChan:
+		t.Errorf("unexpected skew: %v", cs)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// host behind
+	scts = tpdu.Timestamp{Time: time.Now().In(zone).Add(time.Hour).Truncate(time.Second)}
+	before := time.Now()
+	mm.r <- []byte(cmtIndication(t, tpdu.TPDU{OA: oa, SCTS: scts, UD: []byte("hello")}))
+	var received time.Time
+	select {
+	case m := <-msgChan:
+		received = m.Received
+		assert.False(t, received.Before(before), received)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	select {
+	case cs := <-csChan:
+		assert.Equal(t, "+1234", cs.Sender)
+		assert.Equal(t, received, cs.Received)
+		assert.True(t, scts.Equal(cs.SCTS))
+		assert.True(t, cs.Skew < -59*time.Minute, cs.Skew)
+		assert.True(t, cs.Skew > -61*time.Minute, cs.Skew)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no skew received")
+	}
+	select {
+	case e := <-evChan:
+		require.IsType(t, gsm.ClockSkew{}, e)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no skew event published")
+	}
+}
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// SSProcedure is the procedure requested by an MMI string, as per 3GPP TS
+// 22.030.
+type SSProcedure int
+
+const (
+	// Activate is requested by a *SC# string.
+	Activate SSProcedure = iota
+
+	// Deactivate is requested by a #SC# string.
+	Deactivate
+
+	// Interrogate is requested by a *#SC# string.
+	Interrogate
+
+	// Register is requested by a **SC# string.
+	Register
+
+	// Erasure is requested by a ##SC# string.
+	Erasure
+)
+
+// MMI is a parsed MMI string.
+type MMI struct {
+	// Procedure is the requested procedure.
+	Procedure SSProcedure
+
+	// Code is the service code, e.g. 21 for call forwarding unconditional.
+	Code string
+
+	// Args are the supplementary information fields following the service
+	// code, e.g. the forwarded-to number.
+	Args []string
+}
+
+// ssCodes are the service codes of the supplementary services defined in 3GPP
+// TS 22.030 Annex B, and of the PIN management strings.
+//
+// Any other code is treated as USSD.
+var ssCodes = map[string]bool{
+	"002": true, "004": true, "21": true, "67": true, "61": true, "62": true,
+	"30": true, "31": true, "76": true, "77": true, "43": true,
+	"330": true, "333": true, "353": true, "33": true, "331": true,
+	"332": true, "35": true, "351": true, "03": true,
+	"04": true, "042": true, "05": true, "052": true,
+}
+
+// ParseMMI parses an MMI string, such as "*#21#" or "**04*old*new*new#".
+func ParseMMI(s string) (MMI, error) {
+	m := MMI{}
+	if !strings.HasSuffix(s, "#") {
+		return m, ErrInvalidMMI
+	}
+	body := s[:len(s)-1]
+	switch {
+	case strings.HasPrefix(body, "**"):
+		m.Procedure, body = Register, body[2:]
+	case strings.HasPrefix(body, "##"):
+		m.Procedure, body = Erasure, body[2:]
+	case strings.HasPrefix(body, "*#"):
+		m.Procedure, body = Interrogate, body[2:]
+	case strings.HasPrefix(body, "*"):
+		m.Procedure, body = Activate, body[1:]
+	case strings.HasPrefix(body, "#"):
+		m.Procedure, body = Deactivate, body[1:]
+	default:
+		return m, ErrInvalidMMI
+	}
+	fields := strings.Split(body, "*")
+	if fields[0] == "" {
+		return m, ErrInvalidMMI
+	}
+	m.Code = fields[0]
+	m.Args = fields[1:]
+	return m, nil
+}
+
+// IsUSSD returns true if the service code is not a supplementary service
+// known to the modem, and so is passed to the network as USSD.
+func (m MMI) IsUSSD() bool {
+	return !ssCodes[m.Code]
+}
+
+// USSDResponse is the network response to a USSD request, as per +CUSD.
+type USSDResponse struct {
+	// Status is the +CUSD <m>, with 0 indicating no further action is
+	// required, and 1 that further user action is required.
+	Status int
+
+	// Message is the response string, as returned by the modem.
+	//
+	// The encoding depends on the DCS and on the character set selected in
+	// the modem, as per +CSCS.
+	Message string
+
+	// DCS is the data coding scheme of the message.
+	DCS int
+}
+
+// SSResult is the result of executing an MMI string.
+type SSResult struct {
+	// Info is the info returned by the modem, such as +CCFC or +CLCK lines
+	// for interrogations.
+	Info []string
+
+	// USSD is the network response to a USSD request, or nil if the request
+	// was a supplementary service or no response was received.
+	USSD *USSDResponse
+}
+
+// ssOption is an option specific to ExecuteSS.
+//
+// It satisfies at.CommandOption, by embedding an at.LayerOption, so it can be
+// passed with the command options, but it is removed before those reach the
+// AT driver.  Passed to any other method it is rejected by the driver.
+type ssOption interface {
+	at.CommandOption
+	applySSOption(*ssConfig)
+}
+
+type ssConfig struct {
+	ussdTimeout time.Duration
+}
+
+type ussdTimeoutOption struct {
+	at.LayerOption
+	d time.Duration
+}
+
+func (o ussdTimeoutOption) applySSOption(c *ssConfig) {
+	c.ussdTimeout = o.d
+}
+
+// WithUSSDTimeout specifies the time ExecuteSS waits for the network response
+// to a USSD request.
+//
+// The default is 10 seconds.
+func WithUSSDTimeout(d time.Duration) at.CommandOption {
+	return ussdTimeoutOption{"gsm.WithUSSDTimeout", d}
+}
+
+// ExecuteSS dials an MMI string, such as "*#21#" to interrogate call
+// forwarding, or "**04*old*new*new#" to change the PIN, providing access to
+// supplementary services not exposed via dedicated AT commands.
+//
+// Strings with service codes that are not known supplementary services are
+// treated as USSD, and the network response awaited.
+func (g *GSM) ExecuteSS(mmi string, options ...at.CommandOption) (res SSResult, err error) {
+	m, err := ParseMMI(mmi)
+	if err != nil {
+		return
+	}
+	cfg := ssConfig{ussdTimeout: 10 * time.Second}
+	cOpts := []at.CommandOption(nil)
+	for _, o := range options {
+		if so, ok := o.(ssOption); ok {
+			so.applySSOption(&cfg)
+		} else {
+			cOpts = append(cOpts, o)
+		}
+	}
+	var ussd chan []string
+	if m.IsUSSD() {
+		ussd = make(chan []string, 1)
+		err = g.AddIndication("+CUSD:", func(i []string) {
+			select {
+			case ussd <- i:
+			default:
+			}
+		})
+		if err != nil {
+			return
+		}
+		defer g.CancelIndication("+CUSD:")
+	}
+	res.Info, err = g.Command("D"+mmi+";", cOpts...)
+	if err != nil || ussd == nil {
+		return
+	}
+	// some modems return the +CUSD as info rather than an indication.
+	for _, l := range res.Info {
+		if info.HasPrefix(l, "+CUSD") {
+			res.USSD, err = parseCUSD(l)
+			return
+		}
+	}
+	select {
+	case i := <-ussd:
+		res.USSD, err = parseCUSD(i[0])
+	case <-time.After(cfg.ussdTimeout):
+	case <-g.Closed():
+		err = at.ErrClosed
+	}
+	return
+}
+
+// parseCUSD parses a +CUSD: <m>[,<str>[,<dcs>]] line.
+func parseCUSD(l string) (*USSDResponse, error) {
+	fields := info.Fields(info.TrimPrefix(l, "+CUSD"))
+	status, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, ErrMalformedResponse
+	}
+	r := USSDResponse{Status: status}
+	if len(fields) > 1 {
+		r.Message = fields[1]
+	}
+	if len(fields) > 2 {
+		if r.DCS, err = strconv.Atoi(fields[2]); err != nil {
+			return nil, ErrMalformedResponse
+		}
+	}
+	return &r, nil
+}
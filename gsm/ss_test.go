@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+func TestParseMMI(t *testing.T) {
+	patterns := []struct {
+		name string
+		in   string
+		mmi  gsm.MMI
+		ussd bool
+		err  error
+	}{
+		{"interrogate", "*#21#", gsm.MMI{Procedure: gsm.Interrogate, Code: "21", Args: []string{}}, false, nil},
+		{"activate", "*21*+61412345678#", gsm.MMI{Procedure: gsm.Activate, Code: "21", Args: []string{"+61412345678"}}, false, nil},
+		{"deactivate", "#67#", gsm.MMI{Procedure: gsm.Deactivate, Code: "67", Args: []string{}}, false, nil},
+		{"register", "**04*1234*4321*4321#", gsm.MMI{Procedure: gsm.Register, Code: "04", Args: []string{"1234", "4321", "4321"}}, false, nil},
+		{"erasure", "##002#", gsm.MMI{Procedure: gsm.Erasure, Code: "002", Args: []string{}}, false, nil},
+		{"ussd", "*100#", gsm.MMI{Procedure: gsm.Activate, Code: "100", Args: []string{}}, true, nil},
+		{"no terminator", "*#21", gsm.MMI{}, false, gsm.ErrInvalidMMI},
+		{"no prefix", "21#", gsm.MMI{}, false, gsm.ErrInvalidMMI},
+		{"no code", "*#", gsm.MMI{Procedure: gsm.Activate}, false, gsm.ErrInvalidMMI},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			mmi, err := gsm.ParseMMI(p.in)
+			assert.Equal(t, p.err, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, p.mmi, mmi)
+			assert.Equal(t, p.ussd, mmi.IsUSSD())
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestExecuteSS(t *testing.T) {
+	cmdSet := map[string][]string{
+		"ATD*#21#;\r\n":   {"+CCFC: 1,1,\"+61412345678\",145\r\n", "OK\r\n"},
+		"ATD*100#;\r\n":   {"OK\r\n"},
+		"ATD*101#;\r\n":   {"+CUSD: 0,\"Balance $5\",15\r\n", "OK\r\n"},
+		"ATD*102#;\r\n":   {"OK\r\n"},
+		"ATD*103#;\r\n":   {"+CUSD: x\r\n", "OK\r\n"},
+		"ATD**04*1#;\r\n": {"+CME ERROR: 16\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	// supplementary service
+	res, err := g.ExecuteSS("*#21#")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+CCFC: 1,1,\"+61412345678\",145"}, res.Info)
+	assert.Nil(t, res.USSD)
+
+	// ussd indication
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		mm.r <- []byte("\r\n+CUSD: 1,\"Menu\",72\r\n")
+	}()
+	res, err = g.ExecuteSS("*100#")
+	assert.Nil(t, err)
+	assert.Equal(t, &gsm.USSDResponse{Status: 1, Message: "Menu", DCS: 72}, res.USSD)
+
+	// ussd info
+	res, err = g.ExecuteSS("*101#")
+	assert.Nil(t, err)
+	assert.Equal(t, &gsm.USSDResponse{Status: 0, Message: "Balance $5", DCS: 15}, res.USSD)
+
+	// ussd no response
+	start := time.Now()
+	res, err = g.ExecuteSS("*102#", gsm.WithUSSDTimeout(50*time.Millisecond))
+	assert.Nil(t, err)
+	assert.Nil(t, res.USSD)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// malformed ussd
+	_, err = g.ExecuteSS("*103#")
+	assert.Equal(t, gsm.ErrMalformedResponse, err)
+
+	// error
+	_, err = g.ExecuteSS("**04*1#")
+	assert.Equal(t, at.CMEError("16"), err)
+
+	// invalid
+	_, err = g.ExecuteSS("123")
+	assert.Equal(t, gsm.ErrInvalidMMI, err)
+
+	// send option
+	_, err = g.ExecuteSS("*#21#", gsm.WithSendTimeout(time.Second))
+	assert.Equal(t, at.ErrUnsupportedOption("gsm.WithSendTimeout"), err)
+
+	// ussd option with other methods
+	_, err = g.SendShortMessage("+123456789", "test message", gsm.WithUSSDTimeout(time.Second))
+	assert.Equal(t, at.ErrUnsupportedOption("gsm.WithUSSDTimeout"), err)
+	_, err = g.Command("+CSQ", gsm.WithUSSDTimeout(time.Second))
+	assert.Equal(t, at.ErrUnsupportedOption("gsm.WithUSSDTimeout"), err)
+}
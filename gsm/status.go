@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"time"
+
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// DeliveryStatus is the outcome of delivering a sent message, as decoded from
+// the TP-ST of an SMS-STATUS-REPORT.
+type DeliveryStatus int
+
+const (
+	// Delivered indicates the message was delivered to the recipient.
+	Delivered DeliveryStatus = iota
+
+	// DeliveryPending indicates a temporary error, and that the SMSC is still
+	// trying to deliver the message.
+	DeliveryPending
+
+	// TemporaryFailure indicates a temporary error, and that the SMSC has
+	// stopped trying to deliver the message.  The message may be resent.
+	TemporaryFailure
+
+	// PermanentFailure indicates a permanent error, and that the SMSC has
+	// stopped trying to deliver the message.
+	PermanentFailure
+
+	// Expired indicates the validity period of the message expired before it
+	// could be delivered.
+	Expired
+)
+
+var deliveryStatusNames = map[DeliveryStatus]string{
+	Delivered:        "delivered",
+	DeliveryPending:  "pending",
+	TemporaryFailure: "temporary failure",
+	PermanentFailure: "permanent failure",
+	Expired:          "expired",
+}
+
+func (s DeliveryStatus) String() string {
+	if n, ok := deliveryStatusNames[s]; ok {
+		return n
+	}
+	return "unknown"
+}
+
+// the TP-ST indicating the validity period expired.
+const stValidityPeriodExpired = 0x46
+
+// NewDeliveryStatus converts a TP-ST value into the corresponding
+// DeliveryStatus.
+//
+// Reserved and SC specific values are mapped to the status of the group they
+// fall within, and values beyond the defined groups are treated as permanent
+// failures, as per 3GPP TS 23.040.
+func NewDeliveryStatus(st byte) DeliveryStatus {
+	switch {
+	case st == stValidityPeriodExpired:
+		return Expired
+	case st < 0x20:
+		return Delivered
+	case st < 0x40:
+		return DeliveryPending
+	case st < 0x60:
+		return PermanentFailure
+	case st < 0x80:
+		return TemporaryFailure
+	default:
+		return PermanentFailure
+	}
+}
+
+// StatusReport is a decoded SMS-STATUS-REPORT.
+type StatusReport struct {
+	// MR is the TP-MR of the message the report refers to.
+	MR int
+
+	// Recipient is the number of the recipient of the message.
+	Recipient string
+
+	// SCTS is the time the SMSC received the message.
+	SCTS time.Time
+
+	// DT is the time of the delivery, or of the last delivery attempt.
+	DT time.Time
+
+	// Status is the outcome of the delivery.
+	Status DeliveryStatus
+
+	// ST is the raw TP-ST, for those requiring the specific cause.
+	ST byte
+}
+
+// NewStatusReport decodes an SMS-STATUS-REPORT TPDU.
+//
+// Returns ErrNotStatusReport if the TPDU is not an SMS-STATUS-REPORT.
+func NewStatusReport(tp *tpdu.TPDU) (StatusReport, error) {
+	if tp.SmsType() != tpdu.SmsStatusReport {
+		return StatusReport{}, ErrNotStatusReport
+	}
+	return StatusReport{
+		MR:        int(tp.MR),
+		Recipient: tp.RA.Number(),
+		SCTS:      tp.SCTS.Time,
+		DT:        tp.DT.Time,
+		Status:    NewDeliveryStatus(tp.ST),
+		ST:        tp.ST,
+	}, nil
+}
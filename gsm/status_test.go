@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestNewDeliveryStatus(t *testing.T) {
+	patterns := []struct {
+		st     byte
+		status gsm.DeliveryStatus
+		name   string
+	}{
+		{0x00, gsm.Delivered, "delivered"},
+		{0x02, gsm.Delivered, "delivered"},
+		{0x1f, gsm.Delivered, "delivered"},
+		{0x20, gsm.DeliveryPending, "pending"},
+		{0x3f, gsm.DeliveryPending, "pending"},
+		{0x41, gsm.PermanentFailure, "permanent failure"},
+		{0x46, gsm.Expired, "expired"},
+		{0x5f, gsm.PermanentFailure, "permanent failure"},
+		{0x60, gsm.TemporaryFailure, "temporary failure"},
+		{0x7f, gsm.TemporaryFailure, "temporary failure"},
+		{0x80, gsm.PermanentFailure, "permanent failure"},
+	}
+	for _, p := range patterns {
+		status := gsm.NewDeliveryStatus(p.st)
+		assert.Equal(t, p.status, status, p.st)
+		assert.Equal(t, p.name, status.String(), p.st)
+	}
+	assert.Equal(t, "unknown", gsm.DeliveryStatus(-1).String())
+}
+
+func TestNewStatusReport(t *testing.T) {
+	scts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	dt := scts.Add(time.Minute)
+	tp := tpdu.TPDU{
+		MR:   42,
+		RA:   tpdu.Address{Addr: "1234", TOA: 0x91},
+		SCTS: tpdu.Timestamp{Time: scts},
+		DT:   tpdu.Timestamp{Time: dt},
+		ST:   0x46,
+	}
+	err := tp.SetSmsType(tpdu.SmsStatusReport)
+	require.Nil(t, err)
+	sr, err := gsm.NewStatusReport(&tp)
+	require.Nil(t, err)
+	assert.Equal(t, gsm.StatusReport{
+		MR:        42,
+		Recipient: "+1234",
+		SCTS:      scts,
+		DT:        dt,
+		Status:    gsm.Expired,
+		ST:        0x46,
+	}, sr)
+
+	// not a status report
+	tp = tpdu.TPDU{}
+	_, err = gsm.NewStatusReport(&tp)
+	assert.Equal(t, gsm.ErrNotStatusReport, err)
+}
@@ -0,0 +1,343 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/pdumode"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// MessageStatus is the status of a message held in the modem message storage.
+//
+// The values correspond to the PDU mode <stat> values of +CMGL and +CMGR.
+type MessageStatus int
+
+const (
+	// RecUnread identifies received messages that have not been read.
+	RecUnread MessageStatus = iota
+
+	// RecRead identifies received messages that have been read.
+	RecRead
+
+	// StoUnsent identifies stored messages that have not been sent.
+	StoUnsent
+
+	// StoSent identifies stored messages that have been sent.
+	StoSent
+
+	// AllMessages identifies all messages, and is only applicable to listing.
+	AllMessages
+)
+
+// StoredPDU is a TPDU held in the modem message storage.
+type StoredPDU struct {
+	// Index is the location of the message within the storage.
+	Index int
+
+	// Status is the status of the message within the storage.
+	Status MessageStatus
+
+	// TPDU is the message itself.
+	TPDU tpdu.TPDU
+}
+
+// StoredPDUHandler receives TPDUs read from the modem message storage.
+type StoredPDUHandler func(StoredPDU)
+
+// StorageSlot is the location of a TPDU in the modem message storage.
+type StorageSlot struct {
+	// Storage is the name of the message storage, e.g. "SM" or "ME".
+	Storage string
+
+	// Index is the location of the message within the storage.
+	Index int
+}
+
+// slotKey identifies a TPDU while its message is being reassembled.
+type slotKey struct {
+	oa    string
+	mref  int
+	seqno int
+}
+
+func newSlotKey(tp *tpdu.TPDU) slotKey {
+	segments, seqno, mref, ok := tp.ConcatInfo()
+	if !ok || segments < 2 {
+		return slotKey{oa: tp.OA.Number(), mref: -1}
+	}
+	return slotKey{oa: tp.OA.Number(), mref: mref, seqno: seqno}
+}
+
+// slotTracker records the storage slots of TPDUs read from storage until
+// their message is reassembled.
+type slotTracker struct {
+	mu    sync.Mutex
+	slots map[slotKey]StorageSlot
+}
+
+func newSlotTracker() *slotTracker {
+	return &slotTracker{slots: make(map[slotKey]StorageSlot)}
+}
+
+// add records the slot of the TPDU, if it was read from storage.
+func (t *slotTracker) add(tp *tpdu.TPDU, slot *StorageSlot) {
+	if slot == nil {
+		return
+	}
+	t.mu.Lock()
+	t.slots[newSlotKey(tp)] = *slot
+	t.mu.Unlock()
+}
+
+// release returns the slots of the TPDUs, and forgets them.
+func (t *slotTracker) release(tpdus []*tpdu.TPDU) []StorageSlot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ss []StorageSlot
+	for _, tp := range tpdus {
+		if tp == nil {
+			// a part missing from a timed out reassembly
+			continue
+		}
+		k := newSlotKey(tp)
+		if slot, ok := t.slots[k]; ok {
+			ss = append(ss, slot)
+			delete(t.slots, k)
+		}
+	}
+	return ss
+}
+
+// ListPDUs lists the TPDUs in the modem message storage with the given status.
+//
+// The listing is deferred until no SMS sends are pending, as per
+// LongOperation.
+//
+// Each TPDU is decoded and passed to the handler as soon as it is read from
+// the modem, rather than the complete listing being collected first, so the
+// memory required is bounded regardless of the number of stored messages.
+//
+// The handlers are called from the goroutine serialising access to the modem,
+// so they must not issue commands to the modem themselves.
+//
+// TPDUs that cannot be decoded are passed to the error handler, as an
+// ErrUnmarshal, and the listing continues.
+//
+// Requires the modem to be in PDU mode.
+func (g *GSM) ListPDUs(stat MessageStatus, ph StoredPDUHandler, eh ErrorHandler, options ...at.CommandOption) error {
+	if !g.pduMode {
+		return ErrWrongMode
+	}
+	var hdr string
+	lh := func(l string) {
+		if info.HasPrefix(l, "+CMGL") {
+			hdr = l
+			return
+		}
+		if hdr == "" {
+			// ignore cruft
+			return
+		}
+		i := []string{hdr, l}
+		hdr = ""
+		sp, err := unmarshalStoredPDU(i)
+		if err != nil {
+			eh(ErrUnmarshal{i, err})
+			return
+		}
+		ph(sp)
+	}
+	options = append(options, at.WithLineHandler(lh))
+	return g.sched.deferred(func() error {
+		_, err := g.Command(fmt.Sprintf("+CMGL=%d", stat), options...)
+		return err
+	})
+}
+
+// ReadPDU reads the TPDU at the index in the modem message storage.
+//
+// TPDUs that cannot be decoded are returned as an ErrUnmarshal.
+//
+// Requires the modem to be in PDU mode.
+func (g *GSM) ReadPDU(index int, options ...at.CommandOption) (sp StoredPDU, err error) {
+	if !g.pduMode {
+		err = ErrWrongMode
+		return
+	}
+	var i []string
+	i, err = g.Command(fmt.Sprintf("+CMGR=%d", index), options...)
+	if err != nil {
+		return
+	}
+	for n, l := range i {
+		if !info.HasPrefix(l, "+CMGR") {
+			continue
+		}
+		sp, err = unmarshalStoredPDU(i[n:])
+		if err != nil {
+			err = ErrUnmarshal{i[n:], err}
+		}
+		sp.Index = index
+		return
+	}
+	err = ErrMalformedResponse
+	return
+}
+
+// unmarshalStoredPDU converts +CMGL or +CMGR info into the corresponding
+// StoredPDU.
+//
+// The info is expected to be of the form:
+//
+//	+CMGL: <index>,<stat>,[<alpha>],<length>
+//	<pdu>
+//
+// or
+//
+//	+CMGR: <stat>,[<alpha>],<length>
+//	<pdu>
+//
+// In the +CMGR case the Index is left to the caller to populate.
+func unmarshalStoredPDU(i []string) (sp StoredPDU, err error) {
+	if len(i) < 2 {
+		err = ErrUnderlength
+		return
+	}
+	var fields []string
+	if info.HasPrefix(i[0], "+CMGL") {
+		fields = strings.Split(info.TrimPrefix(i[0], "+CMGL"), ",")
+		if len(fields) < 3 {
+			err = ErrMalformedResponse
+			return
+		}
+		sp.Index, err = strconv.Atoi(fields[0])
+		if err != nil {
+			return
+		}
+		fields = fields[1:]
+	} else {
+		fields = strings.Split(info.TrimPrefix(i[0], "+CMGR"), ",")
+		if len(fields) < 2 {
+			err = ErrMalformedResponse
+			return
+		}
+	}
+	var stat int
+	stat, err = strconv.Atoi(fields[0])
+	if err != nil {
+		return
+	}
+	sp.Status = MessageStatus(stat)
+	dirn := sms.AsMT
+	if sp.Status == StoUnsent || sp.Status == StoSent {
+		dirn = sms.AsMO
+	}
+	var tp *tpdu.TPDU
+	tp, err = unmarshalPDU(fields[len(fields)-1], i[1], dirn)
+	if err != nil {
+		return
+	}
+	sp.TPDU = *tp
+	return
+}
+
+// unmarshalPDU converts a PDU mode hex string into the corresponding TPDU,
+// checking the TPDU length against the length reported by the modem.
+func unmarshalPDU(length string, hexstr string, options ...sms.UnmarshalOption) (*tpdu.TPDU, error) {
+	l, err := strconv.Atoi(length)
+	if err != nil {
+		return nil, err
+	}
+	pdu, err := pdumode.UnmarshalHexString(hexstr)
+	if err != nil {
+		return nil, err
+	}
+	if l != len(pdu.TPDU) {
+		return nil, fmt.Errorf("length mismatch - expected %d, got %d", l, len(pdu.TPDU))
+	}
+	return sms.Unmarshal(pdu.TPDU, options...)
+}
+
+// startupDrainDedup is the size of the DedupSet used to discard indications
+// of messages already received by WithStartupDrain, if no other
+// deduplication is provided.
+const startupDrainDedup = 64
+
+type startupDrainOption bool
+
+func (o startupDrainOption) applyRxOption(c *rxConfig) {
+	c.drain = bool(o)
+}
+
+// WithStartupDrain specifies that StartMessageRx receives the unread messages
+// already in the modem message storage, such as those accumulated while the
+// application was not running, before enabling the delivery of new messages.
+//
+// The stored messages are received as per ReceiveStoredPDU.  As a stored
+// message may also be indicated via +CMTI, received messages are
+// deduplicated, using a DedupSet of 64 entries if no deduplication is
+// otherwise provided.
+func WithStartupDrain() RxOption {
+	return startupDrainOption(true)
+}
+
+type drainDeletionOption bool
+
+func (o drainDeletionOption) applyRxOption(c *rxConfig) {
+	c.drainDelete = bool(o)
+}
+
+// WithDrainDeletion specifies that the messages received by WithStartupDrain
+// are deleted from the modem message storage once they have been passed to
+// the message handler, so they are not received again by a later drain.
+//
+// Listing the unread messages marks them as read, so they are not drained
+// again even if not deleted, but they continue to occupy the storage.
+//
+// Only the TPDUs of complete messages are deleted.  The parts of
+// concatenated messages still awaiting other parts remain in storage, and
+// their slots are available in the Message once it is complete.  Failures to
+// delete are passed to the error handler.
+//
+// This option is ignored if WithStartupDrain is not also applied.
+func WithDrainDeletion() RxOption {
+	return drainDeletionOption(true)
+}
+
+type cmtiOption bool
+
+func (o cmtiOption) applyRxOption(c *rxConfig) {
+	c.cmti = bool(o)
+}
+
+// WithCMTI specifies that StartMessageRx directs the modem to store received
+// messages and indicate them with +CMTI, rather than forwarding them directly
+// with +CMT.  Each indicated message is read from storage, passed to the
+// message handler, then deleted from storage.
+//
+// This is for modems and networks that do not reliably support the direct
+// forwarding of messages.  As the messages are stored by the modem they are
+// not lost if the application is not running, and do not require
+// acknowledgement.
+//
+// As with WithDrainDeletion, only the TPDUs of complete messages are
+// deleted, and the parts of concatenated messages remain in storage until the
+// message is complete.  Messages discarded as duplicates, or by the data
+// download and voicemail handlers, are also deleted.  TPDUs that cannot be
+// decoded are left in storage.  Failures to delete are passed to the error
+// handler.
+//
+// The <mt> of the +CNMI settings provided by WithCNMI is overridden.
+func WithCMTI() RxOption {
+	return cmtiOption(true)
+}
@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestListPDUs(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGL=4\r\n": {
+			"+CMGL: 1,1,,24\r\n",
+			"00040B911234567890F000000250100173832305C8329BFD06\r\n",
+			"+CMGL: 2,3,\"bob\",23\r\n",
+			"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c\r\n",
+			"+CMGL: 3,0,,24\r\n",
+			"00040B911234567JUNK000000250100173832305C8329BFD06\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGL=0\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	var sps []gsm.StoredPDU
+	var errs []error
+	ph := func(sp gsm.StoredPDU) {
+		sps = append(sps, sp)
+	}
+	eh := func(err error) {
+		errs = append(errs, err)
+	}
+
+	// all
+	err := g.ListPDUs(gsm.AllMessages, ph, eh)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(sps))
+	assert.Equal(t, 1, sps[0].Index)
+	assert.Equal(t, gsm.RecRead, sps[0].Status)
+	assert.Equal(t, tpdu.SmsDeliver, sps[0].TPDU.SmsType())
+	assert.Equal(t, "+21436587090", sps[0].TPDU.OA.Number())
+	assert.Equal(t, []byte("Hello"), []byte(sps[0].TPDU.UD))
+	assert.Equal(t, 2, sps[1].Index)
+	assert.Equal(t, gsm.StoSent, sps[1].Status)
+	assert.Equal(t, tpdu.SmsSubmit, sps[1].TPDU.SmsType())
+	assert.Equal(t, "+123456789", sps[1].TPDU.DA.Number())
+	require.Equal(t, 1, len(errs))
+	require.IsType(t, gsm.ErrUnmarshal{}, errs[0])
+	assert.Equal(t, hex.InvalidByteError(0x4a), errs[0].(gsm.ErrUnmarshal).Err)
+
+	// empty
+	sps = nil
+	errs = nil
+	err = g.ListPDUs(gsm.RecUnread, ph, eh)
+	assert.Nil(t, err)
+	assert.Nil(t, sps)
+	assert.Nil(t, errs)
+
+	// error
+	err = g.ListPDUs(gsm.RecRead, ph, eh)
+	assert.Equal(t, at.ErrError, err)
+
+	// wrong mode
+	g, mm = setupModem(t, cmdSet, gsm.WithTextMode)
+	defer teardownModem(mm)
+	err = g.ListPDUs(gsm.AllMessages, ph, eh)
+	assert.Equal(t, gsm.ErrWrongMode, err)
+}
+
+func TestReadPDU(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGR=1\r\n": {
+			"+CMGR: 1,,24\r\n",
+			"00040B911234567890F000000250100173832305C8329BFD06\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGR=2\r\n": {
+			"+CMGR: 3,\"bob\",23\r\n",
+			"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGR=3\r\n": {
+			"+CMGR: 0,,24\r\n",
+			"00040B911234567JUNK000000250100173832305C8329BFD06\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGR=4\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	// deliver
+	sp, err := g.ReadPDU(1)
+	require.Nil(t, err)
+	assert.Equal(t, 1, sp.Index)
+	assert.Equal(t, gsm.RecRead, sp.Status)
+	assert.Equal(t, "+21436587090", sp.TPDU.OA.Number())
+
+	// submit
+	sp, err = g.ReadPDU(2)
+	require.Nil(t, err)
+	assert.Equal(t, 2, sp.Index)
+	assert.Equal(t, gsm.StoSent, sp.Status)
+	assert.Equal(t, "+123456789", sp.TPDU.DA.Number())
+
+	// junk
+	_, err = g.ReadPDU(3)
+	require.IsType(t, gsm.ErrUnmarshal{}, err)
+	assert.Equal(t, hex.InvalidByteError(0x4a), err.(gsm.ErrUnmarshal).Err)
+
+	// empty
+	_, err = g.ReadPDU(4)
+	assert.Equal(t, gsm.ErrMalformedResponse, err)
+
+	// error
+	_, err = g.ReadPDU(5)
+	assert.Equal(t, at.ErrError, err)
+
+	// wrong mode
+	g, mm = setupModem(t, cmdSet, gsm.WithTextMode)
+	defer teardownModem(mm)
+	_, err = g.ReadPDU(1)
+	assert.Equal(t, gsm.ErrWrongMode, err)
+}
@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"sort"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// StoredMessage is a message decoded from the TPDUs held in the modem message
+// storage.
+type StoredMessage struct {
+	// Number is the originator for received messages, and the destination
+	// for stored messages waiting to be, or that have been, sent.
+	Number string
+
+	// Message is the decoded text of the message.
+	Message string
+
+	// SCTS is the time the SMSC received the message, for received messages.
+	SCTS tpdu.Timestamp
+
+	// Class is the message class, as determined from the DCS of the first
+	// TPDU, or tpdu.MClassUnknown if no class is indicated.
+	Class tpdu.MessageClass
+
+	// Status is the status of the message within the storage, as per its
+	// first TPDU.
+	Status MessageStatus
+
+	// Partial indicates the message is part of a concatenated message for
+	// which not all the TPDUs are held in storage, so the Message contains
+	// only the text of the TPDUs available.
+	Partial bool
+
+	// Slots are the locations in the modem message storage of the TPDUs
+	// forming the message, so they can later be deleted.
+	Slots []StorageSlot
+
+	TPDUs []*tpdu.TPDU
+}
+
+// StoredMessageHandler receives messages read from the modem message storage.
+type StoredMessageHandler func(StoredMessage)
+
+// ListMessages lists the messages in the modem message storage with the given
+// status, decoding the TPDUs into their text.
+//
+// Concatenated messages are reassembled from their TPDUs, so the listing is
+// collected before any messages are passed to the handler.  Messages are
+// passed in the order of the storage index of their first TPDU, and as the
+// listing is complete the handler may issue commands to the modem, such as
+// deleting the messages once handled.
+//
+// TPDUs that cannot be unmarshalled are passed to the error handler, as an
+// ErrUnmarshal, and messages that cannot be decoded as an ErrDecode.
+//
+// Requires the modem to be in PDU mode.
+func (g *GSM) ListMessages(stat MessageStatus, mh StoredMessageHandler, eh ErrorHandler, options ...at.CommandOption) error {
+	var sps []StoredPDU
+	ph := func(sp StoredPDU) {
+		sps = append(sps, sp)
+	}
+	var errs []error
+	leh := func(err error) {
+		errs = append(errs, err)
+	}
+	err := g.ListPDUs(stat, ph, leh, options...)
+	for _, err := range errs {
+		eh(err)
+	}
+	if err != nil {
+		return err
+	}
+	for _, group := range groupStoredPDUs(sps) {
+		sm, err := decodeStored(group)
+		if err != nil {
+			eh(err)
+			continue
+		}
+		mh(sm)
+	}
+	return nil
+}
+
+// ReadMessage reads the message at the index in the modem message storage,
+// decoding the TPDU into its text.
+//
+// Only the single TPDU at the index is read, so if it is part of a
+// concatenated message the returned message is Partial.
+//
+// TPDUs that cannot be unmarshalled are returned as an ErrUnmarshal, and
+// those that cannot be decoded as an ErrDecode.
+//
+// Requires the modem to be in PDU mode.
+func (g *GSM) ReadMessage(index int, options ...at.CommandOption) (StoredMessage, error) {
+	sp, err := g.ReadPDU(index, options...)
+	if err != nil {
+		return StoredMessage{}, err
+	}
+	return decodeStored([]StoredPDU{sp})
+}
+
+// storedKey identifies the TPDUs forming a concatenated message.
+type storedKey struct {
+	number   string
+	mref     int
+	segments int
+}
+
+// storedNumber returns the number of the other party to the TPDU.
+func storedNumber(tp *tpdu.TPDU) string {
+	if tp.SmsType() == tpdu.SmsSubmit {
+		return tp.DA.Number()
+	}
+	return tp.OA.Number()
+}
+
+// groupStoredPDUs groups the TPDUs of concatenated messages, ordered by
+// sequence number, with the groups ordered by the index of their first TPDU.
+func groupStoredPDUs(sps []StoredPDU) [][]StoredPDU {
+	sort.SliceStable(sps, func(i, j int) bool {
+		return sps[i].Index < sps[j].Index
+	})
+	var groups [][]StoredPDU
+	concat := make(map[storedKey]int)
+	for _, sp := range sps {
+		segments, _, mref, ok := sp.TPDU.ConcatInfo()
+		if !ok || segments < 2 {
+			groups = append(groups, []StoredPDU{sp})
+			continue
+		}
+		k := storedKey{storedNumber(&sp.TPDU), mref, segments}
+		if n, ok := concat[k]; ok {
+			groups[n] = append(groups[n], sp)
+			continue
+		}
+		concat[k] = len(groups)
+		groups = append(groups, []StoredPDU{sp})
+	}
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			_, si, _, _ := group[i].TPDU.ConcatInfo()
+			_, sj, _, _ := group[j].TPDU.ConcatInfo()
+			return si < sj
+		})
+	}
+	return groups
+}
+
+// decodeStored decodes the group of TPDUs forming a message.
+func decodeStored(group []StoredPDU) (StoredMessage, error) {
+	tpdus := make([]*tpdu.TPDU, len(group))
+	slots := make([]StorageSlot, len(group))
+	for i := range group {
+		tpdus[i] = &group[i].TPDU
+		slots[i] = StorageSlot{Index: group[i].Index}
+	}
+	m, err := sms.Decode(tpdus)
+	if err != nil {
+		return StoredMessage{}, ErrDecode{tpdus, err}
+	}
+	first := tpdus[0]
+	segments, _, _, ok := first.ConcatInfo()
+	class, _ := first.DCS.Class()
+	return StoredMessage{
+		Number:  storedNumber(first),
+		Message: string(m),
+		SCTS:    first.SCTS,
+		Class:   class,
+		Status:  group[0].Status,
+		Partial: ok && segments > 1 && len(group) < segments,
+		Slots:   slots,
+		TPDUs:   tpdus,
+	}, nil
+}
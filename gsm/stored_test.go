@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+const (
+	part1of2 = "004004912143000010101000000000a0050003010201c2e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c168bc5"
+	part2of2 = "00400491214300001010100000000018050003010202c462b1582c168bc562b1582c168bc5"
+	partial  = "004004912143000010101000000000a0050003020201c2e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c0e87c3e170381c168bc5"
+)
+
+func TestListMessages(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGL=4\r\n": {
+			"+CMGL: 1,0,,36\r\n",
+			part2of2 + "\r\n",
+			"+CMGL: 2,1,,24\r\n",
+			"00040B911234567890F000000250100173832305C8329BFD06\r\n",
+			"+CMGL: 3,0,,155\r\n",
+			part1of2 + "\r\n",
+			"+CMGL: 4,1,,155\r\n",
+			partial + "\r\n",
+			"+CMGL: 5,0,,24\r\n",
+			"00040B911234567JUNK000000250100173832305C8329BFD06\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGL=0\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	var sms []gsm.StoredMessage
+	var errs []error
+	mh := func(sm gsm.StoredMessage) {
+		sms = append(sms, sm)
+	}
+	eh := func(err error) {
+		errs = append(errs, err)
+	}
+
+	// all
+	err := g.ListMessages(gsm.AllMessages, mh, eh)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(sms))
+
+	assert.Equal(t, "+1234", sms[0].Number)
+	assert.Equal(t, strings.Repeat("a", 150)+strings.Repeat("b", 20), sms[0].Message)
+	assert.Equal(t, gsm.RecUnread, sms[0].Status)
+	assert.False(t, sms[0].Partial)
+	assert.Equal(t, []gsm.StorageSlot{{Index: 3}, {Index: 1}}, sms[0].Slots)
+	assert.Equal(t, 2, len(sms[0].TPDUs))
+
+	assert.Equal(t, "+21436587090", sms[1].Number)
+	assert.Equal(t, "Hello", sms[1].Message)
+	assert.Equal(t, gsm.RecRead, sms[1].Status)
+	assert.False(t, sms[1].Partial)
+	assert.Equal(t, []gsm.StorageSlot{{Index: 2}}, sms[1].Slots)
+
+	assert.Equal(t, "+1234", sms[2].Number)
+	assert.Equal(t, strings.Repeat("a", 150)+"bbb", sms[2].Message)
+	assert.True(t, sms[2].Partial)
+	assert.Equal(t, []gsm.StorageSlot{{Index: 4}}, sms[2].Slots)
+
+	require.Equal(t, 1, len(errs))
+	assert.IsType(t, gsm.ErrUnmarshal{}, errs[0])
+
+	// empty
+	sms = nil
+	errs = nil
+	err = g.ListMessages(gsm.RecUnread, mh, eh)
+	assert.Nil(t, err)
+	assert.Nil(t, sms)
+	assert.Nil(t, errs)
+
+	// error
+	err = g.ListMessages(gsm.RecRead, mh, eh)
+	assert.Equal(t, at.ErrError, err)
+
+	// wrong mode
+	g, mm = setupModem(t, cmdSet, gsm.WithTextMode)
+	defer teardownModem(mm)
+	err = g.ListMessages(gsm.AllMessages, mh, eh)
+	assert.Equal(t, gsm.ErrWrongMode, err)
+}
+
+func TestReadMessage(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGR=1\r\n": {
+			"+CMGR: 1,,24\r\n",
+			"00040B911234567890F000000250100173832305C8329BFD06\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGR=2\r\n": {
+			"+CMGR: 3,\"bob\",23\r\n",
+			"000101099121436587f900000cf4f29c0e6a97e7f3f0b90c\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMGR=3\r\n": {
+			"+CMGR: 0,,36\r\n",
+			part2of2 + "\r\n",
+			"\r\nOK\r\n",
+		},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	// deliver
+	sm, err := g.ReadMessage(1)
+	require.Nil(t, err)
+	assert.Equal(t, "+21436587090", sm.Number)
+	assert.Equal(t, "Hello", sm.Message)
+	assert.Equal(t, gsm.RecRead, sm.Status)
+	assert.Equal(t, []gsm.StorageSlot{{Index: 1}}, sm.Slots)
+	assert.False(t, sm.Partial)
+
+	// submit
+	sm, err = g.ReadMessage(2)
+	require.Nil(t, err)
+	assert.Equal(t, "+123456789", sm.Number)
+	assert.Equal(t, "test message", sm.Message)
+	assert.Equal(t, gsm.StoSent, sm.Status)
+
+	// part of concatenated
+	sm, err = g.ReadMessage(3)
+	require.Nil(t, err)
+	assert.Equal(t, strings.Repeat("b", 17), sm.Message)
+	assert.True(t, sm.Partial)
+
+	// error
+	_, err = g.ReadMessage(4)
+	assert.Equal(t, at.ErrError, err)
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+	"github.com/warthog618/sms/encoding/gsm7"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// UnmarshalTextTPDU converts text mode +CMT info into the corresponding SMS
+// TPDU.
+//
+// The info is expected to be of the form:
+//
+//	+CMT: <oa>,[<alpha>],<scts>[,<tooa>,<fo>,<pid>,<dcs>,<sca>,<tosca>,<length>]
+//	<data>
+//
+// where the optional fields are provided if the modem is configured with
+// +CSDH=1.  Without those fields the message is assumed to be coded in the
+// GSM 7-bit default alphabet, without a user data header.  For 7-bit messages
+// with a user data header the <length> is taken to be the TP-UDL, i.e. the
+// number of septets including the header.
+//
+// The data is expected to be hex encoded for 8-bit and UCS-2 messages, and
+// for messages with a user data header, as per 3GPP TS 27.005, and otherwise
+// to be in a character set compatible with UTF-8, such as "GSM" or "IRA",
+// as selected by +CSCS.
+func UnmarshalTextTPDU(i []string) (tpdu.TPDU, error) {
+	if len(i) < 2 {
+		return tpdu.TPDU{}, ErrUnderlength
+	}
+	return unmarshalTextDeliver(info.Fields(info.TrimPrefix(i[0], "+CMT")), i[1])
+}
+
+// unmarshalTextDeliver converts the header fields and data of a text mode
+// SMS-DELIVER into the corresponding TPDU.
+//
+// The fields are <oa>,[<alpha>],<scts>[,<tooa>,<fo>,<pid>,<dcs>,...].
+func unmarshalTextDeliver(fields []string, data string) (tp tpdu.TPDU, err error) {
+	if len(fields) < 3 {
+		return tp, ErrMalformedResponse
+	}
+	if tp.SCTS, err = parseTextSCTS(fields[2]); err != nil {
+		return
+	}
+	var hdr [4]int
+	if len(fields) >= 7 {
+		for n := range hdr {
+			if hdr[n], err = strconv.Atoi(fields[3+n]); err != nil {
+				return tp, ErrMalformedResponse
+			}
+		}
+	} else {
+		// no header, so a plain text international number
+		hdr[0] = 0x91
+	}
+	tp.OA = textAddress(fields[0], byte(hdr[0]))
+	tp.FirstOctet = tpdu.FirstOctet(hdr[1])
+	tp.PID = byte(hdr[2])
+	tp.DCS = tpdu.DCS(hdr[3])
+	alpha, err := tp.DCS.Alphabet()
+	if err != nil {
+		return
+	}
+	if !tp.UDHI() {
+		if alpha == tpdu.Alpha7Bit {
+			tp.UD, err = gsm7.Encode([]byte(data))
+			return
+		}
+		tp.UD, err = hex.DecodeString(data)
+		return
+	}
+	ud, err := hex.DecodeString(data)
+	if err != nil {
+		return
+	}
+	udhl, err := tp.UDH.UnmarshalBinary(ud)
+	if err != nil {
+		return
+	}
+	if alpha != tpdu.Alpha7Bit {
+		tp.UD = ud[udhl:]
+		return
+	}
+	// the septets are packed following the UDH, aligned to a septet
+	// boundary.
+	hdrSeptets := (udhl*8 + 6) / 7
+	// the number of septets cannot be determined from the packed octets,
+	// as the final octet may contain a spare septet, so it is taken from
+	// the <length>, the TP-UDL, if provided.
+	septets := len(ud)*8/7 - hdrSeptets
+	if len(fields) >= 10 {
+		udl, cerr := strconv.Atoi(fields[9])
+		if cerr != nil || udl < hdrSeptets {
+			return tp, ErrMalformedResponse
+		}
+		septets = udl - hdrSeptets
+	}
+	fill := hdrSeptets*7 - udhl*8
+	u := gsm7.Unpack7Bit(ud[udhl:], fill)
+	if septets < len(u) {
+		u = u[:septets]
+	}
+	tp.UD = u
+	return
+}
+
+// textAddress returns the address corresponding to a text mode number and
+// its type of address.
+func textAddress(number string, toa byte) tpdu.Address {
+	return tpdu.Address{Addr: strings.TrimPrefix(number, "+"), TOA: toa | 0x80}
+}
+
+// parseTextSCTS parses a text mode timestamp of the form
+// "yy/MM/dd,hh:mm:ss±zz", where zz is the offset from UTC in quarter hours.
+func parseTextSCTS(s string) (tpdu.Timestamp, error) {
+	var yy, mm, dd, h, m, sec, tz int
+	var sign byte
+	_, err := fmt.Sscanf(s, "%d/%d/%d,%d:%d:%d%c%d", &yy, &mm, &dd, &h, &m, &sec, &sign, &tz)
+	if err != nil || (sign != '+' && sign != '-') {
+		return tpdu.Timestamp{}, ErrMalformedResponse
+	}
+	offset := tz * 15 * 60
+	if sign == '-' {
+		offset = -offset
+	}
+	loc := time.FixedZone("SCTS", offset)
+	return tpdu.Timestamp{Time: time.Date(2000+yy, time.Month(mm), dd, h, m, sec, 0, loc)}, nil
+}
+
+// readText reads the SMS-DELIVER at the index in the modem message storage,
+// in text mode.
+//
+// The +CMGR info is of the form:
+//
+//	+CMGR: <stat>,<oa>,[<alpha>],<scts>[,<tooa>,<fo>,<pid>,<dcs>,<sca>,<tosca>,<length>]
+//	<data>
+func (g *GSM) readText(index int, options ...at.CommandOption) (tpdu.TPDU, error) {
+	i, err := g.Command(fmt.Sprintf("+CMGR=%d", index), options...)
+	if err != nil {
+		return tpdu.TPDU{}, err
+	}
+	for n, l := range i {
+		if !info.HasPrefix(l, "+CMGR") {
+			continue
+		}
+		if n+1 >= len(i) {
+			return tpdu.TPDU{}, ErrUnderlength
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+CMGR"))
+		if len(fields) < 4 {
+			return tpdu.TPDU{}, ErrMalformedResponse
+		}
+		return unmarshalTextDeliver(fields[1:], i[n+1])
+	}
+	return tpdu.TPDU{}, ErrMalformedResponse
+}
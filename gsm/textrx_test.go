@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestUnmarshalTextTPDU(t *testing.T) {
+	scts := time.Date(2020, 5, 1, 10, 37, 28, 0, time.FixedZone("", 10*3600))
+	patterns := []struct {
+		name string
+		info []string
+		oa   tpdu.Address
+		dcs  tpdu.DCS
+		ud   []byte
+		udh  tpdu.UserDataHeader
+		err  error
+	}{
+		{
+			"header",
+			[]string{
+				"+CMT: \"+61412345678\",,\"20/05/01,10:37:28+40\",145,4,0,0,\"+61418706700\",145,5",
+				"hello",
+			},
+			tpdu.Address{Addr: "61412345678", TOA: 0x91},
+			0,
+			[]byte("hello"),
+			nil,
+			nil,
+		},
+		{
+			"no header",
+			[]string{
+				"+CMT: \"+61412345678\",,\"20/05/01,10:37:28+40\"",
+				"hello",
+			},
+			tpdu.Address{Addr: "61412345678", TOA: 0x91},
+			0,
+			[]byte("hello"),
+			nil,
+			nil,
+		},
+		{
+			"ucs2",
+			[]string{
+				"+CMT: \"0412345678\",,\"20/05/01,10:37:28+40\",129,4,0,8,\"+61418706700\",145,4",
+				"00680069",
+			},
+			tpdu.Address{Addr: "0412345678", TOA: 0x81},
+			0x08,
+			[]byte{0, 'h', 0, 'i'},
+			nil,
+			nil,
+		},
+		{
+			"udh",
+			[]string{
+				"+CMT: \"+1234\",,\"20/05/01,10:37:28+40\",145,64,0,0,\"+61418706700\",145,13",
+				"050003420201d06536fb0d02",
+			},
+			tpdu.Address{Addr: "1234", TOA: 0x91},
+			0,
+			[]byte("hello "),
+			tpdu.UserDataHeader{{ID: 0, Data: []byte{0x42, 2, 1}}},
+			nil,
+		},
+		{
+			"udh spare septet",
+			[]string{
+				"+CMT: \"+1234\",,\"20/05/01,10:37:28+40\",145,64,0,0,\"+61418706700\",145,15",
+				"050003420202c2e231b96c3ea301",
+			},
+			tpdu.Address{Addr: "1234", TOA: 0x91},
+			0,
+			[]byte("abcdefgh"),
+			tpdu.UserDataHeader{{ID: 0, Data: []byte{0x42, 2, 2}}},
+			nil,
+		},
+		{
+			"udh bad length",
+			[]string{
+				"+CMT: \"+1234\",,\"20/05/01,10:37:28+40\",145,64,0,0,\"+61418706700\",145,x",
+				"050003420202c2e231b96c3ea301",
+			},
+			tpdu.Address{},
+			0,
+			nil,
+			nil,
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"underlength",
+			[]string{"+CMT: \"+1234\",,\"20/05/01,10:37:28+40\""},
+			tpdu.Address{},
+			0,
+			nil,
+			nil,
+			gsm.ErrUnderlength,
+		},
+		{
+			"bad scts",
+			[]string{"+CMT: \"+1234\",,\"20/05/01\"", "hello"},
+			tpdu.Address{},
+			0,
+			nil,
+			nil,
+			gsm.ErrMalformedResponse,
+		},
+		{
+			"bad header",
+			[]string{
+				"+CMT: \"+1234\",,\"20/05/01,10:37:28+40\",145,x,0,0,\"+61418706700\",145,5",
+				"hello",
+			},
+			tpdu.Address{},
+			0,
+			nil,
+			nil,
+			gsm.ErrMalformedResponse,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			tp, err := gsm.UnmarshalTextTPDU(p.info)
+			assert.Equal(t, p.err, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, p.oa, tp.OA)
+			assert.Equal(t, p.dcs, tp.DCS)
+			assert.Equal(t, p.ud, []byte(tp.UD))
+			assert.Equal(t, p.udh, tp.UDH)
+			assert.True(t, scts.Equal(tp.SCTS.Time))
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestStartMessageRxTextMode(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CSDH=1\r\n":         {"\r\nOK\r\n"},
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+		"AT+CMGR=3\r\n": {
+			"+CMGR: \"REC UNREAD\",\"+1234\",,\"20/05/01,10:37:28+40\",145,4,0,0,\"+61418706700\",145,6\r\n",
+			"stored\r\n",
+			"\r\nOK\r\n",
+		},
+	}
+	g, mm := setupModem(t, cmdSet, gsm.WithTextMode)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		t.Errorf("error received: %v", err)
+	}
+	err := g.StartMessageRx(mh, eh)
+	require.Nil(t, err)
+	cmds := mm.written()
+	assert.Contains(t, cmds, "AT+CSDH=1\r\n")
+
+	rx := func() gsm.Message {
+		select {
+		case msg := <-msgChan:
+			return msg
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("no message received")
+		}
+		return gsm.Message{}
+	}
+
+	mm.r <- []byte("+CMT: \"+61412345678\",,\"20/05/01,10:37:28+40\",145,4,0,0,\"+61418706700\",145,5\r\nhello\r\n")
+	msg := rx()
+	assert.Equal(t, "+61412345678", msg.Number)
+	assert.Equal(t, "hello", msg.Message)
+	assert.Equal(t, gsm.Acked, msg.Ack)
+
+	// concatenated
+	mm.r <- []byte("+CMT: \"+1234\",,\"20/05/01,10:37:28+40\",145,64,0,0,\"+61418706700\",145,13\r\n050003420201d06536fb0d02\r\n")
+	mm.r <- []byte("+CMT: \"+1234\",,\"20/05/01,10:37:28+40\",145,64,0,0,\"+61418706700\",145,12\r\n050003420202ee6f399b0c\r\n")
+	msg = rx()
+	assert.Equal(t, "hello world", msg.Message)
+	assert.Equal(t, 2, msg.Segments)
+
+	// stored
+	mm.r <- []byte("+CMTI: \"SM\",3\r\n")
+	msg = rx()
+	assert.Equal(t, "stored", msg.Message)
+	assert.Equal(t, []gsm.StorageSlot{{Storage: "SM", Index: 3}}, msg.Slots)
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"errors"
+
+	"github.com/warthog618/modem/at"
+)
+
+type tracerOption struct {
+	t at.Tracer
+}
+
+func (o tracerOption) applyOption(g *GSM) {
+	g.tracer = o.t
+}
+
+// WithTracer specifies a tracer to create spans for the SMS send and receive
+// pipelines.
+//
+// Sends are traced as "SMS send" spans, with the following attributes:
+//
+//	sms.parts     the number of PDUs the message was encoded into
+//	sms.mr        the mr returned by the modem for each part sent
+//	sms.cms_error the CMS error returned by the modem, if any
+//
+// Received messages are traced as "SMS receive" spans, with the following
+// attributes:
+//
+//	sms.indication the indication that delivered the PDU, +CMT or +CMTI, or
+//	               "stored" if passed in by ReceiveStoredPDU
+//	sms.complete   whether the PDU completed a message
+//
+// The individual commands can be traced by providing a tracer to the AT
+// driver using at.WithTracer.
+func WithTracer(t at.Tracer) Option {
+	return tracerOption{t}
+}
+
+// noSpan is used in place of a span when tracing is disabled.
+type noSpan struct{}
+
+func (noSpan) SetAttribute(key string, value interface{}) {}
+
+func (noSpan) End(err error) {}
+
+// startSpan starts a span, if a tracer is configured.
+func (g *GSM) startSpan(name string) at.Span {
+	if g.tracer == nil {
+		return noSpan{}
+	}
+	return g.tracer.Start(name)
+}
+
+// endSendSpan completes the span for a send.
+func endSendSpan(s at.Span, mr []string, err error) {
+	if len(mr) != 0 {
+		s.SetAttribute("sms.mr", mr)
+	}
+	var cms at.CMSError
+	if errors.As(err, &cms) {
+		s.SetAttribute("sms.cms_error", string(cms))
+	}
+	s.End(err)
+}
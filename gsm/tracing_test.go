@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+type span struct {
+	mu    sync.Mutex
+	name  string
+	attrs map[string]interface{}
+	ended bool
+	err   error
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+func (s *span) End(err error) {
+	s.mu.Lock()
+	s.ended = true
+	s.err = err
+	s.mu.Unlock()
+}
+
+type tracer struct {
+	mu    sync.Mutex
+	spans []*span
+}
+
+func (t *tracer) Start(name string) at.Span {
+	s := &span{name: name, attrs: map[string]interface{}{}}
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return s
+}
+
+func (t *tracer) last() *span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.spans) == 0 {
+		return nil
+	}
+	return t.spans[len(t.spans)-1]
+}
+
+func TestTracerSend(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMGS=\"+123456789\"\r":        {"\n>"},
+		"AT+CMGS=\"+1234\"\r":             {"\r\n+CMS ERROR: 304\r\n"},
+		"test message" + string(rune(26)): {"\r\n", "+CMGS: 42\r\n", "\r\nOK\r\n"},
+	}
+	tr := &tracer{}
+	g, mm := setupModem(t, cmdSet, gsm.WithTextMode, gsm.WithTracer(tr))
+	defer teardownModem(mm)
+
+	mr, err := g.SendShortMessage("+123456789", "test message")
+	require.Nil(t, err)
+	assert.Equal(t, "42", mr)
+	s := tr.last()
+	require.NotNil(t, s)
+	assert.Equal(t, "SMS send", s.name)
+	assert.True(t, s.ended)
+	assert.Nil(t, s.err)
+	assert.Equal(t, 1, s.attrs["sms.parts"])
+	assert.Equal(t, []string{"42"}, s.attrs["sms.mr"])
+
+	_, err = g.SendShortMessage("+1234", "test message")
+	require.Equal(t, at.CMSError("304"), err)
+	s = tr.last()
+	assert.Equal(t, at.CMSError("304"), s.err)
+	assert.Equal(t, "304", s.attrs["sms.cms_error"])
+	assert.Nil(t, s.attrs["sms.mr"])
+
+	// long messages need PDU mode
+	_, err = g.SendLongMessage("+123456789", "test message")
+	require.Equal(t, gsm.ErrWrongMode, err)
+	s = tr.last()
+	assert.Equal(t, gsm.ErrWrongMode, s.err)
+	assert.Len(t, tr.spans, 3)
+}
+
+func TestTracerReceive(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+	}
+	tr := &tracer{}
+	g, mm := setupModem(t, cmdSet, gsm.WithTracer(tr))
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 1)
+	errChan := make(chan error, 1)
+	err := g.StartMessageRx(
+		func(m gsm.Message) { msgChan <- m },
+		func(err error) { errChan <- err })
+	require.Nil(t, err)
+
+	mm.r <- []byte("+CMT: ,24\r\n00040B911234567890F000000250100173832305C8329BFD06\r\n")
+	select {
+	case m := <-msgChan:
+		assert.Equal(t, "Hello", m.Message)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no message received")
+	}
+	s := tr.last()
+	require.NotNil(t, s)
+	assert.Equal(t, "SMS receive", s.name)
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.ended
+	}, 100*time.Millisecond, time.Millisecond)
+	s.mu.Lock()
+	assert.Nil(t, s.err)
+	assert.Equal(t, "+CMT", s.attrs["sms.indication"])
+	assert.Equal(t, true, s.attrs["sms.complete"])
+	s.mu.Unlock()
+
+	mm.r <- []byte("+CMT: ,2X\r\n00040B911234567JUNK000000250100173832305C8329BFD06\r\n")
+	select {
+	case err := <-errChan:
+		assert.IsType(t, gsm.ErrUnmarshal{}, err)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no error received")
+	}
+	s = tr.last()
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.ended
+	}, 100*time.Millisecond, time.Millisecond)
+	s.mu.Lock()
+	assert.IsType(t, gsm.ErrUnmarshal{}, s.err)
+	s.mu.Unlock()
+}
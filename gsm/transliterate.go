@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"strings"
+
+	"github.com/warthog618/sms/encoding/gsm7"
+)
+
+// transliterations maps common characters outside the GSM 7-bit default
+// alphabet, and its extension table, to equivalents within it.
+//
+// Characters already in the alphabet, such as é and Ä, are not included.
+var transliterations = map[rune]string{
+	// quotes
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '′': "'", '`': "'",
+	'“': "\"", '”': "\"", '„': "\"", '‟': "\"", '″': "\"",
+	'«': "\"", '»': "\"", '‹': "'", '›': "'",
+
+	// dashes and spaces
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '―': "-", '−': "-",
+	'\u00a0': " ", '\u2002': " ", '\u2003': " ", '\u2009': " ", '\u202f': " ",
+	'\t': " ",
+
+	// punctuation and symbols
+	'…': "...", '•': "*", '·': ".", '×': "x", '÷': "/", '©': "(c)", '®': "(R)",
+	'™': "TM", '¢': "c", '¦': "|", '´': "'", '¨': "\"", '˜': "~",
+
+	// accented letters
+	'á': "a", 'â': "a", 'ã': "a", 'ā': "a", 'ą': "a", 'ă': "a",
+	'Á': "A", 'À': "A", 'Â': "A", 'Ã': "A", 'Ā': "A", 'Ą': "A", 'Ă': "A",
+	'ç': "Ç", 'ć': "c", 'č': "c", 'Ć': "C", 'Č': "C",
+	'ď': "d", 'đ': "d", 'Ď': "D", 'Đ': "D",
+	'ê': "e", 'ë': "e", 'ē': "e", 'ę': "e", 'ě': "e",
+	'Ê': "E", 'Ë': "E", 'È': "E", 'Ē': "E", 'Ę': "E", 'Ě': "E",
+	'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i",
+	'Í': "I", 'Ì': "I", 'Î': "I", 'Ï': "I", 'Ī': "I", 'İ': "I",
+	'ł': "l", 'ľ': "l", 'Ł': "L", 'Ľ': "L",
+	'ń': "n", 'ň': "n", 'Ń': "N", 'Ň': "N",
+	'ó': "o", 'ô': "o", 'õ': "o", 'ō': "o", 'ő': "o",
+	'Ó': "O", 'Ò': "O", 'Ô': "O", 'Õ': "O", 'Ō': "O", 'Ő': "O",
+	'œ': "oe", 'Œ': "OE",
+	'ř': "r", 'Ř': "R",
+	'ś': "s", 'š': "s", 'ş': "s", 'Ś': "S", 'Š': "S", 'Ş': "S",
+	'ť': "t", 'ţ': "t", 'Ť': "T", 'Ţ': "T",
+	'ú': "u", 'û': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'Ú': "U", 'Ù': "U", 'Û': "U", 'Ū': "U", 'Ů': "U", 'Ű': "U",
+	'ý': "y", 'ÿ': "y", 'Ý': "Y", 'Ÿ': "Y",
+	'ź': "z", 'ż': "z", 'ž': "z", 'Ź': "Z", 'Ż': "Z", 'Ž': "Z",
+}
+
+// Transliterate replaces common characters that are outside the GSM 7-bit
+// alphabet, such as smart quotes, dashes and accented letters, with their
+// closest equivalents within it.
+//
+// Characters with no equivalent are left unaltered.
+func Transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if t, ok := transliterations[r]; ok {
+			b.WriteString(t)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+type transliterationOption bool
+
+func (o transliterationOption) applyOption(g *GSM) {
+	g.translit = bool(o)
+}
+
+// WithTransliteration specifies that text messages are transliterated to the
+// GSM 7-bit alphabet before being sent, so a message that is essentially
+// ASCII, but contains a stray smart quote or accented letter, is not sent in
+// UCS-2, which would triple the number of segments required.
+//
+// The transliteration is only applied if it makes the whole message
+// encodable in the 7-bit alphabet.  Messages with characters that have no
+// equivalent, such as CJK, are sent unaltered in UCS-2.
+func WithTransliteration() Option {
+	return transliterationOption(true)
+}
+
+// text returns the text of a message to be sent, transliterated to the GSM
+// 7-bit alphabet if enabled and if that makes it encodable in that alphabet.
+func (g *GSM) text(message string) string {
+	if !g.translit {
+		return message
+	}
+	t := Transliterate(message)
+	if _, err := gsm7.Encode([]byte(t)); err != nil {
+		return message
+	}
+	return t
+}
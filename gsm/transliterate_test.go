@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/gsm7"
+)
+
+func TestTransliterate(t *testing.T) {
+	patterns := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{"empty", "", ""},
+		{"ascii", "hello world", "hello world"},
+		{"quotes", "‘it’s’ “quoted”", "'it's' \"quoted\""},
+		{"dashes", "a–b—c", "a-b-c"},
+		{"ellipsis", "wait…", "wait..."},
+		{"nbsp", "10 km", "10 km"},
+		{"accents", "Crème brûlée à São Paulo", "Crème brulée à Sao Paulo"},
+		{"gsm7 untouched", "ÄÖÜäöüßéèÇ€", "ÄÖÜäöüßéèÇ€"},
+		{"no equivalent", "你好 “x”", "你好 \"x\""},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			assert.Equal(t, p.out, gsm.Transliterate(p.in))
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestTransliterateIsGSM7(t *testing.T) {
+	in := "‘’‚‛′`“”„‟″«»‹›‐‑‒–—―−     \t…•·×÷©®™¢¦´¨˜" +
+		"áâãāąăÁÀÂÃĀĄĂçćčĆČďđĎĐêëēęěÊËÈĒĘĚíîïīıÍÌÎÏĪİłľŁĽńňŃŇ" +
+		"óôõōőÓÒÔÕŌŐœŒřŘśšşŚŠŞťţŤŢúûūůűÚÙÛŪŮŰýÿÝŸźżžŹŻŽ"
+	_, err := gsm7.Encode([]byte(gsm.Transliterate(in)))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/warthog618/modem/info"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// VoicemailWaiting indicates a change in the voicemail waiting state.
+type VoicemailWaiting struct {
+	// Active indicates whether voicemail is waiting.
+	Active bool
+
+	// Count is the number of voicemail messages waiting, if known, else 0.
+	Count int
+
+	// Line identifies the line, or subscriber profile, the indication applies
+	// to, numbered from 1.
+	Line int
+}
+
+// VoicemailHandler receives voicemail waiting indications.
+type VoicemailHandler func(VoicemailWaiting)
+
+type voicemailOption VoicemailHandler
+
+func (o voicemailOption) applyRxOption(c *rxConfig) {
+	c.vmh = VoicemailHandler(o)
+}
+
+// WithVoicemailHandler specifies a handler for voicemail waiting indications.
+//
+// Indications are decoded from the DCS message waiting groups and from the
+// special SMS message indication in the UDH of received messages, as well as
+// from +CIEV "message" indicators.
+//
+// Messages that indicate they are to be discarded once the indication has
+// been extracted are not passed to the message handler.
+func WithVoicemailHandler(h VoicemailHandler) RxOption {
+	return voicemailOption(h)
+}
+
+const (
+	// the UDH IE identifier for a special SMS message indication.
+	ieSpecialSMS = 0x01
+
+	// the special SMS message type for voicemail.
+	mwiVoicemail = 0
+)
+
+// voicemailWaiting extracts any voicemail waiting indication from the TPDU.
+//
+// The discard return value indicates that the message content is to be
+// discarded.
+func voicemailWaiting(t *tpdu.TPDU) (vmw *VoicemailWaiting, discard bool) {
+	if ie, ok := t.UDH.IE(ieSpecialSMS); ok && len(ie.Data) >= 2 {
+		discard = ie.Data[0]&0x80 == 0
+		if ie.Data[0]&0x03 == mwiVoicemail {
+			vmw = &VoicemailWaiting{
+				Active: ie.Data[1] != 0,
+				Count:  int(ie.Data[1]),
+				Line:   int(ie.Data[0]>>5&0x03) + 1,
+			}
+		}
+		return
+	}
+	// DCS message waiting indication groups - 1100, 1101 and 1110
+	switch t.DCS & 0xf0 {
+	case 0xc0:
+		discard = true
+	case 0xd0, 0xe0:
+	default:
+		return
+	}
+	if t.DCS&0x03 == mwiVoicemail {
+		vmw = &VoicemailWaiting{
+			Active: t.DCS&0x08 != 0,
+			Line:   1,
+		}
+	}
+	return
+}
+
+// cindIndex returns the index of the named indicator in a +CIND=? response.
+//
+// The response is of the form:
+//
+//	+CIND: ("battchg",(0-5)),("signal",(0-5)),("message",(0-1))
+//
+// The index is numbered from 1, as per +CIEV, and 0 indicates the indicator
+// was not found.
+func cindIndex(i []string, name string) int {
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CIND") {
+			continue
+		}
+		inds := strings.Split(info.TrimPrefix(l, "+CIND"), "),(")
+		for n, ind := range inds {
+			ind = strings.TrimLeft(ind, "(")
+			if strings.HasPrefix(ind, "\""+name+"\"") {
+				return n + 1
+			}
+		}
+	}
+	return 0
+}
+
+// parseCIEV parses the indicator index and value from a +CIEV indication.
+//
+// The indication is of the form:
+//
+//	+CIEV: <ind>,<value>
+func parseCIEV(line string) (ind int, value int, err error) {
+	fields := info.Fields(info.TrimPrefix(line, "+CIEV"))
+	if len(fields) < 2 {
+		err = ErrMalformedResponse
+		return
+	}
+	if ind, err = strconv.Atoi(fields[0]); err != nil {
+		return
+	}
+	value, err = strconv.Atoi(fields[1])
+	return
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package gsm_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func cmtIndication(t *testing.T, tp tpdu.TPDU) string {
+	b, err := tp.MarshalBinary()
+	require.Nil(t, err)
+	return fmt.Sprintf("+CMT: ,%d\r\n00%s\r\n", len(b), hex.EncodeToString(b))
+}
+
+func TestWithVoicemailHandler(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CNMI=1,2,0,0,0\r\n": {"\r\nOK\r\n"},
+		"AT+CNMA\r\n":           {"\r\nOK\r\n"},
+		"AT+CIND=?\r\n": {
+			"+CIND: (\"battchg\",(0-5)),(\"signal\",(0-5)),(\"message\",(0-1))\r\n",
+			"\r\nOK\r\n",
+		},
+		"AT+CMER=3,0,0,1\r\n": {"\r\nOK\r\n"},
+	}
+	g, mm := setupModem(t, cmdSet)
+	defer teardownModem(mm)
+
+	msgChan := make(chan gsm.Message, 3)
+	vmChan := make(chan gsm.VoicemailWaiting, 3)
+	mh := func(msg gsm.Message) {
+		msgChan <- msg
+	}
+	eh := func(err error) {
+		t.Errorf("error received: %v", err)
+	}
+	vmh := func(vmw gsm.VoicemailWaiting) {
+		vmChan <- vmw
+	}
+	err := g.StartMessageRx(mh, eh, gsm.WithVoicemailHandler(vmh))
+	require.Nil(t, err)
+
+	oa := tpdu.Address{Addr: "1234", TOA: 0x91}
+	patterns := []struct {
+		name string
+		rx   string
+		vmw  *gsm.VoicemailWaiting
+		msg  bool
+	}{
+		{
+			"dcs discard active",
+			cmtIndication(t, tpdu.TPDU{OA: oa, DCS: 0xc8, UD: []byte("vm")}),
+			&gsm.VoicemailWaiting{Active: true, Line: 1},
+			false,
+		},
+		{
+			"dcs store inactive",
+			cmtIndication(t, tpdu.TPDU{OA: oa, DCS: 0xd0, UD: []byte("vm")}),
+			&gsm.VoicemailWaiting{Line: 1},
+			true,
+		},
+		{
+			"dcs fax",
+			cmtIndication(t, tpdu.TPDU{OA: oa, DCS: 0xd9, UD: []byte("fax")}),
+			nil,
+			true,
+		},
+		{
+			"udh store",
+			cmtIndication(t, tpdu.TPDU{
+				FirstOctet: tpdu.FoUDHI,
+				OA:         oa,
+				UDH: tpdu.UserDataHeader{
+					tpdu.InformationElement{ID: 1, Data: []byte{0xa0, 3}},
+				},
+				UD: []byte("vm")}),
+			&gsm.VoicemailWaiting{Active: true, Count: 3, Line: 2},
+			true,
+		},
+		{
+			"udh discard",
+			cmtIndication(t, tpdu.TPDU{
+				FirstOctet: tpdu.FoUDHI,
+				OA:         oa,
+				UDH: tpdu.UserDataHeader{
+					tpdu.InformationElement{ID: 1, Data: []byte{0x00, 0}},
+				},
+				UD: []byte("vm")}),
+			&gsm.VoicemailWaiting{Line: 1},
+			false,
+		},
+		{
+			"plain",
+			cmtIndication(t, tpdu.TPDU{OA: oa, UD: []byte("hello")}),
+			nil,
+			true,
+		},
+		{
+			"ciev",
+			"+CIEV: 3,1\r\n",
+			&gsm.VoicemailWaiting{Active: true, Line: 1},
+			false,
+		},
+		{
+			"ciev other",
+			"+CIEV: 2,1\r\n",
+			nil,
+			false,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			mm.r <- []byte(p.rx)
+			if p.vmw != nil {
+				select {
+				case vmw := <-vmChan:
+					assert.Equal(t, *p.vmw, vmw)
+				case <-time.After(100 * time.Millisecond):
+					t.Errorf("no voicemail indication received")
+				}
+			}
+			select {
+			case <-msgChan:
+				assert.True(t, p.msg)
+			case vmw := <-vmChan:
+				t.Errorf("unexpected voicemail indication: %v", vmw)
+			case <-time.After(50 * time.Millisecond):
+				assert.False(t, p.msg)
+			}
+		}
+		t.Run(p.name, f)
+	}
+}
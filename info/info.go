@@ -19,3 +19,34 @@ func HasPrefix(line, cmd string) bool {
 func TrimPrefix(line, cmd string) string {
 	return strings.TrimLeft(strings.TrimPrefix(line, cmd+":"), " ")
 }
+
+// Fields splits the info line into its comma separated fields.
+//
+// Commas within quoted strings do not separate fields, and any surrounding
+// quotes and space are removed from the returned fields.
+func Fields(line string) []string {
+	var fields []string
+	quoted := false
+	start := 0
+	for i, c := range line {
+		switch c {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				fields = append(fields, unquote(line[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, unquote(line[start:]))
+}
+
+// unquote removes any surrounding space and quotes from the field.
+func unquote(field string) string {
+	field = strings.TrimSpace(field)
+	if len(field) >= 2 && field[0] == '"' && field[len(field)-1] == '"' {
+		return field[1 : len(field)-1]
+	}
+	return field
+}
@@ -30,3 +30,24 @@ func TestTrimPrefix(t *testing.T) {
 	i = info.TrimPrefix("cmd: info line", "cmd")
 	assert.Equal(t, "info line", i)
 }
+
+func TestFields(t *testing.T) {
+	patterns := []struct {
+		name   string
+		line   string
+		fields []string
+	}{
+		{"empty", "", []string{""}},
+		{"one", "1", []string{"1"}},
+		{"several", "1,2,,3", []string{"1", "2", "", "3"}},
+		{"quoted", "\"SM\",3,\"ME\"", []string{"SM", "3", "ME"}},
+		{"quoted comma", "\"Smith, J\",\"+1234\",145", []string{"Smith, J", "+1234", "145"}},
+		{"spaces", " 1, \"a\" ", []string{"1", "a"}},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			assert.Equal(t, p.fields, info.Fields(p.line))
+		}
+		t.Run(p.name, f)
+	}
+}
@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package mailbridge
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// ServeLMTP accepts LMTP connections on the listener, and sends the emails
+// delivered over those connections as SMS.
+//
+// Only recipients that map to a number are accepted.  As per LMTP, the
+// result of sending to each recipient is reported separately.
+//
+// The SMS contains the subject of the email, if any, followed by the first
+// text/plain part of the body.
+//
+// Returns when the listener is closed.
+func (b *Bridge) ServeLMTP(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go b.serveConn(c)
+	}
+}
+
+func (b *Bridge) serveConn(c net.Conn) {
+	defer c.Close()
+	tc := textproto.NewConn(c)
+	tc.PrintfLine("220 %s LMTP ready", b.hostname)
+	var rcpts []string
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if idx := strings.Index(line, " "); idx != -1 {
+			verb, arg = line[:idx], line[idx+1:]
+		}
+		switch strings.ToUpper(verb) {
+		case "LHLO":
+			tc.PrintfLine("250-%s", b.hostname)
+			tc.PrintfLine("250-8BITMIME")
+			tc.PrintfLine("250 ENHANCEDSTATUSCODES")
+		case "MAIL":
+			rcpts = nil
+			tc.PrintfLine("250 2.1.0 OK")
+		case "RCPT":
+			addr, ok := parsePath(arg, "TO:")
+			if !ok {
+				tc.PrintfLine("501 5.5.4 Syntax error")
+				continue
+			}
+			if _, ok := b.number(addr); !ok {
+				tc.PrintfLine("550 5.1.1 No such user")
+				continue
+			}
+			rcpts = append(rcpts, addr)
+			tc.PrintfLine("250 2.1.5 OK")
+		case "DATA":
+			if len(rcpts) == 0 {
+				tc.PrintfLine("503 5.5.1 No valid recipients")
+				continue
+			}
+			tc.PrintfLine("354 Start mail input; end with <CRLF>.<CRLF>")
+			text, err := messageText(tc.DotReader(), b.maxLen)
+			for _, r := range rcpts {
+				if err != nil {
+					tc.PrintfLine("554 5.6.0 %s", err)
+					continue
+				}
+				n, _ := b.number(r)
+				if _, err := b.s.SendLongMessage(n, text); err != nil {
+					tc.PrintfLine("451 4.3.0 %s", err)
+					continue
+				}
+				tc.PrintfLine("250 2.0.0 Sent to %s", n)
+			}
+			rcpts = nil
+		case "RSET":
+			rcpts = nil
+			tc.PrintfLine("250 2.0.0 OK")
+		case "NOOP":
+			tc.PrintfLine("250 2.0.0 OK")
+		case "QUIT":
+			tc.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			tc.PrintfLine("500 5.5.2 Unrecognised command")
+		}
+	}
+}
+
+// parsePath extracts the address from a MAIL or RCPT argument, e.g.
+// "TO:<user@example.com>".
+func parsePath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", false
+	}
+	end := strings.Index(arg, ">")
+	if end == -1 {
+		return "", false
+	}
+	return arg[1:end], true
+}
+
+// messageText extracts the text to be sent as SMS from an email.
+func messageText(r io.Reader, maxLen int) (string, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		// drain the remainder so the connection remains in sync.
+		io.Copy(ioutil.Discard, r)
+		return "", err
+	}
+	defer io.Copy(ioutil.Discard, m.Body)
+	body, err := textBody(m.Header.Get("Content-Type"),
+		m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	if err != nil {
+		return "", err
+	}
+	var dec mime.WordDecoder
+	subject, err := dec.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		subject = m.Header.Get("Subject")
+	}
+	text := strings.TrimSpace(strings.Replace(body, "\r\n", "\n", -1))
+	if subject = strings.TrimSpace(subject); subject != "" {
+		text = strings.TrimSpace(subject + "\n" + text)
+	}
+	if text == "" {
+		return "", ErrEmptyMessage
+	}
+	if r := []rune(text); len(r) > maxLen {
+		text = string(r[:maxLen])
+	}
+	return text, nil
+}
+
+// textBody returns the first text/plain part of the body.
+func textBody(ctype, cte string, r io.Reader) (string, error) {
+	if ctype == "" {
+		ctype = "text/plain"
+	}
+	mt, params, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(mt, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				return "", ErrNoTextBody
+			}
+			// the part reader decodes quoted-printable itself.
+			text, err := textBody(p.Header.Get("Content-Type"),
+				p.Header.Get("Content-Transfer-Encoding"), p)
+			if err == nil {
+				return text, nil
+			}
+		}
+	}
+	if mt != "text/plain" {
+		return "", ErrNoTextBody
+	}
+	switch strings.ToLower(cte) {
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, newlineStripper{r})
+	}
+	b, err := ioutil.ReadAll(r)
+	return string(b), err
+}
+
+// newlineStripper removes line breaks from base64 encoded bodies.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n newlineStripper) Read(p []byte) (int, error) {
+	for {
+		c, err := n.r.Read(p)
+		j := 0
+		for _, b := range p[:c] {
+			if b != '\r' && b != '\n' {
+				p[j] = b
+				j++
+			}
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
+var (
+	// ErrEmptyMessage indicates an email contained no text to be sent.
+	ErrEmptyMessage = errors.New("empty message")
+
+	// ErrNoTextBody indicates an email contained no text/plain body.
+	ErrNoTextBody = errors.New("no text/plain body")
+)
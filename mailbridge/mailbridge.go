@@ -0,0 +1,302 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package mailbridge bridges SMS and email, so the modem can act as an
+// alerting gateway.
+//
+// Received messages are forwarded as emails via SMTP, to the address mapped
+// from the sender's number, and emails delivered to the bridge via LMTP are
+// sent as SMS to the number mapped from the recipient's address.
+//
+//	b := mailbridge.New(modem,
+//		mailbridge.WithSMTP("mail.example.com:25", nil, "sms@example.com"),
+//		mailbridge.WithDefaultRecipient("ops@example.com"),
+//		mailbridge.WithDomain("sms.example.com"))
+//	modem.StartMessageRx(b.HandleMessage, eh)
+//	l, _ := net.Listen("tcp", "localhost:2424")
+//	b.ServeLMTP(l)
+//
+// With the configuration above, received messages are emailed to
+// ops@example.com, and an email to +61412345678@sms.example.com is sent as an
+// SMS to +61412345678.
+package mailbridge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+// Sender sends SMS messages, and is typically a *gsm.GSM.
+type Sender interface {
+	SendLongMessage(number string, message string, options ...at.CommandOption) ([]string, error)
+}
+
+// Mailer sends an email, with the same semantics as smtp.SendMail.
+type Mailer func(from string, to []string, msg []byte) error
+
+// ErrorHandler receives errors encountered forwarding received messages.
+type ErrorHandler func(error)
+
+// Bridge forwards messages between SMS and email.
+type Bridge struct {
+	s      Sender
+	mailer Mailer
+	from   string
+	eh     ErrorHandler
+
+	// inbound maps sender numbers to email recipients.
+	inbound map[string]string
+
+	// the recipient for senders not in inbound.
+	defRcpt string
+
+	// outbound maps email recipients to numbers.
+	outbound map[string]string
+
+	// the domain for addresses of the form <number>@<domain>.
+	domain string
+
+	// the maximum size of an outbound message, in characters.
+	maxLen int
+
+	hostname string
+}
+
+// Option is a construction option for the Bridge.
+type Option interface {
+	applyOption(*Bridge)
+}
+
+// New creates a new Bridge sending SMS using the Sender.
+func New(s Sender, options ...Option) *Bridge {
+	b := Bridge{
+		s:        s,
+		inbound:  make(map[string]string),
+		outbound: make(map[string]string),
+		maxLen:   480,
+		hostname: "localhost",
+	}
+	for _, option := range options {
+		option.applyOption(&b)
+	}
+	return &b
+}
+
+type smtpOption struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func (o smtpOption) applyOption(b *Bridge) {
+	b.from = o.from
+	b.mailer = func(from string, to []string, msg []byte) error {
+		return smtp.SendMail(o.addr, o.auth, from, to, msg)
+	}
+}
+
+// WithSMTP specifies the SMTP server used to forward received messages, and
+// the envelope sender of those emails.
+func WithSMTP(addr string, auth smtp.Auth, from string) Option {
+	return smtpOption{addr, auth, from}
+}
+
+type mailerOption struct {
+	m    Mailer
+	from string
+}
+
+func (o mailerOption) applyOption(b *Bridge) {
+	b.mailer = o.m
+	b.from = o.from
+}
+
+// WithMailer specifies the mailer used to forward received messages, and the
+// envelope sender of those emails, in place of WithSMTP.
+func WithMailer(m Mailer, from string) Option {
+	return mailerOption{m, from}
+}
+
+func (o ErrorHandler) applyOption(b *Bridge) {
+	b.eh = o
+}
+
+// WithErrorHandler specifies a handler for errors forwarding received
+// messages.
+//
+// By default errors are discarded.
+func WithErrorHandler(h ErrorHandler) Option {
+	return h
+}
+
+// Route maps a number to an email address.
+type Route struct {
+	Number string
+	Email  string
+}
+
+type routesOption []Route
+
+func (o routesOption) applyOption(b *Bridge) {
+	for _, r := range o {
+		b.inbound[r.Number] = r.Email
+		b.outbound[strings.ToLower(r.Email)] = r.Number
+	}
+}
+
+// WithRoutes specifies the mapping between numbers and email addresses.
+//
+// Messages received from a number are forwarded to its email address, and
+// emails sent to the address are sent to the number.
+func WithRoutes(routes ...Route) Option {
+	return routesOption(routes)
+}
+
+type defaultRecipientOption string
+
+func (o defaultRecipientOption) applyOption(b *Bridge) {
+	b.defRcpt = string(o)
+}
+
+// WithDefaultRecipient specifies the email address that messages received
+// from numbers without a route are forwarded to.
+//
+// By default such messages are dropped and ErrNoRoute passed to the error
+// handler.
+func WithDefaultRecipient(addr string) Option {
+	return defaultRecipientOption(addr)
+}
+
+type domainOption string
+
+func (o domainOption) applyOption(b *Bridge) {
+	b.domain = strings.ToLower(string(o))
+}
+
+// WithDomain specifies a domain for which emails addressed to
+// <number>@<domain> are sent to the number, without requiring a route.
+func WithDomain(domain string) Option {
+	return domainOption(domain)
+}
+
+type maxLengthOption int
+
+func (o maxLengthOption) applyOption(b *Bridge) {
+	b.maxLen = int(o)
+}
+
+// WithMaxLength specifies the maximum length of SMS sent from emails, in
+// characters.  Longer emails are truncated.
+//
+// The default is 480, i.e. around 3 segments.
+func WithMaxLength(n int) Option {
+	return maxLengthOption(n)
+}
+
+type hostnameOption string
+
+func (o hostnameOption) applyOption(b *Bridge) {
+	b.hostname = string(o)
+}
+
+// WithHostname specifies the hostname the LMTP server identifies as.
+//
+// The default is "localhost".
+func WithHostname(h string) Option {
+	return hostnameOption(h)
+}
+
+// HandleMessage forwards a received message as an email.
+//
+// It can be passed directly to StartMessageRx as the message handler.
+func (b *Bridge) HandleMessage(m gsm.Message) {
+	if err := b.Forward(m); err != nil && b.eh != nil {
+		b.eh(err)
+	}
+}
+
+// Forward forwards a received message as an email.
+func (b *Bridge) Forward(m gsm.Message) error {
+	if b.mailer == nil {
+		return ErrNoMailer
+	}
+	to, ok := b.inbound[m.Number]
+	if !ok {
+		to = b.defRcpt
+	}
+	if to == "" {
+		return ErrNoRoute
+	}
+	from := b.from
+	if b.domain != "" && m.Number != "" {
+		from = m.Number + "@" + b.domain
+	}
+	ts := m.SCTS.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "SMS from "+m.Number))
+	fmt.Fprintf(&msg, "Date: %s\r\n", ts.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.Replace(m.Message, "\n", "\r\n", -1))
+	msg.WriteString("\r\n")
+	return b.mailer(b.from, []string{to}, msg.Bytes())
+}
+
+// number returns the number an email recipient maps to.
+func (b *Bridge) number(rcpt string) (string, bool) {
+	rcpt = strings.ToLower(rcpt)
+	if n, ok := b.outbound[rcpt]; ok {
+		return n, true
+	}
+	if b.domain == "" {
+		return "", false
+	}
+	idx := strings.LastIndex(rcpt, "@")
+	if idx == -1 || rcpt[idx+1:] != b.domain {
+		return "", false
+	}
+	n := rcpt[:idx]
+	if !isNumber(n) {
+		return "", false
+	}
+	return n, true
+}
+
+func isNumber(n string) bool {
+	n = strings.TrimPrefix(n, "+")
+	if len(n) == 0 || len(n) > 20 {
+		return false
+	}
+	for _, r := range n {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	// ErrNoMailer indicates no SMTP server or mailer has been provided to
+	// forward received messages.
+	ErrNoMailer = errors.New("no mailer")
+
+	// ErrNoRoute indicates there is no email address for the sender of a
+	// received message.
+	ErrNoRoute = errors.New("no route")
+)
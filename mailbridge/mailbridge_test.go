@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package mailbridge_test
+
+import (
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/modem/mailbridge"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+type sent struct {
+	number  string
+	message string
+}
+
+type sender struct {
+	mu   sync.Mutex
+	sent []sent
+	err  error
+}
+
+func (s *sender) SendLongMessage(number string, message string, options ...at.CommandOption) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.sent = append(s.sent, sent{number, message})
+	return []string{"1"}, nil
+}
+
+type mail struct {
+	from string
+	to   []string
+	msg  string
+}
+
+type mailer struct {
+	mails []mail
+	err   error
+}
+
+func (m *mailer) send(from string, to []string, msg []byte) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.mails = append(m.mails, mail{from, to, string(msg)})
+	return nil
+}
+
+func TestForward(t *testing.T) {
+	ml := &mailer{}
+	var errs []error
+	eh := func(err error) {
+		errs = append(errs, err)
+	}
+	b := mailbridge.New(&sender{},
+		mailbridge.WithMailer(ml.send, "gateway@example.com"),
+		mailbridge.WithRoutes(mailbridge.Route{Number: "+1234", Email: "alice@example.com"}),
+		mailbridge.WithErrorHandler(eh))
+
+	scts := tpdu.Timestamp{Time: time.Date(2020, 5, 1, 10, 37, 38, 0, time.UTC)}
+	b.HandleMessage(gsm.Message{Number: "+1234", Message: "hello\nworld", SCTS: scts})
+	require.Len(t, ml.mails, 1)
+	m := ml.mails[0]
+	assert.Equal(t, "gateway@example.com", m.from)
+	assert.Equal(t, []string{"alice@example.com"}, m.to)
+	assert.Contains(t, m.msg, "From: gateway@example.com\r\n")
+	assert.Contains(t, m.msg, "To: alice@example.com\r\n")
+	assert.Contains(t, m.msg, "Subject: SMS from +1234\r\n")
+	assert.Contains(t, m.msg, "Date: Fri, 01 May 2020 10:37:38 +0000\r\n")
+	assert.True(t, strings.HasSuffix(m.msg, "\r\n\r\nhello\r\nworld\r\n"))
+
+	// no route
+	b.HandleMessage(gsm.Message{Number: "+5678", Message: "hello"})
+	assert.Equal(t, []error{mailbridge.ErrNoRoute}, errs)
+	assert.Len(t, ml.mails, 1)
+
+	// default recipient, with domain
+	b = mailbridge.New(&sender{},
+		mailbridge.WithMailer(ml.send, "gateway@example.com"),
+		mailbridge.WithDefaultRecipient("ops@example.com"),
+		mailbridge.WithDomain("sms.example.com"))
+	err := b.Forward(gsm.Message{Number: "+5678", Message: "hello"})
+	require.Nil(t, err)
+	require.Len(t, ml.mails, 2)
+	m = ml.mails[1]
+	assert.Equal(t, []string{"ops@example.com"}, m.to)
+	assert.Contains(t, m.msg, "From: +5678@sms.example.com\r\n")
+
+	// mailer error
+	ml.err = errors.New("smtp failed")
+	err = b.Forward(gsm.Message{Number: "+5678", Message: "hello"})
+	assert.Equal(t, ml.err, err)
+
+	// no mailer
+	b = mailbridge.New(&sender{}, mailbridge.WithDefaultRecipient("ops@example.com"))
+	err = b.Forward(gsm.Message{Number: "+5678", Message: "hello"})
+	assert.Equal(t, mailbridge.ErrNoMailer, err)
+}
+
+func TestServeLMTP(t *testing.T) {
+	s := &sender{}
+	b := mailbridge.New(s,
+		mailbridge.WithRoutes(mailbridge.Route{Number: "+1234", Email: "Alice@example.com"}),
+		mailbridge.WithDomain("sms.example.com"),
+		mailbridge.WithHostname("gw.example.com"),
+		mailbridge.WithMaxLength(20))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	done := make(chan error)
+	go func() {
+		done <- b.ServeLMTP(l)
+	}()
+	defer func() {
+		l.Close()
+		<-done
+	}()
+	c, err := textproto.Dial("tcp", l.Addr().String())
+	require.Nil(t, err)
+	defer c.Close()
+
+	expect := func(code int, cmd string) string {
+		t.Helper()
+		if cmd != "" {
+			require.Nil(t, c.PrintfLine("%s", cmd))
+		}
+		_, msg, err := c.ReadResponse(code)
+		require.Nil(t, err, cmd)
+		return msg
+	}
+	assert.Equal(t, "gw.example.com LMTP ready", expect(220, ""))
+	assert.Contains(t, expect(250, "LHLO client"), "gw.example.com")
+	expect(503, "DATA")
+	expect(250, "MAIL FROM:<monitor@example.com>")
+	expect(250, "RCPT TO:<alice@example.com>")
+	expect(250, "RCPT TO:<+5678@sms.example.com>")
+	expect(550, "RCPT TO:<bob@example.com>")
+	expect(550, "RCPT TO:<abc@sms.example.com>")
+	expect(501, "RCPT bob")
+	expect(354, "DATA")
+	w := c.DotWriter()
+	w.Write([]byte("From: monitor@example.com\r\nSubject: =?utf-8?q?Disk_full?=\r\n\r\n/var is 100% used on host db1\r\n"))
+	require.Nil(t, w.Close())
+	assert.Equal(t, "2.0.0 Sent to +1234", expect(250, ""))
+	assert.Equal(t, "2.0.0 Sent to +5678", expect(250, ""))
+
+	// multipart quoted-printable, and send failure
+	expect(250, "RSET")
+	expect(250, "MAIL FROM:<monitor@example.com>")
+	expect(250, "RCPT TO:<+5678@sms.example.com>")
+	expect(354, "DATA")
+	w = c.DotWriter()
+	w.Write([]byte("Content-Type: multipart/alternative; boundary=XX\r\n\r\n" +
+		"--XX\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n" +
+		"--XX\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nplain=20text\r\n" +
+		"--XX--\r\n"))
+	require.Nil(t, w.Close())
+	expect(250, "")
+
+	s.err = errors.New("no service")
+	expect(250, "MAIL FROM:<monitor@example.com>")
+	expect(250, "RCPT TO:<+5678@sms.example.com>")
+	expect(354, "DATA")
+	w = c.DotWriter()
+	w.Write([]byte("Subject: test\r\n\r\nbody\r\n"))
+	require.Nil(t, w.Close())
+	assert.Equal(t, "4.3.0 no service", expect(451, ""))
+
+	// no text body
+	s.err = nil
+	expect(250, "MAIL FROM:<monitor@example.com>")
+	expect(250, "RCPT TO:<+5678@sms.example.com>")
+	expect(354, "DATA")
+	w = c.DotWriter()
+	w.Write([]byte("Content-Type: image/png\r\n\r\nabc\r\n"))
+	require.Nil(t, w.Close())
+	expect(554, "")
+
+	expect(250, "NOOP")
+	expect(500, "HELO")
+	expect(221, "QUIT")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Equal(t, []sent{
+		{"+1234", "Disk full\n/var is 10"},
+		{"+5678", "Disk full\n/var is 10"},
+		{"+5678", "plain text"},
+	}, s.sent)
+}
@@ -0,0 +1,501 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package mmdbus exposes a modem on D-Bus using a minimal subset of the
+// org.freedesktop.ModemManager1 interfaces, so existing tooling that talks to
+// ModemManager can send and receive SMS via a modem driven by this module.
+//
+// The subset provided is:
+//
+//	org.freedesktop.DBus.ObjectManager on the manager object, listing the modem.
+//	org.freedesktop.ModemManager1.Modem identity and SignalQuality properties.
+//	org.freedesktop.ModemManager1.Modem.Messaging List, Create and Delete
+//	methods, the Messages property, and the Added and Deleted signals.
+//	org.freedesktop.ModemManager1.Sms Send method and message properties.
+//
+// e.g.
+//
+//	conn, _ := dbus.ConnectSystemBus()
+//	s, _ := mmdbus.New(conn, g, mmdbus.WithIdentity(mmdbus.Identity{Model: "EC25"}))
+//	conn.RequestName(mmdbus.BusName, dbus.NameFlagDoNotQueue)
+//	g.StartMessageRx(s.HandleMessage, eh)
+//
+// Note that ModemManager itself must not be running, as it owns the same bus
+// name.
+package mmdbus
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+const (
+	// BusName is the well-known name of ModemManager.
+	BusName = "org.freedesktop.ModemManager1"
+
+	// ManagerPath is the path of the manager object.
+	ManagerPath dbus.ObjectPath = "/org/freedesktop/ModemManager1"
+
+	// ModemInterface is the interface providing the modem properties.
+	ModemInterface = "org.freedesktop.ModemManager1.Modem"
+
+	// MessagingInterface is the interface providing the modem messaging.
+	MessagingInterface = "org.freedesktop.ModemManager1.Modem.Messaging"
+
+	// SmsInterface is the interface provided by each SMS object.
+	SmsInterface = "org.freedesktop.ModemManager1.Sms"
+
+	objectManagerInterface = "org.freedesktop.DBus.ObjectManager"
+)
+
+// SmsState is the state of an SMS, as per MMSmsState.
+type SmsState uint32
+
+const (
+	// SmsStateUnknown indicates an SMS created, but not yet sent.
+	SmsStateUnknown SmsState = 0
+
+	// SmsStateReceived indicates an SMS that has been received.
+	SmsStateReceived SmsState = 3
+
+	// SmsStateSending indicates an SMS that is being sent.
+	SmsStateSending SmsState = 4
+
+	// SmsStateSent indicates an SMS that has been sent.
+	SmsStateSent SmsState = 5
+)
+
+// SmsPduType is the type of an SMS, as per MMSmsPduType.
+type SmsPduType uint32
+
+const (
+	// SmsPduTypeDeliver indicates a received SMS.
+	SmsPduTypeDeliver SmsPduType = 1
+
+	// SmsPduTypeSubmit indicates an SMS to be sent.
+	SmsPduTypeSubmit SmsPduType = 2
+)
+
+// Modem is the modem exposed on D-Bus, and is typically a *gsm.GSM.
+type Modem interface {
+	SendLongMessage(number string, message string, options ...at.CommandOption) ([]string, error)
+	SignalQuality(options ...at.CommandOption) (rssi int, ber int, err error)
+}
+
+// Identity describes the modem, as reported in the Modem properties.
+type Identity struct {
+	Manufacturer        string
+	Model               string
+	Revision            string
+	EquipmentIdentifier string
+}
+
+// ErrorHandler receives errors emitting signals.
+type ErrorHandler func(error)
+
+// SignalQuality is the value of the Modem SignalQuality property.
+type SignalQuality struct {
+	// Quality is the signal quality, as a percentage.
+	Quality uint32
+
+	// Recent indicates the quality was recently updated.
+	Recent bool
+}
+
+// Server exposes a modem on D-Bus.
+type Server struct {
+	conn  *dbus.Conn
+	m     Modem
+	id    Identity
+	index int
+	eh    ErrorHandler
+	path  dbus.ObjectPath
+	props *properties
+
+	mu   sync.Mutex
+	next int
+	sms  map[dbus.ObjectPath]*sms
+}
+
+// Option is a construction option for the Server.
+type Option interface {
+	applyOption(*Server)
+}
+
+// New creates a Server exposing the modem on the connection.
+//
+// The objects are exported immediately, but the caller must request BusName
+// for clients to find them.
+func New(conn *dbus.Conn, m Modem, options ...Option) (*Server, error) {
+	s := Server{
+		conn: conn,
+		m:    m,
+		sms:  make(map[dbus.ObjectPath]*sms),
+	}
+	for _, option := range options {
+		option.applyOption(&s)
+	}
+	s.path = dbus.ObjectPath(fmt.Sprintf("%s/Modem/%d", ManagerPath, s.index))
+	s.props = newProperties(conn, s.path, map[string]map[string]interface{}{
+		ModemInterface: {
+			"Manufacturer":        s.id.Manufacturer,
+			"Model":               s.id.Model,
+			"Revision":            s.id.Revision,
+			"EquipmentIdentifier": s.id.EquipmentIdentifier,
+			"SignalQuality":       SignalQuality{},
+		},
+		MessagingInterface: {
+			"Messages":          []dbus.ObjectPath{},
+			"SupportedStorages": []uint32{},
+			"DefaultStorage":    uint32(0),
+		},
+	})
+	om := objectManager{&s}
+	mi := messaging{&s}
+	exports := []struct {
+		v     interface{}
+		path  dbus.ObjectPath
+		iface string
+	}{
+		{om, ManagerPath, objectManagerInterface},
+		{introspect.NewIntrospectable(&introspect.Node{
+			Name: string(ManagerPath),
+			Interfaces: []introspect.Interface{
+				introspect.IntrospectData,
+				{Name: objectManagerInterface, Methods: introspect.Methods(om)},
+			},
+			Children: []introspect.Node{{Name: "Modem"}},
+		}), ManagerPath, "org.freedesktop.DBus.Introspectable"},
+		{s.props, s.path, propertiesInterface},
+		{mi, s.path, MessagingInterface},
+		{introspect.NewIntrospectable(&introspect.Node{
+			Name: string(s.path),
+			Interfaces: []introspect.Interface{
+				introspect.IntrospectData,
+				{Name: propertiesInterface, Methods: introspect.Methods(s.props)},
+				{Name: ModemInterface},
+				{
+					Name:    MessagingInterface,
+					Methods: introspect.Methods(mi),
+					Signals: []introspect.Signal{
+						{Name: "Added", Args: []introspect.Arg{
+							{Name: "path", Type: "o"}, {Name: "received", Type: "b"}}},
+						{Name: "Deleted", Args: []introspect.Arg{
+							{Name: "path", Type: "o"}}},
+					},
+				},
+			},
+		}), s.path, "org.freedesktop.DBus.Introspectable"},
+	}
+	for _, e := range exports {
+		if err := conn.Export(e.v, e.path, e.iface); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+type identityOption Identity
+
+func (o identityOption) applyOption(s *Server) {
+	s.id = Identity(o)
+}
+
+// WithIdentity specifies the identity of the modem reported in the Modem
+// properties.
+func WithIdentity(id Identity) Option {
+	return identityOption(id)
+}
+
+type indexOption int
+
+func (o indexOption) applyOption(s *Server) {
+	s.index = int(o)
+}
+
+// WithIndex specifies the index of the modem, which determines its object
+// path, i.e. /org/freedesktop/ModemManager1/Modem/<index>.
+//
+// The default is 0.
+func WithIndex(index int) Option {
+	return indexOption(index)
+}
+
+func (o ErrorHandler) applyOption(s *Server) {
+	s.eh = o
+}
+
+// WithErrorHandler specifies a handler for errors emitting signals.
+//
+// By default such errors are discarded.
+func WithErrorHandler(h ErrorHandler) Option {
+	return h
+}
+
+// Path returns the object path of the modem.
+func (s *Server) Path() dbus.ObjectPath {
+	return s.path
+}
+
+// Close removes the objects from the connection.
+//
+// The connection itself remains open.
+func (s *Server) Close() {
+	s.mu.Lock()
+	paths := make([]dbus.ObjectPath, 0, len(s.sms))
+	for p := range s.sms {
+		paths = append(paths, p)
+	}
+	s.sms = make(map[dbus.ObjectPath]*sms)
+	s.mu.Unlock()
+	for _, p := range paths {
+		s.unexportSms(p)
+	}
+	for _, iface := range []string{propertiesInterface, MessagingInterface, "org.freedesktop.DBus.Introspectable"} {
+		s.conn.Export(nil, s.path, iface)
+	}
+	s.conn.Export(nil, ManagerPath, objectManagerInterface)
+	s.conn.Export(nil, ManagerPath, "org.freedesktop.DBus.Introspectable")
+}
+
+// HandleMessage exposes a received message as an SMS object and signals it
+// via Messaging.Added.
+//
+// It can be passed directly to StartMessageRx as the message handler.
+func (s *Server) HandleMessage(m gsm.Message) {
+	ts := m.SCTS.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	_, err := s.addSms(map[string]interface{}{
+		"State":                 uint32(SmsStateReceived),
+		"PduType":               uint32(SmsPduTypeDeliver),
+		"Number":                m.Number,
+		"Text":                  m.Message,
+		"Timestamp":             ts.Format(time.RFC3339),
+		"MessageReference":      uint32(0),
+		"DeliveryReportRequest": false,
+		"Storage":               uint32(0),
+	}, true)
+	s.handleError(err)
+}
+
+// UpdateSignalQuality reads the signal quality from the modem and updates the
+// SignalQuality property.
+//
+// This should be called periodically, as the property is not otherwise
+// updated.
+func (s *Server) UpdateSignalQuality() error {
+	rssi, _, err := s.m.SignalQuality()
+	if err != nil {
+		return err
+	}
+	return s.props.set(ModemInterface, map[string]interface{}{
+		"SignalQuality": SignalQuality{Quality: quality(rssi), Recent: true},
+	})
+}
+
+// quality converts the +CSQ rssi to a percentage.
+func quality(rssi int) uint32 {
+	if rssi < 0 || rssi > 31 {
+		return 0
+	}
+	return uint32(rssi * 100 / 31)
+}
+
+func (s *Server) handleError(err error) {
+	if err != nil && s.eh != nil {
+		s.eh(err)
+	}
+}
+
+// addSms exports a new SMS object with the properties and signals its
+// addition.
+//
+// Errors signalling the addition are passed to the error handler, rather than
+// being returned, as the object has been added.
+func (s *Server) addSms(props map[string]interface{}, received bool) (dbus.ObjectPath, error) {
+	s.mu.Lock()
+	path := dbus.ObjectPath(fmt.Sprintf("%s/SMS/%d", ManagerPath, s.next))
+	s.next++
+	o := &sms{s: s, path: path}
+	o.props = newProperties(s.conn, path, map[string]map[string]interface{}{
+		SmsInterface: props,
+	})
+	if err := s.conn.Export(o.props, path, propertiesInterface); err != nil {
+		s.mu.Unlock()
+		return "", err
+	}
+	if err := s.conn.Export(o, path, SmsInterface); err != nil {
+		s.mu.Unlock()
+		s.unexportSms(path)
+		return "", err
+	}
+	s.sms[path] = o
+	msgs := s.messages()
+	s.mu.Unlock()
+	s.handleError(s.conn.Emit(s.path, MessagingInterface+".Added", path, received))
+	s.handleError(s.props.set(MessagingInterface, map[string]interface{}{"Messages": msgs}))
+	return path, nil
+}
+
+// deleteSms removes the SMS object and signals its deletion.
+func (s *Server) deleteSms(path dbus.ObjectPath) bool {
+	s.mu.Lock()
+	_, ok := s.sms[path]
+	delete(s.sms, path)
+	msgs := s.messages()
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	s.unexportSms(path)
+	s.handleError(s.conn.Emit(s.path, MessagingInterface+".Deleted", path))
+	s.handleError(s.props.set(MessagingInterface, map[string]interface{}{"Messages": msgs}))
+	return true
+}
+
+func (s *Server) unexportSms(path dbus.ObjectPath) {
+	s.conn.Export(nil, path, propertiesInterface)
+	s.conn.Export(nil, path, SmsInterface)
+}
+
+// messages returns the paths of the SMS objects.
+//
+// Must be called with s.mu held.
+func (s *Server) messages() []dbus.ObjectPath {
+	msgs := make([]dbus.ObjectPath, 0, len(s.sms))
+	for p := range s.sms {
+		msgs = append(msgs, p)
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i] < msgs[j] })
+	return msgs
+}
+
+// objectManager implements org.freedesktop.DBus.ObjectManager on the manager
+// object.
+type objectManager struct {
+	s *Server
+}
+
+// GetManagedObjects implements org.freedesktop.DBus.ObjectManager.GetManagedObjects.
+func (o objectManager) GetManagedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+	return map[dbus.ObjectPath]map[string]map[string]dbus.Variant{
+		o.s.path: o.s.props.all(),
+	}, nil
+}
+
+// messaging implements org.freedesktop.ModemManager1.Modem.Messaging.
+type messaging struct {
+	s *Server
+}
+
+// List returns the paths of the SMS objects.
+func (m messaging) List() ([]dbus.ObjectPath, *dbus.Error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	return m.s.messages(), nil
+}
+
+// Create creates an SMS object, to be sent by its Send method.
+//
+// The properties must contain the "number" and "text" to be sent.
+func (m messaging) Create(props map[string]dbus.Variant) (dbus.ObjectPath, *dbus.Error) {
+	number, ok := props["number"].Value().(string)
+	if !ok || number == "" {
+		return "", errInvalidArgs("missing number")
+	}
+	text, ok := props["text"].Value().(string)
+	if !ok {
+		return "", errInvalidArgs("missing text")
+	}
+	path, err := m.s.addSms(map[string]interface{}{
+		"State":                 uint32(SmsStateUnknown),
+		"PduType":               uint32(SmsPduTypeSubmit),
+		"Number":                number,
+		"Text":                  text,
+		"Timestamp":             "",
+		"MessageReference":      uint32(0),
+		"DeliveryReportRequest": false,
+		"Storage":               uint32(0),
+	}, false)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return path, nil
+}
+
+// Delete removes an SMS object.
+func (m messaging) Delete(path dbus.ObjectPath) *dbus.Error {
+	if !m.s.deleteSms(path) {
+		return dbus.NewError("org.freedesktop.ModemManager1.Error.Core.NotFound",
+			[]interface{}{"no such SMS " + string(path)})
+	}
+	return nil
+}
+
+// sms implements org.freedesktop.ModemManager1.Sms.
+type sms struct {
+	s     *Server
+	path  dbus.ObjectPath
+	props *properties
+
+	// sendMu serialises sends of the one SMS.
+	sendMu sync.Mutex
+}
+
+// Send sends the SMS, returning once it has been sent.
+func (o *sms) Send() *dbus.Error {
+	o.sendMu.Lock()
+	defer o.sendMu.Unlock()
+	if o.props.value(SmsInterface, "PduType") != uint32(SmsPduTypeSubmit) {
+		return dbus.NewError("org.freedesktop.ModemManager1.Error.Core.WrongState",
+			[]interface{}{"received SMS cannot be sent"})
+	}
+	prev := o.props.value(SmsInterface, "State")
+	o.s.handleError(o.props.set(SmsInterface, map[string]interface{}{
+		"State": uint32(SmsStateSending),
+	}))
+	number, _ := o.props.value(SmsInterface, "Number").(string)
+	text, _ := o.props.value(SmsInterface, "Text").(string)
+	mrs, err := o.s.m.SendLongMessage(number, text)
+	if err != nil {
+		o.s.handleError(o.props.set(SmsInterface, map[string]interface{}{
+			"State": prev,
+		}))
+		return dbus.NewError("org.freedesktop.ModemManager1.Error.Core.Failed",
+			[]interface{}{err.Error()})
+	}
+	changes := map[string]interface{}{
+		"State":     uint32(SmsStateSent),
+		"Timestamp": time.Now().Format(time.RFC3339),
+	}
+	if len(mrs) > 0 {
+		if mr, err := strconv.ParseUint(mrs[0], 10, 32); err == nil {
+			changes["MessageReference"] = uint32(mr)
+		}
+	}
+	o.s.handleError(o.props.set(SmsInterface, changes))
+	return nil
+}
+
+// Store is not supported, as messages are not stored on the modem.
+func (o *sms) Store(storage uint32) *dbus.Error {
+	return dbus.NewError("org.freedesktop.ModemManager1.Error.Core.Unsupported",
+		[]interface{}{"storing SMS is not supported"})
+}
+
+func errInvalidArgs(msg string) *dbus.Error {
+	return dbus.NewError("org.freedesktop.ModemManager1.Error.Core.InvalidArgs",
+		[]interface{}{msg})
+}
@@ -0,0 +1,288 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package mmdbus_test
+
+import (
+	"bufio"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/modem/mmdbus"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+type sent struct {
+	number  string
+	message string
+}
+
+type mockModem struct {
+	mu   sync.Mutex
+	sent []sent
+	rssi int
+	err  error
+}
+
+func (m *mockModem) SendLongMessage(number string, message string, options ...at.CommandOption) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.sent = append(m.sent, sent{number, message})
+	return []string{"42", "43"}, nil
+}
+
+func (m *mockModem) Sent() []sent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]sent(nil), m.sent...)
+}
+
+func (m *mockModem) setErr(err error) {
+	m.mu.Lock()
+	m.err = err
+	m.mu.Unlock()
+}
+
+func (m *mockModem) SignalQuality(options ...at.CommandOption) (int, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rssi, 99, m.err
+}
+
+// setupBus starts a private session bus, and returns connections for the
+// server and a client.
+func setupBus(t *testing.T) (*dbus.Conn, *dbus.Conn, func()) {
+	path, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+	cmd := exec.Command(path, "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	require.Nil(t, err)
+	if err = cmd.Start(); err != nil {
+		t.Skip("dbus-daemon failed to start:", err)
+	}
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		cmd.Process.Kill()
+		t.Skip("dbus-daemon failed to start:", err)
+	}
+	addr = strings.TrimSpace(addr)
+	sc, err := dbus.Connect(addr)
+	require.Nil(t, err)
+	cc, err := dbus.Connect(addr)
+	require.Nil(t, err)
+	return sc, cc, func() {
+		cc.Close()
+		sc.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+}
+
+func setupServer(t *testing.T, m mmdbus.Modem, options ...mmdbus.Option) (*mmdbus.Server, *dbus.Conn, chan *dbus.Signal, func()) {
+	sc, cc, teardown := setupBus(t)
+	s, err := mmdbus.New(sc, m, options...)
+	require.Nil(t, err)
+	require.NotNil(t, s)
+	reply, err := sc.RequestName(mmdbus.BusName, dbus.NameFlagDoNotQueue)
+	require.Nil(t, err)
+	require.Equal(t, dbus.RequestNameReplyPrimaryOwner, reply)
+	err = cc.AddMatchSignal(dbus.WithMatchSender(mmdbus.BusName))
+	require.Nil(t, err)
+	sigs := make(chan *dbus.Signal, 20)
+	cc.Signal(sigs)
+	return s, cc, sigs, func() {
+		s.Close()
+		teardown()
+	}
+}
+
+func waitSignal(t *testing.T, sigs chan *dbus.Signal, name string) *dbus.Signal {
+	t.Helper()
+	for {
+		select {
+		case sig := <-sigs:
+			if sig.Name == name {
+				return sig
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s signal", name)
+			return nil
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	id := mmdbus.Identity{
+		Manufacturer:        "Quectel",
+		Model:               "EC25",
+		Revision:            "EC25EFAR06A06M4G",
+		EquipmentIdentifier: "867698041234567",
+	}
+	s, cc, _, teardown := setupServer(t, &mockModem{},
+		mmdbus.WithIdentity(id),
+		mmdbus.WithIndex(3))
+	defer teardown()
+	assert.Equal(t, dbus.ObjectPath("/org/freedesktop/ModemManager1/Modem/3"), s.Path())
+	obj := cc.Object(mmdbus.BusName, s.Path())
+
+	v, err := obj.GetProperty(mmdbus.ModemInterface + ".Model")
+	assert.Nil(t, err)
+	assert.Equal(t, "EC25", v.Value())
+	v, err = obj.GetProperty(mmdbus.ModemInterface + ".EquipmentIdentifier")
+	assert.Nil(t, err)
+	assert.Equal(t, "867698041234567", v.Value())
+
+	// read only
+	err = obj.SetProperty(mmdbus.ModemInterface+".Model", dbus.MakeVariant("EC21"))
+	assert.NotNil(t, err)
+
+	// object manager
+	var objs map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	err = cc.Object(mmdbus.BusName, mmdbus.ManagerPath).
+		Call("org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0).Store(&objs)
+	assert.Nil(t, err)
+	require.Contains(t, objs, s.Path())
+	assert.Contains(t, objs[s.Path()], mmdbus.MessagingInterface)
+	assert.Equal(t, "Quectel", objs[s.Path()][mmdbus.ModemInterface]["Manufacturer"].Value())
+}
+
+func TestUpdateSignalQuality(t *testing.T) {
+	m := &mockModem{rssi: 20}
+	s, cc, sigs, teardown := setupServer(t, m)
+	defer teardown()
+	obj := cc.Object(mmdbus.BusName, s.Path())
+
+	err := s.UpdateSignalQuality()
+	assert.Nil(t, err)
+	sig := waitSignal(t, sigs, "org.freedesktop.DBus.Properties.PropertiesChanged")
+	assert.Equal(t, mmdbus.ModemInterface, sig.Body[0])
+	var sq struct {
+		Quality uint32
+		Recent  bool
+	}
+	v, err := obj.GetProperty(mmdbus.ModemInterface + ".SignalQuality")
+	assert.Nil(t, err)
+	err = dbus.Store([]interface{}{v.Value()}, &sq)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(64), sq.Quality)
+	assert.True(t, sq.Recent)
+
+	merr := errors.New("no modem")
+	m.setErr(merr)
+	err = s.UpdateSignalQuality()
+	assert.Equal(t, merr, err)
+}
+
+func TestHandleMessage(t *testing.T) {
+	s, cc, sigs, teardown := setupServer(t, &mockModem{})
+	defer teardown()
+	obj := cc.Object(mmdbus.BusName, s.Path())
+
+	scts := tpdu.Timestamp{Time: time.Date(2020, 5, 1, 10, 37, 38, 0, time.UTC)}
+	s.HandleMessage(gsm.Message{Number: "+1234", Message: "hello", SCTS: scts})
+	sig := waitSignal(t, sigs, mmdbus.MessagingInterface+".Added")
+	require.Len(t, sig.Body, 2)
+	path := sig.Body[0].(dbus.ObjectPath)
+	assert.Equal(t, true, sig.Body[1])
+
+	var msgs []dbus.ObjectPath
+	err := obj.Call(mmdbus.MessagingInterface+".List", 0).Store(&msgs)
+	assert.Nil(t, err)
+	assert.Equal(t, []dbus.ObjectPath{path}, msgs)
+
+	sobj := cc.Object(mmdbus.BusName, path)
+	v, err := sobj.GetProperty(mmdbus.SmsInterface + ".Text")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", v.Value())
+	v, err = sobj.GetProperty(mmdbus.SmsInterface + ".Number")
+	assert.Nil(t, err)
+	assert.Equal(t, "+1234", v.Value())
+	v, err = sobj.GetProperty(mmdbus.SmsInterface + ".State")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(mmdbus.SmsStateReceived), v.Value())
+	v, err = sobj.GetProperty(mmdbus.SmsInterface + ".Timestamp")
+	assert.Nil(t, err)
+	assert.Equal(t, "2020-05-01T10:37:38Z", v.Value())
+
+	// received cannot be sent
+	err = sobj.Call(mmdbus.SmsInterface+".Send", 0).Err
+	assert.NotNil(t, err)
+
+	// delete
+	err = obj.Call(mmdbus.MessagingInterface+".Delete", 0, path).Err
+	assert.Nil(t, err)
+	waitSignal(t, sigs, mmdbus.MessagingInterface+".Deleted")
+	err = obj.Call(mmdbus.MessagingInterface+".List", 0).Store(&msgs)
+	assert.Nil(t, err)
+	assert.Empty(t, msgs)
+	err = obj.Call(mmdbus.MessagingInterface+".Delete", 0, path).Err
+	assert.NotNil(t, err)
+}
+
+func TestSend(t *testing.T) {
+	m := &mockModem{}
+	s, cc, sigs, teardown := setupServer(t, m)
+	defer teardown()
+	obj := cc.Object(mmdbus.BusName, s.Path())
+
+	// missing number
+	var path dbus.ObjectPath
+	err := obj.Call(mmdbus.MessagingInterface+".Create", 0,
+		map[string]dbus.Variant{"text": dbus.MakeVariant("hello")}).Store(&path)
+	assert.NotNil(t, err)
+
+	err = obj.Call(mmdbus.MessagingInterface+".Create", 0,
+		map[string]dbus.Variant{
+			"number": dbus.MakeVariant("+1234"),
+			"text":   dbus.MakeVariant("hello"),
+		}).Store(&path)
+	require.Nil(t, err)
+	sig := waitSignal(t, sigs, mmdbus.MessagingInterface+".Added")
+	assert.Equal(t, []interface{}{path, false}, sig.Body)
+
+	sobj := cc.Object(mmdbus.BusName, path)
+	v, err := sobj.GetProperty(mmdbus.SmsInterface + ".State")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(mmdbus.SmsStateUnknown), v.Value())
+
+	err = sobj.Call(mmdbus.SmsInterface+".Send", 0).Err
+	assert.Nil(t, err)
+	assert.Equal(t, []sent{{"+1234", "hello"}}, m.Sent())
+	v, err = sobj.GetProperty(mmdbus.SmsInterface + ".State")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(mmdbus.SmsStateSent), v.Value())
+	v, err = sobj.GetProperty(mmdbus.SmsInterface + ".MessageReference")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(42), v.Value())
+
+	// failed
+	m.setErr(errors.New("CMS ERROR: 500"))
+	err = obj.Call(mmdbus.MessagingInterface+".Create", 0,
+		map[string]dbus.Variant{
+			"number": dbus.MakeVariant("+1234"),
+			"text":   dbus.MakeVariant("again"),
+		}).Store(&path)
+	require.Nil(t, err)
+	sobj = cc.Object(mmdbus.BusName, path)
+	err = sobj.Call(mmdbus.SmsInterface+".Send", 0).Err
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "CMS ERROR: 500")
+	v, err = sobj.GetProperty(mmdbus.SmsInterface + ".State")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(mmdbus.SmsStateUnknown), v.Value())
+}
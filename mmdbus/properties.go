@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package mmdbus
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const propertiesInterface = "org.freedesktop.DBus.Properties"
+
+// properties implements the org.freedesktop.DBus.Properties interface for an
+// object.
+//
+// All properties are read only to clients.  Changes made by the server are
+// signalled via PropertiesChanged.
+type properties struct {
+	conn *dbus.Conn
+	path dbus.ObjectPath
+
+	mu sync.RWMutex
+	m  map[string]map[string]interface{}
+}
+
+func newProperties(conn *dbus.Conn, path dbus.ObjectPath, m map[string]map[string]interface{}) *properties {
+	return &properties{conn: conn, path: path, m: m}
+}
+
+// Get implements org.freedesktop.DBus.Properties.Get.
+func (p *properties) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	props, ok := p.m[iface]
+	if !ok {
+		return dbus.Variant{}, errUnknownInterface(iface)
+	}
+	v, ok := props[name]
+	if !ok {
+		return dbus.Variant{}, errUnknownProperty(name)
+	}
+	return dbus.MakeVariant(v), nil
+}
+
+// GetAll implements org.freedesktop.DBus.Properties.GetAll.
+func (p *properties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	props, ok := p.m[iface]
+	if !ok {
+		return nil, errUnknownInterface(iface)
+	}
+	return variants(props), nil
+}
+
+// Set implements org.freedesktop.DBus.Properties.Set.
+func (p *properties) Set(iface, name string, v dbus.Variant) *dbus.Error {
+	if _, err := p.Get(iface, name); err != nil {
+		return err
+	}
+	return dbus.NewError("org.freedesktop.DBus.Error.PropertyReadOnly",
+		[]interface{}{name + " is read only"})
+}
+
+// all returns the properties of all interfaces, as required by
+// GetManagedObjects.
+func (p *properties) all() map[string]map[string]dbus.Variant {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	all := make(map[string]map[string]dbus.Variant)
+	for iface, props := range p.m {
+		all[iface] = variants(props)
+	}
+	return all
+}
+
+func (p *properties) value(iface, name string) interface{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.m[iface][name]
+}
+
+// set updates the properties of an interface and signals the change.
+func (p *properties) set(iface string, changes map[string]interface{}) error {
+	p.mu.Lock()
+	for name, v := range changes {
+		p.m[iface][name] = v
+	}
+	p.mu.Unlock()
+	return p.conn.Emit(p.path, propertiesInterface+".PropertiesChanged",
+		iface, variants(changes), []string{})
+}
+
+func variants(props map[string]interface{}) map[string]dbus.Variant {
+	vv := make(map[string]dbus.Variant, len(props))
+	for name, v := range props {
+		vv[name] = dbus.MakeVariant(v)
+	}
+	return vv
+}
+
+func errUnknownInterface(iface string) *dbus.Error {
+	return dbus.NewError("org.freedesktop.DBus.Error.UnknownInterface",
+		[]interface{}{"unknown interface " + iface})
+}
+
+func errUnknownProperty(name string) *dbus.Error {
+	return dbus.NewError("org.freedesktop.DBus.Error.UnknownProperty",
+		[]interface{}{"unknown property " + name})
+}
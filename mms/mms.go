@@ -0,0 +1,471 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package mms provides a driver to send MMS messages using the MMS stack
+// embedded in some modems.
+//
+// The MMS stacks are vendor specific, so the Dialect of the modem must be
+// provided.  The MMS is sent over a PDP context which must already be
+// configured for the MMS APN and activated.
+package mms
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// Dialect identifies the vendor specific MMS command set supported by the
+// modem.
+type Dialect int
+
+const (
+	// Quectel modems, using the +QMMS commands.
+	Quectel Dialect = iota
+
+	// SIMCom modems, using the +CMMS commands.
+	SIMCom
+)
+
+// MMS decorates the AT modem with the ability to send MMS messages.
+type MMS struct {
+	*at.AT
+	dialect     Dialect
+	mmsc        string
+	proxy       string
+	port        int
+	contextID   int
+	sendTimeout time.Duration
+}
+
+// Option is a construction option for the MMS.
+type Option interface {
+	applyOption(*MMS)
+}
+
+// New creates a new MMS driver for the modem.
+//
+// The MMSC must be provided, using WithMMSC, along with the proxy, using
+// WithProxy, if the MMS APN requires one.
+func New(a *at.AT, dialect Dialect, options ...Option) *MMS {
+	m := MMS{
+		AT:          a,
+		dialect:     dialect,
+		contextID:   1,
+		sendTimeout: 2 * time.Minute,
+	}
+	for _, option := range options {
+		option.applyOption(&m)
+	}
+	return &m
+}
+
+type mmscOption string
+
+func (o mmscOption) applyOption(m *MMS) {
+	m.mmsc = string(o)
+}
+
+// WithMMSC specifies the URL of the MMSC, as provided in the MMS APN settings.
+func WithMMSC(url string) Option {
+	return mmscOption(url)
+}
+
+type proxyOption struct {
+	host string
+	port int
+}
+
+func (o proxyOption) applyOption(m *MMS) {
+	m.proxy = o.host
+	m.port = o.port
+}
+
+// WithProxy specifies the MMS proxy, as provided in the MMS APN settings.
+//
+// By default no proxy is used.
+func WithProxy(host string, port int) Option {
+	return proxyOption{host, port}
+}
+
+type contextIDOption int
+
+func (o contextIDOption) applyOption(m *MMS) {
+	m.contextID = int(o)
+}
+
+// WithContextID specifies the PDP context used to send MMS messages.
+//
+// The default is 1.
+func WithContextID(id int) Option {
+	return contextIDOption(id)
+}
+
+type sendTimeoutOption time.Duration
+
+func (o sendTimeoutOption) applyOption(m *MMS) {
+	m.sendTimeout = time.Duration(o)
+}
+
+// WithSendTimeout specifies the maximum time allowed for the MMSC to accept
+// the message once the message has been composed.
+//
+// The default is 2 minutes.
+func WithSendTimeout(d time.Duration) Option {
+	return sendTimeoutOption(d)
+}
+
+// Attachment is a file attached to an MMS message.
+type Attachment struct {
+	// Name is the name of the file.
+	//
+	// The extension of the name is used by the modem to determine the content
+	// type of the attachment.
+	Name string
+
+	// Data is the content of the file.
+	Data []byte
+}
+
+// Message is an MMS message.
+type Message struct {
+	// To is the set of recipient numbers.
+	To []string
+
+	// Subject is the optional subject of the message.
+	Subject string
+
+	// Text is the optional text body of the message.
+	Text string
+
+	// Attachments is the optional set of files attached to the message.
+	Attachments []Attachment
+}
+
+// Stage identifies the progress of sending an MMS message.
+type Stage int
+
+const (
+	// Configuring indicates the MMS stack is being configured.
+	Configuring Stage = iota
+
+	// Composing indicates the message is being composed.
+	Composing
+
+	// Uploading indicates the text or an attachment is being uploaded to
+	// the modem.
+	Uploading
+
+	// Sending indicates the message is being sent to the MMSC.
+	Sending
+
+	// Sent indicates the message has been accepted by the MMSC.
+	Sent
+)
+
+// ProgressHandler receives updates on the progress of sending an MMS message.
+type ProgressHandler func(Stage)
+
+// SendOption defines a behavioural option for Send.
+type SendOption interface {
+	applySendOption(*sendConfig)
+}
+
+type sendConfig struct {
+	ph ProgressHandler
+}
+
+type progressOption ProgressHandler
+
+func (o progressOption) applySendOption(c *sendConfig) {
+	c.ph = ProgressHandler(o)
+}
+
+// WithProgressHandler specifies a handler to receive updates on the progress
+// of sending the message.
+func WithProgressHandler(h ProgressHandler) SendOption {
+	return progressOption(h)
+}
+
+// Result is the result of sending an MMS message, as reported by the modem.
+type Result struct {
+	// Code is the vendor specific result code, with 0 indicating success.
+	Code int
+
+	// HTTPStatus is the HTTP status returned by the MMSC, if reported by the
+	// modem, else 0.
+	HTTPStatus int
+}
+
+// Send composes the message and sends it to the MMSC.
+func (m *MMS) Send(msg Message, options ...SendOption) (Result, error) {
+	if len(msg.To) == 0 {
+		return Result{}, ErrNoRecipients
+	}
+	if m.mmsc == "" {
+		return Result{}, ErrNoMMSC
+	}
+	if err := m.checkMessage(msg); err != nil {
+		return Result{}, err
+	}
+	cfg := sendConfig{ph: func(Stage) {}}
+	for _, option := range options {
+		option.applySendOption(&cfg)
+	}
+	if m.dialect == SIMCom {
+		return m.sendSIMCom(msg, cfg)
+	}
+	return m.sendQuectel(msg, cfg)
+}
+
+// checkMessage checks the fields of the message, and the configuration, that
+// are embedded in quoted command parameters.
+//
+// The subject is only embedded by the Quectel dialect, as SIMCom uploads it
+// as data.
+func (m *MMS) checkMessage(msg Message) error {
+	if err := checkQuoted("mmsc", m.mmsc); err != nil {
+		return err
+	}
+	if err := checkQuoted("proxy", m.proxy); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := checkQuoted("recipient", to); err != nil {
+			return err
+		}
+	}
+	if m.dialect == Quectel {
+		if err := checkQuoted("subject", msg.Subject); err != nil {
+			return err
+		}
+	}
+	for _, f := range msg.Attachments {
+		if err := checkQuoted("attachment name", f.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkQuoted checks the value can be embedded in a quoted command
+// parameter, as a quote would end the parameter and a control character,
+// such as CR, the command, either of which would allow commands to be
+// injected into the modem.
+func checkQuoted(field, value string) error {
+	for _, r := range value {
+		if r == '"' || r < ' ' || r == 0x7f {
+			return ErrUnsafeInput{field, value, fmt.Sprintf("invalid character %q", r)}
+		}
+	}
+	return nil
+}
+
+// commands issues a sequence of commands, stopping at the first error.
+func (m *MMS) commands(cmds ...string) error {
+	for _, cmd := range cmds {
+		if _, err := m.Command(cmd); err != nil {
+			return fmt.Errorf("AT%s returned error: %w", cmd, err)
+		}
+	}
+	return nil
+}
+
+func (m *MMS) sendQuectel(msg Message, cfg sendConfig) (res Result, err error) {
+	cfg.ph(Configuring)
+	cmds := []string{
+		"+QMMSEDIT=0",
+		fmt.Sprintf("+QMMSCFG=\"contextid\",%d", m.contextID),
+		fmt.Sprintf("+QMMSCFG=\"mmsc\",\"%s\"", m.mmsc),
+	}
+	if m.proxy != "" {
+		cmds = append(cmds, fmt.Sprintf("+QMMSCFG=\"proxy\",\"%s\",%d", m.proxy, m.port))
+	}
+	if err = m.commands(cmds...); err != nil {
+		return
+	}
+	// clear the message and uploaded files, whatever the outcome.
+	defer m.Command("+QMMSEDIT=0")
+	cfg.ph(Composing)
+	cmds = cmds[:0]
+	for _, to := range msg.To {
+		cmds = append(cmds, fmt.Sprintf("+QMMSEDIT=1,1,\"%s\"", to))
+	}
+	if msg.Subject != "" {
+		cmds = append(cmds, fmt.Sprintf("+QMMSEDIT=4,1,\"%s\"", msg.Subject))
+	}
+	if err = m.commands(cmds...); err != nil {
+		return
+	}
+	files := msg.Attachments
+	if msg.Text != "" {
+		files = append([]Attachment{{Name: "text.txt", Data: []byte(msg.Text)}}, files...)
+	}
+	for n, f := range files {
+		cfg.ph(Uploading)
+		name := fmt.Sprintf("RAM:mms%d%s", n, path.Ext(f.Name))
+		defer m.Command(fmt.Sprintf("+QFDEL=\"%s\"", name))
+		cmd := fmt.Sprintf("+QFUPL=\"%s\",%d", name, len(f.Data))
+		if _, err = m.DataCommand(cmd, f.Data); err != nil {
+			err = fmt.Errorf("AT%s returned error: %w", cmd, err)
+			return
+		}
+		if err = m.commands(fmt.Sprintf("+QMMSEDIT=5,1,\"%s\"", name)); err != nil {
+			return
+		}
+	}
+	cfg.ph(Sending)
+	done := make(chan []string, 1)
+	err = m.AddIndication("+QMMSEND:", func(info []string) {
+		done <- info
+	})
+	if err != nil {
+		return
+	}
+	defer m.CancelIndication("+QMMSEND:")
+	secs := int(m.sendTimeout / time.Second)
+	if err = m.commands(fmt.Sprintf("+QMMSEND=%d", secs)); err != nil {
+		return
+	}
+	select {
+	case i := <-done:
+		res, err = parseQMMSEND(i[0])
+	case <-time.After(m.sendTimeout):
+		err = at.ErrDeadlineExceeded
+	case <-m.Closed():
+		err = at.ErrClosed
+	}
+	if err == nil && res.Code != 0 {
+		err = ErrSendFailed
+	}
+	if err == nil {
+		cfg.ph(Sent)
+	}
+	return
+}
+
+// parseQMMSEND parses the +QMMSEND: <result>,<HTTP response> indication.
+func parseQMMSEND(l string) (res Result, err error) {
+	fields := info.Fields(info.TrimPrefix(l, "+QMMSEND"))
+	res.Code, err = strconv.Atoi(fields[0])
+	if err != nil {
+		err = ErrMalformedResponse
+		return
+	}
+	if len(fields) > 1 {
+		res.HTTPStatus, _ = strconv.Atoi(fields[1])
+	}
+	return
+}
+
+func (m *MMS) sendSIMCom(msg Message, cfg sendConfig) (res Result, err error) {
+	cfg.ph(Configuring)
+	// the MMS stack may have been left initialised, so ignore any error.
+	m.Command("+CMMSTERM")
+	cmds := []string{
+		"+CMMSINIT",
+		fmt.Sprintf("+CMMSCURL=\"%s\"", m.mmsc),
+		fmt.Sprintf("+CMMSCID=%d", m.contextID),
+	}
+	if m.proxy != "" {
+		cmds = append(cmds, fmt.Sprintf("+CMMSPROTO=\"%s\",%d", m.proxy, m.port))
+	}
+	if err = m.commands(cmds...); err != nil {
+		return
+	}
+	defer m.Command("+CMMSTERM")
+	cfg.ph(Composing)
+	if err = m.commands("+CMMSEDIT=1"); err != nil {
+		return
+	}
+	defer m.Command("+CMMSEDIT=0")
+	if msg.Subject != "" {
+		if err = m.download("TITLE", "", []byte(msg.Subject), cfg); err != nil {
+			return
+		}
+	}
+	if msg.Text != "" {
+		if err = m.download("TEXT", "", []byte(msg.Text), cfg); err != nil {
+			return
+		}
+	}
+	for _, f := range msg.Attachments {
+		kind := "FILE"
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".jpg", ".jpeg", ".gif", ".png", ".bmp":
+			kind = "PIC"
+		}
+		if err = m.download(kind, f.Name, f.Data, cfg); err != nil {
+			return
+		}
+	}
+	cmds = cmds[:0]
+	for _, to := range msg.To {
+		cmds = append(cmds, fmt.Sprintf("+CMMSRECP=\"%s\"", to))
+	}
+	if err = m.commands(cmds...); err != nil {
+		return
+	}
+	cfg.ph(Sending)
+	if _, err = m.Command("+CMMSSEND", at.WithTimeout(m.sendTimeout)); err != nil {
+		err = fmt.Errorf("AT+CMMSSEND returned error: %w", err)
+		return
+	}
+	cfg.ph(Sent)
+	return
+}
+
+// download uploads a component of the message to the SIMCom MMS stack.
+func (m *MMS) download(kind, name string, data []byte, cfg sendConfig) error {
+	cfg.ph(Uploading)
+	// the SIMCom timeout is in milliseconds.
+	cmd := fmt.Sprintf("+CMMSDOWN=\"%s\",%d,%d", kind, len(data), 10000)
+	if name != "" {
+		cmd += fmt.Sprintf(",\"%s\"", name)
+	}
+	if _, err := m.DataCommand(cmd, data, at.WithTimeout(10*time.Second)); err != nil {
+		return fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	return nil
+}
+
+var (
+	// ErrMalformedResponse indicates the modem returned a badly formed
+	// response.
+	ErrMalformedResponse = errors.New("modem returned malformed response")
+
+	// ErrNoMMSC indicates the MMSC has not been configured.
+	ErrNoMMSC = errors.New("no MMSC configured")
+
+	// ErrNoRecipients indicates the message has no recipients.
+	ErrNoRecipients = errors.New("no recipients")
+
+	// ErrSendFailed indicates the modem reported that the MMSC did not accept
+	// the message.
+	ErrSendFailed = errors.New("send failed")
+)
+
+// ErrUnsafeInput indicates a message field, or the configuration, was
+// rejected as it could alter the AT command it is embedded in, such as a
+// recipient containing a quote, so injecting commands into the modem.
+type ErrUnsafeInput struct {
+	// Field identifies the input, such as "recipient" or "subject".
+	Field string
+
+	// Value is the rejected input.
+	Value string
+
+	// Reason describes why the input was rejected.
+	Reason string
+}
+
+func (e ErrUnsafeInput) Error() string {
+	return fmt.Sprintf("unsafe %s %q: %s", e.Field, e.Value, e.Reason)
+}
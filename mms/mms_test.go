@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package mms_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/mms"
+)
+
+func TestSendQuectel(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QMMSEDIT=0\r\n":                          {"\r\nOK\r\n"},
+		"AT+QMMSCFG=\"contextid\",1\r\n":             {"\r\nOK\r\n"},
+		"AT+QMMSCFG=\"mmsc\",\"http://mmsc\"\r\n":    {"\r\nOK\r\n"},
+		"AT+QMMSCFG=\"proxy\",\"10.0.0.1\",8080\r\n": {"\r\nOK\r\n"},
+		"AT+QMMSEDIT=1,1,\"+12345\"\r\n":             {"\r\nOK\r\n"},
+		"AT+QMMSEDIT=4,1,\"hi\"\r\n":                 {"\r\nOK\r\n"},
+		"AT+QFUPL=\"RAM:mms0.txt\",5\r":              {"\r\nCONNECT\r\n"},
+		"hello":                                      {"+QFUPL: 5,1234\r\n", "\r\nOK\r\n"},
+		"AT+QMMSEDIT=5,1,\"RAM:mms0.txt\"\r\n":       {"\r\nOK\r\n"},
+		"AT+QFDEL=\"RAM:mms0.txt\"\r\n":              {"\r\nOK\r\n"},
+		"AT+QMMSEND=1\r\n":                           {"\r\nOK\r\n", "+QMMSEND: 0,200\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet, mms.Quectel,
+		mms.WithMMSC("http://mmsc"),
+		mms.WithProxy("10.0.0.1", 8080),
+		mms.WithSendTimeout(time.Second))
+	defer teardownModem(mm)
+
+	var stages []mms.Stage
+	ph := func(s mms.Stage) {
+		stages = append(stages, s)
+	}
+	msg := mms.Message{To: []string{"+12345"}, Subject: "hi", Text: "hello"}
+	res, err := m.Send(msg, mms.WithProgressHandler(ph))
+	require.Nil(t, err)
+	assert.Equal(t, mms.Result{Code: 0, HTTPStatus: 200}, res)
+	assert.Equal(t, []mms.Stage{
+		mms.Configuring, mms.Composing, mms.Uploading, mms.Sending, mms.Sent},
+		stages)
+
+	// rejected
+	cmdSet["AT+QMMSEND=1\r\n"] = []string{"\r\nOK\r\n", "+QMMSEND: 1,404\r\n"}
+	res, err = m.Send(msg)
+	assert.Equal(t, mms.ErrSendFailed, err)
+	assert.Equal(t, mms.Result{Code: 1, HTTPStatus: 404}, res)
+
+	// no indication
+	cmdSet["AT+QMMSEND=1\r\n"] = []string{"\r\nOK\r\n"}
+	_, err = m.Send(msg)
+	assert.Equal(t, at.ErrDeadlineExceeded, err)
+
+	// upload error
+	cmdSet["AT+QFUPL=\"RAM:mms0.txt\",5\r"] = []string{"\r\n+CME ERROR: 407\r\n"}
+	_, err = m.Send(msg)
+	assert.Equal(t, at.CMEError("407"), errors.Unwrap(err))
+
+	// no recipients
+	_, err = m.Send(mms.Message{Text: "hello"})
+	assert.Equal(t, mms.ErrNoRecipients, err)
+
+	// unsafe input
+	_, err = m.Send(mms.Message{To: []string{"+1\",\"2"}, Text: "hello"})
+	assert.Equal(t, mms.ErrUnsafeInput{Field: "recipient", Value: "+1\",\"2", Reason: "invalid character '\"'"}, err)
+	_, err = m.Send(mms.Message{To: []string{"+12345"}, Subject: "hi\r\nAT+CFUN=0"})
+	assert.Equal(t, mms.ErrUnsafeInput{Field: "subject", Value: "hi\r\nAT+CFUN=0", Reason: "invalid character '\\r'"}, err)
+
+	// no MMSC
+	m, mm = setupModem(t, cmdSet, mms.Quectel)
+	defer teardownModem(mm)
+	_, err = m.Send(msg)
+	assert.Equal(t, mms.ErrNoMMSC, err)
+}
+
+func TestSendSIMCom(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CMMSTERM\r\n":                           {"\r\nOK\r\n"},
+		"AT+CMMSINIT\r\n":                           {"\r\nOK\r\n"},
+		"AT+CMMSCURL=\"http://mmsc\"\r\n":           {"\r\nOK\r\n"},
+		"AT+CMMSCID=2\r\n":                          {"\r\nOK\r\n"},
+		"AT+CMMSEDIT=1\r\n":                         {"\r\nOK\r\n"},
+		"AT+CMMSEDIT=0\r\n":                         {"\r\nOK\r\n"},
+		"AT+CMMSDOWN=\"TEXT\",5,10000\r":            {"\r\nCONNECT\r\n"},
+		"hello":                                     {"\r\nOK\r\n"},
+		"AT+CMMSDOWN=\"PIC\",3,10000,\"cat.jpg\"\r": {"\r\nCONNECT\r\n"},
+		"\x01\x02\x03":                              {"\r\nOK\r\n"},
+		"AT+CMMSRECP=\"+12345\"\r\n":                {"\r\nOK\r\n"},
+		"AT+CMMSSEND\r\n":                           {"\r\nOK\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet, mms.SIMCom,
+		mms.WithMMSC("http://mmsc"),
+		mms.WithContextID(2))
+	defer teardownModem(mm)
+
+	msg := mms.Message{
+		To:          []string{"+12345"},
+		Text:        "hello",
+		Attachments: []mms.Attachment{{Name: "cat.jpg", Data: []byte{1, 2, 3}}},
+	}
+	res, err := m.Send(msg)
+	require.Nil(t, err)
+	assert.Equal(t, mms.Result{}, res)
+
+	// send error
+	cmdSet["AT+CMMSSEND\r\n"] = []string{"\r\n+CME ERROR: 100\r\n"}
+	_, err = m.Send(msg)
+	assert.Equal(t, at.CMEError("100"), errors.Unwrap(err))
+
+	// init error
+	delete(cmdSet, "AT+CMMSINIT\r\n")
+	_, err = m.Send(msg)
+	assert.Equal(t, at.ErrError, errors.Unwrap(err))
+}
+
+type mockModem struct {
+	cmdSet map[string][]string
+	closed bool
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if data == nil {
+		return 0, at.ErrClosed
+	}
+	copy(p, data) // assumes p is empty
+	if !ok {
+		return len(data), fmt.Errorf("closed with data")
+	}
+	return len(data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	if mm.closed {
+		return 0, at.ErrClosed
+	}
+	v := mm.cmdSet[string(p)]
+	if len(v) == 0 {
+		mm.r <- []byte("\r\nERROR\r\n")
+	} else {
+		for _, l := range v {
+			mm.r <- []byte(l)
+		}
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) Close() error {
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
+
+func setupModem(t *testing.T, cmdSet map[string][]string, d mms.Dialect, options ...mms.Option) (*mms.MMS, *mockModem) {
+	mm := &mockModem{cmdSet: cmdSet, r: make(chan []byte, 10)}
+	m := mms.New(at.New(mm), d, options...)
+	require.NotNil(t, m)
+	return m, mm
+}
+
+func teardownModem(mm *mockModem) {
+	mm.Close()
+}
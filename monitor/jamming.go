@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package monitor
+
+import (
+	"strings"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// JammingSeverity is the severity of detected jamming.
+type JammingSeverity int
+
+const (
+	// NoJamming indicates no jamming is detected, including that previously
+	// detected jamming has ceased.
+	NoJamming JammingSeverity = iota
+
+	// Interference indicates interference is detected that may degrade, but
+	// not suppress, the cellular link.
+	Interference
+
+	// Jammed indicates the cellular link is being suppressed.
+	Jammed
+)
+
+func (s JammingSeverity) String() string {
+	switch s {
+	case NoJamming:
+		return "no jamming"
+	case Interference:
+		return "interference"
+	case Jammed:
+		return "jammed"
+	}
+	return "unknown"
+}
+
+// JammingDetected is a change in the jamming status reported by the modem.
+type JammingDetected struct {
+	// Time is the time the indication was received.
+	Time time.Time
+
+	// Severity is the severity of the jamming.
+	Severity JammingSeverity
+}
+
+// JammingHandler receives changes in the jamming status.
+type JammingHandler func(JammingDetected)
+
+// StartJammingDetection enables jamming detection in the modem and passes any
+// subsequent jamming indications to the handler.
+//
+// Quectel modems report via +QJDR, SIMCom modems via +SJDR, and Telit modems
+// via #JDR.
+func (m *Monitor) StartJammingDetection(h JammingHandler, options ...at.CommandOption) error {
+	prefix, cmd := "+QJDR", "+QJDR=1"
+	switch m.dialect {
+	case SIMCom:
+		prefix, cmd = "+SJDR", "+SJDR=1,1,255,1"
+	case Telit:
+		prefix, cmd = "#JDR", "#JDR=2"
+	}
+	jh := func(i []string) {
+		s, ok := parseJammingStatus(info.TrimPrefix(i[0], prefix))
+		if !ok {
+			return
+		}
+		h(JammingDetected{Time: time.Now(), Severity: s})
+	}
+	if err := m.AddIndication(prefix, jh); err != nil {
+		return err
+	}
+	if _, err := m.Command(cmd, options...); err != nil {
+		m.CancelIndication(prefix)
+		return err
+	}
+	return nil
+}
+
+// StopJammingDetection disables jamming detection in the modem and removes the
+// handler.
+func (m *Monitor) StopJammingDetection(options ...at.CommandOption) error {
+	prefix, cmd := "+QJDR", "+QJDR=0"
+	switch m.dialect {
+	case SIMCom:
+		prefix, cmd = "+SJDR", "+SJDR=0"
+	case Telit:
+		prefix, cmd = "#JDR", "#JDR=0"
+	}
+	m.CancelIndication(prefix)
+	_, err := m.Command(cmd, options...)
+	return err
+}
+
+// parseJammingStatus maps the vendor jamming status into a severity.
+//
+// Both the numeric and textual forms of the status are supported.
+func parseJammingStatus(status string) (JammingSeverity, bool) {
+	status = strings.ToUpper(info.Fields(status)[0])
+	switch {
+	case status == "0" || strings.HasPrefix(status, "NO JAMMING") ||
+		strings.HasPrefix(status, "OPERATIVE"):
+		return NoJamming, true
+	case status == "1" || strings.HasPrefix(status, "JAMMED") ||
+		strings.HasPrefix(status, "JAMMING"):
+		return Jammed, true
+	case status == "2" || strings.HasPrefix(status, "INTERFERENCE"):
+		return Interference, true
+	}
+	return NoJamming, false
+}
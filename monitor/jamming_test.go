@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package monitor_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/monitor"
+)
+
+func TestJammingDetection(t *testing.T) {
+	patterns := []struct {
+		name     string
+		dialect  monitor.Dialect
+		cmdSet   map[string][]string
+		urc      string
+		severity monitor.JammingSeverity
+	}{
+		{
+			"quectel jammed",
+			monitor.Quectel,
+			map[string][]string{"AT+QJDR=1\r\n": {"OK\r\n"}, "AT+QJDR=0\r\n": {"OK\r\n"}},
+			"+QJDR: 1\r\n",
+			monitor.Jammed,
+		},
+		{
+			"quectel cleared",
+			monitor.Quectel,
+			map[string][]string{"AT+QJDR=1\r\n": {"OK\r\n"}, "AT+QJDR=0\r\n": {"OK\r\n"}},
+			"+QJDR: 0\r\n",
+			monitor.NoJamming,
+		},
+		{
+			"simcom jammed",
+			monitor.SIMCom,
+			map[string][]string{"AT+SJDR=1,1,255,1\r\n": {"OK\r\n"}, "AT+SJDR=0\r\n": {"OK\r\n"}},
+			"+SJDR: JAMMING DETECTED\r\n",
+			monitor.Jammed,
+		},
+		{
+			"simcom interference",
+			monitor.SIMCom,
+			map[string][]string{"AT+SJDR=1,1,255,1\r\n": {"OK\r\n"}, "AT+SJDR=0\r\n": {"OK\r\n"}},
+			"+SJDR: INTERFERENCE DETECTED\r\n",
+			monitor.Interference,
+		},
+		{
+			"simcom cleared",
+			monitor.SIMCom,
+			map[string][]string{"AT+SJDR=1,1,255,1\r\n": {"OK\r\n"}, "AT+SJDR=0\r\n": {"OK\r\n"}},
+			"+SJDR: NO JAMMING\r\n",
+			monitor.NoJamming,
+		},
+		{
+			"telit jammed",
+			monitor.Telit,
+			map[string][]string{"AT#JDR=2\r\n": {"OK\r\n"}, "AT#JDR=0\r\n": {"OK\r\n"}},
+			"#JDR: JAMMED\r\n",
+			monitor.Jammed,
+		},
+		{
+			"telit cleared",
+			monitor.Telit,
+			map[string][]string{"AT#JDR=2\r\n": {"OK\r\n"}, "AT#JDR=0\r\n": {"OK\r\n"}},
+			"#JDR: OPERATIVE\r\n",
+			monitor.NoJamming,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			m, mm := setupModem(t, p.cmdSet, p.dialect)
+			defer teardownModem(mm)
+			jdc := make(chan monitor.JammingDetected, 1)
+			h := func(jd monitor.JammingDetected) {
+				jdc <- jd
+			}
+			err := m.StartJammingDetection(h)
+			require.Nil(t, err)
+			mm.r <- []byte(p.urc)
+			select {
+			case jd := <-jdc:
+				assert.Equal(t, p.severity, jd.Severity)
+				assert.False(t, jd.Time.IsZero())
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("no jamming indication")
+			}
+			err = m.StopJammingDetection()
+			assert.Nil(t, err)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestJammingDetectionUnsupported(t *testing.T) {
+	m, mm := setupModem(t, nil, monitor.Quectel)
+	defer teardownModem(mm)
+	h := func(jd monitor.JammingDetected) {
+		t.Error("unexpected indication")
+	}
+	err := m.StartJammingDetection(h)
+	assert.Equal(t, at.ErrError, err)
+
+	// handler removed so can be restarted
+	err = m.AddIndication("+QJDR", func([]string) {})
+	assert.Nil(t, err)
+}
+
+func TestJammingSeverityString(t *testing.T) {
+	assert.Equal(t, "no jamming", monitor.NoJamming.String())
+	assert.Equal(t, "interference", monitor.Interference.String())
+	assert.Equal(t, "jammed", monitor.Jammed.String())
+	assert.Equal(t, "unknown", monitor.JammingSeverity(7).String())
+}
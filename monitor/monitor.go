@@ -0,0 +1,461 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package monitor provides a sampler of serving cell engineering data, such
+// as is used for drive testing and coverage mapping.
+//
+// The engineering commands are vendor specific, so the Dialect of the modem
+// must be provided.
+package monitor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// Dialect identifies the vendor specific engineering command set supported by
+// the modem.
+type Dialect int
+
+const (
+	// Quectel modems, using +QENG="servingcell".
+	Quectel Dialect = iota
+
+	// SIMCom modems, using +CENG.
+	SIMCom
+
+	// Telit modems, using #MONI.
+	Telit
+
+	// Sierra Wireless modems, using !GSTATUS.
+	Sierra
+)
+
+// Monitor decorates the AT modem with the ability to sample serving cell
+// engineering data.
+type Monitor struct {
+	*at.AT
+	dialect Dialect
+	period  time.Duration
+	ps      PositionSource
+
+	// if not-nil, the table used to resolve operator names.
+	operators OperatorNames
+}
+
+// Option is a construction option for the Monitor.
+type Option interface {
+	applyOption(*Monitor)
+}
+
+// New creates a new Monitor for the modem.
+func New(a *at.AT, dialect Dialect, options ...Option) *Monitor {
+	m := Monitor{
+		AT:      a,
+		dialect: dialect,
+		period:  time.Second,
+	}
+	for _, option := range options {
+		option.applyOption(&m)
+	}
+	return &m
+}
+
+type periodOption time.Duration
+
+func (o periodOption) applyOption(m *Monitor) {
+	m.period = time.Duration(o)
+}
+
+// WithPeriod specifies the period between samples taken by Run.
+//
+// The default is 1 second.
+func WithPeriod(d time.Duration) Option {
+	return periodOption(d)
+}
+
+// Position is a geographic position, in decimal degrees.
+type Position struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// PositionSource provides the current position to be attached to records.
+//
+// Returns false if no position is currently available.
+type PositionSource func() (Position, bool)
+
+type positionSourceOption PositionSource
+
+func (o positionSourceOption) applyOption(m *Monitor) {
+	m.ps = PositionSource(o)
+}
+
+// WithPositionSource specifies a source of positions, such as a GNSS
+// receiver, to be attached to each record.
+//
+// By default records have no position.
+func WithPositionSource(ps PositionSource) Option {
+	return positionSourceOption(ps)
+}
+
+// Record is a sample of the serving cell engineering data.
+type Record struct {
+	// Time is the time the sample was taken.
+	Time time.Time
+
+	// Position is the position at the time the sample was taken, if a
+	// PositionSource is available and has a position, else nil.
+	Position *Position
+
+	// RAT is the radio access technology of the serving cell, e.g. GSM,
+	// WCDMA or LTE.
+	RAT string
+
+	// MCC is the mobile country code of the serving cell.
+	MCC string
+
+	// MNC is the mobile network code of the serving cell.
+	MNC string
+
+	// LAC is the location area code, or tracking area code for LTE, of the
+	// serving cell.
+	LAC string
+
+	// CellID is the identifier of the serving cell.
+	CellID string
+
+	// Fields is the complete set of fields reported by the modem, as the
+	// available fields vary by vendor and RAT.
+	Fields []string
+}
+
+// RecordHandler receives records sampled by Run.
+type RecordHandler func(Record)
+
+// ErrorHandler receives errors encountered by Run.
+type ErrorHandler func(error)
+
+var (
+	// ErrMalformedResponse indicates the modem returned a badly formed
+	// response.
+	ErrMalformedResponse = errors.New("modem returned malformed response")
+
+	// ErrNoServingCell indicates the modem did not report a serving cell.
+	ErrNoServingCell = errors.New("no serving cell")
+)
+
+// Init enables the engineering mode in the modem, if required by the dialect.
+func (m *Monitor) Init(options ...at.CommandOption) error {
+	if m.dialect == SIMCom {
+		_, err := m.Command("+CENG=1,1", options...)
+		return err
+	}
+	return nil
+}
+
+// Sample returns a record of the current serving cell engineering data.
+func (m *Monitor) Sample(options ...at.CommandOption) (Record, error) {
+	r := Record{Time: time.Now()}
+	var err error
+	switch m.dialect {
+	case SIMCom:
+		err = m.sampleSIMCom(&r, options)
+	case Telit:
+		err = m.sampleTelit(&r, options)
+	case Sierra:
+		err = m.sampleSierra(&r, options)
+	default:
+		err = m.sampleQuectel(&r, options)
+	}
+	if err != nil {
+		return r, err
+	}
+	if m.ps != nil {
+		if p, ok := m.ps(); ok {
+			r.Position = &p
+		}
+	}
+	return r, nil
+}
+
+// Run samples the serving cell at the configured period, passing the records
+// to the handler, until the context is done.
+//
+// Sampling errors are passed to the error handler, if provided, and do not
+// stop the monitor.
+func (m *Monitor) Run(ctx context.Context, h RecordHandler, eh ErrorHandler) error {
+	t := time.NewTicker(m.period)
+	defer t.Stop()
+	for {
+		r, err := m.Sample()
+		if err == nil {
+			h(r)
+		} else if eh != nil {
+			eh(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// field indices of the Quectel +QENG servingcell response, following the
+// "servingcell", state and RAT fields, by RAT.
+var quectelFields = map[string]struct {
+	mcc, mnc, lac, cellID int
+}{
+	"GSM":   {0, 1, 2, 3},
+	"WCDMA": {0, 1, 2, 3},
+	"LTE":   {1, 2, 9, 3},
+}
+
+func (m *Monitor) sampleQuectel(r *Record, options []at.CommandOption) error {
+	i, err := m.Command("+QENG=\"servingcell\"", options...)
+	if err != nil {
+		return err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+QENG") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+QENG"))
+		if len(fields) < 3 || fields[0] != "servingcell" {
+			continue
+		}
+		r.Fields = fields
+		if fields[1] == "SEARCH" || fields[1] == "LIMSRV" {
+			return ErrNoServingCell
+		}
+		r.RAT = fields[2]
+		idx, ok := quectelFields[r.RAT]
+		if !ok {
+			// unknown RAT - raw fields only
+			return nil
+		}
+		fields = fields[3:]
+		if len(fields) <= idx.lac || len(fields) <= idx.cellID {
+			return ErrMalformedResponse
+		}
+		r.MCC = fields[idx.mcc]
+		r.MNC = fields[idx.mnc]
+		r.LAC = fields[idx.lac]
+		r.CellID = fields[idx.cellID]
+		return nil
+	}
+	return ErrNoServingCell
+}
+
+func (m *Monitor) sampleSIMCom(r *Record, options []at.CommandOption) error {
+	i, err := m.Command("+CENG?", options...)
+	if err != nil {
+		return err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CENG") {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, "+CENG"))
+		// the serving cell is cell 0, with the cell info in a quoted string
+		if len(fields) != 2 || fields[0] != "0" {
+			continue
+		}
+		fields = info.Fields(fields[1])
+		r.Fields = fields
+		// arfcn,rxl,rxq,mcc,mnc,bsic,cellid,rla,txp,lac,TA
+		if len(fields) < 10 {
+			return ErrMalformedResponse
+		}
+		r.RAT = "GSM"
+		r.MCC = fields[3]
+		r.MNC = fields[4]
+		r.CellID = fields[6]
+		r.LAC = fields[9]
+		return nil
+	}
+	return ErrNoServingCell
+}
+
+func (m *Monitor) sampleTelit(r *Record, options []at.CommandOption) error {
+	mi, err := m.moni(options)
+	if err != nil {
+		return err
+	}
+	r.Fields = mi.fields
+	r.RAT = mi.rat
+	r.MCC = mi.values["Cc"]
+	r.MNC = mi.values["Nc"]
+	r.LAC = mi.lac()
+	r.CellID = mi.values["Id"]
+	return nil
+}
+
+// moniInfo is the serving cell reported by the Telit #MONI command.
+type moniInfo struct {
+	rat    string
+	fields []string
+	values map[string]string
+}
+
+// lac returns the location area code, or tracking area code for LTE.
+func (mi moniInfo) lac() string {
+	if lac, ok := mi.values["LAC"]; ok {
+		return lac
+	}
+	return mi.values["TAC"]
+}
+
+// channel returns the ARFCN, UARFCN or EARFCN.
+func (mi moniInfo) channel() string {
+	for _, k := range []string{"EARFCN", "UARFCN", "ARFCN"} {
+		if ch, ok := mi.values[k]; ok {
+			return ch
+		}
+	}
+	return ""
+}
+
+func (m *Monitor) moni(options []at.CommandOption) (moniInfo, error) {
+	i, err := m.Command("#MONI", options...)
+	if err != nil {
+		return moniInfo{}, err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "#MONI") {
+			continue
+		}
+		return parseMONI(info.TrimPrefix(l, "#MONI"))
+	}
+	return moniInfo{}, ErrNoServingCell
+}
+
+// parseMONI parses the serving cell reported by #MONI.
+//
+// The cell is reported as a sequence of key:value pairs, following either the
+// network name or the Cc and Nc pairs, and the keys vary by RAT, e.g.
+//
+//	Cc:505 Nc:01 BSIC:31 RxQual:0 LAC:02F3 Id:1A2B ARFCN:60 PWR:-70dbm TA:0
+//	Telstra RSRP:-95 RSRQ:-11 TAC:3B1 Id:8A3B21C EARFCN:3050 PWR:-65dbm DRX:64
+func parseMONI(l string) (moniInfo, error) {
+	mi := moniInfo{
+		fields: strings.Fields(l),
+		values: make(map[string]string),
+	}
+	for _, f := range mi.fields {
+		if idx := strings.Index(f, ":"); idx != -1 {
+			mi.values[f[:idx]] = f[idx+1:]
+		}
+	}
+	_, hasID := mi.values["Id"]
+	switch {
+	case len(mi.values) == 0:
+		return mi, ErrNoServingCell
+	case !hasID:
+		return mi, ErrMalformedResponse
+	}
+	switch {
+	case mi.values["RSRP"] != "":
+		mi.rat = "LTE"
+	case mi.values["RSCP"] != "" || mi.values["PSC"] != "":
+		mi.rat = "WCDMA"
+	case mi.values["BSIC"] != "":
+		mi.rat = "GSM"
+	}
+	return mi, nil
+}
+
+func (m *Monitor) sampleSierra(r *Record, options []at.CommandOption) error {
+	gs, err := m.gstatus(options)
+	r.Fields = gs.fields
+	if err != nil {
+		return err
+	}
+	r.RAT = gs.rat()
+	r.LAC = gs.lac()
+	r.CellID = gs.first("Cell ID")
+	return nil
+}
+
+// gstatus is the status reported by the Sierra !GSTATUS command.
+type gstatus struct {
+	fields []string
+	values map[string]string
+}
+
+// first returns the first word of the value, dropping any decimal rendering
+// following a hex value, e.g. "3B1 (945)" becomes "3B1".
+func (gs gstatus) first(key string) string {
+	if f := strings.Fields(gs.values[key]); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+func (gs gstatus) rat() string {
+	return normaliseRAT(gs.values["System mode"])
+}
+
+// lac returns the location area code, or tracking area code for LTE.
+func (gs gstatus) lac() string {
+	if lac := gs.first("LAC"); lac != "" {
+		return lac
+	}
+	return gs.first("TAC")
+}
+
+func (m *Monitor) gstatus(options []at.CommandOption) (gstatus, error) {
+	i, err := m.Command("!GSTATUS?", options...)
+	if err != nil {
+		return gstatus{}, err
+	}
+	gs := parseGSTATUS(i)
+	if len(gs.values) == 0 {
+		return gs, ErrMalformedResponse
+	}
+	switch strings.ToUpper(gs.values["System mode"]) {
+	case "", "NO SERVICE", "NONE":
+		return gs, ErrNoServingCell
+	}
+	return gs, nil
+}
+
+// parseGSTATUS parses the status reported by !GSTATUS.
+//
+// The status is reported over several lines, each containing one or two tab
+// separated "key: value" pairs, e.g.
+//
+//	System mode:   LTE        	PS state:    Attached
+//	LTE band:      B3     		LTE bw:      20 MHz
+//	Tx Power:      --		TAC:         3B1 (945)
+func parseGSTATUS(lines []string) gstatus {
+	gs := gstatus{values: make(map[string]string)}
+	for _, l := range lines {
+		if strings.HasPrefix(l, "!GSTATUS") {
+			continue
+		}
+		for _, f := range strings.Split(l, "\t") {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				continue
+			}
+			gs.fields = append(gs.fields, f)
+			idx := strings.Index(f, ":")
+			if idx == -1 {
+				continue
+			}
+			key := strings.TrimSpace(f[:idx])
+			if _, ok := gs.values[key]; !ok {
+				gs.values[key] = strings.TrimSpace(f[idx+1:])
+			}
+		}
+	}
+	return gs
+}
@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package monitor_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/monitor"
+)
+
+func TestSample(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect monitor.Dialect
+		cmd     string
+		rsp     []string
+		rec     monitor.Record
+		err     error
+	}{
+		{
+			"quectel lte",
+			monitor.Quectel,
+			"AT+QENG=\"servingcell\"\r\n",
+			[]string{"+QENG: \"servingcell\",\"NOCONN\",\"LTE\",\"FDD\",505,01,8A3B21C,123,3050,7,5,5,3B1,-95,-11,-65,12,30\r\n", "OK\r\n"},
+			monitor.Record{RAT: "LTE", MCC: "505", MNC: "01", LAC: "3B1", CellID: "8A3B21C"},
+			nil,
+		},
+		{
+			"quectel gsm",
+			monitor.Quectel,
+			"AT+QENG=\"servingcell\"\r\n",
+			[]string{"+QENG: \"servingcell\",\"NOCONN\",\"GSM\",505,01,2F3,1A2B,12,60,0,-70,255,255,0,38\r\n", "OK\r\n"},
+			monitor.Record{RAT: "GSM", MCC: "505", MNC: "01", LAC: "2F3", CellID: "1A2B"},
+			nil,
+		},
+		{
+			"quectel searching",
+			monitor.Quectel,
+			"AT+QENG=\"servingcell\"\r\n",
+			[]string{"+QENG: \"servingcell\",\"SEARCH\"\r\n", "OK\r\n"},
+			monitor.Record{},
+			monitor.ErrNoServingCell,
+		},
+		{
+			"quectel malformed",
+			monitor.Quectel,
+			"AT+QENG=\"servingcell\"\r\n",
+			[]string{"+QENG: \"servingcell\",\"NOCONN\",\"LTE\",\"FDD\",505\r\n", "OK\r\n"},
+			monitor.Record{RAT: "LTE"},
+			monitor.ErrMalformedResponse,
+		},
+		{
+			"simcom",
+			monitor.SIMCom,
+			"AT+CENG?\r\n",
+			[]string{"+CENG: 1,1\r\n", "\r\n", "+CENG: 0,\"0060,45,00,505,01,31,1a2b,44,05,02f3,255\"\r\n", "+CENG: 1,\"0052,30,32,0c1f,505,01,02f3\"\r\n", "OK\r\n"},
+			monitor.Record{RAT: "GSM", MCC: "505", MNC: "01", LAC: "02f3", CellID: "1a2b"},
+			nil,
+		},
+		{
+			"simcom no cell",
+			monitor.SIMCom,
+			"AT+CENG?\r\n",
+			[]string{"+CENG: 1,1\r\n", "OK\r\n"},
+			monitor.Record{},
+			monitor.ErrNoServingCell,
+		},
+		{
+			"telit gsm",
+			monitor.Telit,
+			"AT#MONI\r\n",
+			[]string{"#MONI: Cc:505 Nc:01 BSIC:31 RxQual:0 LAC:02F3 Id:1A2B ARFCN:60 PWR:-70dbm TA:0\r\n", "OK\r\n"},
+			monitor.Record{RAT: "GSM", MCC: "505", MNC: "01", LAC: "02F3", CellID: "1A2B"},
+			nil,
+		},
+		{
+			"telit lte",
+			monitor.Telit,
+			"AT#MONI\r\n",
+			[]string{"#MONI: Telstra Mobile RSRP:-95 RSRQ:-11 TAC:3B1 Id:8A3B21C EARFCN:3050 PWR:-65dbm DRX:64 pci:123 QRxLevMin:0\r\n", "OK\r\n"},
+			monitor.Record{RAT: "LTE", LAC: "3B1", CellID: "8A3B21C"},
+			nil,
+		},
+		{
+			"telit no cell",
+			monitor.Telit,
+			"AT#MONI\r\n",
+			[]string{"#MONI: \r\n", "OK\r\n"},
+			monitor.Record{},
+			monitor.ErrNoServingCell,
+		},
+		{
+			"telit malformed",
+			monitor.Telit,
+			"AT#MONI\r\n",
+			[]string{"#MONI: Cc:505 Nc:01 BSIC:31\r\n", "OK\r\n"},
+			monitor.Record{},
+			monitor.ErrMalformedResponse,
+		},
+		{
+			"sierra lte",
+			monitor.Sierra,
+			"AT!GSTATUS?\r\n",
+			[]string{
+				"!GSTATUS: \r\n",
+				"Current Time:  2044\t\tTemperature: 38\r\n",
+				"System mode:   LTE        \tPS state:    Attached     \r\n",
+				"LTE band:      B3     \t\tLTE bw:      20 MHz  \r\n",
+				"LTE Rx chan:   1275\t\tLTE Tx chan: 19275\r\n",
+				"PCC RxM RSSI:  -63\t\tRSRP (dBm):  -92\r\n",
+				"Tx Power:      --\t\tTAC:         3B1 (945)\r\n",
+				"RSRQ (dB):     -10.2\t\tCell ID:     08A3B21C (145011228)\r\n",
+				"OK\r\n",
+			},
+			monitor.Record{RAT: "LTE", LAC: "3B1", CellID: "08A3B21C"},
+			nil,
+		},
+		{
+			"sierra no service",
+			monitor.Sierra,
+			"AT!GSTATUS?\r\n",
+			[]string{"!GSTATUS: \r\n", "Current Time:  2044\t\tTemperature: 38\r\n", "System mode:   NO SERVICE\tPS state:    Detached\r\n", "OK\r\n"},
+			monitor.Record{},
+			monitor.ErrNoServingCell,
+		},
+		{
+			"error",
+			monitor.Quectel,
+			"AT+QENG=\"servingcell\"\r\n",
+			[]string{"ERROR\r\n"},
+			monitor.Record{},
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			m, mm := setupModem(t, map[string][]string{p.cmd: p.rsp}, p.dialect)
+			defer teardownModem(mm)
+			rec, err := m.Sample()
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.rec.RAT, rec.RAT)
+			assert.Equal(t, p.rec.MCC, rec.MCC)
+			assert.Equal(t, p.rec.MNC, rec.MNC)
+			assert.Equal(t, p.rec.LAC, rec.LAC)
+			assert.Equal(t, p.rec.CellID, rec.CellID)
+			assert.Nil(t, rec.Position)
+			assert.False(t, rec.Time.IsZero())
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestRun(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QENG=\"servingcell\"\r\n": {"+QENG: \"servingcell\",\"NOCONN\",\"GSM\",505,01,2F3,1A2B,12,60,0,-70,255,255,0,38\r\n", "OK\r\n"},
+	}
+	pos := monitor.Position{Latitude: -27.47, Longitude: 153.02}
+	ps := func() (monitor.Position, bool) {
+		return pos, true
+	}
+	m, mm := setupModem(t, cmdSet, monitor.Quectel,
+		monitor.WithPeriod(10*time.Millisecond),
+		monitor.WithPositionSource(ps))
+	defer teardownModem(mm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var recs []monitor.Record
+	h := func(r monitor.Record) {
+		recs = append(recs, r)
+		if len(recs) == 3 {
+			cancel()
+		}
+	}
+	eh := func(err error) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- m.Run(ctx, h, eh)
+	}()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for Run")
+	}
+	require.Len(t, recs, 3)
+	for _, r := range recs {
+		require.NotNil(t, r.Position)
+		assert.Equal(t, pos, *r.Position)
+		assert.Equal(t, "1A2B", r.CellID)
+	}
+	assert.True(t, recs[0].Time.Before(recs[2].Time))
+}
+
+func TestInit(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CENG=1,1\r\n": {"OK\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet, monitor.SIMCom)
+	defer teardownModem(mm)
+	assert.Nil(t, m.Init())
+
+	// noop for Quectel
+	m, mm = setupModem(t, nil, monitor.Quectel)
+	defer teardownModem(mm)
+	assert.Nil(t, m.Init())
+}
+
+type mockModem struct {
+	cmdSet map[string][]string
+	closed bool
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if data == nil {
+		return 0, at.ErrClosed
+	}
+	copy(p, data) // assumes p is empty
+	if !ok {
+		return len(data), fmt.Errorf("closed with data")
+	}
+	return len(data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	if mm.closed {
+		return 0, at.ErrClosed
+	}
+	v := mm.cmdSet[string(p)]
+	if len(v) == 0 {
+		mm.r <- []byte("\r\nERROR\r\n")
+	} else {
+		for _, l := range v {
+			mm.r <- []byte(l)
+		}
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) Close() error {
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
+
+func setupModem(t *testing.T, cmdSet map[string][]string, d monitor.Dialect, options ...monitor.Option) (*monitor.Monitor, *mockModem) {
+	mm := &mockModem{cmdSet: cmdSet, r: make(chan []byte, 10)}
+	m := monitor.New(at.New(mm), d, options...)
+	require.NotNil(t, m)
+	return m, mm
+}
+
+func teardownModem(mm *mockModem) {
+	mm.Close()
+}
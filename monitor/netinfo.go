@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package monitor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// NetworkInfo describes the network currently serving the modem.
+type NetworkInfo struct {
+	// Time is the time the information was retrieved.
+	Time time.Time
+
+	// RAT is the radio access technology, normalised to GSM, WCDMA,
+	// TDSCDMA, LTE or NB-IoT.
+	RAT string
+
+	// Operator is the numeric identifier of the operator, being the MCC
+	// followed by the MNC.
+	Operator string
+
+	// OperatorName is the name of the operator, if resolved using the table
+	// provided by WithOperatorNames.
+	OperatorName string
+
+	// Band is the band in use, as reported by the modem, e.g. "LTE BAND 3".
+	Band string
+
+	// Channel is the absolute radio frequency channel number, i.e. the
+	// ARFCN, UARFCN or EARFCN, of the serving cell.
+	Channel string
+
+	// LAC is the location area code, or tracking area code for LTE, of the
+	// serving cell, if known.
+	LAC string
+
+	// CellID is the identifier of the serving cell, if known.
+	CellID string
+
+	// Fields is the complete set of fields reported by the modem.
+	Fields []string
+}
+
+// NetworkInfoHandler receives the network information refreshed by
+// WatchNetworkInfo.
+type NetworkInfoHandler func(NetworkInfo)
+
+// NetworkInfo returns the current network information.
+//
+// Quectel modems report via +QNWINFO, supplemented by the serving cell from
+// +QENG, SIMCom modems via +CPSI, Telit modems via #MONI, which does not
+// report the band, and Sierra modems via !GSTATUS, supplemented by the
+// operator from +COPS.
+//
+// The operator is reported numerically, so the OperatorName is only set if a
+// table has been provided using WithOperatorNames.
+//
+// Returns ErrNoServingCell if the modem has no service.
+func (m *Monitor) NetworkInfo(options ...at.CommandOption) (NetworkInfo, error) {
+	ni := NetworkInfo{Time: time.Now()}
+	var err error
+	switch m.dialect {
+	case SIMCom:
+		err = m.networkInfoSIMCom(&ni, options)
+	case Telit:
+		err = m.networkInfoTelit(&ni, options)
+	case Sierra:
+		err = m.networkInfoSierra(&ni, options)
+	default:
+		err = m.networkInfoQuectel(&ni, options)
+	}
+	if m.operators != nil && ni.Operator != "" {
+		ni.OperatorName = m.operators[ni.Operator]
+	}
+	return ni, err
+}
+
+// WatchNetworkInfo enables registration indications in the modem and passes
+// the refreshed network information to the handler whenever the registration,
+// including the serving cell, changes.
+//
+// Errors refreshing the information are passed to the error handler, if
+// provided.
+//
+// The +CREG: responses to AT+CREG? continue to be returned to the command
+// while the indications are enabled.
+func (m *Monitor) WatchNetworkInfo(h NetworkInfoHandler, eh ErrorHandler, options ...at.CommandOption) error {
+	rh := func([]string) {
+		ni, err := m.NetworkInfo(options...)
+		if err == nil {
+			h(ni)
+		} else if eh != nil {
+			eh(err)
+		}
+	}
+	if err := m.AddIndication("+CREG:", rh, at.WithResponseFilter(isCREGResponse)); err != nil {
+		return err
+	}
+	if _, err := m.Command("+CREG=2", options...); err != nil {
+		m.CancelIndication("+CREG:")
+		return err
+	}
+	return nil
+}
+
+// StopWatchingNetworkInfo disables registration indications in the modem and
+// removes the handler.
+func (m *Monitor) StopWatchingNetworkInfo(options ...at.CommandOption) error {
+	m.CancelIndication("+CREG:")
+	_, err := m.Command("+CREG=0", options...)
+	return err
+}
+
+// isCREGResponse returns true if the line is a response to AT+CREG?, i.e.
+//
+//	+CREG: <n>,<stat>[,<lac>,<ci>[,<AcT>]]
+//
+// rather than an indication, i.e.
+//
+//	+CREG: <stat>[,<lac>,<ci>[,<AcT>]]
+//
+// where the second field, if any, is the quoted lac.
+func isCREGResponse(line string) bool {
+	fields := strings.Split(info.TrimPrefix(line, "+CREG"), ",")
+	if len(fields) < 2 {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+	return err == nil
+}
+
+// normaliseRAT maps the vendor specific access technology to one of the RATs
+// described in NetworkInfo.
+func normaliseRAT(act string) string {
+	act = strings.ToUpper(act)
+	switch {
+	case strings.HasSuffix(act, "LTE") || act == "CAT-M" || act == "EMTC":
+		return "LTE"
+	case act == "CAT-NB" || act == "NB-IOT":
+		return "NB-IoT"
+	case act == "TDSCDMA" || act == "TD-SCDMA":
+		return "TDSCDMA"
+	case act == "WCDMA" || strings.HasPrefix(act, "HS"):
+		return "WCDMA"
+	case act == "GSM" || act == "GPRS" || act == "EDGE":
+		return "GSM"
+	}
+	return act
+}
+
+func (m *Monitor) networkInfoQuectel(ni *NetworkInfo, options []at.CommandOption) error {
+	i, err := m.Command("+QNWINFO", options...)
+	if err != nil {
+		return err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+QNWINFO") {
+			continue
+		}
+		// <act>,<oper>,<band>,<channel>
+		fields := info.Fields(info.TrimPrefix(l, "+QNWINFO"))
+		ni.Fields = fields
+		if len(fields) > 0 && strings.EqualFold(fields[0], "No Service") {
+			return ErrNoServingCell
+		}
+		if len(fields) < 4 {
+			return ErrMalformedResponse
+		}
+		ni.RAT = normaliseRAT(fields[0])
+		ni.Operator = fields[1]
+		ni.Band = fields[2]
+		ni.Channel = fields[3]
+		// +QNWINFO does not report the cell, so pull it from the serving
+		// cell engineering data, if available.
+		var r Record
+		if m.sampleQuectel(&r, options) == nil {
+			ni.LAC = r.LAC
+			ni.CellID = r.CellID
+		}
+		return nil
+	}
+	return ErrNoServingCell
+}
+
+// field indices of the SIMCom +CPSI response, by RAT.
+var simcomFields = map[string]struct {
+	band, channel int
+}{
+	"GSM":   {5, 5},
+	"WCDMA": {5, 7},
+	"LTE":   {6, 7},
+}
+
+func (m *Monitor) networkInfoSIMCom(ni *NetworkInfo, options []at.CommandOption) error {
+	i, err := m.Command("+CPSI?", options...)
+	if err != nil {
+		return err
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, "+CPSI") {
+			continue
+		}
+		// <mode>,<status>,<mcc>-<mnc>,<lac>,<cellid>,...
+		fields := info.Fields(info.TrimPrefix(l, "+CPSI"))
+		ni.Fields = fields
+		if len(fields) > 0 && strings.EqualFold(fields[0], "NO SERVICE") {
+			return ErrNoServingCell
+		}
+		if len(fields) < 5 {
+			return ErrMalformedResponse
+		}
+		ni.RAT = normaliseRAT(fields[0])
+		ni.Operator = strings.Replace(fields[2], "-", "", 1)
+		ni.LAC = strings.TrimPrefix(strings.ToLower(fields[3]), "0x")
+		ni.CellID = fields[4]
+		idx, ok := simcomFields[ni.RAT]
+		if !ok {
+			// unknown RAT - raw fields only
+			return nil
+		}
+		if len(fields) <= idx.band || len(fields) <= idx.channel {
+			return ErrMalformedResponse
+		}
+		ni.Band = fields[idx.band]
+		ni.Channel = fields[idx.channel]
+		if ni.RAT == "GSM" {
+			// the GSM ARFCN and band share a field, e.g. "60 EGSM 900"
+			if sp := strings.Index(ni.Band, " "); sp != -1 {
+				ni.Channel = ni.Band[:sp]
+				ni.Band = ni.Band[sp+1:]
+			}
+		}
+		return nil
+	}
+	return ErrNoServingCell
+}
+
+func (m *Monitor) networkInfoTelit(ni *NetworkInfo, options []at.CommandOption) error {
+	mi, err := m.moni(options)
+	ni.Fields = mi.fields
+	if err != nil {
+		return err
+	}
+	ni.RAT = mi.rat
+	ni.Operator = mi.values["Cc"] + mi.values["Nc"]
+	ni.Channel = mi.channel()
+	ni.LAC = mi.lac()
+	ni.CellID = mi.values["Id"]
+	return nil
+}
+
+func (m *Monitor) networkInfoSierra(ni *NetworkInfo, options []at.CommandOption) error {
+	gs, err := m.gstatus(options)
+	ni.Fields = gs.fields
+	if err != nil {
+		return err
+	}
+	ni.RAT = gs.rat()
+	ni.LAC = gs.lac()
+	ni.CellID = gs.first("Cell ID")
+	// the keys for the band and channel are prefixed with the RAT, and the
+	// LTE channel is reported for both directions.
+	for _, prefix := range []string{"LTE", "WCDMA", "GSM"} {
+		if band, ok := gs.values[prefix+" band"]; ok {
+			ni.Band = band
+			ni.Channel = gs.first(prefix + " channel")
+			if ni.Channel == "" {
+				ni.Channel = gs.first(prefix + " Rx chan")
+			}
+			break
+		}
+	}
+	// !GSTATUS does not report the operator, so pull it from +COPS, if
+	// reported in numeric form.
+	if i, err := m.Command("+COPS?", options...); err == nil {
+		for _, l := range i {
+			if !info.HasPrefix(l, "+COPS") {
+				continue
+			}
+			fields := info.Fields(info.TrimPrefix(l, "+COPS"))
+			if len(fields) > 2 && fields[1] == "2" {
+				ni.Operator = fields[2]
+			}
+		}
+	}
+	return nil
+}
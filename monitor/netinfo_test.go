@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package monitor_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/monitor"
+)
+
+const qengLTE = "+QENG: \"servingcell\",\"NOCONN\",\"LTE\",\"FDD\",460,11,B289604,257,1825,3,5,5,5A1E,-95,-11,-65,12,30\r\n"
+
+func TestNetworkInfo(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect monitor.Dialect
+		cmdSet  map[string][]string
+		ni      monitor.NetworkInfo
+		err     error
+	}{
+		{
+			"quectel lte",
+			monitor.Quectel,
+			map[string][]string{
+				"AT+QNWINFO\r\n":              {"+QNWINFO: \"FDD LTE\",\"46011\",\"LTE BAND 3\",1825\r\n", "OK\r\n"},
+				"AT+QENG=\"servingcell\"\r\n": {qengLTE, "OK\r\n"},
+			},
+			monitor.NetworkInfo{RAT: "LTE", Operator: "46011", Band: "LTE BAND 3", Channel: "1825", LAC: "5A1E", CellID: "B289604"},
+			nil,
+		},
+		{
+			"quectel no engineering data",
+			monitor.Quectel,
+			map[string][]string{
+				"AT+QNWINFO\r\n": {"+QNWINFO: \"EDGE\",\"50501\",\"GSM 900\",60\r\n", "OK\r\n"},
+			},
+			monitor.NetworkInfo{RAT: "GSM", Operator: "50501", Band: "GSM 900", Channel: "60"},
+			nil,
+		},
+		{
+			"telit lte",
+			monitor.Telit,
+			map[string][]string{
+				"AT#MONI\r\n": {"#MONI: Cc:460 Nc:11 RSRP:-95 RSRQ:-11 TAC:5A1E Id:B289604 EARFCN:1825 PWR:-65dbm DRX:64\r\n", "OK\r\n"},
+			},
+			monitor.NetworkInfo{RAT: "LTE", Operator: "46011", Channel: "1825", LAC: "5A1E", CellID: "B289604"},
+			nil,
+		},
+		{
+			"sierra lte",
+			monitor.Sierra,
+			map[string][]string{
+				"AT!GSTATUS?\r\n": []string{
+					"!GSTATUS: \r\n",
+					"Current Time:  2044\t\tTemperature: 38\r\n",
+					"System mode:   LTE        \tPS state:    Attached     \r\n",
+					"LTE band:      B3     \t\tLTE bw:      20 MHz  \r\n",
+					"LTE Rx chan:   1275\t\tLTE Tx chan: 19275\r\n",
+					"PCC RxM RSSI:  -63\t\tRSRP (dBm):  -92\r\n",
+					"Tx Power:      --\t\tTAC:         3B1 (945)\r\n",
+					"RSRQ (dB):     -10.2\t\tCell ID:     08A3B21C (145011228)\r\n",
+					"OK\r\n",
+				},
+				"AT+COPS?\r\n": {"+COPS: 0,2,\"50501\",7\r\n", "OK\r\n"},
+			},
+			monitor.NetworkInfo{RAT: "LTE", Operator: "50501", Band: "B3", Channel: "1275", LAC: "3B1", CellID: "08A3B21C"},
+			nil,
+		},
+		{
+			"sierra wcdma",
+			monitor.Sierra,
+			map[string][]string{
+				"AT!GSTATUS?\r\n": {
+					"!GSTATUS: \r\n",
+					"System mode:   WCDMA      \tPS state:    Attached\r\n",
+					"WCDMA band:    WCDMA 2100\r\n",
+					"WCDMA channel: 10713\r\n",
+					"LAC:           A19F (41375)\tCell ID:     00B309D8 (11733464)\r\n",
+					"OK\r\n",
+				},
+			},
+			monitor.NetworkInfo{RAT: "WCDMA", Band: "WCDMA 2100", Channel: "10713", LAC: "A19F", CellID: "00B309D8"},
+			nil,
+		},
+		{
+			"quectel no service",
+			monitor.Quectel,
+			map[string][]string{
+				"AT+QNWINFO\r\n": {"+QNWINFO: No Service\r\n", "OK\r\n"},
+			},
+			monitor.NetworkInfo{},
+			monitor.ErrNoServingCell,
+		},
+		{
+			"quectel malformed",
+			monitor.Quectel,
+			map[string][]string{
+				"AT+QNWINFO\r\n": {"+QNWINFO: \"FDD LTE\",\"46011\"\r\n", "OK\r\n"},
+			},
+			monitor.NetworkInfo{},
+			monitor.ErrMalformedResponse,
+		},
+		{
+			"simcom lte",
+			monitor.SIMCom,
+			map[string][]string{
+				"AT+CPSI?\r\n": {"+CPSI: LTE,Online,460-11,0x5A1E,187214340,257,EUTRAN-BAND3,1825,5,5,-94,-850,-545,15\r\n", "OK\r\n"},
+			},
+			monitor.NetworkInfo{RAT: "LTE", Operator: "46011", Band: "EUTRAN-BAND3", Channel: "1825", LAC: "5a1e", CellID: "187214340"},
+			nil,
+		},
+		{
+			"simcom gsm",
+			monitor.SIMCom,
+			map[string][]string{
+				"AT+CPSI?\r\n": {"+CPSI: GSM,Online,505-01,0x02f3,6699,60 EGSM 900,-64,2110,42-42\r\n", "OK\r\n"},
+			},
+			monitor.NetworkInfo{RAT: "GSM", Operator: "50501", Band: "EGSM 900", Channel: "60", LAC: "02f3", CellID: "6699"},
+			nil,
+		},
+		{
+			"simcom wcdma",
+			monitor.SIMCom,
+			map[string][]string{
+				"AT+CPSI?\r\n": {"+CPSI: WCDMA,Online,505-01,0xA19F,11733464,WCDMA IMT 2000,279,10663,0,6,58,26,39,500\r\n", "OK\r\n"},
+			},
+			monitor.NetworkInfo{RAT: "WCDMA", Operator: "50501", Band: "WCDMA IMT 2000", Channel: "10663", LAC: "a19f", CellID: "11733464"},
+			nil,
+		},
+		{
+			"simcom no service",
+			monitor.SIMCom,
+			map[string][]string{
+				"AT+CPSI?\r\n": {"+CPSI: NO SERVICE,Online\r\n", "OK\r\n"},
+			},
+			monitor.NetworkInfo{},
+			monitor.ErrNoServingCell,
+		},
+		{
+			"error",
+			monitor.SIMCom,
+			nil,
+			monitor.NetworkInfo{},
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			m, mm := setupModem(t, p.cmdSet, p.dialect)
+			defer teardownModem(mm)
+			ni, err := m.NetworkInfo()
+			assert.Equal(t, p.err, err)
+			if err != nil {
+				return
+			}
+			assert.False(t, ni.Time.IsZero())
+			assert.NotEmpty(t, ni.Fields)
+			ni.Time = time.Time{}
+			ni.Fields = nil
+			assert.Equal(t, p.ni, ni)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestWatchNetworkInfo(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CREG=2\r\n": {"OK\r\n"},
+		"AT+CREG=0\r\n": {"OK\r\n"},
+		"AT+CREG?\r\n":  {"+CREG: 0\r\n", "+CREG: 2,1,\"5A1E\",\"B289604\",7\r\n", "OK\r\n"},
+		"AT+CPSI?\r\n":  {"+CPSI: LTE,Online,460-11,0x5A1E,187214340,257,EUTRAN-BAND3,1825,5,5,-94,-850,-545,15\r\n", "OK\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet, monitor.SIMCom)
+	defer teardownModem(mm)
+
+	c := make(chan monitor.NetworkInfo, 1)
+	h := func(ni monitor.NetworkInfo) {
+		c <- ni
+	}
+	eh := func(err error) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := m.WatchNetworkInfo(h, eh)
+	require.Nil(t, err)
+
+	mm.r <- []byte("+CREG: 1,\"5A1E\",\"B289604\",7\r\n")
+	select {
+	case ni := <-c:
+		assert.Equal(t, "LTE", ni.RAT)
+		assert.Equal(t, "187214340", ni.CellID)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no network info received")
+	}
+
+	// the response is returned to the command, while the indication
+	// received during the command is still handled.
+	i, err := m.Command("+CREG?")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"+CREG: 2,1,\"5A1E\",\"B289604\",7"}, i)
+	select {
+	case <-c:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no network info received")
+	}
+
+	err = m.StopWatchingNetworkInfo()
+	assert.Nil(t, err)
+	mm.r <- []byte("+CREG: 0\r\n")
+	select {
+	case ni := <-c:
+		t.Errorf("network info received after stop: %v", ni)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// error
+	m, mm = setupModem(t, nil, monitor.Quectel)
+	defer teardownModem(mm)
+	err = m.WatchNetworkInfo(h, eh)
+	assert.Equal(t, at.ErrError, err)
+}
@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package monitor
+
+// OperatorNames maps numeric operator identifiers, being the MCC followed by
+// the MNC, e.g. "50501", to the names of the operators.
+type OperatorNames map[string]string
+
+// Name returns the name of the operator, or the identifier itself if the
+// operator is not in the table.
+func (o OperatorNames) Name(id string) string {
+	if n, ok := o[id]; ok {
+		return n
+	}
+	return id
+}
+
+// BundledOperatorNames returns a table of the names of the major operators in
+// a selection of countries.
+//
+// The table is not exhaustive, so applications requiring complete coverage
+// should extend it, or provide their own.  The returned table is a copy, so
+// may be freely extended.
+func BundledOperatorNames() OperatorNames {
+	o := make(OperatorNames, len(bundledOperators))
+	for k, v := range bundledOperators {
+		o[k] = v
+	}
+	return o
+}
+
+type operatorNamesOption OperatorNames
+
+func (o operatorNamesOption) applyOption(m *Monitor) {
+	m.operators = OperatorNames(o)
+}
+
+// WithOperatorNames specifies a table used to resolve the numeric operator
+// reported in NetworkInfo to the name of the operator.
+//
+// The bundled table, from BundledOperatorNames, may be used directly, or
+// extended with additional operators.
+//
+// By default the operator name is not resolved.
+func WithOperatorNames(o OperatorNames) Option {
+	return operatorNamesOption(o)
+}
+
+var bundledOperators = map[string]string{
+	// Australia
+	"50501": "Telstra",
+	"50502": "Optus",
+	"50503": "Vodafone",
+
+	// Austria
+	"23201": "A1",
+	"23203": "Magenta",
+	"23210": "3",
+
+	// Belgium
+	"20601": "Proximus",
+	"20610": "Orange",
+	"20620": "BASE",
+
+	// Brazil
+	"72402": "TIM",
+	"72405": "Claro",
+	"72406": "Vivo",
+	"72410": "Vivo",
+	"72411": "Vivo",
+	"72431": "Oi",
+
+	// Canada
+	"302220": "Telus",
+	"302610": "Bell",
+	"302720": "Rogers",
+
+	// China
+	"46000": "China Mobile",
+	"46001": "China Unicom",
+	"46002": "China Mobile",
+	"46003": "China Telecom",
+	"46007": "China Mobile",
+	"46011": "China Telecom",
+
+	// Denmark
+	"23801": "TDC",
+	"23802": "Telenor",
+	"23820": "Telia",
+
+	// France
+	"20801": "Orange",
+	"20810": "SFR",
+	"20815": "Free",
+	"20820": "Bouygues",
+
+	// Germany
+	"26201": "Telekom",
+	"26202": "Vodafone",
+	"26203": "O2",
+
+	// Indonesia
+	"51001": "Indosat",
+	"51010": "Telkomsel",
+	"51011": "XL",
+
+	// Ireland
+	"27201": "Vodafone",
+	"27202": "3",
+	"27205": "3",
+
+	// Italy
+	"22201": "TIM",
+	"22210": "Vodafone",
+	"22250": "Iliad",
+	"22288": "WINDTRE",
+
+	// Japan
+	"44010": "NTT docomo",
+	"44020": "SoftBank",
+	"44050": "au",
+
+	// Malaysia
+	"50212": "Maxis",
+	"50213": "Celcom",
+	"50216": "DiGi",
+	"50219": "Celcom",
+
+	// Mexico
+	"334020": "Telcel",
+	"334050": "AT&T",
+
+	// Netherlands
+	"20404": "Vodafone",
+	"20408": "KPN",
+	"20416": "T-Mobile",
+
+	// New Zealand
+	"53001": "One NZ",
+	"53005": "Spark",
+	"53024": "2degrees",
+
+	// Norway
+	"24201": "Telenor",
+	"24202": "Telia",
+
+	// Philippines
+	"51502": "Globe",
+	"51503": "Smart",
+
+	// Poland
+	"26001": "Plus",
+	"26002": "T-Mobile",
+	"26003": "Orange",
+	"26006": "Play",
+
+	// Russia
+	"25001": "MTS",
+	"25002": "MegaFon",
+	"25099": "Beeline",
+
+	// Singapore
+	"52501": "Singtel",
+	"52503": "M1",
+	"52505": "StarHub",
+
+	// South Africa
+	"65501": "Vodacom",
+	"65507": "Cell C",
+	"65510": "MTN",
+
+	// South Korea
+	"45005": "SK Telecom",
+	"45006": "LG U+",
+	"45008": "KT",
+
+	// Spain
+	"21401": "Vodafone",
+	"21403": "Orange",
+	"21404": "Yoigo",
+	"21407": "Movistar",
+
+	// Sweden
+	"24001": "Telia",
+	"24007": "Tele2",
+	"24008": "Telenor",
+
+	// Switzerland
+	"22801": "Swisscom",
+	"22802": "Sunrise",
+	"22803": "Salt",
+
+	// Taiwan
+	"46601": "Far EasTone",
+	"46692": "Chunghwa Telecom",
+	"46697": "Taiwan Mobile",
+
+	// Thailand
+	"52001": "AIS",
+	"52004": "True",
+	"52005": "dtac",
+
+	// Turkey
+	"28601": "Turkcell",
+	"28602": "Vodafone",
+	"28603": "Türk Telekom",
+
+	// United Kingdom
+	"23410": "O2",
+	"23415": "Vodafone",
+	"23420": "3",
+	"23430": "EE",
+	"23433": "EE",
+
+	// United States
+	"310260": "T-Mobile",
+	"310410": "AT&T",
+	"311480": "Verizon",
+
+	// Vietnam
+	"45201": "MobiFone",
+	"45202": "Vinaphone",
+	"45204": "Viettel",
+	"45205": "Vietnamobile",
+}
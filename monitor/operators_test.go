@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package monitor_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/monitor"
+)
+
+func TestOperatorNames(t *testing.T) {
+	o := monitor.BundledOperatorNames()
+	assert.Equal(t, "Telstra", o.Name("50501"))
+	assert.Equal(t, "T-Mobile", o.Name("310260"))
+	assert.Equal(t, "99999", o.Name("99999"))
+
+	// copy
+	o["50501"] = "Telecom Australia"
+	assert.Equal(t, "Telstra", monitor.BundledOperatorNames().Name("50501"))
+}
+
+func TestWithOperatorNames(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QNWINFO\r\n": {"+QNWINFO: \"EDGE\",\"50501\",\"GSM 900\",60\r\n", "OK\r\n"},
+		"AT+CPSI?\r\n":   {"+CPSI: GSM,Online,999-99,0x02f3,6699,60,EGSM 900,-76,0,34-34\r\n", "OK\r\n"},
+	}
+	m, mm := setupModem(t, cmdSet, monitor.Quectel,
+		monitor.WithOperatorNames(monitor.BundledOperatorNames()))
+	defer teardownModem(mm)
+	ni, err := m.NetworkInfo()
+	require.Nil(t, err)
+	assert.Equal(t, "50501", ni.Operator)
+	assert.Equal(t, "Telstra", ni.OperatorName)
+
+	// unknown operator
+	o := monitor.OperatorNames{"50501": "Telecom Australia"}
+	m, mm = setupModem(t, cmdSet, monitor.SIMCom, monitor.WithOperatorNames(o))
+	defer teardownModem(mm)
+	ni, err = m.NetworkInfo()
+	require.Nil(t, err)
+	assert.Equal(t, "99999", ni.Operator)
+	assert.Equal(t, "", ni.OperatorName)
+
+	// no table
+	m, mm = setupModem(t, cmdSet, monitor.Quectel)
+	defer teardownModem(mm)
+	ni, err = m.NetworkInfo()
+	require.Nil(t, err)
+	assert.Equal(t, "", ni.OperatorName)
+}
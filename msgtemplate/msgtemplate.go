@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package msgtemplate renders outbound SMS messages from localized templates,
+// and reports the alphabet and number of SMS segments the rendered message
+// will be sent in, so the cost of a message is known before it is sent.
+//
+// Templates use the text/template syntax, e.g.
+//
+//	s := msgtemplate.New()
+//	s.Add("otp", "en", "Your code is {{.Code}}")
+//	s.Add("otp", "de", "Ihr Code lautet {{.Code}}")
+//	r, err := s.Render("otp", "de-AT", map[string]string{"Code": "123456"})
+package msgtemplate
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+// Set is a collection of named templates, each of which may be provided in
+// several locales.
+type Set struct {
+	fallback string
+	eOpts    []sms.EncoderOption
+	funcs    template.FuncMap
+
+	mu        sync.RWMutex
+	templates map[string]map[string]*template.Template
+}
+
+// Option is a construction option for the Set.
+type Option interface {
+	applyOption(*Set)
+}
+
+// New creates a new, empty, Set.
+func New(options ...Option) *Set {
+	s := Set{
+		fallback:  "en",
+		templates: make(map[string]map[string]*template.Template),
+	}
+	for _, option := range options {
+		option.applyOption(&s)
+	}
+	return &s
+}
+
+type fallbackOption string
+
+func (o fallbackOption) applyOption(s *Set) {
+	s.fallback = string(o)
+}
+
+// WithFallbackLocale specifies the locale used when a template is not
+// available in the requested locale.
+//
+// The default is "en".
+func WithFallbackLocale(locale string) Option {
+	return fallbackOption(locale)
+}
+
+type encoderOption struct {
+	eo sms.EncoderOption
+}
+
+func (o encoderOption) applyOption(s *Set) {
+	s.eOpts = append(s.eOpts, o.eo)
+}
+
+// WithEncoderOption specifies options used when estimating the encoding of
+// rendered messages, such as the national language character sets, and
+// should match those provided to the sender, e.g. gsm.WithEncoderOption.
+func WithEncoderOption(eo sms.EncoderOption) Option {
+	return encoderOption{eo}
+}
+
+type funcsOption template.FuncMap
+
+func (o funcsOption) applyOption(s *Set) {
+	s.funcs = template.FuncMap(o)
+}
+
+// WithFuncs specifies functions available to templates added to the Set.
+func WithFuncs(funcs template.FuncMap) Option {
+	return funcsOption(funcs)
+}
+
+// Add parses the text and adds it to the set as the named template for the
+// locale, replacing any existing template for that name and locale.
+func (s *Set) Add(name, locale, text string) error {
+	t := template.New(name)
+	if s.funcs != nil {
+		t = t.Funcs(s.funcs)
+	}
+	t, err := t.Parse(text)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.templates[name]
+	if !ok {
+		l = make(map[string]*template.Template)
+		s.templates[name] = l
+	}
+	l[normaliseLocale(locale)] = t
+	return nil
+}
+
+// Rendered is a message rendered from a template.
+type Rendered struct {
+	// Text is the rendered message.
+	Text string
+
+	// Locale is the locale of the template used, which may differ from that
+	// requested.
+	Locale string
+
+	// Alphabet is the alphabet the message will be encoded in.
+	Alphabet tpdu.Alphabet
+
+	// Segments is the number of SMS segments, i.e. PDUs, the message will be
+	// sent in.
+	Segments int
+}
+
+// Render renders the named template for the locale with the data.
+//
+// If the template is not available in the locale then the base language of
+// the locale is tried, e.g. "pt" for "pt-BR", followed by the fallback
+// locale.
+func (s *Set) Render(name, locale string, data interface{}) (Rendered, error) {
+	t, locale := s.lookup(name, locale)
+	if t == nil {
+		return Rendered{}, ErrNoTemplate
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return Rendered{}, err
+	}
+	r := Rendered{Text: b.String(), Locale: locale}
+	pdus, err := sms.Encode([]byte(r.Text), s.eOpts...)
+	if err != nil {
+		return r, err
+	}
+	r.Segments = len(pdus)
+	if len(pdus) > 0 {
+		r.Alphabet, _ = pdus[0].DCS.Alphabet()
+	}
+	return r, nil
+}
+
+// lookup returns the best matching template for the locale, and the locale
+// of that template.
+func (s *Set) lookup(name, locale string) (*template.Template, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.templates[name]
+	if !ok {
+		return nil, ""
+	}
+	locale = normaliseLocale(locale)
+	candidates := []string{locale}
+	if idx := strings.Index(locale, "-"); idx != -1 {
+		candidates = append(candidates, locale[:idx])
+	}
+	candidates = append(candidates, normaliseLocale(s.fallback))
+	for _, c := range candidates {
+		if t, ok := l[c]; ok {
+			return t, c
+		}
+	}
+	return nil, ""
+}
+
+// normaliseLocale converts the locale to lowercase with hyphen separators, so
+// "pt_BR" and "pt-br" are equivalent.
+func normaliseLocale(locale string) string {
+	return strings.ToLower(strings.Replace(locale, "_", "-", -1))
+}
+
+var (
+	// ErrNoTemplate indicates the named template is not available in the
+	// requested or fallback locales.
+	ErrNoTemplate = errors.New("no template")
+)
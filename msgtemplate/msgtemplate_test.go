@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package msgtemplate_test
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/msgtemplate"
+	"github.com/warthog618/sms"
+	"github.com/warthog618/sms/encoding/gsm7/charset"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestRender(t *testing.T) {
+	s := msgtemplate.New()
+	require.Nil(t, s.Add("otp", "en", "Your code is {{.Code}}"))
+	require.Nil(t, s.Add("otp", "de", "Ihr Code lautet {{.Code}}"))
+	require.Nil(t, s.Add("otp", "pt_BR", "Seu código é {{.Code}}"))
+	require.Nil(t, s.Add("otp", "ru", "Ваш код {{.Code}}"))
+	require.Nil(t, s.Add("long", "en", "{{.}}"))
+	data := map[string]string{"Code": "123456"}
+
+	patterns := []struct {
+		name   string
+		tmpl   string
+		locale string
+		data   interface{}
+		r      msgtemplate.Rendered
+		err    error
+	}{
+		{
+			"exact",
+			"otp",
+			"de",
+			data,
+			msgtemplate.Rendered{Text: "Ihr Code lautet 123456", Locale: "de", Alphabet: tpdu.Alpha7Bit, Segments: 1},
+			nil,
+		},
+		{
+			"base language",
+			"otp",
+			"de-AT",
+			data,
+			msgtemplate.Rendered{Text: "Ihr Code lautet 123456", Locale: "de", Alphabet: tpdu.Alpha7Bit, Segments: 1},
+			nil,
+		},
+		{
+			"normalised",
+			"otp",
+			"pt-br",
+			data,
+			msgtemplate.Rendered{Text: "Seu código é 123456", Locale: "pt-br", Alphabet: tpdu.AlphaUCS2, Segments: 1},
+			nil,
+		},
+		{
+			"fallback",
+			"otp",
+			"fr",
+			data,
+			msgtemplate.Rendered{Text: "Your code is 123456", Locale: "en", Alphabet: tpdu.Alpha7Bit, Segments: 1},
+			nil,
+		},
+		{
+			"ucs2",
+			"otp",
+			"ru",
+			data,
+			msgtemplate.Rendered{Text: "Ваш код 123456", Locale: "ru", Alphabet: tpdu.AlphaUCS2, Segments: 1},
+			nil,
+		},
+		{
+			"multipart 7bit",
+			"long",
+			"en",
+			strings.Repeat("a", 161),
+			msgtemplate.Rendered{Text: strings.Repeat("a", 161), Locale: "en", Alphabet: tpdu.Alpha7Bit, Segments: 2},
+			nil,
+		},
+		{
+			"multipart ucs2",
+			"long",
+			"en",
+			strings.Repeat("я", 71),
+			msgtemplate.Rendered{Text: strings.Repeat("я", 71), Locale: "en", Alphabet: tpdu.AlphaUCS2, Segments: 2},
+			nil,
+		},
+		{
+			"no template",
+			"missing",
+			"en",
+			data,
+			msgtemplate.Rendered{},
+			msgtemplate.ErrNoTemplate,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			r, err := s.Render(p.tmpl, p.locale, p.data)
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, p.r, r)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestFallbackLocale(t *testing.T) {
+	s := msgtemplate.New(msgtemplate.WithFallbackLocale("de"))
+	require.Nil(t, s.Add("otp", "de", "Ihr Code lautet {{.}}"))
+	r, err := s.Render("otp", "en", "42")
+	require.Nil(t, err)
+	assert.Equal(t, "Ihr Code lautet 42", r.Text)
+
+	// no fallback
+	s = msgtemplate.New()
+	require.Nil(t, s.Add("otp", "de", "Ihr Code lautet {{.}}"))
+	_, err = s.Render("otp", "fr", "42")
+	assert.Equal(t, msgtemplate.ErrNoTemplate, err)
+}
+
+func TestAdd(t *testing.T) {
+	s := msgtemplate.New()
+	err := s.Add("bad", "en", "{{.Code")
+	assert.NotNil(t, err)
+	_, err = s.Render("bad", "en", nil)
+	assert.Equal(t, msgtemplate.ErrNoTemplate, err)
+
+	// replace
+	require.Nil(t, s.Add("hi", "en", "hi"))
+	require.Nil(t, s.Add("hi", "EN", "hello"))
+	r, err := s.Render("hi", "en", nil)
+	require.Nil(t, err)
+	assert.Equal(t, "hello", r.Text)
+
+	// execution error
+	require.Nil(t, s.Add("exec", "en", "{{.Code.Missing}}"))
+	_, err = s.Render("exec", "en", struct{ Code int }{})
+	assert.NotNil(t, err)
+}
+
+func TestWithFuncs(t *testing.T) {
+	funcs := template.FuncMap{"upper": strings.ToUpper}
+	s := msgtemplate.New(msgtemplate.WithFuncs(funcs))
+	require.Nil(t, s.Add("shout", "en", "{{upper .}}"))
+	r, err := s.Render("shout", "en", "hello")
+	require.Nil(t, err)
+	assert.Equal(t, "HELLO", r.Text)
+}
+
+func TestWithEncoderOption(t *testing.T) {
+	msg := "Çok güzel ğ"
+	s := msgtemplate.New()
+	require.Nil(t, s.Add("tr", "tr", msg))
+	r, err := s.Render("tr", "tr", nil)
+	require.Nil(t, err)
+	assert.Equal(t, tpdu.AlphaUCS2, r.Alphabet)
+
+	s = msgtemplate.New(msgtemplate.WithEncoderOption(sms.WithCharset(charset.Turkish)))
+	require.Nil(t, s.Add("tr", "tr", msg))
+	r, err = s.Render("tr", "tr", nil)
+	require.Nil(t, err)
+	assert.Equal(t, tpdu.Alpha7Bit, r.Alphabet)
+	assert.Equal(t, 1, r.Segments)
+}
@@ -0,0 +1,243 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package poll provides a coordinator for the periodic queries of several
+// subsystems, such as signal, registration, battery and temperature, that
+// share the one AT channel.
+//
+// Rather than each subsystem running its own ticker, and the queries
+// contending for the port, the Poller issues at most one query per time
+// slot, running the most overdue query first, so queries are interleaved
+// and spread over time.
+package poll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/at"
+)
+
+// Poller coordinates periodic queries over the AT modem.
+type Poller struct {
+	*at.AT
+	slot time.Duration
+	eh   ErrorHandler
+
+	mu      sync.Mutex
+	queries map[string]*entry
+	kick    chan struct{}
+}
+
+// Handler receives the info returned by a query.
+//
+// Handlers are called from the Run goroutine, so should not block.
+type Handler func(info []string) error
+
+// ErrorHandler receives errors encountered by queries.
+type ErrorHandler func(error)
+
+// Query is a command to be issued periodically.
+type Query struct {
+	// Name identifies the query.
+	Name string
+
+	// Cmd is the AT command issued, excluding the AT prefix.
+	Cmd string
+
+	// Period is the period between queries.
+	Period time.Duration
+
+	// Handler receives the info returned by the command.
+	Handler Handler
+}
+
+type entry struct {
+	Query
+	due time.Time
+}
+
+// Option is a construction option for the Poller.
+type Option interface {
+	applyOption(*Poller)
+}
+
+// New creates a new Poller for the modem.
+func New(a *at.AT, options ...Option) *Poller {
+	p := Poller{
+		AT:      a,
+		slot:    100 * time.Millisecond,
+		queries: make(map[string]*entry),
+		kick:    make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option.applyOption(&p)
+	}
+	return &p
+}
+
+type slotOption time.Duration
+
+func (o slotOption) applyOption(p *Poller) {
+	p.slot = time.Duration(o)
+}
+
+// WithSlot specifies the minimum time between queries, so other users of
+// the AT channel are not starved.
+//
+// The default is 100ms.
+func WithSlot(d time.Duration) Option {
+	return slotOption(d)
+}
+
+func (o ErrorHandler) applyOption(p *Poller) {
+	p.eh = o
+}
+
+// WithErrorHandler specifies a handler for errors returned by queries.
+//
+// By default errors are discarded.
+func WithErrorHandler(h ErrorHandler) Option {
+	return h
+}
+
+// Subscribe adds a query to the set polled.
+//
+// The first query is issued as soon as a slot is available.
+func (p *Poller) Subscribe(q Query) error {
+	if q.Period <= 0 {
+		return ErrInvalidPeriod
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.queries[q.Name]; ok {
+		return ErrSubscriptionExists
+	}
+	p.queries[q.Name] = &entry{Query: q, due: time.Now()}
+	p.signal()
+	return nil
+}
+
+// Unsubscribe removes the named query from the set polled.
+func (p *Poller) Unsubscribe(name string) {
+	p.mu.Lock()
+	delete(p.queries, name)
+	p.mu.Unlock()
+}
+
+// Run issues the subscribed queries as they fall due, until the context is
+// done.
+//
+// Query errors are passed to the error handler, if provided, and do not stop
+// the poller.
+func (p *Poller) Run(ctx context.Context) error {
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.AT.Closed():
+			return ErrClosed
+		case <-p.kick:
+		case <-t.C:
+		}
+		if q, ok := p.next(); ok {
+			p.issue(q)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(p.slot):
+			}
+		}
+		// wait for the next query, or for a change in subscriptions.
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		t.Reset(p.untilDue())
+	}
+}
+
+// next returns the most overdue query, if any, and schedules its next
+// query.
+func (p *Poller) next() (Query, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	var e *entry
+	for _, q := range p.queries {
+		if q.due.After(now) {
+			continue
+		}
+		if e == nil || q.due.Before(e.due) {
+			e = q
+		}
+	}
+	if e == nil {
+		return Query{}, false
+	}
+	// schedule from the due time, not now, so the period does not drift,
+	// unless the query has fallen more than a period behind.
+	e.due = e.due.Add(e.Period)
+	if e.due.Before(now) {
+		e.due = now.Add(e.Period)
+	}
+	return e.Query, true
+}
+
+// untilDue returns the time until the next query is due.
+func (p *Poller) untilDue() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d := time.Hour
+	now := time.Now()
+	for _, q := range p.queries {
+		if w := q.due.Sub(now); w < d {
+			d = w
+		}
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+func (p *Poller) issue(q Query) {
+	i, err := p.Command(q.Cmd)
+	if err == nil && q.Handler != nil {
+		err = q.Handler(i)
+	}
+	if err != nil && p.eh != nil {
+		p.eh(fmt.Errorf("%s: %w", q.Name, err))
+	}
+}
+
+func (p *Poller) signal() {
+	select {
+	case p.kick <- struct{}{}:
+	default:
+	}
+}
+
+var (
+	// ErrClosed indicates the modem has been closed.
+	ErrClosed = errors.New("closed")
+
+	// ErrInvalidPeriod indicates the period of a query is not positive.
+	ErrInvalidPeriod = errors.New("invalid period")
+
+	// ErrMalformedResponse indicates the modem returned a badly formed
+	// response.
+	ErrMalformedResponse = errors.New("modem returned malformed response")
+
+	// ErrSubscriptionExists indicates a query with the name is already
+	// subscribed.
+	ErrSubscriptionExists = errors.New("subscription exists")
+)
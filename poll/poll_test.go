@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package poll_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/poll"
+)
+
+var cmdSet = map[string][]string{
+	"AT+CSQ\r\n":      {"+CSQ: 20,0\r\n", "OK\r\n"},
+	"AT+CREG?\r\n":    {"+CREG: 0,5\r\n", "OK\r\n"},
+	"AT+CBC\r\n":      {"+CBC: 1,75,3950\r\n", "OK\r\n"},
+	"AT+QTEMP\r\n":    {"+QTEMP: 31,35,33\r\n", "OK\r\n"},
+	"AT+CPMUTEMP\r\n": {"+CPMUTEMP: 28\r\n", "OK\r\n"},
+}
+
+func TestQueries(t *testing.T) {
+	var rssi, ber, stat, qtemp, stemp int
+	var batt poll.Battery
+	queries := []poll.Query{
+		poll.Signal(time.Hour, func(r, b int) { rssi, ber = r, b }),
+		poll.Registration(time.Hour, func(s int) { stat = s }),
+		poll.BatteryStatus(time.Hour, func(b poll.Battery) { batt = b }),
+		poll.Temperature(poll.Quectel, time.Hour, func(t int) { qtemp = t }),
+		poll.Temperature(poll.SIMCom, time.Hour, func(t int) { stemp = t }),
+	}
+	for _, q := range queries {
+		err := q.Handler(cmdSet["AT"+q.Cmd+"\r\n"][:1])
+		assert.Nil(t, err, q.Cmd)
+		err = q.Handler([]string{q.Cmd + ": bad"})
+		assert.Equal(t, poll.ErrMalformedResponse, err, q.Cmd)
+	}
+	assert.Equal(t, 20, rssi)
+	assert.Equal(t, 0, ber)
+	assert.Equal(t, 5, stat)
+	assert.Equal(t, poll.Battery{Charging: true, Level: 75, Voltage: 3950}, batt)
+	assert.Equal(t, 35, qtemp)
+	assert.Equal(t, 28, stemp)
+}
+
+func TestRun(t *testing.T) {
+	p, mm := setupModem(t, cmdSet, poll.WithSlot(5*time.Millisecond))
+	defer teardownModem(mm)
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	count := func(name string) {
+		mu.Lock()
+		counts[name]++
+		mu.Unlock()
+	}
+	require.Nil(t, p.Subscribe(poll.Signal(20*time.Millisecond, func(int, int) { count("signal") })))
+	require.Nil(t, p.Subscribe(poll.Registration(20*time.Millisecond, func(int) { count("registration") })))
+	require.Nil(t, p.Subscribe(poll.BatteryStatus(time.Hour, func(poll.Battery) { count("battery") })))
+	err := p.Subscribe(poll.Signal(time.Second, func(int, int) {}))
+	assert.Equal(t, poll.ErrSubscriptionExists, err)
+	err = p.Subscribe(poll.Query{Name: "zero", Cmd: "+CSQ"})
+	assert.Equal(t, poll.ErrInvalidPeriod, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 110*time.Millisecond)
+	defer cancel()
+	err = p.Run(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, counts["battery"])
+	assert.GreaterOrEqual(t, counts["signal"], 4)
+	assert.LessOrEqual(t, counts["signal"], 7)
+	assert.GreaterOrEqual(t, counts["registration"], 4)
+	assert.LessOrEqual(t, counts["registration"], 7)
+
+	// queries are separated by at least the slot
+	times := mm.times()
+	for i := 1; i < len(times); i++ {
+		assert.GreaterOrEqual(t, int64(times[i].Sub(times[i-1])), int64(5*time.Millisecond))
+	}
+}
+
+func TestSubscribeWhileRunning(t *testing.T) {
+	p, mm := setupModem(t, cmdSet, poll.WithSlot(time.Millisecond))
+	defer teardownModem(mm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+	c := make(chan int, 1)
+	time.Sleep(10 * time.Millisecond)
+	require.Nil(t, p.Subscribe(poll.Signal(time.Hour, func(r, b int) { c <- r })))
+	select {
+	case r := <-c:
+		assert.Equal(t, 20, r)
+	case <-time.After(100 * time.Millisecond):
+		t.Error("query not issued")
+	}
+	p.Unsubscribe("signal")
+	// resubscribe once removed
+	assert.Nil(t, p.Subscribe(poll.Signal(time.Hour, func(r, b int) {})))
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestErrorHandler(t *testing.T) {
+	errs := make(chan error, 2)
+	eh := func(err error) {
+		errs <- err
+	}
+	p, mm := setupModem(t, cmdSet, poll.WithErrorHandler(eh))
+	defer teardownModem(mm)
+
+	require.Nil(t, p.Subscribe(poll.Query{Name: "fail", Cmd: "+FAIL", Period: time.Hour}))
+	herr := errors.New("handler failed")
+	require.Nil(t, p.Subscribe(poll.Query{
+		Name:    "handler",
+		Cmd:     "+CSQ",
+		Period:  time.Hour,
+		Handler: func([]string) error { return herr },
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	go p.Run(ctx)
+	defer cancel()
+	got := []error{}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			got = append(got, err)
+		case <-time.After(time.Second):
+			t.Fatal("no error received")
+		}
+	}
+	var cmdErr, handlerErr error
+	for _, err := range got {
+		if errors.Is(err, at.ErrError) {
+			cmdErr = err
+		} else {
+			handlerErr = err
+		}
+	}
+	require.NotNil(t, cmdErr)
+	assert.Equal(t, "fail: ERROR", cmdErr.Error())
+	assert.True(t, errors.Is(handlerErr, herr))
+}
+
+func TestRunClosed(t *testing.T) {
+	p, mm := setupModem(t, cmdSet)
+	teardownModem(mm)
+	select {
+	case <-p.Closed():
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("modem not closed")
+	}
+	err := p.Run(context.Background())
+	assert.Equal(t, poll.ErrClosed, err)
+}
+
+type mockModem struct {
+	cmdSet map[string][]string
+	closed bool
+	mu     sync.Mutex
+	ts     []time.Time
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if data == nil {
+		return 0, at.ErrClosed
+	}
+	copy(p, data) // assumes p is empty
+	if !ok {
+		return len(data), fmt.Errorf("closed with data")
+	}
+	return len(data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	if mm.closed {
+		return 0, at.ErrClosed
+	}
+	mm.mu.Lock()
+	mm.ts = append(mm.ts, time.Now())
+	mm.mu.Unlock()
+	v := mm.cmdSet[string(p)]
+	if len(v) == 0 {
+		mm.r <- []byte("\r\nERROR\r\n")
+	} else {
+		for _, l := range v {
+			mm.r <- []byte(l)
+		}
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) Close() error {
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
+
+func (mm *mockModem) times() []time.Time {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return append([]time.Time(nil), mm.ts...)
+}
+
+func setupModem(t *testing.T, cmdSet map[string][]string, options ...poll.Option) (*poll.Poller, *mockModem) {
+	mm := &mockModem{cmdSet: cmdSet, r: make(chan []byte, 10)}
+	p := poll.New(at.New(mm), options...)
+	require.NotNil(t, p)
+	return p, mm
+}
+
+func teardownModem(mm *mockModem) {
+	mm.Close()
+}
@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package poll
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/warthog618/modem/info"
+)
+
+// Dialect identifies the vendor specific command set supported by the modem,
+// where a query is not standardised.
+type Dialect int
+
+const (
+	// Quectel modems.
+	Quectel Dialect = iota
+
+	// SIMCom modems.
+	SIMCom
+)
+
+// Signal queries the signal quality using +CSQ, passing the rssi and ber to
+// the handler.
+func Signal(period time.Duration, h func(rssi, ber int)) Query {
+	return Query{
+		Name:   "signal",
+		Cmd:    "+CSQ",
+		Period: period,
+		Handler: func(i []string) error {
+			v, err := parseInts(i, "+CSQ", 2)
+			if err != nil {
+				return err
+			}
+			h(v[0], v[1])
+			return nil
+		},
+	}
+}
+
+// Registration queries the network registration status using +CREG, passing
+// the stat to the handler.
+func Registration(period time.Duration, h func(stat int)) Query {
+	return Query{
+		Name:   "registration",
+		Cmd:    "+CREG?",
+		Period: period,
+		Handler: func(i []string) error {
+			v, err := parseInts(i, "+CREG", 2)
+			if err != nil {
+				return err
+			}
+			h(v[1])
+			return nil
+		},
+	}
+}
+
+// Battery is the battery status reported by +CBC.
+type Battery struct {
+	// Charging is true if the battery is being charged.
+	Charging bool
+
+	// Level is the charge level, as a percentage.
+	Level int
+
+	// Voltage is the battery voltage, in mV.
+	Voltage int
+}
+
+// BatteryStatus queries the battery status using +CBC, passing it to the
+// handler.
+func BatteryStatus(period time.Duration, h func(Battery)) Query {
+	return Query{
+		Name:   "battery",
+		Cmd:    "+CBC",
+		Period: period,
+		Handler: func(i []string) error {
+			v, err := parseInts(i, "+CBC", 3)
+			if err != nil {
+				return err
+			}
+			h(Battery{Charging: v[0] == 1, Level: v[1], Voltage: v[2]})
+			return nil
+		},
+	}
+}
+
+// Temperature queries the temperature of the modem, passing it to the
+// handler, in degrees Celsius.
+//
+// Quectel modems report via +QTEMP, and SIMCom modems via +CPMUTEMP.  Where
+// the modem reports several sensors the highest temperature is reported.
+func Temperature(d Dialect, period time.Duration, h func(int)) Query {
+	cmd, prefix := "+QTEMP", "+QTEMP"
+	if d == SIMCom {
+		cmd, prefix = "+CPMUTEMP", "+CPMUTEMP"
+	}
+	return Query{
+		Name:   "temperature",
+		Cmd:    cmd,
+		Period: period,
+		Handler: func(i []string) error {
+			found := false
+			max := 0
+			for _, l := range i {
+				if !info.HasPrefix(l, prefix) {
+					continue
+				}
+				// +QTEMP: <pmic>,<xo>,<pa>, +QTEMP: "<sensor>","<temp>", or
+				// +CPMUTEMP: <temp>
+				for _, f := range info.Fields(info.TrimPrefix(l, prefix)) {
+					t, err := strconv.Atoi(f)
+					if err != nil {
+						continue
+					}
+					if !found || t > max {
+						max = t
+					}
+					found = true
+				}
+			}
+			if !found {
+				return ErrMalformedResponse
+			}
+			h(max)
+			return nil
+		},
+	}
+}
+
+// parseInts returns the first n integer fields of the info line with the
+// prefix.
+func parseInts(i []string, prefix string, n int) ([]int, error) {
+	for _, l := range i {
+		if !info.HasPrefix(l, prefix) {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, prefix))
+		if len(fields) < n {
+			break
+		}
+		v := make([]int, n)
+		for idx := range v {
+			var err error
+			if v[idx], err = strconv.Atoi(fields[idx]); err != nil {
+				return nil, ErrMalformedResponse
+			}
+		}
+		return v, nil
+	}
+	return nil, ErrMalformedResponse
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package ppp
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// HDLC-like framing, as per RFC 1662.
+const (
+	flag       = 0x7e
+	escape     = 0x7d
+	escapeMask = 0x20
+	address    = 0xff
+	control    = 0x03
+	goodFCS    = 0xf0b8
+	initFCS    = 0xffff
+)
+
+var fcsTable [256]uint16
+
+func init() {
+	for b := 0; b < 256; b++ {
+		v := uint16(b)
+		for i := 0; i < 8; i++ {
+			if v&1 != 0 {
+				v = (v >> 1) ^ 0x8408
+			} else {
+				v >>= 1
+			}
+		}
+		fcsTable[b] = v
+	}
+}
+
+func fcs16(fcs uint16, data []byte) uint16 {
+	for _, b := range data {
+		fcs = (fcs >> 8) ^ fcsTable[(fcs^uint16(b))&0xff]
+	}
+	return fcs
+}
+
+// encodeFrame wraps the protocol and information field in an HDLC frame.
+//
+// All control characters are escaped, irrespective of the negotiated ACCM,
+// as that is always acceptable to the peer.
+func encodeFrame(proto uint16, info []byte) []byte {
+	raw := make([]byte, 0, len(info)+6)
+	raw = append(raw, address, control, byte(proto>>8), byte(proto))
+	raw = append(raw, info...)
+	fcs := fcs16(initFCS, raw) ^ 0xffff
+	raw = append(raw, byte(fcs), byte(fcs>>8))
+	frame := make([]byte, 0, 2*len(raw)+2)
+	frame = append(frame, flag)
+	for _, b := range raw {
+		if b < 0x20 || b == flag || b == escape {
+			frame = append(frame, escape, b^escapeMask)
+		} else {
+			frame = append(frame, b)
+		}
+	}
+	return append(frame, flag)
+}
+
+// frameReader splits a byte stream into PPP frames.
+type frameReader struct {
+	r   io.Reader
+	buf []byte
+	in  []byte
+}
+
+func newFrameReader(r io.Reader) *frameReader {
+	return &frameReader{r: r, in: make([]byte, 0, 1600)}
+}
+
+// readFrame returns the protocol and information field of the next valid
+// frame.
+//
+// Frames with bad checksums are silently discarded, as are the address and
+// control fields, and compressed protocol fields are expanded.
+func (fr *frameReader) readFrame() (uint16, []byte, error) {
+	escaped := false
+	for {
+		if len(fr.buf) == 0 {
+			b := make([]byte, 1600)
+			n, err := fr.r.Read(b)
+			if n == 0 && err != nil {
+				return 0, nil, err
+			}
+			fr.buf = b[:n]
+		}
+		b := fr.buf[0]
+		fr.buf = fr.buf[1:]
+		switch {
+		case b == flag:
+			in := fr.in
+			fr.in = fr.in[:0]
+			escaped = false
+			if proto, info, ok := decodeFrame(in); ok {
+				return proto, info, nil
+			}
+		case b == escape:
+			escaped = true
+		case escaped:
+			fr.in = append(fr.in, b^escapeMask)
+			escaped = false
+		default:
+			fr.in = append(fr.in, b)
+		}
+	}
+}
+
+// decodeFrame checks the FCS of the unescaped frame and extracts the protocol
+// and information field.
+func decodeFrame(raw []byte) (uint16, []byte, bool) {
+	if len(raw) < 4 || fcs16(initFCS, raw) != goodFCS {
+		return 0, nil, false
+	}
+	raw = raw[:len(raw)-2]
+	if len(raw) >= 2 && raw[0] == address && raw[1] == control {
+		raw = raw[2:]
+	}
+	if len(raw) == 0 {
+		return 0, nil, false
+	}
+	// protocol field compression
+	if raw[0]&1 == 1 {
+		info := make([]byte, len(raw)-1)
+		copy(info, raw[1:])
+		return uint16(raw[0]), info, true
+	}
+	if len(raw) < 2 {
+		return 0, nil, false
+	}
+	info := make([]byte, len(raw)-2)
+	copy(info, raw[2:])
+	return binary.BigEndian.Uint16(raw), info, true
+}
@@ -0,0 +1,196 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package ppp
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// option is a configuration option of a control protocol.
+type option struct {
+	kind byte
+	data []byte
+}
+
+func encodeOptions(opts []option) []byte {
+	var b []byte
+	for _, o := range opts {
+		b = append(b, o.kind, byte(len(o.data)+2))
+		b = append(b, o.data...)
+	}
+	return b
+}
+
+func parseOptions(b []byte) ([]option, bool) {
+	var opts []option
+	for len(b) > 0 {
+		if len(b) < 2 || b[1] < 2 || int(b[1]) > len(b) {
+			return nil, false
+		}
+		opts = append(opts, option{b[0], b[2:b[1]]})
+		b = b[b[1]:]
+	}
+	return opts, true
+}
+
+// LCP options.
+const (
+	lcpMRU   = 1
+	lcpACCM  = 2
+	lcpAuth  = 3
+	lcpMagic = 5
+	lcpPFC   = 7
+	lcpACFC  = 8
+)
+
+// the CHAP algorithm supported, MD5.
+const chapMD5 = 5
+
+type lcpOptions struct {
+	l        *Link
+	noMagic  bool
+	peerAuth uint16
+}
+
+func (o *lcpOptions) request() []option {
+	if o.noMagic {
+		return nil
+	}
+	magic := make([]byte, 4)
+	binary.BigEndian.PutUint32(magic, o.l.magic)
+	return []option{{lcpMagic, magic}}
+}
+
+func (o *lcpOptions) nak(opts []option) {
+	for _, opt := range opts {
+		if opt.kind == lcpMagic {
+			o.l.magic = newMagic()
+		}
+	}
+}
+
+func (o *lcpOptions) reject(opts []option) {
+	for _, opt := range opts {
+		if opt.kind == lcpMagic {
+			o.noMagic = true
+		}
+	}
+}
+
+func (o *lcpOptions) check(opts []option) (nak []option, rej []option) {
+	for _, opt := range opts {
+		switch opt.kind {
+		case lcpMRU, lcpACCM, lcpMagic, lcpPFC, lcpACFC:
+			// all acceptable, as the link always escapes control characters
+			// and does not compress its own frames.
+		case lcpAuth:
+			if len(opt.data) < 2 {
+				rej = append(rej, opt)
+				continue
+			}
+			switch binary.BigEndian.Uint16(opt.data) {
+			case protoPAP:
+			case protoCHAP:
+				if len(opt.data) != 3 || opt.data[2] != chapMD5 {
+					nak = append(nak, option{lcpAuth, []byte{0xc0, 0x23}})
+				}
+			default:
+				nak = append(nak, option{lcpAuth, []byte{0xc0, 0x23}})
+			}
+		default:
+			rej = append(rej, opt)
+		}
+	}
+	return
+}
+
+func (o *lcpOptions) accepted(opts []option) {
+	o.l.auth = 0
+	for _, opt := range opts {
+		if opt.kind == lcpAuth {
+			o.l.auth = binary.BigEndian.Uint16(opt.data)
+		}
+	}
+}
+
+// IPCP options.
+const (
+	ipcpAddress = 3
+	ipcpDNS1    = 129
+	ipcpDNS2    = 131
+)
+
+type ipcpOptions struct {
+	l    *Link
+	opts []option
+}
+
+func (o *ipcpOptions) request() []option {
+	if o.opts == nil {
+		for _, kind := range []byte{ipcpAddress, ipcpDNS1, ipcpDNS2} {
+			o.opts = append(o.opts, option{kind, make([]byte, 4)})
+		}
+	}
+	o.update()
+	return o.opts
+}
+
+// update records the addresses currently requested in the link.
+func (o *ipcpOptions) update() {
+	o.l.DNS = nil
+	for _, opt := range o.opts {
+		ip := net.IP(opt.data)
+		switch opt.kind {
+		case ipcpAddress:
+			o.l.IP = ip
+		default:
+			if !ip.Equal(net.IPv4zero) {
+				o.l.DNS = append(o.l.DNS, ip)
+			}
+		}
+	}
+}
+
+func (o *ipcpOptions) nak(opts []option) {
+	for _, opt := range opts {
+		if len(opt.data) != 4 {
+			continue
+		}
+		for i := range o.opts {
+			if o.opts[i].kind == opt.kind {
+				o.opts[i].data = append([]byte(nil), opt.data...)
+			}
+		}
+	}
+}
+
+func (o *ipcpOptions) reject(opts []option) {
+	for _, opt := range opts {
+		for i := range o.opts {
+			if o.opts[i].kind == opt.kind {
+				o.opts = append(o.opts[:i], o.opts[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (o *ipcpOptions) check(opts []option) (nak []option, rej []option) {
+	for _, opt := range opts {
+		if opt.kind != ipcpAddress || len(opt.data) != 4 {
+			rej = append(rej, opt)
+		}
+	}
+	return
+}
+
+func (o *ipcpOptions) accepted(opts []option) {
+	for _, opt := range opts {
+		if opt.kind == ipcpAddress {
+			o.l.PeerIP = net.IP(append([]byte(nil), opt.data...))
+		}
+	}
+}
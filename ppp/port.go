@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package ppp
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// port serialises reads from the modem port, so a read blocked waiting for
+// frames can be interrupted and the port handed back to the call to hang up.
+type port struct {
+	rw     io.ReadWriter
+	chunks chan []byte
+	buf    []byte
+	err    error
+
+	mu     sync.Mutex
+	halted bool
+	intr   chan struct{}
+	done   chan struct{}
+}
+
+var errInterrupted = errors.New("interrupted")
+
+func newPort(rw io.ReadWriter) *port {
+	p := &port{
+		rw:     rw,
+		chunks: make(chan []byte),
+		intr:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go p.readLoop()
+	return p
+}
+
+func (p *port) readLoop() {
+	for {
+		b := make([]byte, 1600)
+		n, err := p.rw.Read(b)
+		if n > 0 {
+			select {
+			case p.chunks <- b[:n]:
+			case <-p.done:
+				return
+			}
+		}
+		if err != nil {
+			p.err = err
+			close(p.chunks)
+			return
+		}
+	}
+}
+
+// Read reads from the port, or returns errInterrupted if interrupted while
+// waiting for data.
+func (p *port) Read(b []byte) (int, error) {
+	if len(p.buf) == 0 {
+		p.mu.Lock()
+		halted, intr := p.halted, p.intr
+		p.mu.Unlock()
+		if halted {
+			return 0, errInterrupted
+		}
+		select {
+		case chunk, ok := <-p.chunks:
+			if !ok {
+				return 0, p.err
+			}
+			p.buf = chunk
+		case <-intr:
+			return 0, errInterrupted
+		}
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	return n, nil
+}
+
+func (p *port) Write(b []byte) (int, error) {
+	return p.rw.Write(b)
+}
+
+// interrupt unblocks a pending Read, and fails subsequent Reads until
+// resumed.
+func (p *port) interrupt() {
+	p.mu.Lock()
+	if !p.halted {
+		p.halted = true
+		close(p.intr)
+	}
+	p.mu.Unlock()
+}
+
+// resume allows Reads following an interrupt.
+func (p *port) resume() {
+	p.mu.Lock()
+	if p.halted {
+		p.halted = false
+		p.intr = make(chan struct{})
+	}
+	p.mu.Unlock()
+}
+
+// close stops reading from the underlying port, though a read may remain
+// pending until the port returns data or is closed.
+func (p *port) close() {
+	close(p.done)
+}
@@ -0,0 +1,688 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package ppp provides a PPP client for packet data connections made through
+// the modem, so host routed data can be used without an external pppd.
+//
+// The client negotiates the link (LCP), authenticates using PAP or CHAP if
+// required by the modem, and negotiates the IPv4 address and DNS servers
+// (IPCP).  The resulting link exchanges IPv4 packets, which may be passed to
+// a TUN device or a userspace IP stack.
+//
+// As with the csd package, once connected the modem port carries the data
+// stream, so the link takes exclusive control of the port.
+package ppp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/csd"
+)
+
+// Protocol numbers.
+const (
+	protoIPv4 = 0x0021
+	protoIPCP = 0x8021
+	protoLCP  = 0xc021
+	protoPAP  = 0xc023
+	protoCHAP = 0xc223
+)
+
+// Control protocol codes.
+const (
+	configureRequest = 1
+	configureAck     = 2
+	configureNak     = 3
+	configureReject  = 4
+	terminateRequest = 5
+	terminateAck     = 6
+	codeReject       = 7
+	protocolReject   = 8
+	echoRequest      = 9
+	echoReply        = 10
+	discardRequest   = 11
+)
+
+// The restart timer and retransmission limit, as per RFC 1661.
+const (
+	restartTime  = 3 * time.Second
+	maxConfigure = 10
+)
+
+// Link is a negotiated PPP link.
+type Link struct {
+	// IP is the IPv4 address assigned to the link.
+	IP net.IP
+
+	// PeerIP is the IPv4 address of the peer, if provided.
+	PeerIP net.IP
+
+	// DNS is the set of DNS servers provided by the peer.
+	DNS []net.IP
+
+	rw     io.ReadWriter
+	closer func() error
+	cfg    config
+	magic  uint32
+	rx     chan packet
+	pkts   chan []byte
+	done   chan struct{}
+
+	// closed when the readLoop exits.
+	readDone chan struct{}
+
+	// the identifier of the last control packet sent.
+	id byte
+
+	// the authentication protocol requested by the peer, if any.
+	auth     uint16
+	termAck  chan struct{}
+	wmu      sync.Mutex
+	mu       sync.Mutex
+	err      error
+	closeMu  sync.Mutex
+	isClosed bool
+}
+
+type packet struct {
+	proto uint16
+	info  []byte
+}
+
+type config struct {
+	contextID int
+	user      string
+	password  string
+	timeout   time.Duration
+	ph        PacketHandler
+}
+
+// Option is a construction option for Dialup and Negotiate.
+type Option interface {
+	applyOption(*config)
+}
+
+type contextIDOption int
+
+func (o contextIDOption) applyOption(c *config) {
+	c.contextID = int(o)
+}
+
+// WithContextID specifies the PDP context dialed by Dialup.
+//
+// The default is 1.
+func WithContextID(id int) Option {
+	return contextIDOption(id)
+}
+
+type credentialsOption struct {
+	user     string
+	password string
+}
+
+func (o credentialsOption) applyOption(c *config) {
+	c.user = o.user
+	c.password = o.password
+}
+
+// WithCredentials specifies the user and password used if the modem requires
+// authentication.
+//
+// By default both are empty, which most modems accept.
+func WithCredentials(user, password string) Option {
+	return credentialsOption{user, password}
+}
+
+type timeoutOption time.Duration
+
+func (o timeoutOption) applyOption(c *config) {
+	c.timeout = time.Duration(o)
+}
+
+// WithTimeout specifies the time allowed to connect and negotiate the link.
+//
+// The default is 1 minute.
+func WithTimeout(d time.Duration) Option {
+	return timeoutOption(d)
+}
+
+// PacketHandler receives the IPv4 packets received on the link.
+type PacketHandler func([]byte)
+
+func (o PacketHandler) applyOption(c *config) {
+	c.ph = o
+}
+
+// WithPacketHandler specifies a handler to receive IPv4 packets, such as to
+// write them to a TUN device, rather than having them returned by
+// ReadPacket.
+func WithPacketHandler(h PacketHandler) Option {
+	return h
+}
+
+// Dialup dials the packet data service of the modem, typically *99#, and
+// negotiates a PPP link over the resulting data stream.
+//
+// The PDP context must already be configured, e.g. with the APN, using
+// +CGDCONT.
+func Dialup(rw io.ReadWriter, options ...Option) (*Link, error) {
+	cfg := newConfig(options)
+	number := fmt.Sprintf("*99***%d#", cfg.contextID)
+	p := newPort(rw)
+	call, err := csd.Dial(p, number, csd.WithTimeout(cfg.timeout))
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+	l := newLink(call, cfg)
+	l.closer = func() error {
+		// stop the readLoop before handing the port back to the call.
+		p.interrupt()
+		<-l.readDone
+		p.resume()
+		err := call.Hangup()
+		p.close()
+		return err
+	}
+	if err = l.negotiate(); err != nil {
+		l.closer()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Negotiate negotiates a PPP link over an already connected data stream.
+//
+// Once the link is closed, a read may remain pending on the stream, so the
+// stream should be closed or discarded.
+func Negotiate(rw io.ReadWriter, options ...Option) (*Link, error) {
+	l := newLink(rw, newConfig(options))
+	if err := l.negotiate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func newConfig(options []Option) config {
+	cfg := config{
+		contextID: 1,
+		timeout:   time.Minute,
+	}
+	for _, option := range options {
+		option.applyOption(&cfg)
+	}
+	return cfg
+}
+
+func newLink(rw io.ReadWriter, cfg config) *Link {
+	return &Link{
+		rw:       rw,
+		closer:   func() error { return nil },
+		cfg:      cfg,
+		magic:    newMagic(),
+		rx:       make(chan packet, 16),
+		pkts:     make(chan []byte, 64),
+		done:     make(chan struct{}),
+		readDone: make(chan struct{}),
+		termAck:  make(chan struct{}),
+	}
+}
+
+// negotiate brings up the link.
+func (l *Link) negotiate() error {
+	go l.readLoop()
+	deadline := time.Now().Add(l.cfg.timeout)
+	err := l.configure(protoLCP, &lcpOptions{l: l}, deadline)
+	if err == nil {
+		err = l.authenticate(deadline)
+	}
+	if err == nil {
+		err = l.configure(protoIPCP, &ipcpOptions{l: l}, deadline)
+	}
+	if err != nil {
+		l.stop(err)
+		return err
+	}
+	go l.serve()
+	return nil
+}
+
+// ReadPacket returns the next IPv4 packet received on the link.
+//
+// Returns an error once the link is down.
+func (l *Link) ReadPacket() ([]byte, error) {
+	select {
+	case p := <-l.pkts:
+		return p, nil
+	case <-l.done:
+		return nil, l.Err()
+	}
+}
+
+// WritePacket sends an IPv4 packet on the link.
+func (l *Link) WritePacket(p []byte) error {
+	select {
+	case <-l.done:
+		return l.Err()
+	default:
+	}
+	return l.send(protoIPv4, p)
+}
+
+// Done returns a channel that is closed when the link goes down.
+func (l *Link) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err returns the reason the link went down, or nil if it is still up.
+func (l *Link) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Close terminates the link and, for links created by Dialup, hangs up the
+// call.
+func (l *Link) Close() error {
+	l.closeMu.Lock()
+	if l.isClosed {
+		l.closeMu.Unlock()
+		return nil
+	}
+	l.isClosed = true
+	l.closeMu.Unlock()
+	select {
+	case <-l.done:
+	default:
+		l.sendControl(protoLCP, terminateRequest, l.nextID(), nil)
+		select {
+		case <-l.termAck:
+		case <-l.done:
+		case <-time.After(restartTime):
+		}
+		l.stop(ErrClosed)
+	}
+	return l.closer()
+}
+
+// readLoop passes frames received from the peer to the rx channel.
+func (l *Link) readLoop() {
+	defer close(l.readDone)
+	fr := newFrameReader(l.rw)
+	for {
+		proto, info, err := fr.readFrame()
+		if err != nil {
+			l.stop(err)
+			return
+		}
+		select {
+		case l.rx <- packet{proto, info}:
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// serve handles frames received once the link is up.
+func (l *Link) serve() {
+	for {
+		var p packet
+		select {
+		case p = <-l.rx:
+		case <-l.done:
+			return
+		}
+		switch p.proto {
+		case protoIPv4:
+			if l.cfg.ph != nil {
+				l.cfg.ph(p.info)
+				continue
+			}
+			select {
+			case l.pkts <- p.info:
+			case <-l.done:
+				return
+			}
+		case protoLCP:
+			l.handleLCP(p.info)
+		case protoIPCP:
+			// renegotiation is not supported, so ignore.
+		default:
+			l.rejectProtocol(p)
+		}
+	}
+}
+
+// stop takes the link down, recording the reason.
+func (l *Link) stop(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return
+	}
+	l.err = err
+	close(l.done)
+}
+
+func (l *Link) send(proto uint16, info []byte) error {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	_, err := l.rw.Write(encodeFrame(proto, info))
+	return err
+}
+
+func (l *Link) sendControl(proto uint16, code, id byte, data []byte) error {
+	cp := make([]byte, 4, len(data)+4)
+	cp[0] = code
+	cp[1] = id
+	binary.BigEndian.PutUint16(cp[2:], uint16(len(data)+4))
+	return l.send(proto, append(cp, data...))
+}
+
+func (l *Link) nextID() byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.id++
+	return l.id
+}
+
+// handleLCP handles LCP packets other than those used during configuration.
+func (l *Link) handleLCP(info []byte) {
+	code, id, data, ok := parseControl(info)
+	if !ok {
+		return
+	}
+	switch code {
+	case echoRequest:
+		reply := make([]byte, 4, len(data))
+		binary.BigEndian.PutUint32(reply, l.magic)
+		if len(data) > 4 {
+			reply = append(reply, data[4:]...)
+		}
+		l.sendControl(protoLCP, echoReply, id, reply)
+	case terminateRequest:
+		l.sendControl(protoLCP, terminateAck, id, nil)
+		l.stop(ErrTerminated)
+	case terminateAck:
+		select {
+		case <-l.termAck:
+		default:
+			close(l.termAck)
+		}
+	case echoReply, discardRequest, codeReject, protocolReject:
+	case configureRequest:
+		// peer is renegotiating, which is not supported.
+		l.stop(ErrTerminated)
+	default:
+		l.sendControl(protoLCP, codeReject, l.nextID(), info)
+	}
+}
+
+// rejectProtocol sends an LCP Protocol-Reject for a frame with an
+// unsupported protocol.
+func (l *Link) rejectProtocol(p packet) {
+	data := make([]byte, 2, len(p.info)+2)
+	binary.BigEndian.PutUint16(data, p.proto)
+	l.sendControl(protoLCP, protocolReject, l.nextID(), append(data, p.info...))
+}
+
+// cpOptions are the protocol specific parts of configuring a control
+// protocol.
+type cpOptions interface {
+	// request returns the options to be requested of the peer.
+	request() []option
+
+	// nak updates the requested options from those suggested by the peer.
+	nak([]option)
+
+	// reject removes the options rejected by the peer.
+	reject([]option)
+
+	// check evaluates the options requested by the peer, returning any to be
+	// rejected or nak'd.
+	check([]option) (nak []option, rej []option)
+
+	// accepted is called when the peer's request has been acked.
+	accepted([]option)
+}
+
+// configure performs the configuration exchange of a control protocol.
+func (l *Link) configure(proto uint16, opts cpOptions, deadline time.Time) error {
+	acked := false
+	peerAcked := false
+	reqID := byte(0)
+	retries := 0
+	sendRequest := func() {
+		reqID = l.nextID()
+		l.sendControl(proto, configureRequest, reqID, encodeOptions(opts.request()))
+	}
+	sendRequest()
+	restart := time.NewTimer(restartTime)
+	defer restart.Stop()
+	expired := time.NewTimer(time.Until(deadline))
+	defer expired.Stop()
+	for !acked || !peerAcked {
+		var p packet
+		select {
+		case p = <-l.rx:
+		case <-restart.C:
+			retries++
+			if retries >= maxConfigure {
+				return ErrNegotiationFailed
+			}
+			sendRequest()
+			restart.Reset(restartTime)
+			continue
+		case <-expired.C:
+			return ErrDeadlineExceeded
+		case <-l.done:
+			return l.Err()
+		}
+		if p.proto != proto {
+			if p.proto == protoLCP {
+				l.handleLCP(p.info)
+			} else if proto != protoLCP {
+				l.rejectProtocol(p)
+			}
+			continue
+		}
+		code, id, data, ok := parseControl(p.info)
+		if !ok {
+			continue
+		}
+		switch code {
+		case configureRequest:
+			peerOpts, ok := parseOptions(data)
+			if !ok {
+				continue
+			}
+			nak, rej := opts.check(peerOpts)
+			switch {
+			case len(rej) != 0:
+				l.sendControl(proto, configureReject, id, encodeOptions(rej))
+			case len(nak) != 0:
+				l.sendControl(proto, configureNak, id, encodeOptions(nak))
+			default:
+				l.sendControl(proto, configureAck, id, data)
+				opts.accepted(peerOpts)
+				peerAcked = true
+			}
+		case configureAck:
+			if id == reqID {
+				acked = true
+			}
+		case configureNak, configureReject:
+			if id != reqID {
+				continue
+			}
+			peerOpts, ok := parseOptions(data)
+			if !ok {
+				continue
+			}
+			if code == configureNak {
+				opts.nak(peerOpts)
+			} else {
+				opts.reject(peerOpts)
+			}
+			acked = false
+			sendRequest()
+			restart.Reset(restartTime)
+		case terminateRequest:
+			l.sendControl(proto, terminateAck, id, nil)
+			return ErrTerminated
+		}
+	}
+	return nil
+}
+
+// authenticate authenticates with the peer, if the peer requires it.
+func (l *Link) authenticate(deadline time.Time) error {
+	switch l.auth {
+	case protoPAP:
+		return l.authenticatePAP(deadline)
+	case protoCHAP:
+		return l.authenticateCHAP(deadline)
+	}
+	return nil
+}
+
+func (l *Link) authenticatePAP(deadline time.Time) error {
+	user, pw := []byte(l.cfg.user), []byte(l.cfg.password)
+	req := make([]byte, 0, len(user)+len(pw)+2)
+	req = append(req, byte(len(user)))
+	req = append(req, user...)
+	req = append(req, byte(len(pw)))
+	req = append(req, pw...)
+	reqID := l.nextID()
+	l.sendControl(protoPAP, 1, reqID, req)
+	restart := time.NewTimer(restartTime)
+	defer restart.Stop()
+	expired := time.NewTimer(time.Until(deadline))
+	defer expired.Stop()
+	for retries := 0; ; {
+		var p packet
+		select {
+		case p = <-l.rx:
+		case <-restart.C:
+			retries++
+			if retries >= maxConfigure {
+				return ErrNegotiationFailed
+			}
+			reqID = l.nextID()
+			l.sendControl(protoPAP, 1, reqID, req)
+			restart.Reset(restartTime)
+			continue
+		case <-expired.C:
+			return ErrDeadlineExceeded
+		case <-l.done:
+			return l.Err()
+		}
+		if p.proto == protoLCP {
+			l.handleLCP(p.info)
+			continue
+		}
+		if p.proto != protoPAP {
+			continue
+		}
+		code, id, _, ok := parseControl(p.info)
+		if !ok || id != reqID {
+			continue
+		}
+		switch code {
+		case 2:
+			return nil
+		case 3:
+			return ErrAuthenticationFailed
+		}
+	}
+}
+
+func (l *Link) authenticateCHAP(deadline time.Time) error {
+	expired := time.NewTimer(time.Until(deadline))
+	defer expired.Stop()
+	for {
+		var p packet
+		select {
+		case p = <-l.rx:
+		case <-expired.C:
+			return ErrDeadlineExceeded
+		case <-l.done:
+			return l.Err()
+		}
+		if p.proto == protoLCP {
+			l.handleLCP(p.info)
+			continue
+		}
+		if p.proto != protoCHAP {
+			continue
+		}
+		code, id, data, ok := parseControl(p.info)
+		if !ok {
+			continue
+		}
+		switch code {
+		case 1:
+			// challenge
+			if len(data) < 1 || len(data) < int(data[0])+1 {
+				continue
+			}
+			h := md5.New()
+			h.Write([]byte{id})
+			h.Write([]byte(l.cfg.password))
+			h.Write(data[1 : int(data[0])+1])
+			rsp := append([]byte{md5.Size}, h.Sum(nil)...)
+			rsp = append(rsp, []byte(l.cfg.user)...)
+			l.sendControl(protoCHAP, 2, id, rsp)
+		case 3:
+			return nil
+		case 4:
+			return ErrAuthenticationFailed
+		}
+	}
+}
+
+// parseControl splits a control protocol packet into its fields.
+func parseControl(info []byte) (code, id byte, data []byte, ok bool) {
+	if len(info) < 4 {
+		return
+	}
+	length := int(binary.BigEndian.Uint16(info[2:]))
+	if length < 4 || length > len(info) {
+		return
+	}
+	return info[0], info[1], info[4:length], true
+}
+
+func newMagic() uint32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
+
+var (
+	// ErrAuthenticationFailed indicates the peer rejected the credentials.
+	ErrAuthenticationFailed = errors.New("authentication failed")
+
+	// ErrClosed indicates the link has been closed.
+	ErrClosed = errors.New("closed")
+
+	// ErrDeadlineExceeded indicates the link could not be negotiated within
+	// the timeout.
+	ErrDeadlineExceeded = errors.New("deadline exceeded")
+
+	// ErrNegotiationFailed indicates the peer did not respond to, or could
+	// not agree on, the configuration of the link.
+	ErrNegotiationFailed = errors.New("negotiation failed")
+
+	// ErrTerminated indicates the peer terminated the link.
+	ErrTerminated = errors.New("terminated by peer")
+)
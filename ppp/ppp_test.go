@@ -0,0 +1,320 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package ppp_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/ppp"
+)
+
+func TestNegotiate(t *testing.T) {
+	patterns := []struct {
+		name string
+		auth []byte
+		user string
+		err  error
+	}{
+		{"no auth", nil, "", nil},
+		{"pap", []byte{0xc0, 0x23}, "user", nil},
+		{"pap rejected", []byte{0xc0, 0x23}, "nobody", ppp.ErrAuthenticationFailed},
+		{"chap", []byte{0xc2, 0x23, 5}, "user", nil},
+		{"chap rejected", []byte{0xc2, 0x23, 5}, "nobody", ppp.ErrAuthenticationFailed},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			c, s := net.Pipe()
+			defer c.Close()
+			pr := newPeer(s, p.auth)
+			go pr.run()
+			l, err := ppp.Negotiate(c,
+				ppp.WithCredentials(p.user, "secret"),
+				ppp.WithTimeout(time.Second))
+			assert.Equal(t, p.err, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, net.IPv4(10, 0, 0, 2).To4(), l.IP)
+			assert.Equal(t, net.IPv4(10, 64, 64, 64).To4(), l.PeerIP)
+			assert.Equal(t, []net.IP{
+				net.IPv4(8, 8, 8, 8).To4(),
+				net.IPv4(8, 8, 4, 4).To4()}, l.DNS)
+
+			// packets
+			pr.send(0x0021, []byte{0x45, 0x7e, 0x7d, 0x01})
+			pkt, err := l.ReadPacket()
+			assert.Nil(t, err)
+			assert.Equal(t, []byte{0x45, 0x7e, 0x7d, 0x01}, pkt)
+			err = l.WritePacket([]byte{0x45, 0x00, 0x11})
+			assert.Nil(t, err)
+			select {
+			case pkt = <-pr.pkts:
+				assert.Equal(t, []byte{0x45, 0x00, 0x11}, pkt)
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("no packet")
+			}
+
+			// echo
+			pr.send(0xc021, []byte{9, 7, 0, 10, 0, 0, 0, 0, 'h', 'i'})
+			select {
+			case e := <-pr.echoes:
+				assert.Equal(t, []byte("hi"), e[4:])
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("no echo reply")
+			}
+
+			// unsupported protocol rejected
+			pr.send(0x8057, []byte{1, 1, 0, 4})
+			select {
+			case r := <-pr.rejects:
+				assert.Equal(t, uint16(0x8057), r)
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("no protocol reject")
+			}
+
+			err = l.Close()
+			assert.Nil(t, err)
+			<-l.Done()
+			assert.Equal(t, ppp.ErrClosed, l.Err())
+			_, err = l.ReadPacket()
+			assert.Equal(t, ppp.ErrClosed, err)
+			err = l.WritePacket([]byte{0x45})
+			assert.Equal(t, ppp.ErrClosed, err)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestPacketHandler(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	pr := newPeer(s, nil)
+	go pr.run()
+	pkts := make(chan []byte, 1)
+	ph := func(p []byte) {
+		pkts <- p
+	}
+	l, err := ppp.Negotiate(c, ppp.WithPacketHandler(ph))
+	require.Nil(t, err)
+	pr.send(0x0021, []byte{0x45, 0x01})
+	select {
+	case pkt := <-pkts:
+		assert.Equal(t, []byte{0x45, 0x01}, pkt)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no packet")
+	}
+
+	// terminated by peer
+	pr.send(0xc021, []byte{5, 9, 0, 4})
+	select {
+	case <-l.Done():
+		assert.Equal(t, ppp.ErrTerminated, l.Err())
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("not terminated")
+	}
+}
+
+func TestNegotiateTimeout(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	go io.Copy(ioutil.Discard, s)
+	_, err := ppp.Negotiate(c, ppp.WithTimeout(50*time.Millisecond))
+	assert.Equal(t, ppp.ErrDeadlineExceeded, err)
+}
+
+func TestDialup(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	pr := newPeer(s, nil)
+	go func() {
+		line, _ := pr.r.ReadString('\r')
+		if line != "ATD*99***2#\r" {
+			s.Write([]byte("\r\nERROR\r\n"))
+			return
+		}
+		s.Write([]byte("\r\nCONNECT 150000000\r\n"))
+		pr.run()
+		// command mode
+		for {
+			line, err := pr.r.ReadString('\r')
+			if err != nil {
+				return
+			}
+			if strings.HasSuffix(line, "ATH\r") {
+				s.Write([]byte("\r\nOK\r\n"))
+			}
+		}
+	}()
+	l, err := ppp.Dialup(c, ppp.WithContextID(2), ppp.WithTimeout(time.Second))
+	require.Nil(t, err)
+	assert.Equal(t, net.IPv4(10, 0, 0, 2).To4(), l.IP)
+	err = l.Close()
+	assert.Nil(t, err)
+}
+
+// peer emulates the PPP server in the modem.
+type peer struct {
+	rw      io.ReadWriter
+	r       *bufio.Reader
+	auth    []byte
+	pkts    chan []byte
+	echoes  chan []byte
+	rejects chan uint16
+}
+
+func newPeer(rw io.ReadWriter, auth []byte) *peer {
+	return &peer{
+		rw:      rw,
+		r:       bufio.NewReader(rw),
+		auth:    auth,
+		pkts:    make(chan []byte, 1),
+		echoes:  make(chan []byte, 1),
+		rejects: make(chan uint16, 1),
+	}
+}
+
+// run handles frames from the client until it terminates the link.
+func (p *peer) run() {
+	var opts []byte
+	if p.auth != nil {
+		opts = append([]byte{3, byte(len(p.auth) + 2)}, p.auth...)
+	}
+	p.sendControl(0xc021, 1, 1, append(opts, 5, 6, 1, 2, 3, 4))
+	sentIPCP := false
+	for {
+		proto, info, err := p.readFrame()
+		if err != nil {
+			return
+		}
+		if proto == 0x0021 {
+			p.pkts <- info
+			continue
+		}
+		code, id, data := info[0], info[1], info[4:]
+		switch proto {
+		case 0xc021:
+			switch code {
+			case 1:
+				p.sendControl(proto, 2, id, data)
+			case 5:
+				p.sendControl(proto, 6, id, nil)
+				return
+			case 8:
+				p.rejects <- binary.BigEndian.Uint16(data)
+			case 10:
+				p.echoes <- data
+			}
+		case 0xc023:
+			user := string(data[1 : 1+data[0]])
+			if user == "user" {
+				p.sendControl(proto, 2, id, nil)
+			} else {
+				p.sendControl(proto, 3, id, nil)
+			}
+		case 0xc223:
+			if code == 2 {
+				user := string(data[1+data[0]:])
+				if user == "user" {
+					p.sendControl(proto, 3, id, nil)
+				} else {
+					p.sendControl(proto, 4, id, nil)
+				}
+			}
+		case 0x8021:
+			if code != 1 {
+				continue
+			}
+			if !sentIPCP {
+				sentIPCP = true
+				p.sendControl(proto, 1, 1, []byte{3, 6, 10, 64, 64, 64})
+			}
+			if bytes.Contains(data, []byte{3, 6, 0, 0, 0, 0}) {
+				p.sendControl(proto, 3, id, []byte{
+					3, 6, 10, 0, 0, 2,
+					129, 6, 8, 8, 8, 8,
+					131, 6, 8, 8, 4, 4})
+			} else {
+				p.sendControl(proto, 2, id, data)
+			}
+		}
+		if proto == 0xc021 && code == 2 && p.auth != nil && p.auth[0] == 0xc2 {
+			// CHAP challenge once LCP is up
+			p.sendControl(0xc223, 1, 3, []byte{4, 1, 2, 3, 4, 'p'})
+		}
+	}
+}
+
+func (p *peer) sendControl(proto uint16, code, id byte, data []byte) {
+	cp := []byte{code, id, 0, 0}
+	binary.BigEndian.PutUint16(cp[2:], uint16(len(data)+4))
+	p.send(proto, append(cp, data...))
+}
+
+func (p *peer) send(proto uint16, info []byte) {
+	raw := []byte{0xff, 0x03, byte(proto >> 8), byte(proto)}
+	raw = append(raw, info...)
+	fcs := fcs16(raw) ^ 0xffff
+	raw = append(raw, byte(fcs), byte(fcs>>8))
+	frame := []byte{0x7e}
+	for _, b := range raw {
+		if b < 0x20 || b == 0x7e || b == 0x7d {
+			frame = append(frame, 0x7d, b^0x20)
+		} else {
+			frame = append(frame, b)
+		}
+	}
+	p.rw.Write(append(frame, 0x7e))
+}
+
+func (p *peer) readFrame() (uint16, []byte, error) {
+	for {
+		b, err := p.r.ReadBytes(0x7e)
+		if err != nil {
+			return 0, nil, err
+		}
+		var raw []byte
+		escaped := false
+		for _, c := range b[:len(b)-1] {
+			switch {
+			case c == 0x7d:
+				escaped = true
+			case escaped:
+				raw = append(raw, c^0x20)
+				escaped = false
+			default:
+				raw = append(raw, c)
+			}
+		}
+		if len(raw) < 6 || fcs16(raw) != 0xf0b8 {
+			continue
+		}
+		return binary.BigEndian.Uint16(raw[2:]), raw[4 : len(raw)-2], nil
+	}
+}
+
+func fcs16(data []byte) uint16 {
+	fcs := uint16(0xffff)
+	for _, b := range data {
+		fcs ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if fcs&1 != 0 {
+				fcs = (fcs >> 1) ^ 0x8408
+			} else {
+				fcs >>= 1
+			}
+		}
+	}
+	return fcs
+}
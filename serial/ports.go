@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package serial
+
+import (
+	"sort"
+	"strconv"
+)
+
+// PortInfo describes a serial port available on the platform.
+type PortInfo struct {
+	// Name identifies the port, and may be passed to WithPort.
+	Name string
+
+	// VID is the USB vendor ID, or 0 if the port is not a USB device.
+	VID uint16
+
+	// PID is the USB product ID, or 0 if the port is not a USB device.
+	PID uint16
+
+	// Interface is the USB interface number of the port, or -1 if unknown.
+	//
+	// Modems typically provide several ports, for AT commands, diagnostics,
+	// GNSS and so on, on separate interfaces, so this identifies the role of
+	// the port for a given VID and PID.
+	Interface int
+
+	// Serial is the USB serial number, if known.
+	Serial string
+
+	// Manufacturer is the USB manufacturer string, if known.
+	Manufacturer string
+
+	// Product is the USB product string, if known.
+	Product string
+}
+
+// IsUSB returns true if the port is provided by a USB device.
+func (p PortInfo) IsUSB() bool {
+	return p.VID != 0
+}
+
+// Ports returns the serial ports available on the platform, sorted by name.
+//
+// On Linux the ports are found in sysfs, on macOS they are the /dev/cu.*
+// devices, described using ioreg, and on Windows they are the COM ports
+// listed in the registry.
+//
+// USB metadata is provided where available, so modems can be identified by
+// VID and PID rather than by a device name that may change between boots.
+func Ports() ([]PortInfo, error) {
+	pp, err := ports()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pp, func(i, j int) bool { return pp[i].Name < pp[j].Name })
+	return pp, nil
+}
+
+// parseHex16 parses a USB ID, as a hex string, returning 0 if it is invalid.
+func parseHex16(s string) uint16 {
+	v, err := strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(v)
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+//go:build darwin
+// +build darwin
+
+package serial
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func ports() ([]PortInfo, error) {
+	names, err := filepath.Glob("/dev/cu.*")
+	if err != nil {
+		return nil, err
+	}
+	// USB metadata is best effort, so ioreg errors are ignored.
+	usb := map[string]PortInfo{}
+	if out, err := exec.Command("ioreg", "-r", "-c", "IOUSBHostDevice", "-l").Output(); err == nil {
+		usb = parseIoreg(out)
+	}
+	pp := make([]PortInfo, 0, len(names))
+	for _, name := range names {
+		p, ok := usb[name]
+		if !ok {
+			p = PortInfo{Name: name, Interface: -1}
+		}
+		pp = append(pp, p)
+	}
+	return pp, nil
+}
+
+var ioregProp = regexp.MustCompile(`"([^"]+)" = (.*)$`)
+
+// parseIoreg extracts the USB metadata of serial ports from the output of
+// "ioreg -r -c IOUSBHostDevice -l", which lists each USB device as the root
+// of the tree of its interfaces and the drivers attached to them, including
+// the IOSerialBSDClient that provides the callout device.
+func parseIoreg(out []byte) map[string]PortInfo {
+	usb := map[string]PortInfo{}
+	var dev PortInfo
+	iface := -1
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "+-o ") {
+			// a new USB device
+			dev = PortInfo{Interface: -1}
+			iface = -1
+			continue
+		}
+		m := ioregProp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		key, val := m[1], strings.Trim(m[2], `"`)
+		switch key {
+		case "idVendor":
+			if dev.VID == 0 {
+				dev.VID = parseDec16(val)
+			}
+		case "idProduct":
+			if dev.PID == 0 {
+				dev.PID = parseDec16(val)
+			}
+		case "USB Serial Number", "kUSBSerialNumberString":
+			if dev.Serial == "" {
+				dev.Serial = val
+			}
+		case "USB Vendor Name", "kUSBVendorString":
+			if dev.Manufacturer == "" {
+				dev.Manufacturer = val
+			}
+		case "USB Product Name", "kUSBProductString":
+			if dev.Product == "" {
+				dev.Product = val
+			}
+		case "bInterfaceNumber":
+			if n, err := strconv.Atoi(val); err == nil {
+				iface = n
+			}
+		case "IOCalloutDevice":
+			p := dev
+			p.Name = val
+			p.Interface = iface
+			usb[val] = p
+		}
+	}
+	return usb
+}
+
+func parseDec16(s string) uint16 {
+	v, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(v)
+}
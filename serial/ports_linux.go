@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+//go:build linux
+// +build linux
+
+package serial
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const sysClassTTY = "/sys/class/tty"
+
+func ports() ([]PortInfo, error) {
+	fis, err := ioutil.ReadDir(sysClassTTY)
+	if err != nil {
+		return nil, err
+	}
+	var pp []PortInfo
+	for _, fi := range fis {
+		dev, err := filepath.EvalSymlinks(filepath.Join(sysClassTTY, fi.Name(), "device"))
+		if err != nil {
+			// virtual terminals have no device
+			continue
+		}
+		subsys, _ := filepath.EvalSymlinks(filepath.Join(dev, "subsystem"))
+		if filepath.Base(subsys) == "platform" {
+			// legacy serial ports that are typically not present
+			continue
+		}
+		p := PortInfo{Name: "/dev/" + fi.Name(), Interface: -1}
+		usbInfo(dev, &p)
+		pp = append(pp, p)
+	}
+	return pp, nil
+}
+
+// usbInfo fills in the USB metadata of the port from the sysfs device
+// directory, or the closest USB interface and device above it.
+func usbInfo(dir string, p *PortInfo) {
+	for ; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		if p.Interface == -1 {
+			if v, ok := readAttr(dir, "bInterfaceNumber"); ok {
+				if n, err := strconv.ParseUint(v, 16, 8); err == nil {
+					p.Interface = int(n)
+				}
+			}
+		}
+		vid, ok := readAttr(dir, "idVendor")
+		if !ok {
+			continue
+		}
+		pid, _ := readAttr(dir, "idProduct")
+		p.VID = parseHex16(vid)
+		p.PID = parseHex16(pid)
+		p.Serial, _ = readAttr(dir, "serial")
+		p.Manufacturer, _ = readAttr(dir, "manufacturer")
+		p.Product, _ = readAttr(dir, "product")
+		return
+	}
+}
+
+func readAttr(dir, name string) (string, bool) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(b)), true
+}
@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package serial_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/serial"
+)
+
+func TestPorts(t *testing.T) {
+	pp, err := serial.Ports()
+	require.Nil(t, err)
+	names := make([]string, len(pp))
+	for i, p := range pp {
+		names[i] = p.Name
+		assert.NotEmpty(t, p.Name)
+		assert.Equal(t, p.VID != 0, p.IsUSB())
+		if !p.IsUSB() {
+			assert.Equal(t, -1, p.Interface, p.Name)
+		}
+	}
+	assert.True(t, sort.StringsAreSorted(names))
+}
+
+func TestPortInfoIsUSB(t *testing.T) {
+	assert.False(t, serial.PortInfo{Name: "/dev/ttyS0", Interface: -1}.IsUSB())
+	assert.True(t, serial.PortInfo{Name: "/dev/ttyUSB2", VID: 0x2c7c, PID: 0x0125, Interface: 2}.IsUSB())
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+//go:build windows
+// +build windows
+
+package serial
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+func ports() ([]PortInfo, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`HARDWARE\DEVICEMAP\SERIALCOMM`, registry.QUERY_VALUE)
+	if err != nil {
+		if err == registry.ErrNotExist {
+			// no serial ports
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer k.Close()
+	vv, err := k.ReadValueNames(0)
+	if err != nil {
+		return nil, err
+	}
+	// USB metadata is best effort, so errors are ignored.
+	usb := usbPorts()
+	pp := make([]PortInfo, 0, len(vv))
+	for _, v := range vv {
+		name, _, err := k.GetStringValue(v)
+		if err != nil {
+			continue
+		}
+		p, ok := usb[name]
+		if !ok {
+			p = PortInfo{Name: name, Interface: -1}
+		}
+		pp = append(pp, p)
+	}
+	return pp, nil
+}
+
+// usbPorts returns the USB metadata of the COM ports provided by USB devices,
+// as found in the USB device enumeration in the registry.
+//
+// The device keys are of the form VID_xxxx&PID_yyyy, or VID_xxxx&PID_yyyy&MI_zz
+// for an interface of a composite device, and the COM port is the PortName of
+// the Device Parameters of a device instance.
+func usbPorts() map[string]PortInfo {
+	usb := map[string]PortInfo{}
+	root, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SYSTEM\CurrentControlSet\Enum\USB`, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return usb
+	}
+	defer root.Close()
+	devs, err := root.ReadSubKeyNames(0)
+	if err != nil {
+		return usb
+	}
+	for _, dev := range devs {
+		id := PortInfo{Interface: -1}
+		for _, f := range strings.Split(strings.ToUpper(dev), "&") {
+			switch {
+			case strings.HasPrefix(f, "VID_"):
+				id.VID = parseHex16(f[4:])
+			case strings.HasPrefix(f, "PID_"):
+				id.PID = parseHex16(f[4:])
+			case strings.HasPrefix(f, "MI_"):
+				id.Interface = int(parseHex16(f[3:]))
+			}
+		}
+		if id.VID == 0 {
+			continue
+		}
+		dk, err := registry.OpenKey(root, dev, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		insts, _ := dk.ReadSubKeyNames(0)
+		for _, inst := range insts {
+			ik, err := registry.OpenKey(dk, inst, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			p := id
+			p.Manufacturer = regString(ik, "Mfg")
+			p.Product = regString(ik, "DeviceDesc")
+			ik.Close()
+			pk, err := registry.OpenKey(dk, inst+`\Device Parameters`, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			p.Name, _, err = pk.GetStringValue("PortName")
+			pk.Close()
+			if err != nil || p.Name == "" {
+				continue
+			}
+			// the instance of a non-composite device is its serial number,
+			// while interfaces have generated instance IDs containing '&'.
+			if p.Interface == -1 && !strings.Contains(inst, "&") {
+				p.Serial = inst
+			}
+			usb[p.Name] = p
+		}
+		dk.Close()
+	}
+	return usb
+}
+
+// regString reads a device string value, stripping any INF reference, e.g.
+// "@oem12.inf,%mfgname%;Quectel" becomes "Quectel".
+func regString(k registry.Key, name string) string {
+	v, _, err := k.GetStringValue(name)
+	if err != nil {
+		return ""
+	}
+	if idx := strings.LastIndex(v, ";"); idx != -1 {
+		v = v[idx+1:]
+	}
+	return v
+}
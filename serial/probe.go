@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package serial
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// Role is the function of a serial port provided by a modem.
+type Role int
+
+const (
+	// RoleUnknown indicates the port did not respond to probing.
+	RoleUnknown Role = iota
+
+	// RoleAT indicates the port accepts AT commands.
+	RoleAT
+
+	// RoleNMEA indicates the port emits NMEA sentences from a GNSS receiver.
+	RoleNMEA
+
+	// RoleDM indicates the port is a Qualcomm diagnostic (DM) port.
+	RoleDM
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleAT:
+		return "AT"
+	case RoleNMEA:
+		return "NMEA"
+	case RoleDM:
+		return "DM"
+	}
+	return "unknown"
+}
+
+// Probe determines the role of a port by issuing an AT command to it and
+// examining whatever the port returns.
+//
+// A port that responds with OK or ERROR accepts AT commands, a port that
+// emits NMEA sentences is a GNSS port, and a port that responds with binary
+// HDLC frames is a diagnostic port.  If the role cannot be determined within
+// the timeout then RoleUnknown is returned.
+//
+// The port is read in the background, so a read may remain pending after
+// Probe returns, until the port is closed.
+func Probe(rw io.ReadWriter, timeout time.Duration) Role {
+	if _, err := rw.Write([]byte("AT\r\n")); err != nil {
+		return RoleUnknown
+	}
+	data := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := rw.Read(buf)
+			if n > 0 {
+				select {
+				case data <- append([]byte(nil), buf[:n]...):
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	expired := time.NewTimer(timeout)
+	defer expired.Stop()
+	var rx []byte
+	for {
+		select {
+		case d := <-data:
+			rx = append(rx, d...)
+			if r := classify(rx); r != RoleUnknown {
+				return r
+			}
+		case <-expired.C:
+			return RoleUnknown
+		}
+	}
+}
+
+// classify returns the role indicated by the data received from a port, or
+// RoleUnknown if the data is not yet conclusive.
+func classify(rx []byte) Role {
+	for _, l := range bytes.Split(rx, []byte("\n")) {
+		l = bytes.TrimSpace(l)
+		if bytes.Equal(l, []byte("OK")) || bytes.Equal(l, []byte("ERROR")) {
+			return RoleAT
+		}
+		if isNMEA(l) {
+			return RoleNMEA
+		}
+	}
+	// a DM port rejects the command with a binary frame terminated by 0x7e.
+	if idx := bytes.IndexByte(rx, 0x7e); idx != -1 && !isText(rx[:idx]) {
+		return RoleDM
+	}
+	return RoleUnknown
+}
+
+// isNMEA returns true if the line is a complete NMEA sentence, such as
+// $GPGGA,...*47.
+func isNMEA(l []byte) bool {
+	if len(l) < 9 || l[0] != '$' {
+		return false
+	}
+	star := bytes.LastIndexByte(l, '*')
+	if star == -1 || star != len(l)-3 {
+		return false
+	}
+	var sum byte
+	for _, c := range l[1:star] {
+		sum ^= c
+	}
+	return string(l[star+1:]) == string(hexDigits(sum))
+}
+
+func hexDigits(b byte) []byte {
+	const digits = "0123456789ABCDEF"
+	return []byte{digits[b>>4], digits[b&0x0f]}
+}
+
+func isText(data []byte) bool {
+	for _, c := range data {
+		if (c < 0x20 || c > 0x7e) && c != '\r' && c != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+// ProbeOption is an option that modifies the behaviour of ProbePorts.
+type ProbeOption interface {
+	applyProbeOption(*probeConfig)
+}
+
+type probeConfig struct {
+	timeout time.Duration
+	open    Opener
+}
+
+// Opener opens a port for probing.
+type Opener func(p PortInfo) (io.ReadWriteCloser, error)
+
+// ProbeTimeout is the time allowed for a port to respond to probing.
+type ProbeTimeout time.Duration
+
+func (o ProbeTimeout) applyProbeOption(c *probeConfig) {
+	c.timeout = time.Duration(o)
+}
+
+// WithProbeTimeout specifies the time allowed for each port to respond to
+// probing.
+//
+// The default is 1 second.
+func WithProbeTimeout(d time.Duration) ProbeTimeout {
+	return ProbeTimeout(d)
+}
+
+func (o Opener) applyProbeOption(c *probeConfig) {
+	c.open = o
+}
+
+// WithOpener specifies the function used to open ports for probing.
+//
+// By default ports are opened using New with the default baud rate.
+func WithOpener(o func(p PortInfo) (io.ReadWriteCloser, error)) Opener {
+	return Opener(o)
+}
+
+// ProbePorts probes each of the ports to determine its role, and returns the
+// ports grouped by role.
+//
+// This allows the ports of a modem to be assigned roles when the order of the
+// USB interfaces is not known, such as for unrecognised hardware.  The ports
+// are probed concurrently, and are closed after probing.  Ports that cannot
+// be opened are reported as RoleUnknown.
+func ProbePorts(pp []PortInfo, options ...ProbeOption) map[Role][]PortInfo {
+	cfg := probeConfig{
+		timeout: time.Second,
+		open: func(p PortInfo) (io.ReadWriteCloser, error) {
+			return New(WithPort(p.Name))
+		},
+	}
+	for _, option := range options {
+		option.applyProbeOption(&cfg)
+	}
+	roles := make([]Role, len(pp))
+	var wg sync.WaitGroup
+	for i, p := range pp {
+		wg.Add(1)
+		go func(i int, p PortInfo) {
+			defer wg.Done()
+			port, err := cfg.open(p)
+			if err != nil {
+				return
+			}
+			roles[i] = Probe(port, cfg.timeout)
+			port.Close()
+		}(i, p)
+	}
+	wg.Wait()
+	byRole := make(map[Role][]PortInfo)
+	for i, p := range pp {
+		byRole[roles[i]] = append(byRole[roles[i]], p)
+	}
+	return byRole
+}
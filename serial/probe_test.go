@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package serial_test
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warthog618/modem/serial"
+)
+
+func TestProbe(t *testing.T) {
+	patterns := []struct {
+		name string
+		rsp  []string
+		role serial.Role
+	}{
+		{"ok", []string{"AT\r\r\n", "OK\r\n"}, serial.RoleAT},
+		{"error", []string{"\r\nERROR\r\n"}, serial.RoleAT},
+		{"nmea", []string{
+			"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,",
+			"*47\r\n",
+		}, serial.RoleNMEA},
+		{"bad nmea checksum", []string{"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*48\r\n"}, serial.RoleUnknown},
+		{"dm", []string{"\x13\x41\x54\x0d\x0a\x8a\xd6\x7e"}, serial.RoleDM},
+		{"silent", nil, serial.RoleUnknown},
+		{"junk", []string{"hello\r\n"}, serial.RoleUnknown},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			mp := newMockPort(p.rsp)
+			defer mp.Close()
+			role := serial.Probe(mp, 50*time.Millisecond)
+			assert.Equal(t, p.role, role)
+			assert.Equal(t, "AT\r\n", mp.written())
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestProbePorts(t *testing.T) {
+	rsps := map[string][]string{
+		"/dev/ttyUSB0": {"\x13\x41\x54\x0d\x0a\x8a\xd6\x7e"},
+		"/dev/ttyUSB1": {"$GPGSA,A,1,,,,,,,,,,,,,,,*1E\r\n"},
+		"/dev/ttyUSB2": {"\r\nOK\r\n"},
+		"/dev/ttyUSB3": {"\r\nOK\r\n"},
+		"/dev/ttyUSB4": nil,
+	}
+	pp := []serial.PortInfo{
+		{Name: "/dev/ttyUSB0", Interface: 0},
+		{Name: "/dev/ttyUSB1", Interface: 1},
+		{Name: "/dev/ttyUSB2", Interface: 2},
+		{Name: "/dev/ttyUSB3", Interface: 3},
+		{Name: "/dev/ttyUSB4", Interface: 4},
+		{Name: "/dev/ttyUSB5", Interface: 5},
+	}
+	open := func(p serial.PortInfo) (io.ReadWriteCloser, error) {
+		rsp, ok := rsps[p.Name]
+		if !ok {
+			return nil, errors.New("no such port")
+		}
+		return newMockPort(rsp), nil
+	}
+	roles := serial.ProbePorts(pp,
+		serial.WithOpener(open),
+		serial.WithProbeTimeout(50*time.Millisecond))
+	assert.Equal(t, map[serial.Role][]serial.PortInfo{
+		serial.RoleDM:      pp[0:1],
+		serial.RoleNMEA:    pp[1:2],
+		serial.RoleAT:      pp[2:4],
+		serial.RoleUnknown: pp[4:6],
+	}, roles)
+}
+
+func TestRoleString(t *testing.T) {
+	assert.Equal(t, "AT", serial.RoleAT.String())
+	assert.Equal(t, "NMEA", serial.RoleNMEA.String())
+	assert.Equal(t, "DM", serial.RoleDM.String())
+	assert.Equal(t, "unknown", serial.RoleUnknown.String())
+	assert.Equal(t, "unknown", serial.Role(42).String())
+}
+
+// mockPort is a port that returns a canned response once written to.
+type mockPort struct {
+	rsp  []string
+	r    chan []byte
+	done chan struct{}
+
+	mu sync.Mutex
+	w  []byte
+}
+
+func newMockPort(rsp []string) *mockPort {
+	return &mockPort{
+		rsp:  rsp,
+		r:    make(chan []byte, len(rsp)),
+		done: make(chan struct{}),
+	}
+}
+
+func (mp *mockPort) Read(p []byte) (int, error) {
+	select {
+	case data := <-mp.r:
+		return copy(p, data), nil
+	case <-mp.done:
+		return 0, io.EOF
+	}
+}
+
+func (mp *mockPort) Write(p []byte) (int, error) {
+	mp.mu.Lock()
+	mp.w = append(mp.w, p...)
+	mp.mu.Unlock()
+	for _, r := range mp.rsp {
+		mp.r <- []byte(r)
+	}
+	return len(p), nil
+}
+
+func (mp *mockPort) Close() error {
+	close(mp.done)
+	return nil
+}
+
+func (mp *mockPort) written() string {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return string(mp.w)
+}
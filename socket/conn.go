@@ -0,0 +1,308 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package socket
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/info"
+)
+
+// the maximum number of bytes retrieved from, or sent to, the modem by a
+// single command.
+const maxChunk = 750
+
+// Conn is a connection made using the embedded IP stack.
+type Conn struct {
+	s  *Stack
+	id int
+
+	// kicks the drainLoop to retrieve data from the modem.
+	kickCh chan struct{}
+	// signals readers that the buffer or state has changed.
+	avail chan struct{}
+	done  chan struct{}
+
+	mu       sync.Mutex
+	buf      []byte
+	paused   bool
+	closed   bool
+	remote   bool
+	eof      bool
+	deadline time.Time
+}
+
+func newConn(s *Stack, id int) *Conn {
+	return &Conn{
+		s:      s,
+		id:     id,
+		kickCh: make(chan struct{}, 1),
+		avail:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// ID returns the identifier of the connection within the modem.
+func (c *Conn) ID() int {
+	return c.id
+}
+
+// Read reads data received on the connection.
+//
+// Read blocks until data is available, the connection is closed, or the
+// read deadline is exceeded.  Once the remote end has closed the connection
+// and all the data has been read, Read returns io.EOF.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.buf) == 0 {
+		if c.closed {
+			return 0, ErrClosed
+		}
+		if c.eof {
+			return 0, io.EOF
+		}
+		var expired <-chan time.Time
+		if !c.deadline.IsZero() {
+			d := time.Until(c.deadline)
+			if d <= 0 {
+				return 0, ErrDeadlineExceeded
+			}
+			t := time.NewTimer(d)
+			defer t.Stop()
+			expired = t.C
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.avail:
+		case <-expired:
+		}
+		c.mu.Lock()
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	if c.paused && len(c.buf) <= c.s.low {
+		c.paused = false
+		c.kick()
+	}
+	return n, nil
+}
+
+// SetReadDeadline sets the deadline for subsequent Reads.
+//
+// A zero value for t means Read will not time out.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	c.signal()
+	return nil
+}
+
+// Write sends the data on the connection.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return 0, ErrClosed
+	}
+	n := 0
+	for n < len(p) {
+		chunk := p[n:]
+		if len(chunk) > c.s.maxChunk() {
+			chunk = chunk[:c.s.maxChunk()]
+		}
+		var cmd string
+		switch c.s.dialect {
+		case SIMCom:
+			cmd = fmt.Sprintf("+CIPSEND=%d,%d", c.id, len(chunk))
+		case Telit:
+			cmd = fmt.Sprintf("#SSENDEXT=%d,%d", c.id, len(chunk))
+		case Ublox:
+			// the data is passed in hex as part of the command.
+			cmd = fmt.Sprintf("+USOWR=%d,%d,\"%s\"", c.id, len(chunk), hex.EncodeToString(chunk))
+			if _, err := c.s.Command(cmd); err != nil {
+				return n, fmt.Errorf("AT+USOWR=%d,%d returned error: %w", c.id, len(chunk), err)
+			}
+			n += len(chunk)
+			continue
+		default:
+			cmd = fmt.Sprintf("+QISEND=%d,%d", c.id, len(chunk))
+		}
+		if _, err := c.s.DataCommand(cmd, chunk); err != nil {
+			return n, fmt.Errorf("AT%s returned error: %w", cmd, err)
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+// Close closes the connection.
+//
+// Any data remaining in the receive buffer is discarded.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.buf = nil
+	close(c.done)
+	c.mu.Unlock()
+	c.signal()
+	c.s.mu.Lock()
+	delete(c.s.conns, c.id)
+	c.s.mu.Unlock()
+	cmd := c.s.closeCmd(c.id)
+	if _, err := c.s.Command(cmd); err != nil {
+		return fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	return nil
+}
+
+// kick requests the drainLoop retrieve data from the modem.
+func (c *Conn) kick() {
+	select {
+	case c.kickCh <- struct{}{}:
+	default:
+	}
+}
+
+// signal wakes any blocked reader.
+func (c *Conn) signal() {
+	select {
+	case c.avail <- struct{}{}:
+	default:
+	}
+}
+
+// remoteClosed records that the remote end has closed the connection, after
+// which any remaining data is drained from the modem.
+func (c *Conn) remoteClosed() {
+	c.mu.Lock()
+	c.remote = true
+	c.mu.Unlock()
+	c.kick()
+}
+
+// drainLoop retrieves data from the modem when kicked.
+func (c *Conn) drainLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.kickCh:
+			c.drain()
+		}
+	}
+}
+
+// drain retrieves data from the modem until the modem is empty or the buffer
+// reaches the high watermark.
+func (c *Conn) drain() {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		room := c.s.high - len(c.buf)
+		if room <= 0 {
+			c.paused = true
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+		if room > c.s.maxChunk() {
+			room = c.s.maxChunk()
+		}
+		data, err := c.s.read(c.id, room)
+		c.mu.Lock()
+		if len(data) == 0 {
+			// a failed read is retried on the next kick.
+			if c.remote && err == nil {
+				c.eof = true
+			}
+			c.mu.Unlock()
+			c.signal()
+			return
+		}
+		c.buf = append(c.buf, data...)
+		c.mu.Unlock()
+		c.signal()
+	}
+}
+
+// read retrieves up to n bytes of data for the connection from the modem.
+func (s *Stack) read(id, n int) ([]byte, error) {
+	cmd := fmt.Sprintf("+QIRD=%d,%d", id, n)
+	prefix := "+QIRD"
+	switch s.dialect {
+	case SIMCom:
+		cmd = fmt.Sprintf("+CIPRXGET=3,%d,%d", id, n)
+		prefix = "+CIPRXGET"
+	case Telit:
+		cmd = fmt.Sprintf("#SRECV=%d,%d", id, n)
+		prefix = "#SRECV"
+	case Ublox:
+		cmd = fmt.Sprintf("+USORD=%d,%d", id, n)
+		prefix = "+USORD"
+	}
+	i, err := s.Command(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	for idx, l := range i {
+		if !info.HasPrefix(l, prefix) {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, prefix))
+		// +QIRD: <len>, +CIPRXGET: 3,<id>,<len>,<remaining>,
+		// #SRECV: <id>,<len>, +USORD: <id>,<len>,"<data>"
+		lenField := 0
+		switch s.dialect {
+		case SIMCom:
+			lenField = 2
+		case Telit, Ublox:
+			lenField = 1
+		}
+		if len(fields) <= lenField {
+			break
+		}
+		length, err := strconv.Atoi(fields[lenField])
+		if err != nil {
+			break
+		}
+		if length == 0 {
+			return nil, nil
+		}
+		var hexData string
+		if s.dialect == Ublox {
+			// the data is inline, rather than on the following line.
+			if len(fields) < 3 {
+				break
+			}
+			hexData = fields[2]
+		} else {
+			if idx+1 >= len(i) {
+				break
+			}
+			hexData = i[idx+1]
+		}
+		data, err := hex.DecodeString(hexData)
+		if err != nil || len(data) != length {
+			break
+		}
+		return data, nil
+	}
+	return nil, ErrMalformedResponse
+}
@@ -0,0 +1,548 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package socket provides TCP and UDP connections using the IP stack
+// embedded in some modems.
+//
+// The IP stacks are vendor specific, so the Dialect of the modem must be
+// provided.  The connections are made over a PDP context which must already
+// be configured and activated.
+//
+// Received data is buffered in the modem until retrieved, so each connection
+// drains the modem into a local buffer when the modem indicates data has
+// arrived.  Draining pauses while the local buffer is above its high
+// watermark, and resumes once reads have brought it below the low watermark,
+// so the modem buffer absorbs bursts that the reader cannot keep up with.
+package socket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// Dialect identifies the vendor specific IP stack command set supported by
+// the modem.
+type Dialect int
+
+const (
+	// Quectel modems, using the +QIOPEN commands.
+	Quectel Dialect = iota
+
+	// SIMCom modems, using the +CIPOPEN commands.
+	SIMCom
+
+	// Telit modems, using the #SD commands.
+	Telit
+
+	// Ublox modems, using the +USOCR commands.
+	Ublox
+)
+
+// Stack decorates the AT modem with the ability to make connections using
+// the embedded IP stack.
+type Stack struct {
+	*at.AT
+	dialect     Dialect
+	contextID   int
+	high        int
+	low         int
+	openTimeout time.Duration
+
+	mu    sync.Mutex
+	conns map[int]*Conn
+	opens map[int]chan int
+}
+
+// Option is a construction option for the Stack.
+type Option interface {
+	applyOption(*Stack)
+}
+
+// New creates a new Stack for the modem.
+//
+// The stack must be started, using Start, before connections are made.
+func New(a *at.AT, dialect Dialect, options ...Option) *Stack {
+	s := Stack{
+		AT:          a,
+		dialect:     dialect,
+		contextID:   1,
+		high:        16384,
+		low:         4096,
+		openTimeout: time.Minute,
+		conns:       make(map[int]*Conn),
+		opens:       make(map[int]chan int),
+	}
+	for _, option := range options {
+		option.applyOption(&s)
+	}
+	return &s
+}
+
+type contextIDOption int
+
+func (o contextIDOption) applyOption(s *Stack) {
+	s.contextID = int(o)
+}
+
+// WithContextID specifies the PDP context used by Quectel modems for
+// connections.
+//
+// The default is 1.
+func WithContextID(id int) Option {
+	return contextIDOption(id)
+}
+
+type watermarksOption struct {
+	high int
+	low  int
+}
+
+func (o watermarksOption) applyOption(s *Stack) {
+	s.high = o.high
+	s.low = o.low
+}
+
+// WithWatermarks specifies the high and low watermarks of the receive buffer
+// of each connection.
+//
+// Draining of the modem is paused when the buffer reaches the high watermark,
+// and resumed when it falls to the low watermark.
+//
+// The defaults are 16384 and 4096 bytes.
+func WithWatermarks(high, low int) Option {
+	return watermarksOption{high, low}
+}
+
+type openTimeoutOption time.Duration
+
+func (o openTimeoutOption) applyOption(s *Stack) {
+	s.openTimeout = time.Duration(o)
+}
+
+// WithOpenTimeout specifies the maximum time allowed by Dial for the
+// connection to be established.
+//
+// The default is 1 minute.
+func WithOpenTimeout(d time.Duration) Option {
+	return openTimeoutOption(d)
+}
+
+// Start configures the IP stack for buffered receive and starts handling
+// indications from it.
+func (s *Stack) Start(options ...at.CommandOption) error {
+	for prefix, h := range s.handlers() {
+		if err := s.AddIndication(prefix, h); err != nil {
+			s.cancelIndications()
+			return err
+		}
+	}
+	var cmd string
+	switch s.dialect {
+	case SIMCom:
+		cmd = "+CIPRXGET=1"
+	case Telit:
+		// Telit sockets are configured individually, as they are opened.
+		return nil
+	case Ublox:
+		// exchange data in hex
+		cmd = "+UDCONF=1,1"
+	default:
+		cmd = "+QICFG=\"dataformat\",0,1"
+	}
+	if _, err := s.Command(cmd, options...); err != nil {
+		s.cancelIndications()
+		return fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	return nil
+}
+
+// Stop stops handling indications from the IP stack.
+//
+// Any open connections are closed.
+func (s *Stack) Stop() {
+	s.mu.Lock()
+	conns := make([]*Conn, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+	s.cancelIndications()
+}
+
+// Dial connects to the address on the named network.
+//
+// The network must be "tcp" or "udp", and the address of the form
+// "host:port".
+func (s *Stack) Dial(network, address string) (*Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	var proto string
+	switch network {
+	case "tcp":
+		proto = "TCP"
+	case "udp":
+		proto = "UDP"
+	default:
+		return nil, ErrUnsupportedNetwork
+	}
+	if s.dialect == Ublox {
+		return s.dialUblox(proto, host, port)
+	}
+	s.mu.Lock()
+	id := -1
+	for i := s.firstConn(); i < s.firstConn()+s.maxConns(); i++ {
+		if _, ok := s.conns[i]; !ok {
+			id = i
+			break
+		}
+	}
+	if id == -1 {
+		s.mu.Unlock()
+		return nil, ErrNoFreeConnection
+	}
+	c := newConn(s, id)
+	s.conns[id] = c
+	opened := make(chan int, 1)
+	s.opens[id] = opened
+	s.mu.Unlock()
+	release := func() {
+		s.mu.Lock()
+		delete(s.conns, id)
+		delete(s.opens, id)
+		s.mu.Unlock()
+	}
+	if s.dialect == Telit {
+		if err = s.openTelit(id, proto, host, port); err != nil {
+			release()
+			return nil, err
+		}
+		return s.opened(c), nil
+	}
+	cmd := fmt.Sprintf("+QIOPEN=%d,%d,\"%s\",\"%s\",%d,0,0", s.contextID, id, proto, host, port)
+	if s.dialect == SIMCom {
+		cmd = fmt.Sprintf("+CIPOPEN=%d,\"%s\",\"%s\",%d", id, proto, host, port)
+	}
+	if _, err = s.Command(cmd); err != nil {
+		release()
+		return nil, fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	select {
+	case code := <-opened:
+		if code != 0 {
+			release()
+			return nil, OpenError(code)
+		}
+	case <-time.After(s.openTimeout):
+		release()
+		s.Command(s.closeCmd(id))
+		return nil, ErrDeadlineExceeded
+	case <-s.Closed():
+		release()
+		return nil, at.ErrClosed
+	}
+	return s.opened(c), nil
+}
+
+// openTelit configures and opens a Telit socket.
+//
+// The socket is opened in command mode, with data indicated by SRING and
+// retrieved in hex, and the #SD does not return until the connection is
+// established or has failed.
+func (s *Stack) openTelit(id int, proto, host string, port int) error {
+	cmd := fmt.Sprintf("#SCFGEXT=%d,0,1,0", id)
+	if _, err := s.Command(cmd); err != nil {
+		return fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	txProt := 0
+	if proto == "UDP" {
+		txProt = 1
+	}
+	cmd = fmt.Sprintf("#SD=%d,%d,%d,\"%s\",0,0,1", id, txProt, port, host)
+	_, err := s.Command(cmd, at.WithTimeout(s.openTimeout))
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, at.ErrDeadlineExceeded):
+		s.Command(s.closeCmd(id))
+		return ErrDeadlineExceeded
+	default:
+		return fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+}
+
+// dialUblox creates and connects a u-blox socket.
+//
+// The modem assigns the identifier of the socket when it is created, and the
+// +USOCO does not return until the connection is established or has failed.
+func (s *Stack) dialUblox(proto, host string, port int) (*Conn, error) {
+	cmd := "+USOCR=6"
+	if proto == "UDP" {
+		cmd = "+USOCR=17"
+	}
+	i, err := s.Command(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	id := -1
+	for _, l := range i {
+		if info.HasPrefix(l, "+USOCR") {
+			id, err = strconv.Atoi(info.TrimPrefix(l, "+USOCR"))
+			break
+		}
+	}
+	if id < 0 || err != nil {
+		return nil, ErrMalformedResponse
+	}
+	c := newConn(s, id)
+	s.mu.Lock()
+	s.conns[id] = c
+	s.mu.Unlock()
+	cmd = fmt.Sprintf("+USOCO=%d,\"%s\",%d", id, host, port)
+	if _, err = s.Command(cmd, at.WithTimeout(s.openTimeout)); err != nil {
+		s.mu.Lock()
+		delete(s.conns, id)
+		s.mu.Unlock()
+		s.Command(s.closeCmd(id))
+		if errors.Is(err, at.ErrDeadlineExceeded) {
+			return nil, ErrDeadlineExceeded
+		}
+		return nil, fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	return s.opened(c), nil
+}
+
+// opened completes the opening of the connection.
+func (s *Stack) opened(c *Conn) *Conn {
+	s.mu.Lock()
+	delete(s.opens, c.id)
+	s.mu.Unlock()
+	go c.drainLoop()
+	// data may have arrived before the connection was registered.
+	c.kick()
+	return c
+}
+
+// firstConn returns the identifier of the first connection supported by the
+// modem.
+func (s *Stack) firstConn() int {
+	if s.dialect == Telit {
+		return 1
+	}
+	return 0
+}
+
+func (s *Stack) maxConns() int {
+	switch s.dialect {
+	case SIMCom:
+		return 10
+	case Telit:
+		return 6
+	case Ublox:
+		return 7
+	}
+	return 12
+}
+
+// maxChunk returns the maximum number of bytes retrieved from, or sent to,
+// the modem by a single command.
+func (s *Stack) maxChunk() int {
+	if s.dialect == Ublox {
+		// limited by the hex encoding
+		return 512
+	}
+	return maxChunk
+}
+
+func (s *Stack) closeCmd(id int) string {
+	switch s.dialect {
+	case SIMCom:
+		return fmt.Sprintf("+CIPCLOSE=%d", id)
+	case Telit:
+		return fmt.Sprintf("#SH=%d", id)
+	case Ublox:
+		return fmt.Sprintf("+USOCL=%d", id)
+	}
+	return fmt.Sprintf("+QICLOSE=%d", id)
+}
+
+func (s *Stack) handlers() map[string]at.InfoHandler {
+	switch s.dialect {
+	case SIMCom:
+		return map[string]at.InfoHandler{
+			"+CIPOPEN:": s.handleOpen,
+			// distinct from the +CIPRXGET: 3 response to reads.
+			"+CIPRXGET: 1,": s.handleCIPRXGET,
+			"+IPCLOSE:":     s.handleIPCLOSE,
+		}
+	case Telit:
+		return map[string]at.InfoHandler{
+			"SRING:": s.handleSRING,
+			// distinct from the bare NO CARRIER final response.
+			"NO CARRIER:": s.handleNoCarrier,
+		}
+	case Ublox:
+		return map[string]at.InfoHandler{
+			"+UUSORD:": s.handleUUSORD,
+			"+UUSOCL:": s.handleUUSOCL,
+		}
+	}
+	return map[string]at.InfoHandler{
+		"+QIOPEN:": s.handleOpen,
+		"+QIURC:":  s.handleQIURC,
+	}
+}
+
+func (s *Stack) cancelIndications() {
+	for prefix := range s.handlers() {
+		s.CancelIndication(prefix)
+	}
+}
+
+func (s *Stack) conn(id string) *Conn {
+	i, err := strconv.Atoi(id)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns[i]
+}
+
+// handleOpen handles the +QIOPEN: <id>,<err> and +CIPOPEN: <id>,<err>
+// indications.
+func (s *Stack) handleOpen(i []string) {
+	l := i[0]
+	fields := info.Fields(strings.TrimSpace(l[strings.Index(l, ":")+1:]))
+	if len(fields) < 2 {
+		return
+	}
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	opened := s.opens[id]
+	s.mu.Unlock()
+	if opened != nil {
+		opened <- code
+	}
+}
+
+// handleQIURC handles the +QIURC: "recv",<id> and +QIURC: "closed",<id>
+// indications.
+func (s *Stack) handleQIURC(i []string) {
+	fields := info.Fields(info.TrimPrefix(i[0], "+QIURC"))
+	if len(fields) < 2 {
+		return
+	}
+	c := s.conn(fields[1])
+	if c == nil {
+		return
+	}
+	switch fields[0] {
+	case "recv":
+		c.kick()
+	case "closed":
+		c.remoteClosed()
+	}
+}
+
+// handleCIPRXGET handles the +CIPRXGET: 1,<id> indication.
+func (s *Stack) handleCIPRXGET(i []string) {
+	fields := info.Fields(strings.TrimPrefix(i[0], "+CIPRXGET: 1,"))
+	if c := s.conn(fields[0]); c != nil {
+		c.kick()
+	}
+}
+
+// handleIPCLOSE handles the +IPCLOSE: <id>,<reason> indication.
+func (s *Stack) handleIPCLOSE(i []string) {
+	fields := info.Fields(info.TrimPrefix(i[0], "+IPCLOSE"))
+	if c := s.conn(fields[0]); c != nil {
+		c.remoteClosed()
+	}
+}
+
+// handleSRING handles the SRING: <id> indication.
+func (s *Stack) handleSRING(i []string) {
+	fields := info.Fields(info.TrimPrefix(i[0], "SRING"))
+	if c := s.conn(fields[0]); c != nil {
+		c.kick()
+	}
+}
+
+// handleNoCarrier handles the NO CARRIER: <id>,<cause> indication.
+func (s *Stack) handleNoCarrier(i []string) {
+	fields := info.Fields(info.TrimPrefix(i[0], "NO CARRIER"))
+	if c := s.conn(fields[0]); c != nil {
+		c.remoteClosed()
+	}
+}
+
+// handleUUSORD handles the +UUSORD: <id>,<length> indication.
+func (s *Stack) handleUUSORD(i []string) {
+	fields := info.Fields(info.TrimPrefix(i[0], "+UUSORD"))
+	if c := s.conn(fields[0]); c != nil {
+		c.kick()
+	}
+}
+
+// handleUUSOCL handles the +UUSOCL: <id> indication.
+func (s *Stack) handleUUSOCL(i []string) {
+	fields := info.Fields(info.TrimPrefix(i[0], "+UUSOCL"))
+	if c := s.conn(fields[0]); c != nil {
+		c.remoteClosed()
+	}
+}
+
+// OpenError indicates Dial failed to establish the connection.
+//
+// The value is the vendor specific error code.
+type OpenError int
+
+func (e OpenError) Error() string {
+	return "open failed: " + strconv.Itoa(int(e))
+}
+
+var (
+	// ErrClosed indicates the connection has been closed.
+	ErrClosed = errors.New("connection closed")
+
+	// ErrDeadlineExceeded indicates an operation did not complete within the
+	// required time.
+	ErrDeadlineExceeded = errors.New("deadline exceeded")
+
+	// ErrMalformedResponse indicates the modem returned a badly formed
+	// response.
+	ErrMalformedResponse = errors.New("modem returned malformed response")
+
+	// ErrNoFreeConnection indicates all the connections supported by the
+	// modem are in use.
+	ErrNoFreeConnection = errors.New("no free connection")
+
+	// ErrUnsupportedNetwork indicates the network passed to Dial is not
+	// supported.
+	ErrUnsupportedNetwork = errors.New("unsupported network")
+)
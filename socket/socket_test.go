@@ -0,0 +1,507 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package socket_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/socket"
+)
+
+func TestStart(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect socket.Dialect
+		cmdSet  map[string][]string
+		err     error
+	}{
+		{
+			"quectel",
+			socket.Quectel,
+			map[string][]string{"AT+QICFG=\"dataformat\",0,1\r\n": {"OK\r\n"}},
+			nil,
+		},
+		{
+			"simcom",
+			socket.SIMCom,
+			map[string][]string{"AT+CIPRXGET=1\r\n": {"OK\r\n"}},
+			nil,
+		},
+		{
+			"telit",
+			socket.Telit,
+			nil,
+			nil,
+		},
+		{
+			"ublox",
+			socket.Ublox,
+			map[string][]string{"AT+UDCONF=1,1\r\n": {"OK\r\n"}},
+			nil,
+		},
+		{
+			"error",
+			socket.Quectel,
+			nil,
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			s, mm := setupModem(t, p.cmdSet, p.dialect)
+			defer teardownModem(mm)
+			err := s.Start()
+			assert.True(t, errors.Is(err, p.err), err)
+			if err != nil {
+				// handlers removed so can be restarted
+				err = s.AddIndication("+QIURC:", func([]string) {})
+				assert.Nil(t, err)
+			}
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestDial(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QICFG=\"dataformat\",0,1\r\n":                  {"OK\r\n"},
+		"AT+QIOPEN=2,0,\"TCP\",\"example.com\",80,0,0\r\n": {"OK\r\n", "+QIOPEN: 0,0\r\n"},
+		"AT+QIOPEN=2,1,\"UDP\",\"example.com\",53,0,0\r\n": {"OK\r\n", "+QIOPEN: 1,0\r\n"},
+		"AT+QIOPEN=2,1,\"TCP\",\"badhost\",80,0,0\r\n":     {"OK\r\n", "+QIOPEN: 1,565\r\n"},
+		"AT+QIOPEN=2,1,\"TCP\",\"slow\",80,0,0\r\n":        {"OK\r\n"},
+		"AT+QICLOSE=0\r\n":                                 {"OK\r\n"},
+		"AT+QICLOSE=1\r\n":                                 {"OK\r\n"},
+		"AT+QIRD=0,750\r\n":                                {"+QIRD: 0\r\n", "OK\r\n"},
+		"AT+QIRD=1,750\r\n":                                {"+QIRD: 0\r\n", "OK\r\n"},
+	}
+	s, mm := setupModem(t, cmdSet, socket.Quectel,
+		socket.WithContextID(2),
+		socket.WithOpenTimeout(50*time.Millisecond))
+	defer teardownModem(mm)
+	err := s.Start()
+	require.Nil(t, err)
+
+	c, err := s.Dial("tcp", "example.com:80")
+	require.Nil(t, err)
+	assert.Equal(t, 0, c.ID())
+
+	_, err = s.Dial("tcp", "badhost:80")
+	assert.Equal(t, socket.OpenError(565), err)
+	assert.Equal(t, "open failed: 565", err.Error())
+
+	_, err = s.Dial("tcp", "slow:80")
+	assert.Equal(t, socket.ErrDeadlineExceeded, err)
+
+	_, err = s.Dial("tcp", "unknown:80")
+	assert.Equal(t, at.ErrError, errors.Unwrap(err))
+
+	_, err = s.Dial("unix", "example.com:80")
+	assert.Equal(t, socket.ErrUnsupportedNetwork, err)
+
+	_, err = s.Dial("tcp", "example.com")
+	assert.NotNil(t, err)
+
+	// id released by failures
+	u, err := s.Dial("udp", "example.com:53")
+	require.Nil(t, err)
+	assert.Equal(t, 1, u.ID())
+
+	err = u.Close()
+	assert.Nil(t, err)
+	err = c.Close()
+	assert.Nil(t, err)
+	_, err = c.Read(make([]byte, 10))
+	assert.Equal(t, socket.ErrClosed, err)
+	_, err = c.Write([]byte("hello"))
+	assert.Equal(t, socket.ErrClosed, err)
+}
+
+func TestDialTelit(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT#SCFGEXT=1,0,1,0\r\n":                 {"OK\r\n"},
+		"AT#SCFGEXT=2,0,1,0\r\n":                 {"OK\r\n"},
+		"AT#SD=1,0,80,\"example.com\",0,0,1\r\n": {"OK\r\n"},
+		"AT#SD=2,1,53,\"example.com\",0,0,1\r\n": {"OK\r\n"},
+		"AT#SD=2,0,80,\"slow\",0,0,1\r\n":        {""},
+		"AT#SH=1\r\n":                            {"OK\r\n"},
+		"AT#SH=2\r\n":                            {"OK\r\n"},
+		"AT#SRECV=1,750\r\n":                     {"#SRECV: 1,0\r\n", "OK\r\n"},
+		"AT#SRECV=2,750\r\n":                     {"#SRECV: 2,0\r\n", "OK\r\n"},
+	}
+	s, mm := setupModem(t, cmdSet, socket.Telit,
+		socket.WithOpenTimeout(50*time.Millisecond))
+	defer teardownModem(mm)
+	err := s.Start()
+	require.Nil(t, err)
+
+	c, err := s.Dial("tcp", "example.com:80")
+	require.Nil(t, err)
+	assert.Equal(t, 1, c.ID())
+
+	_, err = s.Dial("tcp", "badhost:80")
+	assert.Equal(t, at.ErrError, errors.Unwrap(err))
+
+	_, err = s.Dial("tcp", "slow:80")
+	assert.Equal(t, socket.ErrDeadlineExceeded, err)
+
+	// id released by failures
+	u, err := s.Dial("udp", "example.com:53")
+	require.Nil(t, err)
+	assert.Equal(t, 2, u.ID())
+
+	assert.Nil(t, u.Close())
+	assert.Nil(t, c.Close())
+}
+
+func TestDialUblox(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+UDCONF=1,1\r\n":                 {"OK\r\n"},
+		"AT+USOCR=6\r\n":                    {"+USOCR: 0\r\n", "OK\r\n"},
+		"AT+USOCR=17\r\n":                   {"+USOCR: 1\r\n", "OK\r\n"},
+		"AT+USOCO=0,\"example.com\",80\r\n": {"OK\r\n"},
+		"AT+USOCO=1,\"example.com\",53\r\n": {"OK\r\n"},
+		"AT+USOCO=0,\"slow\",80\r\n":        {""},
+		"AT+USOCL=0\r\n":                    {"OK\r\n"},
+		"AT+USOCL=1\r\n":                    {"OK\r\n"},
+		"AT+USORD=0,512\r\n":                {"+USORD: 0,0,\"\"\r\n", "OK\r\n"},
+		"AT+USORD=1,512\r\n":                {"+USORD: 1,0,\"\"\r\n", "OK\r\n"},
+	}
+	s, mm := setupModem(t, cmdSet, socket.Ublox,
+		socket.WithOpenTimeout(50*time.Millisecond))
+	defer teardownModem(mm)
+	err := s.Start()
+	require.Nil(t, err)
+
+	c, err := s.Dial("tcp", "example.com:80")
+	require.Nil(t, err)
+	assert.Equal(t, 0, c.ID())
+	assert.Nil(t, c.Close())
+
+	_, err = s.Dial("tcp", "badhost:80")
+	assert.Equal(t, at.ErrError, errors.Unwrap(err))
+
+	_, err = s.Dial("tcp", "slow:80")
+	assert.Equal(t, socket.ErrDeadlineExceeded, err)
+
+	u, err := s.Dial("udp", "example.com:53")
+	require.Nil(t, err)
+	assert.Equal(t, 1, u.ID())
+	assert.Nil(t, u.Close())
+}
+
+func TestRead(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect socket.Dialect
+		start   string
+		open    []string
+		recv    string
+		closed  string
+	}{
+		{
+			"quectel",
+			socket.Quectel,
+			"AT+QICFG=\"dataformat\",0,1\r\n",
+			[]string{"AT+QIOPEN=1,0,\"TCP\",\"example.com\",80,0,0\r\n", "+QIOPEN: 0,0\r\n"},
+			"+QIURC: \"recv\",0\r\n",
+			"+QIURC: \"closed\",0\r\n",
+		},
+		{
+			"simcom",
+			socket.SIMCom,
+			"AT+CIPRXGET=1\r\n",
+			[]string{"AT+CIPOPEN=0,\"TCP\",\"example.com\",80\r\n", "+CIPOPEN: 0,0\r\n"},
+			"+CIPRXGET: 1,0\r\n",
+			"+IPCLOSE: 0,1\r\n",
+		},
+		{
+			"telit",
+			socket.Telit,
+			"AT#SCFGEXT=1,0,1,0\r\n",
+			[]string{"AT#SD=1,0,80,\"example.com\",0,0,1\r\n", ""},
+			"SRING: 1\r\n",
+			"NO CARRIER: 1,1\r\n",
+		},
+		{
+			"ublox",
+			socket.Ublox,
+			"AT+UDCONF=1,1\r\n",
+			[]string{"AT+USOCR=6\r\n", "+USOCR: 0\r\n", "AT+USOCO=0,\"example.com\",80\r\n"},
+			"+UUSORD: 0,13\r\n",
+			"+UUSOCL: 0\r\n",
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet := map[string][]string{
+				p.start:   {"OK\r\n"},
+				p.open[0]: {"OK\r\n"},
+			}
+			switch {
+			case len(p.open) > 2:
+				// the response precedes the OK, and the socket is then connected.
+				cmdSet[p.open[0]] = []string{p.open[1], "OK\r\n"}
+				cmdSet[p.open[2]] = []string{"OK\r\n"}
+			case p.open[1] != "":
+				cmdSet[p.open[0]] = append(cmdSet[p.open[0]], p.open[1])
+			}
+			s, mm := setupModem(t, cmdSet, p.dialect)
+			defer teardownModem(mm)
+			rm := &remote{dialect: p.dialect}
+			mm.responder = rm.respond
+			err := s.Start()
+			require.Nil(t, err)
+			c, err := s.Dial("tcp", "example.com:80")
+			require.Nil(t, err)
+
+			rm.push([]byte("hello\r\n>world"))
+			mm.r <- []byte(p.recv)
+			buf := make([]byte, 20)
+			c.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, err := c.Read(buf)
+			require.Nil(t, err)
+			assert.Equal(t, "hello\r\n>world", string(buf[:n]))
+
+			c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+			_, err = c.Read(buf)
+			assert.Equal(t, socket.ErrDeadlineExceeded, err)
+
+			c.SetReadDeadline(time.Time{})
+			rm.push([]byte("bye"))
+			mm.r <- []byte(p.closed)
+			n, err = c.Read(buf)
+			require.Nil(t, err)
+			assert.Equal(t, "bye", string(buf[:n]))
+			_, err = c.Read(buf)
+			assert.Equal(t, io.EOF, err)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestWatermarks(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QICFG=\"dataformat\",0,1\r\n":                  {"OK\r\n"},
+		"AT+QIOPEN=1,0,\"TCP\",\"example.com\",80,0,0\r\n": {"OK\r\n", "+QIOPEN: 0,0\r\n"},
+	}
+	s, mm := setupModem(t, cmdSet, socket.Quectel, socket.WithWatermarks(8, 4))
+	defer teardownModem(mm)
+	rm := &remote{dialect: socket.Quectel}
+	mm.responder = rm.respond
+	err := s.Start()
+	require.Nil(t, err)
+	c, err := s.Dial("tcp", "example.com:80")
+	require.Nil(t, err)
+
+	rm.push([]byte("abcdefghijklmnopqrstuvwxyz"))
+	mm.r <- []byte("+QIURC: \"recv\",0\r\n")
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	var rx []byte
+	buf := make([]byte, 5)
+	for len(rx) < 26 {
+		// allow the buffer to fill
+		time.Sleep(5 * time.Millisecond)
+		n, err := c.Read(buf)
+		require.Nil(t, err)
+		rx = append(rx, buf[:n]...)
+	}
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz", string(rx))
+	for _, n := range rm.requests() {
+		assert.LessOrEqual(t, n, 8)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect socket.Dialect
+		cmdSet  map[string][]string
+	}{
+		{
+			"quectel",
+			socket.Quectel,
+			map[string][]string{
+				"AT+QICFG=\"dataformat\",0,1\r\n":                  {"OK\r\n"},
+				"AT+QIOPEN=1,0,\"TCP\",\"example.com\",80,0,0\r\n": {"OK\r\n", "+QIOPEN: 0,0\r\n"},
+				"AT+QIRD=0,750\r\n":                                {"+QIRD: 0\r\n", "OK\r\n"},
+				"AT+QISEND=0,5\r":                                  {"\r\n> "},
+				"hello":                                            {"\r\nSEND OK\r\n"},
+			},
+		},
+		{
+			"simcom",
+			socket.SIMCom,
+			map[string][]string{
+				"AT+CIPRXGET=1\r\n":                           {"OK\r\n"},
+				"AT+CIPOPEN=0,\"TCP\",\"example.com\",80\r\n": {"OK\r\n", "+CIPOPEN: 0,0\r\n"},
+				"AT+CIPRXGET=3,0,750\r\n":                     {"+CIPRXGET: 3,0,0,0\r\n", "OK\r\n"},
+				"AT+CIPSEND=0,5\r":                            {"\r\n> "},
+				"hello":                                       {"\r\nOK\r\n"},
+			},
+		},
+		{
+			"telit",
+			socket.Telit,
+			map[string][]string{
+				"AT#SCFGEXT=1,0,1,0\r\n":                 {"OK\r\n"},
+				"AT#SD=1,0,80,\"example.com\",0,0,1\r\n": {"OK\r\n"},
+				"AT#SRECV=1,750\r\n":                     {"#SRECV: 1,0\r\n", "OK\r\n"},
+				"AT#SSENDEXT=1,5\r":                      {"\r\n> "},
+				"hello":                                  {"\r\nOK\r\n"},
+			},
+		},
+		{
+			"ublox",
+			socket.Ublox,
+			map[string][]string{
+				"AT+UDCONF=1,1\r\n":                 {"OK\r\n"},
+				"AT+USOCR=6\r\n":                    {"+USOCR: 0\r\n", "OK\r\n"},
+				"AT+USOCO=0,\"example.com\",80\r\n": {"OK\r\n"},
+				"AT+USORD=0,512\r\n":                {"+USORD: 0,0,\"\"\r\n", "OK\r\n"},
+				"AT+USOWR=0,5,\"68656c6c6f\"\r\n":   {"+USOWR: 0,5\r\n", "OK\r\n"},
+			},
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			s, mm := setupModem(t, p.cmdSet, p.dialect)
+			defer teardownModem(mm)
+			err := s.Start()
+			require.Nil(t, err)
+			c, err := s.Dial("tcp", "example.com:80")
+			require.Nil(t, err)
+			n, err := c.Write([]byte("hello"))
+			assert.Nil(t, err)
+			assert.Equal(t, 5, n)
+			n, err = c.Write([]byte("bye"))
+			assert.Equal(t, at.ErrError, errors.Unwrap(err))
+			assert.Equal(t, 0, n)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+// remote emulates data received by the modem and awaiting retrieval.
+type remote struct {
+	dialect socket.Dialect
+	mu      sync.Mutex
+	data    []byte
+	reqs    []int
+}
+
+func (r *remote) push(data []byte) {
+	r.mu.Lock()
+	r.data = append(r.data, data...)
+	r.mu.Unlock()
+}
+
+func (r *remote) requests() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.reqs...)
+}
+
+var readRegex = regexp.MustCompile(`^AT(\+QIRD=0|\+CIPRXGET=3,0|#SRECV=1|\+USORD=0),(\d+)\r\n$`)
+
+func (r *remote) respond(cmd string) []string {
+	m := readRegex.FindStringSubmatch(cmd)
+	if m == nil {
+		return nil
+	}
+	n, _ := strconv.Atoi(m[2])
+	r.mu.Lock()
+	r.reqs = append(r.reqs, n)
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	d := r.data[:n]
+	r.data = r.data[n:]
+	rest := len(r.data)
+	r.mu.Unlock()
+	var rsp []string
+	switch r.dialect {
+	case socket.SIMCom:
+		rsp = append(rsp, fmt.Sprintf("+CIPRXGET: 3,0,%d,%d\r\n", n, rest))
+	case socket.Telit:
+		rsp = append(rsp, fmt.Sprintf("#SRECV: 1,%d\r\n", n))
+	case socket.Ublox:
+		// the data is inline
+		return []string{fmt.Sprintf("+USORD: 0,%d,\"%s\"\r\n", n, hex.EncodeToString(d)), "OK\r\n"}
+	default:
+		rsp = append(rsp, fmt.Sprintf("+QIRD: %d\r\n", n))
+	}
+	if n > 0 {
+		rsp = append(rsp, hex.EncodeToString(d)+"\r\n")
+	}
+	return append(rsp, "OK\r\n")
+}
+
+type mockModem struct {
+	cmdSet    map[string][]string
+	responder func(cmd string) []string
+	closed    bool
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if data == nil {
+		return 0, at.ErrClosed
+	}
+	copy(p, data) // assumes p is empty
+	if !ok {
+		return len(data), fmt.Errorf("closed with data")
+	}
+	return len(data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	if mm.closed {
+		return 0, at.ErrClosed
+	}
+	v := mm.cmdSet[string(p)]
+	if len(v) == 0 && mm.responder != nil {
+		v = mm.responder(string(p))
+	}
+	if len(v) == 0 {
+		mm.r <- []byte("\r\nERROR\r\n")
+	} else {
+		for _, l := range v {
+			mm.r <- []byte(l)
+		}
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) Close() error {
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
+
+func setupModem(t *testing.T, cmdSet map[string][]string, d socket.Dialect, options ...socket.Option) (*socket.Stack, *mockModem) {
+	mm := &mockModem{cmdSet: cmdSet, r: make(chan []byte, 10)}
+	s := socket.New(at.New(mm), d, options...)
+	require.NotNil(t, s)
+	return s, mm
+}
+
+func teardownModem(mm *mockModem) {
+	mm.Close()
+}
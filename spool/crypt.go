@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package spool
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// KeyProvider provides the key used to encrypt message files.
+//
+// The key must be 16, 24 or 32 bytes long, to select AES-128, AES-192 or
+// AES-256.  The provider may retrieve the key from wherever it is held, such
+// as the environment or a KMS.
+type KeyProvider func() ([]byte, error)
+
+// KeyFromEnv returns a KeyProvider that reads the key from the named
+// environment variable, encoded in hex or base64.
+func KeyFromEnv(name string) KeyProvider {
+	return func() ([]byte, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", name, ErrNoKey)
+		}
+		if k, err := hex.DecodeString(v); err == nil {
+			return k, nil
+		}
+		k, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key must be hex or base64", name)
+		}
+		return k, nil
+	}
+}
+
+type encryptionOption KeyProvider
+
+func (o encryptionOption) applyOption(s *Spool) {
+	s.kp = KeyProvider(o)
+}
+
+// WithEncryption encrypts the message files written by the spool using
+// AES-GCM, with the key from the KeyProvider, so message content is not
+// stored in the clear.
+//
+// The key is requested once, when the spool is created.
+//
+// Encrypted files are not readable by other tools, so this should not be used
+// where other processes read the sent/, failed/ or incoming/ directories.
+// Files dropped into outgoing/ by other processes may still be plaintext.
+func WithEncryption(kp KeyProvider) Option {
+	return encryptionOption(kp)
+}
+
+// encryptedMagic prefixes encrypted message files, distinguishing them from
+// plaintext message files.
+var encryptedMagic = []byte("SPOOL-AES-GCM\n")
+
+func newAEAD(kp KeyProvider) (cipher.AEAD, error) {
+	key, err := kp()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the content of a message file, if encryption is enabled.
+func (s *Spool) seal(b []byte) ([]byte, error) {
+	if s.aead == nil {
+		return b, nil
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), encryptedMagic...)
+	out = append(out, nonce...)
+	return s.aead.Seal(out, nonce, b, encryptedMagic), nil
+}
+
+// open decrypts the content of a message file, if it is encrypted.
+func (s *Spool) open(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, encryptedMagic) {
+		return b, nil
+	}
+	if s.aead == nil {
+		return nil, ErrNoKey
+	}
+	b = b[len(encryptedMagic):]
+	ns := s.aead.NonceSize()
+	if len(b) < ns {
+		return nil, ErrDecrypt
+	}
+	p, err := s.aead.Open(nil, b[:ns], b[ns:], encryptedMagic)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return p, nil
+}
+
+var (
+	// ErrDecrypt indicates an encrypted message file could not be decrypted,
+	// as it is corrupt or was encrypted with a different key.
+	ErrDecrypt = errors.New("message file decryption failed")
+
+	// ErrNoKey indicates a message file is encrypted, but no key is
+	// available to decrypt it.
+	ErrNoKey = errors.New("no encryption key")
+)
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package spool_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/modem/spool"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func staticKey(key []byte) spool.KeyProvider {
+	return func() ([]byte, error) {
+		return key, nil
+	}
+}
+
+func TestWithEncryption(t *testing.T) {
+	s := &sender{}
+	sp, teardown := setupSpool(t, s,
+		spool.WithEncryption(staticKey(testKey)),
+		spool.WithStatusReports())
+	defer teardown()
+
+	// plaintext dropped by another process
+	err := ioutil.WriteFile(filepath.Join(sp.Dir(), "outgoing", "0plain"),
+		[]byte("To: +1234\n\nplain text\n"), 0644)
+	require.Nil(t, err)
+	sname, err := sp.Submit("+1234", "secret message")
+	require.Nil(t, err)
+	raw := readFile(t, filepath.Join(sp.Dir(), "outgoing", sname))
+	assert.False(t, strings.Contains(raw, "secret"), raw)
+
+	n, err := sp.Process()
+	require.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []sent{{"+1234", "plain text"}, {"+1234", "secret message"}}, s.Sent())
+
+	raw = readFile(t, filepath.Join(sp.Dir(), "sent", sname))
+	assert.False(t, strings.Contains(raw, "secret"), raw)
+	fi, err := os.Stat(filepath.Join(sp.Dir(), "sent", sname))
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	_, err = sp.Report(gsm.StatusReport{MR: 42, Status: gsm.Delivered, DT: time.Now()})
+	assert.Nil(t, err)
+	b, err := sp.ReadFile(filepath.Join(sp.Dir(), "sent", sname))
+	require.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "To: +1234\n"), string(b))
+	assert.Contains(t, string(b), "\nStatus: 42,")
+	assert.True(t, strings.HasSuffix(string(b), "\n\nsecret message\n"), string(b))
+
+	rname, err := sp.Store(gsm.Message{Number: "+4321", Message: "received secret"})
+	require.Nil(t, err)
+	raw = readFile(t, filepath.Join(sp.Dir(), "incoming", rname))
+	assert.False(t, strings.Contains(raw, "secret"), raw)
+	b, err = sp.ReadFile(filepath.Join(sp.Dir(), "incoming", rname))
+	require.Nil(t, err)
+	assert.True(t, strings.HasSuffix(string(b), "\n\nreceived secret\n"), string(b))
+
+	// wrong key
+	wk, err := spool.New(sp.Dir(), s, spool.WithEncryption(staticKey([]byte("fedcba9876543210"))))
+	require.Nil(t, err)
+	_, err = wk.ReadFile(filepath.Join(sp.Dir(), "incoming", rname))
+	assert.Equal(t, spool.ErrDecrypt, err)
+
+	// no key
+	nk, err := spool.New(sp.Dir(), s)
+	require.Nil(t, err)
+	_, err = nk.ReadFile(filepath.Join(sp.Dir(), "incoming", rname))
+	assert.Equal(t, spool.ErrNoKey, err)
+}
+
+func TestWithEncryptionBadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = spool.New(dir, &sender{}, spool.WithEncryption(staticKey([]byte("short"))))
+	assert.NotNil(t, err)
+
+	kerr := errors.New("kms unavailable")
+	_, err = spool.New(dir, &sender{}, spool.WithEncryption(func() ([]byte, error) {
+		return nil, kerr
+	}))
+	assert.Equal(t, kerr, err)
+}
+
+func TestKeyFromEnv(t *testing.T) {
+	const name = "SPOOL_TEST_KEY"
+	defer os.Unsetenv(name)
+
+	os.Unsetenv(name)
+	_, err := spool.KeyFromEnv(name)()
+	assert.True(t, errors.Is(err, spool.ErrNoKey), err)
+
+	os.Setenv(name, "000102030405060708090a0b0c0d0e0f")
+	k, err := spool.KeyFromEnv(name)()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, k)
+
+	os.Setenv(name, "MDEyMzQ1Njc4OWFiY2RlZg==")
+	k, err = spool.KeyFromEnv(name)()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("0123456789abcdef"), k)
+
+	os.Setenv(name, "not a key!")
+	_, err = spool.KeyFromEnv(name)()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,530 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package spool provides a file based outbound message spool, compatible
+// with the smstools workflow, so other processes can send SMS by dropping
+// files into a directory.
+//
+// The spool directory contains five subdirectories:
+//
+//	tmp/      - files being written, as per maildir
+//	outgoing/ - messages waiting to be sent
+//	sent/     - messages that were sent
+//	failed/   - messages that could not be sent
+//	incoming/ - messages received, if stored using Store
+//
+// A message file contains a header, in the form of "Key: value" lines, a blank
+// line, then the message text, e.g.
+//
+//	To: +61412345678
+//
+//	Hello world
+//
+// Files should be written to tmp/ and renamed into outgoing/, so they are
+// never seen partially written, or written directly to outgoing/ while a
+// lock file, the file name with a ".LOCK" suffix, exists.
+//
+// Once processed, the file is moved to sent/ or failed/ with the result
+// appended to its header, in the form of "Sent", "Message_id", "Failed" and
+// "Error" fields.  Status reports passed to Report are similarly appended to
+// the sent message, as "Status" and "Delivery" fields.
+//
+// Messages not sent because the circuit breaker of the modem is open, as per
+// gsm.WithCircuitBreaker, are left in outgoing/ to be retried in a later
+// pass, rather than being failed, and the remainder of the pass is skipped.
+//
+// The files written by the spool may be encrypted, using WithEncryption, in
+// which case they must be read using ReadFile.
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+)
+
+// Sender sends SMS messages, and is typically a *gsm.GSM.
+type Sender interface {
+	SendLongMessage(number string, message string, options ...at.CommandOption) ([]string, error)
+}
+
+// ErrorHandler receives errors encountered processing the spool, other than
+// send errors, which are recorded in the failed message.
+type ErrorHandler func(error)
+
+// Result is the outcome of sending a spooled message.
+type Result struct {
+	// Name is the name of the message file.
+	Name string
+
+	// To is the number the message was sent to.
+	To string
+
+	// Message is the text of the message.
+	Message string
+
+	// MRs are the message references returned for each part of the message.
+	MRs []string
+
+	// Err is the error returned by the send, or nil if it was sent.
+	Err error
+
+	// Time is the time the send completed.
+	Time time.Time
+}
+
+// ResultHandler receives the results of sending spooled messages.
+type ResultHandler func(Result)
+
+// Spool sends messages from a spool directory.
+type Spool struct {
+	dir    string
+	s      Sender
+	period time.Duration
+	eh     ErrorHandler
+	rh     ResultHandler
+	dh     DeliveryHandler
+	kp     KeyProvider
+	aead   cipher.AEAD
+
+	// reports indicates status reports are requested for messages sent, so
+	// the messages are tracked until their delivery is known.
+	reports bool
+
+	// mu protects sent, deliveries and period.
+	mu sync.Mutex
+
+	// sent maps the MRs of sent messages to their file names, so status
+	// reports can be recorded against them.
+	sent map[string]string
+
+	// deliveries maps the file names of sent messages to the parts yet to be
+	// delivered, until the outcome of the delivery is known.
+	deliveries map[string]*delivery
+
+	// periodCh signals Run that the period has changed.
+	periodCh chan struct{}
+}
+
+// Option is a construction option for the Spool.
+type Option interface {
+	applyOption(*Spool)
+}
+
+// The subdirectories of the spool.
+const (
+	tmpDir      = "tmp"
+	outgoingDir = "outgoing"
+	sentDir     = "sent"
+	failedDir   = "failed"
+	incomingDir = "incoming"
+)
+
+// New creates a Spool in the directory, creating the subdirectories if
+// necessary, that sends messages using the Sender.
+func New(dir string, s Sender, options ...Option) (*Spool, error) {
+	sp := Spool{
+		dir:        dir,
+		s:          s,
+		period:     time.Second,
+		sent:       make(map[string]string),
+		deliveries: make(map[string]*delivery),
+		periodCh:   make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option.applyOption(&sp)
+	}
+	if sp.kp != nil {
+		aead, err := newAEAD(sp.kp)
+		if err != nil {
+			return nil, err
+		}
+		sp.aead = aead
+	}
+	for _, sub := range []string{tmpDir, outgoingDir, sentDir, failedDir, incomingDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &sp, nil
+}
+
+type periodOption time.Duration
+
+func (o periodOption) applyOption(s *Spool) {
+	s.period = time.Duration(o)
+}
+
+// WithPeriod specifies the period between scans of the outgoing directory by
+// Run.
+//
+// The default is 1 second.
+func WithPeriod(period time.Duration) Option {
+	return periodOption(period)
+}
+
+func (o ErrorHandler) applyOption(s *Spool) {
+	s.eh = o
+}
+
+// WithErrorHandler specifies a handler for errors processing the spool, such
+// as failing to read or move a message file.
+//
+// By default such errors are discarded.
+func WithErrorHandler(h ErrorHandler) Option {
+	return h
+}
+
+func (o ResultHandler) applyOption(s *Spool) {
+	s.rh = o
+}
+
+// WithResultHandler specifies a handler that receives the result of each
+// message sent from the spool, e.g. to correlate delivery reports with the
+// message references.
+func WithResultHandler(h ResultHandler) Option {
+	return h
+}
+
+type statusReportsOption struct{}
+
+func (o statusReportsOption) applyOption(s *Spool) {
+	s.reports = true
+}
+
+// WithStatusReports requests a status report for each message sent, using
+// gsm.WithStatusReportRequest, and tracks the messages sent so the reports
+// passed to Report can be recorded against them.
+//
+// Messages are tracked until the outcome of their delivery is known, their
+// MR is reused by a later message, or for deliveryTTL, so lost reports do
+// not accumulate.
+func WithStatusReports() Option {
+	return statusReportsOption{}
+}
+
+// SetPeriod changes the period between scans of the outgoing directory by
+// Run.
+//
+// This allows the period to be reconfigured while the spool is running, and
+// takes effect immediately.  Messages waiting in the spool are unaffected.
+func (s *Spool) SetPeriod(period time.Duration) {
+	s.mu.Lock()
+	s.period = period
+	s.mu.Unlock()
+	select {
+	case s.periodCh <- struct{}{}:
+	default:
+	}
+}
+
+// Dir returns the path of the spool directory.
+func (s *Spool) Dir() string {
+	return s.dir
+}
+
+var seq uint32
+
+// newName returns a unique name for a message file.
+func newName() string {
+	return fmt.Sprintf("%d.%d.%d",
+		time.Now().UnixNano(), os.Getpid(), atomic.AddUint32(&seq, 1))
+}
+
+// Submit adds a message to the spool, returning the name of the message
+// file.
+func (s *Spool) Submit(number, message string) (string, error) {
+	name := newName()
+	hdr := header{{"To", number}}
+	if err := s.write(outgoingDir, name, hdr, message); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// Pending returns the names of the messages waiting to be sent, in the order
+// they will be sent.
+func (s *Spool) Pending() ([]string, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(s.dir, outgoingDir))
+	if err != nil {
+		return nil, err
+	}
+	locked := make(map[string]bool)
+	for _, fi := range fis {
+		if strings.HasSuffix(fi.Name(), ".LOCK") {
+			locked[strings.TrimSuffix(fi.Name(), ".LOCK")] = true
+		}
+	}
+	var names []string
+	for _, fi := range fis {
+		name := fi.Name()
+		if !fi.Mode().IsRegular() ||
+			strings.HasPrefix(name, ".") ||
+			strings.HasSuffix(name, ".LOCK") ||
+			locked[name] {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Process sends all the messages waiting in the spool, returning the number
+// of messages processed, whether sent or failed.
+func (s *Spool) Process() (int, error) {
+	names, err := s.Pending()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, name := range names {
+		if err := s.process(name); err != nil {
+			s.handleError(fmt.Errorf("%s: %w", name, err))
+			if errors.Is(err, gsm.ErrCircuitOpen) {
+				break
+			}
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Run processes the spool periodically until the context is done.
+func (s *Spool) Run(ctx context.Context) error {
+	s.mu.Lock()
+	period := s.period
+	s.mu.Unlock()
+	t := time.NewTicker(period)
+	defer func() {
+		t.Stop()
+	}()
+	for {
+		if _, err := s.Process(); err != nil {
+			s.handleError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		case <-s.periodCh:
+			s.mu.Lock()
+			period = s.period
+			s.mu.Unlock()
+			t.Stop()
+			t = time.NewTicker(period)
+		}
+	}
+}
+
+func (s *Spool) process(name string) error {
+	path := filepath.Join(s.dir, outgoingDir, name)
+	b, err := s.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	hdr, body := parse(b)
+	r := Result{Name: name, To: hdr.get("To"), Message: body}
+	if r.To == "" {
+		r.Err = ErrNoRecipient
+	} else {
+		var options []at.CommandOption
+		if s.reports {
+			options = append(options, gsm.WithStatusReportRequest())
+		}
+		r.MRs, r.Err = s.s.SendLongMessage(r.To, body, options...)
+	}
+	if errors.Is(r.Err, gsm.ErrCircuitOpen) && len(r.MRs) == 0 {
+		// leave the message for a later pass, once the modem has recovered
+		return r.Err
+	}
+	r.Time = time.Now()
+	ts := r.Time.Format("2006-01-02 15:04:05")
+	dst := sentDir
+	if r.Err == nil {
+		hdr.add("Sent", ts)
+		hdr.add("Message_id", strings.Join(r.MRs, ","))
+	} else {
+		dst = failedDir
+		hdr.add("Failed", ts)
+		hdr.add("Error", strings.Replace(r.Err.Error(), "\n", " ", -1))
+	}
+	if s.rh != nil {
+		s.rh(r)
+	}
+	if err := s.write(dst, name, hdr, body); err != nil {
+		return err
+	}
+	if r.Err == nil && s.reports {
+		s.track(name, r)
+	}
+	return os.Remove(path)
+}
+
+// deliveryTTL is the period after which a sent message is no longer tracked,
+// if the outcome of its delivery is still not known.
+var deliveryTTL = 72 * time.Hour
+
+// track records a sent message so status reports can be recorded against it.
+//
+// Messages with the same MRs, which have wrapped, and messages tracked for
+// longer than deliveryTTL, are no longer tracked, as their reports are
+// presumed lost.
+func (s *Spool) track(name string, r Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, mr := range r.MRs {
+		if old, ok := s.sent[mr]; ok {
+			s.untrack(old)
+		}
+	}
+	for old, d := range s.deliveries {
+		if r.Time.Sub(d.sent) > deliveryTTL {
+			s.untrack(old)
+		}
+	}
+	for _, mr := range r.MRs {
+		s.sent[mr] = name
+	}
+	s.deliveries[name] = newDelivery(r.To, r.MRs, r.Time)
+}
+
+// untrack stops tracking the sent message.
+//
+// Must be called with mu held.
+func (s *Spool) untrack(name string) {
+	for mr, n := range s.sent {
+		if n == name {
+			delete(s.sent, mr)
+		}
+	}
+	delete(s.deliveries, name)
+}
+
+// Undelivered returns the names of the sent messages being tracked, as per
+// WithStatusReports, as the outcome of their delivery is not yet known.
+func (s *Spool) Undelivered() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.deliveries))
+	for name := range s.deliveries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadFile reads a message file from the spool, decrypting it if it is
+// encrypted.
+func (s *Spool) ReadFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(b)
+}
+
+// write atomically writes a message file to the subdirectory, via tmp/.
+func (s *Spool) write(sub, name string, hdr header, body string) error {
+	b, err := s.seal(hdr.marshal(body))
+	if err != nil {
+		return err
+	}
+	perm := os.FileMode(0644)
+	if s.aead != nil {
+		perm = 0600
+	}
+	tmp := filepath.Join(s.dir, tmpDir, name)
+	if err := ioutil.WriteFile(tmp, b, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, sub, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (s *Spool) handleError(err error) {
+	if s.eh != nil {
+		s.eh(err)
+	}
+}
+
+// header is the ordered set of fields in the header of a message file.
+type header [][2]string
+
+func (h header) get(key string) string {
+	for _, f := range h {
+		if strings.EqualFold(f[0], key) {
+			return f[1]
+		}
+	}
+	return ""
+}
+
+func (h *header) add(key, value string) {
+	*h = append(*h, [2]string{key, value})
+}
+
+func (h header) marshal(body string) []byte {
+	var b bytes.Buffer
+	for _, f := range h {
+		fmt.Fprintf(&b, "%s: %s\n", f[0], f[1])
+	}
+	fmt.Fprintf(&b, "\n%s\n", body)
+	return b.Bytes()
+}
+
+// parse splits a message file into its header and body.
+//
+// The header ends at the first blank line, or the first line not in the form
+// of a header field.  A single trailing newline is removed from the body.
+func parse(b []byte) (header, string) {
+	var h header
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	offset := 0
+	for sc.Scan() {
+		line := sc.Text()
+		next := offset + len(line) + 1
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			offset = next
+			break
+		}
+		idx := strings.Index(line, ":")
+		if idx <= 0 || strings.ContainsAny(line[:idx], " \t") {
+			break
+		}
+		h.add(line[:idx], strings.TrimSpace(line[idx+1:]))
+		offset = next
+	}
+	if offset > len(b) {
+		offset = len(b)
+	}
+	body := string(b[offset:])
+	body = strings.TrimSuffix(body, "\n")
+	body = strings.TrimSuffix(body, "\r")
+	return h, body
+}
+
+var (
+	// ErrNoRecipient indicates a message file has no To field.
+	ErrNoRecipient = errors.New("no recipient")
+)
@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package spool_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/modem/spool"
+)
+
+type sent struct {
+	number  string
+	message string
+}
+
+type sender struct {
+	mu   sync.Mutex
+	sent []sent
+	err  error
+	// the number of options passed with the sends.
+	options int
+}
+
+func (s *sender) SendLongMessage(number string, message string, options ...at.CommandOption) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.sent = append(s.sent, sent{number, message})
+	s.options += len(options)
+	return []string{"42", "43"}, nil
+}
+
+func (s *sender) Sent() []sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sent(nil), s.sent...)
+}
+
+func setupSpool(t *testing.T, s spool.Sender, options ...spool.Option) (*spool.Spool, func()) {
+	dir, err := ioutil.TempDir("", "spool")
+	require.Nil(t, err)
+	sp, err := spool.New(dir, s, options...)
+	require.Nil(t, err)
+	require.NotNil(t, sp)
+	return sp, func() { os.RemoveAll(dir) }
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	return string(b)
+}
+
+func TestNew(t *testing.T) {
+	sp, teardown := setupSpool(t, &sender{})
+	defer teardown()
+	for _, sub := range []string{"tmp", "outgoing", "sent", "failed"} {
+		fi, err := os.Stat(filepath.Join(sp.Dir(), sub))
+		assert.Nil(t, err, sub)
+		if err == nil {
+			assert.True(t, fi.IsDir(), sub)
+		}
+	}
+
+	// not a directory
+	f, err := ioutil.TempFile("", "spool")
+	require.Nil(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+	sp, err = spool.New(f.Name(), &sender{})
+	assert.NotNil(t, err)
+	assert.Nil(t, sp)
+}
+
+func TestSubmit(t *testing.T) {
+	s := &sender{}
+	sp, teardown := setupSpool(t, s)
+	defer teardown()
+
+	name, err := sp.Submit("+1234", "hello\nworld")
+	require.Nil(t, err)
+	assert.Equal(t, "To: +1234\n\nhello\nworld\n",
+		readFile(t, filepath.Join(sp.Dir(), "outgoing", name)))
+	tmp, err := ioutil.ReadDir(filepath.Join(sp.Dir(), "tmp"))
+	assert.Nil(t, err)
+	assert.Empty(t, tmp)
+
+	name2, err := sp.Submit("+5678", "second")
+	require.Nil(t, err)
+	pending, err := sp.Pending()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{name, name2}, pending)
+}
+
+func TestProcess(t *testing.T) {
+	var results []spool.Result
+	rh := func(r spool.Result) {
+		results = append(results, r)
+	}
+	var errs []error
+	eh := func(err error) {
+		errs = append(errs, err)
+	}
+	s := &sender{}
+	sp, teardown := setupSpool(t, s,
+		spool.WithResultHandler(rh),
+		spool.WithErrorHandler(eh))
+	defer teardown()
+	out := filepath.Join(sp.Dir(), "outgoing")
+
+	// externally written files
+	err := ioutil.WriteFile(filepath.Join(out, "a"),
+		[]byte("To: +1234\nFlash: no\n\nhello\n"), 0644)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(out, "b"),
+		[]byte("From: me\n\nno recipient\n"), 0644)
+	require.Nil(t, err)
+	// locked
+	err = ioutil.WriteFile(filepath.Join(out, "c"),
+		[]byte("To: +5678\n\nlocked\n"), 0644)
+	require.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(out, "c.LOCK"), nil, 0644)
+	require.Nil(t, err)
+	// hidden
+	err = ioutil.WriteFile(filepath.Join(out, ".d"),
+		[]byte("To: +5678\n\nhidden\n"), 0644)
+	require.Nil(t, err)
+
+	n, err := sp.Process()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Empty(t, errs)
+	assert.Equal(t, []sent{{"+1234", "hello"}}, s.Sent())
+	require.Len(t, results, 2)
+	assert.Equal(t, "a", results[0].Name)
+	assert.Equal(t, "+1234", results[0].To)
+	assert.Equal(t, "hello", results[0].Message)
+	assert.Equal(t, []string{"42", "43"}, results[0].MRs)
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, "b", results[1].Name)
+	assert.Equal(t, spool.ErrNoRecipient, results[1].Err)
+
+	sentMsg := readFile(t, filepath.Join(sp.Dir(), "sent", "a"))
+	assert.True(t, strings.HasPrefix(sentMsg, "To: +1234\nFlash: no\nSent: "), sentMsg)
+	assert.True(t, strings.HasSuffix(sentMsg, "\nMessage_id: 42,43\n\nhello\n"), sentMsg)
+	failedMsg := readFile(t, filepath.Join(sp.Dir(), "failed", "b"))
+	assert.True(t, strings.HasPrefix(failedMsg, "From: me\nFailed: "), failedMsg)
+	assert.True(t, strings.HasSuffix(failedMsg, "\nError: no recipient\n\nno recipient\n"), failedMsg)
+
+	pending, err := sp.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+
+	// unlocked
+	err = os.Remove(filepath.Join(out, "c.LOCK"))
+	require.Nil(t, err)
+	n, err = sp.Process()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []sent{{"+1234", "hello"}, {"+5678", "locked"}}, s.Sent())
+}
+
+func TestProcessSendError(t *testing.T) {
+	s := &sender{err: errors.New("CMS ERROR: 500")}
+	sp, teardown := setupSpool(t, s)
+	defer teardown()
+
+	name, err := sp.Submit("+1234", "hello")
+	require.Nil(t, err)
+	n, err := sp.Process()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	failedMsg := readFile(t, filepath.Join(sp.Dir(), "failed", name))
+	assert.True(t, strings.HasSuffix(failedMsg, "\nError: CMS ERROR: 500\n\nhello\n"), failedMsg)
+	_, err = os.Stat(filepath.Join(sp.Dir(), "outgoing", name))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestProcessCircuitOpen(t *testing.T) {
+	s := &sender{err: gsm.ErrCircuitOpen}
+	var errs []error
+	sp, teardown := setupSpool(t, s, spool.WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	defer teardown()
+
+	name1, err := sp.Submit("+1234", "hello")
+	require.Nil(t, err)
+	name2, err := sp.Submit("+1234", "world")
+	require.Nil(t, err)
+	n, err := sp.Process()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	// pass is abandoned after the first
+	require.Equal(t, 1, len(errs))
+	assert.True(t, errors.Is(errs[0], gsm.ErrCircuitOpen))
+	pending, err := sp.Pending()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{name1, name2}, pending)
+
+	// sent once the breaker closes
+	s.mu.Lock()
+	s.err = nil
+	s.mu.Unlock()
+	n, err = sp.Process()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []sent{{"+1234", "hello"}, {"+1234", "world"}}, s.Sent())
+}
+
+func TestRun(t *testing.T) {
+	s := &sender{}
+	sp, teardown := setupSpool(t, s, spool.WithPeriod(time.Millisecond))
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- sp.Run(ctx)
+	}()
+	_, err := sp.Submit("+1234", "hello")
+	require.Nil(t, err)
+	assert.Eventually(t, func() bool { return len(s.Sent()) == 1 },
+		time.Second, time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Error("Run failed to return")
+	}
+}
+
+func TestSetPeriod(t *testing.T) {
+	s := &sender{}
+	sp, teardown := setupSpool(t, s, spool.WithPeriod(time.Hour))
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sp.Run(ctx)
+	// allow the initial scan to complete
+	time.Sleep(10 * time.Millisecond)
+	_, err := sp.Submit("+1234", "hello")
+	require.Nil(t, err)
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, s.Sent())
+
+	sp.SetPeriod(time.Millisecond)
+	assert.Eventually(t, func() bool { return len(s.Sent()) == 1 },
+		time.Second, time.Millisecond)
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/warthog618/modem/gsm"
+)
+
+// Store stores a received message in the incoming directory, returning the
+// name of the message file.
+//
+// The header contains the "From", "Sent" and "Received" fields, the latter
+// two being the SMSC timestamp and the local time the message was stored.
+//
+// It can be wrapped to form the message handler passed to StartMessageRx.
+func (s *Spool) Store(m gsm.Message) (string, error) {
+	name := newName()
+	hdr := header{{"From", m.Number}}
+	if !m.SCTS.Time.IsZero() {
+		hdr.add("Sent", m.SCTS.Time.Format("2006-01-02 15:04:05"))
+	}
+	hdr.add("Received", time.Now().Format("2006-01-02 15:04:05"))
+	if err := s.write(incomingDir, name, hdr, m.Message); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// Delivery is the outcome of delivering a message sent from the spool, as
+// aggregated from the status reports for each of its parts.
+type Delivery struct {
+	// Name is the name of the message file.
+	Name string
+
+	// To is the number the message was sent to.
+	To string
+
+	// MRs are the message references of the parts of the message.
+	MRs []string
+
+	// Status is Delivered once all the parts have been delivered, else the
+	// status of the first part to fail.
+	Status gsm.DeliveryStatus
+
+	// Time is the discharge time of the status report that determined the
+	// outcome.
+	Time time.Time
+}
+
+// DeliveryHandler receives the outcome of delivering messages sent from the
+// spool.
+type DeliveryHandler func(Delivery)
+
+func (o DeliveryHandler) applyOption(s *Spool) {
+	s.dh = o
+}
+
+// WithDeliveryHandler specifies a handler that receives the outcome of
+// delivering each message sent from the spool, once it is known.
+//
+// The outcome is determined from the status reports passed to Report, so
+// status reports must be requested using WithStatusReports, and passed to
+// Report as they are received.
+func WithDeliveryHandler(h DeliveryHandler) Option {
+	return h
+}
+
+// delivery tracks the parts of a sent message that are yet to be delivered.
+type delivery struct {
+	to          string
+	mrs         []string
+	sent        time.Time
+	undelivered map[string]bool
+}
+
+func newDelivery(to string, mrs []string, sent time.Time) *delivery {
+	d := delivery{to: to, mrs: mrs, sent: sent, undelivered: make(map[string]bool)}
+	for _, mr := range mrs {
+		d.undelivered[mr] = true
+	}
+	return &d
+}
+
+// Report records a status report against the sent message it refers to, by
+// adding a "Status" field to the header of the message file.
+//
+// The field contains the MR, the TP-ST, the delivery status and the
+// discharge time, e.g. "Status: 42,0,delivered,2020-05-01 10:37:38".  A long
+// message receives a field for each part.
+//
+// Once the outcome of the message as a whole is known, a "Delivery" field is
+// added containing the outcome and the discharge time, e.g. "Delivery:
+// delivered,2020-05-01 10:37:38", and the outcome is passed to the handler
+// provided by WithDeliveryHandler.  The message is delivered once all its
+// parts have been delivered, and has failed as soon as any part fails.
+//
+// Status reports are only recorded for messages sent with WithStatusReports.
+// Returns the name of the message file, or ErrUnknownMR if the MR does not
+// correspond to a message being tracked.
+func (s *Spool) Report(sr gsm.StatusReport) (string, error) {
+	name, d, err := s.report(sr)
+	if d != nil && s.dh != nil {
+		s.dh(*d)
+	}
+	return name, err
+}
+
+// report records the status report, and returns the outcome of the delivery
+// if the report completes it.
+func (s *Spool) report(sr gsm.StatusReport) (string, *Delivery, error) {
+	mr := strconv.Itoa(sr.MR)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name, ok := s.sent[mr]
+	if !ok {
+		return "", nil, ErrUnknownMR
+	}
+	b, err := s.ReadFile(filepath.Join(s.dir, sentDir, name))
+	if err != nil {
+		return "", nil, err
+	}
+	hdr, body := parse(b)
+	hdr.add("Status", fmt.Sprintf("%s,%d,%s,%s",
+		mr, sr.ST, sr.Status, sr.DT.Format("2006-01-02 15:04:05")))
+	var out *Delivery
+	if d, ok := s.deliveries[name]; ok && sr.Status != gsm.DeliveryPending {
+		delete(d.undelivered, mr)
+		if sr.Status != gsm.Delivered || len(d.undelivered) == 0 {
+			out = &Delivery{Name: name, To: d.to, MRs: d.mrs, Status: sr.Status, Time: sr.DT}
+			hdr.add("Delivery", fmt.Sprintf("%s,%s",
+				sr.Status, sr.DT.Format("2006-01-02 15:04:05")))
+		}
+	}
+	if err := s.write(sentDir, name, hdr, body); err != nil {
+		return "", nil, err
+	}
+	if out != nil {
+		delete(s.deliveries, name)
+	}
+	if sr.Status != gsm.DeliveryPending {
+		// final report, so the MR may be reused
+		delete(s.sent, mr)
+	}
+	return name, out, nil
+}
+
+var (
+	// ErrUnknownMR indicates a status report does not correspond to a message
+	// sent from the spool.
+	ErrUnknownMR = errors.New("unknown MR")
+)
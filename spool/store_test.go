@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package spool_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/gsm"
+	"github.com/warthog618/modem/spool"
+	"github.com/warthog618/sms/encoding/tpdu"
+)
+
+func TestStore(t *testing.T) {
+	sp, teardown := setupSpool(t, &sender{})
+	defer teardown()
+
+	scts := tpdu.Timestamp{Time: time.Date(2020, 5, 1, 10, 37, 38, 0, time.UTC)}
+	name, err := sp.Store(gsm.Message{Number: "+1234", Message: "hello", SCTS: scts})
+	require.Nil(t, err)
+	msg := readFile(t, filepath.Join(sp.Dir(), "incoming", name))
+	assert.True(t, strings.HasPrefix(msg, "From: +1234\nSent: 2020-05-01 10:37:38\nReceived: "), msg)
+	assert.True(t, strings.HasSuffix(msg, "\n\nhello\n"), msg)
+
+	// no SCTS
+	name, err = sp.Store(gsm.Message{Number: "+1234", Message: "hello"})
+	require.Nil(t, err)
+	msg = readFile(t, filepath.Join(sp.Dir(), "incoming", name))
+	assert.True(t, strings.HasPrefix(msg, "From: +1234\nReceived: "), msg)
+}
+
+func TestReport(t *testing.T) {
+	sp, teardown := setupSpool(t, &sender{}, spool.WithStatusReports())
+	defer teardown()
+
+	dt := time.Date(2020, 5, 1, 10, 37, 38, 0, time.UTC)
+	name, err := sp.Report(gsm.StatusReport{MR: 42, DT: dt})
+	assert.Equal(t, spool.ErrUnknownMR, err)
+	assert.Equal(t, "", name)
+
+	sname, err := sp.Submit("+1234", "hello")
+	require.Nil(t, err)
+	_, err = sp.Process()
+	require.Nil(t, err)
+
+	// pending report retains the MR
+	name, err = sp.Report(gsm.StatusReport{MR: 42, DT: dt, ST: 0x20, Status: gsm.DeliveryPending})
+	assert.Nil(t, err)
+	assert.Equal(t, sname, name)
+	name, err = sp.Report(gsm.StatusReport{MR: 42, DT: dt, Status: gsm.Delivered})
+	assert.Nil(t, err)
+	assert.Equal(t, sname, name)
+	name, err = sp.Report(gsm.StatusReport{MR: 43, DT: dt, ST: 0x41, Status: gsm.PermanentFailure})
+	assert.Nil(t, err)
+	assert.Equal(t, sname, name)
+	msg := readFile(t, filepath.Join(sp.Dir(), "sent", sname))
+	assert.True(t, strings.HasSuffix(msg, "\nMessage_id: 42,43\n"+
+		"Status: 42,32,pending,2020-05-01 10:37:38\n"+
+		"Status: 42,0,delivered,2020-05-01 10:37:38\n"+
+		"Status: 43,65,permanent failure,2020-05-01 10:37:38\n"+
+		"Delivery: permanent failure,2020-05-01 10:37:38\n"+
+		"\nhello\n"), msg)
+
+	// final report releases the MR
+	_, err = sp.Report(gsm.StatusReport{MR: 42, DT: dt})
+	assert.Equal(t, spool.ErrUnknownMR, err)
+}
+
+func TestWithStatusReports(t *testing.T) {
+	// not requested, so not tracked
+	s := &sender{}
+	sp, teardown := setupSpool(t, s)
+	defer teardown()
+	_, err := sp.Submit("+1234", "hello")
+	require.Nil(t, err)
+	_, err = sp.Process()
+	require.Nil(t, err)
+	assert.Equal(t, 0, s.options)
+	assert.Empty(t, sp.Undelivered())
+	_, err = sp.Report(gsm.StatusReport{MR: 42, Status: gsm.Delivered})
+	assert.Equal(t, spool.ErrUnknownMR, err)
+
+	// requested, and tracked until the MRs are reused
+	s = &sender{}
+	sp, teardown = setupSpool(t, s, spool.WithStatusReports())
+	defer teardown()
+	_, err = sp.Submit("+1234", "hello")
+	require.Nil(t, err)
+	_, err = sp.Process()
+	require.Nil(t, err)
+	sname, err := sp.Submit("+1234", "world")
+	require.Nil(t, err)
+	_, err = sp.Process()
+	require.Nil(t, err)
+	assert.Equal(t, 2, s.options)
+	assert.Equal(t, []string{sname}, sp.Undelivered())
+	name, err := sp.Report(gsm.StatusReport{MR: 42, Status: gsm.PermanentFailure})
+	assert.Nil(t, err)
+	assert.Equal(t, sname, name)
+	assert.Empty(t, sp.Undelivered())
+}
+
+func TestWithDeliveryHandler(t *testing.T) {
+	var dd []spool.Delivery
+	dh := func(d spool.Delivery) {
+		dd = append(dd, d)
+	}
+	sp, teardown := setupSpool(t, &sender{},
+		spool.WithStatusReports(),
+		spool.WithDeliveryHandler(dh))
+	defer teardown()
+
+	dt := time.Date(2020, 5, 1, 10, 37, 38, 0, time.UTC)
+
+	// all parts delivered
+	sname, err := sp.Submit("+1234", "hello")
+	require.Nil(t, err)
+	_, err = sp.Process()
+	require.Nil(t, err)
+	_, err = sp.Report(gsm.StatusReport{MR: 43, DT: dt, Status: gsm.Delivered})
+	assert.Nil(t, err)
+	assert.Empty(t, dd)
+	_, err = sp.Report(gsm.StatusReport{MR: 42, DT: dt.Add(time.Minute), Status: gsm.Delivered})
+	assert.Nil(t, err)
+	require.Equal(t, 1, len(dd))
+	assert.Equal(t, spool.Delivery{
+		Name:   sname,
+		To:     "+1234",
+		MRs:    []string{"42", "43"},
+		Status: gsm.Delivered,
+		Time:   dt.Add(time.Minute),
+	}, dd[0])
+	msg := readFile(t, filepath.Join(sp.Dir(), "sent", sname))
+	assert.True(t, strings.HasSuffix(msg,
+		"\nDelivery: delivered,2020-05-01 10:38:38\n\nhello\n"), msg)
+
+	// one part fails
+	sname, err = sp.Submit("+4321", "world")
+	require.Nil(t, err)
+	_, err = sp.Process()
+	require.Nil(t, err)
+	_, err = sp.Report(gsm.StatusReport{MR: 42, DT: dt, ST: 0x20, Status: gsm.DeliveryPending})
+	assert.Nil(t, err)
+	_, err = sp.Report(gsm.StatusReport{MR: 42, DT: dt, Status: gsm.Delivered})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(dd))
+	_, err = sp.Report(gsm.StatusReport{MR: 43, DT: dt, ST: 0x46, Status: gsm.Expired})
+	assert.Nil(t, err)
+	require.Equal(t, 2, len(dd))
+	assert.Equal(t, sname, dd[1].Name)
+	assert.Equal(t, "+4321", dd[1].To)
+	assert.Equal(t, gsm.Expired, dd[1].Status)
+	msg = readFile(t, filepath.Join(sp.Dir(), "sent", sname))
+	assert.True(t, strings.HasSuffix(msg,
+		"\nDelivery: expired,2020-05-01 10:37:38\n\nworld\n"), msg)
+}
@@ -0,0 +1,328 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package ssl provisions the TLS stack embedded in Quectel and SIMCom modems
+// with certificates and keys.
+//
+// The certificates and keys are uploaded to the modem filesystem and an SSL
+// context is configured to use them, after which the context can be used by
+// the modem's own TLS clients, such as its HTTPS and MQTT stacks.
+package ssl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// Dialect identifies the vendor specific TLS command set supported by the
+// modem.
+type Dialect int
+
+const (
+	// Quectel modems, using the +QSSLCFG commands.
+	Quectel Dialect = iota
+
+	// SIMCom modems, such as the A76xx series, using the +CSSLCFG commands.
+	SIMCom
+)
+
+// SSL decorates the AT modem with the ability to provision its TLS stack.
+type SSL struct {
+	*at.AT
+	dialect      Dialect
+	sslContextID int
+	contextID    int
+	connectID    int
+	openTimeout  time.Duration
+}
+
+// Option is a construction option for the SSL.
+type Option interface {
+	applyOption(*SSL)
+}
+
+// New creates a new SSL provisioner for the modem.
+func New(a *at.AT, options ...Option) *SSL {
+	s := SSL{
+		AT:          a,
+		contextID:   1,
+		connectID:   11,
+		openTimeout: time.Minute,
+	}
+	for _, option := range options {
+		option.applyOption(&s)
+	}
+	return &s
+}
+
+type dialectOption Dialect
+
+func (o dialectOption) applyOption(s *SSL) {
+	s.dialect = Dialect(o)
+}
+
+// WithDialect specifies the TLS command set supported by the modem.
+//
+// The default is Quectel.
+func WithDialect(d Dialect) Option {
+	return dialectOption(d)
+}
+
+type sslContextIDOption int
+
+func (o sslContextIDOption) applyOption(s *SSL) {
+	s.sslContextID = int(o)
+}
+
+// WithSSLContextID specifies the SSL context to be provisioned, from 0 to 5
+// for Quectel modems, or 0 to 9 for SIMCom modems.
+//
+// The default is 0.
+func WithSSLContextID(id int) Option {
+	return sslContextIDOption(id)
+}
+
+type contextIDOption int
+
+func (o contextIDOption) applyOption(s *SSL) {
+	s.contextID = int(o)
+}
+
+// WithContextID specifies the PDP context used by Verify on Quectel modems,
+// which must already be activated.
+//
+// The default is 1.
+func WithContextID(id int) Option {
+	return contextIDOption(id)
+}
+
+type openTimeoutOption time.Duration
+
+func (o openTimeoutOption) applyOption(s *SSL) {
+	s.openTimeout = time.Duration(o)
+}
+
+// WithOpenTimeout specifies the maximum time allowed by Verify for the TLS
+// handshake to complete.
+//
+// The default is 1 minute.
+func WithOpenTimeout(d time.Duration) Option {
+	return openTimeoutOption(d)
+}
+
+// Credentials are the PEM encoded certificates and key used to establish TLS
+// connections.
+type Credentials struct {
+	// CA is the certificate of the CA used to verify the server.
+	//
+	// If empty the server is not verified.
+	CA []byte
+
+	// Cert is the client certificate.
+	//
+	// If empty the client does not authenticate itself to the server.
+	Cert []byte
+
+	// Key is the private key corresponding to the client certificate.
+	Key []byte
+}
+
+// ProvisionTLS uploads the credentials to the modem and configures the SSL
+// context to use them.
+//
+// Any files previously uploaded for the SSL context are replaced.
+func (s *SSL) ProvisionTLS(creds Credentials) error {
+	if len(creds.Cert) != 0 && len(creds.Key) == 0 {
+		return ErrNoKey
+	}
+	if s.dialect == SIMCom {
+		return s.provisionSIMCom(creds)
+	}
+	ctx := s.sslContextID
+	cmds := []string{
+		fmt.Sprintf("+QSSLCFG=\"sslversion\",%d,4", ctx),
+		fmt.Sprintf("+QSSLCFG=\"ciphersuite\",%d,0xFFFF", ctx),
+	}
+	files := []struct {
+		cfg  string
+		name string
+		data []byte
+	}{
+		{"cacert", fmt.Sprintf("UFS:ca%d.pem", ctx), creds.CA},
+		{"clientcert", fmt.Sprintf("UFS:cert%d.pem", ctx), creds.Cert},
+		{"clientkey", fmt.Sprintf("UFS:key%d.pem", ctx), creds.Key},
+	}
+	for _, f := range files {
+		if len(f.data) == 0 {
+			continue
+		}
+		if err := s.upload(f.name, f.data); err != nil {
+			return err
+		}
+		cmds = append(cmds, fmt.Sprintf("+QSSLCFG=\"%s\",%d,\"%s\"", f.cfg, ctx, f.name))
+	}
+	// 0 - no authentication, 1 - server authentication, 2 - mutual
+	secLevel := 0
+	if len(creds.CA) != 0 {
+		secLevel = 1
+		if len(creds.Cert) != 0 {
+			secLevel = 2
+		}
+	}
+	cmds = append(cmds, fmt.Sprintf("+QSSLCFG=\"seclevel\",%d,%d", ctx, secLevel))
+	return s.commands(cmds...)
+}
+
+// provisionSIMCom uploads the credentials to a SIMCom modem and configures
+// the SSL context to use them.
+func (s *SSL) provisionSIMCom(creds Credentials) error {
+	ctx := s.sslContextID
+	cmds := []string{
+		fmt.Sprintf("+CSSLCFG=\"sslversion\",%d,4", ctx),
+	}
+	files := []struct {
+		cfg  string
+		name string
+		data []byte
+	}{
+		{"cacert", fmt.Sprintf("ca%d.pem", ctx), creds.CA},
+		{"clientcert", fmt.Sprintf("cert%d.pem", ctx), creds.Cert},
+		{"clientkey", fmt.Sprintf("key%d.pem", ctx), creds.Key},
+	}
+	for _, f := range files {
+		if len(f.data) == 0 {
+			continue
+		}
+		// the file may not exist, so ignore any error.
+		s.Command(fmt.Sprintf("+CCERTDELE=\"%s\"", f.name))
+		cmd := fmt.Sprintf("+CCERTDOWN=\"%s\",%d", f.name, len(f.data))
+		if _, err := s.DataCommand(cmd, f.data); err != nil {
+			return fmt.Errorf("AT%s returned error: %w", cmd, err)
+		}
+		cmds = append(cmds, fmt.Sprintf("+CSSLCFG=\"%s\",%d,\"%s\"", f.cfg, ctx, f.name))
+	}
+	// 0 - no authentication, 1 - server authentication, 2 - mutual
+	authMode := 0
+	if len(creds.CA) != 0 {
+		authMode = 1
+		if len(creds.Cert) != 0 {
+			authMode = 2
+		}
+	}
+	cmds = append(cmds, fmt.Sprintf("+CSSLCFG=\"authmode\",%d,%d", ctx, authMode))
+	return s.commands(cmds...)
+}
+
+// Verify checks the provisioned SSL context by opening, and then closing, a
+// TLS connection to the server.
+func (s *SSL) Verify(host string, port int) error {
+	prefix := "+QSSLOPEN:"
+	if s.dialect == SIMCom {
+		prefix = "+CCHOPEN:"
+	}
+	done := make(chan []string, 1)
+	err := s.AddIndication(prefix, func(info []string) {
+		done <- info
+	})
+	if err != nil {
+		return err
+	}
+	defer s.CancelIndication(prefix)
+	if s.dialect == SIMCom {
+		// the SIMCom TLS client uses session 0 and the PDP context
+		// configured with +CGDCONT.
+		err = s.commands("+CCHSTART")
+		if err != nil {
+			return err
+		}
+		defer s.Command("+CCHSTOP")
+		err = s.commands(
+			fmt.Sprintf("+CCHSSLCFG=0,%d", s.sslContextID),
+			fmt.Sprintf("+CCHOPEN=0,\"%s\",%d,2", host, port))
+		if err != nil {
+			return err
+		}
+		defer s.Command("+CCHCLOSE=0")
+	} else {
+		cmd := fmt.Sprintf("+QSSLOPEN=%d,%d,%d,\"%s\",%d,0",
+			s.contextID, s.sslContextID, s.connectID, host, port)
+		if err = s.commands(cmd); err != nil {
+			return err
+		}
+		defer s.Command(fmt.Sprintf("+QSSLCLOSE=%d", s.connectID))
+	}
+	select {
+	case i := <-done:
+		return parseOpen(i[0])
+	case <-time.After(s.openTimeout):
+		return at.ErrDeadlineExceeded
+	case <-s.Closed():
+		return at.ErrClosed
+	}
+}
+
+// commands issues a sequence of commands, stopping at the first error.
+func (s *SSL) commands(cmds ...string) error {
+	for _, cmd := range cmds {
+		if _, err := s.Command(cmd); err != nil {
+			return fmt.Errorf("AT%s returned error: %w", cmd, err)
+		}
+	}
+	return nil
+}
+
+// upload writes the data to the named file on the modem filesystem,
+// replacing any existing file.
+func (s *SSL) upload(name string, data []byte) error {
+	// the file may not exist, so ignore any error.
+	s.Command(fmt.Sprintf("+QFDEL=\"%s\"", name))
+	cmd := fmt.Sprintf("+QFUPL=\"%s\",%d", name, len(data))
+	if _, err := s.DataCommand(cmd, data); err != nil {
+		return fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	return nil
+}
+
+// parseOpen parses the +QSSLOPEN: <connectID>,<err> and
+// +CCHOPEN: <session>,<err> indications.
+func parseOpen(l string) error {
+	fields := info.Fields(strings.TrimSpace(l[strings.Index(l, ":")+1:]))
+	if len(fields) < 2 {
+		return ErrMalformedResponse
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return ErrMalformedResponse
+	}
+	if code != 0 {
+		return OpenError(code)
+	}
+	return nil
+}
+
+// OpenError indicates Verify failed to establish a TLS connection.
+//
+// The value is the vendor specific error code, such as 565 for a DNS failure,
+// or 566 for a failure to connect to the server, on Quectel modems.
+type OpenError int
+
+func (e OpenError) Error() string {
+	return "TLS open failed: " + strconv.Itoa(int(e))
+}
+
+var (
+	// ErrMalformedResponse indicates the modem returned a badly formed
+	// response.
+	ErrMalformedResponse = errors.New("modem returned malformed response")
+
+	// ErrNoKey indicates a client certificate was provided without the
+	// corresponding key.
+	ErrNoKey = errors.New("no key for client certificate")
+)
@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package ssl_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/ssl"
+)
+
+func TestProvisionTLS(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QSSLCFG=\"sslversion\",2,4\r\n":                 {"\r\nOK\r\n"},
+		"AT+QSSLCFG=\"ciphersuite\",2,0xFFFF\r\n":           {"\r\nOK\r\n"},
+		"AT+QFDEL=\"UFS:ca2.pem\"\r\n":                      {"\r\n+CME ERROR: 405\r\n"},
+		"AT+QFUPL=\"UFS:ca2.pem\",6\r":                      {"\r\nCONNECT\r\n"},
+		"ca-pem":                                            {"+QFUPL: 6,1234\r\n", "\r\nOK\r\n"},
+		"AT+QSSLCFG=\"cacert\",2,\"UFS:ca2.pem\"\r\n":       {"\r\nOK\r\n"},
+		"AT+QFDEL=\"UFS:cert2.pem\"\r\n":                    {"\r\nOK\r\n"},
+		"AT+QFUPL=\"UFS:cert2.pem\",8\r":                    {"\r\nCONNECT\r\n"},
+		"cert-pem":                                          {"+QFUPL: 8,1234\r\n", "\r\nOK\r\n"},
+		"AT+QSSLCFG=\"clientcert\",2,\"UFS:cert2.pem\"\r\n": {"\r\nOK\r\n"},
+		"AT+QFDEL=\"UFS:key2.pem\"\r\n":                     {"\r\nOK\r\n"},
+		"AT+QFUPL=\"UFS:key2.pem\",7\r":                     {"\r\nCONNECT\r\n"},
+		"key-pem":                                           {"+QFUPL: 7,1234\r\n", "\r\nOK\r\n"},
+		"AT+QSSLCFG=\"clientkey\",2,\"UFS:key2.pem\"\r\n":   {"\r\nOK\r\n"},
+		"AT+QSSLCFG=\"seclevel\",2,2\r\n":                   {"\r\nOK\r\n"},
+		"AT+QSSLCFG=\"seclevel\",2,1\r\n":                   {"\r\nOK\r\n"},
+		"AT+QSSLCFG=\"seclevel\",2,0\r\n":                   {"\r\nOK\r\n"},
+	}
+	s, mm := setupModem(t, cmdSet, ssl.WithSSLContextID(2))
+	defer teardownModem(mm)
+
+	patterns := []struct {
+		name  string
+		creds ssl.Credentials
+		err   error
+	}{
+		{
+			"mutual",
+			ssl.Credentials{
+				CA:   []byte("ca-pem"),
+				Cert: []byte("cert-pem"),
+				Key:  []byte("key-pem"),
+			},
+			nil,
+		},
+		{
+			"server",
+			ssl.Credentials{CA: []byte("ca-pem")},
+			nil,
+		},
+		{
+			"none",
+			ssl.Credentials{},
+			nil,
+		},
+		{
+			"no key",
+			ssl.Credentials{
+				CA:   []byte("ca-pem"),
+				Cert: []byte("cert-pem"),
+			},
+			ssl.ErrNoKey,
+		},
+		{
+			"upload error",
+			ssl.Credentials{CA: []byte("bad-pem")},
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			cmdSet["AT+QFUPL=\"UFS:ca2.pem\",7\r"] = []string{"\r\nCONNECT\r\n"}
+			err := s.ProvisionTLS(p.creds)
+			if p.err == nil {
+				assert.Nil(t, err)
+			} else {
+				require.NotNil(t, err)
+				assert.True(t, errors.Is(err, p.err), err)
+			}
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QSSLOPEN=1,0,11,\"example.com\",443,0\r\n": {"\r\nOK\r\n", "+QSSLOPEN: 11,0\r\n"},
+		"AT+QSSLOPEN=1,0,11,\"badhost\",443,0\r\n":     {"\r\nOK\r\n", "+QSSLOPEN: 11,565\r\n"},
+		"AT+QSSLOPEN=1,0,11,\"slow\",443,0\r\n":        {"\r\nOK\r\n"},
+		"AT+QSSLOPEN=1,0,11,\"junk\",443,0\r\n":        {"\r\nOK\r\n", "+QSSLOPEN: 11\r\n"},
+		"AT+QSSLCLOSE=11\r\n":                          {"\r\nOK\r\n"},
+	}
+	s, mm := setupModem(t, cmdSet, ssl.WithOpenTimeout(50*time.Millisecond))
+	defer teardownModem(mm)
+
+	err := s.Verify("example.com", 443)
+	assert.Nil(t, err)
+
+	err = s.Verify("badhost", 443)
+	assert.Equal(t, ssl.OpenError(565), err)
+	assert.Equal(t, "TLS open failed: 565", err.Error())
+
+	err = s.Verify("slow", 443)
+	assert.Equal(t, at.ErrDeadlineExceeded, err)
+
+	err = s.Verify("junk", 443)
+	assert.Equal(t, ssl.ErrMalformedResponse, err)
+
+	err = s.Verify("unknown", 443)
+	assert.Equal(t, at.ErrError, errors.Unwrap(err))
+}
+
+func TestProvisionTLSSIMCom(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CSSLCFG=\"sslversion\",3,4\r\n":             {"\r\nOK\r\n"},
+		"AT+CCERTDELE=\"ca3.pem\"\r\n":                  {"\r\nERROR\r\n"},
+		"AT+CCERTDOWN=\"ca3.pem\",6\r":                  {"\r\n>"},
+		"ca-pem":                                        {"\r\nOK\r\n"},
+		"AT+CSSLCFG=\"cacert\",3,\"ca3.pem\"\r\n":       {"\r\nOK\r\n"},
+		"AT+CCERTDELE=\"cert3.pem\"\r\n":                {"\r\nOK\r\n"},
+		"AT+CCERTDOWN=\"cert3.pem\",8\r":                {"\r\n>"},
+		"cert-pem":                                      {"\r\nOK\r\n"},
+		"AT+CSSLCFG=\"clientcert\",3,\"cert3.pem\"\r\n": {"\r\nOK\r\n"},
+		"AT+CCERTDELE=\"key3.pem\"\r\n":                 {"\r\nOK\r\n"},
+		"AT+CCERTDOWN=\"key3.pem\",7\r":                 {"\r\n>"},
+		"key-pem":                                       {"\r\nOK\r\n"},
+		"AT+CSSLCFG=\"clientkey\",3,\"key3.pem\"\r\n":   {"\r\nOK\r\n"},
+		"AT+CSSLCFG=\"authmode\",3,2\r\n":               {"\r\nOK\r\n"},
+	}
+	s, mm := setupModem(t, cmdSet, ssl.WithDialect(ssl.SIMCom), ssl.WithSSLContextID(3))
+	defer teardownModem(mm)
+
+	err := s.ProvisionTLS(ssl.Credentials{
+		CA:   []byte("ca-pem"),
+		Cert: []byte("cert-pem"),
+		Key:  []byte("key-pem"),
+	})
+	assert.Nil(t, err)
+
+	err = s.ProvisionTLS(ssl.Credentials{CA: []byte("bad-pem")})
+	require.NotNil(t, err)
+	assert.True(t, errors.Is(err, at.ErrError), err)
+}
+
+func TestVerifySIMCom(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+CCHSTART\r\n":                        {"\r\nOK\r\n", "+CCHSTART: 0\r\n"},
+		"AT+CCHSSLCFG=0,0\r\n":                   {"\r\nOK\r\n"},
+		"AT+CCHOPEN=0,\"example.com\",443,2\r\n": {"\r\nOK\r\n", "+CCHOPEN: 0,0\r\n"},
+		"AT+CCHOPEN=0,\"badhost\",443,2\r\n":     {"\r\nOK\r\n", "+CCHOPEN: 0,4\r\n"},
+		"AT+CCHCLOSE=0\r\n":                      {"\r\nOK\r\n"},
+		"AT+CCHSTOP\r\n":                         {"\r\nOK\r\n"},
+	}
+	s, mm := setupModem(t, cmdSet,
+		ssl.WithDialect(ssl.SIMCom),
+		ssl.WithOpenTimeout(50*time.Millisecond))
+	defer teardownModem(mm)
+
+	err := s.Verify("example.com", 443)
+	assert.Nil(t, err)
+
+	err = s.Verify("badhost", 443)
+	assert.Equal(t, ssl.OpenError(4), err)
+
+	err = s.Verify("unknown", 443)
+	assert.Equal(t, at.ErrError, errors.Unwrap(err))
+}
+
+type mockModem struct {
+	cmdSet map[string][]string
+	closed bool
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if data == nil {
+		return 0, at.ErrClosed
+	}
+	copy(p, data) // assumes p is empty
+	if !ok {
+		return len(data), fmt.Errorf("closed with data")
+	}
+	return len(data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	if mm.closed {
+		return 0, at.ErrClosed
+	}
+	v := mm.cmdSet[string(p)]
+	if len(v) == 0 {
+		mm.r <- []byte("\r\nERROR\r\n")
+	} else {
+		for _, l := range v {
+			mm.r <- []byte(l)
+		}
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) Close() error {
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
+
+func setupModem(t *testing.T, cmdSet map[string][]string, options ...ssl.Option) (*ssl.SSL, *mockModem) {
+	mm := &mockModem{cmdSet: cmdSet, r: make(chan []byte, 10)}
+	s := ssl.New(at.New(mm), options...)
+	require.NotNil(t, s)
+	return s, mm
+}
+
+func teardownModem(mm *mockModem) {
+	mm.Close()
+}
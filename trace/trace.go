@@ -10,16 +10,25 @@ import (
 	"io"
 	"log"
 	"os"
+	"sync/atomic"
 )
 
 // Trace is a trace log on an io.ReadWriter.
 //
 // All reads and writes are written to the logger.
+//
+// Trace implements at.Correlator, so traffic for a command issued by an
+// at.AT is prefixed with the correlation ID of the command, e.g. "#42 ".
 type Trace struct {
 	rw   io.ReadWriter
 	l    Logger
 	wfmt string
 	rfmt string
+
+	// the correlation ID of the command in progress, or 0 if none.
+	//
+	// Accessed atomically.
+	id uint64
 }
 
 // Logger defines the interface used to log trace messages.
@@ -69,10 +78,16 @@ func WithLogger(l Logger) Option {
 	}
 }
 
+// Correlate sets the correlation ID used to prefix subsequent traces, with 0
+// removing the prefix.
+func (t *Trace) Correlate(id uint64) {
+	atomic.StoreUint64(&t.id, id)
+}
+
 func (t *Trace) Read(p []byte) (n int, err error) {
 	n, err = t.rw.Read(p)
 	if n > 0 {
-		t.l.Printf(t.rfmt, p[:n])
+		t.log(t.rfmt, p[:n])
 	}
 	return n, err
 }
@@ -80,7 +95,15 @@ func (t *Trace) Read(p []byte) (n int, err error) {
 func (t *Trace) Write(p []byte) (n int, err error) {
 	n, err = t.rw.Write(p)
 	if n > 0 {
-		t.l.Printf(t.wfmt, p[:n])
+		t.log(t.wfmt, p[:n])
 	}
 	return n, err
 }
+
+func (t *Trace) log(format string, p []byte) {
+	if id := atomic.LoadUint64(&t.id); id != 0 {
+		t.l.Printf("#%d "+format, id, p)
+		return
+	}
+	t.l.Printf(format, p)
+}
@@ -76,3 +76,21 @@ func TestWriteFormat(t *testing.T) {
 	assert.Equal(t, 3, n)
 	assert.Equal(t, []byte("W: [116 119 111]\n"), b.Bytes())
 }
+
+func TestCorrelate(t *testing.T) {
+	mrw := bytes.NewBufferString("one")
+	b := bytes.Buffer{}
+	l := log.New(&b, "", 0)
+	tr := trace.New(mrw, trace.WithLogger(l))
+	require.NotNil(t, tr)
+	tr.Correlate(42)
+	_, err := tr.Write([]byte("two"))
+	assert.Nil(t, err)
+	i := make([]byte, 10)
+	_, err = tr.Read(i)
+	assert.Nil(t, err)
+	tr.Correlate(0)
+	_, err = tr.Write([]byte("three"))
+	assert.Nil(t, err)
+	assert.Equal(t, "#42 w: two\n#42 r: onetwo\nw: three\n", b.String())
+}
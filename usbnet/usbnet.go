@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+// Package usbnet switches the USB composition of a modem between exposing
+// only serial ports and exposing a USB network interface, such as RNDIS, ECM
+// or MBIM, for higher throughput data than is possible over PPP.
+//
+// The composition commands are vendor specific, so the Dialect of the modem
+// must be provided.
+//
+// A change of composition only takes effect once the modem restarts, after
+// which the modem re-enumerates on the USB bus and the serial ports must be
+// reopened.  The mode can then be checked using Verify.
+package usbnet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/info"
+)
+
+// Dialect identifies the vendor specific USB composition command set
+// supported by the modem.
+type Dialect int
+
+const (
+	// Quectel modems, using +QCFG="usbnet".
+	Quectel Dialect = iota
+
+	// SIMCom modems, using +CUSBPIDSWITCH.
+	SIMCom
+)
+
+// Mode is a USB network composition.
+type Mode int
+
+const (
+	// Serial exposes serial ports along with the vendor QMI/RMNET interface,
+	// and is the factory default.
+	Serial Mode = iota
+
+	// ECM exposes a CDC Ethernet interface.
+	ECM
+
+	// MBIM exposes a Mobile Broadband Interface Model interface.
+	MBIM
+
+	// RNDIS exposes a Remote NDIS interface.
+	RNDIS
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Serial:
+		return "serial"
+	case ECM:
+		return "ECM"
+	case MBIM:
+		return "MBIM"
+	case RNDIS:
+		return "RNDIS"
+	}
+	return "unknown"
+}
+
+// HostInterface describes the network interface the host can expect once
+// the modem is in the mode.
+func (m Mode) HostInterface() string {
+	switch m {
+	case Serial:
+		return "qmi_wwan driver (wwanN), requiring a QMI client to connect"
+	case ECM:
+		return "cdc_ether driver (usbN or ethN), configured by DHCP"
+	case MBIM:
+		return "cdc_mbim driver (wwanN), requiring an MBIM client to connect"
+	case RNDIS:
+		return "rndis_host driver (usbN or ethN), configured by DHCP"
+	}
+	return "unknown"
+}
+
+// mode values by dialect.
+//
+// The SIMCom values are the USB PIDs of the compositions.
+var modes = map[Dialect]map[Mode]int{
+	Quectel: {Serial: 0, ECM: 1, MBIM: 2, RNDIS: 3},
+	SIMCom:  {Serial: 9001, ECM: 9018, RNDIS: 9011},
+}
+
+// USBNet decorates the AT modem with the ability to switch USB composition.
+type USBNet struct {
+	*at.AT
+	dialect Dialect
+}
+
+// New creates a new USBNet for the modem.
+func New(a *at.AT, dialect Dialect) *USBNet {
+	return &USBNet{AT: a, dialect: dialect}
+}
+
+// Mode returns the configured composition of the modem.
+//
+// This may differ from the current composition if the mode has been changed
+// and the modem not yet restarted.
+func (u *USBNet) Mode(options ...at.CommandOption) (Mode, error) {
+	cmd, prefix := "+QCFG=\"usbnet\"", "+QCFG"
+	if u.dialect == SIMCom {
+		cmd, prefix = "+CUSBPIDSWITCH?", "+CUSBPIDSWITCH"
+	}
+	i, err := u.Command(cmd, options...)
+	if err != nil {
+		return Serial, fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	for _, l := range i {
+		if !info.HasPrefix(l, prefix) {
+			continue
+		}
+		fields := info.Fields(info.TrimPrefix(l, prefix))
+		if u.dialect == Quectel {
+			// +QCFG: "usbnet",<mode>
+			if len(fields) < 2 || fields[0] != "usbnet" {
+				continue
+			}
+			fields = fields[1:]
+		}
+		v, err := strconv.Atoi(fields[0])
+		if err != nil {
+			break
+		}
+		for m, mv := range modes[u.dialect] {
+			if mv == v {
+				return m, nil
+			}
+		}
+		return Serial, ErrUnknownMode
+	}
+	return Serial, ErrMalformedResponse
+}
+
+// SetMode configures the composition of the modem and, if the mode has
+// changed, restarts the modem so the change takes effect.
+//
+// Returns true if the modem has been restarted, in which case the serial
+// ports must be reopened.
+func (u *USBNet) SetMode(m Mode, options ...at.CommandOption) (bool, error) {
+	v, ok := modes[u.dialect][m]
+	if !ok {
+		return false, ErrNotSupported
+	}
+	cur, err := u.Mode(options...)
+	if err == nil && cur == m {
+		return false, nil
+	}
+	cmd := fmt.Sprintf("+QCFG=\"usbnet\",%d", v)
+	if u.dialect == SIMCom {
+		// SIMCom modems restart themselves following the switch.
+		cmd = fmt.Sprintf("+CUSBPIDSWITCH=%d,1,1", v)
+	}
+	if _, err = u.Command(cmd, options...); err != nil {
+		return false, fmt.Errorf("AT%s returned error: %w", cmd, err)
+	}
+	if u.dialect == Quectel {
+		// the modem may restart before responding, so ignore any error.
+		u.Command("+CFUN=1,1", options...)
+	}
+	return true, nil
+}
+
+// Verify checks the composition of the modem matches the mode, such as after
+// the modem has restarted following SetMode.
+func (u *USBNet) Verify(m Mode, options ...at.CommandOption) error {
+	cur, err := u.Mode(options...)
+	if err != nil {
+		return err
+	}
+	if cur != m {
+		return ModeMismatchError{Expected: m, Actual: cur}
+	}
+	return nil
+}
+
+// ModeMismatchError indicates the composition of the modem does not match
+// that expected.
+type ModeMismatchError struct {
+	Expected Mode
+	Actual   Mode
+}
+
+func (e ModeMismatchError) Error() string {
+	return fmt.Sprintf("mode is %s, expected %s", e.Actual, e.Expected)
+}
+
+var (
+	// ErrMalformedResponse indicates the modem returned a badly formed
+	// response.
+	ErrMalformedResponse = errors.New("modem returned malformed response")
+
+	// ErrNotSupported indicates the mode is not supported by the dialect.
+	ErrNotSupported = errors.New("not supported by dialect")
+
+	// ErrUnknownMode indicates the modem is configured in a composition not
+	// known to this package.
+	ErrUnknownMode = errors.New("unknown mode")
+)
@@ -0,0 +1,220 @@
+// SPDX-License-Identifier: MIT
+//
+// Copyright © 2020 Kent Gibson <warthog618@gmail.com>.
+
+package usbnet_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/warthog618/modem/at"
+	"github.com/warthog618/modem/usbnet"
+)
+
+func TestMode(t *testing.T) {
+	patterns := []struct {
+		name    string
+		dialect usbnet.Dialect
+		cmdSet  map[string][]string
+		mode    usbnet.Mode
+		err     error
+	}{
+		{
+			"quectel rndis",
+			usbnet.Quectel,
+			map[string][]string{"AT+QCFG=\"usbnet\"\r\n": {"+QCFG: \"usbnet\",3\r\n", "OK\r\n"}},
+			usbnet.RNDIS,
+			nil,
+		},
+		{
+			"quectel unknown",
+			usbnet.Quectel,
+			map[string][]string{"AT+QCFG=\"usbnet\"\r\n": {"+QCFG: \"usbnet\",7\r\n", "OK\r\n"}},
+			usbnet.Serial,
+			usbnet.ErrUnknownMode,
+		},
+		{
+			"quectel malformed",
+			usbnet.Quectel,
+			map[string][]string{"AT+QCFG=\"usbnet\"\r\n": {"+QCFG: \"usbnet\"\r\n", "OK\r\n"}},
+			usbnet.Serial,
+			usbnet.ErrMalformedResponse,
+		},
+		{
+			"simcom ecm",
+			usbnet.SIMCom,
+			map[string][]string{"AT+CUSBPIDSWITCH?\r\n": {"+CUSBPIDSWITCH: 9018\r\n", "OK\r\n"}},
+			usbnet.ECM,
+			nil,
+		},
+		{
+			"error",
+			usbnet.SIMCom,
+			nil,
+			usbnet.Serial,
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			u, mm := setupModem(t, p.cmdSet, p.dialect)
+			defer teardownModem(mm)
+			m, err := u.Mode()
+			assert.True(t, errors.Is(err, p.err), err)
+			assert.Equal(t, p.mode, m)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestSetMode(t *testing.T) {
+	patterns := []struct {
+		name      string
+		dialect   usbnet.Dialect
+		cmdSet    map[string][]string
+		mode      usbnet.Mode
+		restarted bool
+		err       error
+	}{
+		{
+			"quectel",
+			usbnet.Quectel,
+			map[string][]string{
+				"AT+QCFG=\"usbnet\"\r\n":   {"+QCFG: \"usbnet\",0\r\n", "OK\r\n"},
+				"AT+QCFG=\"usbnet\",2\r\n": {"OK\r\n"},
+				"AT+CFUN=1,1\r\n":          {"OK\r\n"},
+			},
+			usbnet.MBIM,
+			true,
+			nil,
+		},
+		{
+			"quectel unchanged",
+			usbnet.Quectel,
+			map[string][]string{
+				"AT+QCFG=\"usbnet\"\r\n": {"+QCFG: \"usbnet\",2\r\n", "OK\r\n"},
+			},
+			usbnet.MBIM,
+			false,
+			nil,
+		},
+		{
+			"simcom",
+			usbnet.SIMCom,
+			map[string][]string{
+				"AT+CUSBPIDSWITCH?\r\n":         {"+CUSBPIDSWITCH: 9001\r\n", "OK\r\n"},
+				"AT+CUSBPIDSWITCH=9011,1,1\r\n": {"OK\r\n"},
+			},
+			usbnet.RNDIS,
+			true,
+			nil,
+		},
+		{
+			"simcom mbim",
+			usbnet.SIMCom,
+			nil,
+			usbnet.MBIM,
+			false,
+			usbnet.ErrNotSupported,
+		},
+		{
+			"error",
+			usbnet.SIMCom,
+			map[string][]string{
+				"AT+CUSBPIDSWITCH?\r\n": {"+CUSBPIDSWITCH: 9001\r\n", "OK\r\n"},
+			},
+			usbnet.ECM,
+			false,
+			at.ErrError,
+		},
+	}
+	for _, p := range patterns {
+		f := func(t *testing.T) {
+			u, mm := setupModem(t, p.cmdSet, p.dialect)
+			defer teardownModem(mm)
+			restarted, err := u.SetMode(p.mode)
+			assert.True(t, errors.Is(err, p.err), err)
+			assert.Equal(t, p.restarted, restarted)
+		}
+		t.Run(p.name, f)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	cmdSet := map[string][]string{
+		"AT+QCFG=\"usbnet\"\r\n": {"+QCFG: \"usbnet\",1\r\n", "OK\r\n"},
+	}
+	u, mm := setupModem(t, cmdSet, usbnet.Quectel)
+	defer teardownModem(mm)
+	err := u.Verify(usbnet.ECM)
+	assert.Nil(t, err)
+	err = u.Verify(usbnet.RNDIS)
+	assert.Equal(t, usbnet.ModeMismatchError{Expected: usbnet.RNDIS, Actual: usbnet.ECM}, err)
+	assert.Equal(t, "mode is ECM, expected RNDIS", err.Error())
+}
+
+func TestModeStrings(t *testing.T) {
+	assert.Equal(t, "serial", usbnet.Serial.String())
+	assert.Equal(t, "MBIM", usbnet.MBIM.String())
+	assert.Equal(t, "unknown", usbnet.Mode(9).String())
+	assert.Contains(t, usbnet.RNDIS.HostInterface(), "rndis_host")
+	assert.Contains(t, usbnet.ECM.HostInterface(), "cdc_ether")
+	assert.Equal(t, "unknown", usbnet.Mode(9).HostInterface())
+}
+
+type mockModem struct {
+	cmdSet map[string][]string
+	closed bool
+	// The buffer emulating characters emitted by the modem.
+	r chan []byte
+}
+
+func (mm *mockModem) Read(p []byte) (n int, err error) {
+	data, ok := <-mm.r
+	if data == nil {
+		return 0, at.ErrClosed
+	}
+	copy(p, data) // assumes p is empty
+	if !ok {
+		return len(data), fmt.Errorf("closed with data")
+	}
+	return len(data), nil
+}
+
+func (mm *mockModem) Write(p []byte) (n int, err error) {
+	if mm.closed {
+		return 0, at.ErrClosed
+	}
+	v := mm.cmdSet[string(p)]
+	if len(v) == 0 {
+		mm.r <- []byte("\r\nERROR\r\n")
+	} else {
+		for _, l := range v {
+			mm.r <- []byte(l)
+		}
+	}
+	return len(p), nil
+}
+
+func (mm *mockModem) Close() error {
+	if mm.closed == false {
+		mm.closed = true
+		close(mm.r)
+	}
+	return nil
+}
+
+func setupModem(t *testing.T, cmdSet map[string][]string, d usbnet.Dialect) (*usbnet.USBNet, *mockModem) {
+	mm := &mockModem{cmdSet: cmdSet, r: make(chan []byte, 10)}
+	u := usbnet.New(at.New(mm), d)
+	require.NotNil(t, u)
+	return u, mm
+}
+
+func teardownModem(mm *mockModem) {
+	mm.Close()
+}